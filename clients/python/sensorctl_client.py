@@ -0,0 +1,227 @@
+"""Python client for the sensorctl daemon REST API.
+
+Generated from internal/api/openapi.json by internal/pyclient; do not edit.
+Run `go generate ./internal/api` after changing the spec.
+
+Standard library only, so it can be dropped next to a notebook:
+
+    from sensorctl_client import Client
+    c = Client("http://rig-3:8090", lang="de")
+    c.get_capabilities()["sensors"]
+    c.get_metric_metadata("co2")["label"]
+
+Each operation in the spec is a method named after its operationId. Path
+parameters are positional, a request body is the dict after them, and query
+parameters are keywords (from_ for from). JSON responses are decoded, other
+content is returned as bytes, and an empty response is None. Streams such as
+stream_logs return a generator of decoded events once the daemon accepts
+them, and run until it closes the stream.
+"""
+
+import json
+import time
+import urllib.error
+import urllib.parse
+import urllib.request
+
+API_VERSION = "v1"
+
+
+class APIError(Exception):
+    """Raised for non-2xx responses."""
+
+    def __init__(self, status, message):
+        super().__init__(f"sensorctl api: {status} {message}")
+        self.status = status
+        self.message = message
+
+
+class NotFound(APIError):
+    """Raised for 404 responses, e.g. an unknown metric."""
+
+
+def _segment(value):
+    return urllib.parse.quote(str(value), safe="")
+
+
+class Client:
+    def __init__(self, base_url, lang=None, timeout=10.0, retries=3, backoff=0.25):
+        self.base_url = base_url.rstrip("/")
+        self.lang = lang
+        self.timeout = timeout
+        self.retries = retries  # extra attempts after connection errors and 5xx responses; POST is not retried
+        self.backoff = backoff  # seconds before the first retry, doubled on each attempt
+
+    def has_feature(self, name):
+        return name in self.get_capabilities().get("features", [])
+
+    def list_alerts(self, *, from_=None, to=None, at=None, window=None, type=None, sensor=None, limit=None):
+        """Recorded events that raised an alert, oldest first."""
+        return self._request("GET", "/alerts", query={"from": from_, "to": to, "at": at, "window": window, "type": type, "sensor": sensor, "limit": limit})
+
+    def get_capabilities(self):
+        """API versions, sensors, metrics, and features this daemon supports."""
+        return self._request("GET", "/capabilities")
+
+    def list_corrections(self):
+        """The calibration corrections applied to sensor readings."""
+        return self._request("GET", "/corrections")
+
+    def get_serial_trace(self):
+        """Recent raw serial traffic to and from every sensor, for bug reports."""
+        return self._request("GET", "/debug/serial-trace")
+
+    def list_events(self, *, from_=None, to=None, at=None, window=None, type=None, sensor=None, limit=None):
+        """Recorded alerts, connection events, markers, gaps, and other
+        annotations, oldest first."""
+        return self._request("GET", "/events", query={"from": from_, "to": to, "at": at, "window": window, "type": type, "sensor": sensor, "limit": limit})
+
+    def stream_logs(self, *, level=None):
+        """Follow the daemon's log as it is written, as server-sent events."""
+        return self._request("GET", "/logs/stream", query={"level": level}, stream=True)
+
+    def post_marker(self, body):
+        """Record a marker in the open session; a sync leader also broadcasts
+        it to followers."""
+        return self._request("POST", "/markers", body=body)
+
+    def list_contracts(self):
+        """Valid range, resolution, and expected rate of every polled metric."""
+        return self._request("GET", "/metrics/contracts")
+
+    def list_latest(self):
+        """Most recent value of every metric, raw and derived."""
+        return self._request("GET", "/metrics/latest")
+
+    def get_latest(self, name):
+        """Most recent value of one metric."""
+        return self._request("GET", f"/metrics/latest/{_segment(name)}")
+
+    def list_metric_metadata(self, *, lang=None):
+        """Metadata for every metric."""
+        return self._request("GET", "/metrics/metadata", query={"lang": lang or self.lang})
+
+    def get_metric_metadata(self, name, *, lang=None):
+        """Metadata for one metric."""
+        return self._request("GET", f"/metrics/metadata/{_segment(name)}", query={"lang": lang or self.lang})
+
+    def list_modules(self):
+        """Sensors, derived channels, and exporters, and whether each is
+        switched on."""
+        return self._request("GET", "/modules")
+
+    def set_module(self, kind, name, body):
+        """Switch a module on or off without restarting; the choice survives
+        restarts."""
+        return self._request("PUT", f"/modules/{_segment(kind)}/{_segment(name)}", body=body)
+
+    def get_open_api(self):
+        """This document, for the running daemon version."""
+        return self._request("GET", "/openapi.json")
+
+    def get_proto_descriptors(self, *, format=None):
+        """The gRPC API's proto descriptors, for client generators."""
+        return self._request("GET", "/proto", query={"format": format})
+
+    def calibrate(self, name, metric, body):
+        """Fit a calibration curve to reference points and, if the fit is good,
+        correct the metric with it from now on, kept for the connected probe's
+        serial number; recorded as a calibration event."""
+        return self._request("POST", f"/sensors/{_segment(name)}/calibrations/{_segment(metric)}", body=body)
+
+    def set_correction(self, name, metric, body):
+        """Correct a sensor's metric as slope × reading + offset from now on,
+        publishing the reading as read under <metric>_raw; recorded as a
+        calibration event."""
+        return self._request("PUT", f"/sensors/{_segment(name)}/corrections/{_segment(metric)}", body=body)
+
+    def delete_correction(self, name, metric):
+        """Stop correcting a sensor's metric: the connected probe's curve if it
+        has one, else the sensor's correction; recorded as a calibration event.
+        """
+        return self._request("DELETE", f"/sensors/{_segment(name)}/corrections/{_segment(metric)}")
+
+    def get_sensor_identity(self, name):
+        """The device a sensor is bound to and the one connected to it."""
+        return self._request("GET", f"/sensors/{_segment(name)}/identity")
+
+    def remap_sensor(self, name, body):
+        """Map a replacement probe to the sensor it stands in for, releasing
+        its held readings; recorded as an identity event."""
+        return self._request("PUT", f"/sensors/{_segment(name)}/identity", body=body)
+
+    def get_session_trends(self, id, *, limit=None):
+        """Compare a session's per-metric means with the sessions recorded
+        before it for the same subject on this rig."""
+        return self._request("GET", f"/sessions/{_segment(id)}/trends", query={"limit": limit})
+
+    def delete_subject(self, subject):
+        """Erase a subject's sessions, their event log entries and session
+        history, and the subject's pseudonyms."""
+        return self._request("DELETE", f"/subjects/{_segment(subject)}")
+
+    def _request(self, method, path, query=None, body=None, stream=False):
+        url = f"{self.base_url}/{API_VERSION}{path}"
+        query = {k: v for k, v in (query or {}).items() if v is not None}
+        if query:
+            url += "?" + urllib.parse.urlencode(query, doseq=True)
+        data = None if body is None else json.dumps(body).encode("utf-8")
+
+        if stream:
+            return self._events(self._open(method, url, data, "text/event-stream", None))
+        retries = self.retries if method in ("GET", "PUT", "DELETE") else 0
+        delay = self.backoff
+        for attempt in range(retries + 1):
+            if attempt:
+                time.sleep(delay)
+                delay *= 2
+            try:
+                return self._do(method, url, data)
+            except APIError as e:
+                if e.status < 500 or attempt == retries:
+                    raise
+            except urllib.error.URLError:
+                if attempt == retries:
+                    raise
+
+    def _do(self, method, url, data):
+        resp = self._open(method, url, data, "application/json", self.timeout)
+        content_type = resp.headers.get("Content-Type", "")
+        with resp:
+            raw = resp.read()
+        if not raw:
+            return None
+        if content_type.startswith("application/json"):
+            return json.loads(raw)
+        return raw
+
+    def _open(self, method, url, data, accept, timeout):
+        headers = {"Accept": accept}
+        if data is not None:
+            headers["Content-Type"] = "application/json"
+        req = urllib.request.Request(url, data=data, method=method, headers=headers)
+        try:
+            return urllib.request.urlopen(req, timeout=timeout)
+        except urllib.error.HTTPError as e:
+            raw = e.read(64 << 10).decode("utf-8", "replace")
+            try:
+                message = json.loads(raw)["error"]
+            except (ValueError, KeyError, TypeError):
+                message = raw.strip()
+            cls = NotFound if e.code == 404 else APIError
+            raise cls(e.code, message) from None
+
+    def _events(self, resp):
+        """Yield the data of each unnamed server-sent event until the daemon
+        closes the stream; named events, such as notices of entries dropped
+        for a slow reader, are skipped."""
+        with resp:
+            event = ""
+            for raw in resp:
+                line = raw.decode("utf-8", "replace").rstrip("\r\n")
+                if not line:
+                    event = ""
+                elif line.startswith("event: "):
+                    event = line[len("event: "):]
+                elif line.startswith("data: ") and not event:
+                    yield json.loads(line[len("data: "):])
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/demelere/sensor-control-modules/internal/device"
+	"github.com/demelere/sensor-control-modules/pkg/sensorstack"
+)
+
+func newAuditCommand() *command {
+	c := &command{
+		name:    "audit",
+		usage:   "sensorctl audit [sensor...]",
+		summary: "read back device settings and compare them with each sensor's profile; exits 1 on drift",
+		flags:   flag.NewFlagSet("audit", flag.ContinueOnError),
+	}
+	c.run = func(args []string) error {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		return runAudit(ctx, args)
+	}
+	return c
+}
+
+func runAudit(ctx context.Context, names []string) error {
+	want := map[string]bool{}
+	for _, name := range names {
+		want[name] = true
+	}
+
+	drifted, audited := 0, 0
+	for _, sc := range cfg.Sensors {
+		if len(want) > 0 && !want[sc.Name] || len(want) == 0 && !sc.Enabled {
+			continue
+		}
+		if _, ok := device.Drivers[sc.Driver]; !ok {
+			continue
+		}
+		audit, bad, err := sensorstack.Audit(ctx, cfg, sc)
+		if err != nil {
+			return fmt.Errorf("sensor %s: %w", sc.Name, err)
+		}
+		audited++
+		switch {
+		case audit.Error != "":
+			return fmt.Errorf("sensor %s: %s", sc.Name, audit.Error)
+		case bad:
+			drifted++
+			for _, m := range audit.Mismatches {
+				fmt.Printf("%s (profile %s): %v\n", sc.Name, audit.Profile, m)
+			}
+		case audit.Profile == "":
+			fmt.Printf("%s: no profile applies, skipped\n", sc.Name)
+		default:
+			fmt.Printf("%s: matches profile %s\n", sc.Name, audit.Profile)
+		}
+	}
+	if audited == 0 {
+		return usageError{fmt.Errorf("no matching sensors to audit")}
+	}
+	if drifted > 0 {
+		return fmt.Errorf("%d of %d sensors differ from their profiles", drifted, audited)
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+func newCompletionCommand(root *command) *command {
+	c := &command{
+		name:    "completion",
+		usage:   "sensorctl completion <bash|zsh|fish>",
+		summary: "print a shell completion script generated from the command tree",
+		flags:   flag.NewFlagSet("completion", flag.ContinueOnError),
+		args:    []string{"bash", "zsh", "fish"},
+	}
+	c.run = func(args []string) error {
+		if len(args) != 1 {
+			return usageError{fmt.Errorf("completion expects one shell (bash, zsh, fish)")}
+		}
+		switch args[0] {
+		case "bash":
+			writeBashCompletion(os.Stdout, root)
+		case "zsh":
+			writeZshCompletion(os.Stdout, root)
+		case "fish":
+			writeFishCompletion(os.Stdout, root)
+		default:
+			return usageError{fmt.Errorf("unsupported shell %q", args[0])}
+		}
+		return nil
+	}
+	return c
+}
+
+// words returns every token that may follow the command path: subcommands,
+// positional candidates, and flags.
+func (c *command) words() []string {
+	var out []string
+	for _, sub := range c.subcommands {
+		out = append(out, sub.name)
+	}
+	out = append(out, c.args...)
+	for _, f := range c.flagList() {
+		out = append(out, "-"+f.Name)
+	}
+	return out
+}
+
+func writeBashCompletion(w io.Writer, root *command) {
+	fmt.Fprintf(w, "# bash completion for %s, generated by `%s completion bash`\n", root.name, root.name)
+	fmt.Fprintf(w, "_%s() {\n", root.name)
+	fmt.Fprintf(w, "    local cur=\"${COMP_WORDS[COMP_CWORD]}\" cmdpath=%q w i\n", root.name)
+	fmt.Fprintln(w, "    for ((i=1; i<COMP_CWORD; i++)); do")
+	fmt.Fprintln(w, "        w=\"${COMP_WORDS[i]}\"")
+	fmt.Fprintln(w, "        case \"$cmdpath $w\" in")
+	root.walk("", func(path string, c *command) {
+		if c != root {
+			fmt.Fprintf(w, "            %q) cmdpath=%q ;;\n", path, path)
+		}
+	})
+	fmt.Fprintln(w, "        esac")
+	fmt.Fprintln(w, "    done")
+	fmt.Fprintln(w, "    case \"$cmdpath\" in")
+	root.walk("", func(path string, c *command) {
+		fmt.Fprintf(w, "        %q) COMPREPLY=($(compgen -W %q -- \"$cur\")) ;;\n", path, strings.Join(c.words(), " "))
+	})
+	fmt.Fprintln(w, "    esac")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintf(w, "complete -F _%s %s\n", root.name, root.name)
+}
+
+// zshItem formats a _describe entry; only the name's colons need escaping
+// since the first unescaped colon separates it from the description.
+func zshItem(name, desc string) string {
+	item := strings.ReplaceAll(name, ":", "\\:")
+	if desc != "" {
+		item += ":" + desc
+	}
+	return "'" + strings.ReplaceAll(item, "'", "'\\''") + "'"
+}
+
+func writeZshCompletion(w io.Writer, root *command) {
+	fmt.Fprintf(w, "#compdef %s\n# zsh completion for %s, generated by `%s completion zsh`\n", root.name, root.name, root.name)
+	fmt.Fprintf(w, "_%s() {\n", root.name)
+	fmt.Fprintf(w, "    local cmdpath=%q w\n", root.name)
+	fmt.Fprintln(w, "    local -a opts")
+	fmt.Fprintln(w, "    for w in ${words[2,CURRENT-1]}; do")
+	fmt.Fprintln(w, "        case \"$cmdpath $w\" in")
+	root.walk("", func(path string, c *command) {
+		if c != root {
+			fmt.Fprintf(w, "            (%q) cmdpath=%q ;;\n", path, path)
+		}
+	})
+	fmt.Fprintln(w, "        esac")
+	fmt.Fprintln(w, "    done")
+	fmt.Fprintln(w, "    case \"$cmdpath\" in")
+	root.walk("", func(path string, c *command) {
+		var opts []string
+		for _, sub := range c.subcommands {
+			opts = append(opts, zshItem(sub.name, sub.summary))
+		}
+		for _, a := range c.args {
+			opts = append(opts, zshItem(a, ""))
+		}
+		for _, f := range c.flagList() {
+			opts = append(opts, zshItem("-"+f.Name, f.Usage))
+		}
+		fmt.Fprintf(w, "        (%q) opts=(%s) ;;\n", path, strings.Join(opts, " "))
+	})
+	fmt.Fprintln(w, "    esac")
+	fmt.Fprintln(w, "    _describe 'command' opts")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintf(w, "_%s \"$@\"\n", root.name)
+}
+
+func writeFishCompletion(w io.Writer, root *command) {
+	fmt.Fprintf(w, "# fish completion for %s, generated by `%s completion fish`\n", root.name, root.name)
+	fmt.Fprintf(w, "complete -c %s -f\n", root.name)
+	root.walk("", func(path string, c *command) {
+		parts := strings.Fields(path)[1:]
+		cond := "__fish_use_subcommand"
+		if len(parts) > 0 {
+			cond = "__fish_seen_subcommand_from " + parts[len(parts)-1]
+		}
+		for _, sub := range c.subcommands {
+			fmt.Fprintf(w, "complete -c %s -n %q -a %s -d %q\n", root.name, cond, sub.name, sub.summary)
+		}
+		if len(c.args) > 0 {
+			fmt.Fprintf(w, "complete -c %s -n %q -a %q\n", root.name, cond, strings.Join(c.args, " "))
+		}
+		for _, f := range c.flagList() {
+			fmt.Fprintf(w, "complete -c %s -n %q -o %s -d %q\n", root.name, cond, f.Name, f.Usage)
+		}
+	})
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/demelere/sensor-control-modules/internal/atrest"
+)
+
+func newDecryptCommand() *command {
+	c := &command{
+		name:    "decrypt",
+		usage:   "sensorctl decrypt [-key source] [-o file] file",
+		summary: "decrypt a session file recorded with sessions.encryption_key",
+		flags:   flag.NewFlagSet("decrypt", flag.ContinueOnError),
+	}
+	keySource := c.flags.String("key", "", "key source: file:<path>, env:<variable>, or tpm:<handle> (default sessions.encryption_key)")
+	out := c.flags.String("o", "", "write the plaintext here instead of stdout")
+
+	c.run = func(args []string) error {
+		if len(args) != 1 {
+			return usageError{fmt.Errorf("decrypt expects exactly one file")}
+		}
+		source := *keySource
+		if source == "" {
+			source = cfg.Sessions.EncryptionKey
+		}
+		if source == "" {
+			return usageError{fmt.Errorf("no key: pass -key or set sessions.encryption_key")}
+		}
+		key, err := atrest.LoadKey(source)
+		if err != nil {
+			return err
+		}
+
+		in, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		r, err := atrest.NewReader(in, key)
+		if err != nil {
+			return fmt.Errorf("%s: %w", args[0], err)
+		}
+		w := io.Writer(os.Stdout)
+		if *out != "" {
+			f, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			w = f
+		}
+		_, err = io.Copy(w, r)
+		if errors.Is(err, atrest.ErrTruncated) {
+			return fmt.Errorf("%s: %w; the session was not closed, and everything up to the cut was written", args[0], err)
+		}
+		if errors.Is(err, atrest.ErrTrailingData) {
+			return fmt.Errorf("%s: %w; everything before it was written, but something was appended to the session after it was closed", args[0], err)
+		}
+		return err
+	}
+	return c
+}
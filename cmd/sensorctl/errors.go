@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"go.bug.st/serial"
+
+	"github.com/demelere/sensor-control-modules/internal/sensorerr"
+)
+
+// Exit codes are part of the CLI contract; scripts branch on them, so never
+// renumber an existing code, only append new ones.
+const (
+	exitOK               = 0
+	exitFailure          = 1 // anything not covered below
+	exitUsage            = 2
+	exitSensorNotFound   = 3
+	exitPermissionDenied = 4
+	exitInvalidResponse  = 5
+	exitTimeout          = 6 // the sensor did not reply within its read timeout
+	exitPortBusy         = 7
+)
+
+var errorCodes = map[int]string{
+	exitFailure:          "failure",
+	exitUsage:            "usage",
+	exitSensorNotFound:   "sensor_not_found",
+	exitPermissionDenied: "permission_denied",
+	exitInvalidResponse:  "invalid_response",
+	exitTimeout:          "timeout",
+	exitPortBusy:         "port_busy",
+}
+
+type usageError struct {
+	err error
+}
+
+func (ue usageError) Error() string {
+	return ue.err.Error()
+}
+
+func (ue usageError) Unwrap() error {
+	return ue.err
+}
+
+func exitCode(err error) int {
+	var ue usageError
+	port, isPort := portExitCode(err)
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &ue):
+		return exitUsage
+	case errors.Is(err, sensorerr.ErrNotFound):
+		return exitSensorNotFound
+	case errors.Is(err, os.ErrPermission):
+		return exitPermissionDenied
+	case isPort:
+		return port
+	case errors.Is(err, sensorerr.ErrInvalidResponse):
+		return exitInvalidResponse
+	case errors.Is(err, sensorerr.ErrTimeout), errors.Is(err, os.ErrDeadlineExceeded):
+		return exitTimeout
+	}
+	return exitFailure
+}
+
+// portExitCode maps a serial port error to its exit code. Other port errors,
+// e.g. a read timeout, are left to the checks that follow it in exitCode.
+func portExitCode(err error) (int, bool) {
+	var pe *serial.PortError
+	if !errors.As(err, &pe) {
+		return 0, false
+	}
+	switch pe.Code() {
+	case serial.PermissionDenied:
+		return exitPermissionDenied, true
+	case serial.PortBusy:
+		return exitPortBusy, true
+	case serial.PortNotFound:
+		return exitSensorNotFound, true
+	}
+	return 0, false
+}
+
+type jsonError struct {
+	Error    string `json:"error"`
+	Code     string `json:"code"`
+	ExitCode int    `json:"exit_code"`
+}
+
+// reportError prints err to stderr, as a single JSON object when -json-errors
+// is set, and returns the process exit code.
+func reportError(err error, asJSON bool) int {
+	code := exitCode(err)
+	if asJSON {
+		json.NewEncoder(os.Stderr).Encode(jsonError{Error: err.Error(), Code: errorCodes[code], ExitCode: code})
+	} else {
+		fmt.Fprintf(os.Stderr, "sensorctl: %v\n", err)
+	}
+	return code
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/demelere/sensor-control-modules/internal/correction"
+)
+
+func newFitCommand() *command {
+	c := &command{
+		name:    "fit",
+		usage:   "sensorctl fit [-method polynomial] [-degree 1] [-tolerance 0] [-calibration file -serial sn -metric name] [points]",
+		summary: "fit a calibration curve to reading/reference pairs, report its residuals, and optionally store it for a probe",
+		flags:   flag.NewFlagSet("fit", flag.ContinueOnError),
+	}
+	method := c.flags.String("method", "polynomial", "curve: polynomial or spline")
+	degree := c.flags.Int("degree", 1, "polynomial degree")
+	tolerance := c.flags.Float64("tolerance", 0, "largest residual accepted, in the reference's unit (0 is 1% of the reference span)")
+	path := c.flags.String("calibration", "", "calibration state file to store an accepted curve in")
+	serial := c.flags.String("serial", "", "serial number of the probe the curve is for")
+	sensorName := c.flags.String("sensor", "", "sensor the curve is for, for a probe without a serial number")
+	metric := c.flags.String("metric", "", "metric the curve corrects")
+	unit := c.flags.String("unit", "", "unit the points are in, if not the reading's own")
+	note := c.flags.String("note", "", "note stored with the curve, e.g. the reference gases")
+
+	c.run = func(args []string) error {
+		if len(args) > 1 {
+			return usageError{fmt.Errorf("fit takes at most one input file")}
+		}
+		if *path != "" && (*metric == "" || (*serial == "") == (*sensorName == "")) {
+			return usageError{fmt.Errorf("-calibration needs -metric and one of -serial or -sensor")}
+		}
+		in := io.Reader(os.Stdin)
+		if len(args) == 1 && args[0] != "-" {
+			f, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			in = f
+		}
+		points, err := readFitPoints(in)
+		if err != nil {
+			return err
+		}
+		fit, err := correction.FitCurve(points, correction.FitOptions{Method: *method, Degree: *degree, Tolerance: *tolerance})
+		if err != nil && !errors.Is(err, correction.ErrPoorFit) {
+			return usageError{err}
+		}
+		printFit(os.Stdout, fit)
+		if err != nil || *path == "" {
+			return err
+		}
+		set, err := correction.Open(*path)
+		if err != nil {
+			return err
+		}
+		cor := correction.Correction{Curve: &fit.Curve, Unit: *unit, Note: *note, Since: time.Now().UTC()}
+		if *serial != "" {
+			err = set.PutProbe(*serial, *metric, cor)
+		} else {
+			err = set.Put(*sensorName, *metric, cor)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("stored in %s; a running daemon picks it up on restart\n", *path)
+		return nil
+	}
+	return c
+}
+
+// readFitPoints reads one "reading reference" pair per line, separated by
+// spaces or a comma. Blank lines and lines starting with # are skipped.
+func readFitPoints(in io.Reader) ([]correction.Point, error) {
+	var points []correction.Point
+	sc := bufio.NewScanner(in)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(strings.ReplaceAll(line, ",", " "))
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: want a reading and a reference, got %q", n, line)
+		}
+		reading, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		reference, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		points = append(points, correction.Point{Reading: reading, Reference: reference})
+	}
+	return points, sc.Err()
+}
+
+func printFit(w io.Writer, fit correction.Fit) {
+	fmt.Fprintf(w, "%12s %12s %12s %12s\n", "reading", "reference", "corrected", "residual")
+	for i, p := range fit.Points {
+		fmt.Fprintf(w, "%12.4g %12.4g %12.4g %+12.4g\n", p.Reading, p.Reference, fit.Curve.Eval(p.Reading), fit.Residuals[i])
+	}
+	switch fit.Curve.Method {
+	case "polynomial":
+		fmt.Fprintf(w, "polynomial of degree %d in (reading - %g) / %g: %g\n", len(fit.Curve.Coefficients)-1, fit.Curve.Center, fit.Curve.Scale, fit.Curve.Coefficients)
+	case "spline":
+		fmt.Fprintf(w, "natural cubic spline through %d points; residuals are leave-one-out\n", len(fit.Curve.Knots))
+	}
+	fmt.Fprintf(w, "rmse %.4g, largest residual %.4g, tolerance %.4g\n", fit.RMSE, fit.MaxResidual, fit.Tolerance)
+	if fit.Exact {
+		fmt.Fprintln(w, "as many coefficients as points: the curve passes through each, so the residuals say nothing about the fit")
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/demelere/sensor-control-modules/internal/golden"
+	"github.com/demelere/sensor-control-modules/internal/reference"
+	"github.com/demelere/sensor-control-modules/internal/sim"
+)
+
+func newGoldenCommand() *command {
+	c := &command{
+		name:    "golden",
+		usage:   "sensorctl golden <record|check|scenario|reference> [flags]",
+		summary: "record a simulated reference session, assert pipeline outputs against it, validate against scenarios, or compare the math with published references",
+	}
+
+	record := &command{
+		name:    "record",
+		usage:   "sensorctl golden record -dir directory [-duration 10m] [-seed n] [-scenario file]",
+		summary: "simulate a session and store it with its pipeline outputs as the golden reference",
+		flags:   flag.NewFlagSet("record", flag.ContinueOnError),
+	}
+	recDir := record.flags.String("dir", "testdata/golden", "golden directory")
+	recDuration := record.flags.Duration("duration", sim.DefaultConfig().Duration, "simulated session length")
+	recSeed := record.flags.Int64("seed", sim.DefaultConfig().Seed, "simulator RNG seed, 0 for a random session")
+	recScenario := record.flags.String("scenario", "", "record a scenario file's session instead of the default ramp")
+	record.run = func(args []string) error {
+		if *recScenario != "" {
+			sc, err := sim.LoadScenario(*recScenario)
+			if err != nil {
+				return err
+			}
+			samples, _ := sc.Run()
+			if err := golden.Record(*recDir, samples); err != nil {
+				return err
+			}
+			fmt.Printf("recorded scenario %s in %s\n", sc.Name, *recDir)
+			return nil
+		}
+		cfg := sim.DefaultConfig()
+		cfg.Duration = *recDuration
+		cfg.Seed = *recSeed
+		if err := golden.Record(*recDir, sim.NewSimulator(cfg).Run()); err != nil {
+			return err
+		}
+		fmt.Printf("recorded golden session in %s\n", *recDir)
+		return nil
+	}
+
+	check := &command{
+		name:    "check",
+		usage:   "sensorctl golden check -dir directory [-tolerance 1e-9]",
+		summary: "replay the golden session and fail if any output drifted beyond tolerance",
+		flags:   flag.NewFlagSet("check", flag.ContinueOnError),
+	}
+	checkDir := check.flags.String("dir", "testdata/golden", "golden directory")
+	tolerance := check.flags.Float64("tolerance", 1e-9, "relative tolerance for each output")
+	check.run = func(args []string) error {
+		mismatches, err := golden.Check(*checkDir, *tolerance)
+		if err != nil {
+			return err
+		}
+		for _, m := range mismatches {
+			fmt.Println(m)
+		}
+		if len(mismatches) > 0 {
+			return fmt.Errorf("%d outputs differ from golden reference in %s", len(mismatches), *checkDir)
+		}
+		fmt.Println("golden outputs match")
+		return nil
+	}
+
+	scenario := &command{
+		name:    "scenario",
+		usage:   "sensorctl golden scenario scenario.json...",
+		summary: "play physiological scenarios and check the metabolic and threshold modules against their ground truth",
+		flags:   flag.NewFlagSet("scenario", flag.ContinueOnError),
+	}
+	scenario.run = func(args []string) error {
+		if len(args) == 0 {
+			return usageError{fmt.Errorf("expected at least one scenario file")}
+		}
+		failed := 0
+		for _, path := range args {
+			sc, err := sim.LoadScenario(path)
+			if err != nil {
+				return err
+			}
+			samples, findings := golden.Validate(sc)
+			fmt.Printf("%s (%d samples)\n", sc.Name, len(samples))
+			for _, f := range findings {
+				mark := "ok  "
+				if !f.OK() {
+					mark = "FAIL"
+					failed++
+				}
+				fmt.Printf("  %s %s\n", mark, f)
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d outputs missed their ground truth", failed)
+		}
+		return nil
+	}
+
+	ref := &command{
+		name:    "reference",
+		usage:   "sensorctl golden reference [-dir testdata/reference]",
+		summary: "compare the gas-exchange math with published reference datasets",
+		flags:   flag.NewFlagSet("reference", flag.ContinueOnError),
+	}
+	refDir := ref.flags.String("dir", "testdata/reference", "reference dataset directory")
+	ref.run = func(args []string) error {
+		datasets, err := reference.Load(*refDir)
+		if err != nil {
+			return err
+		}
+		failed := 0
+		for _, d := range datasets {
+			mismatches := reference.Check(d)
+			fmt.Printf("%s: %d/%d cases within %g\n", d.Name, len(d.Cases)-len(mismatches), len(d.Cases), d.Tolerance)
+			for _, m := range mismatches {
+				fmt.Printf("  FAIL %s\n", m)
+			}
+			failed += len(mismatches)
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d cases disagree with their reference", failed)
+		}
+		return nil
+	}
+
+	c.subcommands = []*command{record, check, scenario, ref}
+	return c
+}
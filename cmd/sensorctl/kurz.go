@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/demelere/sensor-control-modules/pkg/kurz"
+)
+
+func newKurzCommand() *command {
+	c := &command{
+		name:    "kurz",
+		usage:   "sensorctl kurz <backup|restore|diff|config|points|reset-totalizer> [flags]",
+		summary: "back up, restore, compare, or commission the Kurz meter's configuration, or reset its totalizer",
+	}
+
+	backup := &command{
+		name:    "backup",
+		usage:   "sensorctl kurz backup [-o file]",
+		summary: "save the meter's configuration parameters as JSON",
+		flags:   flag.NewFlagSet("backup", flag.ContinueOnError),
+	}
+	out := backup.flags.String("o", "", "output file, default stdout")
+	backup.run = func(args []string) error {
+		return withKurz(func(ctx context.Context, ks *kurz.KurzSensor) error {
+			s, err := ks.Backup(ctx)
+			if err != nil {
+				return err
+			}
+			if *out == "" {
+				data, _ := json.MarshalIndent(s, "", "  ")
+				fmt.Println(string(data))
+				return nil
+			}
+			if err := kurz.SaveSettings(*out, s); err != nil {
+				return err
+			}
+			fmt.Printf("saved %d parameters from meter %s to %s\n", len(s.Parameters), s.SerialNumber, *out)
+			return nil
+		})
+	}
+
+	restore := &command{
+		name:    "restore",
+		usage:   "sensorctl kurz restore file",
+		summary: "write a saved configuration to the meter and verify it",
+	}
+	restore.run = func(args []string) error {
+		s, err := loadKurzSettings(args)
+		if err != nil {
+			return err
+		}
+		return withKurz(func(ctx context.Context, ks *kurz.KurzSensor) error {
+			diffs, err := ks.Restore(ctx, s)
+			if err != nil {
+				return err
+			}
+			return reportKurzDiffs(diffs, "after restore")
+		})
+	}
+
+	diff := &command{
+		name:    "diff",
+		usage:   "sensorctl kurz diff file",
+		summary: "compare the meter's configuration with a saved one; exits 1 on drift",
+	}
+	diff.run = func(args []string) error {
+		want, err := loadKurzSettings(args)
+		if err != nil {
+			return err
+		}
+		return withKurz(func(ctx context.Context, ks *kurz.KurzSensor) error {
+			got, err := ks.Backup(ctx)
+			if err != nil {
+				return err
+			}
+			return reportKurzDiffs(kurz.Compare(want, got), "")
+		})
+	}
+
+	config := &command{
+		name:    "config",
+		usage:   "sensorctl kurz config [-flow-area ft2] [-cutoff sfpm] [-filter seconds]",
+		summary: "set the meter's flow area, low flow cutoff, or filter, then print its configuration",
+		flags:   flag.NewFlagSet("config", flag.ContinueOnError),
+	}
+	flowArea := config.flags.Float64("flow-area", 0, "duct cross-section in ft²")
+	cutoff := config.flags.Float64("cutoff", 0, "low flow cutoff in SFPM, 0 for none")
+	filter := config.flags.Float64("filter", 0, "output filter time constant in seconds, 0 for none")
+	config.run = func(args []string) error {
+		if len(args) > 0 {
+			return usageError{fmt.Errorf("config takes no positional arguments")}
+		}
+		set := map[string]bool{}
+		config.flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+		return withKurz(func(ctx context.Context, ks *kurz.KurzSensor) error {
+			if set["flow-area"] {
+				if err := ks.SetFlowArea(ctx, *flowArea); err != nil {
+					return err
+				}
+			}
+			if set["cutoff"] {
+				if err := ks.SetLowFlowCutoff(ctx, *cutoff); err != nil {
+					return err
+				}
+			}
+			if set["filter"] {
+				if err := ks.SetFilter(ctx, *filter); err != nil {
+					return err
+				}
+			}
+			c, err := ks.Config(ctx)
+			if err != nil {
+				return err
+			}
+			data, _ := json.MarshalIndent(c, "", "  ")
+			fmt.Println(string(data))
+			return nil
+		})
+	}
+
+	points := &command{
+		name:    "points",
+		usage:   "sensorctl kurz points [-n points]",
+		summary: "read each sensor point of a multipoint meter, and the duct's mean velocity and flow",
+		flags:   flag.NewFlagSet("points", flag.ContinueOnError),
+	}
+	nPoints := points.flags.Int("n", 0, "sensor points to read, default the sensor's array.points")
+	points.run = func(args []string) error {
+		if len(args) > 0 {
+			return usageError{fmt.Errorf("points takes no positional arguments")}
+		}
+		if *nPoints == 0 && cfg.Sensor("kurz").Array.Points == 0 {
+			return usageError{fmt.Errorf("-n is required when the kurz sensor has no array configured")}
+		}
+		return withKurz(func(ctx context.Context, ks *kurz.KurzSensor) error {
+			ps, err := ks.ReadPoints(ctx, *nPoints)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%-6s %14s %12s\n", "point", "velocity SFPM", "temp °F")
+			for _, p := range ps {
+				fmt.Printf("%-6d %14.1f %12.1f\n", p.Number, p.Velocity, p.Temperature)
+			}
+			mean := ks.MeanVelocity(ps)
+			area := cfg.Sensor("kurz").Array.FlowArea
+			if area == 0 {
+				if area, err = ks.FlowArea(ctx); err != nil {
+					return err
+				}
+			}
+			fmt.Printf("mean velocity %.1f SFPM over %g ft²: %.2f SCFM\n", mean, area, mean*area)
+			return nil
+		})
+	}
+
+	resetTotal := &command{
+		name:    "reset-totalizer",
+		usage:   "sensorctl kurz reset-totalizer",
+		summary: "zero the meter's totalized flow",
+	}
+	resetTotal.run = func(args []string) error {
+		if len(args) > 0 {
+			return usageError{fmt.Errorf("reset-totalizer takes no arguments")}
+		}
+		return withKurz(func(ctx context.Context, ks *kurz.KurzSensor) error {
+			if err := ks.ResetTotalizer(ctx); err != nil {
+				return err
+			}
+			fmt.Println("totalizer reset")
+			return nil
+		})
+	}
+
+	c.subcommands = []*command{backup, restore, diff, config, points, resetTotal}
+	return c
+}
+
+func loadKurzSettings(args []string) (kurz.Settings, error) {
+	if len(args) != 1 {
+		return kurz.Settings{}, usageError{fmt.Errorf("expected exactly one settings file")}
+	}
+	return kurz.LoadSettings(args[0])
+}
+
+// withKurz opens the configured meter for the duration of fn.
+func withKurz(fn func(ctx context.Context, ks *kurz.KurzSensor) error) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	sc := cfg.Sensor("kurz")
+	opts := []kurz.Option{kurz.WithBaudRate(sc.BaudRate), kurz.WithPort(sc.Port), kurz.WithReadRetries(sc.ReadRetries), kurz.WithArray(kurz.Array(sc.Array))}
+	if sc.Protocol == "modbus" {
+		opts = append(opts, kurz.WithModbus(sc.Address))
+	}
+	ks, err := kurz.NewKurzSensor(opts...)
+	if err != nil {
+		return err
+	}
+	if err := ks.Open(); err != nil {
+		return err
+	}
+	defer ks.Close()
+	return fn(ctx, ks)
+}
+
+func reportKurzDiffs(diffs []kurz.Difference, when string) error {
+	for _, d := range diffs {
+		fmt.Println(d)
+	}
+	if len(diffs) > 0 {
+		if when != "" {
+			return fmt.Errorf("%d parameters differ %s", len(diffs), when)
+		}
+		return fmt.Errorf("%d parameters differ", len(diffs))
+	}
+	fmt.Println("meter configuration matches")
+	return nil
+}
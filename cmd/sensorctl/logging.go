@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+
+	"github.com/demelere/sensor-control-modules/internal/config"
+	"github.com/demelere/sensor-control-modules/internal/logging"
+)
+
+// logStream carries every log entry to the API's live log stream.
+var logStream = logging.NewStream()
+
+// setupLogging routes driver logs to the sinks enabled in cfg, and always to
+// logStream. -v always adds stderr at debug level. With no sinks enabled
+// nothing is written, so stdout and stderr stay clean for scripts.
+func setupLogging(cfg config.Logging, verbose bool) (*logging.Logger, error) {
+	logger := logging.New()
+	logger.AddSink(logStream, logging.LevelDebug)
+
+	if verbose || cfg.Stderr.Enabled {
+		level, err := logging.ParseLevel(cfg.Stderr.Level)
+		if err != nil {
+			return nil, err
+		}
+		if verbose {
+			level = logging.LevelDebug
+		}
+		logger.AddSink(logging.NewWriterSink(os.Stderr), level)
+	}
+
+	if cfg.Journald.Enabled && logging.JournaldAvailable() {
+		level, err := logging.ParseLevel(cfg.Journald.Level)
+		if err != nil {
+			return nil, err
+		}
+		js, err := logging.NewJournaldSink("sensorctl")
+		if err != nil {
+			return nil, err
+		}
+		logger.AddSink(js, level)
+	}
+
+	if cfg.EventLog.Enabled && logging.EventLogAvailable() {
+		level, err := logging.ParseLevel(cfg.EventLog.Level)
+		if err != nil {
+			return nil, err
+		}
+		es, err := logging.NewEventLogSink(serviceName)
+		if err != nil {
+			return nil, err
+		}
+		logger.AddSink(es, level)
+	}
+
+	if cfg.File.Enabled {
+		level, err := logging.ParseLevel(cfg.File.Level)
+		if err != nil {
+			return nil, err
+		}
+		fs, err := logging.NewFileSink(cfg.File.Path, int64(cfg.File.MaxSizeMB)<<20, cfg.File.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		logger.AddSink(fs, level)
+	}
+
+	logging.CaptureStdLog(logger)
+	return logger, nil
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/demelere/sensor-control-modules/internal/config"
+	"github.com/demelere/sensor-control-modules/internal/membudget"
+	"github.com/demelere/sensor-control-modules/internal/units"
+)
+
+type command struct {
+	name        string
+	usage       string
+	summary     string
+	flags       *flag.FlagSet
+	args        []string // completion candidates for positional arguments
+	run         func(args []string) error
+	subcommands []*command
+}
+
+var (
+	verbose            bool
+	unitSystem         string
+	jsonErrors         bool
+	memBudget          string
+	configPath         string
+	printDefaultConfig bool
+
+	cfg *config.Config // loaded before dispatch, embedded defaults if -config is not set
+)
+
+func newRootCommand() *command {
+	root := &command{
+		name:    "sensorctl",
+		usage:   "sensorctl [global flags] <command> [args]",
+		summary: "discover, read, and manage rig sensors",
+		flags:   flag.NewFlagSet("sensorctl", flag.ContinueOnError),
+	}
+	root.flags.BoolVar(&verbose, "v", false, "print driver logs to stderr")
+	root.flags.StringVar(&unitSystem, "units", "si", "unit system for output: si or imperial")
+	root.flags.StringVar(&memBudget, "memory-budget", "", "cap on buffered history, e.g. 16MiB (default unlimited)")
+	root.flags.StringVar(&configPath, "config", "", "config file (JSON, YAML, or TOML) overlaid on the embedded defaults")
+	root.flags.BoolVar(&printDefaultConfig, "print-default-config", false, "print the embedded default config and exit")
+	root.flags.BoolVar(&jsonErrors, "json-errors", false, "report errors on stderr as a JSON object with a stable code")
+
+	root.subcommands = []*command{
+		newReadCommand(),
+		newSoakCommand(),
+		newGoldenCommand(),
+		newRunCommand(),
+		newServiceCommand(),
+		newResampleCommand(),
+		newRecorrectCommand(),
+		newFitCommand(),
+		newVerifyCommand(),
+		newDecryptCommand(),
+		newReidentifyCommand(),
+		newKurzCommand(),
+		newVaisalaCommand(),
+		newAuditCommand(),
+		newSupportBundleCommand(),
+		newCompletionCommand(root),
+		newManCommand(root),
+	}
+	return root
+}
+
+// walk calls fn for c and every command below it with the space separated
+// command path, e.g. "sensorctl read".
+func (c *command) walk(path string, fn func(path string, c *command)) {
+	if path == "" {
+		path = c.name
+	}
+	fn(path, c)
+	for _, sub := range c.subcommands {
+		sub.walk(path+" "+sub.name, fn)
+	}
+}
+
+func (c *command) flagList() []*flag.Flag {
+	var out []*flag.Flag
+	if c.flags != nil {
+		c.flags.VisitAll(func(f *flag.Flag) { out = append(out, f) })
+	}
+	return out
+}
+
+func (c *command) find(name string) *command {
+	for _, sub := range c.subcommands {
+		if sub.name == name {
+			return sub
+		}
+	}
+	return nil
+}
+
+func (c *command) printUsage(w io.Writer) {
+	fmt.Fprintf(w, "usage: %s\n\n%s\n", c.usage, c.summary)
+	if len(c.subcommands) > 0 {
+		fmt.Fprintln(w, "\ncommands:")
+		subs := append([]*command{}, c.subcommands...)
+		sort.Slice(subs, func(i, j int) bool { return subs[i].name < subs[j].name })
+		for _, sub := range subs {
+			fmt.Fprintf(w, "  %-12s %s\n", sub.name, sub.summary)
+		}
+	}
+	if c.flags != nil {
+		fmt.Fprintln(w, "\nflags:")
+		out := c.flags.Output()
+		c.flags.SetOutput(w)
+		c.flags.PrintDefaults()
+		c.flags.SetOutput(out)
+	}
+}
+
+// silenceFlags stops every flag set below c printing parse errors and usage
+// itself, so that each failure is reported once, by reportError, in the form
+// -json-errors asks for.
+func (c *command) silenceFlags() {
+	c.walk("", func(_ string, c *command) {
+		if c.flags != nil {
+			c.flags.SetOutput(io.Discard)
+			c.flags.Usage = func() {}
+		}
+	})
+}
+
+// parseFailed shows usage after a flag parse error, unless errors are
+// reported as JSON, and returns the error to report; -h is not a failure and
+// always shows usage.
+func (c *command) parseFailed(err error) error {
+	if errors.Is(err, flag.ErrHelp) || !jsonErrors {
+		c.printUsage(os.Stderr)
+	}
+	return usageError{err}
+}
+
+// execute parses c's flags and dispatches to the named subcommand or c.run.
+func (c *command) execute(args []string) error {
+	if c.flags != nil {
+		var err error
+		if args, err = parseInterspersed(c.flags, args, len(c.subcommands) == 0); err != nil {
+			return c.parseFailed(err)
+		}
+	}
+	return c.dispatch(args)
+}
+
+// parseInterspersed parses fs from args. For leaf commands flags may follow
+// positional arguments ("read vaisala -json"); otherwise parsing stops at the
+// first positional so the subcommand gets its own flags.
+func parseInterspersed(fs *flag.FlagSet, args []string, leaf bool) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if !leaf || len(args) == 0 {
+			return append(positional, args...), nil
+		}
+		if args[0] == "--" {
+			return append(positional, args[1:]...), nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func (c *command) dispatch(args []string) error {
+	if len(c.subcommands) > 0 {
+		if len(args) == 0 {
+			if !jsonErrors {
+				c.printUsage(os.Stderr)
+			}
+			return usageError{fmt.Errorf("missing command")}
+		}
+		switch args[0] {
+		case "-h", "-help", "--help": // commands without flags of their own, e.g. golden
+			c.printUsage(os.Stderr)
+			return flag.ErrHelp
+		}
+		sub := c.find(args[0])
+		if sub == nil {
+			return usageError{fmt.Errorf("unknown command %q", args[0])}
+		}
+		return sub.execute(args[1:])
+	}
+	return c.run(args)
+}
+
+func main() {
+	os.Exit(sensorctl())
+}
+
+// sensorctl runs the CLI and returns the exit code; it is separate from main so
+// deferred cleanup such as closing log sinks runs before the process exits.
+func sensorctl() int {
+	root := newRootCommand()
+	root.silenceFlags()
+	if err := root.flags.Parse(os.Args[1:]); err != nil { // global flags are needed before dispatch to configure logging
+		err = root.parseFailed(err)
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return reportError(err, jsonErrors)
+	}
+
+	if printDefaultConfig {
+		os.Stdout.Write(config.Default())
+		return exitOK
+	}
+	var err error
+	if cfg, err = config.Load(configPath); err != nil {
+		args := root.flags.Args()
+		if !errors.Is(err, os.ErrNotExist) || len(args) == 0 || args[0] != "run" {
+			return reportError(err, jsonErrors)
+		}
+		cfg, _ = config.Load("") // run provisions the missing config on first boot
+	}
+	logger, err := setupLogging(cfg.Logging, verbose)
+	if err != nil {
+		return reportError(err, jsonErrors)
+	}
+	defer logger.Close()
+
+	set := map[string]bool{}
+	root.flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if !set["units"] && cfg.Units != "" { // explicit flags win over the config file
+		unitSystem = cfg.Units
+	}
+	if !set["memory-budget"] {
+		memBudget = cfg.MemoryBudget
+	}
+
+	system, err := units.ParseSystem(unitSystem)
+	if err != nil {
+		return reportError(usageError{err}, jsonErrors)
+	}
+	units.SetSystem(system)
+
+	if memBudget != "" {
+		limit, err := membudget.ParseSize(memBudget)
+		if err != nil {
+			return reportError(usageError{err}, jsonErrors)
+		}
+		membudget.SetLimit(limit)
+	}
+
+	if err := root.dispatch(root.flags.Args()); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return reportError(err, jsonErrors)
+	}
+	return exitOK
+}
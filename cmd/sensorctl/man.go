@@ -0,0 +1,106 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+func newManCommand(root *command) *command {
+	c := &command{
+		name:    "man",
+		usage:   "sensorctl man [-dir directory]",
+		summary: "generate roff man pages for every command",
+		flags:   flag.NewFlagSet("man", flag.ContinueOnError),
+	}
+	dir := c.flags.String("dir", "", "write one page per command into this directory instead of printing the top-level page")
+
+	c.run = func(args []string) error {
+		if *dir == "" {
+			writeManPage(os.Stdout, root.name, root, root)
+			return nil
+		}
+		if err := os.MkdirAll(*dir, 0o755); err != nil {
+			return err
+		}
+		var err error
+		root.walk("", func(path string, cmd *command) {
+			if err != nil {
+				return
+			}
+			name := strings.ReplaceAll(path, " ", "-")
+			var f *os.File
+			if f, err = os.Create(filepath.Join(*dir, name+".1")); err != nil {
+				return
+			}
+			writeManPage(f, path, cmd, root)
+			err = f.Close()
+		})
+		return err
+	}
+	return c
+}
+
+func roffEscape(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "-", `\-`)
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = `\&` + s
+	}
+	return s
+}
+
+func writeManPage(w io.Writer, path string, c *command, root *command) {
+	name := strings.ReplaceAll(path, " ", "-")
+	fmt.Fprintf(w, ".TH %s 1 %q\n", strings.ToUpper(name), time.Now().Format("2006-01-02"))
+	fmt.Fprintf(w, ".SH NAME\n%s \\- %s\n", roffEscape(name), roffEscape(c.summary))
+	fmt.Fprintf(w, ".SH SYNOPSIS\n.B %s\n", roffEscape(strings.TrimPrefix(c.usage, "usage: ")))
+
+	if len(c.subcommands) > 0 {
+		fmt.Fprintln(w, ".SH COMMANDS")
+		subs := append([]*command{}, c.subcommands...)
+		sort.Slice(subs, func(i, j int) bool { return subs[i].name < subs[j].name })
+		for _, sub := range subs {
+			fmt.Fprintf(w, ".TP\n.B %s\n%s\n", roffEscape(sub.name), roffEscape(sub.summary))
+		}
+	}
+
+	if flags := c.flagList(); len(flags) > 0 {
+		fmt.Fprintln(w, ".SH OPTIONS")
+		for _, f := range flags {
+			fmt.Fprintf(w, ".TP\n.B \\-%s\n%s", roffEscape(f.Name), roffEscape(f.Usage))
+			if f.DefValue != "" && f.DefValue != "false" {
+				fmt.Fprintf(w, " (default %s)", roffEscape(f.DefValue))
+			}
+			fmt.Fprintln(w)
+		}
+	}
+
+	if len(c.args) > 0 {
+		fmt.Fprintf(w, ".SH ARGUMENTS\nOne of: %s\n", roffEscape(strings.Join(c.args, ", ")))
+	}
+
+	fmt.Fprintln(w, ".SH EXIT STATUS")
+	codes := make([]int, 0, len(errorCodes)+1)
+	codes = append(codes, exitOK)
+	for code := range errorCodes {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		desc := "success"
+		if code != exitOK {
+			desc = errorCodes[code]
+		}
+		fmt.Fprintf(w, ".TP\n.B %d\n%s\n", code, roffEscape(strings.ReplaceAll(desc, "_", " ")))
+	}
+
+	if c != root {
+		fmt.Fprintf(w, ".SH SEE ALSO\n.BR %s (1)\n", root.name)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/demelere/sensor-control-modules/internal/device"
+	"github.com/demelere/sensor-control-modules/internal/units"
+	"github.com/demelere/sensor-control-modules/pkg/sensorstack"
+)
+
+func newReadCommand() *command {
+	c := &command{
+		name:    "read",
+		usage:   "sensorctl read <sensor> [-json] [-n count] [-interval duration]",
+		summary: "discover a sensor, take one or more readings, print them, and exit",
+		flags:   flag.NewFlagSet("read", flag.ContinueOnError),
+		args:    strings.Split(device.Names(), ", "),
+	}
+	asJSON := c.flags.Bool("json", false, "print one JSON object per reading")
+	count := c.flags.Int("n", 1, "number of readings to take")
+	interval := c.flags.Duration("interval", time.Second, "delay between readings")
+
+	c.run = func(args []string) error {
+		if len(args) != 1 {
+			return usageError{fmt.Errorf("read expects exactly one sensor (%s)", device.Names())}
+		}
+		return runRead(strings.ToLower(args[0]), *count, *interval, *asJSON)
+	}
+	return c
+}
+
+func runRead(name string, count int, interval time.Duration, asJSON bool) error {
+	if _, ok := device.Drivers[name]; !ok {
+		return usageError{fmt.Errorf("unknown sensor %q (supported: %s)", name, device.Names())}
+	}
+	if count < 1 {
+		return usageError{fmt.Errorf("-n must be at least 1")}
+	}
+
+	s, err := device.New(cfg.Sensor(name))
+	if err != nil {
+		return err
+	}
+	if err := s.Open(); err != nil {
+		return err
+	}
+	defer s.Close()
+
+	enc := json.NewEncoder(os.Stdout)
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			time.Sleep(interval)
+		}
+		v, more, err := s.Poll(context.Background())
+		if err != nil {
+			return fmt.Errorf("reading %d of %d: %w", i+1, count, err)
+		}
+
+		now := time.Now().UTC()
+		for _, m := range append([]device.Measurement{{Metric: s.Metric, Unit: s.Unit, Value: v}}, more...) {
+			v, unit := units.Display(m.Value, m.Unit)
+			r := sensorstack.Reading{Sensor: name, Metric: m.Metric, Value: v, Unit: string(unit), Time: now}
+			if asJSON {
+				if err := enc.Encode(r); err != nil {
+					return err
+				}
+			} else {
+				fmt.Printf("%s %s %s %.2f %s\n", r.Time.Format(time.RFC3339), r.Sensor, r.Metric, r.Value, r.Unit)
+			}
+		}
+	}
+	return nil
+}
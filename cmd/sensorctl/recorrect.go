@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/demelere/sensor-control-modules/internal/correction"
+	"github.com/demelere/sensor-control-modules/pkg/sensorstack"
+)
+
+func newRecorrectCommand() *command {
+	c := &command{
+		name:    "recorrect",
+		usage:   "sensorctl recorrect -calibration file [-probe sensor=serial,...] [session.jsonl]",
+		summary: "correct a recorded session's readings again with another calibration, from their raw values",
+		flags:   flag.NewFlagSet("recorrect", flag.ContinueOnError),
+	}
+	path := c.flags.String("calibration", "", "calibration state file, as the daemon keeps in calibration_state")
+	probeList := c.flags.String("probe", "", "comma-separated sensor=serial pairs: the probe each sensor was connected to, to use the curves kept for it")
+
+	c.run = func(args []string) error {
+		if *path == "" {
+			return usageError{fmt.Errorf("-calibration is required")}
+		}
+		if len(args) > 1 {
+			return usageError{fmt.Errorf("recorrect takes at most one input file")}
+		}
+		probes := map[string]string{}
+		for _, pair := range strings.Split(*probeList, ",") {
+			if pair == "" {
+				continue
+			}
+			name, serial, ok := strings.Cut(pair, "=")
+			if !ok || name == "" || serial == "" {
+				return usageError{fmt.Errorf("-probe wants sensor=serial, not %q", pair)}
+			}
+			probes[name] = serial
+		}
+		if _, err := os.Stat(*path); err != nil {
+			return err
+		}
+		set, err := correction.Open(*path)
+		if err != nil {
+			return err
+		}
+		in := io.Reader(os.Stdin)
+		if len(args) == 1 && args[0] != "-" {
+			f, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			in = f
+		}
+		return runRecorrect(in, os.Stdout, set, probes)
+	}
+	return c
+}
+
+// runRecorrect rewrites each reading of a metric with a correction in set as
+// the correction of its raw value, which is the <metric>_raw reading recorded
+// right after it, or the reading itself if it was recorded uncorrected. A
+// metric set has no correction for goes back to its raw value. Everything
+// else, derived and smoothed metrics included, passes through unchanged. A
+// sensor in probes is corrected first with the curves kept for its probe.
+func runRecorrect(in io.Reader, out io.Writer, set *correction.Set, probes map[string]string) error {
+	w := bufio.NewWriter(out)
+	defer w.Flush()
+	enc := json.NewEncoder(w)
+
+	type line struct {
+		rd  sensorstack.Reading
+		raw []byte
+	}
+	var pending *line // a reading whose raw value may follow
+	emit := func(p *line, raw float64, recorded bool) error {
+		c, ok := set.GetProbe(probes[p.rd.Sensor], p.rd.Metric)
+		if !ok {
+			c, ok = set.Get(p.rd.Sensor, p.rd.Metric)
+		}
+		if !ok && !recorded {
+			w.Write(p.raw)
+			w.WriteByte('\n')
+			return nil
+		}
+		rd := p.rd
+		rd.Value = raw
+		if ok {
+			v, err := c.Apply(raw, rd.Unit)
+			if err != nil {
+				return fmt.Errorf("%s %s: %v", rd.Sensor, rd.Metric, err)
+			}
+			rd.Value = v
+		}
+		enc.Encode(rd)
+		if ok {
+			rawRd := p.rd
+			rawRd.Metric, rawRd.Value = p.rd.Metric+"_raw", raw
+			enc.Encode(rawRd)
+		}
+		return nil
+	}
+
+	sc := bufio.NewScanner(in)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for n := 1; sc.Scan(); n++ {
+		var rd struct {
+			sensorstack.Reading
+			Annotation string `json:"annotation"`
+		}
+		if err := json.Unmarshal(sc.Bytes(), &rd); err != nil {
+			return fmt.Errorf("line %d: %v", n, err)
+		}
+		isReading := rd.Annotation == "" && rd.Sensor != "" && rd.Metric != ""
+		if pending != nil && isReading && rd.Sensor == pending.rd.Sensor && rd.Metric == pending.rd.Metric+"_raw" && rd.Time.Equal(pending.rd.Time) {
+			if err := emit(pending, rd.Value, true); err != nil {
+				return fmt.Errorf("line %d: %v", n, err)
+			}
+			pending = nil
+			continue
+		}
+		if pending != nil {
+			if err := emit(pending, pending.rd.Value, false); err != nil {
+				return fmt.Errorf("line %d: %v", n-1, err)
+			}
+			pending = nil
+		}
+		if isReading && !strings.HasSuffix(rd.Metric, "_raw") {
+			pending = &line{rd: rd.Reading, raw: append([]byte(nil), sc.Bytes()...)}
+			continue
+		}
+		w.Write(sc.Bytes())
+		w.WriteByte('\n')
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	if pending != nil {
+		return emit(pending, pending.rd.Value, false)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/demelere/sensor-control-modules/internal/privacy"
+)
+
+func newReidentifyCommand() *command {
+	c := &command{
+		name:    "reidentify",
+		usage:   "sensorctl reidentify [-key-map file] pseudonym...",
+		summary: "look up the subject behind session pseudonyms in the local key map",
+		flags:   flag.NewFlagSet("reidentify", flag.ContinueOnError),
+	}
+	keyMap := c.flags.String("key-map", "", "pseudonym key map (default privacy.key_map)")
+
+	c.run = func(args []string) error {
+		if len(args) == 0 {
+			return usageError{fmt.Errorf("reidentify expects at least one pseudonym")}
+		}
+		path := *keyMap
+		if path == "" {
+			path = cfg.Privacy.KeyMap
+		}
+		for _, p := range args {
+			is, err := privacy.Lookup(path, p)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s\t%s\tissued %s\n", is.Pseudonym, is.Subject, is.Issued.Format(time.RFC3339))
+		}
+		return nil
+	}
+	return c
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/demelere/sensor-control-modules/internal/gap"
+	"github.com/demelere/sensor-control-modules/internal/resample"
+	"github.com/demelere/sensor-control-modules/pkg/sensorstack"
+)
+
+func newResampleCommand() *command {
+	c := &command{
+		name:    "resample",
+		usage:   "sensorctl resample [-rate 1] [-method linear] [-max-gap 0] [file]",
+		summary: "convert a JSON-lines reading stream into fixed-rate series per sensor and metric",
+		flags:   flag.NewFlagSet("resample", flag.ContinueOnError),
+	}
+	rate := c.flags.Float64("rate", 1, "output rate in Hz")
+	method := c.flags.String("method", "linear", "interpolation method: linear, previous, or nearest")
+	maxGap := c.flags.Duration("max-gap", 0, "leave gaps longer than this empty instead of interpolating (0 interpolates across any gap)")
+
+	c.run = func(args []string) error {
+		if len(args) > 1 {
+			return usageError{fmt.Errorf("resample takes at most one input file")}
+		}
+		m, err := resample.ParseMethod(*method)
+		if err != nil {
+			return usageError{err}
+		}
+		if _, err := resample.New(*rate, m, *maxGap); err != nil {
+			return usageError{err}
+		}
+
+		in := io.Reader(os.Stdin)
+		if len(args) == 1 && args[0] != "-" {
+			f, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			in = f
+		}
+		return runResample(in, os.Stdout, *rate, m, *maxGap)
+	}
+	return c
+}
+
+// runResample resamples each sensor/metric stream independently. Lines that
+// are not readings (labels, annotations) are passed through unchanged, and
+// gap annotations stop interpolation across the gap they describe.
+func runResample(in io.Reader, out io.Writer, rate float64, m resample.Method, maxGap time.Duration) error {
+	type stream struct {
+		r    *resample.Resampler
+		tmpl sensorstack.Reading
+	}
+	streams := make(map[string]*stream)
+	var order []string
+
+	w := bufio.NewWriter(out)
+	defer w.Flush()
+	enc := json.NewEncoder(w)
+	emit := func(s *stream, pts []resample.Point) {
+		for _, p := range pts {
+			rd := s.tmpl
+			rd.Time, rd.Value = p.Time, p.Value
+			enc.Encode(rd)
+		}
+	}
+
+	sc := bufio.NewScanner(in)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for line := 1; sc.Scan(); line++ {
+		var rd struct {
+			sensorstack.Reading
+			Annotation string `json:"annotation"`
+		}
+		if err := json.Unmarshal(sc.Bytes(), &rd); err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+		key := rd.Sensor + "\x00" + rd.Metric
+		if rd.Annotation != "" || rd.Sensor == "" || rd.Metric == "" {
+			if s, ok := streams[key]; ok && rd.Annotation == gap.Annotation {
+				s.r.Break()
+			}
+			w.Write(sc.Bytes())
+			w.WriteByte('\n')
+			continue
+		}
+
+		s, ok := streams[key]
+		if !ok {
+			r, _ := resample.New(rate, m, maxGap)
+			s = &stream{r: r, tmpl: rd.Reading}
+			streams[key] = s
+			order = append(order, key)
+		}
+		emit(s, s.r.Add(rd.Time, rd.Value))
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	for _, key := range order {
+		s := streams[key]
+		emit(s, s.r.Flush())
+	}
+	return nil
+}
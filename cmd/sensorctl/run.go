@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/demelere/sensor-control-modules/internal/config"
+	"github.com/demelere/sensor-control-modules/internal/provision"
+	"github.com/demelere/sensor-control-modules/internal/service"
+	"github.com/demelere/sensor-control-modules/pkg/sensorstack"
+)
+
+func newRunCommand() *command {
+	c := &command{
+		name:    "run",
+		usage:   "sensorctl [-config file] run [-provision-addr :8080]",
+		summary: "run as a daemon, polling every enabled sensor and printing readings as JSON lines",
+		flags:   flag.NewFlagSet("run", flag.ContinueOnError),
+	}
+	provisionAddr := c.flags.String("provision-addr", ":8080", "address for the first-boot setup page, empty to disable provisioning")
+	apiAddr := c.flags.String("api-addr", "", "REST API listen address (overrides api_addr in the config)")
+	grpcAddr := c.flags.String("grpc-addr", "", "gRPC API listen address (overrides grpc_addr in the config)")
+
+	c.run = func(args []string) error {
+		if len(args) != 0 {
+			return usageError{fmt.Errorf("run takes no positional arguments")}
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		return service.Run(ctx, serviceName, func(ctx context.Context) error {
+			if configPath != "" && *provisionAddr != "" {
+				if _, err := os.Stat(configPath); errors.Is(err, os.ErrNotExist) {
+					provisioned, err := provisionFirstBoot(ctx, *provisionAddr)
+					if err != nil {
+						return err
+					}
+					cfg = provisioned
+				}
+			}
+			if *apiAddr != "" {
+				cfg.APIAddr = *apiAddr
+			}
+			if *grpcAddr != "" {
+				cfg.GRPCAddr = *grpcAddr
+			}
+			stack := &sensorstack.Stack{Config: cfg, Output: os.Stdout, Logs: logStream}
+			return stack.Run(ctx)
+		})
+	}
+	return c
+}
+
+// provisionFirstBoot builds the rig config when -config points at a file that
+// does not exist yet: from a USB stick if one carries sensorctl.json,
+// otherwise from the setup web page. The result is saved to configPath.
+func provisionFirstBoot(ctx context.Context, addr string) (*config.Config, error) {
+	var provisioned *config.Config
+	if usbPath, ok := provision.FindUSBConfig(); ok {
+		log.Printf("provisioning from %s", usbPath)
+		c, err := config.Load(usbPath)
+		if err != nil {
+			return nil, err
+		}
+		provisioned = c
+	} else {
+		fmt.Fprintf(os.Stderr, "sensorctl: no config at %s, serving setup page on %s\n", configPath, addr)
+		c, err := provision.Serve(ctx, addr, cfg)
+		if err != nil {
+			return nil, err
+		}
+		provisioned = c
+	}
+
+	if err := provision.ApplyWiFi(provisioned.WiFi); err != nil {
+		log.Printf("provisioning: %v", err)
+	}
+	if err := config.Save(configPath, provisioned); err != nil {
+		return nil, err
+	}
+	log.Printf("provisioning complete, config saved to %s", configPath)
+	return provisioned, nil
+}
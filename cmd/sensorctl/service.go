@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/demelere/sensor-control-modules/internal/service"
+)
+
+// serviceName names the installed service, and its event log source on
+// Windows, as the journal identifier does on Linux.
+const serviceName = "sensorctl"
+
+func newServiceCommand() *command {
+	c := &command{
+		name:    "service",
+		usage:   "sensorctl service <install|uninstall|start|stop|status>",
+		summary: "install sensorctl run as a systemd unit, launchd daemon, or Windows service",
+	}
+
+	install := &command{
+		name:    "install",
+		usage:   "sensorctl [-config file] service install",
+		summary: "register sensorctl run with the service manager to start at boot",
+	}
+	install.run = func(args []string) error {
+		if len(args) != 0 {
+			return usageError{fmt.Errorf("install takes no positional arguments")}
+		}
+		exe, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		if exe, err = filepath.EvalSymlinks(exe); err != nil {
+			return err
+		}
+		var runArgs []string
+		if configPath != "" {
+			abs, err := filepath.Abs(configPath)
+			if err != nil {
+				return err
+			}
+			runArgs = append(runArgs, "-config", abs)
+		}
+		runArgs = append(runArgs, "run")
+		env := map[string]string{}
+		if f := service.LogFile(serviceName); f != "" {
+			env["SENSORCTL_LOGGING_FILE_ENABLED"] = "true"
+			env["SENSORCTL_LOGGING_FILE_PATH"] = f
+		}
+		spec := service.Spec{
+			Name:        serviceName,
+			Description: "sensorctl rig daemon",
+			Executable:  exe,
+			Args:        runArgs,
+			Env:         env,
+		}
+		if err := service.Install(spec); err != nil {
+			return err
+		}
+		fmt.Printf("installed service %s; start it with sensorctl service start. Logs go to %s.\n", serviceName, service.LogDestination(serviceName))
+		return nil
+	}
+
+	uninstall := &command{
+		name:    "uninstall",
+		usage:   "sensorctl service uninstall",
+		summary: "stop the service and remove it from the service manager",
+	}
+	uninstall.run = func(args []string) error {
+		return service.Uninstall(serviceName)
+	}
+
+	start := &command{
+		name:    "start",
+		usage:   "sensorctl service start",
+		summary: "start the installed service",
+	}
+	start.run = func(args []string) error {
+		return service.Start(serviceName)
+	}
+
+	stop := &command{
+		name:    "stop",
+		usage:   "sensorctl service stop",
+		summary: "stop the service until it is started again or the host reboots",
+	}
+	stop.run = func(args []string) error {
+		return service.Stop(serviceName)
+	}
+
+	status := &command{
+		name:    "status",
+		usage:   "sensorctl service status",
+		summary: "print the service manager's state for the service",
+	}
+	status.run = func(args []string) error {
+		state, err := service.Status(serviceName)
+		if err != nil {
+			return err
+		}
+		fmt.Println(state)
+		return nil
+	}
+
+	c.subcommands = []*command{install, uninstall, start, stop, status}
+	return c
+}
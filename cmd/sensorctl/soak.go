@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/demelere/sensor-control-modules/internal/device"
+	"github.com/demelere/sensor-control-modules/internal/membudget"
+)
+
+// latencyBuckets are exponential upper bounds from 1ms to ~65s, so a 24h
+// soak keeps constant memory regardless of how many reads it performs.
+var latencyBuckets = func() []time.Duration {
+	var b []time.Duration
+	for d := time.Millisecond; d <= 65*time.Second; d *= 2 {
+		b = append(b, d)
+	}
+	return b
+}()
+
+type latencyStats struct {
+	counts []int64 // one per bucket plus overflow
+	n      int64
+	sum    time.Duration
+	min    time.Duration
+	max    time.Duration
+}
+
+func newLatencyStats() *latencyStats {
+	return &latencyStats{counts: make([]int64, len(latencyBuckets)+1)}
+}
+
+func (ls *latencyStats) add(d time.Duration) {
+	i := 0
+	for i < len(latencyBuckets) && d > latencyBuckets[i] {
+		i++
+	}
+	ls.counts[i]++
+	if ls.n == 0 || d < ls.min {
+		ls.min = d
+	}
+	if d > ls.max {
+		ls.max = d
+	}
+	ls.n++
+	ls.sum += d
+}
+
+// quantile returns the upper bound of the bucket containing quantile q.
+func (ls *latencyStats) quantile(q float64) time.Duration {
+	if ls.n == 0 {
+		return 0
+	}
+	target := int64(math.Ceil(q * float64(ls.n)))
+	var seen int64
+	for i, c := range ls.counts {
+		seen += c
+		if seen >= target {
+			if i < len(latencyBuckets) {
+				return min(latencyBuckets[i], ls.max)
+			}
+			return ls.max
+		}
+	}
+	return ls.max
+}
+
+type soakSensorReport struct {
+	Sensor       string           `json:"sensor"`
+	Reads        int64            `json:"reads"`
+	Errors       int64            `json:"errors"`
+	ErrorRate    float64          `json:"error_rate"`
+	ErrorsByCode map[string]int64 `json:"errors_by_code"`
+	Reopens      int64            `json:"reopens"`
+	LastError    string           `json:"last_error,omitempty"`
+	LatencyMin   string           `json:"latency_min"`
+	LatencyMean  string           `json:"latency_mean"`
+	LatencyP50   string           `json:"latency_p50"`
+	LatencyP95   string           `json:"latency_p95"`
+	LatencyP99   string           `json:"latency_p99"`
+	LatencyMax   string           `json:"latency_max"`
+	MinValue     float64          `json:"min_value"`
+	MaxValue     float64          `json:"max_value"`
+}
+
+type soakMemoryReport struct {
+	HeapAllocStart uint64 `json:"heap_alloc_start_bytes"`
+	HeapAllocEnd   uint64 `json:"heap_alloc_end_bytes"`
+	HeapAllocMax   uint64 `json:"heap_alloc_max_bytes"`
+	SysMax         uint64 `json:"sys_max_bytes"`
+	Goroutines     int    `json:"goroutines_end"`
+	GoroutinesMax  int    `json:"goroutines_max"`
+
+	Budget membudget.Report `json:"budget"`
+}
+
+type soakReport struct {
+	Start     time.Time          `json:"start"`
+	End       time.Time          `json:"end"`
+	Requested string             `json:"requested_duration"`
+	Completed bool               `json:"completed"`
+	Passed    bool               `json:"passed"`
+	Sensors   []soakSensorReport `json:"sensors"`
+	Memory    soakMemoryReport   `json:"memory"`
+}
+
+type soakSensor struct {
+	name    string
+	sensor  *device.Device
+	lock    sync.Mutex
+	reads   int64
+	errors  int64
+	byCode  map[string]int64
+	reopens int64
+	lastErr error
+	latency *latencyStats
+	minV    float64
+	maxV    float64
+}
+
+func newSoakCommand() *command {
+	c := &command{
+		name:    "soak",
+		usage:   "sensorctl soak [-duration 24h] [-sensors vaisala,kurz] [-interval 1s] [-report file]",
+		summary: "exercise sensors continuously and report error, latency, and memory statistics",
+		flags:   flag.NewFlagSet("soak", flag.ContinueOnError),
+	}
+	duration := c.flags.Duration("duration", 24*time.Hour, "how long to run")
+	sensors := c.flags.String("sensors", device.Names(), "comma separated sensors to exercise")
+	interval := c.flags.Duration("interval", time.Second, "delay between reads per sensor")
+	reportPath := c.flags.String("report", "", "write the JSON soak report to this file as well as stdout")
+	maxErrorRate := c.flags.Float64("max-error-rate", 0.001, "fail the soak if any sensor's error rate exceeds this fraction")
+	reopenAfter := c.flags.Int("reopen-after", 5, "reopen a sensor after this many consecutive errors")
+	progress := c.flags.Duration("progress", time.Minute, "interval between progress lines on stderr, 0 to disable")
+
+	c.run = func(args []string) error {
+		if len(args) != 0 {
+			return usageError{fmt.Errorf("soak takes no positional arguments")}
+		}
+		var names []string
+		for _, n := range strings.Split(*sensors, ",") {
+			if n = strings.TrimSpace(strings.ToLower(n)); n != "" {
+				names = append(names, n)
+			}
+		}
+		if len(names) == 0 {
+			return usageError{fmt.Errorf("no sensors selected")}
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		ctx, cancel := context.WithTimeout(ctx, *duration)
+		defer cancel()
+
+		report, err := runSoak(ctx, names, *duration, *interval, *reopenAfter, *maxErrorRate, *progress)
+		if err != nil {
+			return err
+		}
+
+		out, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(out))
+		if *reportPath != "" {
+			if err := os.WriteFile(*reportPath, out, 0o644); err != nil {
+				return fmt.Errorf("failed to write soak report: %w", err)
+			}
+		}
+		if !report.Passed {
+			return fmt.Errorf("soak failed: error rate above %.4f%% or soak interrupted", *maxErrorRate*100)
+		}
+		return nil
+	}
+	return c
+}
+
+func runSoak(ctx context.Context, names []string, duration, interval time.Duration, reopenAfter int, maxErrorRate float64, progress time.Duration) (*soakReport, error) {
+	var soakers []*soakSensor
+	for _, name := range names {
+		if _, ok := device.Drivers[name]; !ok {
+			return nil, usageError{fmt.Errorf("unknown sensor %q (supported: %s)", name, device.Names())}
+		}
+		s, err := device.New(cfg.Sensor(name))
+		if err != nil {
+			return nil, err
+		}
+		if err := s.Open(); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		defer s.Close()
+		soakers = append(soakers, &soakSensor{name: name, sensor: s, byCode: make(map[string]int64), latency: newLatencyStats()})
+	}
+
+	report := &soakReport{Start: time.Now().UTC(), Requested: duration.String()}
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	report.Memory.HeapAllocStart = ms.HeapAlloc
+
+	var wg sync.WaitGroup
+	for _, ss := range soakers {
+		wg.Add(1)
+		go func(ss *soakSensor) {
+			defer wg.Done()
+			ss.run(ctx, interval, reopenAfter)
+		}(ss)
+	}
+
+	memTicker := time.NewTicker(10 * time.Second)
+	defer memTicker.Stop()
+	var progressCh <-chan time.Time
+	if progress > 0 {
+		t := time.NewTicker(progress)
+		defer t.Stop()
+		progressCh = t.C
+	}
+
+	sampleMemory := func() {
+		runtime.ReadMemStats(&ms)
+		report.Memory.HeapAllocMax = max(report.Memory.HeapAllocMax, ms.HeapAlloc)
+		report.Memory.SysMax = max(report.Memory.SysMax, ms.Sys)
+		report.Memory.GoroutinesMax = max(report.Memory.GoroutinesMax, runtime.NumGoroutine())
+	}
+
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			break loop
+		case <-memTicker.C:
+			sampleMemory()
+		case <-progressCh:
+			sampleMemory()
+			for _, ss := range soakers {
+				ss.lock.Lock()
+				fmt.Fprintf(os.Stderr, "soak %s: %s reads=%d errors=%d reopens=%d heap=%dKiB\n",
+					time.Since(report.Start).Truncate(time.Second), ss.name, ss.reads, ss.errors, ss.reopens, ms.HeapAlloc/1024)
+				ss.lock.Unlock()
+			}
+		}
+	}
+	wg.Wait()
+
+	sampleMemory()
+	report.End = time.Now().UTC()
+	report.Completed = ctx.Err() == context.DeadlineExceeded
+	report.Memory.HeapAllocEnd = ms.HeapAlloc
+	report.Memory.Goroutines = runtime.NumGoroutine()
+	report.Memory.Budget = membudget.Snapshot()
+	report.Passed = report.Completed
+
+	for _, ss := range soakers {
+		r := ss.report()
+		if r.Reads == 0 || r.ErrorRate > maxErrorRate {
+			report.Passed = false
+		}
+		report.Sensors = append(report.Sensors, r)
+	}
+	return report, nil
+}
+
+func (ss *soakSensor) run(ctx context.Context, interval time.Duration, reopenAfter int) {
+	consecutive := 0
+	for {
+		start := time.Now()
+		v, err := ss.sensor.Read(ctx)
+		elapsed := time.Since(start)
+		if ctx.Err() != nil { // cut short by the end of the soak, not a sensor failure
+			return
+		}
+
+		ss.lock.Lock()
+		ss.reads++
+		ss.latency.add(elapsed)
+		if err != nil {
+			ss.errors++
+			ss.byCode[errorCodes[exitCode(err)]]++
+			ss.lastErr = err
+			consecutive++
+		} else {
+			if ss.reads-ss.errors == 1 {
+				ss.minV, ss.maxV = v, v
+			}
+			ss.minV, ss.maxV = math.Min(ss.minV, v), math.Max(ss.maxV, v)
+			consecutive = 0
+		}
+		ss.lock.Unlock()
+
+		if reopenAfter > 0 && consecutive >= reopenAfter {
+			ss.sensor.Close()
+			if err := ss.sensor.Open(); err == nil {
+				consecutive = 0
+			}
+			ss.lock.Lock()
+			ss.reopens++
+			ss.lock.Unlock()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (ss *soakSensor) report() soakSensorReport {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+
+	r := soakSensorReport{
+		Sensor:       ss.name,
+		Reads:        ss.reads,
+		Errors:       ss.errors,
+		ErrorsByCode: ss.byCode,
+		Reopens:      ss.reopens,
+		LatencyMin:   ss.latency.min.String(),
+		LatencyP50:   ss.latency.quantile(0.50).String(),
+		LatencyP95:   ss.latency.quantile(0.95).String(),
+		LatencyP99:   ss.latency.quantile(0.99).String(),
+		LatencyMax:   ss.latency.max.String(),
+		MinValue:     ss.minV,
+		MaxValue:     ss.maxV,
+	}
+	if ss.reads > 0 {
+		r.ErrorRate = float64(ss.errors) / float64(ss.reads)
+		r.LatencyMean = (ss.latency.sum / time.Duration(ss.reads)).String()
+	}
+	if ss.lastErr != nil {
+		r.LastError = ss.lastErr.Error()
+	}
+	return r
+}
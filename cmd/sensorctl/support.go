@@ -0,0 +1,320 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/demelere/sensor-control-modules/internal/diskfree"
+	"github.com/demelere/sensor-control-modules/internal/privacy"
+	"github.com/demelere/sensor-control-modules/internal/version"
+)
+
+// maxLogBytes caps how much of each log file goes into a bundle; the end of
+// the file is kept.
+const maxLogBytes = 8 << 20
+
+func newSupportBundleCommand() *command {
+	c := &command{
+		name:    "support-bundle",
+		usage:   "sensorctl support-bundle [-o file.tar.gz] [-since 24h] [-api url]",
+		summary: "collect logs, redacted config, health, serial traces, and storage stats into a tarball for bug reports",
+		flags:   flag.NewFlagSet("support-bundle", flag.ContinueOnError),
+	}
+	out := c.flags.String("o", "", "output file (default sensorctl-support-<time>.tar.gz)")
+	since := c.flags.Duration("since", 24*time.Hour, "how far back to collect logs and events")
+	apiURL := c.flags.String("api", "", "base URL of the running daemon's API (default from api_addr)")
+
+	c.run = func(args []string) error {
+		if len(args) > 0 {
+			return usageError{fmt.Errorf("support-bundle takes no arguments")}
+		}
+		now := time.Now().UTC()
+		name := "sensorctl-support-" + now.Format("20060102T150405Z")
+		path := *out
+		if path == "" {
+			path = name + ".tar.gz"
+		}
+		base := *apiURL
+		if base == "" {
+			base = apiBase(cfg.APIAddr)
+		}
+		f, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("failed to create bundle: %w", err)
+		}
+		b := newBundle(f, name, now)
+		collectBundle(b, base, now.Add(-*since))
+		if err := b.close(); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to write bundle: %w", err)
+		}
+		if err := f.Close(); err != nil {
+			return fmt.Errorf("failed to write bundle: %w", err)
+		}
+		fmt.Printf("wrote %s", path)
+		if len(b.missing) > 0 {
+			fmt.Printf(" (%d items could not be collected, see errors.txt)", len(b.missing))
+		}
+		fmt.Println()
+		return nil
+	}
+	return c
+}
+
+// apiBase turns the daemon's listen address into a URL this host can reach.
+func apiBase(addr string) string {
+	if addr == "" {
+		return ""
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return ""
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
+
+// bundle writes files into a gzipped tarball under one top-level directory
+// and remembers what it could not collect.
+type bundle struct {
+	gz      *gzip.Writer
+	tw      *tar.Writer
+	dir     string
+	time    time.Time
+	missing []string
+}
+
+func newBundle(w io.Writer, dir string, t time.Time) *bundle {
+	gz := gzip.NewWriter(w)
+	return &bundle{gz: gz, tw: tar.NewWriter(gz), dir: dir, time: t}
+}
+
+func (b *bundle) add(name string, data []byte) {
+	hdr := &tar.Header{Name: b.dir + "/" + name, Mode: 0o644, Size: int64(len(data)), ModTime: b.time}
+	if err := b.tw.WriteHeader(hdr); err != nil {
+		b.fail(name, err)
+		return
+	}
+	if _, err := b.tw.Write(data); err != nil {
+		b.fail(name, err)
+	}
+}
+
+func (b *bundle) addJSON(name string, v any) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		b.fail(name, err)
+		return
+	}
+	b.add(name, append(data, '\n'))
+}
+
+func (b *bundle) fail(name string, err error) {
+	b.missing = append(b.missing, fmt.Sprintf("%s: %v", name, err))
+}
+
+func (b *bundle) close() error {
+	if len(b.missing) > 0 {
+		b.add("errors.txt", []byte(strings.Join(b.missing, "\n")+"\n"))
+	}
+	if err := b.tw.Close(); err != nil {
+		return err
+	}
+	return b.gz.Close()
+}
+
+func collectBundle(b *bundle, api string, since time.Time) {
+	host, _ := os.Hostname()
+	b.addJSON("version.json", map[string]string{
+		"version":    version.Version,
+		"go":         runtime.Version(),
+		"os":         runtime.GOOS,
+		"arch":       runtime.GOARCH,
+		"hostname":   host,
+		"site_id":    cfg.SiteID,
+		"collected":  b.time.Format(time.RFC3339),
+		"config":     configPath,
+		"api":        api,
+		"logs_since": since.Format(time.RFC3339),
+	})
+	b.addJSON("config.json", cfg.Redacted())
+	b.addJSON("store.json", storeStats())
+	collectLogs(b, since)
+	if api == "" {
+		b.fail("health", fmt.Errorf("api_addr is not set, so the daemon cannot be asked"))
+		return
+	}
+	window := url.Values{"from": {since.Format(time.RFC3339)}}
+	for _, q := range []struct {
+		file, path string
+		query      url.Values
+	}{
+		{"health/capabilities.json", "/v1/capabilities", nil},
+		{"health/modules.json", "/v1/modules", nil},
+		{"health/latest.json", "/v1/metrics/latest", nil},
+		{"health/contracts.json", "/v1/metrics/contracts", nil},
+		{"health/alerts.json", "/v1/alerts", window},
+		{"health/events.json", "/v1/events", window},
+		{"serial-trace.json", "/v1/debug/serial-trace", nil},
+	} {
+		data, err := fetch(api+q.path, q.query)
+		if err != nil {
+			b.fail(q.file, err)
+			continue
+		}
+		b.add(q.file, data)
+	}
+}
+
+func fetch(u string, query url.Values) ([]byte, error) {
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("daemon not reachable: %v", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(data))
+	}
+	return data, nil
+}
+
+// collectLogs adds the log file sink, with its rotated backups, and the
+// journal when logs go there.
+func collectLogs(b *bundle, since time.Time) {
+	lf := cfg.Logging.File
+	if lf.Enabled && lf.Path != "" {
+		paths := []string{lf.Path}
+		for i := 1; i <= lf.MaxBackups; i++ {
+			paths = append(paths, fmt.Sprintf("%s.%d", lf.Path, i))
+		}
+		for i, path := range paths {
+			data, err := tailFile(path, maxLogBytes)
+			if os.IsNotExist(err) && i > 0 {
+				break // fewer backups than allowed
+			} else if err != nil {
+				b.fail("logs/"+filepath.Base(path), err)
+				continue
+			}
+			b.add("logs/"+filepath.Base(path), scrubLog(data))
+		}
+	}
+	if cfg.Logging.Journald.Enabled {
+		if _, err := exec.LookPath("journalctl"); err != nil {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		out, err := exec.CommandContext(ctx, "journalctl", "-t", "sensorctl", "--no-pager", "-o", "short-iso",
+			"--since", since.Local().Format("2006-01-02 15:04:05")).Output()
+		if err != nil {
+			b.fail("logs/journal.txt", err)
+			return
+		}
+		b.add("logs/journal.txt", scrubLog(out))
+	}
+}
+
+// scrubLog strips device MAC addresses from log text in privacy mode.
+func scrubLog(data []byte) []byte {
+	if !cfg.Privacy.Enabled {
+		return data
+	}
+	return []byte(privacy.StripMACs(string(data)))
+}
+
+// tailFile returns at most the last max bytes of path.
+func tailFile(path string, max int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > max {
+		if _, err := f.Seek(info.Size()-max, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+	return io.ReadAll(f)
+}
+
+// storeUsage is what one of the daemon's stores holds on disk.
+type storeUsage struct {
+	Store     string    `json:"store"`
+	Path      string    `json:"path"`
+	Files     int       `json:"files"`
+	Bytes     int64     `json:"bytes"`
+	Newest    time.Time `json:"newest,omitempty"`
+	FreeBytes uint64    `json:"free_bytes,omitempty"` // on the filesystem holding it, where known
+	Error     string    `json:"error,omitempty"`
+}
+
+func storeStats() []storeUsage {
+	out := []storeUsage{}
+	add := func(store, path string, glob string) {
+		if path == "" {
+			return
+		}
+		u := storeUsage{Store: store, Path: path}
+		matches, err := filepath.Glob(glob)
+		if err != nil {
+			u.Error = err.Error()
+		}
+		for _, m := range matches {
+			info, err := os.Stat(m)
+			if err != nil || info.IsDir() {
+				continue
+			}
+			u.Files++
+			u.Bytes += info.Size()
+			if info.ModTime().After(u.Newest) {
+				u.Newest = info.ModTime().UTC()
+			}
+		}
+		if free, ok := diskfree.Available(path); ok {
+			u.FreeBytes = free
+		}
+		out = append(out, u)
+	}
+	add("sessions", cfg.Sessions.Dir, filepath.Join(cfg.Sessions.Dir, "*"))
+	add("event_log", cfg.EventLog, cfg.EventLog+"*")
+	add("profile_state", cfg.ProfileState, cfg.ProfileState)
+	add("module_state", cfg.ModuleState, cfg.ModuleState)
+	if cfg.Logging.File.Enabled {
+		add("log_file", cfg.Logging.File.Path, cfg.Logging.File.Path+"*")
+	}
+	return out
+}
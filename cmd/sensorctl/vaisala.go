@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/demelere/sensor-control-modules/pkg/vaisala"
+)
+
+func newVaisalaCommand() *command {
+	c := &command{
+		name:    "vaisala",
+		usage:   "sensorctl vaisala <export|import|diff> [flags]",
+		summary: "export, import, or compare a Vaisala probe's settings",
+	}
+
+	export := &command{
+		name:    "export",
+		usage:   "sensorctl vaisala export [-o file]",
+		summary: "save the probe's unit, form, interval, filtering, address, and compensations as JSON",
+		flags:   flag.NewFlagSet("export", flag.ContinueOnError),
+	}
+	out := export.flags.String("o", "", "output file, default stdout")
+	export.run = func(args []string) error {
+		return withVaisala(func(ctx context.Context, vs *vaisala.VaisalaSensor) error {
+			s, err := vs.ExportSettings(ctx)
+			if err != nil {
+				return err
+			}
+			if *out == "" {
+				data, _ := json.MarshalIndent(s, "", "  ")
+				fmt.Println(string(data))
+				return nil
+			}
+			if err := vaisala.SaveSettings(*out, s); err != nil {
+				return err
+			}
+			fmt.Printf("saved %d settings from probe %s to %s\n", len(s.Settings), s.SerialNumber, *out)
+			return nil
+		})
+	}
+
+	imp := &command{
+		name:    "import",
+		usage:   "sensorctl vaisala import file",
+		summary: "write saved settings to a (replacement) probe and verify them",
+	}
+	imp.run = func(args []string) error {
+		s, err := loadVaisalaSettings(args)
+		if err != nil {
+			return err
+		}
+		return withVaisala(func(ctx context.Context, vs *vaisala.VaisalaSensor) error {
+			diffs, err := vs.ImportSettings(ctx, s)
+			if err != nil {
+				return err
+			}
+			return reportVaisalaDiffs(diffs, "after import")
+		})
+	}
+
+	diff := &command{
+		name:    "diff",
+		usage:   "sensorctl vaisala diff file",
+		summary: "compare the probe's settings with saved ones; exits 1 on drift",
+	}
+	diff.run = func(args []string) error {
+		want, err := loadVaisalaSettings(args)
+		if err != nil {
+			return err
+		}
+		return withVaisala(func(ctx context.Context, vs *vaisala.VaisalaSensor) error {
+			got, err := vs.ExportSettings(ctx)
+			if err != nil {
+				return err
+			}
+			return reportVaisalaDiffs(vaisala.CompareSettings(want, got), "")
+		})
+	}
+
+	c.subcommands = []*command{export, imp, diff}
+	return c
+}
+
+func loadVaisalaSettings(args []string) (vaisala.Settings, error) {
+	if len(args) != 1 {
+		return vaisala.Settings{}, usageError{fmt.Errorf("expected exactly one settings file")}
+	}
+	return vaisala.LoadSettings(args[0])
+}
+
+// withVaisala opens the first configured probe for the duration of fn.
+func withVaisala(fn func(ctx context.Context, vs *vaisala.VaisalaSensor) error) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	sc := cfg.Sensor("vaisala")
+	vs, err := vaisala.NewVaisalaSensor(sc.BaudRate, sc.Address)
+	if err != nil {
+		return err
+	}
+	vs.SetReadTimeout(time.Duration(sc.ReadTimeout))
+	vs.SetPort(sc.Port)
+	if err := vs.SetPortMatch(sc.PortMatch); err != nil {
+		return err
+	}
+	if err := vs.SetProtocol(vaisala.Protocol(sc.Protocol)); err != nil {
+		return err
+	}
+	if err := vs.Open(); err != nil {
+		return err
+	}
+	defer vs.Close()
+	return fn(ctx, vs)
+}
+
+func reportVaisalaDiffs(diffs []vaisala.Difference, when string) error {
+	for _, d := range diffs {
+		fmt.Println(d)
+	}
+	if len(diffs) > 0 {
+		if when != "" {
+			return fmt.Errorf("%d settings differ %s", len(diffs), when)
+		}
+		return fmt.Errorf("%d settings differ", len(diffs))
+	}
+	fmt.Println("probe settings match")
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"flag"
+	"fmt"
+
+	"github.com/demelere/sensor-control-modules/internal/integrity"
+)
+
+func newVerifyCommand() *command {
+	c := &command{
+		name:    "verify",
+		usage:   "sensorctl verify [-pubkey key.pem] file...",
+		summary: "check session files against their SHA-256 sidecars and, with -pubkey, their signatures",
+		flags:   flag.NewFlagSet("verify", flag.ContinueOnError),
+	}
+	pubPath := c.flags.String("pubkey", "", "ed25519 public key (PEM); when set, every file must carry a valid signature")
+
+	c.run = func(args []string) error {
+		if len(args) == 0 {
+			return usageError{fmt.Errorf("verify expects at least one file")}
+		}
+		var pub ed25519.PublicKey
+		if *pubPath != "" {
+			k, err := integrity.LoadPublicKey(*pubPath)
+			if err != nil {
+				return err
+			}
+			pub = k
+		}
+
+		failed := 0
+		for _, path := range args {
+			if err := integrity.Verify(path, pub); err != nil {
+				fmt.Printf("%s: FAILED (%v)\n", path, err)
+				failed++
+				continue
+			}
+			fmt.Printf("%s: OK\n", path)
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d files failed verification", failed, len(args))
+		}
+		return nil
+	}
+	return c
+}
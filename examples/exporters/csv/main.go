@@ -0,0 +1,69 @@
+// Command csv is an example plugin exporter: it appends every reading to a
+// CSV file and counts the alerts it sees. Build it and list it in the
+// daemon's config:
+//
+//	plugins:
+//	  - name: csv
+//	    command: [/usr/local/bin/sensorctl-csv, -o, /var/lib/sensorctl/readings.csv]
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/demelere/sensor-control-modules/pkg/exporter"
+)
+
+type csvExporter struct {
+	f      *os.File
+	w      *csv.Writer
+	alerts int
+}
+
+func (e *csvExporter) Reading(r exporter.Reading) error {
+	err := e.w.Write([]string{r.Time.Format(time.RFC3339Nano), r.Sensor, r.Metric, strconv.FormatFloat(r.Value, 'g', -1, 64), r.Unit})
+	if err != nil {
+		return err
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func (e *csvExporter) Event(exporter.Event) error { return nil }
+
+func (e *csvExporter) Alert(a exporter.Alert) error {
+	e.alerts++
+	log.Printf("alert %s: %s", a.Kind, a.Message)
+	return nil
+}
+
+func (e *csvExporter) Close() error {
+	log.Printf("saw %d alerts", e.alerts)
+	e.w.Flush()
+	if err := e.w.Error(); err != nil {
+		e.f.Close()
+		return err
+	}
+	return e.f.Close()
+}
+
+func main() {
+	path := flag.String("o", "readings.csv", "file to append readings to")
+	flag.Parse()
+
+	f, err := os.OpenFile(*path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		log.Fatal(err)
+	}
+	e := &csvExporter{f: f, w: csv.NewWriter(f)}
+	if info, err := f.Stat(); err == nil && info.Size() == 0 {
+		e.w.Write([]string{"time", "sensor", "metric", "value", "unit"})
+	}
+	if err := exporter.Serve(e); err != nil {
+		log.Fatal(err)
+	}
+}
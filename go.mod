@@ -1,3 +1,27 @@
 module github.com/demelere/sensor-control-modules
 
-go 1.22.3
+go 1.25.0
+
+require (
+	github.com/BurntSushi/toml v1.6.0
+	github.com/eclipse/paho.mqtt.golang v1.5.0
+	go.bug.st/serial v1.6.4
+	golang.org/x/sys v0.39.0
+	google.golang.org/grpc v1.79.3
+	google.golang.org/protobuf v1.36.10
+	gopkg.in/yaml.v3 v3.0.1
+	tinygo.org/x/bluetooth v0.16.0
+)
+
+require (
+	github.com/creack/goselect v0.1.2 // indirect
+	github.com/go-ole/go-ole v1.2.6 // indirect
+	github.com/godbus/dbus/v5 v5.1.0 // indirect
+	github.com/gorilla/websocket v1.5.3 // indirect
+	github.com/sirupsen/logrus v1.9.3 // indirect
+	github.com/tinygo-org/cbgo v0.0.4 // indirect
+	golang.org/x/net v0.48.0 // indirect
+	golang.org/x/sync v0.19.0 // indirect
+	golang.org/x/text v0.32.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20251202230838-ff82c1b0f217 // indirect
+)
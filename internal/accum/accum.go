@@ -0,0 +1,147 @@
+package accum
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"sync"
+)
+
+type Mode int
+
+const (
+	ModeFloat   Mode = iota // compensated float64 summation
+	ModeDecimal             // exact fixed-point sum at a configured number of decimal places
+)
+
+func ParseMode(name string) (Mode, error) {
+	switch strings.ToLower(name) {
+	case "float", "":
+		return ModeFloat, nil
+	case "decimal", "fixed":
+		return ModeDecimal, nil
+	}
+	return ModeFloat, fmt.Errorf("unknown accumulation mode %q", name)
+}
+
+// Accumulator sums a long stream of increments, e.g. a totalizer fed once per
+// poll over a multi-week run.
+type Accumulator interface {
+	Add(v float64)
+	Value() float64
+	String() string
+	Reset()
+}
+
+// New returns an accumulator for mode. places is only used in ModeDecimal and
+// sets the resolution every increment is rounded to.
+func New(mode Mode, places int) Accumulator {
+	if mode == ModeDecimal {
+		return NewDecimal(places)
+	}
+	return &Float{}
+}
+
+// Float uses Neumaier compensated summation, which keeps the error
+// independent of the number of increments rather than growing with it.
+type Float struct {
+	lock sync.Mutex
+	sum  float64
+	comp float64
+}
+
+func (f *Float) Add(v float64) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	t := f.sum + v
+	if math.Abs(f.sum) >= math.Abs(v) {
+		f.comp += (f.sum - t) + v
+	} else {
+		f.comp += (v - t) + f.sum
+	}
+	f.sum = t
+}
+
+func (f *Float) Value() float64 {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.sum + f.comp
+}
+
+func (f *Float) String() string {
+	return fmt.Sprintf("%g", f.Value())
+}
+
+func (f *Float) Reset() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.sum, f.comp = 0, 0
+}
+
+// Decimal keeps the total as an arbitrary-precision integer count of
+// 10^-places units. Each increment is rounded once on the way in, after which
+// the sum is exact no matter how long the run.
+type Decimal struct {
+	lock   sync.Mutex
+	places int
+	scale  *big.Float
+	total  *big.Int
+}
+
+func NewDecimal(places int) *Decimal {
+	if places < 0 {
+		places = 0
+	}
+	scale := new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(places)), nil))
+	return &Decimal{places: places, scale: scale, total: new(big.Int)}
+}
+
+func (d *Decimal) Add(v float64) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return
+	}
+	scaled := new(big.Float).Mul(big.NewFloat(v), d.scale)
+	if scaled.Sign() >= 0 { // round half away from zero
+		scaled.Add(scaled, big.NewFloat(0.5))
+	} else {
+		scaled.Sub(scaled, big.NewFloat(0.5))
+	}
+	inc, _ := scaled.Int(nil)
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.total.Add(d.total, inc)
+}
+
+func (d *Decimal) Value() float64 {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	v, _ := new(big.Float).Quo(new(big.Float).SetInt(d.total), d.scale).Float64()
+	return v
+}
+
+// String renders the exact total with all configured decimal places.
+func (d *Decimal) String() string {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	digits := new(big.Int).Abs(d.total).String()
+	if d.places > 0 {
+		if len(digits) <= d.places {
+			digits = strings.Repeat("0", d.places-len(digits)+1) + digits
+		}
+		digits = digits[:len(digits)-d.places] + "." + digits[len(digits)-d.places:]
+	}
+	if d.total.Sign() < 0 {
+		digits = "-" + digits
+	}
+	return digits
+}
+
+func (d *Decimal) Reset() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.total.SetInt64(0)
+}
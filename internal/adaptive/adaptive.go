@@ -0,0 +1,67 @@
+// Package adaptive paces a sensor's polls by how fast its reading changes:
+// at the shortest interval while it moves, backing off towards the longest
+// while it holds still. On a battery rig that cuts bus traffic and writes
+// during the long stable stretches without missing the transitions.
+package adaptive
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// backoff is how much the interval grows per still reading.
+const backoff = 1.5
+
+// Poller picks the interval until the next poll from the readings so far.
+// It is not safe for concurrent use; each poll loop owns one.
+type Poller struct {
+	min, max time.Duration
+	rate     float64 // change per second that counts as moving
+	interval time.Duration
+	last     time.Time
+	lastV    float64
+}
+
+// New returns a Poller between min and max that polls at min whenever the
+// reading changes by rate or more per second, and starts there.
+func New(min, max time.Duration, rate float64) (*Poller, error) {
+	if min <= 0 || max < min {
+		return nil, fmt.Errorf("adaptive polling needs 0 < min <= max, got %v and %v", min, max)
+	}
+	if rate <= 0 {
+		return nil, fmt.Errorf("adaptive polling rate must be positive")
+	}
+	return &Poller{min: min, max: max, rate: rate, interval: min}, nil
+}
+
+// Observe records a reading taken at t and returns the interval until the
+// next poll. A reading changing at rate or faster snaps the interval back to
+// min; one changing at under half of it stretches the interval by half, up to
+// max; anything between keeps it.
+func (p *Poller) Observe(t time.Time, v float64) time.Duration {
+	if !p.last.IsZero() && t.After(p.last) {
+		change := math.Abs(v-p.lastV) / t.Sub(p.last).Seconds()
+		switch {
+		case change >= p.rate:
+			p.interval = p.min
+		case change < p.rate/2:
+			p.interval = min(time.Duration(float64(p.interval)*backoff), p.max)
+		}
+	}
+	p.last, p.lastV = t, v
+	return p.interval
+}
+
+// Miss notes a failed poll: the next one comes at min, since whatever the
+// reading did meanwhile is unknown.
+func (p *Poller) Miss() time.Duration {
+	p.last = time.Time{}
+	p.interval = p.min
+	return p.interval
+}
+
+// Interval returns the current interval.
+func (p *Poller) Interval() time.Duration {
+	return p.interval
+}
@@ -0,0 +1,851 @@
+package api
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/demelere/sensor-control-modules/internal/correction"
+	"github.com/demelere/sensor-control-modules/internal/erasure"
+	"github.com/demelere/sensor-control-modules/internal/eventlog"
+	"github.com/demelere/sensor-control-modules/internal/latest"
+	"github.com/demelere/sensor-control-modules/internal/logging"
+	"github.com/demelere/sensor-control-modules/internal/metricdef"
+	"github.com/demelere/sensor-control-modules/internal/serialio"
+	"github.com/demelere/sensor-control-modules/internal/trend"
+	"github.com/demelere/sensor-control-modules/internal/version"
+	sensorctlv1 "github.com/demelere/sensor-control-modules/pkg/proto/sensorctl/v1"
+)
+
+//go:generate go run ../pyclient/gen openapi.json ../../clients/python/sensorctl_client.py
+
+//go:embed openapi.json
+var openAPISpec []byte
+
+// CurrentVersion is the newest API version; it is also what the unversioned
+// legacy paths resolve to.
+const CurrentVersion = "v1"
+
+// Versions lists every API version this build serves, oldest first.
+var Versions = []string{"v1"}
+
+// GRPCPackages lists every gRPC package version this build serves, oldest
+// first, when the gRPC API is on.
+var GRPCPackages = []string{string(sensorctlv1.File_sensorctl_v1_sensorctl_proto.Package())}
+
+// Features names optional API surfaces so clients can probe for them in
+// /capabilities instead of comparing build versions.
+var Features = []string{"metric_metadata", "openapi", "capabilities", "proto_descriptors"}
+
+// SensorInfo describes one sensor the daemon is polling.
+type SensorInfo struct {
+	Name      string `json:"name"`
+	Driver    string `json:"driver"`
+	Metric    string `json:"metric"`
+	Unit      string `json:"unit,omitempty"`
+	State     string `json:"state,omitempty"` // connected, degraded, disconnected, reconnecting
+	Simulated bool   `json:"simulated,omitempty"`
+}
+
+// ModuleInfo is one part of the daemon an operator can switch off and on.
+type ModuleInfo struct {
+	Kind    string `json:"kind"` // sensor, derived, or exporter
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+}
+
+// Contract is what one sensor's metric promises, in display units, so a
+// consumer can size chart axes and sanity-check values without hard-coding
+// ranges per device.
+type Contract struct {
+	Sensor           string  `json:"sensor"`
+	Metric           string  `json:"metric"`
+	Unit             string  `json:"unit"`
+	ValidMin         float64 `json:"valid_min"`
+	ValidMax         float64 `json:"valid_max"`
+	Resolution       float64 `json:"resolution"`
+	ExpectedInterval string  `json:"expected_interval,omitempty"` // Go duration; absent for event-driven streams
+}
+
+// LogEntry is one log line on GET /v1/logs/stream.
+type LogEntry struct {
+	Time    time.Time         `json:"time"`
+	Level   string            `json:"level"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// ErrUnknownModule is returned by a module setter for a kind and name the
+// daemon does not run.
+var ErrUnknownModule = errors.New("unknown module")
+
+// SensorIdentity is the device behind a logical sensor, on GET and PUT
+// /v1/sensors/{name}/identity.
+type SensorIdentity struct {
+	Sensor       string     `json:"sensor"`
+	SerialNumber string     `json:"serial_number,omitempty"` // the device the sensor is bound to
+	BoundSince   *time.Time `json:"bound_since,omitempty"`
+	Model        string     `json:"model,omitempty"`                   // of the device last connected
+	Connected    string     `json:"connected_serial_number,omitempty"` // of the device last connected
+	State        string     `json:"state"`                             // confirmed, unconfirmed, or unknown for a device without a serial number
+	HeldReadings int        `json:"held_readings,omitempty"`           // polls waiting for the swap to be confirmed
+}
+
+// ErrUnknownSensor is returned for a sensor name the daemon does not poll.
+var ErrUnknownSensor = errors.New("unknown sensor")
+
+// ErrIdentityMismatch is returned when a remap names another serial number
+// than the connected device's.
+var ErrIdentityMismatch = errors.New("serial number does not match the connected device")
+
+// ErrSubjectRecording is returned by a subject deletion for the subject the
+// rig is recording.
+var ErrSubjectRecording = errors.New("subject is being recorded")
+
+// ErrUnknownSession is returned for a session that is neither being recorded
+// nor in the session history.
+var ErrUnknownSession = errors.New("unknown session")
+
+// Capabilities is the body of GET /v1/capabilities.
+type Capabilities struct {
+	Version      string       `json:"version"`
+	APIVersions  []string     `json:"api_versions"`
+	GRPCPackages []string     `json:"grpc_packages"` // empty without the gRPC API
+	Sensors      []SensorInfo `json:"sensors"`
+	Metrics      []string     `json:"metrics"`
+	Features     []string     `json:"features"`
+}
+
+// Server is the daemon's REST API, and its gRPC API when ServeGRPC is set.
+type Server struct {
+	mux      *http.ServeMux
+	srv      *http.Server
+	sensors  []SensorInfo
+	onMarker func(label string) error
+	latest   *latest.Cache
+	readings *latest.Feed
+	grpcAddr string // empty without the gRPC API
+	state    func(sensor string) string
+	modules  func() []ModuleInfo
+	setMod   func(kind, name string, enabled bool) (ModuleInfo, error)
+	events   func(eventlog.Query) ([]eventlog.Entry, error)
+	contract []Contract
+	trace    func() []serialio.TraceEvent
+	logs     *logging.Stream
+	erase    func(subject string) (erasure.Report, error)
+	identity func(sensor string) (SensorIdentity, error)
+	remap    func(sensor, serial, note string) (SensorIdentity, error)
+	cors     func() []correction.Entry
+	correct  func(sensor, metric string, c correction.Correction) (correction.Entry, error)
+	uncorr   func(sensor, metric string) (bool, error)
+	fitted   func(sensor, metric string, c correction.Correction) (correction.Entry, error)
+	trends   func(session string, limit int) (trend.Comparison, error)
+	done     chan struct{} // closed on shutdown, ending streams
+}
+
+func NewServer(addr string, sensors []SensorInfo) *Server {
+	s := &Server{mux: http.NewServeMux(), sensors: sensors, done: make(chan struct{})}
+	s.srv = &http.Server{Addr: addr, Handler: withVersionHeader(s.mux)}
+	s.srv.RegisterOnShutdown(func() { close(s.done) }) // Shutdown waits for handlers, streams included
+	s.routes()
+	return s
+}
+
+func (s *Server) routes() {
+	v1 := map[string]http.HandlerFunc{
+		"/openapi.json":            s.handleOpenAPI,
+		"/capabilities":            s.handleCapabilities,
+		"/metrics/metadata":        s.handleMetadataList,
+		"/metrics/metadata/{name}": s.handleMetadata,
+	}
+	for path, h := range v1 {
+		s.mux.HandleFunc("GET /v1"+path, h)
+		s.mux.HandleFunc("GET "+path, h) // unversioned paths predate /v1
+	}
+	s.mux.HandleFunc("GET /v1/proto", s.handleProto)
+	s.mux.HandleFunc("POST /v1/markers", s.handleMarker)
+	s.mux.HandleFunc("GET /v1/metrics/latest", s.handleLatestList)
+	s.mux.HandleFunc("GET /v1/metrics/latest/{name}", s.handleLatest)
+	s.mux.HandleFunc("GET /v1/modules", s.handleModules)
+	s.mux.HandleFunc("PUT /v1/modules/{kind}/{name}", s.handleSetModule)
+	s.mux.HandleFunc("GET /v1/events", s.handleEvents)
+	s.mux.HandleFunc("GET /v1/alerts", s.handleAlerts)
+	s.mux.HandleFunc("GET /v1/metrics/contracts", s.handleContracts)
+	s.mux.HandleFunc("GET /v1/debug/serial-trace", s.handleTrace)
+	s.mux.HandleFunc("GET /v1/logs/stream", s.handleLogStream)
+	s.mux.HandleFunc("DELETE /v1/subjects/{subject}", s.handleDeleteSubject)
+	s.mux.HandleFunc("GET /v1/sensors/{name}/identity", s.handleIdentity)
+	s.mux.HandleFunc("PUT /v1/sensors/{name}/identity", s.handleRemap)
+	s.mux.HandleFunc("GET /v1/corrections", s.handleCorrections)
+	s.mux.HandleFunc("PUT /v1/sensors/{name}/corrections/{metric}", s.handleSetCorrection)
+	s.mux.HandleFunc("DELETE /v1/sensors/{name}/corrections/{metric}", s.handleDeleteCorrection)
+	s.mux.HandleFunc("POST /v1/sensors/{name}/calibrations/{metric}", s.handleCalibrate)
+	s.mux.HandleFunc("GET /v1/sessions/{id}/trends", s.handleTrends)
+}
+
+// ServeLatest enables the latest-value endpoints, backed by c.
+func (s *Server) ServeLatest(c *latest.Cache) {
+	s.latest = c
+}
+
+// ServeReadings streams every value published to feed over gRPC.
+func (s *Server) ServeReadings(feed *latest.Feed) {
+	s.readings = feed
+}
+
+// ServeGRPC serves the gRPC API on addr beside the REST API.
+func (s *Server) ServeGRPC(addr string) {
+	s.grpcAddr = addr
+}
+
+// ServeSensorStates reports each sensor's live connection state, from fn, in
+// /v1/capabilities.
+func (s *Server) ServeSensorStates(fn func(sensor string) string) {
+	s.state = fn
+}
+
+// HandleModules enables GET /v1/modules, listing what list returns, and
+// PUT /v1/modules/{kind}/{name}, which passes the requested state to set.
+func (s *Server) HandleModules(list func() []ModuleInfo, set func(kind, name string, enabled bool) (ModuleInfo, error)) {
+	s.modules, s.setMod = list, set
+}
+
+// HandleEvents enables GET /v1/events and GET /v1/alerts, answered by query.
+func (s *Server) HandleEvents(query func(eventlog.Query) ([]eventlog.Entry, error)) {
+	s.events = query
+}
+
+// ServeContracts enables GET /v1/metrics/contracts, listing cs.
+func (s *Server) ServeContracts(cs []Contract) {
+	s.contract = cs
+}
+
+// ServeTrace enables GET /v1/debug/serial-trace, the recent serial traffic
+// from fn, for support bundles.
+func (s *Server) ServeTrace(fn func() []serialio.TraceEvent) {
+	s.trace = fn
+}
+
+// ServeLogs enables GET /v1/logs/stream, which follows the entries written
+// to logs as server-sent events.
+func (s *Server) ServeLogs(logs *logging.Stream) {
+	s.logs = logs
+}
+
+// HandleMarkers enables POST /v1/markers, passing each label to fn.
+func (s *Server) HandleMarkers(fn func(label string) error) {
+	s.onMarker = fn
+}
+
+// HandleSubjectDeletion enables DELETE /v1/subjects/{subject}, which erases
+// the subject's stored data with fn and answers with its report.
+func (s *Server) HandleSubjectDeletion(fn func(subject string) (erasure.Report, error)) {
+	s.erase = fn
+}
+
+// withVersionHeader tells clients which API version answered.
+// HandleIdentity serves the device behind each sensor, and lets an operator
+// map a replacement probe to the sensor it stands in for.
+func (s *Server) HandleIdentity(get func(sensor string) (SensorIdentity, error), remap func(sensor, serial, note string) (SensorIdentity, error)) {
+	s.identity = get
+	s.remap = remap
+}
+
+// HandleCorrections enables GET /v1/corrections, listing the calibration
+// corrections in force, and PUT and DELETE
+// /v1/sensors/{name}/corrections/{metric}, which set and remove one.
+func (s *Server) HandleCorrections(list func() []correction.Entry, set func(sensor, metric string, c correction.Correction) (correction.Entry, error), remove func(sensor, metric string) (bool, error)) {
+	s.cors, s.correct, s.uncorr = list, set, remove
+}
+
+// HandleCalibrations enables POST /v1/sensors/{name}/calibrations/{metric},
+// which fits a curve to reference points and, if the fit is good, stores it
+// with store.
+func (s *Server) HandleCalibrations(store func(sensor, metric string, c correction.Correction) (correction.Entry, error)) {
+	s.fitted = store
+}
+
+// HandleTrends enables GET /v1/sessions/{id}/trends, comparing a session,
+// or the one being recorded for "current", with the sessions before it.
+func (s *Server) HandleTrends(fn func(session string, limit int) (trend.Comparison, error)) {
+	s.trends = fn
+}
+
+// Calibration is the outcome of a multipoint calibration: the fit, and the
+// correction stored for it unless the fit was rejected.
+type Calibration struct {
+	Fit        correction.Fit    `json:"fit"`
+	Correction *correction.Entry `json:"correction,omitempty"`
+}
+
+func withVersionHeader(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("API-Version", CurrentVersion)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) Handler() http.Handler {
+	return s.srv.Handler
+}
+
+// Run serves until ctx is cancelled.
+func (s *Server) Run(ctx context.Context) error {
+	errCh := make(chan error, 2)
+	if s.grpcAddr != "" {
+		lis, err := net.Listen("tcp", s.grpcAddr)
+		if err != nil {
+			return fmt.Errorf("grpc api: %w", err)
+		}
+		gs := s.newGRPCServer()
+		defer gs.GracefulStop() // after Shutdown has ended the streams
+		go func() { errCh <- gs.Serve(lis) }()
+		log.Printf("grpc api listening on %s", lis.Addr())
+	}
+	go func() { errCh <- s.srv.ListenAndServe() }()
+	log.Printf("api listening on %s", s.srv.Addr)
+
+	select {
+	case err := <-errCh:
+		s.srv.Shutdown(context.Background()) // ends the streams of the server still up
+		return err
+	case <-ctx.Done():
+		return s.srv.Shutdown(context.Background())
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+// locale takes ?lang= first, then the first Accept-Language entry.
+func locale(r *http.Request) string {
+	if lang := r.URL.Query().Get("lang"); lang != "" {
+		return lang
+	}
+	al := r.Header.Get("Accept-Language")
+	if al == "" {
+		return metricdef.DefaultLocale
+	}
+	first := strings.TrimSpace(strings.SplitN(al, ",", 2)[0])
+	return strings.SplitN(first, ";", 2)[0]
+}
+
+func (s *Server) handleMetadataList(w http.ResponseWriter, r *http.Request) {
+	loc := locale(r)
+	var out []metricdef.Localized
+	for _, d := range metricdef.All() {
+		out = append(out, d.Localize(loc))
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) handleMetadata(w http.ResponseWriter, r *http.Request) {
+	d, ok := metricdef.Lookup(r.PathValue("name"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown metric")
+		return
+	}
+	writeJSON(w, http.StatusOK, d.Localize(locale(r)))
+}
+
+// handleOpenAPI serves the embedded spec stamped with the running version, so
+// generated clients always match the daemon they talk to.
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	var spec map[string]any
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		writeError(w, http.StatusInternalServerError, "embedded OpenAPI spec is invalid")
+		return
+	}
+	if info, ok := spec["info"].(map[string]any); ok {
+		info["version"] = version.Version
+	}
+	writeJSON(w, http.StatusOK, spec)
+}
+
+func (s *Server) handleCapabilities(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.capabilities())
+}
+
+// capabilities lists the API surfaces this server was set up with.
+func (s *Server) capabilities() Capabilities {
+	caps := Capabilities{
+		Version:     version.Version,
+		APIVersions: Versions,
+		Sensors:     s.sensors,
+		Features:    Features,
+	}
+	caps.Features = append([]string(nil), Features...)
+	if s.onMarker != nil {
+		caps.Features = append(caps.Features, "markers")
+	}
+	if s.latest != nil {
+		caps.Features = append(caps.Features, "latest")
+	}
+	if s.modules != nil {
+		caps.Features = append(caps.Features, "modules")
+	}
+	if s.events != nil {
+		caps.Features = append(caps.Features, "events")
+	}
+	if s.contract != nil {
+		caps.Features = append(caps.Features, "contracts")
+	}
+	if s.trace != nil {
+		caps.Features = append(caps.Features, "serial_trace")
+	}
+	if s.logs != nil {
+		caps.Features = append(caps.Features, "log_stream")
+	}
+	if s.erase != nil {
+		caps.Features = append(caps.Features, "subject_deletion")
+	}
+	if s.identity != nil {
+		caps.Features = append(caps.Features, "sensor_identity")
+	}
+	if s.cors != nil {
+		caps.Features = append(caps.Features, "corrections")
+	}
+	if s.fitted != nil {
+		caps.Features = append(caps.Features, "calibrations")
+	}
+	if s.trends != nil {
+		caps.Features = append(caps.Features, "trends")
+	}
+	caps.GRPCPackages = []string{}
+	if s.grpcAddr != "" {
+		caps.Features = append(caps.Features, "grpc")
+		caps.GRPCPackages = GRPCPackages
+	}
+	if caps.Sensors == nil {
+		caps.Sensors = []SensorInfo{}
+	}
+	if s.state != nil {
+		caps.Sensors = append([]SensorInfo(nil), caps.Sensors...)
+		for i := range caps.Sensors {
+			caps.Sensors[i].State = s.state(caps.Sensors[i].Name)
+		}
+	}
+	for _, d := range metricdef.All() {
+		caps.Metrics = append(caps.Metrics, d.Name)
+	}
+	return caps
+}
+
+func (s *Server) handleMarker(w http.ResponseWriter, r *http.Request) {
+	if s.onMarker == nil {
+		writeError(w, http.StatusNotFound, "markers are not accepted by this rig")
+		return
+	}
+	var body struct {
+		Label string `json:"label"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Label == "" {
+		writeError(w, http.StatusBadRequest, "body must be {\"label\": \"...\"}")
+		return
+	}
+	if err := s.onMarker(body.Label); err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleDeleteSubject(w http.ResponseWriter, r *http.Request) {
+	if s.erase == nil {
+		writeError(w, http.StatusNotFound, "subject deletion is not available on this rig")
+		return
+	}
+	rep, err := s.erase(r.PathValue("subject"))
+	switch {
+	case errors.Is(err, ErrSubjectRecording):
+		writeError(w, http.StatusConflict, err.Error())
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	default:
+		writeJSON(w, http.StatusOK, rep)
+	}
+}
+
+func (s *Server) handleIdentity(w http.ResponseWriter, r *http.Request) {
+	if s.identity == nil {
+		writeError(w, http.StatusNotFound, "sensor identities are not available on this rig")
+		return
+	}
+	id, err := s.identity(r.PathValue("name"))
+	switch {
+	case errors.Is(err, ErrUnknownSensor):
+		writeError(w, http.StatusNotFound, err.Error())
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	default:
+		writeJSON(w, http.StatusOK, id)
+	}
+}
+
+func (s *Server) handleRemap(w http.ResponseWriter, r *http.Request) {
+	if s.remap == nil {
+		writeError(w, http.StatusNotFound, "sensor identities are not available on this rig")
+		return
+	}
+	var body struct {
+		SerialNumber string `json:"serial_number"`
+		Note         string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.SerialNumber == "" {
+		writeError(w, http.StatusBadRequest, "body must be {\"serial_number\": \"...\"}")
+		return
+	}
+	id, err := s.remap(r.PathValue("name"), body.SerialNumber, body.Note)
+	switch {
+	case errors.Is(err, ErrUnknownSensor):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrIdentityMismatch):
+		writeError(w, http.StatusConflict, err.Error())
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	default:
+		writeJSON(w, http.StatusOK, id)
+	}
+}
+
+func (s *Server) handleLatestList(w http.ResponseWriter, r *http.Request) {
+	if s.latest == nil {
+		writeError(w, http.StatusNotFound, "latest values are not available")
+		return
+	}
+	out := s.latest.All()
+	if out == nil {
+		out = []latest.Value{}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) handleLatest(w http.ResponseWriter, r *http.Request) {
+	if s.latest == nil {
+		writeError(w, http.StatusNotFound, "latest values are not available")
+		return
+	}
+	v, ok := s.latest.Load(r.PathValue("name"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "no value for metric")
+		return
+	}
+	writeJSON(w, http.StatusOK, v)
+}
+
+func (s *Server) handleContracts(w http.ResponseWriter, r *http.Request) {
+	if s.contract == nil {
+		writeError(w, http.StatusNotFound, "metric contracts are not available")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.contract)
+}
+
+func (s *Server) handleTrace(w http.ResponseWriter, r *http.Request) {
+	if s.trace == nil {
+		writeError(w, http.StatusNotFound, "serial tracing is not available")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.trace())
+}
+
+// logKeepAlive is how often an idle log stream sends a comment, so proxies
+// do not close it.
+const logKeepAlive = 15 * time.Second
+
+func (s *Server) handleLogStream(w http.ResponseWriter, r *http.Request) {
+	if s.logs == nil {
+		writeError(w, http.StatusNotFound, "log streaming is not available")
+		return
+	}
+	level, err := logging.ParseLevel(r.URL.Query().Get("level"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+	sub := s.logs.Subscribe(level, 256)
+	defer s.logs.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	keepAlive := time.NewTicker(logKeepAlive)
+	defer keepAlive.Stop()
+	var reported int64
+	for {
+		select {
+		case e, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if d := sub.Dropped(); d > reported { // the client fell behind
+				fmt.Fprintf(w, "event: dropped\ndata: {\"dropped\": %d}\n\n", d-reported)
+				reported = d
+			}
+			data, err := json.Marshal(LogEntry{Time: e.Time.UTC(), Level: e.Level.String(), Message: e.Message, Fields: e.Fields})
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		case <-s.done:
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func (s *Server) handleModules(w http.ResponseWriter, r *http.Request) {
+	if s.modules == nil {
+		writeError(w, http.StatusNotFound, "modules cannot be switched on this rig")
+		return
+	}
+	out := s.modules()
+	if out == nil {
+		out = []ModuleInfo{}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) handleSetModule(w http.ResponseWriter, r *http.Request) {
+	if s.setMod == nil {
+		writeError(w, http.StatusNotFound, "modules cannot be switched on this rig")
+		return
+	}
+	var body struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Enabled == nil {
+		writeError(w, http.StatusBadRequest, "body must be {\"enabled\": true|false}")
+		return
+	}
+	m, err := s.setMod(r.PathValue("kind"), r.PathValue("name"), *body.Enabled)
+	switch {
+	case errors.Is(err, ErrUnknownModule):
+		writeError(w, http.StatusNotFound, err.Error())
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	default:
+		writeJSON(w, http.StatusOK, m)
+	}
+}
+
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	s.serveEvents(w, r, false)
+}
+
+func (s *Server) handleAlerts(w http.ResponseWriter, r *http.Request) {
+	s.serveEvents(w, r, true)
+}
+
+// serveEvents answers ?from=&to= (RFC 3339), or ?at= with a ?window= either
+// side (default 5m), narrowed by ?type= (repeatable), ?sensor=, and ?limit=.
+func (s *Server) serveEvents(w http.ResponseWriter, r *http.Request, alerts bool) {
+	if s.events == nil {
+		writeError(w, http.StatusNotFound, "events are not kept on this rig")
+		return
+	}
+	q, err := parseEventQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	q.Alerts = alerts
+	out, err := s.events(q)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if out == nil {
+		out = []eventlog.Entry{}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func parseEventQuery(v url.Values) (eventlog.Query, error) {
+	q := eventlog.Query{Types: v["type"], Sensor: v.Get("sensor")}
+	for name, t := range map[string]*time.Time{"from": &q.From, "to": &q.To} {
+		if s := v.Get(name); s != "" {
+			parsed, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				return q, fmt.Errorf("%s must be an RFC 3339 time", name)
+			}
+			*t = parsed
+		}
+	}
+	if s := v.Get("at"); s != "" {
+		at, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return q, fmt.Errorf("at must be an RFC 3339 time")
+		}
+		window := 5 * time.Minute
+		if s := v.Get("window"); s != "" {
+			if window, err = time.ParseDuration(s); err != nil || window < 0 {
+				return q, fmt.Errorf("window must be a duration like 10m")
+			}
+		}
+		q.From, q.To = at.Add(-window), at.Add(window)
+	}
+	if s := v.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return q, fmt.Errorf("limit must be a non-negative integer")
+		}
+		q.Limit = n
+	}
+	return q, nil
+}
+
+func (s *Server) handleCorrections(w http.ResponseWriter, r *http.Request) {
+	if s.cors == nil {
+		writeError(w, http.StatusNotFound, "corrections are not available on this rig")
+		return
+	}
+	out := s.cors()
+	if out == nil {
+		out = []correction.Entry{}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) handleSetCorrection(w http.ResponseWriter, r *http.Request) {
+	if s.correct == nil {
+		writeError(w, http.StatusNotFound, "corrections are not available on this rig")
+		return
+	}
+	var body struct {
+		Slope  *float64 `json:"slope"`
+		Offset float64  `json:"offset"`
+		Unit   string   `json:"unit"`
+		Note   string   `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "body must be {\"slope\": 1.0, \"offset\": 0.0}")
+		return
+	}
+	c := correction.Correction{Slope: 1, Offset: body.Offset, Unit: body.Unit, Note: body.Note, Since: time.Now().UTC()}
+	if body.Slope != nil {
+		c.Slope = *body.Slope
+	}
+	if err := c.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	e, err := s.correct(r.PathValue("name"), r.PathValue("metric"), c)
+	switch {
+	case errors.Is(err, ErrUnknownSensor):
+		writeError(w, http.StatusNotFound, err.Error())
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	default:
+		writeJSON(w, http.StatusOK, e)
+	}
+}
+
+func (s *Server) handleDeleteCorrection(w http.ResponseWriter, r *http.Request) {
+	if s.uncorr == nil {
+		writeError(w, http.StatusNotFound, "corrections are not available on this rig")
+		return
+	}
+	found, err := s.uncorr(r.PathValue("name"), r.PathValue("metric"))
+	switch {
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	case !found:
+		writeError(w, http.StatusNotFound, fmt.Sprintf("no correction for %s %s", r.PathValue("name"), r.PathValue("metric")))
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *Server) handleCalibrate(w http.ResponseWriter, r *http.Request) {
+	if s.fitted == nil {
+		writeError(w, http.StatusNotFound, "calibrations are not available on this rig")
+		return
+	}
+	var body struct {
+		Points []correction.Point `json:"points"`
+		correction.FitOptions
+		Unit string `json:"unit"`
+		Note string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "body must be {\"points\": [{\"reading\": 0, \"reference\": 0}, ...], \"method\": \"polynomial\"}")
+		return
+	}
+	fit, err := correction.FitCurve(body.Points, body.FitOptions)
+	switch {
+	case errors.Is(err, correction.ErrPoorFit):
+		writeJSON(w, http.StatusUnprocessableEntity, Calibration{Fit: fit})
+		return
+	case err != nil:
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	c := correction.Correction{Curve: &fit.Curve, Unit: body.Unit, Note: body.Note, Since: time.Now().UTC()}
+	e, err := s.fitted(r.PathValue("name"), r.PathValue("metric"), c)
+	switch {
+	case errors.Is(err, ErrUnknownSensor):
+		writeError(w, http.StatusNotFound, err.Error())
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	default:
+		writeJSON(w, http.StatusOK, Calibration{Fit: fit, Correction: &e})
+	}
+}
+
+// handleTrends answers ?limit=, the most recent previous sessions to compare
+// with (default 20, 0 for all).
+func (s *Server) handleTrends(w http.ResponseWriter, r *http.Request) {
+	if s.trends == nil {
+		writeError(w, http.StatusNotFound, "session history is not kept on this rig")
+		return
+	}
+	limit := 20
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "limit must be a non-negative integer")
+			return
+		}
+		limit = n
+	}
+	out, err := s.trends(r.PathValue("id"), limit)
+	switch {
+	case errors.Is(err, ErrUnknownSession):
+		writeError(w, http.StatusNotFound, err.Error())
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	default:
+		writeJSON(w, http.StatusOK, out)
+	}
+}
@@ -0,0 +1,248 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/demelere/sensor-control-modules/internal/eventlog"
+	"github.com/demelere/sensor-control-modules/internal/latest"
+	"github.com/demelere/sensor-control-modules/internal/logging"
+	sensorctlv1 "github.com/demelere/sensor-control-modules/pkg/proto/sensorctl/v1"
+)
+
+// eventPageSize is the page size of ListEvents when the request sets none,
+// and maxEventPageSize the largest it grants.
+const (
+	eventPageSize    = 100
+	maxEventPageSize = 1000
+)
+
+// newGRPCServer registers the sensorctl.v1 service, and server reflection
+// so tools like grpcurl can read its descriptors from the daemon.
+func (s *Server) newGRPCServer() *grpc.Server {
+	gs := grpc.NewServer()
+	sensorctlv1.RegisterSensorControlServer(gs, grpcService{s: s})
+	reflection.Register(gs)
+	return gs
+}
+
+// protoDescriptors is the gRPC API's schema: its proto files and everything
+// they import, in dependency order.
+func protoDescriptors() *descriptorpb.FileDescriptorSet {
+	set := &descriptorpb.FileDescriptorSet{}
+	seen := map[string]bool{}
+	var add func(f protoreflect.FileDescriptor)
+	add = func(f protoreflect.FileDescriptor) {
+		if seen[f.Path()] {
+			return
+		}
+		seen[f.Path()] = true
+		imports := f.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			add(imports.Get(i).FileDescriptor)
+		}
+		set.File = append(set.File, protodesc.ToFileDescriptorProto(f))
+	}
+	add(sensorctlv1.File_sensorctl_v1_sensorctl_proto)
+	return set
+}
+
+// handleProto serves the gRPC API's descriptors as a FileDescriptorSet, which
+// protoc takes with --descriptor_set_in, or as JSON with ?format=json.
+func (s *Server) handleProto(w http.ResponseWriter, r *http.Request) {
+	set := protoDescriptors()
+	switch r.URL.Query().Get("format") {
+	case "", "binary":
+		data, err := proto.Marshal(set)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.Header().Set("Content-Disposition", `attachment; filename="sensorctl.binpb"`)
+		w.Write(data)
+	case "json":
+		data, err := protojson.Marshal(set)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		writeError(w, http.StatusBadRequest, "format must be binary or json")
+	}
+}
+
+// grpcService answers the gRPC API from the same sources as the REST routes.
+type grpcService struct {
+	sensorctlv1.UnimplementedSensorControlServer
+	s *Server
+}
+
+func (g grpcService) GetCapabilities(ctx context.Context, _ *sensorctlv1.GetCapabilitiesRequest) (*sensorctlv1.Capabilities, error) {
+	caps := g.s.capabilities()
+	out := &sensorctlv1.Capabilities{Version: caps.Version, ApiVersions: caps.APIVersions, GrpcPackages: caps.GRPCPackages, Metrics: caps.Metrics, Features: caps.Features}
+	for _, si := range caps.Sensors {
+		out.Sensors = append(out.Sensors, &sensorctlv1.SensorInfo{Name: si.Name, Driver: si.Driver, Metric: si.Metric, Unit: si.Unit, State: si.State, Simulated: si.Simulated})
+	}
+	return out, nil
+}
+
+func (g grpcService) ListLatest(ctx context.Context, _ *sensorctlv1.ListLatestRequest) (*sensorctlv1.ListLatestResponse, error) {
+	if g.s.latest == nil {
+		return nil, status.Error(codes.Unimplemented, "latest values are not available")
+	}
+	out := &sensorctlv1.ListLatestResponse{}
+	for _, v := range g.s.latest.All() {
+		out.Readings = append(out.Readings, protoReading(v))
+	}
+	return out, nil
+}
+
+func (g grpcService) StreamReadings(req *sensorctlv1.StreamReadingsRequest, stream sensorctlv1.SensorControl_StreamReadingsServer) error {
+	if g.s.readings == nil {
+		return status.Error(codes.Unimplemented, "reading streams are not available")
+	}
+	metrics, sensors := set(req.GetMetrics()), set(req.GetSensors())
+	sub := g.s.readings.Subscribe(256)
+	defer g.s.readings.Unsubscribe(sub)
+	for {
+		select {
+		case v, ok := <-sub.C:
+			if !ok {
+				return nil
+			}
+			if metrics != nil && !metrics[v.Metric] || sensors != nil && !sensors[v.Sensor] {
+				continue
+			}
+			if err := stream.Send(protoReading(v)); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case <-g.s.done:
+			return status.Error(codes.Unavailable, "daemon is shutting down")
+		}
+	}
+}
+
+// ListEvents pages through the matches oldest first. A page token is the
+// offset of the page's first event among them.
+func (g grpcService) ListEvents(ctx context.Context, req *sensorctlv1.ListEventsRequest) (*sensorctlv1.ListEventsResponse, error) {
+	if g.s.events == nil {
+		return nil, status.Error(codes.Unimplemented, "events are not kept on this rig")
+	}
+	q := eventlog.Query{Types: req.GetTypes(), Sensor: req.GetSensor(), Alerts: req.GetAlertsOnly()}
+	if req.From != nil {
+		q.From = req.From.AsTime()
+	}
+	if req.To != nil {
+		q.To = req.To.AsTime()
+	}
+	offset := 0
+	if t := req.GetPageToken(); t != "" {
+		n, err := strconv.Atoi(t)
+		if err != nil || n < 0 {
+			return nil, status.Error(codes.InvalidArgument, "invalid page token")
+		}
+		offset = n
+	}
+	size := int(req.GetPageSize())
+	switch {
+	case size < 0:
+		return nil, status.Error(codes.InvalidArgument, "page size must not be negative")
+	case size == 0:
+		size = eventPageSize
+	case size > maxEventPageSize:
+		size = maxEventPageSize
+	}
+	all, err := g.s.events(q)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	out := &sensorctlv1.ListEventsResponse{}
+	if offset >= len(all) {
+		return out, nil
+	}
+	page := all[offset:min(offset+size, len(all))]
+	for _, e := range page {
+		pe := &sensorctlv1.Event{Time: timestamppb.New(e.Time), Type: e.Type, Sensor: e.Sensor, Session: e.Session, Alert: e.Alert, Message: e.Message, EventJson: string(e.Event)}
+		if e.End != nil {
+			pe.End = timestamppb.New(*e.End)
+		}
+		out.Events = append(out.Events, pe)
+	}
+	if next := offset + len(page); next < len(all) {
+		out.NextPageToken = strconv.Itoa(next)
+	}
+	return out, nil
+}
+
+func (g grpcService) StreamLogs(req *sensorctlv1.StreamLogsRequest, stream sensorctlv1.SensorControl_StreamLogsServer) error {
+	if g.s.logs == nil {
+		return status.Error(codes.Unimplemented, "log streaming is not available")
+	}
+	level, err := logging.ParseLevel(req.GetLevel())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	sub := g.s.logs.Subscribe(level, 256)
+	defer g.s.logs.Unsubscribe(sub)
+	for {
+		select {
+		case e, ok := <-sub.C:
+			if !ok {
+				return nil
+			}
+			if err := stream.Send(&sensorctlv1.LogEntry{Time: timestamppb.New(e.Time), Level: e.Level.String(), Message: e.Message, Fields: e.Fields}); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case <-g.s.done:
+			return status.Error(codes.Unavailable, "daemon is shutting down")
+		}
+	}
+}
+
+func (g grpcService) AddMarker(ctx context.Context, req *sensorctlv1.AddMarkerRequest) (*sensorctlv1.AddMarkerResponse, error) {
+	if g.s.onMarker == nil {
+		return nil, status.Error(codes.Unimplemented, "markers are not accepted by this rig")
+	}
+	if req.GetLabel() == "" {
+		return nil, status.Error(codes.InvalidArgument, "label must not be empty")
+	}
+	if err := g.s.onMarker(req.GetLabel()); err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return &sensorctlv1.AddMarkerResponse{}, nil
+}
+
+func protoReading(v latest.Value) *sensorctlv1.Reading {
+	return &sensorctlv1.Reading{Sensor: v.Sensor, Metric: v.Metric, Value: v.Value, Unit: v.Unit, Time: timestamppb.New(v.Time)}
+}
+
+// set is names as a set, nil when there are none.
+func set(names []string) map[string]bool {
+	if len(names) == 0 {
+		return nil
+	}
+	out := make(map[string]bool, len(names))
+	for _, n := range names {
+		out[n] = true
+	}
+	return out
+}
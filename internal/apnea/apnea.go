@@ -0,0 +1,169 @@
+package apnea
+
+import (
+	"log"
+	"math"
+	"sync"
+	"time"
+)
+
+var (
+	apneaDefaultFlowThresholdSCFM float64
+	apneaDefaultCO2SwingPPM       float64
+	apneaDefaultMinDuration       time.Duration
+)
+
+func init() {
+	apneaDefaultFlowThresholdSCFM = 0.05
+	apneaDefaultCO2SwingPPM = 150
+	apneaDefaultMinDuration = 10 * time.Second
+}
+
+type EventType int
+
+const (
+	EventStart EventType = iota
+	EventEnd
+)
+
+func (et EventType) String() string {
+	switch et {
+	case EventStart:
+		return "apnea_start"
+	case EventEnd:
+		return "apnea_end"
+	}
+	return "unknown"
+}
+
+// Event marks the beginning or end of a breath-hold. Start is backdated to the
+// last observed breath, End and Duration are only set on EventEnd.
+type Event struct {
+	Type     EventType
+	Start    time.Time
+	End      time.Time
+	Duration time.Duration
+}
+
+type sample struct {
+	t time.Time
+	v float64
+}
+
+// Detector flags breath-hold periods from a flow trace, a CO2 trace, or both.
+// Breathing is considered absent when flow has stayed below the flow threshold
+// and the CO2 trace has stopped swinging for at least the minimum duration.
+type Detector struct {
+	flowThreshold float64
+	co2Swing      float64
+	minDuration   time.Duration
+	lock          sync.Mutex
+	haveFlow      bool
+	lastBreath    time.Time
+	co2           []sample
+	inApnea       bool
+	apneaStart    time.Time
+	eventCh       chan Event
+}
+
+func NewDetector(flowThresholdSCFM, co2SwingPPM float64, minDuration time.Duration) *Detector {
+	if flowThresholdSCFM <= 0 {
+		flowThresholdSCFM = apneaDefaultFlowThresholdSCFM
+	}
+	if co2SwingPPM <= 0 {
+		co2SwingPPM = apneaDefaultCO2SwingPPM
+	}
+	if minDuration <= 0 {
+		minDuration = apneaDefaultMinDuration
+	}
+
+	return &Detector{
+		flowThreshold: flowThresholdSCFM,
+		co2Swing:      co2SwingPPM,
+		minDuration:   minDuration,
+		eventCh:       make(chan Event, 16),
+	}
+}
+
+// Events returns the channel apnea start/end events are published on. Events
+// are dropped (and logged) if the channel is not drained.
+func (d *Detector) Events() <-chan Event {
+	return d.eventCh
+}
+
+func (d *Detector) AddFlow(t time.Time, flowSCFM float64) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if !d.haveFlow || math.Abs(flowSCFM) >= d.flowThreshold { // first sample anchors the quiet period
+		d.lastBreath = t
+	}
+	d.haveFlow = true
+	d.evaluate(t)
+}
+
+func (d *Detector) AddCO2(t time.Time, co2PPM float64) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.co2 = append(d.co2, sample{t: t, v: co2PPM})
+	cutoff := t.Add(-d.minDuration)
+	i := 0
+	for i < len(d.co2)-1 && d.co2[i+1].t.Before(cutoff) { // keep one sample at or before the cutoff so the window spans minDuration
+		i++
+	}
+	d.co2 = d.co2[i:]
+	d.evaluate(t)
+}
+
+func (d *Detector) co2Quiet(t time.Time) (bool, bool) { // returns (quiet, enough data)
+	if len(d.co2) == 0 || t.Sub(d.co2[0].t) < d.minDuration {
+		return false, false
+	}
+
+	lo, hi := d.co2[0].v, d.co2[0].v
+	for _, s := range d.co2[1:] {
+		lo = math.Min(lo, s.v)
+		hi = math.Max(hi, s.v)
+	}
+	return hi-lo <= d.co2Swing, true
+}
+
+func (d *Detector) evaluate(t time.Time) {
+	flowQuiet := d.haveFlow && t.Sub(d.lastBreath) >= d.minDuration
+	co2Quiet, haveCO2 := d.co2Quiet(t)
+
+	var absent bool
+	switch {
+	case d.haveFlow && haveCO2:
+		absent = flowQuiet && co2Quiet
+	case d.haveFlow:
+		absent = flowQuiet
+	case haveCO2:
+		absent = co2Quiet
+	}
+
+	if absent && !d.inApnea {
+		d.inApnea = true
+		d.apneaStart = t.Add(-d.minDuration)
+		if d.haveFlow {
+			d.apneaStart = d.lastBreath
+		}
+		d.emit(Event{Type: EventStart, Start: d.apneaStart})
+		return
+	}
+
+	breathing := (d.haveFlow && !flowQuiet) || (!d.haveFlow && haveCO2 && !co2Quiet)
+	if d.inApnea && breathing {
+		d.inApnea = false
+		d.emit(Event{Type: EventEnd, Start: d.apneaStart, End: t, Duration: t.Sub(d.apneaStart)})
+	}
+}
+
+func (d *Detector) emit(ev Event) {
+	select {
+	case d.eventCh <- ev:
+	default:
+		log.Printf("apnea event channel full, dropping %s event", ev.Type)
+	}
+}
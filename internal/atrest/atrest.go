@@ -0,0 +1,261 @@
+// Package atrest encrypts files as they are written, with AES-256-GCM, for
+// session data that counts as personal health information. A file is a
+// header followed by sealed chunks, one per Write, so a crash loses at most
+// the chunk being written and everything before it stays readable. The last
+// chunk is marked final, so a truncated file, or one with data appended, is
+// detected.
+package atrest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Suffix marks encrypted files.
+const Suffix = ".enc"
+
+const (
+	magic     = "SCMENC01"
+	prefixLen = 8        // random per file; the chunk counter fills the rest of the nonce
+	maxChunk  = 16 << 20 // refuse anything larger when reading, a corrupt length
+	maxChunks = 1 << 32  // the counter has 4 bytes of the nonce, and a nonce must never repeat
+	keyLen    = 32
+)
+
+var (
+	ErrNotEncrypted = errors.New("not an encrypted file")
+	ErrTruncated    = errors.New("file ends without its final chunk")
+	ErrTrailingData = errors.New("file has data after its final chunk")
+	ErrTooLarge     = errors.New("file has as many chunks as its nonces allow")
+)
+
+// LoadKey reads a 256-bit key, given as 64 hex digits or base64, from
+// source: "file:<path>", "env:<variable>", or "tpm:<handle>" to unseal it
+// from a TPM 2.0 object with tpm2_unseal.
+func LoadKey(source string) ([]byte, error) {
+	kind, arg, _ := strings.Cut(source, ":")
+	if arg == "" {
+		return nil, fmt.Errorf("encryption key %q: want file:<path>, env:<variable>, or tpm:<handle>", source)
+	}
+	var raw []byte
+	switch kind {
+	case "file":
+		data, err := os.ReadFile(arg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read encryption key: %w", err)
+		}
+		raw = data
+	case "env":
+		v, ok := os.LookupEnv(arg)
+		if !ok {
+			return nil, fmt.Errorf("encryption key: %s is not set", arg)
+		}
+		raw = []byte(v)
+	case "tpm":
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		out, err := exec.CommandContext(ctx, "tpm2_unseal", "-c", arg).Output()
+		if err != nil {
+			return nil, fmt.Errorf("failed to unseal encryption key from tpm %s: %v", arg, err)
+		}
+		if len(out) == keyLen { // sealed as raw bytes
+			return out, nil
+		}
+		raw = out
+	default:
+		return nil, fmt.Errorf("encryption key %q: unknown source %q (want file, env, or tpm)", source, kind)
+	}
+	return parseKey(raw)
+}
+
+func parseKey(raw []byte) ([]byte, error) {
+	s := string(bytes.TrimSpace(raw))
+	if key, err := hex.DecodeString(s); err == nil && len(key) == keyLen {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(s); err == nil && len(key) == keyLen {
+		return key, nil
+	}
+	return nil, fmt.Errorf("encryption key must be %d bytes as hex or base64, e.g. from \"openssl rand -hex 32\"", keyLen)
+}
+
+// Writer encrypts everything written through it. Each Write is sealed as one
+// chunk and written at once. A file holds at most 2^32 chunks, the last of
+// them the final one; a Write past that fails with ErrTooLarge, and the
+// caller should Close the file and start another.
+type Writer struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	prefix []byte
+	n      uint64
+	closed bool
+}
+
+// NewWriter writes the header to w and returns a Writer sealing with key.
+func NewWriter(w io.Writer, key []byte) (*Writer, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	prefix := make([]byte, prefixLen)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(append([]byte(magic), prefix...)); err != nil {
+		return nil, err
+	}
+	return &Writer{w: w, aead: aead, prefix: prefix}, nil
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, fmt.Errorf("atrest: write after close")
+	}
+	written := 0
+	for len(p) > 0 {
+		chunk := p[:min(len(p), maxChunk)] // split rather than write a chunk Reader refuses
+		if err := w.seal(chunk, false); err != nil {
+			return written, err
+		}
+		written += len(chunk)
+		p = p[len(chunk):]
+	}
+	return written, nil
+}
+
+// Close writes the final chunk. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.seal(nil, true)
+}
+
+func (w *Writer) seal(p []byte, final bool) error {
+	if w.n >= maxChunks || !final && w.n == maxChunks-1 { // the last counter is kept for the final chunk
+		return ErrTooLarge
+	}
+	sealed := w.aead.Seal(nil, nonce(w.prefix, w.n), p, additional(w.n, final))
+	w.n++
+	frame := binary.BigEndian.AppendUint32(nil, uint32(len(sealed)))
+	_, err := w.w.Write(append(frame, sealed...))
+	return err
+}
+
+// Reader decrypts a file written by Writer.
+type Reader struct {
+	r      *bufio.Reader
+	aead   cipher.AEAD
+	prefix []byte
+	n      uint64
+	buf    []byte
+	done   bool
+}
+
+// NewReader reads the header from r. It returns ErrNotEncrypted when r does
+// not start with one.
+func NewReader(r io.Reader, key []byte) (*Reader, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(r)
+	head := make([]byte, len(magic)+prefixLen)
+	if _, err := io.ReadFull(br, head); err != nil || string(head[:len(magic)]) != magic {
+		return nil, ErrNotEncrypted
+	}
+	return &Reader{r: br, aead: aead, prefix: head[len(magic):]}, nil
+}
+
+// Read returns ErrTruncated, after everything that could be decrypted, for a
+// file that was not closed, e.g. one the daemon was recording when the power
+// went, and ErrTrailingData for one with bytes after its final chunk.
+func (r *Reader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.done {
+			if _, err := r.r.Peek(1); err == nil {
+				return 0, ErrTrailingData
+			} else if err != io.EOF {
+				return 0, err
+			}
+			return 0, io.EOF
+		}
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *Reader) next() error {
+	if r.n >= maxChunks {
+		return ErrTooLarge
+	}
+	var size [4]byte
+	if _, err := io.ReadFull(r.r, size[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return ErrTruncated
+		}
+		return err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n > maxChunk+uint32(r.aead.Overhead()) {
+		return fmt.Errorf("chunk %d: length %d is corrupt", r.n, n)
+	}
+	sealed := make([]byte, n)
+	if _, err := io.ReadFull(r.r, sealed); err != nil {
+		return ErrTruncated
+	}
+	plain, err := r.aead.Open(nil, nonce(r.prefix, r.n), sealed, additional(r.n, false))
+	if err != nil {
+		if plain, err = r.aead.Open(nil, nonce(r.prefix, r.n), sealed, additional(r.n, true)); err != nil {
+			return fmt.Errorf("chunk %d does not decrypt: wrong key or corrupt file", r.n)
+		}
+		r.done = true
+	}
+	r.n++
+	r.buf = plain
+	return nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != keyLen {
+		return nil, fmt.Errorf("encryption key must be %d bytes", keyLen)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func nonce(prefix []byte, n uint64) []byte {
+	return binary.BigEndian.AppendUint32(append([]byte{}, prefix...), uint32(n))
+}
+
+// additional binds each chunk to its place in the file and marks the last,
+// so chunks cannot be reordered, dropped, or cut off unnoticed.
+func additional(n uint64, final bool) []byte {
+	ad := binary.BigEndian.AppendUint64([]byte(magic), n)
+	if final {
+		ad = append(ad, 1)
+	}
+	return ad
+}
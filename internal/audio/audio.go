@@ -0,0 +1,126 @@
+package audio
+
+import (
+	"fmt"
+	"log"
+	"os/exec"
+
+	"github.com/demelere/sensor-control-modules/internal/protocol"
+)
+
+var (
+	audioCmdPlayWAV string
+	audioCmdSpeak   string
+	audioQueueSize  int
+)
+
+func init() {
+	audioCmdPlayWAV = "aplay"
+	audioCmdSpeak = "espeak"
+	audioQueueSize = 8
+}
+
+// Cue is a single audible prompt: a WAV file, a phrase for text-to-speech, or
+// both (the WAV plays first).
+type Cue struct {
+	WAV  string
+	Say  string
+	Kind string // "stage" or "alert", only used for logging
+}
+
+// Player plays cues one at a time on the local speaker so prompts never talk
+// over each other. Alerts jump ahead of queued stage prompts.
+type Player struct {
+	playCmd string
+	sayCmd  string
+	stageCh chan Cue
+	alertCh chan Cue
+	doneCh  chan struct{}
+}
+
+func NewPlayer() (*Player, error) {
+	p := &Player{
+		stageCh: make(chan Cue, audioQueueSize),
+		alertCh: make(chan Cue, audioQueueSize),
+		doneCh:  make(chan struct{}),
+	}
+
+	if path, err := exec.LookPath(audioCmdPlayWAV); err == nil {
+		p.playCmd = path
+	}
+	if path, err := exec.LookPath(audioCmdSpeak); err == nil {
+		p.sayCmd = path
+	}
+	if p.playCmd == "" && p.sayCmd == "" {
+		return nil, fmt.Errorf("no audio output available: neither %s nor %s found in PATH", audioCmdPlayWAV, audioCmdSpeak)
+	}
+
+	go p.run()
+	return p, nil
+}
+
+func (p *Player) run() {
+	for {
+		select { // drain alerts before looking at stage prompts
+		case c := <-p.alertCh:
+			p.play(c)
+			continue
+		case <-p.doneCh:
+			return
+		default:
+		}
+
+		select {
+		case c := <-p.alertCh:
+			p.play(c)
+		case c := <-p.stageCh:
+			p.play(c)
+		case <-p.doneCh:
+			return
+		}
+	}
+}
+
+func (p *Player) play(c Cue) {
+	if c.WAV != "" {
+		if p.playCmd == "" {
+			log.Printf("cannot play %s cue %s: %s not available", c.Kind, c.WAV, audioCmdPlayWAV)
+		} else if err := exec.Command(p.playCmd, "-q", c.WAV).Run(); err != nil {
+			log.Printf("failed to play %s cue %s: %v", c.Kind, c.WAV, err)
+		}
+	}
+	if c.Say != "" {
+		if p.sayCmd == "" {
+			log.Printf("cannot speak %s cue %q: %s not available", c.Kind, c.Say, audioCmdSpeak)
+		} else if err := exec.Command(p.sayCmd, c.Say).Run(); err != nil {
+			log.Printf("failed to speak %s cue: %v", c.Kind, err)
+		}
+	}
+}
+
+func (p *Player) enqueue(ch chan Cue, c Cue) {
+	select {
+	case ch <- c:
+	default:
+		log.Printf("audio queue full, dropping %s cue", c.Kind)
+	}
+}
+
+// Alert queues an urgent spoken message, played before any pending stage cue.
+func (p *Player) Alert(message string) {
+	p.enqueue(p.alertCh, Cue{Say: message, Kind: "alert"})
+}
+
+// StageCue is a protocol.Runner OnStage hook: it plays the stage's sound (if
+// any) and reads out its operator prompt.
+func (p *Player) StageCue(stage protocol.Stage) {
+	say := stage.Prompt
+	if say == "" {
+		say = stage.Name
+	}
+	p.enqueue(p.stageCh, Cue{WAV: stage.Sound, Say: say, Kind: "stage"})
+}
+
+func (p *Player) Close() {
+	close(p.doneCh)
+}
@@ -0,0 +1,38 @@
+package chaos
+
+import (
+	"errors"
+	"time"
+)
+
+// Kind is what Next decided to do to one call.
+type Kind int
+
+const (
+	None       Kind = iota
+	Delay           // the call stalls for Fault.Delay, then goes ahead
+	Error           // the call fails the way a flaky device or broker would
+	Disconnect      // the link drops; for a broker, Fault.Delay is how long it stays down
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Delay:
+		return "delay"
+	case Error:
+		return "error"
+	case Disconnect:
+		return "disconnect"
+	}
+	return "none"
+}
+
+// Fault is one injected failure.
+type Fault struct {
+	Kind  Kind
+	Delay time.Duration
+}
+
+// ErrInjected is wrapped by every error a caller makes up for a Fault, so
+// logs and tests can tell injected failures from real ones.
+var ErrInjected = errors.New("chaos")
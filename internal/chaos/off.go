@@ -0,0 +1,11 @@
+//go:build !chaos
+
+package chaos
+
+// Enabled reports whether this is a chaos build (go build -tags chaos).
+const Enabled = false
+
+// Next never injects anything outside chaos builds.
+func Next(point string) Fault {
+	return Fault{}
+}
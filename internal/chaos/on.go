@@ -0,0 +1,112 @@
+//go:build chaos
+
+package chaos
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const Enabled = true
+
+var (
+	chaosDelayRate      float64
+	chaosErrorRate      float64
+	chaosDisconnectRate float64
+	chaosMaxDelay       time.Duration
+	chaosOutage         time.Duration
+	chaosSeed           int64
+
+	lock sync.Mutex
+	rng  *rand.Rand
+)
+
+func init() {
+	chaosDelayRate = 0.05
+	chaosErrorRate = 0.02
+	chaosDisconnectRate = 0.005
+	chaosMaxDelay = 3 * time.Second
+	chaosOutage = 30 * time.Second
+	chaosSeed = time.Now().UnixNano()
+
+	if spec := os.Getenv("SENSORCTL_CHAOS"); spec != "" {
+		if err := parse(spec); err != nil {
+			log.Fatalf("SENSORCTL_CHAOS: %v", err)
+		}
+	}
+	rng = rand.New(rand.NewSource(chaosSeed))
+	log.Printf("chaos mode: delay %.3g, error %.3g, disconnect %.3g per call (max delay %v, outage %v, seed %d)",
+		chaosDelayRate, chaosErrorRate, chaosDisconnectRate, chaosMaxDelay, chaosOutage, chaosSeed)
+}
+
+// parse reads comma-separated key=value overrides, e.g.
+// "error=0.1,disconnect=0,max_delay=5s,seed=42".
+func parse(spec string) error {
+	for _, kv := range strings.Split(spec, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(kv), "=")
+		if !ok {
+			return fmt.Errorf("expected key=value, got %q", kv)
+		}
+		var err error
+		switch key {
+		case "delay":
+			chaosDelayRate, err = strconv.ParseFloat(value, 64)
+		case "error":
+			chaosErrorRate, err = strconv.ParseFloat(value, 64)
+		case "disconnect":
+			chaosDisconnectRate, err = strconv.ParseFloat(value, 64)
+		case "max_delay":
+			chaosMaxDelay, err = time.ParseDuration(value)
+		case "outage":
+			chaosOutage, err = time.ParseDuration(value)
+		case "seed":
+			chaosSeed, err = strconv.ParseInt(value, 10, 64)
+		default:
+			return fmt.Errorf("unknown key %q", key)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// Configure replaces the rates and timings with spec, in the form
+// SENSORCTL_CHAOS takes, and restarts the generator from the seed, e.g. for a
+// test that needs one kind of fault at a time.
+func Configure(spec string) error {
+	lock.Lock()
+	defer lock.Unlock()
+	if err := parse(spec); err != nil {
+		return err
+	}
+	rng = rand.New(rand.NewSource(chaosSeed))
+	return nil
+}
+
+// Next decides the fault, if any, for one call at point, e.g. "serial" or
+// "exporter mqtt", and logs it.
+func Next(point string) Fault {
+	lock.Lock()
+	p := rng.Float64()
+	var f Fault
+	switch {
+	case p < chaosDisconnectRate:
+		f = Fault{Kind: Disconnect, Delay: chaosOutage}
+	case p < chaosDisconnectRate+chaosErrorRate:
+		f = Fault{Kind: Error}
+	case p < chaosDisconnectRate+chaosErrorRate+chaosDelayRate:
+		f = Fault{Kind: Delay, Delay: time.Duration(rng.Int63n(int64(chaosMaxDelay) + 1))}
+	}
+	lock.Unlock()
+	if f.Kind != None {
+		log.Printf("chaos: %s at %s", f.Kind, point)
+	}
+	return f
+}
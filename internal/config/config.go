@@ -0,0 +1,752 @@
+package config
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/demelere/sensor-control-modules/internal/simulate"
+	"github.com/demelere/sensor-control-modules/internal/units"
+)
+
+//go:embed default.json
+var defaultConfig []byte
+
+// Default returns the embedded default configuration, so the daemon can run
+// from a single binary with no files alongside it.
+func Default() []byte {
+	return append([]byte(nil), defaultConfig...)
+}
+
+// Duration is a time.Duration that reads and writes as a Go duration string.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"1s\": %v", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("failed to parse duration %q: %v", s, err)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+type Sensor struct {
+	Name         string            `json:"name"`
+	Driver       string            `json:"driver"`
+	Enabled      bool              `json:"enabled"`
+	Optional     bool              `json:"optional,omitempty"` // the daemon starts without it (degraded) and picks it up when it appears
+	BaudRate     int               `json:"baud_rate,omitempty"`
+	Address      int               `json:"address,omitempty"`
+	MAC          string            `json:"mac,omitempty"`
+	Port         string            `json:"port,omitempty"`       // serial device to open instead of discovering one
+	PortMatch    string            `json:"port_match,omitempty"` // regexp narrowing discovery by by-id link name (or "VID:PID serial" off Linux)
+	Protocol     string            `json:"protocol,omitempty"`   // "ascii" (default) or "modbus" (vaisala, kurz)
+	Parameters   []string          `json:"parameters,omitempty"` // metrics a multi-parameter probe reports, e.g. ["co2", "temperature"] (vaisala)
+	Stream       bool              `json:"stream,omitempty"`     // the probe prints samples every poll_interval instead of answering a request per sample (vaisala RUN mode)
+	Compensate   map[string]string `json:"compensate,omitempty"` // compensation ("pressure", "temperature", "humidity", "oxygen") -> metric whose latest value feeds it (vaisala)
+	PollInterval Duration          `json:"poll_interval,omitempty"`
+	Adaptive     Adaptive          `json:"adaptive,omitempty"`     // poll faster while the reading changes, in place of poll_interval
+	ReadTimeout  Duration          `json:"read_timeout,omitempty"` // wait for each reply from a serial sensor, default 2s
+	ReadRetries  int               `json:"read_retries,omitempty"` // resend a command whose reply is missing or malformed, default 2, -1 for never (kurz)
+	Priority     int               `json:"priority,omitempty"`     // dispatch weight, default from poll interval
+	Profile      string            `json:"profile,omitempty"`      // provisioning profile, default by driver and model
+	FaultPoll    Duration          `json:"fault_poll,omitempty"`   // device error register poll interval (vaisala), default 1m
+	Filtering    float64           `json:"filtering,omitempty"`    // the probe's own averaging factor, set on connect: 0.1 (heavy) to 1 (off) (vaisala)
+	Smoothing    Smoothing         `json:"smoothing,omitempty"`    // host-side smoothing, published as <metric>_smoothed beside the raw series
+	Flow         Flow              `json:"flow,omitempty"`         // the meter's flow unit and what to publish it in (kurz)
+	Array        Array             `json:"array,omitempty"`        // sensor points of a multipoint installation, each published as velocity_<n> (kurz)
+	Simulate     *Simulate         `json:"simulate,omitempty"`     // stand a simulated device in for the hardware
+}
+
+// Adaptive polling runs between MinInterval and MaxInterval: at the minimum
+// while the sensor's reading changes by Rate or more per second (in its
+// native unit, e.g. ppm/s), backing off towards the maximum while it is
+// stable. It is off while unset.
+type Adaptive struct {
+	MinInterval Duration `json:"min_interval,omitempty"`
+	MaxInterval Duration `json:"max_interval,omitempty"`
+	Rate        float64  `json:"rate,omitempty"`
+}
+
+func (a Adaptive) On() bool { return a != Adaptive{} }
+
+// Smoothing publishes a smoothed copy of each of a sensor's metrics:
+// "moving_average" or "median" over the last Window readings, or
+// "exponential" weighing each new reading by Alpha. It is off while Method is
+// empty.
+type Smoothing struct {
+	Method string  `json:"method,omitempty"`
+	Window int     `json:"window,omitempty"`
+	Alpha  float64 `json:"alpha,omitempty"`
+}
+
+// Flow converts a flow meter's readings from the unit the meter is set to,
+// Native (default SCFM), to Unit: SCFM, SLPM, ACFM, kg/h, or Nm3/h. Standard
+// volumes refer to Standard, by default the Kurz factory reference of 25 °C
+// and 101.325 kPa; ACFM needs Line, whose temperature the meter's own reading
+// replaces; kg/h uses MolarMass, by default dry air's.
+type Flow struct {
+	Native    string      `json:"native,omitempty"`
+	Unit      string      `json:"unit,omitempty"`
+	Standard  *Conditions `json:"standard,omitempty"`
+	Line      *Conditions `json:"line,omitempty"`
+	MolarMass float64     `json:"molar_mass,omitempty"` // g/mol
+}
+
+// Array reads a multipoint meter's Points sensor points on every poll. Their
+// velocities are averaged with Weights (equal when empty) into
+// velocity_average, and over the duct's FlowArea (ft², the meter's own
+// FLOW_AREA when 0) into flow_profile.
+type Array struct {
+	Points   int       `json:"points,omitempty"`
+	Weights  []float64 `json:"weights,omitempty"`
+	FlowArea float64   `json:"flow_area,omitempty"`
+}
+
+// Conditions are a gas's temperature and absolute pressure.
+type Conditions struct {
+	Temperature float64 `json:"temperature"` // °C
+	Pressure    float64 `json:"pressure"`    // kPa
+}
+
+// Gas returns what converting between f's units needs.
+func (f Flow) Gas() units.Gas {
+	g := units.Gas{MolarMass: f.MolarMass}
+	if f.Standard != nil {
+		g.Standard = units.Conditions(*f.Standard)
+	}
+	if f.Line != nil {
+		g.Line = units.Conditions(*f.Line)
+	}
+	return g
+}
+
+// Simulate replaces a sensor's hardware with a simulated device reporting
+// the same metrics in the same units. The sensor's metric follows the
+// embedded Signal, and other metrics of a multi-parameter device follow
+// Metrics; those left out are not reported. Faults run from when the device
+// first opens, again every Repeat if it is set.
+type Simulate struct {
+	Signal
+	Metrics map[string]Signal `json:"metrics,omitempty"`
+	Faults  []Fault           `json:"faults,omitempty"`
+	Repeat  Duration          `json:"repeat,omitempty"`
+	Seed    int64             `json:"seed,omitempty"` // repeatable noise; 0 for a different run every time
+}
+
+// Signal holds Value, or with Over ramps from Value to To and starts again,
+// adding Gaussian noise with standard deviation Noise. Values are in the
+// metric's native unit.
+type Signal struct {
+	Value float64  `json:"value"`
+	To    float64  `json:"to,omitempty"`
+	Over  Duration `json:"over,omitempty"`
+	Noise float64  `json:"noise,omitempty"`
+}
+
+// Fault is one step of a fault script: "dropout" (reads time out),
+// "garbage" (reads get unparseable frames), or "disconnect" (reads and
+// reopens fail), from At until For later.
+type Fault struct {
+	Kind string   `json:"kind"`
+	At   Duration `json:"at"`
+	For  Duration `json:"for"`
+}
+
+// SensorProfile is the settings every probe of one model should run. The
+// daemon applies it the first time it connects to each serial number; a sensor
+// can name its profile explicitly, otherwise Driver and Model are matched.
+type SensorProfile struct {
+	Name     string            `json:"name"`
+	Driver   string            `json:"driver"`
+	Model    string            `json:"model,omitempty"` // empty matches any model of the driver
+	Settings map[string]string `json:"settings"`        // device parameter -> value, driver specific
+}
+
+type WiFi struct {
+	SSID string `json:"ssid,omitempty"`
+	PSK  string `json:"psk,omitempty"`
+}
+
+type Export struct {
+	URL   string `json:"url,omitempty"`
+	Token string `json:"token,omitempty"`
+}
+
+// MQTT configures the MQTT exporter; an empty Broker disables it. Mobile adds
+// compact retained status, last-value, and alert topics for phone apps.
+type MQTT struct {
+	Broker      string `json:"broker,omitempty"` // e.g. tcp://broker.local:1883
+	ClientID    string `json:"client_id,omitempty"`
+	Username    string `json:"username,omitempty"`
+	Password    string `json:"password,omitempty"`
+	TopicPrefix string `json:"topic_prefix,omitempty"` // default "sensorctl"
+	Mobile      bool   `json:"mobile,omitempty"`
+}
+
+// Plugin runs an exporter kept outside this repository: Command, with its
+// arguments, is started with the daemon and fed everything recorded on its
+// stdin (see pkg/exporter). It is switched as module "exporter <name>".
+type Plugin struct {
+	Name    string   `json:"name"`
+	Command []string `json:"command"`
+}
+
+type LogSink struct {
+	Enabled bool   `json:"enabled"`
+	Level   string `json:"level"`
+}
+
+type LogFile struct {
+	LogSink
+	Path       string `json:"path"`
+	MaxSizeMB  int    `json:"max_size_mb"`
+	MaxBackups int    `json:"max_backups"`
+}
+
+// Logging configures each log destination independently; any combination
+// may be enabled at once, each with its own minimum level.
+type Logging struct {
+	Stderr   LogSink `json:"stderr"`
+	Journald LogSink `json:"journald"`
+	EventLog LogSink `json:"eventlog"` // Windows only
+	File     LogFile `json:"file"`
+}
+
+// LabelCondition compares the latest value of a metric, in its native unit
+// (ppm, SCFM, bpm), against a threshold. Op is one of >, >=, <, <=. Once met,
+// it stays met until the value moves back past the threshold by Hysteresis.
+type LabelCondition struct {
+	Metric     string  `json:"metric"`
+	Op         string  `json:"op"`
+	Value      float64 `json:"value"`
+	Hysteresis float64 `json:"hysteresis,omitempty"`
+}
+
+// LabelRule tags a time range with Name once every condition has held for at
+// least For.
+type LabelRule struct {
+	Name string           `json:"name"`
+	When []LabelCondition `json:"when"`
+	For  Duration         `json:"for,omitempty"`
+}
+
+// Sessions controls where the daemon records its reading stream. Each run
+// writes one file into Dir, sealed with a SHA-256 sidecar (and a signature
+// when SigningKey names an ed25519 PEM key) once it is closed.
+//
+// The filesystem holding Dir is watched: below WarnFreeMB, or when the
+// current write rate would fill it within the hour, the daemon raises an
+// alert, and below CriticalFreeMB the file gets only per-metric aggregates
+// over AggregateEvery instead of every reading.
+type Sessions struct {
+	Dir            string   `json:"dir,omitempty"` // empty writes to stdout only
+	SigningKey     string   `json:"signing_key,omitempty"`
+	EncryptionKey  string   `json:"encryption_key,omitempty"`   // "file:<path>", "env:<variable>", or "tpm:<handle>"; files are then written encrypted
+	WarnFreeMB     int      `json:"warn_free_mb,omitempty"`     // default 1024
+	CriticalFreeMB int      `json:"critical_free_mb,omitempty"` // default 200
+	DiskPoll       Duration `json:"disk_poll,omitempty"`        // default 30s
+	AggregateEvery Duration `json:"aggregate_every,omitempty"`  // default 1m
+}
+
+// Privacy keeps the study's subjects from being identified by anything the
+// daemon records or exports. When enabled, each session carries a pseudonym
+// for Subject instead, mapped back only in KeyMap, and device MAC addresses
+// are stripped.
+type Privacy struct {
+	Enabled bool     `json:"enabled,omitempty"`
+	KeyMap  string   `json:"key_map,omitempty"` // default /var/lib/sensorctl/pseudonyms.json
+	Rotate  Duration `json:"rotate,omitempty"`  // how long a subject keeps a pseudonym; 0 issues one per session
+}
+
+// Uncertainty sets the measurement uncertainty attached to each raw metric.
+// Specs override the built-in datasheet accuracies by metric name. With
+// Publish, every reading of a metric with a spec is followed by its 95%
+// confidence bounds, as <metric>_ci95_lower and <metric>_ci95_upper.
+type Uncertainty struct {
+	Publish bool                       `json:"publish,omitempty"`
+	Specs   map[string]UncertaintySpec `json:"specs,omitempty"`
+}
+
+// UncertaintySpec is a sensor's accuracy as datasheets give it, at one
+// standard deviation: Absolute in the metric's native unit plus Relative, a
+// fraction of the reading.
+type UncertaintySpec struct {
+	Absolute float64 `json:"absolute"`
+	Relative float64 `json:"relative"`
+}
+
+// Protocol runs the scripted protocol in File (see internal/protocol) with
+// every session, from its start: each stage's markers go into the session,
+// and the stage-by-stage result is written to Results as the session ends.
+// It is off while File is empty.
+type Protocol struct {
+	File    string `json:"file,omitempty"`
+	Results string `json:"results,omitempty"` // directory for result files, empty to write none
+}
+
+// Audio plays protocol stage cues and speaks alerts on the local speaker,
+// with aplay and espeak, for an operator running a test alone.
+type Audio struct {
+	Enabled bool `json:"enabled,omitempty"`
+	Alerts  bool `json:"alerts,omitempty"` // speak alerts as well as stage cues
+}
+
+// Time selects the clock a session is declared traceable to: "system",
+// "ntp", or "gps_pps". With Strict the daemon refuses to start unless that
+// source is synchronized; otherwise it records the shortfall and carries on.
+type Time struct {
+	Source string `json:"source"`
+	Strict bool   `json:"strict,omitempty"`
+}
+
+// Sync coordinates recording across rigs. A leader announces session start,
+// stop, and markers over UDP; followers act on them at the announced instant,
+// so every rig's clock should be synchronized (see Time).
+type Sync struct {
+	Role       string   `json:"role,omitempty"`        // "leader", "follower", or empty for standalone
+	Group      string   `json:"group,omitempty"`       // multicast group or follower listen address, default 239.255.42.1:8091
+	Followers  []string `json:"followers,omitempty"`   // extra unicast targets for networks without multicast
+	StartDelay Duration `json:"start_delay,omitempty"` // lead time on start, default 500ms
+}
+
+// Thermal sheds work the daemon can do without while the host runs hot, as a
+// sealed enclosure in the sun does. It is off while ThrottleC is 0.
+type Thermal struct {
+	ThrottleC    float64  `json:"throttle_c,omitempty"`
+	ResumeC      float64  `json:"resume_c,omitempty"`     // default 5 below throttle_c
+	Sensors      []string `json:"sensors,omitempty"`      // sysfs temperatures in millidegrees, globs allowed; default every thermal zone
+	Poll         Duration `json:"poll,omitempty"`         // default 10s
+	Nonessential []string `json:"nonessential,omitempty"` // modules paused while hot, e.g. "exporter mqtt"; default every derived channel and exporter
+}
+
+// Power watches the rig's supply and stops recording cleanly before the
+// battery runs out. It is off while Source is empty.
+type Power struct {
+	Source          string   `json:"source,omitempty"`           // "ina219" (I2C UPS HAT) or "nut"
+	I2CBus          int      `json:"i2c_bus,omitempty"`          // ina219, default 1
+	I2CAddress      int      `json:"i2c_address,omitempty"`      // ina219, default 0x42
+	EmptyVoltage    float64  `json:"empty_voltage,omitempty"`    // ina219 battery voltage at 0%, default 3.0
+	FullVoltage     float64  `json:"full_voltage,omitempty"`     // ina219 battery voltage at 100%, default 4.2
+	NUTAddr         string   `json:"nut_addr,omitempty"`         // upsd address, default localhost:3493
+	UPS             string   `json:"ups,omitempty"`              // UPS name on the NUT server, default "ups"
+	Poll            Duration `json:"poll,omitempty"`             // default 30s
+	LowBattery      float64  `json:"low_battery,omitempty"`      // percent at which to shut down, default 10
+	ShutdownCommand []string `json:"shutdown_command,omitempty"` // run after a low-battery stop, e.g. ["sudo", "poweroff"]
+}
+
+// DeadBandChannel publishes <metric>_filtered only when the metric has moved
+// by at least Band since the last published value.
+type DeadBandChannel struct {
+	Metric string  `json:"metric"`
+	Band   float64 `json:"band"`
+}
+
+// DerivativeChannel publishes <metric>_rate, the smoothed rate of change of a
+// metric in native units per Per (default per minute), estimated over Window
+// (default 10s).
+type DerivativeChannel struct {
+	Metric string   `json:"metric"`
+	Window Duration `json:"window,omitempty"`
+	Per    Duration `json:"per,omitempty"`
+}
+
+// IntegralChannel publishes <metric>_total (or Name), the running integral of
+// a metric since the session started. The rate's time base is Per (default
+// per minute, matching SCFM and SLPM); Unit overrides the inferred total
+// unit. Mode is "float" or "decimal" (exact to Places decimal places).
+type IntegralChannel struct {
+	Metric string   `json:"metric"`
+	Name   string   `json:"name,omitempty"`
+	Per    Duration `json:"per,omitempty"`
+	Unit   string   `json:"unit,omitempty"`
+	Mode   string   `json:"mode,omitempty"`
+	Places int      `json:"places,omitempty"`
+	MaxGap Duration `json:"max_gap,omitempty"` // intervals longer than this add nothing
+}
+
+type SpectralBand struct {
+	Name   string  `json:"name"`
+	LowHz  float64 `json:"low_hz"`
+	HighHz float64 `json:"high_hz"`
+}
+
+// SpectralChannel publishes rolling power-spectrum summaries of one metric.
+// Bands come from Preset ("hrv" or "breathing") and/or are listed explicitly.
+type SpectralChannel struct {
+	Metric string         `json:"metric"`
+	Preset string         `json:"preset,omitempty"`
+	Bands  []SpectralBand `json:"bands,omitempty"`
+	RateHz float64        `json:"rate_hz,omitempty"` // resampling rate, default 4
+	Window Duration       `json:"window"`
+	Every  Duration       `json:"every,omitempty"` // default 10s
+}
+
+type Config struct {
+	SiteID           string              `json:"site_id"`
+	Subject          string              `json:"subject,omitempty"` // who is being recorded, written with each session
+	Privacy          Privacy             `json:"privacy,omitempty"`
+	Units            string              `json:"units"`
+	MemoryBudget     string              `json:"memory_budget"`
+	APIAddr          string              `json:"api_addr"`  // empty disables the REST API
+	GRPCAddr         string              `json:"grpc_addr"` // empty disables the gRPC API
+	WiFi             WiFi                `json:"wifi"`
+	Export           Export              `json:"export"`
+	MQTT             MQTT                `json:"mqtt"`
+	Plugins          []Plugin            `json:"plugins,omitempty"`
+	Logging          Logging             `json:"logging"`
+	Sessions         Sessions            `json:"sessions"`
+	Uncertainty      Uncertainty         `json:"uncertainty,omitempty"`
+	Protocol         Protocol            `json:"protocol,omitempty"`
+	Audio            Audio               `json:"audio,omitempty"`
+	Time             Time                `json:"time"`
+	Sync             Sync                `json:"sync"`
+	Power            Power               `json:"power"`
+	Thermal          Thermal             `json:"thermal"`
+	Sensors          []Sensor            `json:"sensors"`
+	Labels           []LabelRule         `json:"labels,omitempty"`
+	Spectral         []SpectralChannel   `json:"spectral,omitempty"`
+	Derivatives      []DerivativeChannel `json:"derivatives,omitempty"`
+	Integrals        []IntegralChannel   `json:"integrals,omitempty"`
+	DeadBands        []DeadBandChannel   `json:"dead_bands,omitempty"`
+	Profiles         []SensorProfile     `json:"profiles,omitempty"`
+	ProfileState     string              `json:"profile_state,omitempty"`     // serial numbers already provisioned
+	ModuleState      string              `json:"module_state,omitempty"`      // modules switched off through the API
+	IdentityState    string              `json:"identity_state,omitempty"`    // the serial number each sensor is bound to
+	CalibrationState string              `json:"calibration_state,omitempty"` // the slope and offset each sensor's readings are corrected with
+	EventLog         string              `json:"event_log,omitempty"`         // alerts and annotations for the events API, empty to keep none
+	SessionHistory   string              `json:"session_history,omitempty"`   // per-metric statistics of each finished session, for trends; empty to keep none
+}
+
+// Load reads the embedded defaults and, if path is non-empty, overlays the
+// file at path (JSON, or YAML or TOML by extension) on top of them. Sensors
+// listed in the file replace the default sensor list entirely. SENSORCTL_*
+// environment variables then override single settings, and the result is
+// validated.
+func Load(path string) (*Config, error) {
+	var cfg Config
+	if err := json.Unmarshal(defaultConfig, &cfg); err != nil {
+		return nil, fmt.Errorf("embedded default config is invalid: %v", err)
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config: %w", err)
+		}
+		if data, err = toJSON(formatOf(path), data); err != nil {
+			return nil, fmt.Errorf("failed to parse config %s: %v", path, err)
+		}
+		var listed struct {
+			Sensors json.RawMessage `json:"sensors"`
+		}
+		if json.Unmarshal(data, &listed) == nil && listed.Sensors != nil {
+			cfg.Sensors = nil // otherwise each entry is decoded over the default at its index
+		}
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse config %s: %v", path, err)
+		}
+	}
+	if err := applyEnv(&cfg, os.Environ()); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		if path == "" {
+			return nil, err
+		}
+		return nil, fmt.Errorf("config %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// Validate reports the first setting that cannot work, naming it as it
+// appears in the file.
+func (c *Config) Validate() error {
+	if _, err := units.ParseSystem(c.Units); err != nil {
+		return fmt.Errorf("units: %v", err)
+	}
+	switch c.Sync.Role {
+	case "", "leader", "follower":
+	default:
+		return fmt.Errorf("sync.role: must be \"leader\" or \"follower\", not %q", c.Sync.Role)
+	}
+	switch p := c.Power; {
+	case p.Source != "" && p.Source != "ina219" && p.Source != "nut":
+		return fmt.Errorf("power.source: must be \"ina219\" or \"nut\", not %q", p.Source)
+	case p.Poll < 0:
+		return fmt.Errorf("power.poll: must be positive")
+	case p.LowBattery < 0 || p.LowBattery >= 100:
+		return fmt.Errorf("power.low_battery: must be a percentage below 100")
+	case p.EmptyVoltage != 0 && p.FullVoltage != 0 && p.EmptyVoltage >= p.FullVoltage:
+		return fmt.Errorf("power: empty_voltage must be below full_voltage")
+	}
+	switch t := c.Thermal; {
+	case t.ThrottleC < 0, t.ResumeC < 0, t.Poll < 0:
+		return fmt.Errorf("thermal: temperatures and poll must be positive")
+	case t.ResumeC != 0 && t.ResumeC >= t.ThrottleC:
+		return fmt.Errorf("thermal: resume_c must be below throttle_c")
+	}
+	for _, m := range c.Thermal.Nonessential {
+		if !strings.HasPrefix(m, "derived ") && !strings.HasPrefix(m, "exporter ") {
+			return fmt.Errorf("thermal.nonessential: %q is not a derived channel or exporter (\"derived <name>\", \"exporter mqtt\")", m)
+		}
+	}
+	switch ss := c.Sessions; {
+	case ss.WarnFreeMB < 0, ss.CriticalFreeMB < 0, ss.DiskPoll < 0, ss.AggregateEvery < 0:
+		return fmt.Errorf("sessions: disk thresholds and intervals must be positive")
+	case ss.WarnFreeMB != 0 && ss.CriticalFreeMB != 0 && ss.CriticalFreeMB >= ss.WarnFreeMB:
+		return fmt.Errorf("sessions: critical_free_mb must be below warn_free_mb")
+	}
+	for metric, spec := range c.Uncertainty.Specs {
+		if spec.Absolute < 0 || spec.Relative < 0 {
+			return fmt.Errorf("uncertainty: %s: absolute and relative must not be negative", metric)
+		}
+	}
+	if c.Privacy.Rotate < 0 {
+		return fmt.Errorf("privacy: rotate must be positive")
+	}
+	if k := c.Sessions.EncryptionKey; k != "" {
+		kind, arg, _ := strings.Cut(k, ":")
+		if (kind != "file" && kind != "env" && kind != "tpm") || arg == "" {
+			return fmt.Errorf("sessions: encryption_key must be file:<path>, env:<variable>, or tpm:<handle>, not %q", k)
+		}
+	}
+	plugins := map[string]bool{"mqtt": true}
+	for i, p := range c.Plugins {
+		switch {
+		case p.Name == "":
+			return fmt.Errorf("plugins[%d]: name is required", i)
+		case plugins[p.Name]:
+			return fmt.Errorf("plugin %s: name is already used by another exporter", p.Name)
+		case len(p.Command) == 0 || p.Command[0] == "":
+			return fmt.Errorf("plugin %s: command is required", p.Name)
+		}
+		plugins[p.Name] = true
+	}
+	names := map[string]bool{}
+	probes := map[string]Sensor{} // vaisala probes by line and address
+	lines := map[string]int{}     // vaisala probes per line
+	for _, s := range c.Sensors {
+		if s.Driver == "vaisala" {
+			lines[vaisalaLine(s)]++
+		}
+	}
+	for i, s := range c.Sensors {
+		switch {
+		case s.Name == "":
+			return fmt.Errorf("sensors[%d]: name is required", i)
+		case names[s.Name]:
+			return fmt.Errorf("sensors[%d]: name %q is used twice", i, s.Name)
+		case s.Driver == "":
+			return fmt.Errorf("sensor %s: driver is required", s.Name)
+		case s.BaudRate < 0:
+			return fmt.Errorf("sensor %s: baud_rate must be positive", s.Name)
+		case s.ReadRetries < -1:
+			return fmt.Errorf("sensor %s: read_retries must be -1 or more", s.Name)
+		case s.PollInterval < 0, s.ReadTimeout < 0, s.FaultPoll < 0:
+			return fmt.Errorf("sensor %s: durations must be positive", s.Name)
+		case s.Port != "" && s.PortMatch != "":
+			return fmt.Errorf("sensor %s: port and port_match are exclusive", s.Name)
+		case s.Protocol != "" && s.Protocol != "ascii" && s.Protocol != "modbus":
+			return fmt.Errorf("sensor %s: protocol must be \"ascii\" or \"modbus\", not %q", s.Name, s.Protocol)
+		case s.Stream && s.Protocol == "modbus":
+			return fmt.Errorf("sensor %s: stream needs the ascii protocol", s.Name)
+		case s.Adaptive.On() && (s.Adaptive.MinInterval <= 0 || s.Adaptive.MaxInterval < s.Adaptive.MinInterval):
+			return fmt.Errorf("sensor %s: adaptive: need 0 < min_interval <= max_interval", s.Name)
+		case s.Adaptive.On() && s.Adaptive.Rate <= 0:
+			return fmt.Errorf("sensor %s: adaptive: rate must be positive", s.Name)
+		case s.Adaptive.On() && s.Stream:
+			return fmt.Errorf("sensor %s: adaptive polling and stream are exclusive, a streaming probe sets its own pace", s.Name)
+		case s.Filtering != 0 && s.Driver != "vaisala":
+			return fmt.Errorf("sensor %s: filtering is only supported by vaisala", s.Name)
+		case s.Filtering != 0 && (s.Filtering < 0.1 || s.Filtering > 1):
+			return fmt.Errorf("sensor %s: filtering must be between 0.1 and 1", s.Name)
+		case s.Filtering != 0 && s.Protocol == "modbus":
+			return fmt.Errorf("sensor %s: filtering needs the ascii protocol", s.Name)
+		case s.Flow != (Flow{}) && s.Driver != "kurz":
+			return fmt.Errorf("sensor %s: flow is only supported by kurz", s.Name)
+		case s.Flow.MolarMass < 0:
+			return fmt.Errorf("sensor %s: flow: molar_mass must be positive", s.Name)
+		case s.Array.Points != 0 && s.Driver != "kurz":
+			return fmt.Errorf("sensor %s: array is only supported by kurz", s.Name)
+		case s.Array.Points != 0 && s.Protocol == "modbus":
+			return fmt.Errorf("sensor %s: array needs the ascii protocol", s.Name)
+		case s.Array.Points < 0 || s.Array.Points > 32:
+			return fmt.Errorf("sensor %s: array: points must be between 1 and 32", s.Name)
+		case len(s.Array.Weights) != 0 && len(s.Array.Weights) != s.Array.Points:
+			return fmt.Errorf("sensor %s: array: %d weights for %d points", s.Name, len(s.Array.Weights), s.Array.Points)
+		case s.Array.FlowArea < 0:
+			return fmt.Errorf("sensor %s: array: flow_area must be positive", s.Name)
+		}
+		if sim := s.Simulate; sim != nil {
+			signals := []Signal{sim.Signal}
+			for _, sg := range sim.Metrics {
+				signals = append(signals, sg)
+			}
+			for _, sg := range signals {
+				if sg.Over < 0 || sg.Noise < 0 {
+					return fmt.Errorf("sensor %s: simulate: over and noise must be positive", s.Name)
+				}
+			}
+			if sim.Repeat < 0 {
+				return fmt.Errorf("sensor %s: simulate: repeat must be positive", s.Name)
+			}
+			for i, f := range sim.Faults {
+				if _, err := simulate.ParseFaultKind(f.Kind); err != nil {
+					return fmt.Errorf("sensor %s: simulate: faults[%d]: %v", s.Name, i, err)
+				}
+				if f.At < 0 || f.For <= 0 {
+					return fmt.Errorf("sensor %s: simulate: faults[%d]: need at >= 0 and for > 0", s.Name, i)
+				}
+			}
+		}
+		if s.Flow != (Flow{}) {
+			native, unit := units.Unit(s.Flow.Native), units.Unit(s.Flow.Unit)
+			if native == "" {
+				native = units.SCFM
+			}
+			if unit == "" {
+				unit = native
+			}
+			if !units.IsFlow(native) {
+				return fmt.Errorf("sensor %s: flow: native unit %q is not one the meter reports (want SCFM, SLPM, ACFM, kg/h, or Nm3/h)", s.Name, native)
+			}
+			if _, err := units.FlowFactor(native, unit, s.Flow.Gas()); err != nil {
+				return fmt.Errorf("sensor %s: flow: %v", s.Name, err)
+			}
+		}
+		if s.PortMatch != "" {
+			if _, err := regexp.Compile(s.PortMatch); err != nil {
+				return fmt.Errorf("sensor %s: port_match: %v", s.Name, err)
+			}
+		}
+		switch sm := s.Smoothing; sm.Method {
+		case "":
+		case "moving_average", "median":
+			if sm.Window < 1 {
+				return fmt.Errorf("sensor %s: smoothing: %s needs a window of at least 1", s.Name, sm.Method)
+			}
+		case "exponential":
+			if sm.Alpha <= 0 || sm.Alpha > 1 {
+				return fmt.Errorf("sensor %s: smoothing: exponential needs 0 < alpha <= 1", s.Name)
+			}
+		default:
+			return fmt.Errorf("sensor %s: smoothing: unknown method %q (want moving_average, median, or exponential)", s.Name, sm.Method)
+		}
+		for kind, metric := range s.Compensate {
+			switch {
+			case s.Driver != "vaisala":
+				return fmt.Errorf("sensor %s: compensate is only supported by vaisala", s.Name)
+			case kind != "pressure" && kind != "temperature" && kind != "humidity" && kind != "oxygen":
+				return fmt.Errorf("sensor %s: compensate: unknown compensation %q (want pressure, temperature, humidity, or oxygen)", s.Name, kind)
+			case kind != "pressure" && s.Protocol == "modbus":
+				return fmt.Errorf("sensor %s: compensate: %s needs the ascii protocol", s.Name, kind)
+			case metric == "":
+				return fmt.Errorf("sensor %s: compensate: %s needs a metric", s.Name, kind)
+			}
+		}
+		if s.Driver == "vaisala" {
+			line := vaisalaLine(s)
+			address := s.Address
+			if address == 0 {
+				address = 240
+			}
+			key := fmt.Sprintf("%s@%d", line, address)
+			if other, ok := probes[key]; ok {
+				return fmt.Errorf("sensor %s: address %d is already used by sensor %s on the same line", s.Name, address, other.Name)
+			}
+			probes[key] = s
+			if s.Stream && lines[line] > 1 {
+				return fmt.Errorf("sensor %s: stream needs the line to itself, %d vaisala probes share it", s.Name, lines[line])
+			}
+		}
+		names[s.Name] = true
+	}
+	return nil
+}
+
+// vaisalaLine names the RS-485 line a vaisala probe is on: probes with the
+// same port, or found by discovery with the same port_match, share one.
+func vaisalaLine(s Sensor) string {
+	if s.Port != "" {
+		return "port " + s.Port
+	}
+	return "port_match " + s.PortMatch
+}
+
+// Sensor returns the first sensor entry using driver, or a bare entry for it
+// if the config has none.
+func (c *Config) Sensor(driver string) Sensor {
+	for _, s := range c.Sensors {
+		if s.Driver == driver {
+			return s
+		}
+	}
+	return Sensor{Name: driver, Driver: driver, Enabled: true}
+}
+
+// Redacted returns a copy of c safe to share, e.g. in a bug report, with
+// passwords, keys, and tokens, including any in URLs, replaced, and the
+// subject too. In privacy mode device MAC addresses go as well.
+func (c *Config) Redacted() *Config {
+	out := *c
+	out.Sensors = append([]Sensor(nil), c.Sensors...)
+	redact := func(s *string) {
+		if *s != "" {
+			*s = "REDACTED"
+		}
+	}
+	redact(&out.WiFi.PSK)
+	redact(&out.Export.Token)
+	redact(&out.MQTT.Password)
+	redact(&out.Subject)
+	if c.Privacy.Enabled {
+		for i := range out.Sensors {
+			redact(&out.Sensors[i].MAC)
+		}
+	}
+	out.Export.URL = redactURL(out.Export.URL)
+	out.MQTT.Broker = redactURL(out.MQTT.Broker)
+	return &out
+}
+
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "REDACTED")
+	}
+	return u.String()
+}
+
+// Save writes cfg to path atomically (write to a temp file, then rename) so a
+// power cut during provisioning can't leave a truncated config behind. The
+// format follows the extension, as for Load.
+func Save(path string, cfg *Config) error {
+	data, err := encode(formatOf(path), cfg)
+	if err != nil {
+		return fmt.Errorf("failed to encode config: %v", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var envPrefix string
+
+func init() {
+	envPrefix = "SENSORCTL_"
+}
+
+// applyEnv overrides settings from the environment, so a container or a
+// systemd drop-in can change one value without editing the file. A setting's
+// variable is SENSORCTL_ followed by its path in upper case, e.g.
+// SENSORCTL_SITE_ID, SENSORCTL_MQTT_BROKER, SENSORCTL_LOGGING_STDERR_LEVEL.
+// Sensors are addressed by name: SENSORCTL_SENSORS_CO2_POLL_INTERVAL=2s.
+// Variables that match no setting are left alone; other parts of sensorctl
+// read some of their own.
+func applyEnv(cfg *Config, environ []string) error {
+	fields := map[string]reflect.Value{}
+	collectEnv(fields, envPrefix, reflect.ValueOf(cfg).Elem())
+	for i := range cfg.Sensors {
+		name := strings.ToUpper(strings.NewReplacer("-", "_", " ", "_").Replace(cfg.Sensors[i].Name))
+		collectEnv(fields, envPrefix+"SENSORS_"+name+"_", reflect.ValueOf(&cfg.Sensors[i]).Elem())
+	}
+
+	sort.Strings(environ) // apply in a fixed order
+	for _, kv := range environ {
+		key, value, _ := strings.Cut(kv, "=")
+		field, ok := fields[key]
+		if !ok {
+			continue
+		}
+		literal := []byte(value)
+		if field.Kind() == reflect.String || field.Type() == reflect.TypeOf(Duration(0)) {
+			literal, _ = json.Marshal(value)
+		}
+		if err := json.Unmarshal(literal, field.Addr().Interface()); err != nil {
+			return fmt.Errorf("failed to parse %s=%q: %v", key, value, err)
+		}
+	}
+	return nil
+}
+
+// collectEnv maps the variable name of every plain setting under v, a
+// struct, to the field it sets. Lists other than sensors are not covered.
+func collectEnv(fields map[string]reflect.Value, prefix string, v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous { // e.g. LogFile embeds LogSink
+			collectEnv(fields, prefix, v.Field(i))
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		key := prefix + strings.ToUpper(name)
+		switch f.Type.Kind() {
+		case reflect.Struct:
+			collectEnv(fields, key+"_", v.Field(i))
+		case reflect.String, reflect.Bool, reflect.Int, reflect.Int64, reflect.Float64:
+			fields[key] = v.Field(i)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Config files may be JSON, YAML, or TOML, chosen by extension. All three
+// use the JSON field names (baud_rate, poll_interval, ...) and the same
+// duration strings; YAML and TOML are converted to JSON and decoded with the
+// JSON rules, so every format behaves identically.
+type format int
+
+const (
+	formatJSON format = iota
+	formatYAML
+	formatTOML
+)
+
+func formatOf(path string) format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return formatYAML
+	case ".toml":
+		return formatTOML
+	}
+	return formatJSON
+}
+
+// toJSON converts a YAML or TOML document to JSON.
+func toJSON(f format, data []byte) ([]byte, error) {
+	var doc map[string]any
+	switch f {
+	case formatYAML:
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+	case formatTOML:
+		if err := toml.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+	default:
+		return data, nil
+	}
+	if doc == nil { // an empty file overrides nothing
+		return []byte("{}"), nil
+	}
+	return json.Marshal(doc)
+}
+
+// encode writes cfg in format f.
+func encode(f format, cfg *Config) ([]byte, error) {
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil || f == formatJSON {
+		return data, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber() // so baud_rate stays 19200, not 19200.0
+	var doc map[string]any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	switch f {
+	case formatYAML:
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		err = enc.Encode(plainNumbers(doc))
+	case formatTOML:
+		err = toml.NewEncoder(&buf).Encode(plainNumbers(doc))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+// plainNumbers replaces json.Number with int64 or float64, which the YAML and
+// TOML encoders write as numbers.
+func plainNumbers(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			v[k] = plainNumbers(e)
+		}
+	case []any:
+		for i, e := range v {
+			v[i] = plainNumbers(e)
+		}
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return v
+}
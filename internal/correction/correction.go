@@ -0,0 +1,251 @@
+// Package correction keeps the calibration each sensor's readings are
+// corrected with, a slope and offset per metric, so a sensor found to read
+// off at its last calibration can be put right on the host without touching
+// the device, and recorded sessions can be corrected again after a later
+// calibration from the raw values kept beside the corrected ones. A
+// calibration against several reference points is fitted as a curve instead
+// (see FitCurve) and kept under the probe's serial number, so it follows the
+// probe from one rig position to another.
+package correction
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/demelere/sensor-control-modules/internal/units"
+)
+
+// Correction maps a raw reading v to Slope*v + Offset, or to Curve(v) when
+// there is a curve. Unit is the unit Offset or the curve is in; a reading in
+// another unit of the same dimension is converted to it and back. Empty means
+// the reading's own unit.
+type Correction struct {
+	Slope  float64   `json:"slope,omitempty"`
+	Offset float64   `json:"offset"`
+	Curve  *Curve    `json:"curve,omitempty"`
+	Unit   string    `json:"unit,omitempty"`
+	Since  time.Time `json:"since"`
+	Note   string    `json:"note,omitempty"` // e.g. the reference gas or certificate it came from
+}
+
+func (c Correction) Validate() error {
+	if c.Curve != nil {
+		return c.Curve.validate()
+	}
+	if c.Slope <= 0 || math.IsInf(c.Slope, 0) || math.IsNaN(c.Slope) {
+		return fmt.Errorf("slope %g must be positive", c.Slope)
+	}
+	if math.IsInf(c.Offset, 0) || math.IsNaN(c.Offset) {
+		return fmt.Errorf("offset %g is not a number", c.Offset)
+	}
+	return nil
+}
+
+// Apply corrects v, read in unit.
+func (c Correction) Apply(v float64, unit string) (float64, error) {
+	if c.Unit == "" || c.Unit == unit {
+		return c.eval(v), nil
+	}
+	in, err := units.Convert(v, units.Unit(unit), units.Unit(c.Unit))
+	if err != nil {
+		return 0, err
+	}
+	return units.Convert(c.eval(in), units.Unit(c.Unit), units.Unit(unit))
+}
+
+func (c Correction) eval(v float64) float64 {
+	if c.Curve != nil {
+		return c.Curve.Eval(v)
+	}
+	return c.Slope*v + c.Offset
+}
+
+// Entry is one correction, as listed: a sensor's, or a probe's by its
+// serial number.
+type Entry struct {
+	Sensor       string `json:"sensor,omitempty"`
+	SerialNumber string `json:"serial_number,omitempty"`
+	Metric       string `json:"metric"`
+	Correction
+}
+
+// Set holds every correction in force. With a path, every change is saved so
+// it survives a restart.
+type Set struct {
+	path   string
+	lock   sync.RWMutex
+	set    map[string]map[string]Correction // sensor -> metric -> correction
+	probes map[string]map[string]Correction // serial number -> metric -> correction
+}
+
+type savedSet struct {
+	Sensors map[string]map[string]Correction `json:"sensors"`
+	Probes  map[string]map[string]Correction `json:"probes,omitempty"`
+}
+
+// Open loads the set saved at path. An empty path keeps it in memory only,
+// and a missing file is an empty set.
+func Open(path string) (*Set, error) {
+	s := &Set{path: path, set: map[string]map[string]Correction{}, probes: map[string]map[string]Correction{}}
+	if path == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read calibration state: %w", err)
+	}
+	var saved savedSet
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("failed to parse calibration state %s: %v", path, err)
+	}
+	for sensor, metrics := range saved.Sensors {
+		for metric, c := range metrics {
+			if err := c.Validate(); err != nil {
+				return nil, fmt.Errorf("calibration state %s: %s %s: %v", path, sensor, metric, err)
+			}
+		}
+		s.set[sensor] = metrics
+	}
+	for serial, metrics := range saved.Probes {
+		for metric, c := range metrics {
+			if err := c.Validate(); err != nil {
+				return nil, fmt.Errorf("calibration state %s: probe %s %s: %v", path, serial, metric, err)
+			}
+		}
+		s.probes[serial] = metrics
+	}
+	return s, nil
+}
+
+// Get returns the correction for a sensor's metric. It is cheap enough to
+// call for every sample.
+func (s *Set) Get(sensor, metric string) (Correction, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	c, ok := s.set[sensor][metric]
+	return c, ok
+}
+
+// Put sets the correction for a sensor's metric and saves the set. The
+// correction stands in memory even if saving fails.
+func (s *Set) Put(sensor, metric string, c Correction) error {
+	return s.put(s.set, sensor, metric, c)
+}
+
+// Delete removes the correction for a sensor's metric, reporting whether
+// there was one, and saves the set.
+func (s *Set) Delete(sensor, metric string) (bool, error) {
+	return s.delete(s.set, sensor, metric)
+}
+
+// GetProbe returns the correction for a metric of the probe with a serial
+// number, wherever it is connected. It takes precedence over the sensor's.
+func (s *Set) GetProbe(serial, metric string) (Correction, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	c, ok := s.probes[serial][metric]
+	return c, ok
+}
+
+// HasProbes reports whether any probe has a correction, so callers can skip
+// finding out which probe a reading came from.
+func (s *Set) HasProbes() bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return len(s.probes) > 0
+}
+
+func (s *Set) PutProbe(serial, metric string, c Correction) error {
+	return s.put(s.probes, serial, metric, c)
+}
+
+func (s *Set) DeleteProbe(serial, metric string) (bool, error) {
+	return s.delete(s.probes, serial, metric)
+}
+
+func (s *Set) put(in map[string]map[string]Correction, key, metric string, c Correction) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if in[key] == nil {
+		in[key] = map[string]Correction{}
+	}
+	in[key][metric] = c
+	return s.saveLocked()
+}
+
+func (s *Set) delete(in map[string]map[string]Correction, key, metric string) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := in[key][metric]; !ok {
+		return false, nil
+	}
+	delete(in[key], metric)
+	if len(in[key]) == 0 {
+		delete(in, key)
+	}
+	return true, s.saveLocked()
+}
+
+// All lists the sensors' corrections by sensor and metric, then the probes'
+// by serial number and metric.
+func (s *Set) All() []Entry {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	var out []Entry
+	for sensor, metrics := range s.set {
+		for metric, c := range metrics {
+			out = append(out, Entry{Sensor: sensor, Metric: metric, Correction: c})
+		}
+	}
+	for serial, metrics := range s.probes {
+		for metric, c := range metrics {
+			out = append(out, Entry{SerialNumber: serial, Metric: metric, Correction: c})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if (out[i].Sensor == "") != (out[j].Sensor == "") {
+			return out[j].Sensor == "" // sensors before probes
+		}
+		if out[i].Sensor != out[j].Sensor {
+			return out[i].Sensor < out[j].Sensor
+		}
+		if out[i].SerialNumber != out[j].SerialNumber {
+			return out[i].SerialNumber < out[j].SerialNumber
+		}
+		return out[i].Metric < out[j].Metric
+	})
+	return out
+}
+
+func (s *Set) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(savedSet{s.set, s.probes}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode calibration state: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("failed to write calibration state: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write calibration state: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to write calibration state: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,305 @@
+package correction
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// ErrPoorFit is returned with a Fit whose curve does not pass through the
+// calibration points closely enough, or does not rise with the reading.
+var ErrPoorFit = errors.New("calibration fit rejected")
+
+// Point is one calibration point: what the sensor read against a reference,
+// e.g. a certified gas.
+type Point struct {
+	Reading   float64 `json:"reading"`
+	Reference float64 `json:"reference"`
+}
+
+// Curve maps a reading to a corrected value. A polynomial is fitted by least
+// squares in (v-Center)/Scale, which keeps high degrees well conditioned,
+// with Coefficients from the constant up. A spline is the natural cubic
+// spline through Knots, continued as a straight line beyond them.
+type Curve struct {
+	Method       string    `json:"method"` // "polynomial" or "spline"
+	Center       float64   `json:"center,omitempty"`
+	Scale        float64   `json:"scale,omitempty"`
+	Coefficients []float64 `json:"coefficients,omitempty"`
+	Knots        []Point   `json:"knots,omitempty"`
+}
+
+func (c Curve) validate() error {
+	switch c.Method {
+	case "polynomial":
+		if len(c.Coefficients) == 0 || c.Scale <= 0 {
+			return fmt.Errorf("polynomial needs coefficients and a positive scale")
+		}
+	case "spline":
+		if len(c.Knots) < 2 {
+			return fmt.Errorf("spline needs at least 2 knots")
+		}
+		for i := 1; i < len(c.Knots); i++ {
+			if c.Knots[i].Reading <= c.Knots[i-1].Reading {
+				return fmt.Errorf("spline knots must rise with the reading")
+			}
+		}
+	default:
+		return fmt.Errorf("unknown curve %q", c.Method)
+	}
+	return nil
+}
+
+func (c Curve) Eval(v float64) float64 {
+	if c.Method == "spline" {
+		return evalSpline(c.Knots, v)
+	}
+	t := (v - c.Center) / c.Scale
+	out := 0.0
+	for i := len(c.Coefficients) - 1; i >= 0; i-- {
+		out = out*t + c.Coefficients[i]
+	}
+	return out
+}
+
+// FitOptions chooses the curve. Degree is the polynomial's, default 1.
+// Tolerance is the largest residual accepted, in the reference's unit; 0
+// accepts up to 1% of the span of the references.
+type FitOptions struct {
+	Method    string  `json:"method"` // "polynomial" (default) or "spline"
+	Degree    int     `json:"degree,omitempty"`
+	Tolerance float64 `json:"tolerance,omitempty"`
+}
+
+// Fit is a fitted curve and how well it matches its points. A residual is
+// the curve's value at a point's reading less its reference. A spline passes
+// through every point, so its residuals are leave-one-out: each point
+// against the spline through the others.
+type Fit struct {
+	Curve       Curve     `json:"curve"`
+	Points      []Point   `json:"points"`
+	Residuals   []float64 `json:"residuals"`
+	RMSE        float64   `json:"rmse"`
+	MaxResidual float64   `json:"max_residual"`
+	Tolerance   float64   `json:"tolerance"`
+	Exact       bool      `json:"exact,omitempty"` // as many coefficients as points, so the residuals prove nothing
+	Rejected    string    `json:"rejected,omitempty"`
+}
+
+// FitCurve fits a curve through points. It returns ErrPoorFit, with the
+// fit, when the residuals exceed the tolerance or the curve falls or levels
+// off anywhere across the calibrated range, which would map two readings to
+// one value.
+func FitCurve(points []Point, opts FitOptions) (Fit, error) {
+	if opts.Method == "" {
+		opts.Method = "polynomial"
+	}
+	if opts.Degree == 0 {
+		opts.Degree = 1
+	}
+	pts := append([]Point(nil), points...)
+	sort.Slice(pts, func(i, j int) bool { return pts[i].Reading < pts[j].Reading })
+	for i, p := range pts {
+		if math.IsNaN(p.Reading) || math.IsInf(p.Reading, 0) || math.IsNaN(p.Reference) || math.IsInf(p.Reference, 0) {
+			return Fit{}, fmt.Errorf("calibration point %d is not a number", i+1)
+		}
+		if i > 0 && p.Reading == pts[i-1].Reading {
+			return Fit{}, fmt.Errorf("two calibration points read %g", p.Reading)
+		}
+	}
+
+	fit := Fit{Points: pts, Residuals: make([]float64, len(pts)), Tolerance: opts.Tolerance}
+	switch opts.Method {
+	case "polynomial":
+		if opts.Degree < 1 || opts.Degree > 5 {
+			return Fit{}, fmt.Errorf("degree %d out of range 1-5", opts.Degree)
+		}
+		if len(pts) < opts.Degree+1 {
+			return Fit{}, fmt.Errorf("a degree %d polynomial needs at least %d points, not %d", opts.Degree, opts.Degree+1, len(pts))
+		}
+		c, err := fitPolynomial(pts, opts.Degree)
+		if err != nil {
+			return Fit{}, err
+		}
+		fit.Curve = c
+		fit.Exact = len(pts) == opts.Degree+1
+		for i, p := range pts {
+			fit.Residuals[i] = c.Eval(p.Reading) - p.Reference
+		}
+	case "spline":
+		if len(pts) < 3 {
+			return Fit{}, fmt.Errorf("a spline needs at least 3 points, not %d", len(pts))
+		}
+		fit.Curve = Curve{Method: "spline", Knots: pts}
+		for i, p := range pts {
+			others := append(append([]Point(nil), pts[:i]...), pts[i+1:]...)
+			fit.Residuals[i] = evalSpline(others, p.Reading) - p.Reference
+		}
+	default:
+		return Fit{}, fmt.Errorf("unknown fit method %q (want polynomial or spline)", opts.Method)
+	}
+	if !rises(pts) {
+		return Fit{}, fmt.Errorf("every calibration point has the reference %g; a curve needs at least two different references", pts[0].Reference)
+	}
+
+	lo, hi := pts[0].Reference, pts[0].Reference
+	for i, r := range fit.Residuals {
+		fit.RMSE += r * r
+		fit.MaxResidual = math.Max(fit.MaxResidual, math.Abs(r))
+		lo, hi = math.Min(lo, pts[i].Reference), math.Max(hi, pts[i].Reference)
+	}
+	fit.RMSE = math.Sqrt(fit.RMSE / float64(len(pts)))
+	if fit.Tolerance == 0 {
+		fit.Tolerance = 0.01 * (hi - lo)
+	}
+
+	if fit.MaxResidual > fit.Tolerance {
+		fit.Rejected = fmt.Sprintf("largest residual %.4g exceeds the tolerance %.4g", fit.MaxResidual, fit.Tolerance)
+	} else if at, ok := falls(fit.Curve, pts[0].Reading, pts[len(pts)-1].Reading); ok {
+		fit.Rejected = fmt.Sprintf("curve does not rise near reading %.4g", at)
+	}
+	if fit.Rejected != "" {
+		return fit, fmt.Errorf("%w: %s", ErrPoorFit, fit.Rejected)
+	}
+	return fit, nil
+}
+
+// rises reports whether pts have at least two different references. Without
+// them every curve is flat, and the default tolerance would be 0.
+func rises(pts []Point) bool {
+	for _, p := range pts[1:] {
+		if p.Reference != pts[0].Reference {
+			return true
+		}
+	}
+	return false
+}
+
+// falls reports where, if anywhere, c falls or stays level between lo and
+// hi.
+func falls(c Curve, lo, hi float64) (float64, bool) {
+	const steps = 200
+	prev := c.Eval(lo)
+	for i := 1; i <= steps; i++ {
+		v := lo + (hi-lo)*float64(i)/steps
+		y := c.Eval(v)
+		if y <= prev {
+			return v, true
+		}
+		prev = y
+	}
+	return 0, false
+}
+
+// fitPolynomial solves the least-squares normal equations by Gaussian
+// elimination with partial pivoting, in scaled readings.
+func fitPolynomial(pts []Point, degree int) (Curve, error) {
+	lo, hi := pts[0].Reading, pts[len(pts)-1].Reading
+	c := Curve{Method: "polynomial", Center: (lo + hi) / 2, Scale: (hi - lo) / 2}
+	if c.Scale == 0 {
+		c.Scale = 1
+	}
+	n := degree + 1
+	a := make([][]float64, n)
+	for i := range a {
+		a[i] = make([]float64, n+1)
+	}
+	for _, p := range pts {
+		t := (p.Reading - c.Center) / c.Scale
+		pow := make([]float64, 2*n)
+		pow[0] = 1
+		for k := 1; k < len(pow); k++ {
+			pow[k] = pow[k-1] * t
+		}
+		for i := 0; i < n; i++ {
+			for j := 0; j < n; j++ {
+				a[i][j] += pow[i+j]
+			}
+			a[i][n] += pow[i] * p.Reference
+		}
+	}
+	for col := 0; col < n; col++ {
+		pivot := col
+		for r := col + 1; r < n; r++ {
+			if math.Abs(a[r][col]) > math.Abs(a[pivot][col]) {
+				pivot = r
+			}
+		}
+		if math.Abs(a[pivot][col]) < 1e-12 {
+			return Curve{}, fmt.Errorf("calibration points cannot determine a degree %d polynomial", degree)
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		for r := 0; r < n; r++ {
+			if r == col {
+				continue
+			}
+			f := a[r][col] / a[col][col]
+			for k := col; k <= n; k++ {
+				a[r][k] -= f * a[col][k]
+			}
+		}
+	}
+	c.Coefficients = make([]float64, n)
+	for i := range c.Coefficients {
+		c.Coefficients[i] = a[i][n] / a[i][i]
+	}
+	return c, nil
+}
+
+// evalSpline evaluates the natural cubic spline through knots, which rise
+// with the reading, at v.
+func evalSpline(knots []Point, v float64) float64 {
+	n := len(knots)
+	if n == 2 {
+		k0, k1 := knots[0], knots[1]
+		return k0.Reference + (v-k0.Reading)*(k1.Reference-k0.Reference)/(k1.Reading-k0.Reading)
+	}
+	m := splineMoments(knots)
+	slope := func(i int) float64 { // first derivative at knot i
+		if i == 0 {
+			h := knots[1].Reading - knots[0].Reading
+			return (knots[1].Reference-knots[0].Reference)/h - h*(2*m[0]+m[1])/6
+		}
+		h := knots[i].Reading - knots[i-1].Reading
+		return (knots[i].Reference-knots[i-1].Reference)/h + h*(m[i-1]+2*m[i])/6
+	}
+	if v <= knots[0].Reading {
+		return knots[0].Reference + (v-knots[0].Reading)*slope(0)
+	}
+	if v >= knots[n-1].Reading {
+		return knots[n-1].Reference + (v-knots[n-1].Reading)*slope(n-1)
+	}
+	i := sort.Search(n, func(i int) bool { return knots[i].Reading >= v }) - 1
+	x0, x1 := knots[i].Reading, knots[i+1].Reading
+	y0, y1 := knots[i].Reference, knots[i+1].Reference
+	h := x1 - x0
+	a, b := (x1-v)/h, (v-x0)/h
+	return a*y0 + b*y1 + ((a*a*a-a)*m[i]+(b*b*b-b)*m[i+1])*h*h/6
+}
+
+// splineMoments returns the second derivative at each knot, zero at the
+// ends, by the Thomas algorithm.
+func splineMoments(knots []Point) []float64 {
+	n := len(knots)
+	m := make([]float64, n)
+	if n < 3 {
+		return m
+	}
+	sub, diag, sup, rhs := make([]float64, n), make([]float64, n), make([]float64, n), make([]float64, n)
+	for i := 1; i < n-1; i++ {
+		h0 := knots[i].Reading - knots[i-1].Reading
+		h1 := knots[i+1].Reading - knots[i].Reading
+		sub[i], diag[i], sup[i] = h0, 2*(h0+h1), h1
+		rhs[i] = 6 * ((knots[i+1].Reference-knots[i].Reference)/h1 - (knots[i].Reference-knots[i-1].Reference)/h0)
+	}
+	for i := 2; i < n-1; i++ {
+		f := sub[i] / diag[i-1]
+		diag[i] -= f * sup[i-1]
+		rhs[i] -= f * rhs[i-1]
+	}
+	for i := n - 2; i >= 1; i-- {
+		m[i] = (rhs[i] - sup[i]*m[i+1]) / diag[i]
+	}
+	return m
+}
@@ -0,0 +1,65 @@
+package derivative
+
+import (
+	"fmt"
+	"time"
+)
+
+type sample struct {
+	t time.Time
+	v float64
+}
+
+// Slope estimates a signal's rate of change as the least-squares slope over a
+// trailing window, which smooths sensor noise far better than differencing
+// consecutive readings and copes with irregular poll timing.
+type Slope struct {
+	window  time.Duration
+	samples []sample
+}
+
+func NewSlope(window time.Duration) (*Slope, error) {
+	if window <= 0 {
+		return nil, fmt.Errorf("derivative window must be positive")
+	}
+	return &Slope{window: window}, nil
+}
+
+// Add records a sample and returns the slope in units per second. It reports
+// false until the window holds at least three samples spanning half of it.
+func (s *Slope) Add(t time.Time, v float64) (float64, bool) {
+	if n := len(s.samples); n > 0 && !t.After(s.samples[n-1].t) {
+		return 0, false
+	}
+	s.samples = append(s.samples, sample{t: t, v: v})
+	cutoff := t.Add(-s.window)
+	i := 0
+	for i < len(s.samples) && s.samples[i].t.Before(cutoff) {
+		i++
+	}
+	s.samples = s.samples[i:]
+
+	if len(s.samples) < 3 || t.Sub(s.samples[0].t) < s.window/2 {
+		return 0, false
+	}
+
+	// regress on seconds relative to the newest sample to keep values small
+	var sx, sy, sxx, sxy float64
+	n := float64(len(s.samples))
+	for _, p := range s.samples {
+		x := p.t.Sub(t).Seconds()
+		sx += x
+		sy += p.v
+		sxx += x * x
+		sxy += x * p.v
+	}
+	den := n*sxx - sx*sx
+	if den == 0 {
+		return 0, false
+	}
+	return (n*sxy - sx*sy) / den, true
+}
+
+func (s *Slope) Reset() {
+	s.samples = s.samples[:0]
+}
@@ -0,0 +1,171 @@
+// Package device adapts each supported driver to the one lifecycle the
+// daemon, the read and soak commands, and audits share.
+package device
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/demelere/sensor-control-modules/internal/config"
+	"github.com/demelere/sensor-control-modules/internal/units"
+	"github.com/demelere/sensor-control-modules/pkg/kurz"
+	"github.com/demelere/sensor-control-modules/pkg/vaisala"
+)
+
+// Device is a driver seen through its configured sensor entry. Optional
+// capabilities are nil when the driver has none.
+type Device struct {
+	Open         func() error
+	Read         func(context.Context) (float64, error)
+	ReadAll      func(context.Context) ([]Measurement, error) // metric plus whatever a multi-parameter device reports with it, nil for read alone
+	Extra        []Measurement                                // the other metrics ReadAll reports, where known before the first read
+	Paced        bool                                         // reads wait for the device's own output, so polls need no ticker
+	Close        func() error
+	Faults       func(context.Context) ([]vaisala.Fault, error)                          // device error register, nil if the driver has none
+	Compensate   func(context.Context, string, func() (vaisala.Measurement, bool)) error // feeds the named compensation from another metric until ctx is done, nil if the driver has none
+	Ident        func() (model, serial string)
+	Apply        func(context.Context, map[string]string) error // device settings from a provisioning profile
+	ReadSettings func(context.Context, []string) (map[string]string, error)
+	SetFiltering func(context.Context, float64) error // the device's own averaging, nil if it has none
+	Simulated    bool                                 // no hardware behind it, see config.Simulate
+	Metric       string
+	Unit         units.Unit
+}
+
+// Measurement is one value of a multi-parameter read, in its native unit.
+type Measurement struct {
+	Metric string
+	Unit   units.Unit
+	Value  float64
+}
+
+// Poll reads the sensor's metric and, from a multi-parameter device, the
+// values read alongside it.
+func (s *Device) Poll(ctx context.Context) (float64, []Measurement, error) {
+	if s.ReadAll == nil {
+		v, err := s.Read(ctx)
+		return v, nil, err
+	}
+	all, err := s.ReadAll(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+	for i, m := range all {
+		if m.Metric == s.Metric {
+			return m.Value, append(all[:i:i], all[i+1:]...), nil
+		}
+	}
+	return 0, nil, fmt.Errorf("reply has no %s", s.Metric)
+}
+
+// CompensateEvery is how often a compensation fed from another metric is
+// brought up to date.
+const CompensateEvery = time.Minute
+
+// Drivers opens a Device for a sensor entry, by driver name.
+var Drivers = map[string]func(cfg config.Sensor) (*Device, error){
+	"vaisala": func(cfg config.Sensor) (*Device, error) {
+		vs, err := vaisala.NewVaisalaSensor(cfg.BaudRate, cfg.Address)
+		if err != nil {
+			return nil, err
+		}
+		vs.SetReadTimeout(time.Duration(cfg.ReadTimeout))
+		vs.SetPort(cfg.Port)
+		vs.SetBus(vaisala.SharedBus(cfg.Port, cfg.PortMatch))
+		if err := vs.SetPortMatch(cfg.PortMatch); err != nil {
+			return nil, err
+		}
+		if err := vs.SetProtocol(vaisala.Protocol(cfg.Protocol)); err != nil {
+			return nil, err
+		}
+		if err := vs.SetParameters(cfg.Parameters); err != nil {
+			return nil, err
+		}
+		ident := func() (string, string) {
+			info := vs.Info()
+			return info.Model, info.SerialNumber
+		}
+		readAll := func(ctx context.Context) ([]Measurement, error) {
+			values, err := vs.ReadMeasurements(ctx)
+			if err != nil {
+				return nil, err
+			}
+			out := make([]Measurement, len(values))
+			for i, m := range values {
+				out[i] = Measurement{Metric: m.Metric, Unit: units.Unit(m.Unit), Value: m.Value}
+			}
+			return out, nil
+		}
+		var extra []Measurement
+		for _, p := range vs.Parameters() {
+			if p.Metric != "co2" {
+				extra = append(extra, Measurement{Metric: p.Metric, Unit: units.Unit(p.Unit)})
+			}
+		}
+		open := vs.Open
+		if cfg.Stream {
+			interval := time.Duration(cfg.PollInterval)
+			open = func() error {
+				if err := vs.Open(); err != nil {
+					return err
+				}
+				return vs.StartRun(interval) // Close ends it, so every reopen starts it again
+			}
+		}
+		compensate := func(ctx context.Context, kind string, source func() (vaisala.Measurement, bool)) error {
+			return vs.AutoCompensate(ctx, vaisala.Compensation(kind), source, CompensateEvery)
+		}
+		return &Device{Open: open, Read: vs.ReadCO2Context, ReadAll: readAll, Extra: extra, Paced: cfg.Stream, Close: vs.Close, Faults: vs.Faults, Compensate: compensate, Ident: ident, Apply: vs.Apply, ReadSettings: vs.ReadSettings, SetFiltering: vs.SetFiltering, Metric: "co2", Unit: units.PPM}, nil
+	},
+	"kurz": func(cfg config.Sensor) (*Device, error) {
+		opts := []kurz.Option{kurz.WithBaudRate(cfg.BaudRate), kurz.WithPort(cfg.Port), kurz.WithReadRetries(cfg.ReadRetries), kurz.WithFlowUnits(units.Unit(cfg.Flow.Native), units.Unit(cfg.Flow.Unit), cfg.Flow.Gas()), kurz.WithArray(kurz.Array(cfg.Array))}
+		switch cfg.Protocol {
+		case "", "ascii":
+		case "modbus":
+			opts = append(opts, kurz.WithModbus(cfg.Address))
+		default:
+			return nil, fmt.Errorf("protocol %q is not supported by kurz", cfg.Protocol)
+		}
+		ks, err := kurz.NewKurzSensor(opts...)
+		if err != nil {
+			return nil, err
+		}
+		ks.SetReadTimeout(time.Duration(cfg.ReadTimeout))
+		if err := ks.SetPortMatch(cfg.PortMatch); err != nil {
+			return nil, err
+		}
+		ident := func() (string, string) {
+			info := ks.Info()
+			return info.Model, info.SerialNumber
+		}
+		readAll := func(ctx context.Context) ([]Measurement, error) {
+			values, err := ks.ReadMeasurements(ctx)
+			if err != nil {
+				return nil, err
+			}
+			out := make([]Measurement, len(values))
+			for i, m := range values {
+				out[i] = Measurement{Metric: m.Metric, Unit: units.Unit(m.Unit), Value: m.Value}
+			}
+			return out, nil
+		}
+		var extra []Measurement
+		for _, m := range ks.Metrics() {
+			extra = append(extra, Measurement{Metric: m.Metric, Unit: units.Unit(m.Unit)})
+		}
+		return &Device{Open: ks.Open, Read: ks.ReadFlowRateContext, ReadAll: readAll, Extra: extra, Close: ks.Close, Ident: ident, Apply: ks.Apply, ReadSettings: ks.ReadParameters, Metric: "flow", Unit: ks.FlowUnit()}, nil
+	},
+}
+
+// Names lists the supported drivers, comma separated.
+func Names() string {
+	names := make([]string, 0, len(Drivers))
+	for name := range Drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
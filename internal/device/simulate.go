@@ -0,0 +1,122 @@
+package device
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/demelere/sensor-control-modules/internal/config"
+	"github.com/demelere/sensor-control-modules/internal/serialio"
+	"github.com/demelere/sensor-control-modules/internal/simulate"
+	"github.com/demelere/sensor-control-modules/internal/units"
+)
+
+// New opens a Device for a sensor entry by its driver, simulated when the
+// entry has simulate set.
+func New(cfg config.Sensor) (*Device, error) {
+	newDevice, ok := Drivers[cfg.Driver]
+	if !ok {
+		return nil, fmt.Errorf("driver %q is not supported (supported: %s)", cfg.Driver, Names())
+	}
+	d, err := newDevice(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Simulate == nil && cfg.Driver == "kurz" {
+		if cfg.Simulate, err = constantFlow(cfg, d.Unit); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Simulate == nil {
+		return d, nil
+	}
+	return simulated(cfg, d)
+}
+
+// constantFlow turns CONSTANT_FLOW_RATE_SCFM, which predates simulate, into
+// a constant simulated flow.
+func constantFlow(cfg config.Sensor, unit units.Unit) (*config.Simulate, error) {
+	v := os.Getenv("CONSTANT_FLOW_RATE_SCFM")
+	if v == "" {
+		return nil, nil
+	}
+	rate, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return nil, fmt.Errorf("CONSTANT_FLOW_RATE_SCFM: %v", err)
+	}
+	if rate, err = units.ConvertFlow(rate, units.SCFM, unit, cfg.Flow.Gas()); err != nil {
+		return nil, fmt.Errorf("CONSTANT_FLOW_RATE_SCFM: %v", err)
+	}
+	log.Printf("sensor %s: CONSTANT_FLOW_RATE_SCFM is deprecated, use simulate: {\"value\": %g}", cfg.Name, rate)
+	return &config.Simulate{Signal: config.Signal{Value: rate}}, nil
+}
+
+// simulated replaces d's hardware with cfg.Simulate, keeping d's metrics and
+// units.
+func simulated(cfg config.Sensor, d *Device) (*Device, error) {
+	sc := cfg.Simulate
+	signals := map[string]simulate.Signal{d.Metric: signal(sc.Signal)}
+	var extra []Measurement
+	for _, m := range d.Extra {
+		if sg, ok := sc.Metrics[m.Metric]; ok {
+			signals[m.Metric] = signal(sg)
+			extra = append(extra, m)
+		}
+	}
+	for metric := range sc.Metrics {
+		if _, ok := signals[metric]; !ok {
+			return nil, fmt.Errorf("simulate: %s reports no %s", cfg.Driver, metric)
+		}
+	}
+	var faults []simulate.Fault
+	for _, f := range sc.Faults {
+		kind, err := simulate.ParseFaultKind(f.Kind)
+		if err != nil {
+			return nil, fmt.Errorf("simulate: %v", err)
+		}
+		faults = append(faults, simulate.Fault{Kind: kind, At: time.Duration(f.At), For: time.Duration(f.For)})
+	}
+	timeout := time.Duration(cfg.ReadTimeout)
+	if timeout <= 0 {
+		timeout = serialio.DefaultTimeout
+	}
+	sim := simulate.New(signals, faults, time.Duration(sc.Repeat), timeout, sc.Seed)
+
+	unitOf := map[string]units.Unit{d.Metric: d.Unit}
+	for _, m := range extra {
+		unitOf[m.Metric] = m.Unit
+	}
+	read := func(ctx context.Context) (float64, error) {
+		values, err := sim.Read(ctx)
+		if err != nil {
+			return 0, err
+		}
+		return values[d.Metric], nil
+	}
+	var readAll func(context.Context) ([]Measurement, error)
+	if len(extra) > 0 {
+		readAll = func(ctx context.Context) ([]Measurement, error) {
+			values, err := sim.Read(ctx)
+			if err != nil {
+				return nil, err
+			}
+			out := make([]Measurement, 0, len(values))
+			for metric, v := range values {
+				out = append(out, Measurement{Metric: metric, Unit: unitOf[metric], Value: v})
+			}
+			return out, nil
+		}
+	}
+	ident := func() (string, string) {
+		return "simulated " + cfg.Driver, "SIM-" + cfg.Name
+	}
+	log.Printf("sensor %s: simulated, no %s device is opened", cfg.Name, cfg.Driver)
+	return &Device{Open: sim.Open, Read: read, ReadAll: readAll, Extra: extra, Close: sim.Close, Ident: ident, Simulated: true, Metric: d.Metric, Unit: d.Unit}, nil
+}
+
+func signal(s config.Signal) simulate.Signal {
+	return simulate.Signal{Value: s.Value, To: s.To, Over: time.Duration(s.Over), Noise: s.Noise}
+}
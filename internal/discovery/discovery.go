@@ -0,0 +1,126 @@
+package discovery
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"go.bug.st/serial/enumerator"
+
+	"github.com/demelere/sensor-control-modules/internal/sensorerr"
+)
+
+var discoveryByIDDir string
+
+func init() {
+	discoveryByIDDir = "/dev/serial/by-id"
+}
+
+// Port is a candidate serial device.
+type Port struct {
+	ID   string // by-id link name, e.g. usb-FTDI_..._USB_..-if00-port0, or VID:PID and serial number
+	Path string // device to open: /dev/ttyUSB0, /dev/cu.usbserial-A1, COM3
+}
+
+// USBID is a USB vendor and product ID pair, in hex as the OS reports them.
+type USBID struct {
+	VID, PID string
+}
+
+// Spec says how to recognise one driver's cable.
+type Spec struct {
+	Driver string         // names the sensor in errors and logs
+	ByID   *regexp.Regexp // matched against /dev/serial/by-id link names (linux)
+	USB    []USBID        // matched against enumerated USB serial ports (every platform)
+	Match  *regexp.Regexp // optional, keeps only candidates whose Port.ID matches, to pick one of several cables
+}
+
+// ByID lists the by-id links whose names match pattern, resolved to their
+// devices and sorted by name. No by-id directory (nothing plugged in, or not
+// Linux) is not an error; it just yields no ports.
+func ByID(pattern *regexp.Regexp) ([]Port, error) {
+	entries, err := os.ReadDir(discoveryByIDDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to list serial devices: %w", err)
+	}
+
+	var ports []Port
+	for _, e := range entries {
+		if !pattern.MatchString(e.Name()) {
+			continue
+		}
+		path, err := filepath.EvalSymlinks(filepath.Join(discoveryByIDDir, e.Name()))
+		if err != nil { // unplugged between ReadDir and here
+			log.Printf("skipping serial device %s: %v", e.Name(), err)
+			continue
+		}
+		ports = append(ports, Port{ID: e.Name(), Path: path})
+	}
+	sort.Slice(ports, func(i, j int) bool { return ports[i].ID < ports[j].ID })
+	return ports, nil
+}
+
+// USB enumerates the serial ports whose USB VID/PID is one of ids, sorted by
+// path. On macOS only the /dev/cu.* side of each device is returned: opening
+// /dev/tty.* blocks until the device asserts carrier detect.
+func USB(ids []USBID) ([]Port, error) {
+	details, err := enumerator.GetDetailedPortsList()
+	if err != nil {
+		return nil, fmt.Errorf("failed to enumerate serial ports: %w", err)
+	}
+
+	var ports []Port
+	for _, d := range details {
+		if !d.IsUSB || strings.HasPrefix(d.Name, "/dev/tty.") || !matchUSB(ids, d.VID, d.PID) {
+			continue
+		}
+		ports = append(ports, Port{ID: strings.TrimSpace(fmt.Sprintf("%s:%s %s", d.VID, d.PID, d.SerialNumber)), Path: d.Name})
+	}
+	sort.Slice(ports, func(i, j int) bool { return ports[i].Path < ports[j].Path })
+	return ports, nil
+}
+
+func matchUSB(ids []USBID, vid, pid string) bool {
+	for _, id := range ids {
+		if strings.EqualFold(id.VID, vid) && strings.EqualFold(id.PID, pid) {
+			return true
+		}
+	}
+	return false
+}
+
+// Find returns the first candidate port for spec. Errors wrap
+// sensorerr.ErrNotFound when there is none.
+func Find(spec Spec) (string, error) {
+	ports, err := candidates(spec)
+	if err != nil {
+		return "", fmt.Errorf("%s sensor %w: %v", spec.Driver, sensorerr.ErrNotFound, err)
+	}
+	if spec.Match != nil {
+		matched := ports[:0]
+		for _, p := range ports {
+			if spec.Match.MatchString(p.ID) {
+				matched = append(matched, p)
+			}
+		}
+		if len(matched) == 0 && len(ports) > 0 {
+			return "", fmt.Errorf("%s sensor %w matching %s (found %d others)", spec.Driver, sensorerr.ErrNotFound, spec.Match, len(ports))
+		}
+		ports = matched
+	}
+	if len(ports) == 0 {
+		return "", fmt.Errorf("%s sensor %w", spec.Driver, sensorerr.ErrNotFound)
+	}
+	if len(ports) > 1 {
+		log.Printf("found %d %s sensors, using %s", len(ports), spec.Driver, ports[0].ID)
+	}
+	return ports[0].Path, nil
+}
@@ -0,0 +1,24 @@
+package discovery
+
+import "log"
+
+// candidates prefers the by-id links udev maintains, and falls back to
+// enumerating USB serial ports where there are none (e.g. a container without
+// udev).
+func candidates(spec Spec) ([]Port, error) {
+	if spec.ByID != nil {
+		ports, err := ByID(spec.ByID)
+		if err != nil || len(ports) > 0 {
+			return ports, err
+		}
+	}
+	if len(spec.USB) == 0 {
+		return nil, nil
+	}
+	ports, err := USB(spec.USB)
+	if err != nil {
+		log.Printf("%v", err) // no by-id match either, so this is just not found
+		return nil, nil
+	}
+	return ports, nil
+}
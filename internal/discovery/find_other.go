@@ -0,0 +1,9 @@
+//go:build !linux
+
+package discovery
+
+// candidates enumerates USB serial ports by VID/PID: COM ports on Windows,
+// /dev/cu.* on macOS.
+func candidates(spec Spec) ([]Port, error) {
+	return USB(spec.USB)
+}
@@ -0,0 +1,17 @@
+// Package diskfree reports the free space on a filesystem.
+package diskfree
+
+import (
+	"path/filepath"
+	"syscall"
+)
+
+// Available reports the space available to unprivileged users on the
+// filesystem holding path, or its parent when path does not exist yet.
+func Available(path string) (uint64, bool) {
+	var st syscall.Statfs_t
+	if syscall.Statfs(path, &st) != nil && syscall.Statfs(filepath.Dir(path), &st) != nil {
+		return 0, false
+	}
+	return st.Bavail * uint64(st.Bsize), true
+}
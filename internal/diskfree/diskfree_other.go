@@ -0,0 +1,5 @@
+//go:build !linux
+
+package diskfree
+
+func Available(path string) (uint64, bool) { return 0, false }
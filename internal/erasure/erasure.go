@@ -0,0 +1,218 @@
+// Package erasure deletes what a rig has stored about one subject, for a
+// participant who withdraws from a study or asks for their data to be erased.
+// It covers the stores the daemon writes: session files with their sidecars
+// and protocol results, the event log, the session history, and the
+// pseudonym key map.
+package erasure
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/demelere/sensor-control-modules/internal/atrest"
+	"github.com/demelere/sensor-control-modules/internal/eventlog"
+	"github.com/demelere/sensor-control-modules/internal/integrity"
+	"github.com/demelere/sensor-control-modules/internal/privacy"
+	"github.com/demelere/sensor-control-modules/internal/protocol"
+	"github.com/demelere/sensor-control-modules/internal/trend"
+)
+
+// Stores are where the subject's data may be. Nil and empty fields are
+// skipped.
+type Stores struct {
+	SessionDir string
+	Key        []byte // decrypts session files recorded with sessions.encryption_key
+	Protocols  string // protocol results, named after their sessions
+	Events     *eventlog.Log
+	History    *trend.History
+	Pseudonyms *privacy.Pseudonyms
+}
+
+// Report says what Delete removed. A report that is not Complete lists what
+// it could not check or remove under Skipped; the key map is then left alone,
+// so running the deletion again still finds the subject's pseudonymous files.
+type Report struct {
+	Subject    string    `json:"subject"`
+	Time       time.Time `json:"time"`
+	Complete   bool      `json:"complete"`
+	Pseudonyms []string  `json:"pseudonyms"` // searched for, and removed from the key map when complete
+	Sessions   []string  `json:"sessions"`
+	Files      []string  `json:"files"`
+	Events     int       `json:"events"`    // event log entries removed
+	Summaries  int       `json:"summaries"` // session history entries removed
+	Skipped    []Skip    `json:"skipped,omitempty"`
+	Elsewhere  []string  `json:"elsewhere,omitempty"` // where data was sent that the rig cannot delete
+}
+
+// Skip is a file that may hold the subject's data but was not removed.
+type Skip struct {
+	File   string `json:"file"`
+	Reason string `json:"reason"`
+}
+
+// Delete removes every session recorded for subject, under its own name or
+// any of its pseudonyms, along with the session's sidecars, event log
+// entries, and history, and then the subject's pseudonyms. Sessions recorded without a
+// subject cannot be attributed and are kept.
+func Delete(subject string, st Stores) (Report, error) {
+	rep := Report{Subject: subject, Time: time.Now().UTC(), Pseudonyms: []string{}, Sessions: []string{}, Files: []string{}}
+	if subject == "" {
+		return rep, fmt.Errorf("no subject given")
+	}
+	names := map[string]bool{subject: true}
+	if st.Pseudonyms != nil {
+		for _, p := range st.Pseudonyms.Issued(subject) {
+			names[p] = true
+			rep.Pseudonyms = append(rep.Pseudonyms, p)
+		}
+	}
+
+	deleted := map[string]bool{}
+	if st.SessionDir != "" {
+		files, err := sessionFiles(st.SessionDir)
+		if err != nil {
+			return rep, err
+		}
+		for _, path := range files {
+			id, recorded, err := sessionSubject(path, st.Key)
+			if err != nil {
+				rep.Skipped = append(rep.Skipped, Skip{path, err.Error()})
+				continue
+			}
+			if !names[recorded] {
+				continue
+			}
+			removed, err := remove(path)
+			if err == nil && st.Protocols != "" {
+				var results []string
+				results, err = removeResults(st.Protocols, path)
+				removed = append(removed, results...)
+			}
+			rep.Files = append(rep.Files, removed...)
+			if err != nil {
+				rep.Skipped = append(rep.Skipped, Skip{path, err.Error()})
+				continue
+			}
+			deleted[id] = true
+			rep.Sessions = append(rep.Sessions, id)
+		}
+	}
+
+	if st.Events != nil && len(deleted) > 0 {
+		n, err := st.Events.Remove(func(e eventlog.Entry) bool { return deleted[e.Session] })
+		rep.Events = n
+		if err != nil {
+			rep.Skipped = append(rep.Skipped, Skip{"event log", err.Error()})
+		}
+	}
+
+	if st.History != nil {
+		n, err := st.History.Remove(func(s trend.Summary) bool { return names[s.Subject] || deleted[s.Session] })
+		rep.Summaries = n
+		if err != nil {
+			rep.Skipped = append(rep.Skipped, Skip{"session history", err.Error()})
+		}
+	}
+
+	rep.Complete = len(rep.Skipped) == 0
+	if st.Pseudonyms != nil && rep.Complete {
+		if _, err := st.Pseudonyms.Forget(subject); err != nil {
+			rep.Skipped = append(rep.Skipped, Skip{"pseudonym key map", err.Error()})
+			rep.Complete = false
+		}
+	}
+	return rep, nil
+}
+
+// removeResults deletes the protocol results of the session recorded in
+// path, in dir.
+func removeResults(dir, path string) ([]string, error) {
+	stem := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(path), atrest.Suffix), ".jsonl")
+	var removed []string
+	for _, suffix := range []string{protocol.ResultSuffix, protocol.ResultSuffix + atrest.Suffix} {
+		p := filepath.Join(dir, stem+suffix)
+		err := os.Remove(p)
+		if err == nil {
+			removed = append(removed, p)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return removed, fmt.Errorf("failed to delete protocol result: %w", err)
+		}
+	}
+	return removed, nil
+}
+
+// sessionFiles lists the session streams in dir, encrypted or not.
+func sessionFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	var files []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.Type().IsRegular() && (strings.HasSuffix(name, ".jsonl") || strings.HasSuffix(name, ".jsonl"+atrest.Suffix)) {
+			files = append(files, filepath.Join(dir, name))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// sessionSubject reads the session ID and subject from the session_start
+// line every session file opens with.
+func sessionSubject(path string, key []byte) (string, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(path, atrest.Suffix) {
+		if key == nil {
+			return "", "", fmt.Errorf("encrypted, and no sessions.encryption_key to read it with")
+		}
+		if r, err = atrest.NewReader(f, key); err != nil {
+			return "", "", err
+		}
+	}
+	line, err := bufio.NewReader(r).ReadBytes('\n')
+	if err != nil && len(line) == 0 {
+		if err == io.EOF {
+			return "", "", nil // created but never written
+		}
+		return "", "", err
+	}
+	var start struct {
+		Annotation string `json:"annotation"`
+		Session    string `json:"session"`
+		Subject    string `json:"subject"`
+	}
+	if json.Unmarshal(line, &start) != nil || start.Annotation != "session_start" {
+		return "", "", fmt.Errorf("does not open with session_start")
+	}
+	return start.Session, start.Subject, nil
+}
+
+// remove deletes a session file and its sidecars and returns what it deleted.
+func remove(path string) ([]string, error) {
+	var removed []string
+	for _, p := range []string{path + integrity.SigSuffix, path + integrity.HashSuffix, path} {
+		err := os.Remove(p)
+		if err == nil {
+			removed = append(removed, p)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return removed, fmt.Errorf("failed to delete: %w", err)
+		}
+	}
+	return removed, nil
+}
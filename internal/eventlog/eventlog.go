@@ -0,0 +1,249 @@
+package eventlog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DefaultMaxBytes is the size at which the log rotates. One previous
+// generation is kept, so queries reach back at most about twice this.
+var DefaultMaxBytes int64 = 16 << 20
+
+// Entry is one recorded event: an annotation from the session stream, plus
+// the alert it raised, if any.
+type Entry struct {
+	Time    time.Time       `json:"time"`
+	End     *time.Time      `json:"end,omitempty"` // set for events that span time (gaps, labels)
+	Type    string          `json:"type"`          // gap, connection, device_fault, marker, session_start, ...
+	Sensor  string          `json:"sensor,omitempty"`
+	Session string          `json:"session,omitempty"`
+	Alert   string          `json:"alert,omitempty"` // alert kind, e.g. "disconnected"
+	Message string          `json:"message,omitempty"`
+	Event   json.RawMessage `json:"event"` // the annotation exactly as recorded
+}
+
+// Query selects entries. Zero fields match everything; an event that spans
+// time matches if any part of it falls between From and To.
+type Query struct {
+	From, To time.Time
+	Types    []string
+	Sensor   string
+	Alerts   bool // only entries that raised an alert
+	Limit    int  // most recent Limit matches, 0 for all
+}
+
+func (q Query) match(e Entry) bool {
+	end := e.Time
+	if e.End != nil {
+		end = *e.End
+	}
+	if !q.From.IsZero() && end.Before(q.From) || !q.To.IsZero() && e.Time.After(q.To) {
+		return false
+	}
+	if q.Sensor != "" && e.Sensor != q.Sensor || q.Alerts && e.Alert == "" {
+		return false
+	}
+	if len(q.Types) == 0 {
+		return true
+	}
+	for _, t := range q.Types {
+		if t == e.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// Log is an append-only JSON-lines file of entries that survives restarts.
+// When it passes maxBytes it is renamed to <path>.1, replacing the previous
+// generation, and a new file is started.
+type Log struct {
+	path     string
+	maxBytes int64
+	lock     sync.Mutex
+	f        *os.File
+	size     int64
+}
+
+// Open opens or creates the log at path. maxBytes <= 0 selects
+// DefaultMaxBytes.
+func Open(path string, maxBytes int64) (*Log, error) {
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBytes
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create event log dir: %w", err)
+	}
+	l := &Log{path: path, maxBytes: maxBytes}
+	if err := l.openFile(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *Log) openFile() error {
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open event log: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to open event log: %w", err)
+	}
+	l.f, l.size = f, info.Size()
+	return nil
+}
+
+func (l *Log) Append(e Entry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %v", err)
+	}
+	line = append(line, '\n')
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.f == nil {
+		return fmt.Errorf("event log is closed")
+	}
+	if l.size > 0 && l.size+int64(len(line)) > l.maxBytes {
+		if err := l.rotateLocked(); err != nil {
+			return err
+		}
+	}
+	n, err := l.f.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write event log: %w", err)
+	}
+	return nil
+}
+
+func (l *Log) rotateLocked() error {
+	l.f.Close()
+	l.f = nil
+	if err := os.Rename(l.path, l.path+".1"); err != nil {
+		return fmt.Errorf("failed to rotate event log: %w", err)
+	}
+	return l.openFile()
+}
+
+// Query returns the matching entries, oldest first, from both generations.
+func (l *Log) Query(q Query) ([]Entry, error) {
+	l.lock.Lock() // no half-written line, and no rotation mid-read
+	defer l.lock.Unlock()
+	var out []Entry
+	for _, path := range []string{l.path + ".1", l.path} {
+		var err error
+		if out, err = scan(path, q, out); err != nil {
+			return nil, err
+		}
+	}
+	if q.Limit > 0 && len(out) > q.Limit {
+		out = out[len(out)-q.Limit:]
+	}
+	return out, nil
+}
+
+func scan(path string, q Query, out []Entry) ([]Entry, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return out, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read event log: %w", err)
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for sc.Scan() {
+		var e Entry
+		if json.Unmarshal(sc.Bytes(), &e) != nil {
+			continue // torn last line from a power cut
+		}
+		if q.match(e) {
+			out = append(out, e)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read event log: %w", err)
+	}
+	return out, nil
+}
+
+// Remove deletes the entries match selects from both generations and returns
+// how many it removed. Each generation is rewritten and renamed into place,
+// so a crash leaves it either whole or without the entries.
+func (l *Log) Remove(match func(Entry) bool) (int, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.f == nil {
+		return 0, fmt.Errorf("event log is closed")
+	}
+	removed, err := rewrite(l.path+".1", match)
+	if err != nil {
+		return removed, err
+	}
+	n, err := rewrite(l.path, match)
+	removed += n
+	if n > 0 {
+		// the open file is the old, unlinked one; append to the new
+		l.f.Close()
+		l.f = nil
+		if err := l.openFile(); err != nil {
+			return removed, err
+		}
+	}
+	return removed, err
+}
+
+// rewrite copies path without the entries match selects, keeping lines that
+// do not parse as they are, and renames the copy over path if any were dropped.
+func rewrite(path string, match func(Entry) bool) (int, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to read event log: %w", err)
+	}
+	var kept []byte
+	removed := 0
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		var e Entry
+		if len(line) > 0 && json.Unmarshal(line, &e) == nil && match(e) {
+			removed++
+			continue
+		}
+		kept = append(kept, line...)
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, kept, 0o644); err != nil {
+		return 0, fmt.Errorf("failed to rewrite event log: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return 0, fmt.Errorf("failed to rewrite event log: %w", err)
+	}
+	return removed, nil
+}
+
+func (l *Log) Close() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
@@ -0,0 +1,165 @@
+package filter
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Hysteresis is a Schmitt trigger around Threshold. It turns on when the input
+// crosses the threshold (above it, or below it when Above is false) and only
+// turns off once the input has come back past the threshold by Band, so a
+// value hovering at the threshold does not chatter on and off.
+type Hysteresis struct {
+	Threshold float64
+	Band      float64
+	Above     bool
+	Inclusive bool // on at exactly Threshold
+	on        bool
+}
+
+func (h *Hysteresis) Update(v float64) bool {
+	t := h.Threshold
+	if !h.Above {
+		v, t = -v, -t // mirror so the logic below only handles "above"
+	}
+	if h.on {
+		if h.Inclusive {
+			h.on = v >= t-h.Band
+		} else {
+			h.on = v > t-h.Band
+		}
+	} else {
+		if h.Inclusive {
+			h.on = v >= t
+		} else {
+			h.on = v > t
+		}
+	}
+	return h.on
+}
+
+func (h *Hysteresis) On() bool {
+	return h.on
+}
+
+func (h *Hysteresis) Reset() {
+	h.on = false
+}
+
+// DeadBand holds its output until the input moves at least Band away from the
+// last value passed through.
+type DeadBand struct {
+	Band   float64
+	last   float64
+	primed bool
+}
+
+// Apply returns the held value and whether it changed.
+func (d *DeadBand) Apply(v float64) (float64, bool) {
+	if !d.primed || math.Abs(v-d.last) >= d.Band {
+		d.last, d.primed = v, true
+		return v, true
+	}
+	return d.last, false
+}
+
+func (d *DeadBand) Reset() {
+	d.primed = false
+}
+
+// Smoother turns a noisy series into a smoothed one, a value at a time.
+type Smoother interface {
+	Apply(v float64) float64
+	Reset()
+}
+
+// NewSmoother returns the smoother named by method: "moving_average" or
+// "median" over the last window values, or "exponential" with weight alpha
+// (0 < alpha <= 1) on each new value.
+func NewSmoother(method string, window int, alpha float64) (Smoother, error) {
+	switch method {
+	case "moving_average", "median":
+		if window < 1 {
+			return nil, fmt.Errorf("%s needs a window of at least 1", method)
+		}
+		if method == "median" {
+			return &Median{Window: window}, nil
+		}
+		return &MovingAverage{Window: window}, nil
+	case "exponential":
+		if alpha <= 0 || alpha > 1 {
+			return nil, fmt.Errorf("exponential smoothing needs 0 < alpha <= 1, not %g", alpha)
+		}
+		return &Exponential{Alpha: alpha}, nil
+	}
+	return nil, fmt.Errorf("unknown smoothing %q (want moving_average, median, or exponential)", method)
+}
+
+// MovingAverage is the mean of the last Window values, or of all of them
+// until there are that many.
+type MovingAverage struct {
+	Window int
+	values []float64
+	sum    float64
+}
+
+func (m *MovingAverage) Apply(v float64) float64 {
+	m.values = append(m.values, v)
+	m.sum += v
+	if len(m.values) > m.Window {
+		m.sum -= m.values[0]
+		m.values = m.values[1:]
+	}
+	return m.sum / float64(len(m.values))
+}
+
+func (m *MovingAverage) Reset() {
+	m.values, m.sum = nil, 0
+}
+
+// Median is the median of the last Window values, which unlike an average
+// ignores the odd spike entirely.
+type Median struct {
+	Window int
+	values []float64
+}
+
+func (m *Median) Apply(v float64) float64 {
+	m.values = append(m.values, v)
+	if len(m.values) > m.Window {
+		m.values = m.values[1:]
+	}
+	sorted := append([]float64(nil), m.values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+func (m *Median) Reset() {
+	m.values = nil
+}
+
+// Exponential weighs each new value by Alpha against the running output,
+// starting from the first value.
+type Exponential struct {
+	Alpha  float64
+	out    float64
+	primed bool
+}
+
+func (e *Exponential) Apply(v float64) float64 {
+	if !e.primed {
+		e.out, e.primed = v, true
+	} else {
+		e.out += e.Alpha * (v - e.out)
+	}
+	return e.out
+}
+
+func (e *Exponential) Reset() {
+	e.primed = false
+}
@@ -0,0 +1,77 @@
+package gap
+
+import (
+	"math"
+	"time"
+)
+
+// Annotation is the marker value for gap records, so consumers of a mixed
+// JSON-lines stream can tell them apart from readings without guessing.
+const Annotation = "gap"
+
+// Gap records a stretch with no data for one stream. Start is the last good
+// reading and End the first one after it (or when the stream was closed).
+type Gap struct {
+	Annotation string    `json:"annotation"`
+	Sensor     string    `json:"sensor"`
+	Metric     string    `json:"metric"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	Missed     int       `json:"missed_polls"`
+	Reason     string    `json:"reason,omitempty"` // last error seen during the gap
+}
+
+// Detector spots gaps in one polled stream. A gap is any spacing between
+// readings longer than 1.5 poll intervals.
+type Detector struct {
+	sensor   string
+	metric   string
+	interval time.Duration
+	last     time.Time
+	lastErr  error
+}
+
+func NewDetector(sensor, metric string, interval time.Duration) *Detector {
+	return &Detector{sensor: sensor, metric: metric, interval: interval}
+}
+
+// Error notes a failed poll; the most recent one becomes the gap's reason.
+func (d *Detector) Error(err error) {
+	d.lastErr = err
+}
+
+// Reading records a good reading at t and returns the gap it closes, if any.
+func (d *Detector) Reading(t time.Time) (Gap, bool) {
+	g, ok := d.check(t)
+	d.last = t
+	d.lastErr = nil
+	return g, ok
+}
+
+// Close returns the gap still open at t, e.g. when the daemon stops while a
+// sensor is unreachable.
+func (d *Detector) Close(t time.Time) (Gap, bool) {
+	return d.check(t)
+}
+
+func (d *Detector) check(t time.Time) (Gap, bool) {
+	if d.last.IsZero() || d.interval <= 0 {
+		return Gap{}, false
+	}
+	spacing := t.Sub(d.last)
+	if spacing <= d.interval*3/2 {
+		return Gap{}, false
+	}
+	g := Gap{
+		Annotation: Annotation,
+		Sensor:     d.sensor,
+		Metric:     d.metric,
+		Start:      d.last,
+		End:        t,
+		Missed:     int(math.Round(float64(spacing)/float64(d.interval))) - 1,
+	}
+	if d.lastErr != nil {
+		g.Reason = d.lastErr.Error()
+	}
+	return g, true
+}
@@ -0,0 +1,272 @@
+package golden
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/demelere/sensor-control-modules/internal/apnea"
+	"github.com/demelere/sensor-control-modules/internal/kalman"
+	"github.com/demelere/sensor-control-modules/internal/metabolic"
+	"github.com/demelere/sensor-control-modules/internal/resample"
+	"github.com/demelere/sensor-control-modules/internal/sim"
+	"github.com/demelere/sensor-control-modules/internal/threshold"
+	"github.com/demelere/sensor-control-modules/internal/uncertainty"
+)
+
+var (
+	goldenSessionFile  string
+	goldenExpectedFile string
+)
+
+func init() {
+	goldenSessionFile = "session.jsonl"
+	goldenExpectedFile = "expected.json"
+}
+
+type Aggregate struct {
+	Count int     `json:"count"`
+	Mean  float64 `json:"mean"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+}
+
+func (a *Aggregate) add(v float64) {
+	if a.Count == 0 {
+		a.Min, a.Max = v, v
+	}
+	a.Count++
+	a.Mean += (v - a.Mean) / float64(a.Count)
+	a.Min = math.Min(a.Min, v)
+	a.Max = math.Max(a.Max, v)
+}
+
+// ExportRateHz is the rate the derived series are exported at in Outputs.
+const ExportRateHz = 0.1
+
+// exported are the derived series pinned as they are exported.
+var exported = []string{"ve_lpm", "vco2_lpm", "ee_kcal_min"}
+
+// Outputs is everything the math modules derive from a session; it is what the
+// golden file pins down.
+type Outputs struct {
+	Aggregates     map[string]*Aggregate `json:"aggregates"`
+	FinalEE        float64               `json:"final_ee_kcal_min"`
+	FinalEEStdDev  float64               `json:"final_ee_std_dev"`
+	MeanVCO2StdDev float64               `json:"mean_vco2_std_dev"`
+	Thresholds     map[string]float64    `json:"thresholds"`
+	ApneaEvents    int                   `json:"apnea_events"`
+	// Export is each derived series resampled at ExportRateHz, as
+	// sensorctl resample exports it.
+	Export map[string][]float64 `json:"export"`
+}
+
+// Process runs a recorded session through the derived-metric pipeline.
+func Process(samples []sim.Sample) Outputs {
+	out := Outputs{Aggregates: make(map[string]*Aggregate), Thresholds: make(map[string]float64), Export: make(map[string][]float64)}
+	series := make(map[string]*resample.Resampler)
+	for _, name := range exported {
+		series[name], _ = resample.New(ExportRateHz, resample.Linear, 0)
+		out.Export[name] = []float64{}
+	}
+	export := func(name string, points []resample.Point) {
+		for _, p := range points {
+			out.Export[name] = append(out.Export[name], p.Value)
+		}
+	}
+	agg := func(name string, v float64) {
+		a, ok := out.Aggregates[name]
+		if !ok {
+			a = &Aggregate{}
+			out.Aggregates[name] = a
+		}
+		a.add(v)
+	}
+
+	est := kalman.NewMetabolicEstimator(kalman.DefaultHRCalibration(), 0)
+	thr := threshold.NewEstimator(nil)
+	defer thr.Close()
+	det := apnea.NewDetector(0, 0, 0)
+	var vco2SD Aggregate
+
+	for _, s := range samples {
+		ve := metabolic.VE(s.FlowSCFM)
+		vco2 := metabolic.VCO2(ve, s.CO2PPM)
+		ee := metabolic.EnergyExpenditure(vco2, 0)
+
+		agg("co2_ppm", s.CO2PPM)
+		agg("flow_scfm", s.FlowSCFM)
+		agg("hr_bpm", s.HR)
+		agg("ve_lpm", ve)
+		agg("vco2_lpm", vco2)
+		agg("ee_kcal_min", ee)
+		for name, v := range map[string]float64{"ve_lpm": ve, "vco2_lpm": vco2, "ee_kcal_min": ee} {
+			export(name, series[name].Add(s.Time, v))
+		}
+
+		vu := metabolic.VCO2Uncertain(metabolic.VEUncertain(uncertainty.Measure("flow", s.FlowSCFM)), uncertainty.Measure("co2", s.CO2PPM))
+		vco2SD.add(vu.StdDev)
+
+		est.UpdateCO2(s.Time, s.CO2PPM)
+		est.UpdateFlow(s.Time, s.FlowSCFM)
+		est.UpdateHeartRate(s.Time, s.HR)
+		thr.Add(threshold.Sample{Time: s.Time, VE: ve, VCO2: vco2, HR: s.HR})
+		det.AddFlow(s.Time, s.FlowSCFM)
+		det.AddCO2(s.Time, s.CO2PPM)
+	}
+
+	for _, name := range exported {
+		export(name, series[name].Flush())
+	}
+
+	e := est.Estimate()
+	out.FinalEE, out.FinalEEStdDev = e.EE, e.StdDev
+	out.MeanVCO2StdDev = vco2SD.Mean
+	for _, t := range thr.Found() {
+		out.Thresholds[string(t.Kind)] = t.At
+	}
+	for drained := false; !drained; {
+		select {
+		case <-det.Events():
+			out.ApneaEvents++
+		default:
+			drained = true
+		}
+	}
+	return out
+}
+
+// Record writes samples and their pipeline outputs into dir as a new golden
+// reference, replacing any existing one.
+func Record(dir string, samples []sim.Sample) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create golden directory: %v", err)
+	}
+
+	f, err := os.Create(filepath.Join(dir, goldenSessionFile))
+	if err != nil {
+		return fmt.Errorf("failed to create session file: %v", err)
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, s := range samples {
+		if err := enc.Encode(s); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to write session: %v", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write session: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(Process(samples), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, goldenExpectedFile), data, 0o644)
+}
+
+func LoadSession(path string) ([]sim.Sample, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open session: %v", err)
+	}
+	defer f.Close()
+
+	var samples []sim.Sample
+	dec := json.NewDecoder(f)
+	for dec.More() {
+		var s sim.Sample
+		if err := dec.Decode(&s); err != nil {
+			return nil, fmt.Errorf("failed to decode session sample %d: %v", len(samples)+1, err)
+		}
+		samples = append(samples, s)
+	}
+	return samples, nil
+}
+
+// Mismatch is one output that drifted from its golden value.
+type Mismatch struct {
+	Field    string
+	Expected float64
+	Actual   float64
+}
+
+func (m Mismatch) String() string {
+	return fmt.Sprintf("%s: expected %g, got %g", m.Field, m.Expected, m.Actual)
+}
+
+// Check replays the session stored in dir and compares the outputs with the
+// stored expectation. relTol is a relative tolerance; values near zero are
+// compared with relTol as an absolute tolerance instead.
+func Check(dir string, relTol float64) ([]Mismatch, error) {
+	samples, err := LoadSession(filepath.Join(dir, goldenSessionFile))
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, goldenExpectedFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read golden outputs: %v", err)
+	}
+	var want Outputs
+	if err := json.Unmarshal(data, &want); err != nil {
+		return nil, fmt.Errorf("failed to parse golden outputs: %v", err)
+	}
+	return Compare(want, Process(samples), relTol), nil
+}
+
+func Compare(want, got Outputs, relTol float64) []Mismatch {
+	var out []Mismatch
+	cmp := func(field string, w, g float64) {
+		diff := math.Abs(w - g)
+		if diff > relTol*math.Max(math.Abs(w), 1) || math.IsNaN(g) != math.IsNaN(w) {
+			out = append(out, Mismatch{Field: field, Expected: w, Actual: g})
+		}
+	}
+
+	names := make([]string, 0, len(want.Aggregates))
+	for name := range want.Aggregates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		w, g := want.Aggregates[name], got.Aggregates[name]
+		if g == nil {
+			g = &Aggregate{}
+		}
+		cmp(name+".count", float64(w.Count), float64(g.Count))
+		cmp(name+".mean", w.Mean, g.Mean)
+		cmp(name+".min", w.Min, g.Min)
+		cmp(name+".max", w.Max, g.Max)
+	}
+
+	cmp("final_ee_kcal_min", want.FinalEE, got.FinalEE)
+	cmp("final_ee_std_dev", want.FinalEEStdDev, got.FinalEEStdDev)
+	cmp("mean_vco2_std_dev", want.MeanVCO2StdDev, got.MeanVCO2StdDev)
+	cmp("apnea_events", float64(want.ApneaEvents), float64(got.ApneaEvents))
+	for _, kind := range []string{string(threshold.KindVentilatory), string(threshold.KindHeartRate)} {
+		w, wok := want.Thresholds[kind]
+		g, gok := got.Thresholds[kind]
+		if wok != gok {
+			out = append(out, Mismatch{Field: "thresholds." + kind, Expected: w, Actual: g})
+			continue
+		}
+		cmp("thresholds."+kind, w, g)
+	}
+	for _, name := range exported {
+		w, g := want.Export[name], got.Export[name]
+		cmp("export."+name+".points", float64(len(w)), float64(len(g)))
+		for i := 0; i < len(w) && i < len(g); i++ {
+			cmp(fmt.Sprintf("export.%s[%d]", name, i), w[i], g[i])
+		}
+	}
+	return out
+}
@@ -0,0 +1,13 @@
+package golden
+
+import "testing"
+
+func TestGoldenSession(t *testing.T) {
+	mismatches, err := Check("../../testdata/golden", 1e-9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range mismatches {
+		t.Error(m)
+	}
+}
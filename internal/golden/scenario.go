@@ -0,0 +1,103 @@
+package golden
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/demelere/sensor-control-modules/internal/kalman"
+	"github.com/demelere/sensor-control-modules/internal/metabolic"
+	"github.com/demelere/sensor-control-modules/internal/sim"
+	"github.com/demelere/sensor-control-modules/internal/threshold"
+)
+
+// Finding is one output of the modules held against a scenario's ground
+// truth. A threshold the truth lacks must not be found, and one it has must.
+type Finding struct {
+	Field     string
+	Truth     float64
+	Got       float64
+	Tolerance float64 // absolute
+	Expected  bool    // the truth has a value
+	Found     bool    // the modules reported one
+}
+
+func (f Finding) OK() bool {
+	if f.Expected != f.Found {
+		return false
+	}
+	return !f.Expected || math.Abs(f.Got-f.Truth) <= f.Tolerance
+}
+
+func (f Finding) String() string {
+	switch {
+	case !f.Expected && f.Found:
+		return fmt.Sprintf("%s: none expected, found %.3f", f.Field, f.Got)
+	case !f.Expected:
+		return fmt.Sprintf("%s: none, as expected", f.Field)
+	case !f.Found:
+		return fmt.Sprintf("%s: expected %.3f, found none", f.Field, f.Truth)
+	}
+	return fmt.Sprintf("%s: expected %.3f ± %.3f, got %.3f", f.Field, f.Truth, f.Tolerance, f.Got)
+}
+
+// Validate plays sc and runs its session through the metabolic and
+// threshold modules the way a test would, tracking the error of the fused
+// energy expenditure estimate at every sample: the threshold estimator is reset
+// at the start of every ramp and sees only ramps, and the metabolic
+// estimator is calibrated for heart rate on the subject, as a calibration
+// stage would. It returns the session with how each output compares to the
+// truth.
+func Validate(sc *sim.Scenario) ([]sim.Sample, []Finding) {
+	samples, truth := sc.Run()
+	subj := sc.Subject
+	hrCal := kalman.HRCalibration{
+		RestHR:     subj.RestHR,
+		RestEE:     subj.RestEE(),
+		KcalPerBPM: (subj.MaxEE() - subj.RestEE()) / (subj.MaxHR - subj.RestHR),
+	}
+	est := kalman.NewMetabolicEstimator(hrCal, subj.RQ)
+	thr := threshold.NewEstimator(nil)
+	defer thr.Close()
+
+	var ee, tracking Aggregate
+	found := map[string]float64{}
+	phase := ""
+	for i, s := range samples {
+		ee.add(metabolic.EnergyExpenditure(metabolic.VCO2(metabolic.VE(s.FlowSCFM), s.CO2PPM), subj.RQ))
+		est.UpdateCO2(s.Time, s.CO2PPM)
+		est.UpdateFlow(s.Time, s.FlowSCFM)
+		est.UpdateHeartRate(s.Time, s.HR)
+		tracking.add(math.Abs(est.Estimate().EE - truth.EE[i]))
+
+		p, _ := sc.Phase(s.Phase)
+		if s.Phase != phase {
+			phase = s.Phase
+			if p.Ramp() {
+				thr.Reset()
+			}
+		}
+		if p.Ramp() {
+			thr.Add(threshold.Sample{Time: s.Time, VE: metabolic.VE(s.FlowSCFM), VCO2: metabolic.VCO2(metabolic.VE(s.FlowSCFM), s.CO2PPM), HR: s.HR})
+			for _, t := range thr.Found() {
+				if _, ok := found[string(t.Kind)]; !ok {
+					found[string(t.Kind)] = t.At
+				}
+			}
+		}
+	}
+
+	tol := sc.Tolerance
+	findings := []Finding{
+		{Field: "mean_ee_kcal_min", Truth: truth.MeanEE, Got: ee.Mean, Tolerance: tol.MeanEE * truth.MeanEE, Expected: true, Found: ee.Count > 0},
+		{Field: "ee_estimate_error_kcal_min", Got: tracking.Mean, Tolerance: tol.Tracking * truth.MeanEE, Expected: true, Found: tracking.Count > 0},
+	}
+	for _, k := range []struct {
+		kind threshold.Kind
+		tol  float64
+	}{{threshold.KindVentilatory, tol.Ventilatory}, {threshold.KindHeartRate, tol.HeartRate}} {
+		want, expected := truth.Thresholds[string(k.kind)]
+		got, ok := found[string(k.kind)]
+		findings = append(findings, Finding{Field: "thresholds." + string(k.kind), Truth: want, Got: got, Tolerance: k.tol, Expected: expected, Found: ok})
+	}
+	return samples, findings
+}
@@ -0,0 +1,91 @@
+// Package identity binds each logical sensor in the config to the device, by
+// serial number, its readings come from, so a probe replaced under the same
+// sensor name is noticed instead of silently continuing the old one's series.
+package identity
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Binding is the device a sensor is bound to.
+type Binding struct {
+	Driver       string    `json:"driver"`
+	Model        string    `json:"model,omitempty"`
+	SerialNumber string    `json:"serial_number"`
+	Since        time.Time `json:"since"`
+}
+
+// Set holds every sensor's binding. With a path, every change is saved so it
+// survives a restart.
+type Set struct {
+	path  string
+	lock  sync.RWMutex
+	bound map[string]Binding
+}
+
+// Open loads the set saved at path. An empty path keeps it in memory only,
+// and a missing file is an empty set.
+func Open(path string) (*Set, error) {
+	s := &Set{path: path, bound: map[string]Binding{}}
+	if path == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read identity state: %w", err)
+	}
+	var saved struct {
+		Sensors map[string]Binding `json:"sensors"`
+	}
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("failed to parse identity state %s: %v", path, err)
+	}
+	for name, b := range saved.Sensors {
+		s.bound[name] = b
+	}
+	return s, nil
+}
+
+// Get returns the device sensor is bound to.
+func (s *Set) Get(sensor string) (Binding, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	b, ok := s.bound[sensor]
+	return b, ok
+}
+
+// Bind binds sensor to b and saves the set. The binding stands in memory
+// even if saving fails.
+func (s *Set) Bind(sensor string, b Binding) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.bound[sensor] = b
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(struct {
+		Sensors map[string]Binding `json:"sensors"`
+	}{s.bound}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode identity state: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("failed to write identity state: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write identity state: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to write identity state: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package integral
+
+import (
+	"time"
+
+	"github.com/demelere/sensor-control-modules/internal/accum"
+)
+
+// Integral accumulates the trapezoidal integral of a signal over time, in
+// signal units times seconds. Intervals longer than maxGap are skipped rather
+// than bridged, so a disconnect does not invent volume; zero maxGap bridges
+// any interval.
+type Integral struct {
+	acc     accum.Accumulator
+	maxGap  time.Duration
+	started bool
+	lastT   time.Time
+	lastV   float64
+}
+
+func New(mode accum.Mode, places int, maxGap time.Duration) *Integral {
+	return &Integral{acc: accum.New(mode, places), maxGap: maxGap}
+}
+
+// Add records a sample and returns the running total.
+func (i *Integral) Add(t time.Time, v float64) float64 {
+	if i.started && t.After(i.lastT) {
+		dt := t.Sub(i.lastT)
+		if i.maxGap <= 0 || dt <= i.maxGap {
+			i.acc.Add((i.lastV + v) / 2 * dt.Seconds())
+		}
+	}
+	if !i.started || t.After(i.lastT) {
+		i.started, i.lastT, i.lastV = true, t, v
+	}
+	return i.acc.Value()
+}
+
+func (i *Integral) Total() float64 {
+	return i.acc.Value()
+}
+
+// Reset zeroes the total and forgets the last sample, e.g. at a session start.
+func (i *Integral) Reset() {
+	i.acc.Reset()
+	i.started = false
+}
@@ -0,0 +1,153 @@
+package integrity
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	HashSuffix = ".sha256" // sha256sum-compatible sidecar
+	SigSuffix  = ".sig"    // base64 ed25519 signature of the raw digest
+)
+
+var (
+	ErrMismatch     = errors.New("hash mismatch")
+	ErrBadSignature = errors.New("bad signature")
+	ErrUnsigned     = errors.New("no signature")
+)
+
+// Hash returns the SHA-256 digest of the file at path.
+func Hash(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+	return h.Sum(nil), nil
+}
+
+// Seal hashes a closed file and writes the digest next to it in sha256sum
+// format, so "sha256sum -c" works without this tool. With a key it also
+// writes a detached signature of the digest. It returns the hex digest.
+func Seal(path string, key ed25519.PrivateKey) (string, error) {
+	sum, err := Hash(path)
+	if err != nil {
+		return "", err
+	}
+	digest := hex.EncodeToString(sum)
+	line := fmt.Sprintf("%s  %s\n", digest, filepath.Base(path))
+	if err := os.WriteFile(path+HashSuffix, []byte(line), 0o644); err != nil {
+		return "", fmt.Errorf("failed to write hash: %w", err)
+	}
+	if key != nil {
+		sig := base64.StdEncoding.EncodeToString(ed25519.Sign(key, sum))
+		if err := os.WriteFile(path+SigSuffix, []byte(sig+"\n"), 0o644); err != nil {
+			return "", fmt.Errorf("failed to write signature: %w", err)
+		}
+	}
+	return digest, nil
+}
+
+// Verify rehashes path and checks it against its sidecar. If pub is non-nil
+// the signature must also be present and valid.
+func Verify(path string, pub ed25519.PublicKey) error {
+	sidecar, err := os.ReadFile(path + HashSuffix)
+	if err != nil {
+		return fmt.Errorf("failed to read hash: %w", err)
+	}
+	fields := strings.Fields(string(sidecar))
+	if len(fields) == 0 {
+		return fmt.Errorf("%s%s is empty", path, HashSuffix)
+	}
+	want, err := hex.DecodeString(fields[0])
+	if err != nil || len(want) != sha256.Size {
+		return fmt.Errorf("%s%s does not hold a SHA-256 digest", path, HashSuffix)
+	}
+
+	got, err := Hash(path)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(got, want) {
+		return ErrMismatch
+	}
+	if pub == nil {
+		return nil
+	}
+
+	raw, err := os.ReadFile(path + SigSuffix)
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrUnsigned
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read signature: %w", err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(raw)))
+	if err != nil || !ed25519.Verify(pub, got, sig) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// LoadPrivateKey reads a PKCS#8 PEM ed25519 key, as written by
+// "openssl genpkey -algorithm ed25519".
+func LoadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	der, err := readPEM(path, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+	k, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	key, ok := k.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an ed25519 key", path)
+	}
+	return key, nil
+}
+
+// LoadPublicKey reads a PKIX PEM ed25519 public key, as written by
+// "openssl pkey -pubout".
+func LoadPublicKey(path string) (ed25519.PublicKey, error) {
+	der, err := readPEM(path, "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+	k, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	key, ok := k.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an ed25519 key", path)
+	}
+	return key, nil
+}
+
+func readPEM(path, blockType string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != blockType {
+		return nil, fmt.Errorf("%s has no %s PEM block", path, blockType)
+	}
+	return block.Bytes, nil
+}
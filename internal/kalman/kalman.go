@@ -0,0 +1,196 @@
+package kalman
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/demelere/sensor-control-modules/internal/metabolic"
+)
+
+var (
+	kalmanProcessNoise     float64
+	kalmanGasNoiseStdDev   float64
+	kalmanHRNoiseStdDev    float64
+	kalmanInitialStdDev    float64
+	kalmanConfidenceZScore float64
+)
+
+func init() {
+	kalmanProcessNoise = 0.05 // (kcal/min)^2 per s^3, how fast metabolic rate is allowed to change
+	kalmanGasNoiseStdDev = 0.4
+	kalmanHRNoiseStdDev = 1.2
+	kalmanInitialStdDev = 5
+	kalmanConfidenceZScore = 1.96
+}
+
+// Filter is a two-state (level, rate of change) constant-velocity Kalman
+// filter over a single scalar quantity observed by several noisy sources.
+type Filter struct {
+	x    [2]float64
+	p    [2][2]float64
+	q    float64
+	last time.Time
+	init bool
+}
+
+func NewFilter(processNoise, initialStdDev float64) *Filter {
+	v := initialStdDev * initialStdDev
+	return &Filter{q: processNoise, p: [2][2]float64{{v, 0}, {0, v}}}
+}
+
+func (f *Filter) predict(t time.Time) {
+	if f.last.IsZero() || !t.After(f.last) {
+		if f.last.IsZero() {
+			f.last = t
+		}
+		return
+	}
+	dt := t.Sub(f.last).Seconds()
+	f.last = t
+
+	f.x[0] += dt * f.x[1]
+
+	p := f.p
+	p00 := p[0][0] + dt*(p[1][0]+p[0][1]) + dt*dt*p[1][1]
+	p01 := p[0][1] + dt*p[1][1]
+	p10 := p[1][0] + dt*p[1][1]
+	p11 := p[1][1]
+
+	dt2, dt3 := dt*dt, dt*dt*dt
+	f.p = [2][2]float64{
+		{p00 + f.q*dt3/3, p01 + f.q*dt2/2},
+		{p10 + f.q*dt2/2, p11 + f.q*dt},
+	}
+}
+
+// Update advances the filter to t and folds in measurement z with the given
+// standard deviation.
+func (f *Filter) Update(t time.Time, z, stdDev float64) {
+	if !f.init { // seed the level with the first observation instead of converging from zero
+		f.x[0] = z
+		f.last = t
+		f.init = true
+		return
+	}
+
+	f.predict(t)
+
+	r := stdDev * stdDev
+	s := f.p[0][0] + r
+	k0, k1 := f.p[0][0]/s, f.p[1][0]/s
+	y := z - f.x[0]
+
+	f.x[0] += k0 * y
+	f.x[1] += k1 * y
+
+	p := f.p
+	f.p = [2][2]float64{
+		{(1 - k0) * p[0][0], (1 - k0) * p[0][1]},
+		{p[1][0] - k1*p[0][0], p[1][1] - k1*p[0][1]},
+	}
+}
+
+func (f *Filter) Value() float64 {
+	return f.x[0]
+}
+
+func (f *Filter) StdDev() float64 {
+	return math.Sqrt(math.Max(f.p[0][0], 0))
+}
+
+// HRCalibration maps heart rate to energy expenditure with a linear model,
+// ideally fitted per subject from a short calibration stage.
+type HRCalibration struct {
+	RestHR     float64 // bpm
+	RestEE     float64 // kcal/min
+	KcalPerBPM float64 // kcal/min per bpm above rest
+}
+
+func DefaultHRCalibration() HRCalibration {
+	return HRCalibration{RestHR: 60, RestEE: 1.2, KcalPerBPM: 0.1}
+}
+
+// Estimate is the fused metabolic rate with a 95% confidence interval.
+type Estimate struct {
+	Time    time.Time
+	EE      float64 // kcal/min
+	StdDev  float64
+	Lower   float64
+	Upper   float64
+	Rate    float64 // kcal/min per s
+	Settled bool    // false until both gas exchange and HR have contributed
+}
+
+// MetabolicEstimator fuses gas-exchange measurements (flow + CO2) and heart
+// rate into a smoothed energy expenditure estimate. Gas exchange is accurate
+// but slow and noisy breath-to-breath; HR responds quickly but needs a
+// per-subject calibration, so it is trusted less.
+type MetabolicEstimator struct {
+	lock    sync.Mutex
+	filter  *Filter
+	hrCal   HRCalibration
+	rq      float64
+	lastCO2 float64
+	haveGas bool
+	haveHR  bool
+	last    time.Time
+}
+
+func NewMetabolicEstimator(hrCal HRCalibration, rq float64) *MetabolicEstimator {
+	return &MetabolicEstimator{
+		filter: NewFilter(kalmanProcessNoise, kalmanInitialStdDev),
+		hrCal:  hrCal,
+		rq:     rq,
+	}
+}
+
+// UpdateCO2 stores the latest expired CO2 concentration; it is combined with
+// the next flow reading since the two sensors are polled independently.
+func (me *MetabolicEstimator) UpdateCO2(t time.Time, co2PPM float64) {
+	me.lock.Lock()
+	defer me.lock.Unlock()
+	me.lastCO2 = co2PPM
+}
+
+func (me *MetabolicEstimator) UpdateFlow(t time.Time, flowSCFM float64) {
+	me.lock.Lock()
+	defer me.lock.Unlock()
+
+	if me.lastCO2 == 0 {
+		return
+	}
+	vco2 := metabolic.VCO2(metabolic.VE(flowSCFM), me.lastCO2)
+	me.filter.Update(t, metabolic.EnergyExpenditure(vco2, me.rq), kalmanGasNoiseStdDev)
+	me.haveGas = true
+	me.last = t
+}
+
+func (me *MetabolicEstimator) UpdateHeartRate(t time.Time, hr float64) {
+	me.lock.Lock()
+	defer me.lock.Unlock()
+
+	if hr <= 0 {
+		return
+	}
+	ee := me.hrCal.RestEE + me.hrCal.KcalPerBPM*(hr-me.hrCal.RestHR)
+	me.filter.Update(t, math.Max(ee, 0), kalmanHRNoiseStdDev)
+	me.haveHR = true
+	me.last = t
+}
+
+func (me *MetabolicEstimator) Estimate() Estimate {
+	me.lock.Lock()
+	defer me.lock.Unlock()
+
+	v, sd := me.filter.Value(), me.filter.StdDev()
+	return Estimate{
+		Time:    me.last,
+		EE:      v,
+		StdDev:  sd,
+		Lower:   v - kalmanConfidenceZScore*sd,
+		Upper:   v + kalmanConfidenceZScore*sd,
+		Rate:    me.filter.x[1],
+		Settled: me.haveGas && me.haveHR,
+	}
+}
@@ -0,0 +1,150 @@
+package label
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/demelere/sensor-control-modules/internal/filter"
+)
+
+// Condition compares the latest value of Metric against Value. Once it
+// holds, it keeps holding until the value has moved back past Value by
+// Hysteresis, so a metric hovering at the threshold doesn't chatter.
+type Condition struct {
+	Metric     string
+	Op         string // >, >=, <, <=
+	Value      float64
+	Hysteresis float64
+}
+
+func (c Condition) trigger() *filter.Hysteresis {
+	return &filter.Hysteresis{
+		Threshold: c.Value,
+		Band:      c.Hysteresis,
+		Above:     c.Op == ">" || c.Op == ">=",
+		Inclusive: c.Op == ">=" || c.Op == "<=",
+	}
+}
+
+func (c Condition) valid() bool {
+	switch c.Op {
+	case ">", ">=", "<", "<=":
+		return true
+	}
+	return false
+}
+
+// Rule tags a time range with Name while all of its conditions hold. Ranges
+// shorter than MinDuration are discarded.
+type Rule struct {
+	Name        string
+	Conditions  []Condition
+	MinDuration time.Duration
+}
+
+// Label is one tagged time range.
+type Label struct {
+	Name     string        `json:"label"`
+	Start    time.Time     `json:"start"`
+	End      time.Time     `json:"end"`
+	Duration time.Duration `json:"-"`
+}
+
+type ruleState struct {
+	rule     Rule
+	triggers []*filter.Hysteresis // one per condition
+	active   bool
+	since    time.Time
+}
+
+// Labeler evaluates rules against a stream of metric values. It is not safe
+// for concurrent use; callers serialise Observe the same way they serialise
+// output.
+type Labeler struct {
+	rules  []*ruleState
+	latest map[string]float64
+}
+
+func NewLabeler(rules []Rule) (*Labeler, error) {
+	l := &Labeler{latest: make(map[string]float64)}
+	for i, r := range rules {
+		if r.Name == "" {
+			return nil, fmt.Errorf("label rule %d has no name", i)
+		}
+		if len(r.Conditions) == 0 {
+			return nil, fmt.Errorf("label rule %s has no conditions", r.Name)
+		}
+		for _, c := range r.Conditions {
+			if !c.valid() {
+				return nil, fmt.Errorf("label rule %s: unknown operator %q", r.Name, c.Op)
+			}
+		}
+		rs := &ruleState{rule: r}
+		for _, c := range r.Conditions {
+			rs.triggers = append(rs.triggers, c.trigger())
+		}
+		l.rules = append(l.rules, rs)
+	}
+	return l, nil
+}
+
+// Observe records the latest value of metric at t and returns any labels whose
+// range closed as a result.
+func (l *Labeler) Observe(t time.Time, metric string, v float64) []Label {
+	l.latest[metric] = v
+
+	var closed []Label
+	for _, rs := range l.rules {
+		match := l.matches(rs)
+		switch {
+		case match && !rs.active:
+			rs.active, rs.since = true, t
+		case !match && rs.active:
+			rs.active = false
+			if lbl, ok := rs.close(t); ok {
+				closed = append(closed, lbl)
+			}
+		}
+	}
+	return closed
+}
+
+// Flush closes every open range at t, e.g. when the session ends.
+func (l *Labeler) Flush(t time.Time) []Label {
+	var closed []Label
+	for _, rs := range l.rules {
+		if rs.active {
+			rs.active = false
+			if lbl, ok := rs.close(t); ok {
+				closed = append(closed, lbl)
+			}
+		}
+	}
+	return closed
+}
+
+// matches updates every condition's trigger from the latest values; all of
+// them are updated even after one fails so their hysteresis state stays true
+// to the signal.
+func (l *Labeler) matches(rs *ruleState) bool {
+	match := true
+	for i, c := range rs.rule.Conditions {
+		v, ok := l.latest[c.Metric]
+		if !ok {
+			match = false
+			continue
+		}
+		if !rs.triggers[i].Update(v) {
+			match = false
+		}
+	}
+	return match
+}
+
+func (rs *ruleState) close(t time.Time) (Label, bool) {
+	d := t.Sub(rs.since)
+	if d < rs.rule.MinDuration {
+		return Label{}, false
+	}
+	return Label{Name: rs.rule.Name, Start: rs.since, End: t, Duration: d}, true
+}
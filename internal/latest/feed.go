@@ -0,0 +1,62 @@
+package latest
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Feed hands every value to live subscribers, e.g. API streams. A subscriber
+// that falls behind loses values rather than holding up acquisition. The zero
+// Feed is ready to use.
+type Feed struct {
+	lock sync.Mutex
+	subs map[*Subscription]struct{}
+}
+
+// Subscription is one reader of a Feed.
+type Subscription struct {
+	C       <-chan Value
+	ch      chan Value
+	dropped atomic.Int64
+}
+
+// Dropped is how many values were lost because the subscriber was too slow.
+func (s *Subscription) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// Subscribe returns a subscription with room for buffer values, receiving
+// until it is passed to Unsubscribe.
+func (f *Feed) Subscribe(buffer int) *Subscription {
+	ch := make(chan Value, max(buffer, 1))
+	sub := &Subscription{C: ch, ch: ch}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.subs == nil {
+		f.subs = map[*Subscription]struct{}{}
+	}
+	f.subs[sub] = struct{}{}
+	return sub
+}
+
+// Unsubscribe stops sub and closes its channel.
+func (f *Feed) Unsubscribe(sub *Subscription) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if _, ok := f.subs[sub]; ok {
+		delete(f.subs, sub)
+		close(sub.ch)
+	}
+}
+
+func (f *Feed) Publish(v Value) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for sub := range f.subs {
+		select {
+		case sub.ch <- v:
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package latest
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Value struct {
+	Sensor string    `json:"sensor"`
+	Metric string    `json:"metric"`
+	Value  float64   `json:"value"`
+	Unit   string    `json:"unit"`
+	Time   time.Time `json:"time"`
+}
+
+// Cache holds the most recent value of each metric. Each metric's slot is an
+// atomic pointer created once, so after the first value readers and the
+// writer never take a lock and API requests cannot hold up acquisition.
+type Cache struct {
+	slots sync.Map // metric -> *atomic.Pointer[Value]
+}
+
+func (c *Cache) Store(v Value) {
+	slot, ok := c.slots.Load(v.Metric)
+	if !ok {
+		slot, _ = c.slots.LoadOrStore(v.Metric, new(atomic.Pointer[Value]))
+	}
+	slot.(*atomic.Pointer[Value]).Store(&v)
+}
+
+func (c *Cache) Load(metric string) (Value, bool) {
+	slot, ok := c.slots.Load(metric)
+	if !ok {
+		return Value{}, false
+	}
+	v := slot.(*atomic.Pointer[Value]).Load()
+	if v == nil {
+		return Value{}, false
+	}
+	return *v, true
+}
+
+// All returns every cached value sorted by metric name.
+func (c *Cache) All() []Value {
+	var out []Value
+	c.slots.Range(func(_, slot any) bool {
+		if v := slot.(*atomic.Pointer[Value]).Load(); v != nil {
+			out = append(out, *v)
+		}
+		return true
+	})
+	sort.Slice(out, func(i, j int) bool { return out[i].Metric < out[j].Metric })
+	return out
+}
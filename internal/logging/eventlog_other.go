@@ -0,0 +1,16 @@
+//go:build !windows
+
+package logging
+
+import "errors"
+
+type EventLogSink struct{}
+
+func EventLogAvailable() bool { return false }
+
+func NewEventLogSink(source string) (*EventLogSink, error) {
+	return nil, errors.New("the event log is only available on Windows")
+}
+
+func (es *EventLogSink) Write(e Entry) error { return nil }
+func (es *EventLogSink) Close() error        { return nil }
@@ -0,0 +1,52 @@
+package logging
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/sys/windows/svc/eventlog"
+)
+
+// EventLogSink writes entries to the Windows Application event log, under
+// the source sensorctl service install registers.
+type EventLogSink struct {
+	log *eventlog.Log
+}
+
+// EventLogAvailable reports whether there is an event log to write to.
+func EventLogAvailable() bool { return true }
+
+func NewEventLogSink(source string) (*EventLogSink, error) {
+	l, err := eventlog.Open(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the event log: %w", err)
+	}
+	return &EventLogSink{log: l}, nil
+}
+
+// Write reports e as event 1, whose message, from EventCreate.exe, is the
+// text itself. Fields follow the message as key="value".
+func (es *EventLogSink) Write(e Entry) error {
+	var b strings.Builder
+	b.WriteString(e.Message)
+	keys := make([]string, 0, len(e.Fields))
+	for k := range e.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&b, " %s=%q", k, e.Fields[k])
+	}
+	switch e.Level {
+	case LevelError:
+		return es.log.Error(1, b.String())
+	case LevelWarn:
+		return es.log.Warning(1, b.String())
+	}
+	return es.log.Info(1, b.String())
+}
+
+func (es *EventLogSink) Close() error {
+	return es.log.Close()
+}
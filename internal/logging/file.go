@@ -0,0 +1,71 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// FileSink appends to path and rotates it to path.1 ... path.N once it grows
+// past maxBytes, for rigs started from rc scripts without a journal.
+type FileSink struct {
+	path       string
+	maxBytes   int64
+	maxBackups int
+	f          *os.File
+	size       int64
+}
+
+func NewFileSink(path string, maxBytes int64, maxBackups int) (*FileSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+	fs := &FileSink{path: path, maxBytes: maxBytes, maxBackups: maxBackups}
+	if err := fs.open(); err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+func (fs *FileSink) open() error {
+	f, err := os.OpenFile(fs.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to stat log file: %w", err)
+	}
+	fs.f, fs.size = f, info.Size()
+	return nil
+}
+
+func (fs *FileSink) rotate() error {
+	fs.f.Close()
+	for i := fs.maxBackups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", fs.path, i), fmt.Sprintf("%s.%d", fs.path, i+1))
+	}
+	if fs.maxBackups > 0 {
+		os.Rename(fs.path, fs.path+".1")
+	} else {
+		os.Remove(fs.path)
+	}
+	return fs.open()
+}
+
+func (fs *FileSink) Write(e Entry) error {
+	line := formatLine(e)
+	if fs.maxBytes > 0 && fs.size+int64(len(line)) > fs.maxBytes {
+		if err := fs.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := fs.f.WriteString(line)
+	fs.size += int64(n)
+	return err
+}
+
+func (fs *FileSink) Close() error {
+	return fs.f.Close()
+}
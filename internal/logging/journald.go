@@ -0,0 +1,86 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var (
+	journaldSocket     string
+	journaldFieldRegex *regexp.Regexp
+)
+
+func init() {
+	journaldSocket = "/run/systemd/journal/socket"
+	journaldFieldRegex = regexp.MustCompile(`[^A-Z0-9_]`)
+}
+
+// JournaldSink writes entries with the journal's native protocol so fields
+// such as the sensor name stay queryable (journalctl SENSOR=co2).
+type JournaldSink struct {
+	conn       *net.UnixConn
+	identifier string
+}
+
+// JournaldAvailable reports whether a journal socket is present.
+func JournaldAvailable() bool {
+	_, err := os.Stat(journaldSocket)
+	return err == nil
+}
+
+func NewJournaldSink(identifier string) (*JournaldSink, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journaldSocket, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to journald: %w", err)
+	}
+	return &JournaldSink{conn: conn, identifier: identifier}, nil
+}
+
+func journaldPriority(l Level) int {
+	switch l {
+	case LevelDebug:
+		return 7
+	case LevelWarn:
+		return 4
+	case LevelError:
+		return 3
+	}
+	return 6
+}
+
+func writeJournaldField(b *bytes.Buffer, key, value string) {
+	if !strings.Contains(value, "\n") {
+		fmt.Fprintf(b, "%s=%s\n", key, value)
+		return
+	}
+	b.WriteString(key)
+	b.WriteByte('\n')
+	binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value)
+	b.WriteByte('\n')
+}
+
+func (js *JournaldSink) Write(e Entry) error {
+	var b bytes.Buffer
+	writeJournaldField(&b, "MESSAGE", e.Message)
+	writeJournaldField(&b, "PRIORITY", fmt.Sprint(journaldPriority(e.Level)))
+	writeJournaldField(&b, "SYSLOG_IDENTIFIER", js.identifier)
+	for k, v := range e.Fields {
+		key := journaldFieldRegex.ReplaceAllString(strings.ToUpper(k), "_")
+		if key == "" || key[0] == '_' {
+			key = "F" + key // journald reserves leading underscores for trusted fields
+		}
+		writeJournaldField(&b, key, v)
+	}
+	_, err := js.conn.Write(b.Bytes())
+	return err
+}
+
+func (js *JournaldSink) Close() error {
+	return js.conn.Close()
+}
@@ -0,0 +1,197 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+	return "unknown"
+}
+
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return LevelDebug, nil
+	case "info", "":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q", s)
+}
+
+type Entry struct {
+	Time    time.Time
+	Level   Level
+	Message string
+	Fields  map[string]string
+}
+
+type Sink interface {
+	Write(e Entry) error
+	Close() error
+}
+
+type sinkEntry struct {
+	sink Sink
+	min  Level
+}
+
+// Logger fans each entry out to every sink whose minimum level it meets.
+type Logger struct {
+	lock   sync.Mutex
+	sinks  []sinkEntry
+	fields map[string]string
+	parent *Logger
+}
+
+func New() *Logger {
+	return &Logger{}
+}
+
+// AddSink attaches s, which only receives entries at min or above.
+func (l *Logger) AddSink(s Sink, min Level) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.sinks = append(l.sinks, sinkEntry{sink: s, min: min})
+}
+
+// With returns a logger that adds fields to every entry, e.g. the sensor name.
+func (l *Logger) With(fields map[string]string) *Logger {
+	merged := make(map[string]string, len(l.fields)+len(fields))
+	for k, v := range l.fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	root := l
+	if l.parent != nil {
+		root = l.parent
+	}
+	return &Logger{fields: merged, parent: root}
+}
+
+func (l *Logger) root() *Logger {
+	if l.parent != nil {
+		return l.parent
+	}
+	return l
+}
+
+func (l *Logger) Log(level Level, msg string) {
+	e := Entry{Time: time.Now(), Level: level, Message: msg, Fields: l.fields}
+	r := l.root()
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, se := range r.sinks {
+		if level >= se.min {
+			if err := se.sink.Write(e); err != nil {
+				fmt.Fprintf(os.Stderr, "log sink error: %v\n", err)
+			}
+		}
+	}
+}
+
+func (l *Logger) Debugf(format string, args ...any) { l.Log(LevelDebug, fmt.Sprintf(format, args...)) }
+func (l *Logger) Infof(format string, args ...any)  { l.Log(LevelInfo, fmt.Sprintf(format, args...)) }
+func (l *Logger) Warnf(format string, args ...any)  { l.Log(LevelWarn, fmt.Sprintf(format, args...)) }
+func (l *Logger) Errorf(format string, args ...any) { l.Log(LevelError, fmt.Sprintf(format, args...)) }
+
+func (l *Logger) Close() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	var first error
+	for _, se := range l.sinks {
+		if err := se.sink.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	l.sinks = nil
+	return first
+}
+
+// stdWriter adapts the standard library logger, which every driver uses, onto
+// a Logger. Lines starting with "failed" or "error" are logged as errors,
+// everything else as info.
+type stdWriter struct {
+	l *Logger
+}
+
+func (w stdWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimRight(string(p), "\n")
+	level := LevelInfo
+	lower := strings.ToLower(msg)
+	if strings.HasPrefix(lower, "failed") || strings.HasPrefix(lower, "error") {
+		level = LevelError
+	}
+	w.l.Log(level, msg)
+	return len(p), nil
+}
+
+// CaptureStdLog routes the standard library logger into l.
+func CaptureStdLog(l *Logger) {
+	log.SetFlags(0)
+	log.SetOutput(stdWriter{l: l})
+}
+
+// WriterSink writes human-readable lines, e.g. to stderr.
+type WriterSink struct {
+	w io.Writer
+}
+
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+func (ws *WriterSink) Write(e Entry) error {
+	_, err := io.WriteString(ws.w, formatLine(e))
+	return err
+}
+
+func (ws *WriterSink) Close() error {
+	return nil
+}
+
+func formatLine(e Entry) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %-5s %s", e.Time.Format(time.RFC3339Nano), e.Level, e.Message)
+	keys := make([]string, 0, len(e.Fields))
+	for k := range e.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&b, " %s=%q", k, e.Fields[k])
+	}
+	b.WriteByte('\n')
+	return b.String()
+}
@@ -0,0 +1,79 @@
+package logging
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Stream is a sink that hands entries to live subscribers, e.g. operators
+// watching over the API. A subscriber that falls behind loses entries rather
+// than slowing the logger down.
+type Stream struct {
+	lock sync.Mutex
+	subs map[*Subscription]struct{}
+}
+
+// Subscription is one reader of a Stream.
+type Subscription struct {
+	C       <-chan Entry
+	ch      chan Entry
+	min     Level
+	dropped atomic.Int64
+}
+
+// Dropped is how many entries were lost because the subscriber was too slow.
+func (s *Subscription) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+func NewStream() *Stream {
+	return &Stream{subs: map[*Subscription]struct{}{}}
+}
+
+// Subscribe returns a subscription receiving entries at min or above, with
+// room for buffer of them, until it is passed to Unsubscribe.
+func (s *Stream) Subscribe(min Level, buffer int) *Subscription {
+	ch := make(chan Entry, max(buffer, 1))
+	sub := &Subscription{C: ch, ch: ch, min: min}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.subs[sub] = struct{}{}
+	return sub
+}
+
+// Unsubscribe stops sub and closes its channel.
+func (s *Stream) Unsubscribe(sub *Subscription) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.subs[sub]; ok {
+		delete(s.subs, sub)
+		close(sub.ch)
+	}
+}
+
+func (s *Stream) Write(e Entry) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for sub := range s.subs {
+		if e.Level < sub.min {
+			continue
+		}
+		select {
+		case sub.ch <- e:
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+	return nil
+}
+
+// Close ends every subscription.
+func (s *Stream) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for sub := range s.subs {
+		delete(s.subs, sub)
+		close(sub.ch)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package membudget
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	lock     sync.Mutex
+	limit    int64 // 0 means unlimited
+	reserved int64
+	accounts = map[*Account]struct{}{}
+)
+
+// SetLimit caps the total bytes buffers may reserve. Components created
+// afterwards are sized to fit; existing reservations are not shrunk.
+func SetLimit(bytes int64) {
+	lock.Lock()
+	defer lock.Unlock()
+	limit = bytes
+}
+
+func Limit() int64 {
+	lock.Lock()
+	defer lock.Unlock()
+	return limit
+}
+
+// Account is one component's share of the memory budget.
+type Account struct {
+	name    string
+	granted int64
+	used    func() int64
+}
+
+// Reserve asks for want bytes for name. The grant is reduced to what is left
+// of the budget but never below floor, so every component can still run,
+// just with a shorter history.
+func Reserve(name string, want, floor int64) *Account {
+	lock.Lock()
+	defer lock.Unlock()
+
+	granted := want
+	if limit > 0 {
+		granted = min(want, max(limit-reserved, 0))
+	}
+	granted = max(granted, floor)
+	reserved += granted
+
+	a := &Account{name: name, granted: granted}
+	accounts[a] = struct{}{}
+	return a
+}
+
+func (a *Account) Granted() int64 {
+	return a.granted
+}
+
+// ReportUsage registers how the component measures its current usage.
+func (a *Account) ReportUsage(fn func() int64) {
+	lock.Lock()
+	defer lock.Unlock()
+	a.used = fn
+}
+
+func (a *Account) Release() {
+	lock.Lock()
+	defer lock.Unlock()
+	if _, ok := accounts[a]; ok {
+		delete(accounts, a)
+		reserved -= a.granted
+	}
+}
+
+type AccountUsage struct {
+	Name     string `json:"name"`
+	Reserved int64  `json:"reserved_bytes"`
+	Used     int64  `json:"used_bytes"`
+}
+
+type Report struct {
+	Limit    int64          `json:"limit_bytes"`
+	Reserved int64          `json:"reserved_bytes"`
+	Used     int64          `json:"used_bytes"`
+	Accounts []AccountUsage `json:"accounts"`
+}
+
+// Snapshot reports every live reservation and its current usage.
+func Snapshot() Report {
+	lock.Lock()
+	list := make([]*Account, 0, len(accounts))
+	for a := range accounts {
+		list = append(list, a)
+	}
+	r := Report{Limit: limit, Reserved: reserved}
+	lock.Unlock()
+
+	for _, a := range list {
+		u := AccountUsage{Name: a.name, Reserved: a.granted}
+		if a.used != nil {
+			u.Used = a.used()
+		}
+		r.Used += u.Used
+		r.Accounts = append(r.Accounts, u)
+	}
+	sort.Slice(r.Accounts, func(i, j int) bool { return r.Accounts[i].Name < r.Accounts[j].Name })
+	return r
+}
+
+// ParseSize parses sizes like "512KiB", "32MiB", "1GB" or a plain byte count.
+func ParseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	mult := int64(1)
+	for _, u := range []struct {
+		suffix string
+		mult   int64
+	}{
+		{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30},
+		{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9},
+		{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30},
+		{"B", 1},
+	} {
+		if strings.HasSuffix(s, u.suffix) {
+			s, mult = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.mult
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * mult, nil
+}
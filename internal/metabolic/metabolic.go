@@ -0,0 +1,66 @@
+package metabolic
+
+import (
+	"github.com/demelere/sensor-control-modules/internal/uncertainty"
+)
+
+var (
+	metabolicLitersPerCubicFoot float64
+	metabolicAmbientCO2PPM      float64
+	metabolicDefaultRQ          float64
+)
+
+func init() {
+	metabolicLitersPerCubicFoot = 28.3168
+	metabolicAmbientCO2PPM = 400
+	metabolicDefaultRQ = 0.85
+}
+
+// VE converts a Kurz flow reading (standard cubic feet per minute) to minute
+// ventilation in litres per minute.
+func VE(flowSCFM float64) float64 {
+	return flowSCFM * metabolicLitersPerCubicFoot
+}
+
+// VCO2 returns CO2 output in litres per minute from minute ventilation and the
+// mixed expired CO2 concentration, assuming ambient inspired air.
+func VCO2(veLPM, expiredCO2PPM float64) float64 {
+	fe := (expiredCO2PPM - metabolicAmbientCO2PPM) / 1e6
+	if fe < 0 {
+		fe = 0
+	}
+	return veLPM * fe
+}
+
+// EnergyExpenditure returns energy expenditure in kcal/min from CO2 output
+// using the abbreviated Weir equation, with VO2 inferred from an assumed
+// respiratory quotient.
+func EnergyExpenditure(vco2LPM, rq float64) float64 {
+	if rq <= 0 {
+		rq = metabolicDefaultRQ
+	}
+	vo2 := vco2LPM / rq
+	return 3.941*vo2 + 1.106*vco2LPM
+}
+
+// The *Uncertain variants mirror the functions above but carry measurement
+// uncertainty through the calculation.
+
+func VEUncertain(flowSCFM uncertainty.Quantity) uncertainty.Quantity {
+	return flowSCFM.Scale(metabolicLitersPerCubicFoot)
+}
+
+func VCO2Uncertain(veLPM, expiredCO2PPM uncertainty.Quantity) uncertainty.Quantity {
+	fe := expiredCO2PPM.Offset(-metabolicAmbientCO2PPM).Scale(1e-6)
+	if fe.Value < 0 {
+		fe.Value = 0
+	}
+	return uncertainty.Mul(veLPM, fe)
+}
+
+func EnergyExpenditureUncertain(vco2LPM uncertainty.Quantity, rq float64) uncertainty.Quantity {
+	if rq <= 0 {
+		rq = metabolicDefaultRQ
+	}
+	return vco2LPM.Scale(3.941/rq + 1.106) // VO2 is derived from VCO2, so the terms are fully correlated
+}
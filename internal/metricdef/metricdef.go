@@ -0,0 +1,143 @@
+package metricdef
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/demelere/sensor-control-modules/internal/units"
+)
+
+// Definition describes a metric for UI consumers so dashboards can label,
+// format, and scale it without hard-coding sensor knowledge.
+type Definition struct {
+	Name         string            `json:"name"`
+	Unit         units.Unit        `json:"unit"`
+	Precision    int               `json:"display_precision"` // decimal places
+	ChartMin     float64           `json:"chart_min"`
+	ChartMax     float64           `json:"chart_max"`
+	Labels       map[string]string `json:"labels"`       // locale -> short label
+	Descriptions map[string]string `json:"descriptions"` // locale -> one-line description
+}
+
+const DefaultLocale = "en"
+
+var definitions = map[string]Definition{
+	"co2": {
+		Name: "co2", Unit: units.PPM, Precision: 0, ChartMin: 0, ChartMax: 50000,
+		Labels:       map[string]string{"en": "CO2", "de": "CO2", "fr": "CO2", "es": "CO2"},
+		Descriptions: map[string]string{"en": "Expired CO2 concentration", "de": "CO2-Konzentration der Ausatemluft", "fr": "Concentration de CO2 expiré", "es": "Concentración de CO2 espirado"},
+	},
+	"flow": {
+		Name: "flow", Unit: units.SCFM, Precision: 2, ChartMin: 0, ChartMax: 10,
+		Labels:       map[string]string{"en": "Flow", "de": "Durchfluss", "fr": "Débit", "es": "Caudal"},
+		Descriptions: map[string]string{"en": "Gas flow rate at standard conditions", "de": "Gasdurchfluss bei Normbedingungen", "fr": "Débit de gaz aux conditions standard", "es": "Caudal de gas en condiciones estándar"},
+	},
+	"heart_rate": {
+		Name: "heart_rate", Unit: units.BPM, Precision: 0, ChartMin: 40, ChartMax: 200,
+		Labels:       map[string]string{"en": "Heart rate", "de": "Herzfrequenz", "fr": "Fréquence cardiaque", "es": "Frecuencia cardíaca"},
+		Descriptions: map[string]string{"en": "Heart rate from the chest strap", "de": "Herzfrequenz vom Brustgurt", "fr": "Fréquence cardiaque de la ceinture thoracique", "es": "Frecuencia cardíaca de la banda pectoral"},
+	},
+	"rr_interval": {
+		Name: "rr_interval", Unit: units.Millis, Precision: 0, ChartMin: 300, ChartMax: 1500,
+		Labels:       map[string]string{"en": "RR interval", "de": "RR-Intervall", "fr": "Intervalle RR", "es": "Intervalo RR"},
+		Descriptions: map[string]string{"en": "Time between successive heartbeats", "de": "Zeit zwischen aufeinanderfolgenden Herzschlägen", "fr": "Temps entre deux battements successifs", "es": "Tiempo entre latidos sucesivos"},
+	},
+	"temperature": {
+		Name: "temperature", Unit: units.Celsius, Precision: 1, ChartMin: 0, ChartMax: 40,
+		Labels:       map[string]string{"en": "Temperature", "de": "Temperatur", "fr": "Température", "es": "Temperatura"},
+		Descriptions: map[string]string{"en": "Gas temperature at the CO2 probe", "de": "Gastemperatur an der CO2-Sonde", "fr": "Température du gaz à la sonde CO2", "es": "Temperatura del gas en la sonda de CO2"},
+	},
+	"humidity": {
+		Name: "humidity", Unit: units.Percent, Precision: 1, ChartMin: 0, ChartMax: 100,
+		Labels:       map[string]string{"en": "Humidity", "de": "Feuchte", "fr": "Humidité", "es": "Humedad"},
+		Descriptions: map[string]string{"en": "Relative humidity at the CO2 probe", "de": "Relative Feuchte an der CO2-Sonde", "fr": "Humidité relative à la sonde CO2", "es": "Humedad relativa en la sonda de CO2"},
+	},
+	"pressure": {
+		Name: "pressure", Unit: units.HectoPascal, Precision: 0, ChartMin: 900, ChartMax: 1100,
+		Labels:       map[string]string{"en": "Pressure", "de": "Druck", "fr": "Pression", "es": "Presión"},
+		Descriptions: map[string]string{"en": "Ambient pressure at the CO2 probe", "de": "Umgebungsdruck an der CO2-Sonde", "fr": "Pression ambiante à la sonde CO2", "es": "Presión ambiente en la sonda de CO2"},
+	},
+	"ve": {
+		Name: "ve", Unit: units.SLPM, Precision: 1, ChartMin: 0, ChartMax: 200,
+		Labels:       map[string]string{"en": "VE", "de": "VE", "fr": "VE", "es": "VE"},
+		Descriptions: map[string]string{"en": "Minute ventilation", "de": "Atemminutenvolumen", "fr": "Ventilation minute", "es": "Ventilación minuto"},
+	},
+	"vco2": {
+		Name: "vco2", Unit: units.SLPM, Precision: 2, ChartMin: 0, ChartMax: 6,
+		Labels:       map[string]string{"en": "VCO2", "de": "VCO2", "fr": "VCO2", "es": "VCO2"},
+		Descriptions: map[string]string{"en": "CO2 output", "de": "CO2-Abgabe", "fr": "Production de CO2", "es": "Producción de CO2"},
+	},
+	"energy_expenditure": {
+		Name: "energy_expenditure", Unit: units.KcalPerMin, Precision: 1, ChartMin: 0, ChartMax: 30,
+		Labels:       map[string]string{"en": "Energy expenditure", "de": "Energieumsatz", "fr": "Dépense énergétique", "es": "Gasto energético"},
+		Descriptions: map[string]string{"en": "Estimated energy expenditure", "de": "Geschätzter Energieumsatz", "fr": "Dépense énergétique estimée", "es": "Gasto energético estimado"},
+	},
+	"supply_voltage": {
+		Name: "supply_voltage", Unit: units.Volt, Precision: 2, ChartMin: 3, ChartMax: 4.3,
+		Labels:       map[string]string{"en": "Supply voltage", "de": "Versorgungsspannung", "fr": "Tension d'alimentation", "es": "Tensión de alimentación"},
+		Descriptions: map[string]string{"en": "Battery or supply voltage of the rig", "de": "Batterie- oder Versorgungsspannung des Messaufbaus", "fr": "Tension de la batterie ou de l'alimentation du banc", "es": "Tensión de la batería o de la alimentación del equipo"},
+	},
+	"host_temperature": {
+		Name: "host_temperature", Unit: units.Celsius, Precision: 1, ChartMin: 20, ChartMax: 90,
+		Labels:       map[string]string{"en": "Host temperature", "de": "Rechnertemperatur", "fr": "Température de l'hôte", "es": "Temperatura del equipo"},
+		Descriptions: map[string]string{"en": "Hottest CPU or enclosure sensor on the rig's computer", "de": "Heißester CPU- oder Gehäusesensor am Rechner des Messaufbaus", "fr": "Capteur CPU ou boîtier le plus chaud de l'ordinateur du banc", "es": "Sensor de CPU o de la caja más caliente del ordenador del equipo"},
+	},
+	"battery": {
+		Name: "battery", Unit: units.Percent, Precision: 0, ChartMin: 0, ChartMax: 100,
+		Labels:       map[string]string{"en": "Battery", "de": "Akku", "fr": "Batterie", "es": "Batería"},
+		Descriptions: map[string]string{"en": "Charge left in the rig's battery", "de": "Restladung des Akkus am Messaufbau", "fr": "Charge restante de la batterie du banc", "es": "Carga restante de la batería del equipo"},
+	},
+}
+
+func Lookup(name string) (Definition, bool) {
+	d, ok := definitions[name]
+	return d, ok
+}
+
+func All() []Definition {
+	out := make([]Definition, 0, len(definitions))
+	for _, d := range definitions {
+		out = append(out, d)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Localized is a Definition resolved for one locale and the current unit
+// system, ready to render.
+type Localized struct {
+	Name        string     `json:"name"`
+	Label       string     `json:"label"`
+	Description string     `json:"description"`
+	Unit        units.Unit `json:"unit"`
+	Precision   int        `json:"display_precision"`
+	ChartMin    float64    `json:"chart_min"`
+	ChartMax    float64    `json:"chart_max"`
+	Locale      string     `json:"locale"`
+}
+
+// Localize picks the best available locale ("de-CH" falls back to "de", then
+// to DefaultLocale) and converts the chart range into the display unit.
+func (d Definition) Localize(locale string) Localized {
+	locale = strings.ToLower(locale)
+	chosen := DefaultLocale
+	for _, candidate := range []string{locale, strings.SplitN(locale, "-", 2)[0]} {
+		if _, ok := d.Labels[candidate]; ok {
+			chosen = candidate
+			break
+		}
+	}
+
+	lo, unit := units.Display(d.ChartMin, d.Unit)
+	hi, _ := units.Display(d.ChartMax, d.Unit)
+	return Localized{
+		Name:        d.Name,
+		Label:       d.Labels[chosen],
+		Description: d.Descriptions[chosen],
+		Unit:        unit,
+		Precision:   d.Precision,
+		ChartMin:    lo,
+		ChartMax:    hi,
+		Locale:      chosen,
+	}
+}
@@ -0,0 +1,276 @@
+// Package modbus is a minimal Modbus RTU master: holding and input register
+// reads, multiple register writes, and device identification, for probes on
+// an RS-485 bus where each one answers only to its own unit address.
+package modbus
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/demelere/sensor-control-modules/internal/sensorerr"
+)
+
+const (
+	fnReadHolding     = 0x03
+	fnReadInput       = 0x04
+	fnWriteMultiple   = 0x10
+	fnEncapsulated    = 0x2B
+	meiDeviceID       = 0x0E
+	maxReadRegisters  = 125
+	maxWriteRegisters = 123
+)
+
+// Exception is an error reply from the device, e.g. 2 for an address it does
+// not have.
+type Exception struct {
+	Function byte
+	Code     byte
+}
+
+func (e *Exception) Error() string {
+	msg, ok := exceptionText[e.Code]
+	if !ok {
+		msg = "unknown exception"
+	}
+	return fmt.Sprintf("modbus exception %d (%s) for function 0x%02x", e.Code, msg, e.Function)
+}
+
+var exceptionText = map[byte]string{
+	1: "illegal function",
+	2: "illegal data address",
+	3: "illegal data value",
+	4: "device failure",
+	6: "device busy",
+}
+
+// Reader is the receiving side of a port: exact-length reads under a timeout,
+// dropping the rest of a reply that timed out (Discard), and dropping
+// everything after a garbled one (Reset). serialio.LineReader is one.
+type Reader interface {
+	ReadFull(ctx context.Context, p []byte) error
+	Discard()
+	Reset()
+}
+
+// Client talks to one unit on a bus. It is not safe for concurrent use; the
+// drivers run it on their port worker.
+type Client struct {
+	w    io.Writer
+	r    Reader
+	unit byte
+}
+
+// NewClient returns a client for unit (1-247) that writes requests to w and
+// reads replies from r.
+func NewClient(w io.Writer, r Reader, unit int) (*Client, error) {
+	if unit < 1 || unit > 247 {
+		return nil, fmt.Errorf("modbus address %d out of range 1-247", unit)
+	}
+	return &Client{w: w, r: r, unit: byte(unit)}, nil
+}
+
+// ReadHoldingRegisters reads count registers starting at the 0-based addr.
+func (c *Client) ReadHoldingRegisters(ctx context.Context, addr, count uint16) ([]uint16, error) {
+	return c.readRegisters(ctx, fnReadHolding, addr, count)
+}
+
+// ReadInputRegisters reads count input registers starting at addr.
+func (c *Client) ReadInputRegisters(ctx context.Context, addr, count uint16) ([]uint16, error) {
+	return c.readRegisters(ctx, fnReadInput, addr, count)
+}
+
+func (c *Client) readRegisters(ctx context.Context, fn byte, addr, count uint16) ([]uint16, error) {
+	if count == 0 || count > maxReadRegisters {
+		return nil, fmt.Errorf("cannot read %d registers at once", count)
+	}
+	req := binary.BigEndian.AppendUint16([]byte{c.unit, fn}, addr)
+	req = binary.BigEndian.AppendUint16(req, count)
+	if err := c.send(req); err != nil {
+		return nil, err
+	}
+	head, err := c.head(ctx, fn)
+	if err != nil {
+		return nil, err
+	}
+	if int(head[2]) != 2*int(count) {
+		c.r.Reset()
+		return nil, fmt.Errorf("%w: %d data bytes for %d registers", sensorerr.ErrInvalidResponse, head[2], count)
+	}
+	frame, err := c.rest(ctx, head, int(head[2]))
+	if err != nil {
+		return nil, err
+	}
+	regs := make([]uint16, count)
+	for i := range regs {
+		regs[i] = binary.BigEndian.Uint16(frame[3+2*i:])
+	}
+	return regs, nil
+}
+
+// WriteRegisters writes values, 1 to 123 of them, to consecutive holding
+// registers from addr.
+func (c *Client) WriteRegisters(ctx context.Context, addr uint16, values []uint16) error {
+	if len(values) == 0 || len(values) > maxWriteRegisters {
+		return fmt.Errorf("cannot write %d registers at once", len(values))
+	}
+	req := binary.BigEndian.AppendUint16([]byte{c.unit, fnWriteMultiple}, addr)
+	req = binary.BigEndian.AppendUint16(req, uint16(len(values)))
+	req = append(req, byte(2*len(values)))
+	for _, v := range values {
+		req = binary.BigEndian.AppendUint16(req, v)
+	}
+	if err := c.send(req); err != nil {
+		return err
+	}
+	head, err := c.head(ctx, fnWriteMultiple)
+	if err != nil {
+		return err
+	}
+	frame, err := c.rest(ctx, head, 3) // rest of address, then quantity
+	if err != nil {
+		return err
+	}
+	if binary.BigEndian.Uint16(frame[2:]) != addr || int(binary.BigEndian.Uint16(frame[4:])) != len(values) {
+		return fmt.Errorf("%w: write echo does not match the request", sensorerr.ErrInvalidResponse)
+	}
+	return nil
+}
+
+// DeviceID reads one device identification object (0 vendor, 1 product code,
+// 2 revision; 0x80 and up are vendor specific).
+func (c *Client) DeviceID(ctx context.Context, object byte) (string, error) {
+	if err := c.send([]byte{c.unit, fnEncapsulated, meiDeviceID, 4, object}); err != nil {
+		return "", err
+	}
+	head, err := c.head(ctx, fnEncapsulated)
+	if err != nil {
+		return "", err
+	}
+	// after the MEI type: access code, conformity, more follows, next object,
+	// object count, then each object as id, length, value
+	frame, err := c.more(ctx, head, 5)
+	if err != nil {
+		return "", err
+	}
+	var value string
+	for n := frame[7]; n > 0; n-- {
+		start := len(frame)
+		if frame, err = c.more(ctx, frame, 2); err != nil {
+			return "", err
+		}
+		id, size := frame[start], int(frame[start+1])
+		if frame, err = c.more(ctx, frame, size); err != nil {
+			return "", err
+		}
+		if id == object {
+			value = string(frame[start+2:])
+		}
+	}
+	if frame, err = c.more(ctx, frame, 2); err != nil {
+		return "", err
+	}
+	if err := c.checkCRC(frame); err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+func (c *Client) send(req []byte) error {
+	c.r.Discard()
+	if _, err := c.w.Write(binary.LittleEndian.AppendUint16(req, crc16(req))); err != nil {
+		return fmt.Errorf("failed to write modbus request: %v", err)
+	}
+	return nil
+}
+
+// head reads the unit, function, and first data byte of a reply, and returns
+// an *Exception for an error reply.
+func (c *Client) head(ctx context.Context, fn byte) ([]byte, error) {
+	head, err := c.more(ctx, nil, 3)
+	if err != nil {
+		return nil, err
+	}
+	if head[0] != c.unit {
+		c.r.Reset()
+		return nil, fmt.Errorf("%w: reply from unit %d, expected %d", sensorerr.ErrInvalidResponse, head[0], c.unit)
+	}
+	switch head[1] {
+	case fn:
+		return head, nil
+	case fn | 0x80:
+		frame, err := c.more(ctx, head, 2)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.checkCRC(frame); err != nil {
+			return nil, err
+		}
+		return nil, &Exception{Function: fn, Code: head[2]}
+	}
+	c.r.Reset()
+	return nil, fmt.Errorf("%w: reply to function 0x%02x, expected 0x%02x", sensorerr.ErrInvalidResponse, head[1], fn)
+}
+
+// rest reads n more data bytes and the CRC, and checks the whole frame.
+func (c *Client) rest(ctx context.Context, frame []byte, n int) ([]byte, error) {
+	frame, err := c.more(ctx, frame, n+2)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkCRC(frame); err != nil {
+		return nil, err
+	}
+	return frame[:len(frame)-2], nil
+}
+
+func (c *Client) more(ctx context.Context, frame []byte, n int) ([]byte, error) {
+	buf := make([]byte, n)
+	if err := c.r.ReadFull(ctx, buf); err != nil {
+		return nil, fmt.Errorf("failed to read modbus reply: %w", err)
+	}
+	return append(frame, buf...), nil
+}
+
+func (c *Client) checkCRC(frame []byte) error {
+	n := len(frame) - 2
+	if binary.LittleEndian.Uint16(frame[n:]) != crc16(frame[:n]) {
+		c.r.Reset()
+		return fmt.Errorf("%w: modbus CRC mismatch", sensorerr.ErrInvalidResponse)
+	}
+	return nil
+}
+
+func crc16(b []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, v := range b {
+		crc ^= uint16(v)
+		for range 8 {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xA001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
+
+// Float32 decodes a 32-bit float held in two registers, least significant
+// word first (the order Vaisala and many other instruments use).
+func Float32(regs []uint16) float64 {
+	return float64(math.Float32frombits(uint32(regs[1])<<16 | uint32(regs[0])))
+}
+
+// Float32Registers encodes v for Float32.
+func Float32Registers(v float64) []uint16 {
+	bits := math.Float32bits(float32(v))
+	return []uint16{uint16(bits), uint16(bits >> 16)}
+}
+
+// Uint32 decodes a 32-bit integer held in two registers, low word first.
+func Uint32(regs []uint16) uint32 {
+	return uint32(regs[1])<<16 | uint32(regs[0])
+}
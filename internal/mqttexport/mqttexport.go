@@ -0,0 +1,183 @@
+package mqttexport
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/demelere/sensor-control-modules/internal/metricdef"
+)
+
+var (
+	mqttDefaultPrefix     string
+	mqttConnectTimeout    time.Duration
+	mqttMobileMinInterval time.Duration
+)
+
+func init() {
+	mqttDefaultPrefix = "sensorctl"
+	mqttConnectTimeout = 10 * time.Second
+	mqttMobileMinInterval = time.Second // phones don't need every poll
+}
+
+type Config struct {
+	Broker   string // e.g. tcp://broker.local:1883
+	ClientID string
+	Username string
+	Password string
+	Prefix   string // topic root, default "sensorctl"
+	Mobile   bool   // also publish the compact mobile topics
+}
+
+// Exporter publishes rig data under <prefix>/<site>/:
+//
+//	readings/<sensor>/<metric>  full reading JSON, every poll
+//	events                      alerts, labels, markers, session changes
+//
+// With Mobile set it adds a compact scheme a phone app can subscribe to
+// without a backend:
+//
+//	mobile/status         retained {"st":"recording","sid":"...","ts":...}, "offline" as last will
+//	mobile/last/<metric>  retained {"v":412,"u":"ppm","ts":...}, at most once a second
+//	mobile/alerts         {"k":"gap","m":"co2: 4 missed polls","ts":...}, QoS 1
+type Exporter struct {
+	client mqtt.Client
+	base   string
+	mobile bool
+	lock   sync.Mutex
+	last   map[string]time.Time // last mobile publish per metric
+}
+
+func New(cfg Config, site string) (*Exporter, error) {
+	if cfg.Broker == "" {
+		return nil, fmt.Errorf("mqtt broker is not set")
+	}
+	prefix := cfg.Prefix
+	if prefix == "" {
+		prefix = mqttDefaultPrefix
+	}
+	if site == "" {
+		site = "default"
+	}
+	e := &Exporter{
+		base:   strings.TrimRight(prefix, "/") + "/" + site,
+		mobile: cfg.Mobile,
+		last:   make(map[string]time.Time),
+	}
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(cfg.Broker).
+		SetClientID(cfg.ClientID).
+		SetUsername(cfg.Username).
+		SetPassword(cfg.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true)
+	if e.mobile {
+		offline, _ := json.Marshal(mobileStatus{State: "offline"})
+		opts.SetWill(e.base+"/mobile/status", string(offline), 1, true)
+	}
+	e.client = mqtt.NewClient(opts)
+
+	tok := e.client.Connect()
+	if !tok.WaitTimeout(mqttConnectTimeout) {
+		// SetConnectRetry keeps trying in the background; publishes queue meanwhile
+		return e, nil
+	}
+	if err := tok.Error(); err != nil {
+		return nil, fmt.Errorf("mqtt connect %s: %v", cfg.Broker, err)
+	}
+	return e, nil
+}
+
+type fullReading struct {
+	Sensor string    `json:"sensor"`
+	Metric string    `json:"metric"`
+	Value  float64   `json:"value"`
+	Unit   string    `json:"unit"`
+	Time   time.Time `json:"time"`
+}
+
+type mobileValue struct {
+	Value float64 `json:"v"`
+	Unit  string  `json:"u,omitempty"`
+	TS    int64   `json:"ts"`
+}
+
+type mobileStatus struct {
+	State   string `json:"st"`
+	Session string `json:"sid,omitempty"`
+	TS      int64  `json:"ts,omitempty"`
+}
+
+type mobileAlert struct {
+	Kind    string `json:"k"`
+	Message string `json:"m"`
+	TS      int64  `json:"ts"`
+}
+
+func (e *Exporter) Reading(sensor, metric string, v float64, unit string, t time.Time) {
+	e.publish("readings/"+sensor+"/"+metric, 0, false, fullReading{Sensor: sensor, Metric: metric, Value: v, Unit: unit, Time: t})
+
+	if !e.mobile {
+		return
+	}
+	e.lock.Lock()
+	due := t.Sub(e.last[metric]) >= mqttMobileMinInterval
+	if due {
+		e.last[metric] = t
+	}
+	e.lock.Unlock()
+	if due {
+		e.publish("mobile/last/"+metric, 0, true, mobileValue{Value: round(metric, v), Unit: unit, TS: t.Unix()})
+	}
+}
+
+// Event publishes an arbitrary annotation (label, marker, gap) on the events
+// topic.
+func (e *Exporter) Event(v any) {
+	e.publish("events", 1, false, v)
+}
+
+// Alert publishes a short operator-facing alert for mobile subscribers; the
+// full annotation behind it goes out through Event.
+func (e *Exporter) Alert(kind, msg string, t time.Time) {
+	if e.mobile {
+		e.publish("mobile/alerts", 1, false, mobileAlert{Kind: kind, Message: msg, TS: t.Unix()})
+	}
+}
+
+// Status publishes the rig state ("recording", "idle") for mobile subscribers.
+func (e *Exporter) Status(state, session string, t time.Time) {
+	if e.mobile {
+		e.publish("mobile/status", 1, true, mobileStatus{State: state, Session: session, TS: t.Unix()})
+	}
+}
+
+func (e *Exporter) Close() {
+	if e.mobile {
+		tok := e.publish("mobile/status", 1, true, mobileStatus{State: "offline", TS: time.Now().Unix()})
+		tok.WaitTimeout(time.Second)
+	}
+	e.client.Disconnect(250)
+}
+
+func (e *Exporter) publish(topic string, qos byte, retained bool, v any) mqtt.Token {
+	payload, _ := json.Marshal(v)
+	return e.client.Publish(e.base+"/"+topic, qos, retained, payload)
+}
+
+// round trims values to the metric's display precision to keep mobile
+// payloads small.
+func round(metric string, v float64) float64 {
+	d, ok := metricdef.Lookup(metric)
+	if !ok {
+		return v
+	}
+	p := math.Pow(10, float64(d.Precision))
+	return math.Round(v*p) / p
+}
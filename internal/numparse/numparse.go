@@ -0,0 +1,55 @@
+package numparse
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ParseFloat parses a number as printed by sensor firmware, tolerating decimal
+// commas, thousands separators (comma, point, space, apostrophe, underscore)
+// and exponent forms ("1.2E+03", "1,2e3"). When only a single ',' or '.' is
+// present it is taken as the decimal separator, since no supported firmware
+// groups thousands without also printing decimals. "NaN" and "Inf" are
+// rejected: no firmware means them as readings.
+func ParseFloat(s string) (float64, error) {
+	raw := s
+	s = strings.TrimSpace(s)
+	s = strings.NewReplacer(" ", "", "\u00a0", "", "\u202f", "", "'", "", "_", "").Replace(s)
+	if s == "" {
+		return 0, fmt.Errorf("empty number")
+	}
+
+	mantissa, exponent := s, ""
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		mantissa, exponent = s[:i], s[i:]
+	}
+
+	dots, commas := strings.Count(mantissa, "."), strings.Count(mantissa, ",")
+	switch {
+	case dots > 0 && commas > 0: // whichever comes last is the decimal separator
+		if strings.LastIndex(mantissa, ",") > strings.LastIndex(mantissa, ".") {
+			mantissa = strings.ReplaceAll(mantissa, ".", "")
+			mantissa = strings.Replace(mantissa, ",", ".", 1)
+		} else {
+			mantissa = strings.ReplaceAll(mantissa, ",", "")
+		}
+	case commas > 1:
+		mantissa = strings.ReplaceAll(mantissa, ",", "")
+	case dots > 1:
+		mantissa = strings.ReplaceAll(mantissa, ".", "")
+	case commas == 1:
+		mantissa = strings.Replace(mantissa, ",", ".", 1)
+	}
+
+	if strings.Count(mantissa, ".") > 1 {
+		return 0, fmt.Errorf("ambiguous number %q", raw)
+	}
+
+	v, err := strconv.ParseFloat(mantissa+exponent, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("invalid number %q", raw)
+	}
+	return v, nil
+}
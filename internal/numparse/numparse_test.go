@@ -0,0 +1,46 @@
+package numparse
+
+import "testing"
+
+func TestParseFloat(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want float64
+	}{
+		{"12.5", 12.5},
+		{"12,5", 12.5},
+		{" -0,75 ", -0.75},
+		{"1,234.5", 1234.5},
+		{"1.234,5", 1234.5},
+		{"1,234,567", 1234567},
+		{"1.234.567", 1234567},
+		{"1 234,5", 1234.5},
+		{"1 234,5", 1234.5},
+		{"1 234.5", 1234.5},
+		{"1'234.5", 1234.5},
+		{"1_234.5", 1234.5},
+		{"1.2E+03", 1200},
+		{"1,2e3", 1200},
+		{"-3,5E-2", -0.035},
+		{"1.234,5e2", 123450},
+		// A lone separator is the decimal separator, even where a firmware
+		// grouping thousands without decimals would mean 1234.
+		{"1,234", 1.234},
+		{"1.234", 1.234},
+	} {
+		got, err := ParseFloat(tc.in)
+		if err != nil {
+			t.Errorf("ParseFloat(%q): %v", tc.in, err)
+		} else if got != tc.want {
+			t.Errorf("ParseFloat(%q) = %v, want %v", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestParseFloatInvalid(t *testing.T) {
+	for _, in := range []string{"", "   ", "abc", "1,2e", "--1", "1.2,3.4,5", "NaN", "nan", "-NaN", "Inf", "+Inf", "-inf", "Infinity", "1e400"} {
+		if v, err := ParseFloat(in); err == nil {
+			t.Errorf("ParseFloat(%q) = %v, want an error", in, v)
+		}
+	}
+}
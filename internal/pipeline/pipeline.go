@@ -0,0 +1,158 @@
+package pipeline
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Dispatcher drains per-stream queues on a single worker. Producers never
+// block: each stream has its own bounded queue that drops its oldest item
+// when full, so a burst on one stream cannot stall or crowd out another.
+// Streams are served weighted round-robin, taking up to Priority items from
+// each per round, so high-rate streams keep up while low-rate ones are never
+// starved.
+type Dispatcher struct {
+	handle  func(stream string, v any)
+	lock    sync.Mutex
+	cond    *sync.Cond
+	streams []*Stream
+	closed  bool
+	done    chan struct{}
+}
+
+type Stream struct {
+	d        *Dispatcher
+	name     string
+	priority int
+	queue    []any
+	head     int
+	size     int
+	dropped  atomic.Uint64
+	handled  atomic.Uint64
+}
+
+type StreamStats struct {
+	Name     string `json:"name"`
+	Priority int    `json:"priority"`
+	Queued   int    `json:"queued"`
+	Capacity int    `json:"capacity"`
+	Handled  uint64 `json:"handled"`
+	Dropped  uint64 `json:"dropped"`
+}
+
+func New(handle func(stream string, v any)) *Dispatcher {
+	d := &Dispatcher{handle: handle, done: make(chan struct{})}
+	d.cond = sync.NewCond(&d.lock)
+	return d
+}
+
+// Stream registers a queue. priority is the number of items served from it
+// per round (minimum 1); capacity bounds the backlog.
+func (d *Dispatcher) Stream(name string, priority, capacity int) *Stream {
+	if priority < 1 {
+		priority = 1
+	}
+	if capacity < 1 {
+		capacity = 1
+	}
+	s := &Stream{d: d, name: name, priority: priority, queue: make([]any, capacity)}
+	d.lock.Lock()
+	d.streams = append(d.streams, s)
+	d.lock.Unlock()
+	return s
+}
+
+// Submit enqueues v, dropping the stream's oldest item if its queue is full.
+// It reports false if something was dropped or the dispatcher is closed.
+func (s *Stream) Submit(v any) bool {
+	d := s.d
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.closed {
+		s.dropped.Add(1)
+		return false
+	}
+
+	ok := true
+	if s.size == len(s.queue) {
+		s.queue[s.head] = nil
+		s.head = (s.head + 1) % len(s.queue)
+		s.size--
+		s.dropped.Add(1)
+		ok = false
+	}
+	s.queue[(s.head+s.size)%len(s.queue)] = v
+	s.size++
+	d.cond.Signal()
+	return ok
+}
+
+type queued struct {
+	s *Stream
+	v any
+}
+
+// Run serves the queues until Close, then drains what is left and returns.
+func (d *Dispatcher) Run() {
+	defer close(d.done)
+	var batch []queued
+	for {
+		d.lock.Lock()
+		for !d.closed && d.pending() == 0 {
+			d.cond.Wait()
+		}
+		if d.closed && d.pending() == 0 {
+			d.lock.Unlock()
+			return
+		}
+		batch = batch[:0]
+		for _, s := range d.streams {
+			for n := 0; n < s.priority && s.size > 0; n++ {
+				batch = append(batch, queued{s: s, v: s.queue[s.head]})
+				s.queue[s.head] = nil
+				s.head = (s.head + 1) % len(s.queue)
+				s.size--
+			}
+		}
+		d.lock.Unlock()
+
+		for _, q := range batch {
+			d.handle(q.s.name, q.v)
+			q.s.handled.Add(1)
+		}
+	}
+}
+
+func (d *Dispatcher) pending() int {
+	n := 0
+	for _, s := range d.streams {
+		n += s.size
+	}
+	return n
+}
+
+// Close stops accepting items and waits for Run to drain the queues.
+func (d *Dispatcher) Close() {
+	d.lock.Lock()
+	d.closed = true
+	d.cond.Broadcast()
+	d.lock.Unlock()
+	<-d.done
+}
+
+func (d *Dispatcher) Stats() []StreamStats {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	out := make([]StreamStats, 0, len(d.streams))
+	for _, s := range d.streams {
+		out = append(out, StreamStats{
+			Name:     s.name,
+			Priority: s.priority,
+			Queued:   s.size,
+			Capacity: len(s.queue),
+			Handled:  s.handled.Load(),
+			Dropped:  s.dropped.Load(),
+		})
+	}
+	return out
+}
@@ -0,0 +1,107 @@
+package polar
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// Flags of the Heart Rate Measurement characteristic (0x2A37).
+const (
+	flagHR16          = 0x01 // heart rate is a uint16, not a uint8
+	flagContactDetect = 0x02 // skin contact detected
+	flagContactSupp   = 0x04 // the strap reports skin contact
+	flagEnergy        = 0x08 // energy expended field present
+	flagRR            = 0x10 // one or more RR intervals present
+)
+
+// Contact is what a strap says about skin contact.
+type Contact int
+
+const (
+	ContactUnsupported Contact = iota // the strap does not report it
+	ContactLost
+	ContactDetected
+)
+
+func (c Contact) String() string {
+	switch c {
+	case ContactLost:
+		return "lost"
+	case ContactDetected:
+		return "detected"
+	default:
+		return "unsupported"
+	}
+}
+
+// HeartRateMeasurement is one Heart Rate Measurement notification, decoded
+// per the GATT specification.
+type HeartRateMeasurement struct {
+	Flags          byte
+	HeartRate      uint16 // beats per minute
+	Contact        Contact
+	EnergyExpended uint16 // kJ since the strap's last reset; valid if HasEnergy
+	HasEnergy      bool
+	RRIntervals    []uint16 // in 1/1024 s, oldest first; nil when the packet has none
+}
+
+// RR returns the RR intervals as durations.
+func (m HeartRateMeasurement) RR() []time.Duration {
+	var out []time.Duration
+	for _, rr := range m.RRIntervals {
+		out = append(out, time.Duration(rr)*time.Second/1024)
+	}
+	return out
+}
+
+// ParseHeartRateMeasurement decodes a Heart Rate Measurement packet. The
+// fields after the flags are at offsets that depend on them: a 16-bit heart
+// rate and the energy expended field each move the RR intervals along. A
+// packet too short for the fields its flags announce is an error; a trailing
+// odd byte after the RR intervals is ignored.
+func ParseHeartRateMeasurement(buf []byte) (HeartRateMeasurement, error) {
+	if len(buf) < 2 {
+		return HeartRateMeasurement{}, fmt.Errorf("heart rate measurement of %d bytes is too short", len(buf))
+	}
+	m := HeartRateMeasurement{Flags: buf[0]}
+	i := 1
+	if m.Flags&flagHR16 != 0 {
+		if len(buf) < i+2 {
+			return HeartRateMeasurement{}, fmt.Errorf("heart rate measurement is cut short in its 16-bit heart rate")
+		}
+		m.HeartRate = binary.LittleEndian.Uint16(buf[i:])
+		i += 2
+	} else {
+		m.HeartRate = uint16(buf[i])
+		i++
+	}
+
+	switch {
+	case m.Flags&flagContactSupp == 0:
+		m.Contact = ContactUnsupported
+	case m.Flags&flagContactDetect != 0:
+		m.Contact = ContactDetected
+	default:
+		m.Contact = ContactLost
+	}
+
+	if m.Flags&flagEnergy != 0 {
+		if len(buf) < i+2 {
+			return HeartRateMeasurement{}, fmt.Errorf("heart rate measurement is cut short in its energy expended field")
+		}
+		m.EnergyExpended = binary.LittleEndian.Uint16(buf[i:])
+		m.HasEnergy = true
+		i += 2
+	}
+
+	if m.Flags&flagRR != 0 {
+		if len(buf) < i+2 {
+			return HeartRateMeasurement{}, fmt.Errorf("heart rate measurement announces RR intervals but has none")
+		}
+		for ; i+1 < len(buf); i += 2 {
+			m.RRIntervals = append(m.RRIntervals, binary.LittleEndian.Uint16(buf[i:]))
+		}
+	}
+	return m, nil
+}
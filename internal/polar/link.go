@@ -0,0 +1,164 @@
+package polar
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"tinygo.org/x/bluetooth"
+)
+
+// central connects to straps: bleCentral over the radio, or a Replayer
+// playing back a recording.
+type central interface {
+	Connect(address string) (peripheral, error)
+}
+
+// peripheral is one connected strap, reduced to what the driver uses: the
+// heart rate measurement notifications, the battery level, and the device
+// information.
+type peripheral interface {
+	// Notify calls fn with every heart rate measurement packet; a nil fn
+	// stops the notifications. fn must not block.
+	Notify(fn func(packet []byte)) error
+	// ReadBattery reads the Battery Service's level, in percent.
+	ReadBattery() (int, error)
+	// ReadInfo reads the Device Information Service.
+	ReadInfo() (DeviceInfo, error)
+	// Lost is closed when the link drops. It is nil when the link cannot
+	// tell, and then never fires.
+	Lost() <-chan struct{}
+	Disconnect() error
+}
+
+// bleCentral is the host's Bluetooth adapter.
+type bleCentral struct {
+	adapter *bluetooth.Adapter
+}
+
+func (c bleCentral) Connect(address string) (peripheral, error) {
+	var addr bluetooth.Address
+	addr.Set(address)
+	device, err := c.adapter.Connect(addr, bluetooth.ConnectionParams{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Polar sensor: %v", err)
+	}
+	return &blePeripheral{device: device}, nil
+}
+
+// errNoService is returned by a peripheral without the service asked for.
+var errNoService = errors.New("service not offered")
+
+// DeviceInfo is what the strap's Device Information Service reports. A
+// field the strap does not offer is empty.
+type DeviceInfo struct {
+	Manufacturer string `json:"manufacturer,omitempty"`
+	Model        string `json:"model,omitempty"`
+	SerialNumber string `json:"serial_number,omitempty"`
+	Firmware     string `json:"firmware_revision,omitempty"`
+	Hardware     string `json:"hardware_revision,omitempty"`
+}
+
+type blePeripheral struct {
+	device  bluetooth.Device
+	char    *bluetooth.DeviceCharacteristic // found by the first Notify
+	battery *bluetooth.DeviceCharacteristic // found by the first ReadBattery
+}
+
+func (p *blePeripheral) Notify(fn func([]byte)) error {
+	if p.char == nil {
+		if fn == nil {
+			return nil
+		}
+		srvcs, err := p.device.DiscoverServices([]bluetooth.UUID{bluetooth.ServiceUUIDHeartRate})
+		if err != nil {
+			return fmt.Errorf("failed to discover heart rate service: %v", err)
+		}
+		if len(srvcs) == 0 {
+			return fmt.Errorf("could not find heart rate service")
+		}
+		chars, err := srvcs[0].DiscoverCharacteristics([]bluetooth.UUID{bluetooth.CharacteristicUUIDHeartRateMeasurement})
+		if err != nil {
+			return fmt.Errorf("failed to discover heart rate characteristic: %v", err)
+		}
+		if len(chars) == 0 {
+			return fmt.Errorf("could not find heart rate characteristic")
+		}
+		p.char = &chars[0]
+	}
+	if err := p.char.EnableNotifications(fn); err != nil {
+		return fmt.Errorf("failed to enable heart rate notifications: %v", err)
+	}
+	return nil
+}
+
+func (p *blePeripheral) ReadBattery() (int, error) {
+	if p.battery == nil {
+		chars, err := p.characteristics(bluetooth.ServiceUUIDBattery, bluetooth.CharacteristicUUIDBatteryLevel)
+		if err != nil {
+			return 0, fmt.Errorf("battery service: %w", err)
+		}
+		p.battery = &chars[0]
+	}
+	buf := make([]byte, 1)
+	n, err := p.battery.Read(buf)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read battery level: %v", err)
+	}
+	if n != 1 || buf[0] > 100 {
+		return 0, fmt.Errorf("invalid battery level % x", buf[:n])
+	}
+	return int(buf[0]), nil
+}
+
+func (p *blePeripheral) ReadInfo() (DeviceInfo, error) {
+	var info DeviceInfo
+	fields := map[bluetooth.UUID]*string{
+		bluetooth.CharacteristicUUIDManufacturerNameString: &info.Manufacturer,
+		bluetooth.CharacteristicUUIDModelNumberString:      &info.Model,
+		bluetooth.CharacteristicUUIDSerialNumberString:     &info.SerialNumber,
+		bluetooth.CharacteristicUUIDFirmwareRevisionString: &info.Firmware,
+		bluetooth.CharacteristicUUIDHardwareRevisionString: &info.Hardware,
+	}
+	chars, err := p.characteristics(bluetooth.ServiceUUIDDeviceInformation)
+	if err != nil {
+		return info, fmt.Errorf("device information service: %w", err)
+	}
+	buf := make([]byte, 64)
+	for _, c := range chars {
+		field, ok := fields[c.UUID()]
+		if !ok {
+			continue
+		}
+		n, err := c.Read(buf)
+		if err != nil {
+			return info, fmt.Errorf("failed to read device information: %v", err)
+		}
+		*field = strings.TrimRight(string(buf[:n]), "\x00 ")
+	}
+	return info, nil
+}
+
+// characteristics discovers a service's characteristics, all of them if
+// none are named.
+func (p *blePeripheral) characteristics(service bluetooth.UUID, chars ...bluetooth.UUID) ([]bluetooth.DeviceCharacteristic, error) {
+	srvcs, err := p.device.DiscoverServices([]bluetooth.UUID{service})
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover: %v", err)
+	}
+	if len(srvcs) == 0 {
+		return nil, errNoService
+	}
+	found, err := srvcs[0].DiscoverCharacteristics(chars)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover characteristics: %v", err)
+	}
+	if len(found) == 0 {
+		return nil, errNoService
+	}
+	return found, nil
+}
+
+func (p *blePeripheral) Lost() <-chan struct{} { return nil }
+
+func (p *blePeripheral) Disconnect() error { return p.device.Disconnect() }
@@ -1,86 +1,165 @@
 package polar
 
 import (
-	"encoding/binary"
-	"fmt"
-
-	"tinygo.org/x/bluetooth"
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/demelere/sensor-control-modules/internal/units"
+	"github.com/demelere/sensor-control-modules/pkg/sensor"
 )
 
+// BatteryInterval is how often a connected strap's battery level is read
+// and sent as a battery reading.
+var BatteryInterval = 5 * time.Minute
+
 type PolarSensor struct {
-	device       *bluetooth.Device
-	heartRateCh  chan uint8
-	rrIntervalCh chan []uint16
+	link     peripheral
+	address  string
+	info     DeviceInfo
+	readings chan sensor.Reading
 }
 
-func newPolarSensor(adapter *bluetooth.Adapter, address bluetooth.Address) (*PolarSensor, error) { // TO DO: pass in mac address
-	device, err := adapter.Connect(address, bluetooth.ConnectionParams{}) // TO DO: change to connect to specific mac address instead of by device name
+func newPolarSensor(c central, address string) (*PolarSensor, error) {
+	link, err := c.Connect(address)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to Polar sensor: %v", err)
+		return nil, err
+	}
+	info, err := link.ReadInfo()
+	if err != nil && !errors.Is(err, errNoService) {
+		log.Printf("polar sensor %s: %v", address, err)
 	}
 
 	return &PolarSensor{
-		device:       &device,
-		heartRateCh:  make(chan uint8),
-		rrIntervalCh: make(chan []uint16),
+		link:     link,
+		address:  address,
+		info:     info,
+		readings: make(chan sensor.Reading),
 	}, nil
 }
 
-func (ps *PolarSensor) startPolarSensor() error {
-	srvcs, err := ps.device.DiscoverServices([]bluetooth.UUID{bluetooth.ServiceUUIDHeartRate})
-	if err != nil {
-		return fmt.Errorf("failed to discover heart rate service: %v", err)
-	}
-
-	if len(srvcs) == 0 {
-		return fmt.Errorf("could not find heart rate service")
-	}
+// Info is the strap's device information, as read on connecting.
+func (ps *PolarSensor) Info() DeviceInfo {
+	return ps.info
+}
 
-	srvc := srvcs[0]
+// Battery reads the strap's battery level, in percent.
+func (ps *PolarSensor) Battery() (int, error) {
+	return ps.link.ReadBattery()
+}
 
-	chars, err := srvc.DiscoverCharacteristics([]bluetooth.UUID{bluetooth.CharacteristicUUIDHeartRateMeasurement})
+// startPolarSensor subscribes to heart rate notifications and sends a
+// heart_rate reading, then one rr_interval reading per beat, for each
+// notification until ctx is done or the link drops, then unsubscribes and
+// closes readings. Readings taken while the strap reports no skin contact are
+// sensor.Uncertain. A battery reading is sent on starting and every
+// BatteryInterval.
+func (ps *PolarSensor) startPolarSensor(ctx context.Context) error {
+	packets := make(chan []byte, 16)
+	err := ps.link.Notify(func(buf []byte) {
+		select { // never block the BLE stack; drop if the reader is behind or gone
+		case packets <- append([]byte(nil), buf...):
+		default:
+		}
+	})
 	if err != nil {
-		return fmt.Errorf("failed to discover heart rate characteristic: %v", err)
+		return err
 	}
 
-	if len(chars) == 0 {
-		return fmt.Errorf("could not find heart rate characteristic")
-	}
-
-	char := chars[0]
-
-	char.EnableNotifications(func(buf []byte) {
-		if len(buf) > 1 {
-			heartRate := buf[1]
-			ps.heartRateCh <- heartRate
-
-			flags := buf[0]
-			if flags&0x10 != 0 && len(buf) >= 4 { // handle cases where RR interval data not available
-				rrIntervals := make([]uint16, 0)
-				for i := 2; i < len(buf); i += 2 { // avoiding panic situations by checking buffer lengths before accessing
-					if i+1 < len(buf) {
-						rrInterval := binary.LittleEndian.Uint16(buf[i:])
-						rrIntervals = append(rrIntervals, rrInterval)
-					}
+	go func() {
+		defer close(ps.readings)
+		defer ps.link.Notify(nil)
+		stop := make(chan struct{})
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ps.pollBattery(ctx, stop)
+		}()
+		defer wg.Wait()
+		defer close(stop)
+		for {
+			var buf []byte
+			select {
+			case buf = <-packets:
+			case <-ps.link.Lost():
+				log.Printf("polar sensor %s: link lost", ps.address)
+				return
+			case <-ctx.Done():
+				return
+			}
+			for _, rd := range decodeMeasurement(buf, ps.address, time.Now().UTC()) {
+				select {
+				case ps.readings <- rd:
+				case <-ctx.Done():
+					return
 				}
-				ps.rrIntervalCh <- rrIntervals
-			} else {
-				ps.rrIntervalCh <- nil // send nil when RR interval data is not available
 			}
 		}
-	})
+	}()
 
 	return nil
 }
 
-func (ps *PolarSensor) readHeartRate() uint8 {
-	return <-ps.heartRateCh
+// pollBattery sends a battery reading now and every BatteryInterval until
+// stop is closed. A strap without the Battery Service sends none.
+func (ps *PolarSensor) pollBattery(ctx context.Context, stop <-chan struct{}) {
+	tick := time.NewTicker(BatteryInterval)
+	defer tick.Stop()
+	failed := false // logged once per connection
+	for {
+		level, err := ps.link.ReadBattery()
+		switch {
+		case errors.Is(err, errNoService):
+			return
+		case err != nil:
+			if !failed {
+				log.Printf("polar sensor %s: %v", ps.address, err)
+				failed = true
+			}
+		default:
+			rd := sensor.Reading{Sensor: ps.address, Metric: "battery", Value: float64(level), Unit: string(units.Percent), Time: time.Now().UTC(), Quality: sensor.Good}
+			select {
+			case ps.readings <- rd:
+			case <-stop:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+		select {
+		case <-tick.C:
+		case <-stop:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
 }
 
-func (ps *PolarSensor) readRRInterval() []uint16 {
-	return <-ps.rrIntervalCh
+// decodeMeasurement turns one heart rate measurement packet into a
+// heart_rate reading followed by its rr_interval readings, if any. A packet
+// that does not parse is logged and dropped.
+func decodeMeasurement(buf []byte, address string, now time.Time) []sensor.Reading {
+	m, err := ParseHeartRateMeasurement(buf)
+	if err != nil {
+		log.Printf("polar sensor %s: dropping packet % x: %v", address, buf, err)
+		return nil
+	}
+	quality := sensor.Good
+	if m.Contact == ContactLost {
+		quality = sensor.Uncertain
+	}
+
+	out := []sensor.Reading{{Sensor: address, Metric: "heart_rate", Value: float64(m.HeartRate), Unit: string(units.BPM), Time: now, Quality: quality}}
+	for _, rr := range m.RRIntervals {
+		out = append(out, sensor.Reading{Sensor: address, Metric: "rr_interval", Value: float64(rr) * 1000 / 1024, Unit: string(units.Millis), Time: now, Quality: quality}) // RR arrives in 1/1024 s
+	}
+	return out
 }
 
 func (ps *PolarSensor) close() error {
-	return ps.device.Disconnect()
+	return ps.link.Disconnect()
 }
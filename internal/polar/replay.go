@@ -0,0 +1,180 @@
+package polar
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Recording is a capture of a strap's heart rate measurement notifications,
+// for running the driver without one.
+type Recording struct {
+	Packets []Packet
+}
+
+// Packet is one notification, At after the capture started.
+type Packet struct {
+	At   time.Duration
+	Data []byte
+}
+
+// LoadRecording reads a capture with one notification per line: seconds
+// since the start, then the packet in hex, e.g. "1.002 16 48 a0 03". Blank
+// lines and lines starting with '#' are skipped.
+func LoadRecording(path string) (*Recording, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	rec := &Recording{}
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("%s:%d: want seconds and hex packet", path, n)
+		}
+		secs, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil || secs < 0 {
+			return nil, fmt.Errorf("%s:%d: bad offset %q", path, n, fields[0])
+		}
+		data, err := hex.DecodeString(strings.Join(fields[1:], ""))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+		at := time.Duration(secs * float64(time.Second))
+		if k := len(rec.Packets); k > 0 && at < rec.Packets[k-1].At {
+			return nil, fmt.Errorf("%s:%d: offset goes backwards", path, n)
+		}
+		rec.Packets = append(rec.Packets, Packet{At: at, Data: data})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(rec.Packets) == 0 {
+		return nil, fmt.Errorf("%s: no packets", path)
+	}
+	return rec, nil
+}
+
+// Replayer stands in for the Bluetooth adapter: every strap it connects to
+// notifies the recorded packets at their recorded spacing, over and over.
+// With DropAfter set, each link is lost after that many packets, to exercise
+// reconnection; the next Connect resumes where the last link stopped.
+type Replayer struct {
+	Recording *Recording
+	DropAfter int // packets per connection, 0 for a link that never drops
+
+	lock sync.Mutex
+	next int // packet the next link starts from
+}
+
+func NewReplayer(rec *Recording) *Replayer {
+	return &Replayer{Recording: rec}
+}
+
+func (r *Replayer) Connect(address string) (peripheral, error) {
+	return &replayLink{replayer: r, lost: make(chan struct{}), stop: make(chan struct{})}, nil
+}
+
+type replayLink struct {
+	replayer *Replayer
+	lost     chan struct{}
+	stop     chan struct{} // closed by Disconnect
+	lock     sync.Mutex
+	playing  chan struct{} // closed to stop the current Notify
+	done     chan struct{} // closed when it has stopped
+}
+
+func (l *replayLink) Notify(fn func([]byte)) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.playing != nil {
+		close(l.playing)
+		<-l.done
+		l.playing = nil
+	}
+	if fn == nil {
+		return nil
+	}
+	select {
+	case <-l.lost:
+		return fmt.Errorf("failed to enable heart rate notifications: link lost")
+	case <-l.stop:
+		return fmt.Errorf("failed to enable heart rate notifications: not connected")
+	default:
+	}
+	l.playing, l.done = make(chan struct{}), make(chan struct{})
+	go l.play(fn, l.playing, l.done)
+	return nil
+}
+
+// play sends packets until stopped, looping over the recording with the
+// recording's first gap between its last packet and its first.
+func (l *replayLink) play(fn func([]byte), playing, done chan struct{}) {
+	defer close(done)
+	r := l.replayer
+	packets := r.Recording.Packets
+	r.lock.Lock()
+	i := r.next
+	r.lock.Unlock()
+
+	wrap := time.Second
+	if len(packets) > 1 {
+		wrap = packets[1].At - packets[0].At
+	}
+	for sent := 0; ; sent++ {
+		if r.DropAfter > 0 && sent == r.DropAfter {
+			close(l.lost)
+			return
+		}
+		var wait time.Duration
+		if sent > 0 {
+			if i == 0 {
+				wait = wrap
+			} else {
+				wait = packets[i].At - packets[i-1].At
+			}
+		}
+		select {
+		case <-time.After(wait):
+		case <-playing:
+			return
+		case <-l.stop:
+			return
+		}
+		fn(append([]byte(nil), packets[i].Data...))
+		i = (i + 1) % len(packets)
+		r.lock.Lock()
+		r.next = i
+		r.lock.Unlock()
+	}
+}
+
+func (l *replayLink) Lost() <-chan struct{} { return l.lost }
+
+// A recording holds heart rate packets only.
+func (l *replayLink) ReadBattery() (int, error) { return 0, errNoService }
+
+func (l *replayLink) ReadInfo() (DeviceInfo, error) { return DeviceInfo{}, errNoService }
+
+func (l *replayLink) Disconnect() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	select {
+	case <-l.stop:
+	default:
+		close(l.stop)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package polar
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/demelere/sensor-control-modules/pkg/sensor"
+)
+
+const replayAddress = "A0:9E:1A:00:00:01"
+
+// loadFastRecording loads the shipped capture played 100 times faster.
+func loadFastRecording(t *testing.T) *Recording {
+	t.Helper()
+	rec, err := LoadRecording("../../testdata/polar/h10-rest.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range rec.Packets {
+		rec.Packets[i].At /= 100
+	}
+	return rec
+}
+
+// beat is the heart_rate reading of one packet and the rr_interval readings
+// that follow it.
+type beat struct {
+	hr sensor.Reading
+	rr []sensor.Reading
+}
+
+// collect reads until readings closes, grouping them by packet.
+func collect(t *testing.T, readings <-chan sensor.Reading) []beat {
+	t.Helper()
+	var beats []beat
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case rd, ok := <-readings:
+			if !ok {
+				return beats
+			}
+			switch rd.Metric {
+			case "heart_rate":
+				beats = append(beats, beat{hr: rd})
+			case "rr_interval":
+				if len(beats) == 0 {
+					t.Fatalf("rr_interval %v before any heart_rate", rd.Value)
+				}
+				beats[len(beats)-1].rr = append(beats[len(beats)-1].rr, rd)
+			default:
+				t.Fatalf("unexpected %s reading from a replay", rd.Metric)
+			}
+		case <-timeout:
+			t.Fatal("readings not closed after the link was lost")
+		}
+	}
+}
+
+func TestReplay(t *testing.T) {
+	rep := NewReplayer(loadFastRecording(t))
+	rep.DropAfter = 30
+
+	ps, err := newPolarSensor(rep, replayAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ps.close()
+	if err := ps.startPolarSensor(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	beats := collect(t, ps.readings)
+	// the last packet races the link loss, so it may not be read
+	if len(beats) != 29 && len(beats) != 30 {
+		t.Fatalf("got %d heart rate readings before the link dropped, want 30", len(beats))
+	}
+
+	for i, want := range []struct {
+		packet  int
+		hr      float64
+		rr      []float64
+		quality sensor.Quality
+	}{
+		{0, 63, []float64{957 * 1000.0 / 1024}, sensor.Good},
+		{12, 65, []float64{471 * 1000.0 / 1024, 518 * 1000.0 / 1024}, sensor.Good},
+		{24, 64, []float64{985 * 1000.0 / 1024}, sensor.Uncertain}, // no skin contact
+		{26, 63, []float64{973 * 1000.0 / 1024}, sensor.Uncertain},
+		{27, 63, []float64{953 * 1000.0 / 1024}, sensor.Good},
+	} {
+		b := beats[want.packet]
+		if b.hr.Value != want.hr || b.hr.Sensor != replayAddress || b.hr.Quality != want.quality {
+			t.Errorf("case %d: packet %d: heart_rate %v %s from %s, want %v %s", i, want.packet, b.hr.Value, b.hr.Quality, b.hr.Sensor, want.hr, want.quality)
+		}
+		if len(b.rr) != len(want.rr) {
+			t.Errorf("case %d: packet %d: %d rr_interval readings, want %d", i, want.packet, len(b.rr), len(want.rr))
+			continue
+		}
+		for j, rr := range b.rr {
+			if math.Abs(rr.Value-want.rr[j]) > 1e-9 || rr.Unit != "ms" || rr.Quality != want.quality {
+				t.Errorf("case %d: packet %d: rr_interval %v %s %s, want %v ms %s", i, want.packet, rr.Value, rr.Unit, rr.Quality, want.rr[j], want.quality)
+			}
+		}
+	}
+
+	// a reconnect resumes the recording where the lost link stopped
+	again, err := newPolarSensor(rep, replayAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer again.close()
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := again.startPolarSensor(ctx); err != nil {
+		cancel()
+		t.Fatal(err)
+	}
+	first := <-again.readings
+	cancel()
+	for range again.readings { // closed once ctx is done
+	}
+	if first.Metric != "heart_rate" || first.Value != 64 {
+		t.Errorf("first reading after reconnecting is %s %v, want heart_rate 64 from packet 30", first.Metric, first.Value)
+	}
+}
@@ -0,0 +1,142 @@
+package polar
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"tinygo.org/x/bluetooth"
+)
+
+// DefaultScanTimeout is how long Open looks for the configured strap before
+// giving up.
+var DefaultScanTimeout = 10 * time.Second
+
+// Candidate is a device seen advertising during a scan.
+type Candidate struct {
+	Address string `json:"address"`
+	Name    string `json:"name"`
+	RSSI    int16  `json:"rssi"` // dBm, the strongest advertisement seen
+}
+
+// ScanFilter picks the devices Scan reports: the one with MAC if set, in any
+// case, or else those whose advertised name starts with NamePrefix, "Polar"
+// when empty.
+type ScanFilter struct {
+	NamePrefix string
+	MAC        string
+}
+
+func (f ScanFilter) match(c Candidate) bool {
+	if f.MAC != "" {
+		return strings.EqualFold(c.Address, f.MAC)
+	}
+	prefix := f.NamePrefix
+	if prefix == "" {
+		prefix = "Polar"
+	}
+	return strings.HasPrefix(c.Name, prefix)
+}
+
+// scanner is a central that can discover straps before connecting. A
+// replay has nothing to discover.
+type scanner interface {
+	// Scan calls found with each advertisement until found returns false
+	// or ctx is done.
+	Scan(ctx context.Context, found func(Candidate) bool) error
+}
+
+// Scan listens for advertisements until ctx is done and returns the devices
+// that match filter, strongest signal first.
+func Scan(ctx context.Context, filter ScanFilter) ([]Candidate, error) {
+	c, err := openCentral()
+	if err != nil {
+		return nil, err
+	}
+	s, ok := c.(scanner)
+	if !ok {
+		return nil, fmt.Errorf("cannot scan for Polar sensors while replaying a recording")
+	}
+	return scan(ctx, s, filter)
+}
+
+func scan(ctx context.Context, s scanner, filter ScanFilter) ([]Candidate, error) {
+	seen := map[string]Candidate{}
+	err := s.Scan(ctx, func(cd Candidate) bool {
+		prev, known := seen[cd.Address]
+		if !known && !filter.match(cd) {
+			return true
+		}
+		if known {
+			cd.RSSI = max(cd.RSSI, prev.RSSI)
+			if cd.Name == "" { // not every advertisement carries the name
+				cd.Name = prev.Name
+			}
+		}
+		seen[cd.Address] = cd
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Candidate, 0, len(seen))
+	for _, cd := range seen {
+		out = append(out, cd)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].RSSI > out[j].RSSI })
+	return out, nil
+}
+
+// ConnectByMAC waits up to timeout for the strap at mac to advertise, then
+// connects to it.
+func ConnectByMAC(mac string, timeout time.Duration) (*PolarSensor, error) {
+	c, err := openCentral()
+	if err != nil {
+		return nil, err
+	}
+	return connectByMAC(c, mac, timeout)
+}
+
+func connectByMAC(c central, mac string, timeout time.Duration) (*PolarSensor, error) {
+	if s, ok := c.(scanner); ok {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		filter := ScanFilter{MAC: mac}
+		found := false
+		err := s.Scan(ctx, func(cd Candidate) bool {
+			found = filter.match(cd)
+			return !found
+		})
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, fmt.Errorf("polar sensor %s not seen advertising within %v", mac, timeout)
+		}
+	}
+	return newPolarSensor(c, mac)
+}
+
+func (c bleCentral) Scan(ctx context.Context, found func(Candidate) bool) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- c.adapter.Scan(func(a *bluetooth.Adapter, r bluetooth.ScanResult) {
+			if !found(Candidate{Address: r.Address.String(), Name: r.LocalName(), RSSI: r.RSSI}) {
+				a.StopScan()
+			}
+		})
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("failed to scan for Polar sensors: %v", err)
+		}
+		return nil
+	case <-ctx.Done():
+		c.adapter.StopScan()
+		<-done // the callback is not called once Scan returns
+		return nil
+	}
+}
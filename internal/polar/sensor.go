@@ -0,0 +1,128 @@
+package polar
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"tinygo.org/x/bluetooth"
+
+	"github.com/demelere/sensor-control-modules/internal/units"
+	"github.com/demelere/sensor-control-modules/pkg/sensor"
+)
+
+func init() {
+	// the strap notifies about once a second; RR intervals arrive per beat in 1/1024 s
+	sensor.RegisterContract("polar", sensor.Contract{Metric: "heart_rate", Unit: string(units.BPM), Min: 20, Max: 250, Resolution: 1, Interval: time.Second})
+	sensor.RegisterContract("polar", sensor.Contract{Metric: "rr_interval", Unit: string(units.Millis), Min: 200, Max: 3000, Resolution: 1000.0 / 1024})
+	sensor.RegisterContract("polar", sensor.Contract{Metric: "battery", Unit: string(units.Percent), Min: 0, Max: 100, Resolution: 1})
+	sensor.Register("polar", func(cfg sensor.Config) (sensor.Sensor, error) {
+		if cfg.MAC == "" {
+			return nil, fmt.Errorf("polar sensor %s: no mac address configured", cfg.Name)
+		}
+		return &registered{cfg: cfg, readings: make(chan sensor.Reading)}, nil
+	})
+}
+
+// registered adapts PolarSensor to sensor.Sensor. The strap is connected on
+// Open rather than at construction, like the serial drivers.
+type registered struct {
+	*PolarSensor
+	cfg      sensor.Config
+	readings chan sensor.Reading
+}
+
+// Open connects to the strap over Bluetooth, once it is seen advertising, or,
+// with POLAR_REPLAY set to a recording (see LoadRecording), to a replay of
+// it. POLAR_REPLAY_DROP_AFTER drops each replayed link after that many
+// packets.
+func (r *registered) Open() error {
+	c, err := openCentral()
+	if err != nil {
+		return err
+	}
+	ps, err := connectByMAC(c, r.cfg.MAC, DefaultScanTimeout)
+	if err != nil {
+		return err
+	}
+	r.PolarSensor = ps
+	return nil
+}
+
+var replay struct {
+	lock     sync.Mutex
+	replayer *Replayer // shared, so a reconnect resumes the recording
+}
+
+func openCentral() (central, error) {
+	path := os.Getenv("POLAR_REPLAY")
+	if path == "" {
+		adapter := bluetooth.DefaultAdapter
+		if err := adapter.Enable(); err != nil {
+			return nil, fmt.Errorf("failed to enable bluetooth adapter: %v", err)
+		}
+		return bleCentral{adapter: adapter}, nil
+	}
+
+	replay.lock.Lock()
+	defer replay.lock.Unlock()
+	if replay.replayer == nil {
+		rec, err := LoadRecording(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load polar replay: %w", err)
+		}
+		replay.replayer = NewReplayer(rec)
+		if val := os.Getenv("POLAR_REPLAY_DROP_AFTER"); val != "" {
+			if n, err := strconv.Atoi(val); err == nil {
+				replay.replayer.DropAfter = n
+			}
+		}
+		log.Printf("polar: replaying %d packets from %s instead of using bluetooth", len(rec.Packets), path)
+	}
+	return replay.replayer, nil
+}
+
+func (r *registered) Start(ctx context.Context) error {
+	if r.PolarSensor == nil {
+		return fmt.Errorf("polar sensor %s is not open", r.cfg.Name)
+	}
+	if err := r.startPolarSensor(ctx); err != nil {
+		return err
+	}
+	go func() {
+		defer close(r.readings)
+		for rd := range r.PolarSensor.readings {
+			rd.Sensor = r.cfg.Name
+			select {
+			case r.readings <- rd:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (r *registered) Readings() <-chan sensor.Reading { return r.readings }
+
+func (r *registered) Close() error {
+	if r.PolarSensor == nil {
+		return nil
+	}
+	return r.close()
+}
+
+// Info adds the strap's model, serial number, and firmware revision once it
+// is open.
+func (r *registered) Info() sensor.Info {
+	info := sensor.Info{Name: r.cfg.Name, Driver: "polar", Port: r.cfg.MAC}
+	if r.PolarSensor != nil {
+		di := r.PolarSensor.Info()
+		info.Model, info.SerialNumber, info.SoftwareVersion = di.Model, di.SerialNumber, di.Firmware
+	}
+	return info
+}
@@ -0,0 +1,159 @@
+package portworker
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var ErrStopped = errors.New("port worker is not running")
+
+// Priority orders queued operations; higher runs first, FIFO within a level.
+type Priority int
+
+const (
+	Routine     Priority = iota // periodic polls
+	Operator                    // commands a person is waiting on
+	Calibration                 // steps of a calibration sequence, which must not be held up mid-procedure
+	levels
+)
+
+// Worker owns one device's port and runs every operation on it (polls, info
+// queries, calibration commands) one at a time on a single goroutine. A
+// command and its response can therefore never interleave with another
+// caller's on the wire, however many goroutines share the driver. Waiting
+// operations are served by priority, so an operator command only waits for
+// the poll in progress, not for every poll queued behind it.
+type Worker struct {
+	lock    sync.Mutex
+	cond    *sync.Cond
+	queues  [levels][]*job
+	running bool
+	done    chan struct{}
+}
+
+type job struct {
+	ctx     context.Context
+	fn      func() error
+	res     chan error
+	started bool
+}
+
+// Start launches the worker goroutine. It is a no-op while already running,
+// and a stopped worker can be started again (e.g. when a port is reopened).
+func (w *Worker) Start() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.running {
+		return
+	}
+	if w.cond == nil {
+		w.cond = sync.NewCond(&w.lock)
+	}
+	w.running = true
+	w.done = make(chan struct{})
+	go w.run(w.done)
+}
+
+func (w *Worker) run(done chan struct{}) {
+	defer close(done)
+	for {
+		j := w.next()
+		if j == nil {
+			return
+		}
+		if err := j.ctx.Err(); err != nil { // expired while queued
+			j.res <- err
+			continue
+		}
+		j.res <- j.fn()
+	}
+}
+
+// next blocks for the highest-priority waiting job, or returns nil once the
+// worker is stopped.
+func (w *Worker) next() *job {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	for w.running {
+		for p := levels - 1; p >= 0; p-- {
+			if q := w.queues[p]; len(q) > 0 {
+				j := q[0]
+				w.queues[p] = q[1:]
+				j.started = true
+				return j
+			}
+		}
+		w.cond.Wait()
+	}
+	return nil
+}
+
+// Do runs fn at Routine priority with no deadline.
+func (w *Worker) Do(fn func() error) error {
+	return w.Submit(context.Background(), Routine, fn)
+}
+
+// Submit queues fn at priority p and returns its error once it has run on the
+// worker goroutine. If ctx is done first, Submit returns ctx.Err() right away:
+// a queued fn is dropped, while one already started runs to completion on the
+// worker (a command on the wire must still consume its reply) and its result
+// is discarded. It returns ErrStopped if the worker is not running or stops
+// before fn is picked up. fn must not call Do, Submit, or Stop on the same
+// worker.
+func (w *Worker) Submit(ctx context.Context, p Priority, fn func() error) error {
+	p = min(max(p, Routine), levels-1)
+	j := &job{ctx: ctx, fn: fn, res: make(chan error, 1)}
+
+	w.lock.Lock()
+	if !w.running {
+		w.lock.Unlock()
+		return ErrStopped
+	}
+	w.queues[p] = append(w.queues[p], j)
+	w.cond.Signal()
+	w.lock.Unlock()
+
+	select {
+	case err := <-j.res:
+		return err
+	case <-ctx.Done():
+	}
+	w.lock.Lock()
+	if !j.started {
+		w.remove(p, j)
+	}
+	w.lock.Unlock()
+	return ctx.Err()
+}
+
+func (w *Worker) remove(p Priority, j *job) {
+	q := w.queues[p]
+	for i := range q {
+		if q[i] == j {
+			w.queues[p] = append(q[:i:i], q[i+1:]...)
+			return
+		}
+	}
+}
+
+// Stop waits for the running operation, if any, to finish and then stops the
+// goroutine. Operations still queued get ErrStopped.
+func (w *Worker) Stop() {
+	w.lock.Lock()
+	if !w.running {
+		w.lock.Unlock()
+		return
+	}
+	w.running = false
+	for p := range w.queues {
+		for _, j := range w.queues[p] {
+			j.res <- ErrStopped
+		}
+		w.queues[p] = nil
+	}
+	done := w.done
+	w.cond.Broadcast()
+	w.lock.Unlock()
+	<-done
+}
@@ -0,0 +1,23 @@
+package power
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+)
+
+const i2cSlave = 0x0703 // ioctl selecting the device later reads and writes address
+
+func openI2C(bus, address int) (io.ReadWriteCloser, error) {
+	path := fmt.Sprintf("/dev/i2c-%d", bus)
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), i2cSlave, uintptr(address)); errno != 0 {
+		f.Close()
+		return nil, fmt.Errorf("failed to address 0x%02x on %s: %v", address, path, errno)
+	}
+	return f, nil
+}
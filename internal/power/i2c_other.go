@@ -0,0 +1,12 @@
+//go:build !linux
+
+package power
+
+import (
+	"fmt"
+	"io"
+)
+
+func openI2C(bus, address int) (io.ReadWriteCloser, error) {
+	return nil, fmt.Errorf("i2c is only supported on linux")
+}
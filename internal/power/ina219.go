@@ -0,0 +1,70 @@
+package power
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// INA219 registers.
+const (
+	regShuntVoltage = 0x01 // signed, 10 µV per bit
+	regBusVoltage   = 0x02 // bits 15-3, 4 mV per bit
+)
+
+// discharging is the shunt reading, in 10 µV steps, below which current is
+// flowing out of the battery. The margin keeps a full battery's trickle from
+// flapping between on_battery and on_mains.
+const discharging = -10
+
+// INA219 reads a UPS HAT's battery through its INA219 current sensor (e.g.
+// the Waveshare UPS HAT at address 0x42 on I2C bus 1). Charge is estimated
+// from the voltage between EmptyVoltage and FullVoltage.
+type INA219 struct {
+	EmptyVoltage float64 // default 3.0 V
+	FullVoltage  float64 // default 4.2 V
+
+	dev io.ReadWriteCloser
+}
+
+// OpenINA219 opens the INA219 at address on /dev/i2c-<bus>. Linux only.
+func OpenINA219(bus, address int) (*INA219, error) {
+	dev, err := openI2C(bus, address)
+	if err != nil {
+		return nil, err
+	}
+	return &INA219{EmptyVoltage: 3.0, FullVoltage: 4.2, dev: dev}, nil
+}
+
+func (s *INA219) Read(ctx context.Context) (Status, error) {
+	bus, err := s.register(regBusVoltage)
+	if err != nil {
+		return Status{}, fmt.Errorf("failed to read ina219 bus voltage: %w", err)
+	}
+	shunt, err := s.register(regShuntVoltage)
+	if err != nil {
+		return Status{}, fmt.Errorf("failed to read ina219 shunt voltage: %w", err)
+	}
+	v := float64(bus>>3) * 0.004
+	return Status{
+		Voltage:   v,
+		Battery:   charge(v, s.EmptyVoltage, s.FullVoltage),
+		OnBattery: int16(shunt) < discharging,
+	}, nil
+}
+
+// register reads a 16-bit register, sent big-endian.
+func (s *INA219) register(reg byte) (uint16, error) {
+	if _, err := s.dev.Write([]byte{reg}); err != nil {
+		return 0, err
+	}
+	var b [2]byte
+	if _, err := io.ReadFull(s.dev, b[:]); err != nil {
+		return 0, err
+	}
+	return uint16(b[0])<<8 | uint16(b[1]), nil
+}
+
+func (s *INA219) Close() error {
+	return s.dev.Close()
+}
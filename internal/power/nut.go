@@ -0,0 +1,106 @@
+package power
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// nutTimeout bounds one exchange with upsd.
+const nutTimeout = 5 * time.Second
+
+// errNoVar is upsd's answer for a variable the UPS does not report.
+var errNoVar = errors.New("variable not supported")
+
+// NUT reads a UPS through a Network UPS Tools server (upsd). Each Read is a
+// short connection of its own, so a restarted upsd needs no reconnect.
+type NUT struct {
+	Addr string // host:port, default localhost:3493
+	UPS  string // UPS name in ups.conf, default "ups"
+}
+
+func (n *NUT) Read(ctx context.Context) (Status, error) {
+	addr, ups := n.Addr, n.UPS
+	if addr == "" {
+		addr = "localhost:3493"
+	}
+	if ups == "" {
+		ups = "ups"
+	}
+	d := net.Dialer{Timeout: nutTimeout}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return Status{}, fmt.Errorf("failed to reach upsd: %w", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(nutTimeout))
+	r := bufio.NewReader(conn)
+	get := func(name string) (string, error) {
+		if _, err := fmt.Fprintf(conn, "GET VAR %s %s\n", ups, name); err != nil {
+			return "", err
+		}
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		return parseVar(strings.TrimSpace(line), ups, name)
+	}
+
+	status, err := get("ups.status") // e.g. "OB DISCHRG LB"
+	if err != nil {
+		return Status{}, fmt.Errorf("failed to read %s status: %w", ups, err)
+	}
+	st := Status{Battery: -1}
+	for _, flag := range strings.Fields(status) {
+		switch flag {
+		case "OB":
+			st.OnBattery = true
+		case "LB":
+			st.LowBattery = true
+		}
+	}
+	for _, v := range []struct {
+		name  string
+		field *float64
+	}{
+		{"battery.charge", &st.Battery},
+		{"battery.voltage", &st.Voltage},
+	} {
+		s, err := get(v.name)
+		if errors.Is(err, errNoVar) {
+			continue
+		} else if err != nil {
+			return Status{}, fmt.Errorf("failed to read %s %s: %w", ups, v.name, err)
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return Status{}, fmt.Errorf("%s %s: bad value %q", ups, v.name, s)
+		}
+		*v.field = f
+	}
+	fmt.Fprintf(conn, "LOGOUT\n")
+	return st, nil
+}
+
+// parseVar reads a GET VAR reply: VAR <ups> <name> "<value>", or ERR <code>.
+func parseVar(line, ups, name string) (string, error) {
+	if code, ok := strings.CutPrefix(line, "ERR "); ok {
+		if code == "VAR-NOT-SUPPORTED" {
+			return "", errNoVar
+		}
+		return "", fmt.Errorf("upsd: %s", code)
+	}
+	prefix := fmt.Sprintf("VAR %s %s ", ups, name)
+	value, ok := strings.CutPrefix(line, prefix)
+	if !ok {
+		return "", fmt.Errorf("unexpected upsd reply %q", line)
+	}
+	return strings.Trim(value, `"`), nil
+}
+
+func (n *NUT) Close() error { return nil }
@@ -0,0 +1,98 @@
+// Package power watches the rig's supply, from an INA219 on an I2C UPS HAT
+// or from a NUT server, and decides when the battery is too low to keep
+// recording.
+package power
+
+import (
+	"context"
+	"time"
+)
+
+// Status is one reading of the supply.
+type Status struct {
+	Voltage    float64 // battery or supply voltage, V; 0 when the source does not report it
+	Battery    float64 // charge in percent, negative when unknown
+	OnBattery  bool
+	LowBattery bool // the source itself says the battery is low, e.g. NUT's LB flag
+}
+
+// Source reads the supply.
+type Source interface {
+	Read(ctx context.Context) (Status, error)
+	Close() error
+}
+
+// Event is a change in the supply, recorded as a session annotation.
+type Event struct {
+	Annotation string    `json:"annotation"` // "power"
+	Event      string    `json:"event"`      // "on_battery", "on_mains", "low_battery", or "shutdown"
+	Voltage    float64   `json:"voltage,omitempty"`
+	Battery    *float64  `json:"battery,omitempty"` // percent, nil when unknown
+	Time       time.Time `json:"time"`
+}
+
+// Monitor turns readings into events. The rig shuts down once the battery
+// has read low Confirm times in a row while on battery, so one noisy reading
+// under load cannot stop a session.
+type Monitor struct {
+	LowBattery float64 // percent at or below which the battery is low, default 10
+	Confirm    int     // consecutive low readings before shutting down, default 3
+
+	known     bool
+	onBattery bool
+	low       int
+	shutdown  bool
+}
+
+// Observe records st, read at t, and returns the events it raises and
+// whether the rig should shut down now. Shutdown is reported once.
+func (m *Monitor) Observe(st Status, t time.Time) ([]Event, bool) {
+	lowAt, confirm := m.LowBattery, m.Confirm
+	if lowAt <= 0 {
+		lowAt = 10
+	}
+	if confirm <= 0 {
+		confirm = 3
+	}
+	event := func(name string) Event {
+		e := Event{Annotation: "power", Event: name, Voltage: st.Voltage, Time: t}
+		if st.Battery >= 0 {
+			pct := st.Battery
+			e.Battery = &pct
+		}
+		return e
+	}
+
+	var events []Event
+	if st.OnBattery != m.onBattery || (!m.known && st.OnBattery) {
+		if st.OnBattery {
+			events = append(events, event("on_battery"))
+		} else {
+			events = append(events, event("on_mains"))
+		}
+	}
+	m.known, m.onBattery = true, st.OnBattery
+
+	low := st.OnBattery && (st.LowBattery || (st.Battery >= 0 && st.Battery <= lowAt))
+	if !low {
+		m.low = 0
+		return events, false
+	}
+	m.low++
+	if m.low == 1 {
+		events = append(events, event("low_battery"))
+	}
+	if m.low >= confirm && !m.shutdown {
+		m.shutdown = true
+		events = append(events, event("shutdown"))
+		return events, true
+	}
+	return events, false
+}
+
+// charge estimates a single-cell lithium battery's charge from its voltage,
+// linearly between empty and full.
+func charge(v, empty, full float64) float64 {
+	pct := (v - empty) / (full - empty) * 100
+	return min(max(pct, 0), 100)
+}
@@ -0,0 +1,184 @@
+// Package privacy keeps the people and devices in a study from being
+// identified by what the daemon records: subjects are replaced with rotating
+// pseudonyms, mapped back only in a local key file, and device MAC addresses
+// are stripped from text.
+package privacy
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// DefaultKeyMap is where pseudonyms are mapped back to subjects.
+const DefaultKeyMap = "/var/lib/sensorctl/pseudonyms.json"
+
+var macAddress = regexp.MustCompile(`\b[0-9A-Fa-f]{2}(?:[:-][0-9A-Fa-f]{2}){5}\b`)
+
+// StripMACs replaces every MAC address in s, e.g. a BLE address in a
+// connection error, with "[mac]".
+func StripMACs(s string) string {
+	return macAddress.ReplaceAllString(s, "[mac]")
+}
+
+// Issue is one pseudonym handed out for a subject.
+type Issue struct {
+	Pseudonym string    `json:"pseudonym"`
+	Subject   string    `json:"subject"`
+	Issued    time.Time `json:"issued"`
+}
+
+// Pseudonyms issues pseudonyms and records each in the key map, which only
+// the daemon's user can read.
+type Pseudonyms struct {
+	mu     sync.Mutex
+	path   string
+	rotate time.Duration
+	issued []Issue
+}
+
+// Open loads the key map at path, creating it on first use. A subject keeps
+// its pseudonym for rotate; with 0 every call to For issues a new one.
+func Open(path string, rotate time.Duration) (*Pseudonyms, error) {
+	if path == "" {
+		path = DefaultKeyMap
+	}
+	p := &Pseudonyms{path: path, rotate: rotate}
+	issued, err := load(path)
+	if err != nil {
+		return nil, err
+	}
+	p.issued = issued
+	return p, nil
+}
+
+// For returns the subject's pseudonym at now, issuing and recording a new one
+// when the last has expired.
+func (p *Pseudonyms) For(subject string, now time.Time) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.rotate > 0 {
+		for i := len(p.issued) - 1; i >= 0; i-- {
+			if is := p.issued[i]; is.Subject == subject {
+				if now.Sub(is.Issued) < p.rotate {
+					return is.Pseudonym, nil
+				}
+				break
+			}
+		}
+	}
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	is := Issue{Pseudonym: "p-" + hex.EncodeToString(b), Subject: subject, Issued: now.UTC()}
+	if err := save(p.path, append(p.issued, is)); err != nil {
+		return "", err
+	}
+	p.issued = append(p.issued, is)
+	return is.Pseudonym, nil
+}
+
+// Issued lists every pseudonym the subject has been given.
+func (p *Pseudonyms) Issued(subject string) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var names []string
+	for _, is := range p.issued {
+		if is.Subject == subject {
+			names = append(names, is.Pseudonym)
+		}
+	}
+	return names
+}
+
+// Subject returns the subject behind a pseudonym in the key map.
+func (p *Pseudonyms) Subject(pseudonym string) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, is := range p.issued {
+		if is.Pseudonym == pseudonym {
+			return is.Subject, true
+		}
+	}
+	return "", false
+}
+
+// Forget removes the subject's pseudonyms from the key map, after which
+// nothing recorded under them can be traced back to the subject.
+func (p *Pseudonyms) Forget(subject string) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	kept := make([]Issue, 0, len(p.issued))
+	for _, is := range p.issued {
+		if is.Subject != subject {
+			kept = append(kept, is)
+		}
+	}
+	n := len(p.issued) - len(kept)
+	if n == 0 {
+		return 0, nil
+	}
+	if err := save(p.path, kept); err != nil {
+		return 0, err
+	}
+	p.issued = kept
+	return n, nil
+}
+
+// Lookup finds the subject behind pseudonym in the key map at path.
+func Lookup(path, pseudonym string) (Issue, error) {
+	if path == "" {
+		path = DefaultKeyMap
+	}
+	issued, err := load(path)
+	if err != nil {
+		return Issue{}, err
+	}
+	for _, is := range issued {
+		if is.Pseudonym == pseudonym {
+			return is, nil
+		}
+	}
+	return Issue{}, fmt.Errorf("pseudonym %s is not in %s", pseudonym, path)
+}
+
+func load(path string) ([]Issue, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read pseudonym key map: %w", err)
+	}
+	var issued []Issue
+	if err := json.Unmarshal(data, &issued); err != nil {
+		return nil, fmt.Errorf("failed to parse pseudonym key map %s: %v", path, err)
+	}
+	return issued, nil
+}
+
+// save replaces the key map in one rename, so a crash never leaves pseudonyms
+// that cannot be mapped back.
+func save(path string, issued []Issue) error {
+	data, err := json.MarshalIndent(issued, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create pseudonym key map dir: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("failed to write pseudonym key map: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write pseudonym key map: %w", err)
+	}
+	return nil
+}
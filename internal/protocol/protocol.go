@@ -0,0 +1,312 @@
+package protocol
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/demelere/sensor-control-modules/internal/uncertainty"
+)
+
+// ResultSuffix names a run's result file after the session it ran with.
+const ResultSuffix = ".protocol.json"
+
+// Duration is a time.Duration that reads and writes as a Go duration string
+// ("3m", "90s") in protocol and result files.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"90s\": %v", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("failed to parse duration %q: %v", s, err)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+type Stage struct {
+	Name           string   `json:"name"`
+	Duration       Duration `json:"duration"`
+	TargetWorkW    float64  `json:"target_work_w,omitempty"`
+	TargetFlowSCFM float64  `json:"target_flow_scfm,omitempty"`
+	Prompt         string   `json:"prompt,omitempty"`  // shown to the operator when the stage starts
+	Markers        []string `json:"markers,omitempty"` // recorded automatically when the stage starts
+	Sound          string   `json:"sound,omitempty"`   // WAV file played as an audio cue when the stage starts
+	Ramp           bool     `json:"ramp,omitempty"`    // part of the ramp thresholds are estimated over
+}
+
+// Protocol is a scripted sequence of stages, e.g. a graded exercise test.
+type Protocol struct {
+	Name   string  `json:"name"`
+	Stages []Stage `json:"stages"`
+}
+
+func LoadProtocol(path string) (*Protocol, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read protocol file: %v", err)
+	}
+
+	var p Protocol
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse protocol file: %v", err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (p *Protocol) Validate() error {
+	if len(p.Stages) == 0 {
+		return fmt.Errorf("protocol %q has no stages", p.Name)
+	}
+	for i, s := range p.Stages {
+		if s.Duration <= 0 {
+			return fmt.Errorf("stage %d (%s) has no duration", i, s.Name)
+		}
+	}
+	return nil
+}
+
+type Marker struct {
+	Time  time.Time `json:"time"`
+	Stage string    `json:"stage"`
+	Label string    `json:"label"`
+}
+
+type MetricSummary struct {
+	Count int     `json:"count"`
+	Mean  float64 `json:"mean"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+
+	// populated only for metrics recorded with RecordUncertain; the mean's
+	// uncertainty is treated as systematic, so it does not shrink with Count
+	StdDev    float64 `json:"std_dev,omitempty"`
+	CI95Lower float64 `json:"ci95_lower,omitempty"`
+	CI95Upper float64 `json:"ci95_upper,omitempty"`
+}
+
+func (ms *MetricSummary) add(v float64) {
+	if ms.Count == 0 {
+		ms.Min, ms.Max = v, v
+	}
+	ms.Count++
+	ms.Mean += (v - ms.Mean) / float64(ms.Count)
+	ms.Min = math.Min(ms.Min, v)
+	ms.Max = math.Max(ms.Max, v)
+}
+
+func (ms *MetricSummary) addUncertain(q uncertainty.Quantity) {
+	ms.add(q.Value)
+	ms.StdDev += (q.StdDev - ms.StdDev) / float64(ms.Count)
+	ms.CI95Lower, ms.CI95Upper = uncertainty.Quantity{Value: ms.Mean, StdDev: ms.StdDev}.CI95()
+}
+
+type StageResult struct {
+	Stage     Stage                     `json:"stage"`
+	Start     time.Time                 `json:"start"`
+	End       time.Time                 `json:"end"`
+	Completed bool                      `json:"completed"`
+	Metrics   map[string]*MetricSummary `json:"metrics"`
+}
+
+// Result is the structured stage-by-stage record of one protocol run.
+type Result struct {
+	Protocol string        `json:"protocol"`
+	Start    time.Time     `json:"start"`
+	End      time.Time     `json:"end"`
+	Aborted  bool          `json:"aborted"`
+	Stages   []StageResult `json:"stages"`
+	Markers  []Marker      `json:"markers"`
+}
+
+// Runner executes a Protocol in real time. Measurements fed in with Record are
+// summarised against whichever stage is active when they arrive.
+type Runner struct {
+	protocol Protocol
+	lock     sync.Mutex
+	current  int
+	result   Result
+	onStage  []func(Stage)
+}
+
+func NewRunner(p Protocol) (*Runner, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return &Runner{
+		protocol: p,
+		current:  -1,
+		result:   Result{Protocol: p.Name},
+	}, nil
+}
+
+// OnStage registers a callback invoked at the start of every stage, after the
+// stage's automatic markers have been recorded.
+func (r *Runner) OnStage(fn func(Stage)) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.onStage = append(r.onStage, fn)
+}
+
+// Run blocks until every stage has elapsed or ctx is cancelled. The partial
+// result is still available after cancellation.
+func (r *Runner) Run(ctx context.Context) (*Result, error) {
+	r.lock.Lock()
+	r.result.Start = time.Now()
+	r.lock.Unlock()
+
+	for i, stage := range r.protocol.Stages {
+		r.startStage(i)
+
+		timer := time.NewTimer(time.Duration(stage.Duration))
+		select {
+		case <-timer.C:
+			r.endStage(true)
+		case <-ctx.Done():
+			timer.Stop()
+			r.endStage(false)
+			return r.finish(true), ctx.Err()
+		}
+	}
+
+	return r.finish(false), nil
+}
+
+func (r *Runner) startStage(i int) {
+	stage := r.protocol.Stages[i]
+	now := time.Now()
+
+	r.lock.Lock()
+	r.current = i
+	r.result.Stages = append(r.result.Stages, StageResult{
+		Stage:   stage,
+		Start:   now,
+		Metrics: make(map[string]*MetricSummary),
+	})
+	for _, label := range stage.Markers {
+		r.result.Markers = append(r.result.Markers, Marker{Time: now, Stage: stage.Name, Label: label})
+	}
+	hooks := append([]func(Stage){}, r.onStage...)
+	r.lock.Unlock()
+
+	log.Printf("protocol %s: stage %d/%d %s (%s)", r.protocol.Name, i+1, len(r.protocol.Stages), stage.Name, time.Duration(stage.Duration))
+	if stage.Prompt != "" {
+		log.Printf("operator prompt: %s", stage.Prompt)
+	}
+	for _, fn := range hooks {
+		fn(stage)
+	}
+}
+
+func (r *Runner) endStage(completed bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	sr := &r.result.Stages[len(r.result.Stages)-1]
+	sr.End = time.Now()
+	sr.Completed = completed
+	r.current = -1
+}
+
+func (r *Runner) finish(aborted bool) *Result {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.result.End = time.Now()
+	r.result.Aborted = aborted
+	res := r.result.clone()
+	return &res
+}
+
+// clone copies res down to its metric summaries, so a Result handed out
+// does not change under its reader when a late Record or Mark arrives.
+func (res Result) clone() Result {
+	out := res
+	out.Stages = make([]StageResult, len(res.Stages))
+	for i, sr := range res.Stages {
+		sr.Stage.Markers = append([]string(nil), sr.Stage.Markers...)
+		metrics := make(map[string]*MetricSummary, len(sr.Metrics))
+		for name, ms := range sr.Metrics {
+			c := *ms
+			metrics[name] = &c
+		}
+		sr.Metrics = metrics
+		out.Stages[i] = sr
+	}
+	out.Markers = append([]Marker(nil), res.Markers...)
+	return out
+}
+
+// Record adds a measurement to the active stage. Values recorded between
+// stages or after the run are ignored.
+func (r *Runner) Record(metric string, value float64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if ms := r.summary(metric); ms != nil {
+		ms.add(value)
+	}
+}
+
+// RecordUncertain is Record for values carrying a propagated uncertainty; the
+// stage summary then also reports a 95% confidence interval.
+func (r *Runner) RecordUncertain(metric string, q uncertainty.Quantity) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if ms := r.summary(metric); ms != nil {
+		ms.addUncertain(q)
+	}
+}
+
+func (r *Runner) summary(metric string) *MetricSummary {
+	if r.current < 0 {
+		return nil
+	}
+	metrics := r.result.Stages[len(r.result.Stages)-1].Metrics
+	ms, ok := metrics[metric]
+	if !ok {
+		ms = &MetricSummary{}
+		metrics[metric] = ms
+	}
+	return ms
+}
+
+// Mark records an operator or analysis marker against the active stage.
+func (r *Runner) Mark(label string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	stage := ""
+	if r.current >= 0 {
+		stage = r.protocol.Stages[r.current].Name
+	}
+	r.result.Markers = append(r.result.Markers, Marker{Time: time.Now(), Stage: stage, Label: label})
+}
+
+func (res *Result) WriteFile(path string) error {
+	data, err := json.MarshalIndent(res, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode protocol result: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write protocol result: %v", err)
+	}
+	return nil
+}
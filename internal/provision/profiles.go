@@ -0,0 +1,128 @@
+package provision
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/demelere/sensor-control-modules/internal/config"
+)
+
+// MatchProfile picks the profile for a sensor: the one named explicitly, or
+// else the first whose model is empty or equal. Either way the driver must
+// match, so one driver's settings are never sent to another's device.
+func MatchProfile(profiles []config.SensorProfile, driver, model, explicit string) (config.SensorProfile, bool) {
+	for _, p := range profiles {
+		if p.Driver != driver {
+			continue
+		}
+		if explicit != "" {
+			if p.Name == explicit {
+				return p, true
+			}
+			continue
+		}
+		if p.Model == "" || p.Model == model {
+			return p, true
+		}
+	}
+	return config.SensorProfile{}, false
+}
+
+// Provisioned is one serial number that has had its profile applied.
+type Provisioned struct {
+	Profile string    `json:"profile"`
+	At      time.Time `json:"at"`
+}
+
+// Ledger remembers which serial numbers have been provisioned, so a profile
+// is applied once per probe rather than on every connection, and a probe
+// swapped in later is still provisioned on first contact.
+type Ledger struct {
+	path    string
+	lock    sync.Mutex
+	entries map[string]Provisioned // "driver/serial"
+}
+
+// OpenLedger loads the ledger at path; a missing file is an empty ledger.
+func OpenLedger(path string) (*Ledger, error) {
+	l := &Ledger{path: path, entries: map[string]Provisioned{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return l, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read provisioning ledger: %w", err)
+	}
+	if err := json.Unmarshal(data, &l.entries); err != nil {
+		return nil, fmt.Errorf("failed to parse provisioning ledger %s: %v", path, err)
+	}
+	return l, nil
+}
+
+// Has reports whether the probe was provisioned with profile.
+func (l *Ledger) Has(driver, serial, profile string) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	e, ok := l.entries[driver+"/"+serial]
+	return ok && e.Profile == profile
+}
+
+// Record marks the probe provisioned and saves the ledger atomically.
+func (l *Ledger) Record(driver, serial, profile string, at time.Time) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.entries[driver+"/"+serial] = Provisioned{Profile: profile, At: at.UTC()}
+
+	data, err := json.MarshalIndent(l.entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode provisioning ledger: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o755); err != nil {
+		return fmt.Errorf("failed to write provisioning ledger: %w", err)
+	}
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write provisioning ledger: %w", err)
+	}
+	if err := os.Rename(tmp, l.path); err != nil {
+		return fmt.Errorf("failed to write provisioning ledger: %w", err)
+	}
+	return nil
+}
+
+// Mismatch is a device setting whose read-back value differs from its
+// profile. Got is empty if the device did not report the setting.
+type Mismatch struct {
+	Setting string `json:"setting"`
+	Want    string `json:"want"`
+	Got     string `json:"got"`
+}
+
+func (m Mismatch) String() string {
+	return fmt.Sprintf("%s: profile wants %q, device has %q", m.Setting, m.Want, m.Got)
+}
+
+// Audit compares the settings read back from a device with its profile,
+// ignoring case and runs of whitespace, and returns the mismatches sorted by
+// setting.
+func Audit(want, got map[string]string) []Mismatch {
+	var mismatches []Mismatch
+	for name, w := range want {
+		g := got[name]
+		if normalize(w) != normalize(g) {
+			mismatches = append(mismatches, Mismatch{Setting: name, Want: w, Got: g})
+		}
+	}
+	sort.Slice(mismatches, func(i, j int) bool { return mismatches[i].Setting < mismatches[j].Setting })
+	return mismatches
+}
+
+func normalize(v string) string {
+	return strings.ToLower(strings.Join(strings.Fields(v), " "))
+}
@@ -0,0 +1,198 @@
+package provision
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/demelere/sensor-control-modules/internal/config"
+)
+
+var (
+	provisionUSBGlobs    []string
+	provisionWPAConfPath string
+)
+
+func init() {
+	provisionUSBGlobs = []string{"/media/*/sensorctl.json", "/media/*/*/sensorctl.json", "/mnt/usb*/sensorctl.json"}
+	provisionWPAConfPath = "/etc/wpa_supplicant/wpa_supplicant.conf"
+}
+
+// FindUSBConfig returns the first sensorctl.json found on a mounted USB stick.
+func FindUSBConfig() (string, bool) {
+	for _, pattern := range provisionUSBGlobs {
+		matches, _ := filepath.Glob(pattern)
+		if len(matches) > 0 {
+			return matches[0], true
+		}
+	}
+	return "", false
+}
+
+// ApplyWiFi appends the configured network to wpa_supplicant's config. It is
+// a no-op when no SSID was provided.
+// An empty PSK adds an open network.
+func ApplyWiFi(w config.WiFi) error {
+	if w.SSID == "" {
+		return nil
+	}
+	if err := checkWiFi(w); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(provisionWPAConfPath, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", provisionWPAConfPath, err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(wpaNetwork(w)); err != nil {
+		return fmt.Errorf("failed to write wifi network: %w", err)
+	}
+	log.Printf("added wifi network %q to %s", w.SSID, provisionWPAConfPath)
+	return nil
+}
+
+// checkWiFi rejects a network wpa_supplicant would not accept: an SSID is at
+// most 32 bytes, and a passphrase is 8 to 63 printable ASCII characters.
+func checkWiFi(w config.WiFi) error {
+	if len(w.SSID) > 32 {
+		return fmt.Errorf("wifi SSID is %d bytes, the limit is 32", len(w.SSID))
+	}
+	if w.PSK == "" {
+		return nil
+	}
+	if n := len(w.PSK); n < 8 || n > 63 {
+		return fmt.Errorf("wifi password must be 8 to 63 characters, got %d", n)
+	}
+	if !printableASCII(w.PSK) {
+		return fmt.Errorf("wifi password must be printable ASCII")
+	}
+	return nil
+}
+
+// wpaNetwork is w's network block for wpa_supplicant.conf.
+func wpaNetwork(w config.WiFi) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "\nnetwork={\n\tssid=%s\n", wpaString(w.SSID))
+	if w.PSK == "" {
+		b.WriteString("\tkey_mgmt=NONE\n")
+	} else {
+		fmt.Fprintf(&b, "\tpsk=\"%s\"\n", w.PSK)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// wpaString writes s the way wpa_supplicant reads strings: between double
+// quotes, taken literally with no escapes, or, for an SSID that is not
+// printable ASCII, as bare hex.
+func wpaString(s string) string {
+	if printableASCII(s) {
+		return `"` + s + `"`
+	}
+	return hex.EncodeToString([]byte(s))
+}
+
+func printableASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x20 || s[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+var page = template.Must(template.New("setup").Parse(`<!doctype html>
+<html><head><meta name="viewport" content="width=device-width"><title>Rig setup</title></head>
+<body style="font-family:sans-serif;max-width:32em;margin:2em auto">
+<h1>Rig setup</h1>
+{{if .Error}}<p style="color:red">{{.Error}}</p>{{end}}
+<form method="post">
+<p><label>Site ID<br><input name="site_id" value="{{.Config.SiteID}}" required></label></p>
+<fieldset><legend>WiFi</legend>
+<p><label>SSID<br><input name="wifi_ssid" value="{{.Config.WiFi.SSID}}"></label></p>
+<p><label>Password<br><input name="wifi_psk" type="password"></label></p>
+</fieldset>
+<fieldset><legend>Export</legend>
+<p><label>URL<br><input name="export_url" value="{{.Config.Export.URL}}"></label></p>
+<p><label>Token<br><input name="export_token" type="password"></label></p>
+</fieldset>
+<fieldset><legend>Attached sensors</legend>
+{{range $i, $s := .Config.Sensors}}
+<p><label><input type="checkbox" name="sensor_{{$i}}" {{if $s.Enabled}}checked{{end}}> {{$s.Name}} ({{$s.Driver}})</label>
+{{if eq $s.Driver "polar"}}<br><label>MAC <input name="mac_{{$i}}" value="{{$s.MAC}}"></label>{{end}}</p>
+{{end}}
+</fieldset>
+<p><button type="submit">Save and start</button></p>
+</form></body></html>`))
+
+// Serve runs the setup page on addr until the operator submits it, then
+// returns the completed config. base supplies the initial form values.
+func Serve(ctx context.Context, addr string, base *config.Config) (*config.Config, error) {
+	done := make(chan *config.Config, 1)
+	var mu sync.Mutex // guards cfg against concurrent submissions
+	cfg := *base
+	cfg.Sensors = append([]config.Sensor(nil), base.Sensors...)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		data := struct {
+			Config *config.Config
+			Error  string
+		}{Config: &cfg}
+
+		if r.Method == http.MethodPost {
+			if err := r.ParseForm(); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			cfg.SiteID = strings.TrimSpace(r.FormValue("site_id"))
+			cfg.WiFi = config.WiFi{SSID: r.FormValue("wifi_ssid"), PSK: r.FormValue("wifi_psk")}
+			cfg.Export = config.Export{URL: r.FormValue("export_url"), Token: r.FormValue("export_token")}
+			for i := range cfg.Sensors {
+				cfg.Sensors[i].Enabled = r.FormValue(fmt.Sprintf("sensor_%d", i)) != ""
+				if mac := r.FormValue(fmt.Sprintf("mac_%d", i)); mac != "" {
+					cfg.Sensors[i].MAC = strings.TrimSpace(mac)
+				}
+			}
+			if cfg.SiteID == "" {
+				data.Error = "site ID is required"
+			} else if err := checkWiFi(cfg.WiFi); err != nil {
+				data.Error = err.Error()
+			} else {
+				fmt.Fprintln(w, "<p>Saved. The rig is starting normal operation; you can close this page.</p>")
+				submitted := cfg
+				submitted.Sensors = append([]config.Sensor(nil), cfg.Sensors...)
+				select {
+				case done <- &submitted:
+				default: // an earlier submission is already being applied
+				}
+				return
+			}
+		}
+		page.Execute(w, data)
+	})
+
+	srv := &http.Server{Addr: addr, Handler: mux}
+	errCh := make(chan error, 1)
+	go func() { errCh <- srv.ListenAndServe() }()
+	log.Printf("provisioning: setup page listening on %s", addr)
+
+	defer srv.Shutdown(context.Background())
+	select {
+	case c := <-done:
+		return c, nil
+	case err := <-errCh:
+		return nil, fmt.Errorf("provisioning server failed: %w", err)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,33 @@
+// Command gen writes the Python client for an OpenAPI spec. It is run by go
+// generate in internal/api:
+//
+//	go run ../pyclient/gen openapi.json ../../clients/python/sensorctl_client.py
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/demelere/sensor-control-modules/internal/pyclient"
+)
+
+func main() {
+	if len(os.Args) != 3 {
+		fmt.Fprintln(os.Stderr, "usage: gen <openapi.json> <client.py>")
+		os.Exit(2)
+	}
+	spec, err := os.ReadFile(os.Args[1])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	src, err := pyclient.Generate(spec)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(os.Args[2], src, 0o644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
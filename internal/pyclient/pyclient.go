@@ -0,0 +1,357 @@
+// Package pyclient generates clients/python/sensorctl_client.py from the
+// daemon's OpenAPI spec, one method per operation.
+package pyclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+type spec struct {
+	Servers []struct {
+		URL string `json:"url"`
+	} `json:"servers"`
+	Paths      map[string]map[string]operation `json:"paths"`
+	Components struct {
+		Parameters map[string]parameter `json:"parameters"`
+	} `json:"components"`
+}
+
+type operation struct {
+	OperationID string      `json:"operationId"`
+	Summary     string      `json:"summary"`
+	Parameters  []parameter `json:"parameters"`
+	RequestBody *struct {
+		Required bool `json:"required"`
+	} `json:"requestBody"`
+	Responses map[string]struct {
+		Content map[string]json.RawMessage `json:"content"`
+	} `json:"responses"`
+}
+
+// streams reports whether op answers with server-sent events.
+func (op operation) streams() bool {
+	_, ok := op.Responses["200"].Content["text/event-stream"]
+	return ok
+}
+
+type parameter struct {
+	Ref      string `json:"$ref"`
+	Name     string `json:"name"`
+	In       string `json:"in"`
+	Required bool   `json:"required"`
+}
+
+// methods are the HTTP methods in the order their operations are emitted for
+// a path.
+var methods = []string{"get", "put", "post", "delete"}
+
+// Generate returns the Python client for the OpenAPI spec.
+func Generate(data []byte) ([]byte, error) {
+	var s spec
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("pyclient: parse spec: %w", err)
+	}
+	if len(s.Servers) == 0 {
+		return nil, fmt.Errorf("pyclient: spec has no server")
+	}
+	version := strings.Trim(s.Servers[0].URL, "/")
+
+	paths := make([]string, 0, len(s.Paths))
+	for p := range s.Paths {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, header, version)
+	seen := map[string]bool{}
+	for _, path := range paths {
+		for _, m := range methods {
+			op, ok := s.Paths[path][m]
+			if !ok {
+				continue
+			}
+			if op.OperationID == "" {
+				return nil, fmt.Errorf("pyclient: %s %s has no operationId", strings.ToUpper(m), path)
+			}
+			name := snake(op.OperationID)
+			if seen[name] {
+				return nil, fmt.Errorf("pyclient: operation %s is defined twice", op.OperationID)
+			}
+			seen[name] = true
+			if err := writeMethod(&b, &s, name, strings.ToUpper(m), path, op); err != nil {
+				return nil, err
+			}
+		}
+	}
+	b.WriteString(footer)
+	return []byte(b.String()), nil
+}
+
+func writeMethod(b *strings.Builder, s *spec, name, method, path string, op operation) error {
+	var pathArgs, queryArgs, query []string
+	for _, p := range op.Parameters {
+		if p.Ref != "" {
+			ref, ok := s.Components.Parameters[strings.TrimPrefix(p.Ref, "#/components/parameters/")]
+			if !ok {
+				return fmt.Errorf("pyclient: %s: unknown parameter %s", op.OperationID, p.Ref)
+			}
+			p = ref
+		}
+		arg := pyName(p.Name)
+		switch p.In {
+		case "path":
+			pathArgs = append(pathArgs, arg)
+			path = strings.ReplaceAll(path, "{"+p.Name+"}", "{_segment("+arg+")}")
+		case "query":
+			queryArgs = append(queryArgs, arg+"=None")
+			value := arg
+			if p.Name == "lang" {
+				value = "lang or self.lang"
+			}
+			query = append(query, pyString(p.Name)+": "+value)
+		default:
+			return fmt.Errorf("pyclient: %s: %s parameters are not supported", op.OperationID, p.In)
+		}
+	}
+
+	args := append([]string{"self"}, pathArgs...)
+	if op.RequestBody != nil {
+		if op.RequestBody.Required {
+			args = append(args, "body")
+		} else {
+			queryArgs = append([]string{"body=None"}, queryArgs...)
+		}
+	}
+	if len(queryArgs) > 0 {
+		args = append(append(args, "*"), queryArgs...)
+	}
+
+	call := []string{pyString(method)}
+	if len(pathArgs) > 0 {
+		call = append(call, "f"+pyString(path))
+	} else {
+		call = append(call, pyString(path))
+	}
+	if len(query) > 0 {
+		call = append(call, "query={"+strings.Join(query, ", ")+"}")
+	}
+	if op.RequestBody != nil {
+		call = append(call, "body=body")
+	}
+	if op.streams() {
+		call = append(call, "stream=True")
+	}
+
+	fmt.Fprintf(b, "\n    def %s(%s):\n", name, strings.Join(args, ", "))
+	if op.Summary != "" {
+		writeDocstring(b, op.Summary)
+	}
+	fmt.Fprintf(b, "        return self._request(%s)\n", strings.Join(call, ", "))
+	return nil
+}
+
+// writeDocstring writes text as an indented docstring wrapped at 79 columns.
+func writeDocstring(b *strings.Builder, text string) {
+	const indent = "        "
+	text = strings.ReplaceAll(text, `\`, `\\`)
+	text = strings.ReplaceAll(text, `"""`, `\"\"\"`)
+	if !strings.HasSuffix(text, ".") {
+		text += "."
+	}
+	words := strings.Fields(text)
+	var lines []string
+	line := `"""`
+	for _, w := range words {
+		if line != `"""` && len(indent)+len(line)+1+len(w) > 79 {
+			lines = append(lines, line)
+			line = w
+			continue
+		}
+		if line == `"""` {
+			line += w
+		} else {
+			line += " " + w
+		}
+	}
+	line += `"""`
+	if len(lines) > 0 && len(indent)+len(line) > 79 {
+		lines = append(lines, strings.TrimSuffix(line, `"""`))
+		line = `"""`
+	}
+	for _, l := range append(lines, line) {
+		b.WriteString(indent + l + "\n")
+	}
+}
+
+// snake turns an operationId like getOpenAPI into get_open_api.
+func snake(id string) string {
+	r := []rune(id)
+	var b strings.Builder
+	for i, c := range r {
+		if i > 0 && unicode.IsUpper(c) {
+			prev := r[i-1]
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || i+1 < len(r) && unicode.IsLower(r[i+1]) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(c))
+	}
+	return b.String()
+}
+
+// pyName is a parameter's Python argument name; keywords get a trailing
+// underscore, so from becomes from_.
+func pyName(name string) string {
+	name = strings.NewReplacer("-", "_", ".", "_").Replace(name)
+	if pyKeywords[name] {
+		return name + "_"
+	}
+	return name
+}
+
+var pyKeywords = map[string]bool{
+	"and": true, "as": true, "assert": true, "async": true, "await": true,
+	"break": true, "class": true, "continue": true, "def": true, "del": true,
+	"elif": true, "else": true, "except": true, "finally": true, "for": true,
+	"from": true, "global": true, "if": true, "import": true, "in": true,
+	"is": true, "lambda": true, "nonlocal": true, "not": true, "or": true,
+	"pass": true, "raise": true, "return": true, "try": true, "while": true,
+	"with": true, "yield": true, "None": true, "True": true, "False": true,
+}
+
+// pyString quotes s as a Python string literal; paths need no escapes
+// beyond quotes and backslashes.
+func pyString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+const header = `"""Python client for the sensorctl daemon REST API.
+
+Generated from internal/api/openapi.json by internal/pyclient; do not edit.
+Run ` + "`go generate ./internal/api`" + ` after changing the spec.
+
+Standard library only, so it can be dropped next to a notebook:
+
+    from sensorctl_client import Client
+    c = Client("http://rig-3:8090", lang="de")
+    c.get_capabilities()["sensors"]
+    c.get_metric_metadata("co2")["label"]
+
+Each operation in the spec is a method named after its operationId. Path
+parameters are positional, a request body is the dict after them, and query
+parameters are keywords (from_ for from). JSON responses are decoded, other
+content is returned as bytes, and an empty response is None. Streams such as
+stream_logs return a generator of decoded events once the daemon accepts
+them, and run until it closes the stream.
+"""
+
+import json
+import time
+import urllib.error
+import urllib.parse
+import urllib.request
+
+API_VERSION = "%s"
+
+
+class APIError(Exception):
+    """Raised for non-2xx responses."""
+
+    def __init__(self, status, message):
+        super().__init__(f"sensorctl api: {status} {message}")
+        self.status = status
+        self.message = message
+
+
+class NotFound(APIError):
+    """Raised for 404 responses, e.g. an unknown metric."""
+
+
+def _segment(value):
+    return urllib.parse.quote(str(value), safe="")
+
+
+class Client:
+    def __init__(self, base_url, lang=None, timeout=10.0, retries=3, backoff=0.25):
+        self.base_url = base_url.rstrip("/")
+        self.lang = lang
+        self.timeout = timeout
+        self.retries = retries  # extra attempts after connection errors and 5xx responses; POST is not retried
+        self.backoff = backoff  # seconds before the first retry, doubled on each attempt
+
+    def has_feature(self, name):
+        return name in self.get_capabilities().get("features", [])
+`
+
+const footer = `
+    def _request(self, method, path, query=None, body=None, stream=False):
+        url = f"{self.base_url}/{API_VERSION}{path}"
+        query = {k: v for k, v in (query or {}).items() if v is not None}
+        if query:
+            url += "?" + urllib.parse.urlencode(query, doseq=True)
+        data = None if body is None else json.dumps(body).encode("utf-8")
+
+        if stream:
+            return self._events(self._open(method, url, data, "text/event-stream", None))
+        retries = self.retries if method in ("GET", "PUT", "DELETE") else 0
+        delay = self.backoff
+        for attempt in range(retries + 1):
+            if attempt:
+                time.sleep(delay)
+                delay *= 2
+            try:
+                return self._do(method, url, data)
+            except APIError as e:
+                if e.status < 500 or attempt == retries:
+                    raise
+            except urllib.error.URLError:
+                if attempt == retries:
+                    raise
+
+    def _do(self, method, url, data):
+        resp = self._open(method, url, data, "application/json", self.timeout)
+        content_type = resp.headers.get("Content-Type", "")
+        with resp:
+            raw = resp.read()
+        if not raw:
+            return None
+        if content_type.startswith("application/json"):
+            return json.loads(raw)
+        return raw
+
+    def _open(self, method, url, data, accept, timeout):
+        headers = {"Accept": accept}
+        if data is not None:
+            headers["Content-Type"] = "application/json"
+        req = urllib.request.Request(url, data=data, method=method, headers=headers)
+        try:
+            return urllib.request.urlopen(req, timeout=timeout)
+        except urllib.error.HTTPError as e:
+            raw = e.read(64 << 10).decode("utf-8", "replace")
+            try:
+                message = json.loads(raw)["error"]
+            except (ValueError, KeyError, TypeError):
+                message = raw.strip()
+            cls = NotFound if e.code == 404 else APIError
+            raise cls(e.code, message) from None
+
+    def _events(self, resp):
+        """Yield the data of each unnamed server-sent event until the daemon
+        closes the stream; named events, such as notices of entries dropped
+        for a slow reader, are skipped."""
+        with resp:
+            event = ""
+            for raw in resp:
+                line = raw.decode("utf-8", "replace").rstrip("\r\n")
+                if not line:
+                    event = ""
+                elif line.startswith("event: "):
+                    event = line[len("event: "):]
+                elif line.startswith("data: ") and not event:
+                    yield json.loads(line[len("data: "):])
+`
@@ -0,0 +1,25 @@
+package pyclient
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestCheckedInClientIsCurrent(t *testing.T) {
+	spec, err := os.ReadFile("../api/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := Generate(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile("../../clients/python/sensorctl_client.py")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("clients/python/sensorctl_client.py is out of date with openapi.json; run go generate ./internal/api")
+	}
+}
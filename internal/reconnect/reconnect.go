@@ -0,0 +1,98 @@
+package reconnect
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/demelere/sensor-control-modules/internal/sensorerr"
+	"github.com/demelere/sensor-control-modules/pkg/sensor"
+)
+
+// Policy decides when a connection is dead and how fast to retry it.
+type Policy struct {
+	Initial          time.Duration // first retry delay
+	Max              time.Duration // cap on the delay before jitter
+	Multiplier       float64       // growth per failed attempt
+	Jitter           float64       // +/- fraction of each delay, so rigs on one bus do not retry in lockstep
+	MaxParseFailures int           // consecutive unparseable replies before the link is presumed garbled
+	MaxTimeouts      int           // consecutive read timeouts before a slow sensor is presumed gone
+}
+
+var DefaultPolicy = Policy{Initial: time.Second, Max: time.Minute, Multiplier: 2, Jitter: 0.2, MaxParseFailures: 3, MaxTimeouts: 3}
+
+// Backoff is the delay before retry number attempt (1-based).
+func (p Policy) Backoff(attempt int) time.Duration {
+	d := float64(p.Initial)
+	for i := 1; i < attempt && d < float64(p.Max); i++ {
+		d *= p.Multiplier
+	}
+	d = min(d, float64(p.Max))
+	if p.Jitter > 0 {
+		d *= 1 + p.Jitter*(2*rand.Float64()-1)
+	}
+	return time.Duration(d)
+}
+
+// Tracker classifies read results for one connection. A parse failure may be
+// line noise and a timeout a sensor busy with something else, so only a run
+// of MaxParseFailures or MaxTimeouts of them counts; any other error (EOF,
+// I/O error, port gone) means the link is dead.
+type Tracker struct {
+	policy      Policy
+	parseErrors int
+	timeouts    int
+}
+
+func NewTracker(p Policy) *Tracker {
+	return &Tracker{policy: p}
+}
+
+// Observe records the result of one read and reports whether the connection
+// should be torn down and rediscovered.
+func (t *Tracker) Observe(err error) bool {
+	switch {
+	case err == nil:
+		t.parseErrors, t.timeouts = 0, 0
+		return false
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return false // the caller gave up, the link did not
+	case errors.Is(err, sensorerr.ErrTimeout):
+		t.timeouts++
+		return t.timeouts >= max(t.policy.MaxTimeouts, 1)
+	case errors.Is(err, sensorerr.ErrInvalidResponse):
+		t.parseErrors++
+		return t.parseErrors >= max(t.policy.MaxParseFailures, 1)
+	}
+	return true
+}
+
+// Reconnect closes the dead connection and calls open, which should re-run
+// port discovery, until it succeeds or ctx is done, waiting Backoff between
+// attempts. Every state change is passed to notify, if set, with Time filled
+// in and Sensor left for the caller.
+func Reconnect(ctx context.Context, p Policy, cause error, closeFn, open func() error, notify func(sensor.StateEvent)) error {
+	emit := func(e sensor.StateEvent) {
+		if notify != nil {
+			e.Time = time.Now().UTC()
+			notify(e)
+		}
+	}
+	emit(sensor.StateEvent{State: sensor.Disconnected, Err: cause})
+	closeFn()
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(p.Backoff(attempt)):
+		}
+		err := open()
+		if err == nil {
+			emit(sensor.StateEvent{State: sensor.Connected, Attempt: attempt})
+			return nil
+		}
+		closeFn()
+		emit(sensor.StateEvent{State: sensor.Reconnecting, Attempt: attempt, Err: err})
+	}
+}
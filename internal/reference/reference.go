@@ -0,0 +1,143 @@
+// Package reference checks the gas-exchange math in internal/metabolic
+// against published reference values. Each dataset is a JSON file naming
+// its source, the calculation it exercises, a relative tolerance, and cases
+// of inputs with the value the source gives for them. Some sources use a
+// different equation from the one metabolic implements (Lusk's caloric
+// table, Brouwer's formula); those tolerances are the agreement the
+// equations themselves have, so a change that leaves them is a change to
+// the physiology, not a rounding difference.
+package reference
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/demelere/sensor-control-modules/internal/metabolic"
+)
+
+// Case is one set of inputs and the value the source gives for them.
+type Case struct {
+	Inputs   map[string]float64 `json:"inputs"`
+	Expected float64            `json:"expected"`
+}
+
+type Dataset struct {
+	Name        string  `json:"name"`
+	Source      string  `json:"source"`
+	Calculation string  `json:"calculation"`
+	Tolerance   float64 `json:"tolerance"` // relative; absolute where the expected value is below 1
+	Cases       []Case  `json:"cases"`
+}
+
+// calculation computes a dataset's output from a case's inputs.
+type calculation struct {
+	inputs []string
+	eval   func(in map[string]float64) float64
+}
+
+var calculations = map[string]calculation{
+	"ve": {[]string{"flow_scfm"}, func(in map[string]float64) float64 {
+		return metabolic.VE(in["flow_scfm"])
+	}},
+	"vco2": {[]string{"ve_lpm", "co2_ppm"}, func(in map[string]float64) float64 {
+		return metabolic.VCO2(in["ve_lpm"], in["co2_ppm"])
+	}},
+	"energy_expenditure": {[]string{"vco2_lpm", "rq"}, func(in map[string]float64) float64 {
+		return metabolic.EnergyExpenditure(in["vco2_lpm"], in["rq"])
+	}},
+	// chain is what the pipeline does with a flow and CO2 reading.
+	"chain": {[]string{"flow_scfm", "co2_ppm", "rq"}, func(in map[string]float64) float64 {
+		return metabolic.EnergyExpenditure(metabolic.VCO2(metabolic.VE(in["flow_scfm"]), in["co2_ppm"]), in["rq"])
+	}},
+}
+
+// Load reads every *.json dataset in dir, in name order.
+func Load(dir string) ([]Dataset, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no reference datasets in %s", dir)
+	}
+	sort.Strings(paths)
+	var out []Dataset
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read reference dataset: %v", err)
+		}
+		var d Dataset
+		if err := json.Unmarshal(data, &d); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+		}
+		if err := d.validate(); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		out = append(out, d)
+	}
+	return out, nil
+}
+
+func (d Dataset) validate() error {
+	calc, ok := calculations[d.Calculation]
+	if !ok {
+		return fmt.Errorf("unknown calculation %q", d.Calculation)
+	}
+	if d.Tolerance <= 0 {
+		return fmt.Errorf("tolerance must be positive")
+	}
+	if len(d.Cases) == 0 {
+		return fmt.Errorf("no cases")
+	}
+	for i, c := range d.Cases {
+		for _, name := range calc.inputs {
+			if _, ok := c.Inputs[name]; !ok {
+				return fmt.Errorf("case %d: missing input %s", i+1, name)
+			}
+		}
+	}
+	return nil
+}
+
+// Mismatch is a case the math no longer agrees with.
+type Mismatch struct {
+	Dataset  string
+	Case     int // 1-based
+	Inputs   map[string]float64
+	Expected float64
+	Actual   float64
+}
+
+func (m Mismatch) String() string {
+	names := make([]string, 0, len(m.Inputs))
+	for name := range m.Inputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	in := ""
+	for i, name := range names {
+		if i > 0 {
+			in += " "
+		}
+		in += fmt.Sprintf("%s=%g", name, m.Inputs[name])
+	}
+	return fmt.Sprintf("%s case %d (%s): expected %g, got %g (%+.2f%%)", m.Dataset, m.Case, in, m.Expected, m.Actual, 100*(m.Actual-m.Expected)/math.Max(math.Abs(m.Expected), 1e-12))
+}
+
+// Check runs every case in d and returns those outside its tolerance.
+func Check(d Dataset) []Mismatch {
+	calc := calculations[d.Calculation]
+	var out []Mismatch
+	for i, c := range d.Cases {
+		got := calc.eval(c.Inputs)
+		if math.IsNaN(got) || math.Abs(got-c.Expected) > d.Tolerance*math.Max(math.Abs(c.Expected), 1) {
+			out = append(out, Mismatch{Dataset: d.Name, Case: i + 1, Inputs: c.Inputs, Expected: c.Expected, Actual: got})
+		}
+	}
+	return out
+}
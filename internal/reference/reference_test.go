@@ -0,0 +1,22 @@
+package reference
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReferenceDatasets(t *testing.T) {
+	datasets, err := Load("../../testdata/reference")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range datasets {
+		if mismatches := Check(d); len(mismatches) > 0 {
+			lines := make([]string, len(mismatches))
+			for i, m := range mismatches {
+				lines[i] = m.String()
+			}
+			t.Fatalf("%s: %d/%d cases outside %g:\n%s", d.Name, len(mismatches), len(d.Cases), d.Tolerance, strings.Join(lines, "\n"))
+		}
+	}
+}
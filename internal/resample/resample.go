@@ -0,0 +1,139 @@
+package resample
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+type Method int
+
+const (
+	Linear   Method = iota
+	Previous        // zero-order hold
+	Nearest
+)
+
+func (m Method) String() string {
+	switch m {
+	case Previous:
+		return "previous"
+	case Nearest:
+		return "nearest"
+	}
+	return "linear"
+}
+
+func ParseMethod(name string) (Method, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "linear", "":
+		return Linear, nil
+	case "previous", "hold", "zoh":
+		return Previous, nil
+	case "nearest":
+		return Nearest, nil
+	}
+	return Linear, fmt.Errorf("unknown resampling method %q", name)
+}
+
+type Point struct {
+	Time  time.Time
+	Value float64
+}
+
+// Resampler converts an irregular stream into points on a fixed-rate grid
+// aligned to the Unix epoch, so independently resampled channels line up.
+// Grid points are emitted as soon as the samples on both sides are known.
+// Grid points inside a gap longer than maxGap are skipped rather than
+// invented; zero maxGap interpolates across any gap.
+type Resampler struct {
+	period  time.Duration
+	method  Method
+	maxGap  time.Duration
+	prev    Point
+	started bool
+	broken  bool      // a known gap precedes the next sample
+	next    time.Time // next grid point to emit
+}
+
+func New(rateHz float64, method Method, maxGap time.Duration) (*Resampler, error) {
+	if rateHz <= 0 {
+		return nil, fmt.Errorf("resampling rate must be positive")
+	}
+	period := time.Duration(float64(time.Second) / rateHz)
+	if period <= 0 {
+		return nil, fmt.Errorf("resampling rate %g Hz is too high", rateHz)
+	}
+	return &Resampler{period: period, method: method, maxGap: maxGap}, nil
+}
+
+func (r *Resampler) Period() time.Duration {
+	return r.period
+}
+
+// Add feeds one sample and returns the grid points it completes. Samples that
+// are not newer than the previous one are ignored.
+func (r *Resampler) Add(t time.Time, v float64) []Point {
+	cur := Point{Time: t, Value: v}
+	if !r.started {
+		r.started = true
+		r.prev = cur
+		r.next = r.ceil(t)
+		return nil
+	}
+	if !t.After(r.prev.Time) {
+		return nil
+	}
+
+	var out []Point
+	if r.broken || r.maxGap > 0 && t.Sub(r.prev.Time) > r.maxGap {
+		r.broken = false
+		if r.next.Equal(r.prev.Time) { // the sample before the gap sat on the grid
+			out = append(out, r.prev)
+		}
+		r.next = r.ceil(t)
+	} else {
+		for ; r.next.Before(t); r.next = r.next.Add(r.period) {
+			out = append(out, Point{Time: r.next, Value: r.value(r.prev, cur, r.next)})
+		}
+	}
+	r.prev = cur
+	return out
+}
+
+// Break marks a known gap (e.g. a recorded disconnect) before the next sample,
+// so it is not interpolated across regardless of maxGap.
+func (r *Resampler) Break() {
+	r.broken = true
+}
+
+// Flush emits the final grid point if the last sample sits exactly on it.
+func (r *Resampler) Flush() []Point {
+	if r.started && r.next.Equal(r.prev.Time) {
+		r.next = r.next.Add(r.period)
+		return []Point{r.prev}
+	}
+	return nil
+}
+
+func (r *Resampler) ceil(t time.Time) time.Time {
+	g := t.Truncate(r.period)
+	if g.Before(t) {
+		g = g.Add(r.period)
+	}
+	return g
+}
+
+func (r *Resampler) value(a, b Point, t time.Time) float64 {
+	switch r.method {
+	case Previous:
+		return a.Value
+	case Nearest:
+		if t.Sub(a.Time) <= b.Time.Sub(t) {
+			return a.Value
+		}
+		return b.Value
+	}
+	frac := float64(t.Sub(a.Time)) / float64(b.Time.Sub(a.Time))
+	return a.Value + frac*(b.Value-a.Value)
+}
@@ -0,0 +1,188 @@
+package rigsync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// DefaultGroup is the multicast group leaders announce on and followers join.
+const DefaultGroup = "239.255.42.1:8091"
+
+var (
+	rigsyncSendRepeats int
+	rigsyncSendSpacing time.Duration
+)
+
+func init() {
+	rigsyncSendRepeats = 3 // UDP may drop packets; followers dedupe by sequence
+	rigsyncSendSpacing = 20 * time.Millisecond
+}
+
+type MessageType string
+
+const (
+	Start  MessageType = "start"
+	Stop   MessageType = "stop"
+	Marker MessageType = "marker"
+)
+
+// Message is one leader announcement. At is the instant every rig should act
+// on it, on each rig's own (synchronized) clock.
+type Message struct {
+	Type    MessageType `json:"type"`
+	Leader  string      `json:"leader"`
+	Seq     uint64      `json:"seq"`
+	Session string      `json:"session"`
+	At      time.Time   `json:"at"`
+	Label   string      `json:"label,omitempty"`
+}
+
+// Leader announces session start/stop and markers to follower rigs.
+type Leader struct {
+	name  string
+	lead  time.Duration
+	lock  sync.Mutex
+	seq   uint64
+	conns []*net.UDPConn
+}
+
+// NewLeader sends to every target, each a multicast group or a follower's
+// unicast address. Starts are scheduled lead into the future so followers
+// have time to receive them and every rig begins at the same instant.
+func NewLeader(name string, targets []string, lead time.Duration) (*Leader, error) {
+	l := &Leader{
+		name: name,
+		lead: lead,
+		seq:  uint64(time.Now().UnixNano()), // a restarted leader must not look like a replay
+	}
+	for _, t := range targets {
+		addr, err := net.ResolveUDPAddr("udp", t)
+		if err != nil {
+			l.Close()
+			return nil, fmt.Errorf("sync target %s: %v", t, err)
+		}
+		conn, err := net.DialUDP("udp", nil, addr)
+		if err != nil {
+			l.Close()
+			return nil, fmt.Errorf("sync target %s: %v", t, err)
+		}
+		l.conns = append(l.conns, conn)
+	}
+	if len(l.conns) == 0 {
+		return nil, fmt.Errorf("sync leader has no targets")
+	}
+	return l, nil
+}
+
+// Start announces a session and returns the instant recording should begin.
+func (l *Leader) Start(session string) time.Time {
+	return l.send(Message{Type: Start, Session: session, At: time.Now().Add(l.lead)})
+}
+
+// Stop announces the end of a session, effective immediately.
+func (l *Leader) Stop(session string) time.Time {
+	return l.send(Message{Type: Stop, Session: session, At: time.Now()})
+}
+
+func (l *Leader) Mark(session, label string) time.Time {
+	return l.send(Message{Type: Marker, Session: session, At: time.Now(), Label: label})
+}
+
+func (l *Leader) send(m Message) time.Time {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.seq++
+	m.Leader, m.Seq, m.At = l.name, l.seq, m.At.UTC()
+	data, _ := json.Marshal(m)
+	for i := 0; i < rigsyncSendRepeats; i++ {
+		if i > 0 {
+			time.Sleep(rigsyncSendSpacing)
+		}
+		for _, c := range l.conns {
+			if _, err := c.Write(data); err != nil && i == 0 {
+				log.Printf("sync: failed to send %s to %s: %v", m.Type, c.RemoteAddr(), err)
+			}
+		}
+	}
+	return m.At
+}
+
+func (l *Leader) Close() error {
+	for _, c := range l.conns {
+		c.Close()
+	}
+	return nil
+}
+
+// Follower receives leader announcements on a multicast group or a unicast
+// listen address.
+type Follower struct {
+	conn *net.UDPConn
+	last map[string]uint64 // highest sequence seen per leader
+}
+
+func NewFollower(addr string) (*Follower, error) {
+	ua, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("sync address %s: %v", addr, err)
+	}
+	var conn *net.UDPConn
+	if ua.IP.IsMulticast() {
+		conn, err = net.ListenMulticastUDP("udp", nil, ua)
+	} else {
+		conn, err = net.ListenUDP("udp", ua)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for sync on %s: %v", addr, err)
+	}
+	return &Follower{conn: conn, last: make(map[string]uint64)}, nil
+}
+
+// Run calls handle once per announcement, at its At instant, until ctx is
+// cancelled. Announcements that arrive late are handled immediately.
+func (f *Follower) Run(ctx context.Context, handle func(Message)) error {
+	go func() {
+		<-ctx.Done()
+		f.conn.Close()
+	}()
+
+	buf := make([]byte, 4096)
+	for {
+		n, from, err := f.conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("sync receive: %v", err)
+		}
+		var m Message
+		if err := json.Unmarshal(buf[:n], &m); err != nil {
+			log.Printf("sync: ignoring malformed message from %s: %v", from, err)
+			continue
+		}
+		if m.Seq <= f.last[m.Leader] {
+			continue // repeat or replay
+		}
+		f.last[m.Leader] = m.Seq
+
+		delay := time.Until(m.At)
+		if delay <= 0 {
+			if delay < -100*time.Millisecond {
+				log.Printf("sync: %s from %s arrived %s late", m.Type, m.Leader, -delay)
+			}
+			handle(m)
+			continue
+		}
+		time.AfterFunc(delay, func() {
+			if ctx.Err() == nil {
+				handle(m)
+			}
+		})
+	}
+}
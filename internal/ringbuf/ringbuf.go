@@ -0,0 +1,59 @@
+package ringbuf
+
+// Ring is a fixed-capacity FIFO that overwrites its oldest element when full,
+// so long-running consumers hold a bounded window instead of an ever-growing
+// slice. It is not safe for concurrent use.
+type Ring[T any] struct {
+	buf   []T
+	start int
+	n     int
+}
+
+func New[T any](capacity int) *Ring[T] {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &Ring[T]{buf: make([]T, capacity)}
+}
+
+// Push appends v, returning true if the oldest element was evicted.
+func (r *Ring[T]) Push(v T) bool {
+	if r.n < len(r.buf) {
+		r.buf[(r.start+r.n)%len(r.buf)] = v
+		r.n++
+		return false
+	}
+	r.buf[r.start] = v
+	r.start = (r.start + 1) % len(r.buf)
+	return true
+}
+
+func (r *Ring[T]) Len() int {
+	return r.n
+}
+
+func (r *Ring[T]) Cap() int {
+	return len(r.buf)
+}
+
+// At returns the i-th oldest element.
+func (r *Ring[T]) At(i int) T {
+	return r.buf[(r.start+i)%len(r.buf)]
+}
+
+// Slice copies the contents, oldest first.
+func (r *Ring[T]) Slice() []T {
+	out := make([]T, r.n)
+	for i := range out {
+		out[i] = r.At(i)
+	}
+	return out
+}
+
+func (r *Ring[T]) Reset() {
+	var zero T
+	for i := range r.buf {
+		r.buf[i] = zero
+	}
+	r.start, r.n = 0, 0
+}
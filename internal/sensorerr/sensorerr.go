@@ -0,0 +1,11 @@
+package sensorerr
+
+import "errors"
+
+// Sentinel errors shared by all drivers. Drivers wrap them with %w so callers
+// can branch with errors.Is regardless of which sensor failed.
+var (
+	ErrNotFound        = errors.New("not found")
+	ErrInvalidResponse = errors.New("invalid response")
+	ErrTimeout         = errors.New("timed out") // no reply in time; the sensor may be slow rather than gone
+)
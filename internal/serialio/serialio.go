@@ -0,0 +1,188 @@
+package serialio
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"go.bug.st/serial"
+
+	"github.com/demelere/sensor-control-modules/internal/chaos"
+	"github.com/demelere/sensor-control-modules/internal/sensorerr"
+)
+
+// DefaultTimeout is how long ReadLine waits for a reply when the driver was
+// not given a timeout of its own.
+var DefaultTimeout = 2 * time.Second
+
+// LineReader reads reply lines from a serial port without ever blocking for
+// good: each line must arrive within the timeout, or by the caller's context
+// deadline if that is sooner, otherwise the read fails with
+// sensorerr.ErrTimeout. One LineReader per connection, so no buffered bytes
+// are lost between commands.
+type LineReader struct {
+	port    serial.Port
+	src     deadlineReader
+	buf     *bufio.Reader
+	timeout time.Duration
+	stale   bool // a reply timed out and may still arrive
+}
+
+func NewLineReader(port serial.Port, timeout time.Duration) *LineReader {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	r := &LineReader{port: port, timeout: timeout}
+	r.src.port = port
+	r.buf = bufio.NewReader(&r.src)
+	return r
+}
+
+// ReadLine returns the next line, including its '\n'.
+func (r *LineReader) ReadLine(ctx context.Context) (string, error) {
+	return r.ReadLineWithin(ctx, r.timeout)
+}
+
+// ReadLineWithin is ReadLine with its own timeout, for lines a device sends
+// unprompted on a schedule longer than a reply takes.
+func (r *LineReader) ReadLineWithin(ctx context.Context, timeout time.Duration) (string, error) {
+	r.src.deadline = time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(r.src.deadline) {
+		r.src.deadline = d
+	}
+	if chaos.Enabled {
+		if line, injected, err := r.inject(ctx, chaos.Next("serial")); injected {
+			return line, err
+		}
+	}
+	line, err := r.buf.ReadString('\n')
+	if errors.Is(err, sensorerr.ErrTimeout) {
+		r.stale = true
+		return line, fmt.Errorf("no reply within %v: %w", timeout, err)
+	}
+	return line, err
+}
+
+// ReadUntil reads up to and including the first byte that is in delims, for
+// replies ending in a prompt with no newline after it. A timeout of 0 means
+// the reader's own.
+func (r *LineReader) ReadUntil(ctx context.Context, timeout time.Duration, delims string) (string, error) {
+	if timeout <= 0 {
+		timeout = r.timeout
+	}
+	r.src.deadline = time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(r.src.deadline) {
+		r.src.deadline = d
+	}
+	if chaos.Enabled {
+		if line, injected, err := r.inject(ctx, chaos.Next("serial")); injected {
+			return line, err
+		}
+	}
+	var b []byte
+	for {
+		c, err := r.buf.ReadByte()
+		if errors.Is(err, sensorerr.ErrTimeout) {
+			r.stale = true
+			return string(b), fmt.Errorf("no reply within %v: %w", timeout, err)
+		} else if err != nil {
+			return string(b), err
+		}
+		b = append(b, c)
+		if strings.IndexByte(delims, c) >= 0 {
+			return string(b), nil
+		}
+	}
+}
+
+// ReadFull reads exactly len(p) bytes, for binary protocols such as Modbus
+// RTU, under the same timeout as ReadLine.
+func (r *LineReader) ReadFull(ctx context.Context, p []byte) error {
+	r.src.deadline = time.Now().Add(r.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(r.src.deadline) {
+		r.src.deadline = d
+	}
+	if chaos.Enabled {
+		if noise, injected, err := r.inject(ctx, chaos.Next("serial")); injected {
+			copy(p, noise)
+			return err
+		}
+	}
+	_, err := io.ReadFull(r.buf, p)
+	if errors.Is(err, sensorerr.ErrTimeout) {
+		r.stale = true
+		return fmt.Errorf("no reply within %v: %w", r.timeout, err)
+	}
+	return err
+}
+
+// Discard drops whatever is left of a reply that timed out, so the late
+// answer to one command is not read as the answer to the next. Call it
+// before writing a command; it does nothing after a clean read.
+func (r *LineReader) Discard() {
+	if !r.stale {
+		return
+	}
+	r.stale = false
+	r.port.ResetInputBuffer()
+	r.buf.Reset(&r.src)
+}
+
+// Reset drops everything received so far, for binary protocols that lose
+// framing on a bad reply.
+func (r *LineReader) Reset() {
+	r.stale = false
+	r.port.ResetInputBuffer()
+	r.buf.Reset(&r.src)
+}
+
+// inject acts out f the way a real port would misbehave: a stall past the
+// deadline times out, an error is line noise the driver fails to parse, and a
+// disconnect is an I/O error. injected is false when the read should go ahead.
+func (r *LineReader) inject(ctx context.Context, f chaos.Fault) (line string, injected bool, err error) {
+	switch f.Kind {
+	case chaos.Delay:
+		left := time.Until(r.src.deadline)
+		select {
+		case <-time.After(min(f.Delay, left)):
+		case <-ctx.Done():
+			return "", true, ctx.Err()
+		}
+		if f.Delay >= left {
+			r.stale = true
+			return "", true, fmt.Errorf("no reply within %v: %w", r.timeout, sensorerr.ErrTimeout)
+		}
+	case chaos.Error:
+		r.stale = true // the real reply is still on its way
+		return "\x00#\xff?\r\n", true, nil
+	case chaos.Disconnect:
+		return "", true, fmt.Errorf("%w: serial port went away", chaos.ErrInjected)
+	}
+	return "", false, nil
+}
+
+// deadlineReader turns the serial driver's silent timeout (a zero-byte read
+// with no error) into sensorerr.ErrTimeout.
+type deadlineReader struct {
+	port     serial.Port
+	deadline time.Time
+}
+
+func (d *deadlineReader) Read(p []byte) (int, error) {
+	wait := time.Until(d.deadline)
+	if wait <= 0 {
+		return 0, sensorerr.ErrTimeout
+	}
+	if err := d.port.SetReadTimeout(wait); err != nil {
+		return 0, err
+	}
+	n, err := d.port.Read(p)
+	if n == 0 && err == nil {
+		return 0, sensorerr.ErrTimeout
+	}
+	return n, err
+}
@@ -0,0 +1,88 @@
+package serialio
+
+import (
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"go.bug.st/serial"
+)
+
+// TraceSize is how many port reads and writes the trace keeps, across all
+// ports; older ones are overwritten.
+var TraceSize = 512
+
+// maxTraced caps the bytes kept from one read or write.
+const maxTraced = 256
+
+// TraceEvent is one read from or write to a serial port.
+type TraceEvent struct {
+	Time time.Time `json:"time"`
+	Port string    `json:"port"`
+	Dir  string    `json:"dir"`  // "tx" or "rx"
+	Hex  string    `json:"hex"`  // the bytes, up to 256
+	Text string    `json:"text"` // the same bytes with anything unprintable as '.'
+}
+
+var trace struct {
+	lock   sync.Mutex
+	events []TraceEvent
+	next   int
+}
+
+// Traced wraps port so every read and write on it is kept in the trace that
+// Trace returns, for bug reports.
+func Traced(port serial.Port, path string) serial.Port {
+	return &tracedPort{Port: port, path: path}
+}
+
+type tracedPort struct {
+	serial.Port
+	path string
+}
+
+func (p *tracedPort) Read(b []byte) (int, error) {
+	n, err := p.Port.Read(b)
+	if n > 0 {
+		record(p.path, "rx", b[:n])
+	}
+	return n, err
+}
+
+func (p *tracedPort) Write(b []byte) (int, error) {
+	n, err := p.Port.Write(b)
+	if n > 0 {
+		record(p.path, "tx", b[:n])
+	}
+	return n, err
+}
+
+func record(path, dir string, b []byte) {
+	b = b[:min(len(b), maxTraced)]
+	text := make([]byte, len(b))
+	for i, c := range b {
+		if c < 0x20 || c > 0x7e {
+			c = '.'
+		}
+		text[i] = c
+	}
+	e := TraceEvent{Time: time.Now().UTC(), Port: path, Dir: dir, Hex: hex.EncodeToString(b), Text: string(text)}
+
+	trace.lock.Lock()
+	defer trace.lock.Unlock()
+	if len(trace.events) < TraceSize {
+		trace.events = append(trace.events, e)
+		return
+	}
+	trace.events[trace.next] = e
+	trace.next = (trace.next + 1) % len(trace.events)
+}
+
+// Trace returns the traced reads and writes, oldest first.
+func Trace() []TraceEvent {
+	trace.lock.Lock()
+	defer trace.lock.Unlock()
+	out := make([]TraceEvent, 0, len(trace.events))
+	out = append(out, trace.events[trace.next:]...)
+	return append(out, trace.events[:trace.next]...)
+}
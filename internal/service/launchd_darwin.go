@@ -0,0 +1,148 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	daemonDir   = "/Library/LaunchDaemons"
+	labelPrefix = "com.github.demelere."
+)
+
+// logDir holds an installed daemon's logs, next to other system logs so
+// Console.app finds them.
+func logDir(name string) string {
+	return filepath.Join("/Library/Logs", name)
+}
+
+// LogFile is the file an installed daemon should log to: macOS has no
+// journal the daemon can write to directly.
+func LogFile(name string) string {
+	return filepath.Join(logDir(name), name+".log")
+}
+
+// LogDestination says where the daemon's logs end up once installed.
+func LogDestination(name string) string {
+	return LogFile(name)
+}
+
+// Install writes a launchd daemon plist for s. launchd loads it at every
+// boot; Start loads it now. Readings on stdout are discarded, since they are
+// in the session files, and stderr, where a panic would go, is kept in
+// its log directory.
+func Install(s Spec) error {
+	if err := s.validate(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(logDir(s.Name), 0o755); err != nil {
+		return fmt.Errorf("failed to create log directory: %w", err)
+	}
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	b.WriteString(`<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">` + "\n")
+	b.WriteString("<plist version=\"1.0\">\n<dict>\n")
+	plistString(&b, "Label", labelPrefix+s.Name)
+	b.WriteString("\t<key>ProgramArguments</key>\n\t<array>\n")
+	for _, arg := range append([]string{s.Executable}, s.Args...) {
+		b.WriteString("\t\t<string>")
+		xml.EscapeText(&b, []byte(arg))
+		b.WriteString("</string>\n")
+	}
+	b.WriteString("\t</array>\n")
+	if len(s.Env) > 0 {
+		keys := make([]string, 0, len(s.Env))
+		for k := range s.Env {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		b.WriteString("\t<key>EnvironmentVariables</key>\n\t<dict>\n")
+		for _, k := range keys {
+			plistString(&b, k, s.Env[k])
+		}
+		b.WriteString("\t</dict>\n")
+	}
+	b.WriteString("\t<key>RunAtLoad</key>\n\t<true/>\n\t<key>KeepAlive</key>\n\t<true/>\n")
+	b.WriteString("\t<key>ThrottleInterval</key>\n\t<integer>5</integer>\n")
+	plistString(&b, "StandardOutPath", "/dev/null")
+	plistString(&b, "StandardErrorPath", filepath.Join(logDir(s.Name), "stderr.log"))
+	b.WriteString("</dict>\n</plist>\n")
+
+	if err := os.WriteFile(plistPath(s.Name), b.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("failed to write plist: %w", err)
+	}
+	return nil
+}
+
+func plistString(b *bytes.Buffer, key, value string) {
+	b.WriteString("\t<key>")
+	xml.EscapeText(b, []byte(key))
+	b.WriteString("</key>\n\t<string>")
+	xml.EscapeText(b, []byte(value))
+	b.WriteString("</string>\n")
+}
+
+// Uninstall unloads the daemon and removes its plist. Its logs are kept.
+func Uninstall(name string) error {
+	path := plistPath(name)
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("service %s is not installed: %w", name, err)
+	}
+	command("launchctl", "bootout", "system/"+labelPrefix+name)
+	return os.Remove(path)
+}
+
+func Start(name string) error {
+	if loaded(name) {
+		_, err := command("launchctl", "kickstart", "system/"+labelPrefix+name)
+		return err
+	}
+	_, err := command("launchctl", "bootstrap", "system", plistPath(name))
+	return err
+}
+
+// Stop unloads the daemon, since a loaded one is kept alive. It is loaded
+// again at the next boot.
+func Stop(name string) error {
+	_, err := command("launchctl", "bootout", "system/"+labelPrefix+name)
+	return err
+}
+
+// Status returns launchd's state for the daemon, e.g. running or waiting,
+// or not loaded.
+func Status(name string) (string, error) {
+	if _, err := os.Stat(plistPath(name)); err != nil {
+		return "not installed", nil
+	}
+	out, err := command("launchctl", "print", "system/"+labelPrefix+name)
+	if err != nil {
+		return "not loaded", nil
+	}
+	for _, line := range strings.Split(out, "\n") {
+		if state, ok := strings.CutPrefix(strings.TrimSpace(line), "state = "); ok {
+			return state, nil
+		}
+	}
+	return "loaded", nil
+}
+
+// Run runs fn. launchd stops the daemon with SIGTERM, which ctx already
+// carries.
+func Run(ctx context.Context, name string, fn func(context.Context) error) error {
+	return fn(ctx)
+}
+
+func loaded(name string) bool {
+	_, err := command("launchctl", "print", "system/"+labelPrefix+name)
+	return err == nil
+}
+
+func plistPath(name string) string {
+	return filepath.Join(daemonDir, labelPrefix+name+".plist")
+}
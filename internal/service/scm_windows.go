@@ -0,0 +1,224 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"golang.org/x/sys/windows/registry"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// LogFile is empty: the daemon logs to the event log.
+func LogFile(name string) string { return "" }
+
+// LogDestination says where the daemon's logs end up once installed.
+func LogDestination(name string) string {
+	return "the Application event log, source " + name
+}
+
+// Install creates a Windows service for s that starts at boot and is
+// restarted 5s after it fails, and registers s.Name as an event log source.
+// s.Env goes into the Environment value of the service's registry key,
+// which the Service Control Manager applies when it starts the process.
+func Install(s Spec) error {
+	if err := s.validate(); err != nil {
+		return err
+	}
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service manager: %w", err)
+	}
+	defer m.Disconnect()
+	if existing, err := m.OpenService(s.Name); err == nil {
+		existing.Close()
+		return fmt.Errorf("service %s is already installed", s.Name)
+	}
+	svcCfg := mgr.Config{
+		DisplayName: s.Name,
+		Description: s.Description,
+		StartType:   mgr.StartAutomatic,
+	}
+	sv, err := m.CreateService(s.Name, s.Executable, svcCfg, s.Args...)
+	if err != nil {
+		return fmt.Errorf("failed to create service: %w", err)
+	}
+	defer sv.Close()
+	if len(s.Env) > 0 {
+		if err := setEnvironment(s.Name, s.Env); err != nil {
+			sv.Delete()
+			return err
+		}
+	}
+	restart := []mgr.RecoveryAction{{Type: mgr.ServiceRestart, Delay: 5 * time.Second}}
+	if err := sv.SetRecoveryActions(restart, uint32((24 * time.Hour).Seconds())); err != nil {
+		sv.Delete()
+		return fmt.Errorf("failed to set recovery actions: %w", err)
+	}
+	if err := sv.SetRecoveryActionsOnNonCrashFailures(true); err != nil {
+		sv.Delete()
+		return fmt.Errorf("failed to set recovery actions: %w", err)
+	}
+	eventlog.Remove(s.Name) // left behind by an earlier install
+	if err := eventlog.InstallAsEventCreate(s.Name, eventlog.Error|eventlog.Warning|eventlog.Info); err != nil {
+		sv.Delete()
+		return fmt.Errorf("failed to register event log source: %w", err)
+	}
+	return nil
+}
+
+// Uninstall stops and deletes the service and its event log source.
+func Uninstall(name string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service manager: %w", err)
+	}
+	defer m.Disconnect()
+	sv, err := m.OpenService(name)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed: %w", name, err)
+	}
+	defer sv.Close()
+	sv.Control(svc.Stop)
+	if err := sv.Delete(); err != nil {
+		return fmt.Errorf("failed to delete service: %w", err)
+	}
+	eventlog.Remove(name)
+	return nil
+}
+
+func Start(name string) error {
+	return withService(name, func(sv *mgr.Service) error {
+		return sv.Start()
+	})
+}
+
+// Stop asks the service to stop and waits up to 30s for it to.
+func Stop(name string) error {
+	return withService(name, func(sv *mgr.Service) error {
+		status, err := sv.Control(svc.Stop)
+		if err != nil {
+			return err
+		}
+		deadline := time.Now().Add(30 * time.Second)
+		for status.State != svc.Stopped {
+			if time.Now().After(deadline) {
+				return fmt.Errorf("service %s did not stop within 30s", name)
+			}
+			time.Sleep(300 * time.Millisecond)
+			if status, err = sv.Query(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Status returns the service's state, e.g. running or stopped.
+func Status(name string) (string, error) {
+	m, err := mgr.Connect()
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to the service manager: %w", err)
+	}
+	defer m.Disconnect()
+	sv, err := m.OpenService(name)
+	if err != nil {
+		return "not installed", nil
+	}
+	defer sv.Close()
+	status, err := sv.Query()
+	if err != nil {
+		return "", err
+	}
+	return stateNames[status.State], nil
+}
+
+var stateNames = map[svc.State]string{
+	svc.Stopped:         "stopped",
+	svc.StartPending:    "start pending",
+	svc.StopPending:     "stop pending",
+	svc.Running:         "running",
+	svc.ContinuePending: "continue pending",
+	svc.PausePending:    "pause pending",
+	svc.Paused:          "paused",
+}
+
+func setEnvironment(name string, env map[string]string) error {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, `SYSTEM\CurrentControlSet\Services\`+name, registry.SET_VALUE)
+	if err != nil {
+		return fmt.Errorf("failed to open service key: %w", err)
+	}
+	defer k.Close()
+	vars := make([]string, 0, len(env))
+	for key, v := range env {
+		vars = append(vars, key+"="+v)
+	}
+	sort.Strings(vars)
+	if err := k.SetStringsValue("Environment", vars); err != nil {
+		return fmt.Errorf("failed to set service environment: %w", err)
+	}
+	return nil
+}
+
+func withService(name string, fn func(*mgr.Service) error) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service manager: %w", err)
+	}
+	defer m.Disconnect()
+	sv, err := m.OpenService(name)
+	if err != nil {
+		return fmt.Errorf("service %s: %w", name, err)
+	}
+	defer sv.Close()
+	return fn(sv)
+}
+
+// Run runs fn, under the Service Control Manager when the process was
+// started as a service: a stop or shutdown request cancels fn's context,
+// and fn failing stops the service with an error so recovery restarts it.
+func Run(ctx context.Context, name string, fn func(context.Context) error) error {
+	isService, err := svc.IsWindowsService()
+	if err != nil || !isService {
+		return fn(ctx)
+	}
+	h := &handler{ctx: ctx, fn: fn}
+	if err := svc.Run(name, h); err != nil {
+		return err
+	}
+	return h.err
+}
+
+type handler struct {
+	ctx context.Context
+	fn  func(context.Context) error
+	err error
+}
+
+func (h *handler) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	ctx, cancel := context.WithCancel(h.ctx)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- h.fn(ctx) }()
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case h.err = <-done:
+			if h.err != nil {
+				return true, 1
+			}
+			return false, 0
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				status <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending, WaitHint: 30000}
+				cancel()
+			}
+		}
+	}
+}
@@ -0,0 +1,51 @@
+// Package service registers sensorctl run with the platform's service
+// manager, so it starts at boot and is restarted when it exits: a systemd
+// unit on Linux, a launchd daemon on macOS, and a Windows service.
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// ErrUnsupported is returned where sensorctl knows no service manager.
+var ErrUnsupported = errors.New("no supported service manager on this platform")
+
+// Spec is what Install registers.
+type Spec struct {
+	Name        string // unit, launchd label suffix, or Windows service name
+	Description string
+	Executable  string // absolute path
+	Args        []string
+	Env         map[string]string
+}
+
+func (s Spec) validate() error {
+	if s.Name == "" || strings.ContainsAny(s.Name, `/\ `) {
+		return fmt.Errorf("service name %q is not usable", s.Name)
+	}
+	if s.Executable == "" {
+		return fmt.Errorf("service %s has no executable", s.Name)
+	}
+	return nil
+}
+
+// command runs a service manager's tool and folds its output into the error.
+func command(name string, args ...string) (string, error) {
+	var out bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+	text := strings.TrimSpace(out.String())
+	if err != nil {
+		if text != "" {
+			return text, fmt.Errorf("%s %s: %v: %s", name, strings.Join(args, " "), err, text)
+		}
+		return text, fmt.Errorf("%s %s: %v", name, strings.Join(args, " "), err)
+	}
+	return text, nil
+}
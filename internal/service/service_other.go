@@ -0,0 +1,18 @@
+//go:build !linux && !darwin && !windows
+
+package service
+
+import "context"
+
+func LogFile(name string) string        { return "" }
+func LogDestination(name string) string { return "the configured log sinks" }
+
+func Install(s Spec) error          { return ErrUnsupported }
+func Uninstall(name string) error   { return ErrUnsupported }
+func Start(name string) error       { return ErrUnsupported }
+func Stop(name string) error        { return ErrUnsupported }
+func Status(string) (string, error) { return "", ErrUnsupported }
+
+func Run(ctx context.Context, name string, fn func(context.Context) error) error {
+	return fn(ctx)
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const unitDir = "/etc/systemd/system"
+
+// LogFile is empty: the daemon logs to the journal.
+func LogFile(name string) string { return "" }
+
+// LogDestination says where the daemon's logs end up once installed.
+func LogDestination(name string) string {
+	return "journald (journalctl -u " + name + ")"
+}
+
+// Install writes a systemd unit for s and enables it for boot. Readings on
+// stdout are discarded; they are in the session files, and the logs go to
+// the journal natively.
+func Install(s Spec) error {
+	if err := s.validate(); err != nil {
+		return err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "[Unit]\nDescription=%s\nWants=network-online.target\nAfter=network-online.target\n\n", s.Description)
+	b.WriteString("[Service]\nExecStart=")
+	for i, arg := range append([]string{s.Executable}, s.Args...) {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(systemdQuote(strings.ReplaceAll(arg, "$", "$$")))
+	}
+	b.WriteByte('\n')
+	keys := make([]string, 0, len(s.Env))
+	for k := range s.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&b, "Environment=%s\n", systemdQuote(k+"="+s.Env[k]))
+	}
+	b.WriteString("Restart=always\nRestartSec=5\nStandardOutput=null\n\n[Install]\nWantedBy=multi-user.target\n")
+
+	if err := os.WriteFile(unitPath(s.Name), []byte(b.String()), 0o644); err != nil {
+		return fmt.Errorf("failed to write unit: %w", err)
+	}
+	if _, err := command("systemctl", "daemon-reload"); err != nil {
+		return err
+	}
+	_, err := command("systemctl", "enable", s.Name+".service")
+	return err
+}
+
+// Uninstall stops and disables the unit and removes it.
+func Uninstall(name string) error {
+	path := unitPath(name)
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("service %s is not installed: %w", name, err)
+	}
+	command("systemctl", "disable", "--now", name+".service")
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	_, err := command("systemctl", "daemon-reload")
+	return err
+}
+
+func Start(name string) error {
+	_, err := command("systemctl", "start", name+".service")
+	return err
+}
+
+func Stop(name string) error {
+	_, err := command("systemctl", "stop", name+".service")
+	return err
+}
+
+// Status returns the unit's active state, e.g. active or failed.
+func Status(name string) (string, error) {
+	if _, err := os.Stat(unitPath(name)); err != nil {
+		return "not installed", nil
+	}
+	out, err := command("systemctl", "is-active", name+".service")
+	if err != nil && (out == "" || strings.ContainsAny(out, " \n")) {
+		return "", err // is-active exits non-zero for any one-word state but active
+	}
+	return out, nil
+}
+
+// Run runs fn. systemd stops the daemon with SIGTERM, which ctx already
+// carries.
+func Run(ctx context.Context, name string, fn func(context.Context) error) error {
+	return fn(ctx)
+}
+
+func unitPath(name string) string {
+	return filepath.Join(unitDir, name+".service")
+}
+
+// systemdQuote quotes a word of ExecStart or Environment when it needs it.
+// ExecStart also expands $, which the caller escapes.
+func systemdQuote(s string) string {
+	s = strings.ReplaceAll(s, "%", "%%")
+	if s != "" && !strings.ContainsAny(s, " \t\"'\\;") {
+		return s
+	}
+	return strconv.Quote(s)
+}
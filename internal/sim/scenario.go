@@ -0,0 +1,314 @@
+package sim
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"time"
+)
+
+// The metabolic modules assume these, so the scenario generator inverts them
+// to turn ventilation and CO2 output into the flow and CO2 a rig measures.
+var (
+	simLitersPerCubicFoot float64
+	simAmbientCO2PPM      float64
+)
+
+func init() {
+	simLitersPerCubicFoot = 28.3168
+	simAmbientCO2PPM = 400
+}
+
+// Duration is a time.Duration that reads as a Go duration string.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"1s\": %v", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("failed to parse duration %q: %v", s, err)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Subject is the physiology a scenario plays out on. Effort runs from 0 at
+// rest to 1 at maximal effort; CO2 output rises with it linearly, and
+// ventilation and heart rate follow CO2 output and effort piecewise
+// linearly, with one breakpoint each.
+type Subject struct {
+	RestHR       float64  `json:"rest_hr"`             // bpm
+	MaxHR        float64  `json:"max_hr"`              // bpm
+	RestVCO2     float64  `json:"rest_vco2"`           // L/min
+	MaxVCO2      float64  `json:"max_vco2"`            // L/min
+	VESlope      float64  `json:"ve_vco2_slope"`       // VE/VCO2 below the respiratory compensation point
+	VESlopeAbove float64  `json:"ve_vco2_slope_above"` // and above it, steeper
+	RCPEffort    float64  `json:"rcp_effort"`          // effort at the respiratory compensation point
+	HRDeflection float64  `json:"hr_deflection_effort"`
+	HRFlatten    float64  `json:"hr_flatten"` // HR slope above the deflection as a fraction of the slope below
+	RQ           float64  `json:"rq"`
+	VCO2Tau      Duration `json:"vco2_tau"` // time constants CO2 output and heart rate follow effort with
+	HRTau        Duration `json:"hr_tau"`
+}
+
+func (s Subject) vco2(effort float64) float64 {
+	return s.RestVCO2 + (s.MaxVCO2-s.RestVCO2)*effort
+}
+
+func (s Subject) rcpVCO2() float64 {
+	return s.vco2(s.RCPEffort)
+}
+
+func (s Subject) ve(vco2 float64) float64 {
+	if rcp := s.rcpVCO2(); vco2 > rcp {
+		return s.VESlope*rcp + s.VESlopeAbove*(vco2-rcp)
+	}
+	return s.VESlope * vco2
+}
+
+func (s Subject) hr(effort float64) float64 {
+	d, f := s.HRDeflection, s.HRFlatten
+	k := 1 / (d + f*(1-d)) // so maximal effort reaches MaxHR
+	g := k * effort
+	if effort > d {
+		g = k*d + k*f*(effort-d)
+	}
+	return s.RestHR + (s.MaxHR-s.RestHR)*g
+}
+
+// EE is the energy expenditure in kcal/min at a CO2 output, by the
+// abbreviated Weir equation at the subject's respiratory quotient.
+func (s Subject) EE(vco2 float64) float64 {
+	return 3.941*vco2/s.RQ + 1.106*vco2
+}
+
+// RestEE is the energy expenditure at rest.
+func (s Subject) RestEE() float64 {
+	return s.EE(s.RestVCO2)
+}
+
+// MaxEE is the energy expenditure at maximal effort.
+func (s Subject) MaxEE() float64 {
+	return s.EE(s.MaxVCO2)
+}
+
+// Phase is one stretch of a scenario at an effort, or ramping from Effort to
+// To when To is set.
+type Phase struct {
+	Name     string   `json:"name"` // e.g. "rest", "ramp", "recovery"
+	Duration Duration `json:"duration"`
+	Effort   float64  `json:"effort"`
+	To       *float64 `json:"to,omitempty"`
+}
+
+// Ramp reports whether effort rises through the phase, which is when the
+// threshold modules look for breakpoints.
+func (p Phase) Ramp() bool {
+	return p.To != nil && *p.To > p.Effort
+}
+
+func (p Phase) effort(into time.Duration) float64 {
+	if p.To == nil || p.Duration <= 0 {
+		return p.Effort
+	}
+	return p.Effort + (*p.To-p.Effort)*into.Seconds()/time.Duration(p.Duration).Seconds()
+}
+
+// Tolerance is how close the modules must come to a scenario's ground truth.
+// Unset, they are 5% and 10% for energy expenditure, 0.25 L/min, and a
+// minute.
+type Tolerance struct {
+	MeanEE      float64 `json:"mean_ee"`     // relative
+	Tracking    float64 `json:"ee_tracking"` // mean absolute error of the fused estimate, relative to the mean
+	Ventilatory float64 `json:"ventilatory"` // L/min of VCO2
+	HeartRate   float64 `json:"heart_rate"`  // seconds
+}
+
+// Scenario coordinates CO2, flow, and heart rate through phases of effort on
+// one subject, so the metabolic and threshold modules can be run against a
+// session whose true values are known.
+type Scenario struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Interval    Duration  `json:"interval,omitempty"`        // 1s when unset
+	BreathsPerM float64   `json:"breaths_per_min,omitempty"` // 15 when unset
+	BreathDepth float64   `json:"breath_depth,omitempty"`    // flow swing over a breath as a fraction of the mean
+	NoiseFrac   float64   `json:"noise,omitempty"`           // noise standard deviation as a fraction of the value
+	Seed        int64     `json:"seed,omitempty"`            // zero seeds from the clock
+	Subject     Subject   `json:"subject"`
+	Phases      []Phase   `json:"phases"`
+	Tolerance   Tolerance `json:"tolerance"`
+}
+
+// Truth is what a scenario's session really contained. Thresholds are keyed
+// by kind like threshold.Kind: the CO2 output at the respiratory
+// compensation point, and the seconds into the ramp at which heart rate
+// deflects, both from the first ramp to cross them. A threshold no ramp
+// reaches is absent.
+type Truth struct {
+	EE         []float64          `json:"ee_kcal_min"` // at each sample
+	MeanEE     float64            `json:"mean_ee_kcal_min"`
+	Thresholds map[string]float64 `json:"thresholds"`
+}
+
+// LoadScenario reads a scenario file and checks it.
+func LoadScenario(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scenario: %v", err)
+	}
+	var sc Scenario
+	if err := json.Unmarshal(data, &sc); err != nil {
+		return nil, fmt.Errorf("failed to parse scenario %s: %v", path, err)
+	}
+	if sc.Name == "" {
+		sc.Name = path
+	}
+	if err := sc.validate(); err != nil {
+		return nil, fmt.Errorf("scenario %s: %v", sc.Name, err)
+	}
+	return &sc, nil
+}
+
+func (sc *Scenario) validate() error {
+	if sc.Interval == 0 {
+		sc.Interval = Duration(time.Second)
+	}
+	if sc.BreathsPerM == 0 {
+		sc.BreathsPerM = 15
+	}
+	t := &sc.Tolerance
+	for _, f := range []struct {
+		field *float64
+		def   float64
+	}{{&t.MeanEE, 0.05}, {&t.Tracking, 0.1}, {&t.Ventilatory, 0.25}, {&t.HeartRate, 60}} {
+		if *f.field == 0 {
+			*f.field = f.def
+		}
+	}
+	s := sc.Subject
+	switch {
+	case sc.Interval < 0 || sc.BreathsPerM < 0 || sc.NoiseFrac < 0 || sc.BreathDepth < 0 || sc.BreathDepth >= 1:
+		return fmt.Errorf("interval, breaths_per_min, and noise must be positive, and breath_depth below 1")
+	case s.RestHR <= 0 || s.MaxHR <= s.RestHR:
+		return fmt.Errorf("subject: need 0 < rest_hr < max_hr")
+	case s.RestVCO2 <= 0 || s.MaxVCO2 <= s.RestVCO2:
+		return fmt.Errorf("subject: need 0 < rest_vco2 < max_vco2")
+	case s.VESlope <= 0 || s.VESlopeAbove < s.VESlope:
+		return fmt.Errorf("subject: need 0 < ve_vco2_slope <= ve_vco2_slope_above")
+	case s.RCPEffort <= 0 || s.RCPEffort >= 1 || s.HRDeflection <= 0 || s.HRDeflection >= 1:
+		return fmt.Errorf("subject: rcp_effort and hr_deflection_effort must be between 0 and 1")
+	case s.HRFlatten <= 0 || s.HRFlatten > 1:
+		return fmt.Errorf("subject: hr_flatten must be in (0, 1]")
+	case s.RQ <= 0:
+		return fmt.Errorf("subject: rq must be positive")
+	case s.VCO2Tau < 0 || s.HRTau < 0:
+		return fmt.Errorf("subject: time constants must not be negative")
+	case len(sc.Phases) == 0:
+		return fmt.Errorf("no phases")
+	}
+	names := map[string]bool{}
+	for i, p := range sc.Phases {
+		if p.Name == "" || names[p.Name] {
+			return fmt.Errorf("phases[%d]: need a unique name", i)
+		}
+		names[p.Name] = true
+		if p.Duration <= 0 {
+			return fmt.Errorf("phase %s: duration must be positive", p.Name)
+		}
+		if p.Effort < 0 || p.Effort > 1 || p.To != nil && (*p.To < 0 || *p.To > 1) {
+			return fmt.Errorf("phase %s: effort must be between 0 and 1", p.Name)
+		}
+	}
+	return nil
+}
+
+// Phase returns the phase named name.
+func (sc *Scenario) Phase(name string) (Phase, bool) {
+	for _, p := range sc.Phases {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Phase{}, false
+}
+
+// Run plays the scenario from DefaultConfig's start time, returning the
+// samples a rig would have recorded, each tagged with its phase, and the
+// truth behind them. The subject starts in a steady state at the first
+// phase's effort.
+func (sc *Scenario) Run() ([]Sample, Truth) {
+	seed := sc.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	rng := rand.New(rand.NewSource(seed))
+	noisy := func(v float64) float64 { return v * (1 + sc.NoiseFrac*rng.NormFloat64()) }
+	s := sc.Subject
+	step := time.Duration(sc.Interval)
+	start := DefaultConfig().Start
+	follow := func(v, target float64, tau Duration) float64 { // first-order lag over one step
+		if tau <= 0 {
+			return target
+		}
+		return target + (v-target)*math.Exp(-step.Seconds()/time.Duration(tau).Seconds())
+	}
+
+	truth := Truth{Thresholds: map[string]float64{}}
+	vco2, hr := s.vco2(sc.Phases[0].Effort), s.hr(sc.Phases[0].Effort)
+	var out []Sample
+	var elapsed time.Duration
+	var sumEE float64
+	for _, p := range sc.Phases {
+		for into := time.Duration(0); into < time.Duration(p.Duration); into += step {
+			effort := p.effort(into)
+			if p.Ramp() {
+				sc.crossings(&truth, p, effort, into)
+			}
+			vco2 = follow(vco2, s.vco2(effort), s.VCO2Tau)
+			hr = follow(hr, s.hr(effort), s.HRTau)
+
+			ve := s.ve(vco2)
+			co2 := simAmbientCO2PPM + 1e6*vco2/ve // mixed expired, so steady over a breath
+			breath := math.Sin(2 * math.Pi * sc.BreathsPerM / 60 * (elapsed + into).Seconds())
+			out = append(out, Sample{
+				Time:     start.Add(elapsed + into),
+				CO2PPM:   noisy(co2),
+				FlowSCFM: noisy(ve / simLitersPerCubicFoot * (1 + sc.BreathDepth*breath)),
+				HR:       noisy(hr),
+				Phase:    p.Name,
+			})
+			truth.EE = append(truth.EE, s.EE(vco2))
+			sumEE += s.EE(vco2)
+		}
+		elapsed += time.Duration(p.Duration)
+	}
+	truth.MeanEE = sumEE / float64(len(out))
+	return out, truth
+}
+
+// crossings records the breakpoints a ramp passes at effort, into it. The
+// ventilatory one is at a CO2 output; heart rate shows its deflection one
+// time constant after effort crosses it, the lag of a first-order response
+// to a ramp.
+func (sc *Scenario) crossings(truth *Truth, p Phase, effort float64, into time.Duration) {
+	s := sc.Subject
+	if _, ok := truth.Thresholds["ventilatory"]; !ok && effort >= s.RCPEffort && p.Effort < s.RCPEffort {
+		truth.Thresholds["ventilatory"] = s.rcpVCO2()
+	}
+	if _, ok := truth.Thresholds["heart_rate"]; !ok && effort >= s.HRDeflection && p.Effort < s.HRDeflection {
+		at := into + time.Duration(s.HRTau)
+		if at < time.Duration(p.Duration) {
+			truth.Thresholds["heart_rate"] = at.Seconds()
+		}
+	}
+}
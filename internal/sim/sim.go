@@ -0,0 +1,106 @@
+package sim
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Sample is one simultaneous set of simulated sensor values.
+type Sample struct {
+	Time     time.Time `json:"time"`
+	CO2PPM   float64   `json:"co2_ppm"`
+	FlowSCFM float64   `json:"flow_scfm"`
+	HR       float64   `json:"hr_bpm"`
+	Phase    string    `json:"phase,omitempty"` // of the scenario that produced it
+}
+
+// Config describes a linear ramp from rest to peak with breath-by-breath
+// oscillation on flow and CO2 and gaussian noise on every channel.
+type Config struct {
+	Start        time.Time
+	Duration     time.Duration
+	Interval     time.Duration
+	BreathsPerM  float64
+	RestHR       float64
+	PeakHR       float64
+	RestFlowSCFM float64
+	PeakFlowSCFM float64
+	RestCO2PPM   float64
+	PeakCO2PPM   float64
+	NoiseFrac    float64 // noise standard deviation as a fraction of the value
+
+	// Seed fixes the noise sequence: the same Seed and Config always produce
+	// identical samples. Zero seeds from the clock.
+	Seed int64
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Start:        time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC),
+		Duration:     10 * time.Minute,
+		Interval:     time.Second,
+		BreathsPerM:  15,
+		RestHR:       65,
+		PeakHR:       175,
+		RestFlowSCFM: 0.3,
+		PeakFlowSCFM: 3.5,
+		RestCO2PPM:   25000,
+		PeakCO2PPM:   42000,
+		NoiseFrac:    0.01,
+		Seed:         1,
+	}
+}
+
+type Simulator struct {
+	cfg Config
+	rng *rand.Rand
+	n   int
+}
+
+func NewSimulator(cfg Config) *Simulator {
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &Simulator{cfg: cfg, rng: rand.New(rand.NewSource(seed))}
+}
+
+func (s *Simulator) noisy(v float64) float64 {
+	return v * (1 + s.cfg.NoiseFrac*s.rng.NormFloat64())
+}
+
+// Next returns the next sample, or false once Duration has elapsed.
+func (s *Simulator) Next() (Sample, bool) {
+	elapsed := time.Duration(s.n) * s.cfg.Interval
+	if elapsed > s.cfg.Duration {
+		return Sample{}, false
+	}
+	s.n++
+
+	frac := elapsed.Seconds() / s.cfg.Duration.Seconds()
+	lerp := func(a, b float64) float64 { return a + (b-a)*frac }
+	breath := math.Sin(2 * math.Pi * s.cfg.BreathsPerM / 60 * elapsed.Seconds())
+
+	flow := lerp(s.cfg.RestFlowSCFM, s.cfg.PeakFlowSCFM) * (1 + 0.3*breath)
+	co2 := lerp(s.cfg.RestCO2PPM, s.cfg.PeakCO2PPM) * (1 + 0.05*breath)
+
+	return Sample{
+		Time:     s.cfg.Start.Add(elapsed),
+		CO2PPM:   s.noisy(co2),
+		FlowSCFM: s.noisy(flow),
+		HR:       s.noisy(lerp(s.cfg.RestHR, s.cfg.PeakHR)),
+	}, true
+}
+
+// Run drains the simulator into a slice.
+func (s *Simulator) Run() []Sample {
+	var out []Sample
+	for {
+		sample, ok := s.Next()
+		if !ok {
+			return out
+		}
+		out = append(out, sample)
+	}
+}
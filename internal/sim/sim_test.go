@@ -0,0 +1,34 @@
+package sim
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+// TestDefaultSessionIsReproducible regenerates the golden session from
+// DefaultConfig's fixed seed. It fails when the simulator, or the random
+// sequence under it, no longer produces the checked-in samples.
+func TestDefaultSessionIsReproducible(t *testing.T) {
+	want, err := os.ReadFile("../../testdata/golden/session.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got bytes.Buffer
+	enc := json.NewEncoder(&got) // as golden.Record writes it
+	for _, s := range NewSimulator(DefaultConfig()).Run() {
+		if err := enc.Encode(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(got.Bytes(), want) {
+		gotLines, wantLines := bytes.Split(got.Bytes(), []byte("\n")), bytes.Split(want, []byte("\n"))
+		for i := range min(len(gotLines), len(wantLines)) {
+			if !bytes.Equal(gotLines[i], wantLines[i]) {
+				t.Fatalf("sample %d differs from testdata/golden/session.jsonl:\n got %s\nwant %s", i, gotLines[i], wantLines[i])
+			}
+		}
+		t.Fatalf("regenerated %d samples, testdata/golden/session.jsonl has %d", len(gotLines)-1, len(wantLines)-1)
+	}
+}
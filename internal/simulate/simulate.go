@@ -0,0 +1,163 @@
+// Package simulate stands in for sensor hardware. Each metric follows a
+// Signal, a constant or a repeating ramp with optional noise, and a script
+// of faults makes reads drop out, return garbage, or lose the device
+// altogether, so the daemon and everything downstream of it can be tested
+// without a probe or meter on the bench.
+package simulate
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/demelere/sensor-control-modules/internal/sensorerr"
+)
+
+// Signal is what one metric reads.
+type Signal struct {
+	Value float64       // the constant, or where the ramp starts
+	To    float64       // where the ramp ends
+	Over  time.Duration // ramp from Value to To over this, then start again; 0 holds Value
+	Noise float64       // standard deviation of Gaussian noise added to every read
+}
+
+func (s Signal) at(elapsed time.Duration, rng *rand.Rand) float64 {
+	v := s.Value
+	if s.Over > 0 {
+		frac := float64(elapsed%s.Over) / float64(s.Over)
+		v += (s.To - s.Value) * frac
+	}
+	if s.Noise > 0 {
+		v += rng.NormFloat64() * s.Noise
+	}
+	return v
+}
+
+// FaultKind is how a fault shows to the daemon.
+type FaultKind string
+
+const (
+	Dropout    FaultKind = "dropout"    // reads time out after the read timeout
+	Garbage    FaultKind = "garbage"    // reads get a frame that does not parse
+	Disconnect FaultKind = "disconnect" // reads fail and reopening fails, as with a pulled cable
+)
+
+// ParseFaultKind checks a fault kind from a config.
+func ParseFaultKind(s string) (FaultKind, error) {
+	switch k := FaultKind(s); k {
+	case Dropout, Garbage, Disconnect:
+		return k, nil
+	}
+	return "", fmt.Errorf("unknown fault %q (want dropout, garbage, or disconnect)", s)
+}
+
+// Fault is one entry in a fault script: Kind from At after the device first
+// opens until For later.
+type Fault struct {
+	Kind FaultKind
+	At   time.Duration
+	For  time.Duration
+}
+
+// Device is a simulated sensor. Time starts when it first opens.
+type Device struct {
+	signals map[string]Signal
+	faults  []Fault
+	repeat  time.Duration
+	timeout time.Duration
+
+	mu    sync.Mutex
+	rng   *rand.Rand
+	start time.Time
+	open  bool
+}
+
+// New returns a closed device reading signals by metric. The fault script
+// restarts every repeat, or runs once when repeat is 0. A dropout holds each
+// read for timeout, as a device that stopped answering would. seed makes the
+// noise repeatable; 0 picks one at random.
+func New(signals map[string]Signal, faults []Fault, repeat, timeout time.Duration, seed int64) *Device {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &Device{
+		signals: signals,
+		faults:  faults,
+		repeat:  repeat,
+		timeout: timeout,
+		rng:     rand.New(rand.NewSource(seed)),
+	}
+}
+
+func (d *Device) Open() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.start.IsZero() {
+		d.start = time.Now()
+	}
+	if f, ok := d.fault(); ok && f.Kind == Disconnect {
+		return fmt.Errorf("simulated disconnect: device not found")
+	}
+	d.open = true
+	return nil
+}
+
+func (d *Device) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.open = false
+	return nil
+}
+
+// Read returns every metric's value at the same instant, or the error the
+// fault running at that instant causes.
+func (d *Device) Read(ctx context.Context) (map[string]float64, error) {
+	d.mu.Lock()
+	if !d.open {
+		d.mu.Unlock()
+		return nil, fmt.Errorf("simulated device is not open")
+	}
+	f, faulty := d.fault()
+	if !faulty {
+		elapsed := time.Now().Sub(d.start)
+		values := make(map[string]float64, len(d.signals))
+		for metric, s := range d.signals {
+			values[metric] = s.at(elapsed, d.rng)
+		}
+		d.mu.Unlock()
+		return values, nil
+	}
+	garbage := make([]byte, 8)
+	d.rng.Read(garbage)
+	d.mu.Unlock()
+
+	switch f.Kind {
+	case Dropout:
+		select {
+		case <-time.After(d.timeout):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("simulated dropout: %w", sensorerr.ErrTimeout)
+	case Garbage:
+		return nil, fmt.Errorf("%w: simulated garbage frame % x", sensorerr.ErrInvalidResponse, garbage)
+	default:
+		return nil, fmt.Errorf("simulated disconnect: port is gone")
+	}
+}
+
+// fault returns the fault the script runs now, if any. d.mu must be held.
+func (d *Device) fault() (Fault, bool) {
+	t := time.Now().Sub(d.start)
+	if d.repeat > 0 {
+		t %= d.repeat
+	}
+	for _, f := range d.faults {
+		if t >= f.At && t < f.At+f.For {
+			return f, true
+		}
+	}
+	return Fault{}, false
+}
@@ -0,0 +1,173 @@
+package spectral
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"time"
+)
+
+// Band is a frequency range in Hz, inclusive of Low and exclusive of High.
+type Band struct {
+	Name string  `json:"name"`
+	Low  float64 `json:"low_hz"`
+	High float64 `json:"high_hz"`
+}
+
+var (
+	// HRVBands are the standard short-term HRV bands for an RR-interval series.
+	HRVBands = []Band{{"vlf", 0.0033, 0.04}, {"lf", 0.04, 0.15}, {"hf", 0.15, 0.4}}
+
+	// BreathingBands cover resting to maximal breathing rates in a flow trace.
+	BreathingBands = []Band{{"breathing", 0.1, 1.0}}
+)
+
+// Presets maps config names to band sets.
+var Presets = map[string][]Band{
+	"hrv":       HRVBands,
+	"breathing": BreathingBands,
+}
+
+// FFT transforms x in place; len(x) must be a power of two.
+func FFT(x []complex128) {
+	n := len(x)
+	for i, j := 1, 0; i < n; i++ { // bit-reversal permutation
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j |= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				a, b := x[start+k], w*x[start+k+size/2]
+				x[start+k], x[start+k+size/2] = a+b, a-b
+				w *= step
+			}
+		}
+	}
+}
+
+// Summary is one rolling power-spectrum snapshot. Powers are in the signal
+// unit squared.
+type Summary struct {
+	Time       time.Time
+	PeakHz     float64 // strongest non-DC frequency
+	TotalPower float64
+	Bands      map[string]float64
+}
+
+type sample struct {
+	t time.Time
+	v float64
+}
+
+// Analyzer keeps the most recent window of an irregularly sampled signal and
+// summarises its power spectrum on demand. The signal is linearly resampled
+// onto a uniform grid, detrended, and Hann-windowed before the FFT.
+type Analyzer struct {
+	rate    float64
+	window  time.Duration
+	n       int
+	bands   []Band
+	samples []sample
+}
+
+func NewAnalyzer(rateHz float64, window time.Duration, bands []Band) (*Analyzer, error) {
+	if rateHz <= 0 {
+		return nil, fmt.Errorf("spectral sample rate must be positive")
+	}
+	if window <= 0 {
+		return nil, fmt.Errorf("spectral window must be positive")
+	}
+	n := 1
+	for float64(n) < rateHz*window.Seconds() {
+		n <<= 1
+	}
+	if n < 8 {
+		return nil, fmt.Errorf("spectral window of %s at %g Hz is too short", window, rateHz)
+	}
+	return &Analyzer{rate: rateHz, window: window, n: n, bands: bands}, nil
+}
+
+func (a *Analyzer) Add(t time.Time, v float64) {
+	if len(a.samples) > 0 && !t.After(a.samples[len(a.samples)-1].t) {
+		return // out of order or duplicate
+	}
+	a.samples = append(a.samples, sample{t: t, v: v})
+
+	span := time.Duration(float64(a.n) / a.rate * float64(time.Second))
+	cutoff := t.Add(-span)
+	i := 0
+	for i < len(a.samples)-1 && a.samples[i+1].t.Before(cutoff) { // keep one sample at or before the cutoff for interpolation
+		i++
+	}
+	a.samples = a.samples[i:]
+}
+
+// Summary returns the spectrum of the latest window, or false until a full
+// window has been observed.
+func (a *Analyzer) Summary() (Summary, bool) {
+	if len(a.samples) < 2 {
+		return Summary{}, false
+	}
+	last := a.samples[len(a.samples)-1].t
+	dt := time.Duration(float64(time.Second) / a.rate)
+	first := last.Add(-time.Duration(a.n-1) * dt)
+	if a.samples[0].t.After(first) {
+		return Summary{}, false
+	}
+
+	x := make([]complex128, a.n)
+	var mean float64
+	j := 0
+	for i := range x {
+		t := first.Add(time.Duration(i) * dt)
+		for j < len(a.samples)-2 && a.samples[j+1].t.Before(t) {
+			j++
+		}
+		s0, s1 := a.samples[j], a.samples[j+1]
+		frac := float64(t.Sub(s0.t)) / float64(s1.t.Sub(s0.t))
+		v := s0.v + math.Max(0, math.Min(1, frac))*(s1.v-s0.v)
+		x[i] = complex(v, 0)
+		mean += v
+	}
+	mean /= float64(a.n)
+
+	var wss float64 // window sum of squares, for power normalisation
+	for i := range x {
+		w := 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(a.n-1))
+		x[i] = complex((real(x[i])-mean)*w, 0)
+		wss += w * w
+	}
+	FFT(x)
+
+	// one-sided power per bin, scaled so the bins sum to the signal variance
+	df := a.rate / float64(a.n)
+	sum := Summary{Time: last, Bands: make(map[string]float64, len(a.bands))}
+	var peak float64
+	for k := 1; k <= a.n/2; k++ {
+		p := cmplx.Abs(x[k])
+		p = p * p / (wss * float64(a.n))
+		if k < a.n/2 {
+			p *= 2
+		}
+		f := float64(k) * df
+		sum.TotalPower += p
+		if p > peak {
+			peak, sum.PeakHz = p, f
+		}
+		for _, b := range a.bands {
+			if f >= b.Low && f < b.High {
+				sum.Bands[b.Name] += p
+			}
+		}
+	}
+	return sum, true
+}
@@ -0,0 +1,154 @@
+package startorder
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Module is one part of the daemon that needs others running first, e.g. a
+// derived metric that needs the sensors it is computed from. Start and Stop
+// are optional.
+type Module struct {
+	Name     string
+	Requires []string
+	Start    func(ctx context.Context) error
+	Stop     func()
+}
+
+// Blocked reports a module that was not started because Dependency failed,
+// was blocked itself, or is not configured at all. Dependency is the root
+// cause, not the nearest link in the chain.
+type Blocked struct {
+	Module     string
+	Dependency string
+	Cause      error
+}
+
+func (b Blocked) Error() string {
+	return fmt.Sprintf("%s not started: requires %s, which %v", b.Module, b.Dependency, b.Cause)
+}
+
+func (b Blocked) Unwrap() error {
+	return b.Cause
+}
+
+// Order sorts mods so every module comes after the modules it requires,
+// keeping the declared order where dependencies allow. Requirements that name
+// no module are left for Start to report. It fails only on a cycle.
+func Order(mods []Module) ([]Module, error) {
+	index := make(map[string]int, len(mods))
+	for i, m := range mods {
+		if _, dup := index[m.Name]; dup {
+			return nil, fmt.Errorf("module %s declared twice", m.Name)
+		}
+		index[m.Name] = i
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make([]int, len(mods))
+	ordered := make([]Module, 0, len(mods))
+	var path []string
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case done:
+			return nil
+		case visiting:
+			start := 0
+			for start < len(path) && path[start] != mods[i].Name {
+				start++
+			}
+			return fmt.Errorf("dependency cycle: %s -> %s", strings.Join(path[start:], " -> "), mods[i].Name)
+		}
+		state[i] = visiting
+		path = append(path, mods[i].Name)
+		for _, dep := range mods[i].Requires {
+			if j, ok := index[dep]; ok {
+				if err := visit(j); err != nil {
+					return err
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[i] = done
+		ordered = append(ordered, mods[i])
+		return nil
+	}
+	for i := range mods {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+// Group is a set of modules started together and stopped in reverse.
+type Group struct {
+	started []Module
+}
+
+// Start starts mods in dependency order. A module whose Start fails, or that
+// is blocked, keeps every module that requires it from starting; each of
+// those is reported as a Blocked error alongside the failure itself. The
+// modules that did start are in the returned group, which the caller must
+// Stop, even when errors are returned.
+func Start(ctx context.Context, mods []Module) (*Group, []error) {
+	ordered, err := Order(mods)
+	if err != nil {
+		return &Group{}, []error{err}
+	}
+
+	g := &Group{}
+	declared := make(map[string]bool, len(mods))
+	for _, m := range mods {
+		declared[m.Name] = true
+	}
+	down := map[string]Blocked{} // module -> why it is not running
+	var errs []error
+	for _, m := range ordered {
+		if b, blocked := blockedBy(m, declared, down); blocked {
+			down[m.Name] = b
+			errs = append(errs, b)
+			continue
+		}
+		if m.Start != nil {
+			if err := m.Start(ctx); err != nil {
+				down[m.Name] = Blocked{Module: m.Name, Dependency: m.Name, Cause: fmt.Errorf("failed to start: %w", err)}
+				errs = append(errs, fmt.Errorf("%s: %w", m.Name, err))
+				continue
+			}
+			log.Printf("started %s", m.Name)
+		}
+		g.started = append(g.started, m)
+	}
+	return g, errs
+}
+
+func blockedBy(m Module, declared map[string]bool, down map[string]Blocked) (Blocked, bool) {
+	for _, dep := range m.Requires {
+		if !declared[dep] {
+			return Blocked{Module: m.Name, Dependency: dep, Cause: fmt.Errorf("is not configured")}, true
+		}
+		if b, ok := down[dep]; ok {
+			return Blocked{Module: m.Name, Dependency: b.Dependency, Cause: b.Cause}, true
+		}
+	}
+	return Blocked{}, false
+}
+
+// Stop stops the started modules in reverse start order.
+func (g *Group) Stop() {
+	for i := len(g.started) - 1; i >= 0; i-- {
+		if m := g.started[i]; m.Stop != nil {
+			m.Stop()
+			log.Printf("stopped %s", m.Name)
+		}
+	}
+	g.started = nil
+}
@@ -0,0 +1,124 @@
+// Package thermal reads the host's temperature sensors and decides when an
+// enclosure is hot enough that the rig should shed work it can do without.
+package thermal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// defaultZones are the kernel's thermal zones, usually the CPU or SoC.
+const defaultZones = "/sys/class/thermal/thermal_zone*/temp"
+
+// Reading is one sensor's temperature.
+type Reading struct {
+	Source  string  `json:"source"` // zone type or hwmon label, else the file's path
+	Celsius float64 `json:"celsius"`
+}
+
+// Read reads every file matched by paths, each a sysfs temperature in
+// millidegrees Celsius such as a thermal zone's temp or an hwmon tempN_input
+// (an ambient sensor in the enclosure). Globs are expanded; no paths means
+// every thermal zone. Files that cannot be read are skipped, and an error is
+// returned only when none could be.
+func Read(paths []string) ([]Reading, error) {
+	if len(paths) == 0 {
+		paths = []string{defaultZones}
+	}
+	var (
+		out   []Reading
+		first error
+	)
+	for _, pattern := range paths {
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("bad temperature path %q: %v", pattern, err)
+		}
+		for _, f := range files {
+			c, err := readMilli(f)
+			if err != nil {
+				if first == nil {
+					first = err
+				}
+				continue
+			}
+			out = append(out, Reading{Source: label(f), Celsius: c})
+		}
+	}
+	if len(out) == 0 {
+		if first == nil {
+			first = fmt.Errorf("no temperature sensors at %s", strings.Join(paths, ", "))
+		}
+		return nil, first
+	}
+	return out, nil
+}
+
+func readMilli(path string) (float64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(string(data)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: bad temperature %q", path, strings.TrimSpace(string(data)))
+	}
+	return v / 1000, nil
+}
+
+// label names a sensor file the way the kernel does: a thermal zone by its
+// type ("cpu-thermal"), an hwmon input by its tempN_label.
+func label(path string) string {
+	dir, base := filepath.Split(path)
+	name := filepath.Join(dir, "type")
+	if strings.HasSuffix(base, "_input") {
+		name = filepath.Join(dir, strings.TrimSuffix(base, "_input")+"_label")
+	}
+	if data, err := os.ReadFile(name); err == nil {
+		if s := strings.TrimSpace(string(data)); s != "" {
+			return s
+		}
+	}
+	return path
+}
+
+// Hottest returns the reading with the highest temperature.
+func Hottest(rs []Reading) Reading {
+	var hot Reading
+	for i, r := range rs {
+		if i == 0 || r.Celsius > hot.Celsius {
+			hot = r
+		}
+	}
+	return hot
+}
+
+// Governor decides when to throttle, with hysteresis: it throttles at
+// Throttle and resumes only once the temperature is back down to Resume.
+type Governor struct {
+	Throttle float64 // °C
+	Resume   float64 // °C, default 5 below Throttle
+
+	throttled bool
+}
+
+// Observe records the hottest temperature and reports whether the rig should
+// be throttled and whether that changed.
+func (g *Governor) Observe(celsius float64) (throttled, changed bool) {
+	resume := g.Resume
+	if resume == 0 || resume >= g.Throttle {
+		resume = g.Throttle - 5
+	}
+	switch {
+	case !g.throttled && celsius >= g.Throttle:
+		g.throttled = true
+		return true, true
+	case g.throttled && celsius <= resume:
+		g.throttled = false
+		return false, true
+	}
+	return g.throttled, false
+}
@@ -0,0 +1,289 @@
+package threshold
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/demelere/sensor-control-modules/internal/membudget"
+	"github.com/demelere/sensor-control-modules/internal/ringbuf"
+)
+
+var (
+	thresholdMinSamples     int
+	thresholdMinSegment     int
+	thresholdMinSlopeRatio  float64
+	thresholdStableEvals    int
+	thresholdStableFraction float64
+	thresholdMaxSamples     int
+)
+
+func init() {
+	thresholdMinSamples = 30
+	thresholdMinSegment = 8
+	thresholdMinSlopeRatio = 1.15
+	thresholdStableEvals = 5
+	thresholdStableFraction = 0.05
+	thresholdMaxSamples = 3600 // an hour-long ramp at 1 Hz
+}
+
+type Kind string
+
+const (
+	KindVentilatory Kind = "ventilatory" // VE/VCO2 breakpoint (respiratory compensation)
+	KindHeartRate   Kind = "heart_rate"  // HR deflection point
+)
+
+type Sample struct {
+	Time time.Time
+	VE   float64 // L/min
+	VCO2 float64 // L/min
+	HR   float64 // bpm, 0 if unavailable
+}
+
+// Threshold is a detected breakpoint. At is the x-value of the breakpoint
+// (VCO2 for ventilatory, seconds into the ramp for heart rate).
+type Threshold struct {
+	Kind       Kind
+	Time       time.Time
+	At         float64
+	SlopeRatio float64
+	Sample     Sample
+}
+
+type candidate struct {
+	at    float64
+	count int
+}
+
+// Estimator fits two-segment linear regressions to ramp data as it arrives and
+// reports a threshold once the breakpoint has stayed put for several fits.
+// Each kind is reported at most once per ramp. Only the most recent samples
+// that fit its memory budget reservation are kept.
+type Estimator struct {
+	lock        sync.Mutex
+	samples     *ringbuf.Ring[Sample]
+	budget      *membudget.Account
+	found       map[Kind]Threshold
+	cands       map[Kind]*candidate
+	mark        func(label string, at time.Time)
+	thresholdCh chan Threshold
+}
+
+// NewEstimator creates an estimator. mark, if non-nil, is called with a short
+// label and the breakpoint's sample time whenever a threshold is found.
+func NewEstimator(mark func(label string, at time.Time)) *Estimator {
+	size := int64(unsafe.Sizeof(Sample{}))
+	budget := membudget.Reserve("threshold", int64(thresholdMaxSamples)*size, int64(4*thresholdMinSamples)*size)
+	samples := ringbuf.New[Sample](int(budget.Granted() / size))
+	budget.ReportUsage(func() int64 { return int64(samples.Cap()) * size })
+
+	return &Estimator{
+		samples:     samples,
+		budget:      budget,
+		found:       make(map[Kind]Threshold),
+		cands:       make(map[Kind]*candidate),
+		mark:        mark,
+		thresholdCh: make(chan Threshold, 2),
+	}
+}
+
+func (e *Estimator) Thresholds() <-chan Threshold {
+	return e.thresholdCh
+}
+
+func (e *Estimator) Found() []Threshold {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	out := make([]Threshold, 0, len(e.found))
+	for _, k := range []Kind{KindVentilatory, KindHeartRate} {
+		if t, ok := e.found[k]; ok {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+func (e *Estimator) Add(s Sample) {
+	e.lock.Lock()
+	e.samples.Push(s)
+	var newly []Threshold
+	if e.samples.Len() >= thresholdMinSamples {
+		samples := e.samples.Slice()
+		if t, ok := e.evaluateVentilatory(samples); ok {
+			newly = append(newly, t)
+		}
+		if t, ok := e.evaluateHeartRate(samples); ok {
+			newly = append(newly, t)
+		}
+	}
+	e.lock.Unlock()
+
+	for _, t := range newly {
+		log.Printf("%s threshold detected at %.3f (slope ratio %.2f)", t.Kind, t.At, t.SlopeRatio)
+		if e.mark != nil {
+			e.mark(fmt.Sprintf("%s_threshold", t.Kind), t.Time)
+		}
+		select {
+		case e.thresholdCh <- t:
+		default:
+		}
+	}
+}
+
+func (e *Estimator) evaluateVentilatory(samples []Sample) (Threshold, bool) {
+	if _, done := e.found[KindVentilatory]; done {
+		return Threshold{}, false
+	}
+	xs := make([]float64, len(samples))
+	ys := make([]float64, len(samples))
+	for i, s := range samples {
+		xs[i], ys[i] = s.VCO2, s.VE
+	}
+	return e.accept(KindVentilatory, samples, xs, ys)
+}
+
+func (e *Estimator) evaluateHeartRate(samples []Sample) (Threshold, bool) {
+	if _, done := e.found[KindHeartRate]; done {
+		return Threshold{}, false
+	}
+	xs := make([]float64, 0, len(samples))
+	ys := make([]float64, 0, len(samples))
+	start := samples[0].Time
+	for _, s := range samples {
+		if s.HR > 0 {
+			xs = append(xs, s.Time.Sub(start).Seconds())
+			ys = append(ys, s.HR)
+		}
+	}
+	if len(xs) < thresholdMinSamples {
+		return Threshold{}, false
+	}
+	return e.accept(KindHeartRate, samples, xs, ys)
+}
+
+// accept runs the breakpoint fit and only reports it once the same breakpoint
+// (within thresholdStableFraction of the x-range) has been found
+// thresholdStableEvals times in a row. HR deflection flattens rather than
+// steepens, so for heart rate the slope ratio is inverted.
+func (e *Estimator) accept(kind Kind, samples []Sample, xs, ys []float64) (Threshold, bool) {
+	idx, before, after, ok := breakpoint(xs, ys, thresholdMinSegment)
+	if !ok || before == 0 {
+		delete(e.cands, kind)
+		return Threshold{}, false
+	}
+
+	ratio := after / before
+	if kind == KindHeartRate && after != 0 {
+		ratio = before / after
+	}
+	if ratio < thresholdMinSlopeRatio {
+		delete(e.cands, kind)
+		return Threshold{}, false
+	}
+
+	lo, hi := xs[0], xs[0]
+	for _, x := range xs {
+		if x < lo {
+			lo = x
+		}
+		if x > hi {
+			hi = x
+		}
+	}
+
+	at := xs[idx]
+	c := e.cands[kind]
+	if c == nil || abs(c.at-at) > thresholdStableFraction*(hi-lo) {
+		e.cands[kind] = &candidate{at: at, count: 1}
+		return Threshold{}, false
+	}
+	c.count++
+	if c.count < thresholdStableEvals {
+		return Threshold{}, false
+	}
+
+	sample := samples[len(samples)-1]
+	for _, s := range samples { // locate the sample that sits on the breakpoint
+		if (kind == KindVentilatory && s.VCO2 == at) || (kind == KindHeartRate && s.Time.Sub(samples[0].Time).Seconds() == at) {
+			sample = s
+			break
+		}
+	}
+
+	t := Threshold{Kind: kind, Time: sample.Time, At: at, SlopeRatio: ratio, Sample: sample}
+	e.found[kind] = t
+	delete(e.cands, kind)
+	return t, true
+}
+
+// Reset clears all samples and detected thresholds, e.g. at the start of a new ramp.
+func (e *Estimator) Reset() {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.samples.Reset()
+	e.found = make(map[Kind]Threshold)
+	e.cands = make(map[Kind]*candidate)
+}
+
+// Close releases the estimator's memory budget reservation.
+func (e *Estimator) Close() {
+	e.budget.Release()
+}
+
+// breakpoint finds the split index minimising the combined squared error of
+// two least-squares lines, returning the split and the slopes either side.
+// xs need not be sorted; samples are used in arrival order.
+func breakpoint(xs, ys []float64, minSeg int) (int, float64, float64, bool) {
+	n := len(xs)
+	if n < 2*minSeg {
+		return 0, 0, 0, false
+	}
+
+	var sx, sy, sxx, sxy, syy []float64
+	sx, sy = make([]float64, n+1), make([]float64, n+1)
+	sxx, sxy, syy = make([]float64, n+1), make([]float64, n+1), make([]float64, n+1)
+	for i := 0; i < n; i++ {
+		sx[i+1] = sx[i] + xs[i]
+		sy[i+1] = sy[i] + ys[i]
+		sxx[i+1] = sxx[i] + xs[i]*xs[i]
+		sxy[i+1] = sxy[i] + xs[i]*ys[i]
+		syy[i+1] = syy[i] + ys[i]*ys[i]
+	}
+
+	fit := func(a, b int) (slope, sse float64) { // least squares on [a, b)
+		m := float64(b - a)
+		x, y := sx[b]-sx[a], sy[b]-sy[a]
+		xx, xy, yy := sxx[b]-sxx[a], sxy[b]-sxy[a], syy[b]-syy[a]
+		den := m*xx - x*x
+		if den == 0 {
+			return 0, yy - y*y/m
+		}
+		slope = (m*xy - x*y) / den
+		intercept := (y - slope*x) / m
+		sse = yy - 2*slope*xy - 2*intercept*y + slope*slope*xx + 2*slope*intercept*x + m*intercept*intercept
+		return slope, sse
+	}
+
+	best, bestSSE := -1, 0.0
+	var bestBefore, bestAfter float64
+	for i := minSeg; i <= n-minSeg; i++ {
+		s1, e1 := fit(0, i)
+		s2, e2 := fit(i, n)
+		if best < 0 || e1+e2 < bestSSE {
+			best, bestSSE, bestBefore, bestAfter = i, e1+e2, s1, s2
+		}
+	}
+	return best, bestBefore, bestAfter, best >= 0
+}
+
+func abs(v float64) float64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
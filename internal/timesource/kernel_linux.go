@@ -0,0 +1,33 @@
+package timesource
+
+import (
+	"syscall"
+	"time"
+)
+
+const (
+	staPPSSignal = 0x0100
+	staUnsync    = 0x0040
+	staNano      = 0x2000
+	timeError    = 5
+)
+
+// kernelClock reads the kernel's NTP discipline state via adjtimex, which
+// reflects whichever daemon (chrony, ntpd, timesyncd) is steering the clock.
+func kernelClock() (kernelState, error) {
+	var tx syscall.Timex
+	state, err := syscall.Adjtimex(&tx)
+	if err != nil {
+		return kernelState{}, err
+	}
+	offset := time.Duration(int64(tx.Offset)) * time.Microsecond
+	if int64(tx.Status)&staNano != 0 {
+		offset = time.Duration(int64(tx.Offset))
+	}
+	return kernelState{
+		synced:    state != timeError && int64(tx.Status)&staUnsync == 0,
+		ppsSignal: int64(tx.Status)&staPPSSignal != 0,
+		offset:    offset,
+		maxError:  time.Duration(int64(tx.Maxerror)) * time.Microsecond,
+	}, nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package timesource
+
+import "fmt"
+
+func kernelClock() (kernelState, error) {
+	return kernelState{}, fmt.Errorf("clock discipline state is only available on linux")
+}
@@ -0,0 +1,106 @@
+package timesource
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Source is the clock a session's timestamps are taken to be traceable to.
+type Source int
+
+const (
+	System Source = iota // free-running system clock, no discipline assumed
+	NTP                  // kernel clock disciplined by an NTP daemon
+	GPSPPS               // kernel clock disciplined by a GPS pulse-per-second input
+)
+
+func (s Source) String() string {
+	switch s {
+	case NTP:
+		return "ntp"
+	case GPSPPS:
+		return "gps_pps"
+	}
+	return "system"
+}
+
+func ParseSource(name string) (Source, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "system", "":
+		return System, nil
+	case "ntp":
+		return NTP, nil
+	case "gps_pps", "gps", "pps":
+		return GPSPPS, nil
+	}
+	return System, fmt.Errorf("unknown time source %q", name)
+}
+
+func (s Source) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Status is what a session records about its clock so datasets from several
+// rigs can be aligned afterwards.
+type Status struct {
+	Source       Source    `json:"source"`
+	Synchronized bool      `json:"synchronized"`
+	Offset       Micros    `json:"offset_us"`    // kernel's current offset from the reference
+	MaxError     Micros    `json:"max_error_us"` // kernel's bound on the clock error
+	PPSDevice    string    `json:"pps_device,omitempty"`
+	CheckedAt    time.Time `json:"checked_at"`
+	Detail       string    `json:"detail,omitempty"`
+}
+
+// Micros is a duration that encodes as whole microseconds.
+type Micros time.Duration
+
+func (m Micros) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprint(time.Duration(m).Microseconds())), nil
+}
+
+// Probe reports the state of the clock under the given source. The returned
+// error is non-nil when the source's requirements are not met; the status is
+// still filled in so callers can record it either way.
+func Probe(source Source) (Status, error) {
+	st := Status{Source: source, CheckedAt: time.Now().UTC()}
+	if source == System {
+		st.Synchronized = true
+		return st, nil
+	}
+
+	k, err := kernelClock()
+	if err != nil {
+		st.Detail = err.Error()
+		return st, fmt.Errorf("time source %s: %v", source, err)
+	}
+	st.Synchronized = k.synced
+	st.Offset = Micros(k.offset)
+	st.MaxError = Micros(k.maxError)
+	if !k.synced {
+		st.Detail = "kernel clock is not synchronized"
+		return st, fmt.Errorf("time source %s: kernel clock is not synchronized", source)
+	}
+
+	if source == GPSPPS {
+		devs, _ := filepath.Glob("/dev/pps*")
+		if len(devs) == 0 {
+			st.Detail = "no /dev/pps device"
+			return st, fmt.Errorf("time source %s: no /dev/pps device", source)
+		}
+		st.PPSDevice = devs[0]
+		if !k.ppsSignal {
+			st.Detail = "kernel reports no PPS signal, clock may be disciplined in user space"
+		}
+	}
+	return st, nil
+}
+
+type kernelState struct {
+	synced    bool
+	ppsSignal bool
+	offset    time.Duration
+	maxError  time.Duration
+}
@@ -0,0 +1,107 @@
+package toggle
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Set records which modules an operator switched off at runtime. Everything
+// is enabled unless listed, so a module added to the config later starts
+// enabled. With a path, every change is saved so it survives a restart.
+type Set struct {
+	path     string
+	lock     sync.RWMutex
+	disabled map[string]bool
+}
+
+// Open loads the set saved at path. An empty path keeps it in memory only,
+// and a missing file is an empty set.
+func Open(path string) (*Set, error) {
+	s := &Set{path: path, disabled: map[string]bool{}}
+	if path == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read module state: %w", err)
+	}
+	var saved struct {
+		Disabled []string `json:"disabled"`
+	}
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("failed to parse module state %s: %v", path, err)
+	}
+	for _, name := range saved.Disabled {
+		s.disabled[name] = true
+	}
+	return s, nil
+}
+
+// Enabled is cheap enough to call for every sample.
+func (s *Set) Enabled(name string) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return !s.disabled[name]
+}
+
+// SetEnabled switches name on or off and saves the set. The change stands in
+// memory even if saving fails.
+func (s *Set) SetEnabled(name string, enabled bool) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if enabled == !s.disabled[name] {
+		return nil
+	}
+	if enabled {
+		delete(s.disabled, name)
+	} else {
+		s.disabled[name] = true
+	}
+	return s.saveLocked()
+}
+
+// Disabled returns the disabled modules, sorted.
+func (s *Set) Disabled() []string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.disabledLocked()
+}
+
+func (s *Set) disabledLocked() []string {
+	names := make([]string, 0, len(s.disabled))
+	for name := range s.disabled {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *Set) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(struct {
+		Disabled []string `json:"disabled"`
+	}{s.disabledLocked()}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode module state: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("failed to write module state: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write module state: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to write module state: %w", err)
+	}
+	return nil
+}
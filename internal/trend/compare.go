@@ -0,0 +1,117 @@
+package trend
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// MinBandSessions is how many previous sessions must have recorded a metric
+// before its percentile band means anything.
+var MinBandSessions = 3
+
+// Band is the spread of a metric's session means over previous sessions.
+type Band struct {
+	P10 float64 `json:"p10"`
+	P25 float64 `json:"p25"`
+	P50 float64 `json:"p50"`
+	P75 float64 `json:"p75"`
+	P90 float64 `json:"p90"`
+}
+
+// MetricTrend compares one metric's mean in a session with its means in the
+// previous sessions that recorded it.
+type MetricTrend struct {
+	Sensor   string  `json:"sensor"`
+	Metric   string  `json:"metric"`
+	Unit     string  `json:"unit"`
+	Mean     float64 `json:"mean"`
+	Count    int     `json:"count"`
+	Previous int     `json:"previous_sessions"`
+
+	Baseline     *float64 `json:"baseline,omitempty"`      // mean of the previous session means
+	Delta        *float64 `json:"delta,omitempty"`         // Mean - Baseline
+	DeltaPercent *float64 `json:"delta_percent,omitempty"` // Delta as a percentage of Baseline
+	LastDelta    *float64 `json:"last_delta,omitempty"`    // change since the most recent previous session
+	Band         *Band    `json:"band,omitempty"`          // from MinBandSessions previous sessions
+	Percentile   *float64 `json:"percentile,omitempty"`    // where Mean falls among the previous means, 0-100
+}
+
+// Comparison is a session set against the sessions before it.
+type Comparison struct {
+	Session  string        `json:"session"`
+	SiteID   string        `json:"site_id,omitempty"`
+	Subject  string        `json:"subject,omitempty"`
+	Start    time.Time     `json:"start"`
+	Open     bool          `json:"open"` // still recording, so its statistics are partial
+	Compared []string      `json:"compared"`
+	Metrics  []MetricTrend `json:"metrics"`
+}
+
+// Compare sets cur against previous, oldest first. A metric previous
+// sessions did not record is listed with no baseline.
+func Compare(cur Summary, previous []Summary) Comparison {
+	c := Comparison{Session: cur.Session, SiteID: cur.SiteID, Subject: cur.Subject, Start: cur.Start, Open: cur.End.IsZero(), Compared: []string{}, Metrics: []MetricTrend{}}
+	for _, p := range previous {
+		c.Compared = append(c.Compared, p.Session)
+	}
+	for _, st := range cur.Metrics {
+		t := MetricTrend{Sensor: st.Sensor, Metric: st.Metric, Unit: st.Unit, Mean: st.Mean, Count: st.Count}
+		var means []float64
+		for _, p := range previous {
+			for _, ps := range p.Metrics {
+				if ps.Sensor == st.Sensor && ps.Metric == st.Metric && ps.Unit == st.Unit && ps.Count > 0 {
+					means = append(means, ps.Mean)
+				}
+			}
+		}
+		t.Previous = len(means)
+		if len(means) > 0 {
+			sum := 0.0
+			for _, m := range means {
+				sum += m
+			}
+			baseline := sum / float64(len(means))
+			delta := st.Mean - baseline
+			last := st.Mean - means[len(means)-1]
+			t.Baseline, t.Delta, t.LastDelta = &baseline, &delta, &last
+			if baseline != 0 {
+				pct := 100 * delta / math.Abs(baseline)
+				t.DeltaPercent = &pct
+			}
+			rank := percentileRank(means, st.Mean)
+			t.Percentile = &rank
+		}
+		if len(means) >= MinBandSessions {
+			sorted := append([]float64(nil), means...)
+			sort.Float64s(sorted)
+			t.Band = &Band{P10: quantile(sorted, 0.10), P25: quantile(sorted, 0.25), P50: quantile(sorted, 0.50), P75: quantile(sorted, 0.75), P90: quantile(sorted, 0.90)}
+		}
+		c.Metrics = append(c.Metrics, t)
+	}
+	return c
+}
+
+// quantile interpolates linearly between the sorted values around q.
+func quantile(sorted []float64, q float64) float64 {
+	pos := q * float64(len(sorted)-1)
+	i := int(pos)
+	if i+1 >= len(sorted) {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[i] + (pos-float64(i))*(sorted[i+1]-sorted[i])
+}
+
+// percentileRank is the share of values below v, counting ties as half.
+func percentileRank(values []float64, v float64) float64 {
+	below := 0.0
+	for _, x := range values {
+		switch {
+		case x < v:
+			below++
+		case x == v:
+			below += 0.5
+		}
+	}
+	return 100 * below / float64(len(values))
+}
@@ -0,0 +1,245 @@
+// Package trend keeps per-metric statistics of each finished session, and
+// compares a session with the ones before it for the same subject on the
+// same rig, for following a subject over weeks of visits.
+package trend
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Stats summarises one metric over a session.
+type Stats struct {
+	Sensor string  `json:"sensor"`
+	Metric string  `json:"metric"`
+	Unit   string  `json:"unit"`
+	Count  int     `json:"count"`
+	Mean   float64 `json:"mean"`
+	SD     float64 `json:"sd"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	m2     float64 // sum of squared deviations, for SD
+}
+
+// add folds v in by Welford's method.
+func (s *Stats) add(v float64) {
+	if s.Count == 0 {
+		s.Min, s.Max = v, v
+	}
+	s.Count++
+	d := v - s.Mean
+	s.Mean += d / float64(s.Count)
+	s.m2 += d * (v - s.Mean)
+	s.Min, s.Max = math.Min(s.Min, v), math.Max(s.Max, v)
+	if s.Count > 1 {
+		s.SD = math.Sqrt(s.m2 / float64(s.Count-1))
+	}
+}
+
+// Summary is one session's statistics.
+type Summary struct {
+	Session string    `json:"session"`
+	SiteID  string    `json:"site_id,omitempty"`
+	Subject string    `json:"subject,omitempty"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end,omitempty"` // zero while the session is open
+	Metrics []Stats   `json:"metrics"`
+}
+
+// Session accumulates a summary while a session is recorded. It is not safe
+// for concurrent use.
+type Session struct {
+	summary Summary
+	index   map[[2]string]int
+}
+
+func NewSession(id, siteID, subject string, start time.Time) *Session {
+	return &Session{summary: Summary{Session: id, SiteID: siteID, Subject: subject, Start: start, Metrics: []Stats{}}, index: map[[2]string]int{}}
+}
+
+// Add folds a reading in. Values that are not numbers are skipped.
+func (s *Session) Add(sensor, metric, unit string, v float64) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return
+	}
+	key := [2]string{sensor, metric}
+	i, ok := s.index[key]
+	if !ok {
+		i = len(s.summary.Metrics)
+		s.index[key] = i
+		s.summary.Metrics = append(s.summary.Metrics, Stats{Sensor: sensor, Metric: metric, Unit: unit})
+	}
+	s.summary.Metrics[i].add(v)
+}
+
+// Summary returns the statistics so far, sorted by sensor and metric.
+func (s *Session) Summary() Summary {
+	out := s.summary
+	out.Metrics = append([]Stats(nil), s.summary.Metrics...)
+	sort.Slice(out.Metrics, func(i, j int) bool {
+		if out.Metrics[i].Sensor != out.Metrics[j].Sensor {
+			return out.Metrics[i].Sensor < out.Metrics[j].Sensor
+		}
+		return out.Metrics[i].Metric < out.Metrics[j].Metric
+	})
+	return out
+}
+
+// History is an append-only JSON-lines file of session summaries, held in
+// memory as well. An empty path keeps them in memory only.
+type History struct {
+	path      string
+	lock      sync.Mutex
+	sessions  []Summary // oldest first
+	subjectOf func(string) string
+}
+
+// Open loads the history at path. A missing file is an empty history.
+func Open(path string) (*History, error) {
+	h := &History{path: path}
+	if path == "" {
+		return h, nil
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return h, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read session history: %w", err)
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 4<<20)
+	for sc.Scan() {
+		var s Summary
+		if json.Unmarshal(sc.Bytes(), &s) != nil {
+			continue // torn last line from a power cut
+		}
+		h.sessions = append(h.sessions, s)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read session history: %w", err)
+	}
+	sort.SliceStable(h.sessions, func(i, j int) bool { return h.sessions[i].Start.Before(h.sessions[j].Start) })
+	return h, nil
+}
+
+// Append adds a finished session. It is kept in memory even if writing it
+// fails.
+func (h *History) Append(s Summary) error {
+	line, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("failed to encode session summary: %v", err)
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.sessions = append(h.sessions, s)
+	if h.path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(h.path), 0o755); err != nil {
+		return fmt.Errorf("failed to write session history: %w", err)
+	}
+	f, err := os.OpenFile(h.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to write session history: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write session history: %w", err)
+	}
+	return nil
+}
+
+// MatchSubjects sets how Before maps a recorded subject to the person it
+// stands for, e.g. a rotating pseudonym to its subject, so sessions recorded
+// under different pseudonyms are still compared. Without it subjects are
+// matched as recorded.
+func (h *History) MatchSubjects(subjectOf func(string) string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.subjectOf = subjectOf
+}
+
+// Get returns the summary of a finished session.
+func (h *History) Get(id string) (Summary, bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for _, s := range h.sessions {
+		if s.Session == id {
+			return s, true
+		}
+	}
+	return Summary{}, false
+}
+
+// Before returns up to limit of the sessions that started before s on the
+// same site with the same subject, most recent last; limit 0 returns all.
+// A session without a subject is compared with every session on the site.
+func (h *History) Before(s Summary, limit int) []Summary {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	subject := func(name string) string {
+		if h.subjectOf == nil || name == "" {
+			return name
+		}
+		return h.subjectOf(name)
+	}
+	want := subject(s.Subject)
+	var out []Summary
+	for _, p := range h.sessions {
+		if p.Session == s.Session || !p.Start.Before(s.Start) || p.SiteID != s.SiteID {
+			continue
+		}
+		if want != "" && subject(p.Subject) != want {
+			continue
+		}
+		out = append(out, p)
+	}
+	if limit > 0 && len(out) > limit {
+		out = out[len(out)-limit:]
+	}
+	return out
+}
+
+// Remove deletes the summaries match selects and rewrites the file,
+// returning how many it removed.
+func (h *History) Remove(match func(Summary) bool) (int, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	kept := h.sessions[:0:0]
+	for _, s := range h.sessions {
+		if !match(s) {
+			kept = append(kept, s)
+		}
+	}
+	removed := len(h.sessions) - len(kept)
+	if removed == 0 {
+		return 0, nil
+	}
+	h.sessions = kept
+	if h.path == "" {
+		return removed, nil
+	}
+	var buf []byte
+	for _, s := range kept {
+		line, _ := json.Marshal(s)
+		buf = append(append(buf, line...), '\n')
+	}
+	tmp := h.path + ".tmp"
+	if err := os.WriteFile(tmp, buf, 0o644); err != nil {
+		return removed, fmt.Errorf("failed to rewrite session history: %w", err)
+	}
+	if err := os.Rename(tmp, h.path); err != nil {
+		return removed, fmt.Errorf("failed to rewrite session history: %w", err)
+	}
+	return removed, nil
+}
@@ -0,0 +1,94 @@
+package uncertainty
+
+import (
+	"math"
+	"sync"
+)
+
+var (
+	uncertaintyZ95 float64
+	specLock       sync.RWMutex
+	specs          map[string]Spec
+)
+
+func init() {
+	uncertaintyZ95 = 1.96
+	specs = map[string]Spec{
+		"co2":        {Absolute: 30, Relative: 0.02},    // Vaisala GMP2xx: ±(30 ppm + 2% of reading)
+		"flow":       {Absolute: 0.05, Relative: 0.015}, // Kurz: ±(1.5% of reading + 0.05 SCFM)
+		"heart_rate": {Absolute: 1, Relative: 0},        // Polar H10: ±1 bpm
+	}
+}
+
+// Spec is a sensor accuracy specification in the usual datasheet form of an
+// absolute term plus a fraction of reading, both at one standard deviation.
+type Spec struct {
+	Absolute float64 `json:"absolute"`
+	Relative float64 `json:"relative"`
+}
+
+func (s Spec) Apply(v float64) Quantity {
+	return Quantity{Value: v, StdDev: s.Absolute + s.Relative*math.Abs(v)}
+}
+
+// SetSpec overrides the uncertainty specification for a raw metric.
+func SetSpec(metric string, s Spec) {
+	specLock.Lock()
+	defer specLock.Unlock()
+	specs[metric] = s
+}
+
+func SpecFor(metric string) Spec {
+	specLock.RLock()
+	defer specLock.RUnlock()
+	return specs[metric]
+}
+
+// Measure attaches the configured uncertainty for metric to a raw value.
+func Measure(metric string, v float64) Quantity {
+	return SpecFor(metric).Apply(v)
+}
+
+// Quantity is a value with its one-sigma uncertainty. Arithmetic uses
+// first-order propagation and assumes the operands are independent.
+type Quantity struct {
+	Value  float64 `json:"value"`
+	StdDev float64 `json:"std_dev"`
+}
+
+func Exact(v float64) Quantity {
+	return Quantity{Value: v}
+}
+
+func (q Quantity) Scale(k float64) Quantity {
+	return Quantity{Value: q.Value * k, StdDev: q.StdDev * math.Abs(k)}
+}
+
+func (q Quantity) Offset(c float64) Quantity {
+	return Quantity{Value: q.Value + c, StdDev: q.StdDev}
+}
+
+func Add(a, b Quantity) Quantity {
+	return Quantity{Value: a.Value + b.Value, StdDev: math.Hypot(a.StdDev, b.StdDev)}
+}
+
+func Sub(a, b Quantity) Quantity {
+	return Quantity{Value: a.Value - b.Value, StdDev: math.Hypot(a.StdDev, b.StdDev)}
+}
+
+func Mul(a, b Quantity) Quantity {
+	return Quantity{Value: a.Value * b.Value, StdDev: math.Hypot(a.StdDev*b.Value, b.StdDev*a.Value)}
+}
+
+func Div(a, b Quantity) Quantity {
+	if b.Value == 0 {
+		return Quantity{Value: math.NaN(), StdDev: math.Inf(1)}
+	}
+	v := a.Value / b.Value
+	return Quantity{Value: v, StdDev: math.Hypot(a.StdDev/b.Value, b.StdDev*a.Value/(b.Value*b.Value))}
+}
+
+// CI95 returns the bounds of the 95% confidence interval.
+func (q Quantity) CI95() (float64, float64) {
+	return q.Value - uncertaintyZ95*q.StdDev, q.Value + uncertaintyZ95*q.StdDev
+}
@@ -0,0 +1,124 @@
+package units
+
+import (
+	"fmt"
+	"math"
+)
+
+// Gas flow units beyond SCFM and SLPM. Standard and normal volumes refer to
+// fixed conditions; actual volumes to those in the duct.
+const (
+	ACFM                     Unit = "ACFM"  // actual cubic feet per minute
+	NormalCubicMetersPerHour Unit = "Nm3/h" // at 0 °C and 101.325 kPa
+	KilogramsPerHour         Unit = "kg/h"
+
+	NormalCubicMeter Unit = "Nm3"
+	Kilogram         Unit = "kg"
+)
+
+// Conditions are a gas's temperature (°C) and absolute pressure (kPa).
+type Conditions struct {
+	Temperature float64
+	Pressure    float64
+}
+
+var (
+	// Normal is what normal cubic metres refer to (DIN 1343).
+	Normal = Conditions{Temperature: 0, Pressure: 101.325}
+	// Standard is 77 °F and 14.696 psia, the reference Kurz meters ship
+	// with. Other makers use 60 °F, 68 °F, or 0 °C; check the meter's.
+	Standard = Conditions{Temperature: 25, Pressure: 101.325}
+)
+
+// AirMolarMass is the molar mass of dry air in g/mol.
+const AirMolarMass = 28.9647
+
+const (
+	gasConstant = 8.314462618 // J/(mol K)
+	cubicFoot   = 0.028316846592
+)
+
+// Gas is what converting between flow units needs to know: the conditions
+// standard volumes (SCFM, SLPM) refer to, the conditions in the line for
+// actual volumes (ACFM), and the molar mass for mass flow (kg/h). The zero
+// Standard is Standard and the zero MolarMass is AirMolarMass; the line has
+// no default.
+type Gas struct {
+	Standard  Conditions
+	Line      Conditions
+	MolarMass float64 // g/mol
+}
+
+// IsFlow reports whether ConvertFlow handles u.
+func IsFlow(u Unit) bool {
+	switch u {
+	case SCFM, SLPM, ACFM, NormalCubicMetersPerHour, KilogramsPerHour:
+		return true
+	}
+	return false
+}
+
+// FlowFactor returns what a flow in from is multiplied by to give it in to,
+// treating the gas as ideal.
+func FlowFactor(from, to Unit, g Gas) (float64, error) {
+	if from == to {
+		return 1, nil
+	}
+	f, err := molesPer(from, g)
+	if err != nil {
+		return 0, err
+	}
+	t, err := molesPer(to, g)
+	if err != nil {
+		return 0, err
+	}
+	return f / t, nil
+}
+
+// ConvertFlow converts a gas flow rate between SCFM, SLPM, ACFM, kg/h, and
+// Nm3/h.
+func ConvertFlow(v float64, from, to Unit, g Gas) (float64, error) {
+	factor, err := FlowFactor(from, to, g)
+	if err != nil {
+		return 0, err
+	}
+	return v * factor, nil
+}
+
+// molesPer returns the molar flow, in mol/s, of one u of gas.
+func molesPer(u Unit, g Gas) (float64, error) {
+	if g.Standard == (Conditions{}) {
+		g.Standard = Standard
+	}
+	if g.MolarMass == 0 {
+		g.MolarMass = AirMolarMass
+	}
+	switch u {
+	case SCFM:
+		return moles(cubicFoot/60, g.Standard, "standard")
+	case SLPM:
+		return moles(0.001/60, g.Standard, "standard")
+	case ACFM:
+		if g.Line == (Conditions{}) {
+			return 0, fmt.Errorf("ACFM needs the temperature and pressure in the line")
+		}
+		return moles(cubicFoot/60, g.Line, "line")
+	case NormalCubicMetersPerHour:
+		return moles(1.0/3600, Normal, "normal")
+	case KilogramsPerHour:
+		if !(g.MolarMass > 0) {
+			return 0, fmt.Errorf("kg/h needs the gas's molar mass")
+		}
+		return 1.0 / 3600 / (g.MolarMass / 1000), nil
+	}
+	return 0, fmt.Errorf("%s is not a gas flow unit (want SCFM, SLPM, ACFM, kg/h, or Nm3/h)", u)
+}
+
+// moles returns how many moles are in volume m³ of gas at c.
+func moles(volume float64, c Conditions, name string) (float64, error) {
+	kelvin := c.Temperature + 273.15
+	if !(c.Pressure > 0) || !(kelvin > 0) || math.IsInf(c.Pressure, 0) {
+		return 0, fmt.Errorf("%s conditions %g °C, %g kPa are not physical", name, c.Temperature, c.Pressure)
+	}
+	return volume * c.Pressure * 1000 / (gasConstant * kelvin), nil
+}
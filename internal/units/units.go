@@ -0,0 +1,133 @@
+package units
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+type Unit string
+
+const (
+	PPM        Unit = "ppm"
+	Percent    Unit = "%"
+	BPM        Unit = "bpm"
+	Millis     Unit = "ms"
+	KcalPerMin Unit = "kcal/min"
+	Hertz      Unit = "Hz"
+
+	SCFM Unit = "SCFM" // standard cubic feet per minute
+	SLPM Unit = "SLPM" // standard litres per minute
+
+	Liter     Unit = "L"
+	CubicFoot Unit = "ft3"
+
+	Celsius    Unit = "degC"
+	Fahrenheit Unit = "degF"
+
+	MetersPerSecond Unit = "m/s"
+	FeetPerMinute   Unit = "ft/min"
+
+	HectoPascal Unit = "hPa"
+	PSI         Unit = "psi"
+
+	Volt Unit = "V"
+)
+
+type System int32
+
+const (
+	SI System = iota
+	Imperial
+)
+
+func (s System) String() string {
+	if s == Imperial {
+		return "imperial"
+	}
+	return "si"
+}
+
+func ParseSystem(name string) (System, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "si", "metric", "":
+		return SI, nil
+	case "imperial", "us":
+		return Imperial, nil
+	}
+	return SI, fmt.Errorf("unknown unit system %q", name)
+}
+
+var current atomic.Int32
+
+// SetSystem selects the unit system used by Display for every consumer.
+func SetSystem(s System) {
+	current.Store(int32(s))
+}
+
+func CurrentSystem() System {
+	return System(current.Load())
+}
+
+type conversion struct {
+	base   Unit
+	factor float64 // value in base units = v*factor + offset
+	offset float64
+}
+
+var conversions = map[Unit]conversion{
+	SCFM:            {base: SLPM, factor: 28.3168},
+	SLPM:            {base: SLPM, factor: 1},
+	Liter:           {base: Liter, factor: 1},
+	CubicFoot:       {base: Liter, factor: 28.3168},
+	Celsius:         {base: Celsius, factor: 1},
+	Fahrenheit:      {base: Celsius, factor: 5.0 / 9.0, offset: -32 * 5.0 / 9.0},
+	MetersPerSecond: {base: MetersPerSecond, factor: 1},
+	FeetPerMinute:   {base: MetersPerSecond, factor: 0.00508},
+	HectoPascal:     {base: HectoPascal, factor: 1},
+	PSI:             {base: HectoPascal, factor: 68.9476},
+}
+
+// preferred maps each base unit to what it should be shown as per system;
+// units absent here (ppm, bpm, ...) are the same in both systems.
+var preferred = map[Unit][2]Unit{
+	SLPM:            {SLPM, SCFM},
+	Liter:           {Liter, CubicFoot},
+	Celsius:         {Celsius, Fahrenheit},
+	MetersPerSecond: {MetersPerSecond, FeetPerMinute},
+	HectoPascal:     {HectoPascal, PSI},
+}
+
+func Convert(v float64, from, to Unit) (float64, error) {
+	if from == to {
+		return v, nil
+	}
+	f, ok := conversions[from]
+	if !ok {
+		return 0, fmt.Errorf("no conversion from %s", from)
+	}
+	t, ok := conversions[to]
+	if !ok {
+		return 0, fmt.Errorf("no conversion to %s", to)
+	}
+	if f.base != t.base {
+		return 0, fmt.Errorf("cannot convert %s to %s", from, to)
+	}
+	base := v*f.factor + f.offset
+	return (base - t.offset) / t.factor, nil
+}
+
+// Display converts v into the unit the current system prefers for its
+// dimension. Values in units with no conversion are returned unchanged.
+func Display(v float64, u Unit) (float64, Unit) {
+	c, ok := conversions[u]
+	if !ok {
+		return v, u
+	}
+	target := preferred[c.base][CurrentSystem()]
+	out, err := Convert(v, u, target)
+	if err != nil {
+		return v, u
+	}
+	return out, target
+}
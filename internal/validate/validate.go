@@ -0,0 +1,93 @@
+package validate
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/demelere/sensor-control-modules/pkg/sensor"
+)
+
+// Violation records a stream breaking its contract, once when it starts and
+// again when it clears. Rejected counts the readings dropped in between.
+type Violation struct {
+	Annotation string    `json:"annotation"` // "contract_violation"
+	Sensor     string    `json:"sensor"`
+	Metric     string    `json:"metric"`
+	Kind       string    `json:"kind"`  // "range" or "rate"
+	State      string    `json:"state"` // "raised" or "cleared"
+	Detail     string    `json:"detail,omitempty"`
+	Rejected   int       `json:"rejected,omitempty"`
+	Time       time.Time `json:"time"`
+}
+
+// rateSmoothing weighs each new reading spacing into the running average; a
+// single early read (a slow poll followed by an on-time one) cannot trip it.
+const rateSmoothing = 0.2
+
+// Validator enforces each stream's contract. A value outside the valid range
+// is rejected: it is not a measurement, and must not be recorded as one. A
+// stream arriving at more than twice its expected rate is flagged but kept,
+// since each value may still be sound. Streams arriving too slowly are left
+// to gap detection. A Validator is not safe for concurrent use.
+type Validator struct {
+	streams map[string]*stream // sensor + "/" + metric
+}
+
+type stream struct {
+	contract sensor.Contract
+	last     time.Time
+	spacing  float64 // smoothed seconds between readings
+	range_   *Violation
+	rate     *Violation
+}
+
+func New() *Validator {
+	return &Validator{streams: map[string]*stream{}}
+}
+
+// Expect enforces c on the readings of c.Metric from sensorName.
+func (v *Validator) Expect(sensorName string, c sensor.Contract) {
+	v.streams[sensorName+"/"+c.Metric] = &stream{contract: c}
+}
+
+// Check validates one reading. It reports whether the value is valid and
+// returns a Violation for each contract breach that started or ended with it.
+// Metrics with no contract always pass.
+func (v *Validator) Check(sensorName, metric string, value float64, t time.Time) (bool, []Violation) {
+	s, ok := v.streams[sensorName+"/"+metric]
+	if !ok {
+		return true, nil
+	}
+	c := s.contract
+	var notes []Violation
+	note := func(open **Violation, bad bool, kind, detail string) {
+		switch {
+		case bad && *open == nil:
+			*open = &Violation{Annotation: "contract_violation", Sensor: sensorName, Metric: metric, Kind: kind, State: "raised", Detail: detail, Time: t}
+			notes = append(notes, **open)
+		case !bad && *open != nil:
+			cleared := **open
+			cleared.State, cleared.Detail, cleared.Time = "cleared", "", t
+			notes = append(notes, cleared)
+			*open = nil
+		}
+	}
+
+	valid := value >= c.Min && value <= c.Max
+	note(&s.range_, !valid, "range", fmt.Sprintf("%g %s outside %g..%g", value, c.Unit, c.Min, c.Max))
+	if !valid {
+		s.range_.Rejected++
+	}
+
+	if c.Interval > 0 && !s.last.IsZero() {
+		gap := t.Sub(s.last).Seconds()
+		if s.spacing == 0 {
+			s.spacing = c.Interval.Seconds()
+		}
+		s.spacing += rateSmoothing * (gap - s.spacing)
+		fast := s.spacing < c.Interval.Seconds()/2
+		note(&s.rate, fast, "rate", fmt.Sprintf("a reading every %.3gs, expected every %v", s.spacing, c.Interval))
+	}
+	s.last = t
+	return valid, notes
+}
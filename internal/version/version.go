@@ -0,0 +1,6 @@
+package version
+
+// Version is stamped at build time:
+//
+//	go build -ldflags "-X github.com/demelere/sensor-control-modules/internal/version.Version=v1.2.3" ./cmd/sensorctl
+var Version = "dev"
@@ -0,0 +1,391 @@
+// Package client is a Go SDK for the sensorctl daemon's REST and gRPC APIs.
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIVersion is the daemon API version this client speaks.
+const APIVersion = "v1"
+
+// ErrNotFound is wrapped by errors for 404 responses, e.g. an unknown metric.
+var ErrNotFound = errors.New("not found")
+
+// APIError is returned for any non-2xx response.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("sensorctl api: %d %s", e.StatusCode, e.Message)
+}
+
+func (e *APIError) Unwrap() error {
+	if e.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type SensorInfo struct {
+	Name      string `json:"name"`
+	Driver    string `json:"driver"`
+	Metric    string `json:"metric"`
+	Unit      string `json:"unit,omitempty"`
+	Simulated bool   `json:"simulated,omitempty"`
+}
+
+type Capabilities struct {
+	Version      string       `json:"version"`
+	APIVersions  []string     `json:"api_versions"`
+	GRPCPackages []string     `json:"grpc_packages"`
+	Sensors      []SensorInfo `json:"sensors"`
+	Metrics      []string     `json:"metrics"`
+	Features     []string     `json:"features"`
+}
+
+// HasGRPCPackage reports whether the daemon serves the named gRPC package
+// version, e.g. "sensorctl.v1".
+func (c *Capabilities) HasGRPCPackage(name string) bool {
+	for _, p := range c.GRPCPackages {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// HasFeature reports whether the daemon advertises the named feature.
+func (c *Capabilities) HasFeature(name string) bool {
+	for _, f := range c.Features {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+type MetricMetadata struct {
+	Name             string  `json:"name"`
+	Label            string  `json:"label"`
+	Description      string  `json:"description,omitempty"`
+	Unit             string  `json:"unit"`
+	DisplayPrecision int     `json:"display_precision"`
+	ChartMin         float64 `json:"chart_min"`
+	ChartMax         float64 `json:"chart_max"`
+	Locale           string  `json:"locale"`
+}
+
+type LatestValue struct {
+	Sensor string    `json:"sensor"`
+	Metric string    `json:"metric"`
+	Value  float64   `json:"value"`
+	Unit   string    `json:"unit"`
+	Time   time.Time `json:"time"`
+}
+
+// Contract is a metric's valid range, resolution, and expected reading
+// interval, in the units readings are published in.
+type Contract struct {
+	Sensor           string  `json:"sensor"`
+	Metric           string  `json:"metric"`
+	Unit             string  `json:"unit"`
+	ValidMin         float64 `json:"valid_min"`
+	ValidMax         float64 `json:"valid_max"`
+	Resolution       float64 `json:"resolution"`
+	ExpectedInterval string  `json:"expected_interval,omitempty"`
+}
+
+// LogEntry is one line of the daemon's log, from FollowLogs.
+type LogEntry struct {
+	Time    time.Time         `json:"time"`
+	Level   string            `json:"level"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// Event is one recorded alert or annotation. Raw is the annotation exactly as
+// it appears in the session stream.
+type Event struct {
+	Time    time.Time       `json:"time"`
+	End     *time.Time      `json:"end,omitempty"`
+	Type    string          `json:"type"`
+	Sensor  string          `json:"sensor,omitempty"`
+	Session string          `json:"session,omitempty"`
+	Alert   string          `json:"alert,omitempty"`
+	Message string          `json:"message,omitempty"`
+	Raw     json.RawMessage `json:"event"`
+}
+
+// EventQuery narrows Events and Alerts. Zero fields match everything.
+type EventQuery struct {
+	From, To time.Time
+	Types    []string
+	Sensor   string
+	Limit    int
+}
+
+func (q EventQuery) values() url.Values {
+	v := url.Values{}
+	if !q.From.IsZero() {
+		v.Set("from", q.From.Format(time.RFC3339))
+	}
+	if !q.To.IsZero() {
+		v.Set("to", q.To.Format(time.RFC3339))
+	}
+	for _, t := range q.Types {
+		v.Add("type", t)
+	}
+	if q.Sensor != "" {
+		v.Set("sensor", q.Sensor)
+	}
+	if q.Limit > 0 {
+		v.Set("limit", strconv.Itoa(q.Limit))
+	}
+	return v
+}
+
+// Client talks to one daemon. The zero values of HTTPClient, Retries and
+// Backoff are replaced with defaults by New.
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	Retries    int           // extra attempts after connection errors and 5xx responses
+	Backoff    time.Duration // delay before the first retry, doubled on each attempt
+	Lang       string        // locale for metric metadata, empty for the daemon default
+}
+
+// New returns a client for the daemon at baseURL, e.g. "http://rig-3:8090".
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+		Retries:    3,
+		Backoff:    250 * time.Millisecond,
+	}
+}
+
+// Capabilities returns what the daemon supports.
+func (c *Client) Capabilities(ctx context.Context) (*Capabilities, error) {
+	var caps Capabilities
+	if err := c.get(ctx, "/capabilities", nil, &caps); err != nil {
+		return nil, err
+	}
+	return &caps, nil
+}
+
+// MetricMetadata returns metadata for every metric.
+func (c *Client) MetricMetadata(ctx context.Context) ([]MetricMetadata, error) {
+	var out []MetricMetadata
+	if err := c.get(ctx, "/metrics/metadata", c.langQuery(), &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Metric returns metadata for one metric; the error wraps ErrNotFound if the
+// daemon does not know it.
+func (c *Client) Metric(ctx context.Context, name string) (*MetricMetadata, error) {
+	var out MetricMetadata
+	if err := c.get(ctx, "/metrics/metadata/"+url.PathEscape(name), c.langQuery(), &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Latest returns the most recent value of every metric.
+func (c *Client) Latest(ctx context.Context) ([]LatestValue, error) {
+	var out []LatestValue
+	if err := c.get(ctx, "/metrics/latest", nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// LatestValue returns the most recent value of one metric; the error wraps
+// ErrNotFound until the metric has been seen.
+func (c *Client) LatestValue(ctx context.Context, metric string) (*LatestValue, error) {
+	var out LatestValue
+	if err := c.get(ctx, "/metrics/latest/"+url.PathEscape(metric), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Contracts returns the contract of every polled metric.
+func (c *Client) Contracts(ctx context.Context) ([]Contract, error) {
+	var out []Contract
+	if err := c.get(ctx, "/metrics/contracts", nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Events returns the recorded events matching q, oldest first. The error
+// wraps ErrNotFound when the daemon keeps no event log.
+func (c *Client) Events(ctx context.Context, q EventQuery) ([]Event, error) {
+	var out []Event
+	if err := c.get(ctx, "/events", q.values(), &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Alerts is Events restricted to events that raised an alert.
+func (c *Client) Alerts(ctx context.Context, q EventQuery) ([]Event, error) {
+	var out []Event
+	if err := c.get(ctx, "/alerts", q.values(), &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// FollowLogs calls fn with each daemon log entry at level ("debug", "info",
+// "warn", "error"; empty for info) or above, as it is written, until ctx is
+// done or the daemon closes the stream. It does not retry; entries the
+// daemon dropped because fn was too slow are skipped.
+func (c *Client) FollowLogs(ctx context.Context, level string, fn func(LogEntry)) error {
+	u := c.BaseURL + "/" + APIVersion + "/logs/stream"
+	if level != "" {
+		u += "?" + url.Values{"level": {level}}.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	hc := http.Client{}
+	if c.HTTPClient != nil {
+		hc = *c.HTTPClient
+	}
+	hc.Timeout = 0 // the stream is open-ended; ctx ends it
+	resp, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		var body struct {
+			Error string `json:"error"`
+		}
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		if json.Unmarshal(raw, &body) != nil || body.Error == "" {
+			body.Error = strings.TrimSpace(string(raw))
+		}
+		return &APIError{StatusCode: resp.StatusCode, Message: body.Error}
+	}
+
+	sc := bufio.NewScanner(resp.Body)
+	event := ""
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case line == "":
+			event = ""
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: ") && event == "":
+			var e LogEntry
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e); err != nil {
+				return fmt.Errorf("sensorctl api: decoding log entry: %w", err)
+			}
+			fn(e)
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return sc.Err()
+}
+
+// OpenAPI returns the daemon's OpenAPI document as raw JSON.
+func (c *Client) OpenAPI(ctx context.Context) (json.RawMessage, error) {
+	var out json.RawMessage
+	if err := c.get(ctx, "/openapi.json", nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *Client) langQuery() url.Values {
+	if c.Lang == "" {
+		return nil
+	}
+	return url.Values{"lang": {c.Lang}}
+}
+
+func (c *Client) get(ctx context.Context, path string, query url.Values, out any) error {
+	u := c.BaseURL + "/" + APIVersion + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	backoff := c.Backoff
+	var lastErr error
+	for attempt := 0; attempt <= c.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+
+		retry, err := c.do(ctx, u, out)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if !retry {
+			return err
+		}
+	}
+	return lastErr
+}
+
+// do performs one request and reports whether a failure is worth retrying.
+func (c *Client) do(ctx context.Context, u string, out any) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		var body struct {
+			Error string `json:"error"`
+		}
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		if json.Unmarshal(raw, &body) != nil || body.Error == "" {
+			body.Error = strings.TrimSpace(string(raw))
+		}
+		return resp.StatusCode >= 500, &APIError{StatusCode: resp.StatusCode, Message: body.Error}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return false, fmt.Errorf("sensorctl api: decoding %s: %w", u, err)
+	}
+	return false, nil
+}
@@ -0,0 +1,242 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"iter"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	sensorctlv1 "github.com/demelere/sensor-control-modules/pkg/proto/sensorctl/v1"
+)
+
+// GRPCPackage is the gRPC package version this client speaks.
+const GRPCPackage = "sensorctl.v1"
+
+// Reading is one published value, in display units, from StreamReadings.
+type Reading struct {
+	Sensor string
+	Metric string
+	Value  float64
+	Unit   string
+	Time   time.Time
+}
+
+// ReadingFilter narrows StreamReadings. Empty fields match everything;
+// derived metrics come from sensor "derived".
+type ReadingFilter struct {
+	Metrics []string
+	Sensors []string
+}
+
+// GRPC talks to one daemon over its gRPC API. Unary calls are not retried.
+// Streams reconnect on their own after the connection drops, waiting Backoff
+// before the first attempt and doubling it up to MaxBackoff.
+type GRPC struct {
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	conn *grpc.ClientConn
+	api  sensorctlv1.SensorControlClient
+}
+
+// DialGRPC returns a client for the daemon's gRPC API at addr, e.g.
+// "rig-3:8091". It connects without TLS unless opts set other credentials;
+// the connection is made on first use.
+func DialGRPC(addr string, opts ...grpc.DialOption) (*GRPC, error) {
+	opts = append([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}, opts...)
+	conn, err := grpc.NewClient(addr, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &GRPC{
+		Backoff:    250 * time.Millisecond,
+		MaxBackoff: 10 * time.Second,
+		conn:       conn,
+		api:        sensorctlv1.NewSensorControlClient(conn),
+	}, nil
+}
+
+// Close ends the connection and every stream on it.
+func (g *GRPC) Close() error {
+	return g.conn.Close()
+}
+
+// Capabilities returns what the daemon supports.
+func (g *GRPC) Capabilities(ctx context.Context) (*Capabilities, error) {
+	pc, err := g.api.GetCapabilities(ctx, &sensorctlv1.GetCapabilitiesRequest{})
+	if err != nil {
+		return nil, err
+	}
+	caps := &Capabilities{Version: pc.GetVersion(), APIVersions: pc.GetApiVersions(), GRPCPackages: pc.GetGrpcPackages(), Metrics: pc.GetMetrics(), Features: pc.GetFeatures()}
+	for _, s := range pc.GetSensors() {
+		caps.Sensors = append(caps.Sensors, SensorInfo{Name: s.GetName(), Driver: s.GetDriver(), Metric: s.GetMetric(), Unit: s.GetUnit(), Simulated: s.GetSimulated()})
+	}
+	return caps, nil
+}
+
+// Latest returns the most recent value of every metric.
+func (g *GRPC) Latest(ctx context.Context) ([]LatestValue, error) {
+	resp, err := g.api.ListLatest(ctx, &sensorctlv1.ListLatestRequest{})
+	if err != nil {
+		return nil, err
+	}
+	var out []LatestValue
+	for _, r := range resp.GetReadings() {
+		out = append(out, LatestValue(reading(r)))
+	}
+	return out, nil
+}
+
+// Mark records a marker in the open session.
+func (g *GRPC) Mark(ctx context.Context, label string) error {
+	_, err := g.api.AddMarker(ctx, &sensorctlv1.AddMarkerRequest{Label: label})
+	return err
+}
+
+// Events yields the recorded events matching q, oldest first, fetching them
+// a page of q.Limit (the daemon's default when 0) at a time. It stops after
+// the first error, which it yields.
+func (g *GRPC) Events(ctx context.Context, q EventQuery) iter.Seq2[Event, error] {
+	return g.events(ctx, q, false)
+}
+
+// Alerts is Events restricted to events that raised an alert.
+func (g *GRPC) Alerts(ctx context.Context, q EventQuery) iter.Seq2[Event, error] {
+	return g.events(ctx, q, true)
+}
+
+func (g *GRPC) events(ctx context.Context, q EventQuery, alerts bool) iter.Seq2[Event, error] {
+	return func(yield func(Event, error) bool) {
+		req := &sensorctlv1.ListEventsRequest{Types: q.Types, Sensor: q.Sensor, AlertsOnly: alerts, PageSize: int32(q.Limit)}
+		if !q.From.IsZero() {
+			req.From = timestamppb.New(q.From)
+		}
+		if !q.To.IsZero() {
+			req.To = timestamppb.New(q.To)
+		}
+		for {
+			resp, err := g.api.ListEvents(ctx, req)
+			if err != nil {
+				yield(Event{}, err)
+				return
+			}
+			for _, pe := range resp.GetEvents() {
+				e := Event{Time: pe.GetTime().AsTime(), Type: pe.GetType(), Sensor: pe.GetSensor(), Session: pe.GetSession(), Alert: pe.GetAlert(), Message: pe.GetMessage(), Raw: []byte(pe.GetEventJson())}
+				if pe.End != nil {
+					end := pe.GetEnd().AsTime()
+					e.End = &end
+				}
+				if !yield(e, nil) {
+					return
+				}
+			}
+			if resp.GetNextPageToken() == "" {
+				return
+			}
+			req.PageToken = resp.GetNextPageToken()
+		}
+	}
+}
+
+// StreamReadings follows every reading matching f as it is recorded, until
+// ctx is done.
+func (g *GRPC) StreamReadings(ctx context.Context, f ReadingFilter) *Stream[Reading] {
+	req := &sensorctlv1.StreamReadingsRequest{Metrics: f.Metrics, Sensors: f.Sensors}
+	return newStream(ctx, g, func(ctx context.Context) (grpc.ServerStreamingClient[sensorctlv1.Reading], error) {
+		return g.api.StreamReadings(ctx, req)
+	}, reading)
+}
+
+// StreamLogs follows the daemon's log entries at level ("debug", "info",
+// "warn", "error"; empty for info) or above, until ctx is done.
+func (g *GRPC) StreamLogs(ctx context.Context, level string) *Stream[LogEntry] {
+	req := &sensorctlv1.StreamLogsRequest{Level: level}
+	return newStream(ctx, g, func(ctx context.Context) (grpc.ServerStreamingClient[sensorctlv1.LogEntry], error) {
+		return g.api.StreamLogs(ctx, req)
+	}, func(e *sensorctlv1.LogEntry) LogEntry {
+		return LogEntry{Time: e.GetTime().AsTime(), Level: e.GetLevel(), Message: e.GetMessage(), Fields: e.GetFields()}
+	})
+}
+
+// Stream is a typed server stream that reopens itself when the connection
+// drops or the daemon restarts. Values sent while it was reconnecting, or
+// dropped by the daemon because the reader fell behind, are not seen.
+type Stream[T any] struct {
+	ctx     context.Context
+	g       *GRPC
+	recv    func() (T, error)
+	open    func(context.Context) error
+	backoff time.Duration
+}
+
+func newStream[M, T any](ctx context.Context, g *GRPC, open func(context.Context) (grpc.ServerStreamingClient[M], error), conv func(*M) T) *Stream[T] {
+	s := &Stream[T]{ctx: ctx, g: g}
+	var cur grpc.ServerStreamingClient[M]
+	s.open = func(ctx context.Context) (err error) {
+		cur, err = open(ctx)
+		return err
+	}
+	s.recv = func() (T, error) {
+		var zero T
+		if cur == nil {
+			return zero, io.EOF
+		}
+		m, err := cur.Recv()
+		if err != nil {
+			cur = nil
+			return zero, err
+		}
+		return conv(m), nil
+	}
+	return s
+}
+
+// Recv returns the next value. It fails only once ctx is done or the daemon
+// refuses the stream, e.g. with codes.Unimplemented on a rig without it.
+func (s *Stream[T]) Recv() (T, error) {
+	for {
+		v, err := s.recv()
+		if err == nil {
+			s.backoff = 0
+			return v, nil
+		}
+		if s.ctx.Err() != nil {
+			return v, s.ctx.Err()
+		}
+		if !errors.Is(err, io.EOF) && status.Code(err) != codes.Unavailable {
+			return v, err
+		}
+		if err := s.wait(); err != nil {
+			return v, err
+		}
+		if err := s.open(s.ctx); err != nil && status.Code(err) != codes.Unavailable {
+			return v, err
+		}
+	}
+}
+
+// wait sleeps before a reconnect; the first one follows at once.
+func (s *Stream[T]) wait() error {
+	if s.backoff == 0 {
+		s.backoff = s.g.Backoff
+		return nil
+	}
+	select {
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	case <-time.After(s.backoff):
+	}
+	s.backoff = min(2*s.backoff, s.g.MaxBackoff)
+	return nil
+}
+
+func reading(r *sensorctlv1.Reading) Reading {
+	return Reading{Sensor: r.GetSensor(), Metric: r.GetMetric(), Value: r.GetValue(), Unit: r.GetUnit(), Time: r.GetTime().AsTime()}
+}
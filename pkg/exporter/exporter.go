@@ -0,0 +1,116 @@
+// Package exporter is the stable interface for exporters kept outside this
+// repository. A plugin exporter is a program of its own: sensorctl starts it,
+// feeds it everything it records as JSON lines on stdin, and logs whatever it
+// writes to stderr. A plugin written in Go only has to implement Exporter and
+// call Serve; one in another language writes Handshake to stdout, then reads
+// one Message per line until stdin closes.
+package exporter
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+// Protocol is the version of the message format. It changes only when an
+// existing plugin would misread the messages; new fields do not change it.
+const Protocol = 1
+
+// Handshake is the first line a plugin writes to stdout, so the host knows it
+// started the right program and that it speaks this Protocol. Nothing else
+// may be written to stdout.
+var Handshake = fmt.Sprintf("sensorctl-exporter %d", Protocol)
+
+// Reading is one published value, in display units.
+type Reading struct {
+	Sensor string    `json:"sensor"`
+	Metric string    `json:"metric"`
+	Value  float64   `json:"value"`
+	Unit   string    `json:"unit"`
+	Time   time.Time `json:"time"`
+}
+
+// Event is an annotation recorded alongside the readings: a session start or
+// end, a gap, a device fault, a label, and so on. Data is the record exactly
+// as it is written to the session file.
+type Event struct {
+	Type   string          `json:"type"` // e.g. "session_start", "gap", "device_fault", "label"
+	Sensor string          `json:"sensor,omitempty"`
+	Time   time.Time       `json:"time"`
+	Data   json.RawMessage `json:"data"`
+}
+
+// Alert is an event someone should look at, as the MQTT exporter publishes
+// them.
+type Alert struct {
+	Kind    string    `json:"kind"` // e.g. "gap", "fault", "disk_low"
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// Message is one line on the plugin's stdin. An event that raises an alert
+// carries both.
+type Message struct {
+	Reading *Reading `json:"reading,omitempty"`
+	Event   *Event   `json:"event,omitempty"`
+	Alert   *Alert   `json:"alert,omitempty"`
+}
+
+// Exporter is implemented by plugins. Calls come one at a time, in recording
+// order. An error is logged and the plugin carries on; an exporter that
+// cannot continue should exit instead, and the host restarts it. An Exporter
+// that is also an io.Closer is closed once the host stops sending.
+type Exporter interface {
+	Reading(Reading) error
+	Event(Event) error
+	Alert(Alert) error
+}
+
+// Serve runs e as a plugin on stdin and stdout and returns when stdin closes,
+// which is how the host stops it. Log output goes to stderr, where the host
+// picks it up.
+func Serve(e Exporter) error {
+	log.SetFlags(0)
+	return serve(os.Stdin, os.Stdout, e)
+}
+
+func serve(in io.Reader, out io.Writer, e Exporter) error {
+	if _, err := fmt.Fprintln(out, Handshake); err != nil {
+		return fmt.Errorf("failed to write handshake: %w", err)
+	}
+	sc := bufio.NewScanner(in)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for sc.Scan() {
+		var m Message
+		if err := json.Unmarshal(sc.Bytes(), &m); err != nil {
+			log.Printf("bad message: %v", err)
+			continue
+		}
+		if m.Reading != nil {
+			if err := e.Reading(*m.Reading); err != nil {
+				log.Printf("reading %s/%s: %v", m.Reading.Sensor, m.Reading.Metric, err)
+			}
+		}
+		if m.Event != nil {
+			if err := e.Event(*m.Event); err != nil {
+				log.Printf("event %s: %v", m.Event.Type, err)
+			}
+		}
+		if m.Alert != nil {
+			if err := e.Alert(*m.Alert); err != nil {
+				log.Printf("alert %s: %v", m.Alert.Kind, err)
+			}
+		}
+	}
+	err := sc.Err()
+	if c, ok := e.(io.Closer); ok {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,141 @@
+package exporter
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+var (
+	handshakeTimeout time.Duration // for the plugin to start and write its handshake
+	stopTimeout      time.Duration // for the plugin to exit once its stdin is closed
+)
+
+func init() {
+	handshakeTimeout = 10 * time.Second
+	stopTimeout = 5 * time.Second
+}
+
+// Plugin is a running plugin exporter, seen from the host.
+type Plugin struct {
+	name   string
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	enc    *json.Encoder
+	exited chan struct{} // closed once the process has exited
+	err    error         // why it exited, valid after exited is closed
+}
+
+// StartPlugin starts command, its arguments included, as the exporter name
+// and waits for its handshake. Its stderr is logged line by line.
+func StartPlugin(name string, command []string) (*Plugin, error) {
+	if len(command) == 0 {
+		return nil, fmt.Errorf("plugin %s: no command", name)
+	}
+	cmd := exec.Command(command[0], command[1:]...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: %v", name, err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: %v", name, err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: %v", name, err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start plugin %s: %w", name, err)
+	}
+	p := &Plugin{name: name, cmd: cmd, stdin: stdin, enc: json.NewEncoder(stdin), exited: make(chan struct{})}
+
+	logged := make(chan struct{})
+	go func() {
+		defer close(logged)
+		sc := bufio.NewScanner(stderr)
+		for sc.Scan() {
+			log.Printf("plugin %s: %s", name, sc.Text())
+		}
+	}()
+	handshake := make(chan string, 1)
+	go func() {
+		sc := bufio.NewScanner(stdout)
+		if sc.Scan() {
+			handshake <- strings.TrimSpace(sc.Text())
+		}
+		close(handshake)
+		for sc.Scan() { // stdout is the handshake's alone
+			log.Printf("plugin %s wrote to stdout: %s", name, sc.Text())
+		}
+	}()
+	go func() {
+		<-logged // Wait must not close stderr before it is read to the end
+		p.err = cmd.Wait()
+		close(p.exited)
+	}()
+
+	select {
+	case line, ok := <-handshake:
+		switch {
+		case line == Handshake:
+			return p, nil
+		case !ok:
+			p.Close()
+			return nil, fmt.Errorf("plugin %s exited before its handshake: %v", name, p.err)
+		default:
+			p.Close()
+			return nil, fmt.Errorf("plugin %s: handshake %q, want %q", name, line, Handshake)
+		}
+	case <-time.After(handshakeTimeout):
+		p.Close()
+		return nil, fmt.Errorf("plugin %s: no handshake within %v", name, handshakeTimeout)
+	}
+}
+
+// Send writes m to the plugin. It fails once the plugin has exited.
+func (p *Plugin) Send(m Message) error {
+	select {
+	case <-p.exited:
+		return p.exitErr()
+	default:
+	}
+	if err := p.enc.Encode(m); err != nil {
+		select {
+		case <-p.exited:
+			return p.exitErr()
+		case <-time.After(100 * time.Millisecond):
+		}
+		return fmt.Errorf("plugin %s: %w", p.name, err)
+	}
+	return nil
+}
+
+func (p *Plugin) exitErr() error {
+	if p.err == nil {
+		return fmt.Errorf("plugin %s exited", p.name)
+	}
+	return fmt.Errorf("plugin %s exited: %w", p.name, p.err)
+}
+
+// Close closes the plugin's stdin, telling it to finish, and kills it if it
+// has not exited within a few seconds.
+func (p *Plugin) Close() error {
+	p.stdin.Close()
+	select {
+	case <-p.exited:
+	case <-time.After(stopTimeout):
+		p.cmd.Process.Kill()
+		<-p.exited
+		return fmt.Errorf("plugin %s did not stop, killed", p.name)
+	}
+	if p.err != nil {
+		return fmt.Errorf("plugin %s: %w", p.name, p.err)
+	}
+	return nil
+}
@@ -0,0 +1,406 @@
+package kurz
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/demelere/sensor-control-modules/internal/portworker"
+)
+
+// Field calibration commands. In calibration mode the meter holds its analog
+// outputs and accepts the zero and span commands; the coefficients they set
+// are parameters like any other. The span takes the reference flow in the
+// units the meter reports.
+var (
+	kurzCmdCalEnter       string
+	kurzCmdCalExit        string
+	kurzCmdCalZero        string
+	kurzCmdCalSpan        string
+	kurzParamCalZero      string
+	kurzParamCalSpan      string
+	kurzParamCalDate      string
+	kurzMaxZeroVelocity   float64 // SFPM, the most a meter may read for a zero without Force
+	kurzMaxSpanCorrection float64 // fraction of the reference corrected without Force
+)
+
+func init() {
+	kurzCmdCalEnter = "CAL ON"
+	kurzCmdCalExit = "CAL OFF"
+	kurzCmdCalZero = "CAL ZERO"
+	kurzCmdCalSpan = "CAL SPAN %g"
+	kurzParamCalZero = "CAL_ZERO"
+	kurzParamCalSpan = "CAL_SPAN"
+	kurzParamCalDate = "CAL_DATE"
+	kurzMaxZeroVelocity = 50
+	kurzMaxSpanCorrection = 0.25
+}
+
+// ErrNotConfirmed is returned when a calibration step was not confirmed.
+var ErrNotConfirmed = errors.New("calibration not confirmed")
+
+// CalibrationOptions are the guard rails around a command that changes the
+// meter's calibration.
+type CalibrationOptions struct {
+	// Confirm is asked before each change with a description of it,
+	// including what the meter reads now; the change is made only if it
+	// returns true. Nil refuses every change.
+	Confirm func(prompt string) bool
+	// DryRun reads the meter and returns the steps that would be sent,
+	// without asking or sending them.
+	DryRun bool
+	// Force allows a zero while the meter reads more than 50 SFPM, or a
+	// span correcting it by more than a quarter of the reference.
+	Force bool
+	// Date is recorded as the calibration date after an adjustment; zero
+	// records today.
+	Date time.Time
+	// AuditLog is the file a CalibrationRecord of each change is appended
+	// to, failed ones included; empty keeps no record.
+	AuditLog string
+}
+
+// CalibrationStep is one command of a calibration, with the meter's reply
+// (empty on a dry run).
+type CalibrationStep struct {
+	Command string `json:"command"`
+	Reply   string `json:"reply,omitempty"`
+}
+
+// Coefficients are the meter's field calibration: its flow is
+// (raw - Zero) * Span, in the units it reports.
+type Coefficients struct {
+	Zero float64 `json:"zero"`
+	Span float64 `json:"span"`
+	Date string  `json:"date,omitempty"` // as the meter prints it
+}
+
+// CalibrationRecord is one line of the audit trail: a zero or span
+// adjustment with the meter's coefficients and flow before and after it.
+type CalibrationRecord struct {
+	Time          time.Time         `json:"time"`
+	Model         string            `json:"model,omitempty"`
+	SerialNumber  string            `json:"serial_number,omitempty"`
+	Kind          string            `json:"kind"` // "zero" or "span"
+	Reference     float64           `json:"reference"`
+	Unit          string            `json:"unit"`
+	Before        Coefficients      `json:"before"`
+	After         *Coefficients     `json:"after,omitempty"` // nil if they could not be read back
+	ReadingBefore float64           `json:"reading_before"`
+	ReadingAfter  *float64          `json:"reading_after,omitempty"`
+	Steps         []CalibrationStep `json:"steps"`
+	Error         string            `json:"error,omitempty"`
+}
+
+// EnterCalibration puts the meter in calibration mode, which CalibrateZero
+// and CalibrateSpan need. Readings are marked sensor.Uncertain until
+// ExitCalibration. Terminal protocol only.
+func (ks *KurzSensor) EnterCalibration(ctx context.Context) error {
+	if ks.constantFlowRateSCFM != 0.0 {
+		return fmt.Errorf("kurz sensor has a constant flow rate and cannot be calibrated")
+	}
+	err := ks.port.Submit(ctx, portworker.Calibration, func() error {
+		if err := ks.terminal(); err != nil {
+			return err
+		}
+		if _, err := ks.calCommand(ctx, kurzCmdCalEnter); err != nil {
+			return err
+		}
+		ks.calibrating.Store(true)
+		return nil
+	})
+	if errors.Is(err, portworker.ErrStopped) {
+		return fmt.Errorf("kurz sensor is not open: %w", err)
+	} else if err != nil {
+		return fmt.Errorf("failed to enter calibration mode: %w", err)
+	}
+	log.Printf("kurz meter %s: calibration mode", ks.sensorSerialNumber)
+	return nil
+}
+
+// ExitCalibration returns the meter to normal operation with whatever
+// coefficients it has.
+func (ks *KurzSensor) ExitCalibration(ctx context.Context) error {
+	err := ks.port.Submit(ctx, portworker.Calibration, func() error {
+		if err := ks.terminal(); err != nil {
+			return err
+		}
+		if _, err := ks.calCommand(ctx, kurzCmdCalExit); err != nil {
+			return err
+		}
+		ks.calibrating.Store(false)
+		return nil
+	})
+	if errors.Is(err, portworker.ErrStopped) {
+		return fmt.Errorf("kurz sensor is not open: %w", err)
+	} else if err != nil {
+		return fmt.Errorf("failed to leave calibration mode: %w", err)
+	}
+	log.Printf("kurz meter %s: calibration mode left", ks.sensorSerialNumber)
+	return nil
+}
+
+// CalibrateZero sets the meter's zero. The probe must be in still air, e.g.
+// capped or in a zero chamber. See CalibrationOptions for the guard rails.
+func (ks *KurzSensor) CalibrateZero(ctx context.Context, opts CalibrationOptions) ([]CalibrationStep, error) {
+	return ks.adjust(ctx, "zero", kurzCmdCalZero, 0, opts)
+}
+
+// CalibrateSpan sets the meter's span against a reference flow, in the units
+// the meter reports (SCFM unless WithFlowUnits says otherwise).
+func (ks *KurzSensor) CalibrateSpan(ctx context.Context, reference float64, opts CalibrationOptions) ([]CalibrationStep, error) {
+	if reference <= 0 || math.IsInf(reference, 0) {
+		return nil, fmt.Errorf("span reference %g must be a positive flow", reference)
+	}
+	return ks.adjust(ctx, "span", fmt.Sprintf(kurzCmdCalSpan, reference), reference, opts)
+}
+
+// adjust runs one zero or span adjustment: read the meter and its
+// coefficients, check the correction, confirm, adjust, record the date, and
+// read both back for the audit trail.
+func (ks *KurzSensor) adjust(ctx context.Context, kind, cmd string, reference float64, opts CalibrationOptions) ([]CalibrationStep, error) {
+	if !ks.calibrating.Load() {
+		return nil, fmt.Errorf("meter is not in calibration mode")
+	}
+	rec := CalibrationRecord{Kind: kind, Reference: reference, Unit: string(ks.flowNative)}
+	var velocity float64
+	err := ks.port.Submit(ctx, portworker.Calibration, func() error {
+		if err := ks.terminal(); err != nil {
+			return err
+		}
+		rec.Model, rec.SerialNumber = ks.sensorModel, ks.sensorSerialNumber
+		var err error
+		if rec.Before, err = ks.coefficients(ctx); err != nil {
+			return err
+		}
+		rec.ReadingBefore, velocity, err = ks.readFlowVelocity(ctx)
+		return err
+	})
+	if errors.Is(err, portworker.ErrStopped) {
+		return nil, fmt.Errorf("kurz sensor is not open: %w", err)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read the meter before %s calibration: %w", kind, err)
+	}
+	switch {
+	case opts.Force:
+	case kind == "zero" && math.IsNaN(velocity):
+		return nil, fmt.Errorf("meter reports no velocity to check for still air; force the zero if the probe is capped")
+	case kind == "zero" && math.Abs(velocity) > kurzMaxZeroVelocity:
+		return nil, fmt.Errorf("zero calibration with the meter reading %.0f SFPM, more than %.0f; cap the probe or force it", velocity, kurzMaxZeroVelocity)
+	case kind == "span" && math.Abs(rec.ReadingBefore-reference) > kurzMaxSpanCorrection*reference:
+		return nil, fmt.Errorf("span calibration would correct the meter from %g to %g %s, more than %.0f%%; check the reference or force it", rec.ReadingBefore, reference, rec.Unit, kurzMaxSpanCorrection*100)
+	}
+
+	date := opts.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	rec.Steps = []CalibrationStep{
+		{Command: cmd},
+		{Command: fmt.Sprintf(strings.TrimSuffix(kurzCmdSetParameter, "\r"), kurzParamCalDate, date.Format("2006-01-02"))},
+	}
+	if opts.DryRun {
+		return rec.Steps, nil
+	}
+	prompt := fmt.Sprintf("%s calibration of kurz meter %s at %g %s; it reads %g %s now, zero %g span %g", kind, rec.SerialNumber, reference, rec.Unit, rec.ReadingBefore, rec.Unit, rec.Before.Zero, rec.Before.Span)
+	if opts.Confirm == nil || !opts.Confirm(prompt) {
+		return nil, ErrNotConfirmed
+	}
+
+	sent := 0
+	err = ks.port.Submit(ctx, portworker.Calibration, func() error {
+		if err := ks.terminal(); err != nil {
+			return err
+		}
+		for i := range rec.Steps {
+			sent = i + 1
+			reply, err := ks.calCommand(ctx, rec.Steps[i].Command)
+			rec.Steps[i].Reply = reply
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, portworker.ErrStopped) {
+		err = fmt.Errorf("kurz sensor is not open: %w", err)
+	}
+	rec.Steps = rec.Steps[:sent]
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	if sent > 0 {
+		ks.readBack(ctx, &rec)
+		rec.Time = time.Now().UTC()
+		if aerr := appendAudit(opts.AuditLog, rec); aerr != nil {
+			if err == nil {
+				return rec.Steps, fmt.Errorf("calibrated, but %w", aerr)
+			}
+			log.Printf("kurz meter %s: %v", rec.SerialNumber, aerr)
+		}
+	}
+	if err != nil {
+		return rec.Steps, err
+	}
+	if rec.After != nil {
+		log.Printf("kurz meter %s: %s calibration done, zero %g span %g now zero %g span %g", rec.SerialNumber, kind, rec.Before.Zero, rec.Before.Span, rec.After.Zero, rec.After.Span)
+	}
+	return rec.Steps, nil
+}
+
+// readBack fills in the coefficients and flow after an adjustment. Either
+// stays nil if the meter does not answer, which the record shows as well as
+// the log.
+func (ks *KurzSensor) readBack(ctx context.Context, rec *CalibrationRecord) {
+	err := ks.port.Submit(context.WithoutCancel(ctx), portworker.Calibration, func() error {
+		if err := ks.terminal(); err != nil {
+			return err
+		}
+		after, err := ks.coefficients(ctx)
+		if err != nil {
+			return err
+		}
+		rec.After = &after
+		flow, _, err := ks.readFlowVelocity(ctx)
+		if err != nil {
+			return err
+		}
+		rec.ReadingAfter = &flow
+		return nil
+	})
+	if err != nil {
+		log.Printf("kurz meter %s: failed to read back after %s calibration: %v", rec.SerialNumber, rec.Kind, err)
+	}
+}
+
+// CalibrationCoefficients reads the meter's zero, span, and calibration
+// date. Terminal protocol only.
+func (ks *KurzSensor) CalibrationCoefficients(ctx context.Context) (Coefficients, error) {
+	var c Coefficients
+	err := ks.port.Submit(ctx, portworker.Operator, func() error {
+		if err := ks.terminal(); err != nil {
+			return err
+		}
+		var err error
+		c, err = ks.coefficients(ctx)
+		return err
+	})
+	if errors.Is(err, portworker.ErrStopped) {
+		return Coefficients{}, fmt.Errorf("kurz sensor is not open: %w", err)
+	} else if err != nil {
+		return Coefficients{}, err
+	}
+	return c, nil
+}
+
+func (ks *KurzSensor) coefficients(ctx context.Context) (Coefficients, error) {
+	params, err := ks.getParameters(ctx, []string{kurzParamCalZero, kurzParamCalSpan, kurzParamCalDate})
+	if err != nil {
+		return Coefficients{}, err
+	}
+	c := Coefficients{Date: params[kurzParamCalDate]}
+	if c.Zero, err = strconv.ParseFloat(params[kurzParamCalZero], 64); err != nil {
+		return Coefficients{}, fmt.Errorf("failed to parse %s %q", kurzParamCalZero, params[kurzParamCalZero])
+	}
+	if c.Span, err = strconv.ParseFloat(params[kurzParamCalSpan], 64); err != nil {
+		return Coefficients{}, fmt.Errorf("failed to parse %s %q", kurzParamCalSpan, params[kurzParamCalSpan])
+	}
+	return c, nil
+}
+
+// readFlowVelocity reads the flow in the meter's units and the velocity,
+// NaN when the meter does not report it.
+func (ks *KurzSensor) readFlowVelocity(ctx context.Context) (flow, velocity float64, err error) {
+	values, err := ks.readNative(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	flow, velocity = math.NaN(), math.NaN()
+	for _, m := range values {
+		switch m.Metric {
+		case metricFlow.Metric:
+			flow = m.Value
+		case metricVelocity.Metric:
+			velocity = m.Value
+		}
+	}
+	return flow, velocity, nil
+}
+
+// calCommand sends a calibration command once and returns the meter's
+// reply, failing if it was rejected. A reply that could not be read is
+// returned with the error, for the audit trail.
+func (ks *KurzSensor) calCommand(ctx context.Context, cmd string) (string, error) {
+	reply, err := ks.requestOnce(ctx, cmd+"\r", ackFrame)
+	if err != nil {
+		return reply, err
+	}
+	if strings.HasPrefix(reply, kurzRejectedReply) {
+		return reply, fmt.Errorf("meter rejected %s: %s", cmd, reply)
+	}
+	return reply, nil
+}
+
+func appendAudit(path string, rec CalibrationRecord) error {
+	if path == "" {
+		return nil
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to encode calibration record: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to write calibration audit log: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to write calibration audit log: %w", err)
+	}
+	_, err = f.Write(append(data, '\n'))
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write calibration audit log: %w", err)
+	}
+	return nil
+}
+
+// ReadAuditLog reads the records appended to path by calibrations, oldest
+// first.
+func ReadAuditLog(path string) ([]CalibrationRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read calibration audit log: %w", err)
+	}
+	defer f.Close()
+	var recs []CalibrationRecord
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1<<20)
+	for line := 1; sc.Scan(); line++ {
+		if len(strings.TrimSpace(sc.Text())) == 0 {
+			continue
+		}
+		var rec CalibrationRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("failed to parse calibration audit log %s line %d: %v", path, line, err)
+		}
+		recs = append(recs, rec)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read calibration audit log: %w", err)
+	}
+	return recs, nil
+}
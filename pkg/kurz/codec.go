@@ -0,0 +1,147 @@
+package kurz
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/demelere/sensor-control-modules/internal/sensorerr"
+)
+
+// The terminal protocol answers every command with one line. A meter with
+// echo on repeats the command first, and firmware with checksums on ends the
+// reply with '*' and two hex digits, the XOR of every byte before the '*',
+// as NMEA does. A reply that is missing, malformed, or fails its checksum is
+// usually line noise or a late answer to an earlier command, so the command
+// is sent again, up to readRetries times, before the error is returned.
+// Commands that change the meter are sent only once: the meter may have
+// acted on one whose reply was lost, and a calibration must not be applied
+// twice.
+
+var (
+	kurzDefaultReadRetries int
+	kurzAcceptedReply      string
+	kurzRegexChecksum      *regexp.Regexp
+)
+
+func init() {
+	kurzDefaultReadRetries = 2
+	kurzAcceptedReply = "OK"
+	kurzRegexChecksum = regexp.MustCompile(`^(.*)\*([0-9A-Fa-f]{2})$`)
+}
+
+// request sends command and returns the first reply line valid accepts,
+// trimmed and without its checksum. On failure it returns the last line the
+// meter sent, if any, with the error. It runs on the port worker.
+func (ks *KurzSensor) request(ctx context.Context, command string, valid func(string) error) (string, error) {
+	var reply string
+	var err error
+	for attempt := 0; attempt <= ks.readRetries; attempt++ {
+		if attempt > 0 {
+			log.Printf("kurz: %v; sending %q again", err, strings.TrimSpace(command))
+		}
+		if reply, err = ks.exchange(ctx, command, valid); err == nil {
+			return reply, nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return reply, err
+}
+
+// requestOnce is request for a command that changes the meter, which is
+// never sent again.
+func (ks *KurzSensor) requestOnce(ctx context.Context, command string, valid func(string) error) (string, error) {
+	return ks.exchange(ctx, command, valid)
+}
+
+func (ks *KurzSensor) exchange(ctx context.Context, command string, valid func(string) error) (string, error) {
+	if err := ks.writeCommand(command); err != nil {
+		return "", err
+	}
+	sent := strings.TrimSpace(command)
+	echoed := false
+	for {
+		line, err := ks.reader.ReadLine(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to read response to %s: %w", sent, err)
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !echoed && strings.EqualFold(line, sent) {
+			echoed = true
+			continue
+		}
+		reply, err := verifyChecksum(line)
+		if err != nil {
+			return line, err
+		}
+		if err := valid(reply); err != nil {
+			return reply, err
+		}
+		return reply, nil
+	}
+}
+
+// verifyChecksum checks and strips a reply's checksum; a reply without one
+// passes as it is.
+func verifyChecksum(line string) (string, error) {
+	m := kurzRegexChecksum.FindStringSubmatch(line)
+	if m == nil {
+		return line, nil
+	}
+	var sum byte
+	for i := 0; i < len(m[1]); i++ {
+		sum ^= m[1][i]
+	}
+	want, _ := strconv.ParseUint(m[2], 16, 8)
+	if sum != byte(want) {
+		return "", fmt.Errorf("%w: checksum %s does not match %02X in %q", sensorerr.ErrInvalidResponse, m[2], sum, line)
+	}
+	return strings.TrimSpace(m[1]), nil
+}
+
+// measurementFrame accepts an "x" line.
+func measurementFrame(line string) error {
+	_, err := parseMeasurements(line)
+	return err
+}
+
+// identityFrame accepts the reply to "?", which names the device or its
+// serial number.
+func identityFrame(line string) error {
+	if kurzRegexIdentity.MatchString(line) {
+		return nil
+	}
+	return fmt.Errorf("%w: %q is not an identity reply", sensorerr.ErrInvalidResponse, line)
+}
+
+// parameterFrame accepts the reply to a query for name: its value, or
+// "NAME = value" for name and not another parameter. A rejection is a valid
+// reply the caller handles.
+func parameterFrame(name string) func(string) error {
+	return func(line string) error {
+		if strings.HasPrefix(line, kurzRejectedReply) {
+			return nil
+		}
+		if n, _, ok := strings.Cut(line, "="); ok && !strings.EqualFold(strings.TrimSpace(n), name) {
+			return fmt.Errorf("%w: reply for %s to a query for %s", sensorerr.ErrInvalidResponse, strings.TrimSpace(n), name)
+		}
+		return nil
+	}
+}
+
+// ackFrame accepts the reply to a command that changes the meter: OK, or a
+// rejection the caller handles.
+func ackFrame(line string) error {
+	if strings.EqualFold(line, kurzAcceptedReply) || strings.HasPrefix(line, kurzRejectedReply) {
+		return nil
+	}
+	return fmt.Errorf("%w: %q is neither %s nor %s", sensorerr.ErrInvalidResponse, line, kurzAcceptedReply, kurzRejectedReply)
+}
@@ -0,0 +1,156 @@
+package kurz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/demelere/sensor-control-modules/internal/portworker"
+)
+
+var (
+	kurzParamFlowArea string
+	kurzParamGas      string
+	kurzParamCutoff   string
+	kurzParamFilter   string
+	kurzParamUnits    string
+)
+
+func init() {
+	kurzParamFlowArea = "FLOW_AREA"
+	kurzParamGas = "GAS"
+	kurzParamCutoff = "ZERO_CUTOFF"
+	kurzParamFilter = "FILTER"
+	kurzParamUnits = "UNITS"
+}
+
+// Config is the part of the meter's configuration commissioning sets up.
+// The gas is the one the probe was calibrated for at the factory and cannot
+// be changed in the field.
+type Config struct {
+	FlowArea      float64 `json:"flow_area"`       // ft², the duct cross-section flow is computed over
+	Gas           string  `json:"gas"`             // e.g. "AIR"
+	LowFlowCutoff float64 `json:"low_flow_cutoff"` // SFPM, below which the meter reports no flow
+	Filter        float64 `json:"filter"`          // s, the output filter time constant
+	FlowUnits     string  `json:"flow_units"`      // as the meter prints it, e.g. "SCFM"
+}
+
+// Config reads the meter's configuration in one operator-priority
+// operation. Terminal protocol only.
+func (ks *KurzSensor) Config(ctx context.Context) (Config, error) {
+	var params map[string]string
+	err := ks.port.Submit(ctx, portworker.Operator, func() error {
+		if err := ks.terminal(); err != nil {
+			return err
+		}
+		var err error
+		params, err = ks.getParameters(ctx, []string{kurzParamFlowArea, kurzParamGas, kurzParamCutoff, kurzParamFilter, kurzParamUnits})
+		return err
+	})
+	if errors.Is(err, portworker.ErrStopped) {
+		return Config{}, fmt.Errorf("kurz sensor is not open: %w", err)
+	} else if err != nil {
+		return Config{}, err
+	}
+	c := Config{Gas: params[kurzParamGas], FlowUnits: params[kurzParamUnits]}
+	for _, f := range []struct {
+		name  string
+		field *float64
+	}{
+		{kurzParamFlowArea, &c.FlowArea},
+		{kurzParamCutoff, &c.LowFlowCutoff},
+		{kurzParamFilter, &c.Filter},
+	} {
+		v, err := strconv.ParseFloat(params[f.name], 64)
+		if err != nil {
+			return Config{}, fmt.Errorf("failed to parse %s %q", f.name, params[f.name])
+		}
+		*f.field = v
+	}
+	return c, nil
+}
+
+// FlowArea reads the duct cross-section in ft².
+func (ks *KurzSensor) FlowArea(ctx context.Context) (float64, error) {
+	var area float64
+	err := ks.port.Submit(ctx, portworker.Operator, func() error {
+		if err := ks.terminal(); err != nil {
+			return err
+		}
+		var err error
+		area, err = ks.readFlowArea(ctx)
+		return err
+	})
+	if errors.Is(err, portworker.ErrStopped) {
+		return 0, fmt.Errorf("kurz sensor is not open: %w", err)
+	}
+	return area, err
+}
+
+func (ks *KurzSensor) readFlowArea(ctx context.Context) (float64, error) {
+	reply, err := ks.getParameter(ctx, kurzParamFlowArea)
+	if err != nil {
+		return 0, err
+	}
+	area, err := strconv.ParseFloat(reply, 64)
+	if err != nil || area <= 0 {
+		return 0, fmt.Errorf("meter has no usable %s: %q", kurzParamFlowArea, reply)
+	}
+	return area, nil
+}
+
+// SetFlowArea sets the duct cross-section in ft², which scales every flow
+// the meter reports.
+func (ks *KurzSensor) SetFlowArea(ctx context.Context, squareFeet float64) error {
+	if squareFeet <= 0 || math.IsInf(squareFeet, 0) {
+		return fmt.Errorf("flow area %g ft² must be positive", squareFeet)
+	}
+	return ks.setNumber(ctx, kurzParamFlowArea, squareFeet)
+}
+
+// SetLowFlowCutoff sets the velocity in SFPM below which the meter reports
+// no flow; 0 turns the cutoff off.
+func (ks *KurzSensor) SetLowFlowCutoff(ctx context.Context, sfpm float64) error {
+	if sfpm < 0 || math.IsInf(sfpm, 0) {
+		return fmt.Errorf("low flow cutoff %g SFPM must not be negative", sfpm)
+	}
+	return ks.setNumber(ctx, kurzParamCutoff, sfpm)
+}
+
+// SetFilter sets the output filter time constant in seconds; 0 turns the
+// filter off.
+func (ks *KurzSensor) SetFilter(ctx context.Context, seconds float64) error {
+	if seconds < 0 || seconds > 600 {
+		return fmt.Errorf("filter time constant %g s out of range 0-600", seconds)
+	}
+	return ks.setNumber(ctx, kurzParamFilter, seconds)
+}
+
+// setNumber writes a numeric parameter and reads it back, failing if the
+// meter kept another value. Values are compared as numbers, since the meter
+// prints them to its own precision.
+func (ks *KurzSensor) setNumber(ctx context.Context, name string, v float64) error {
+	err := ks.port.Submit(ctx, portworker.Operator, func() error {
+		if err := ks.terminal(); err != nil {
+			return err
+		}
+		if err := ks.setParameter(ctx, name, strconv.FormatFloat(v, 'g', -1, 64)); err != nil {
+			return err
+		}
+		reply, err := ks.getParameter(ctx, name)
+		if err != nil {
+			return fmt.Errorf("set %s, but failed to read it back: %w", name, err)
+		}
+		got, err := strconv.ParseFloat(reply, 64)
+		if err != nil || math.Abs(got-v) > 1e-4*(1+math.Abs(v)) {
+			return fmt.Errorf("meter did not take %s = %g, it has %q", name, v, reply)
+		}
+		return nil
+	})
+	if errors.Is(err, portworker.ErrStopped) {
+		return fmt.Errorf("kurz sensor is not open: %w", err)
+	}
+	return err
+}
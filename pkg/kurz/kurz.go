@@ -0,0 +1,415 @@
+package kurz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sync/atomic"
+	"time"
+
+	"go.bug.st/serial"
+
+	"github.com/demelere/sensor-control-modules/internal/discovery"
+	"github.com/demelere/sensor-control-modules/internal/modbus"
+	"github.com/demelere/sensor-control-modules/internal/portworker"
+	"github.com/demelere/sensor-control-modules/internal/reconnect"
+	"github.com/demelere/sensor-control-modules/internal/sensorerr"
+	"github.com/demelere/sensor-control-modules/internal/serialio"
+	"github.com/demelere/sensor-control-modules/internal/units"
+	"github.com/demelere/sensor-control-modules/pkg/sensor"
+)
+
+var (
+	kurzBaudRate                   int
+	kurzDataBits                   int
+	kurzCable                      discovery.Spec
+	kurzRegexSensorModel           string
+	kurzRegexSensorSerialNumber    string
+	kurzRegexSensorSoftwareVersion string
+	kurzRegexIdentity              *regexp.Regexp
+)
+
+func init() {
+	kurzBaudRate = 9600
+	kurzDataBits = 8
+	kurzCable = discovery.Spec{
+		Driver: "kurz",
+		ByID:   regexp.MustCompile("^usb-FTDI_.*_USB"),
+		USB:    []discovery.USBID{{VID: "0403", PID: "6001"}, {VID: "0403", PID: "6015"}}, // FT232R, FT-X
+	}
+	kurzRegexSensorModel = "Device\\s*:\\s*\\w*"
+	kurzRegexSensorSerialNumber = "SNUM\\s*:\\s*\\w*"
+	kurzRegexSensorSoftwareVersion = "SW version\\s*:\\s*\\d.\\d.\\d"
+	kurzRegexIdentity = regexp.MustCompile(kurzRegexSensorModel + "|" + kurzRegexSensorSerialNumber)
+}
+
+// Info is the port and identity found when the meter was opened.
+type Info struct {
+	Port            string `json:"port"`
+	Model           string `json:"model,omitempty"`
+	SerialNumber    string `json:"serial_number,omitempty"`
+	SoftwareVersion string `json:"software_version,omitempty"`
+}
+
+type KurzSensor struct {
+	baudRate              int
+	dataBits              int
+	portPath              string
+	portHint              string         // configured device, skips discovery
+	portMatch             *regexp.Regexp // narrows discovery
+	serialConn            serial.Port
+	port                  portworker.Worker // serialises all access to serialConn and reader
+	reader                *serialio.LineReader
+	slaveID               int            // Modbus address, 0 for the terminal protocol
+	bus                   *modbus.Client // set while open over Modbus
+	readTimeout           time.Duration
+	readRetries           int // extra attempts at a command whose reply is missing or malformed
+	sensorModel           string
+	sensorSerialNumber    string
+	sensorSoftwareVersion string
+	constantFlowRateSCFM  float64
+	flowNative            units.Unit // what the meter is set to report flow in
+	flowUnit              units.Unit // what flow is converted to
+	gas                   units.Gas
+	array                 Array   // sensor points of a multipoint installation
+	flowArea              float64 // ft², the array's, once known; port worker only
+	pollInterval          time.Duration
+	readings              <-chan sensor.Reading   // from Start
+	onState               func(sensor.StateEvent) // reconnection progress in startKurzSensor
+	calibrating           atomic.Bool             // in calibration mode, see EnterCalibration
+}
+
+// NewKurzSensor returns a closed meter on the default 9600 baud, found by
+// discovery, as opts adjust it.
+func NewKurzSensor(opts ...Option) (*KurzSensor, error) {
+	ks := &KurzSensor{baudRate: kurzBaudRate, dataBits: kurzDataBits, readRetries: kurzDefaultReadRetries, pollInterval: time.Second, flowNative: units.SCFM, flowUnit: units.SCFM}
+	for _, opt := range opts {
+		opt(ks)
+	}
+	switch {
+	case ks.baudRate < 0:
+		return nil, fmt.Errorf("kurz: baud rate %d must be positive", ks.baudRate)
+	case ks.pollInterval < 0:
+		return nil, fmt.Errorf("kurz: polling interval %v must be positive", ks.pollInterval)
+	case ks.slaveID < 0 || ks.slaveID > 247:
+		return nil, fmt.Errorf("kurz: modbus slave ID %d out of range 1-247", ks.slaveID)
+	case ks.constantFlowRateSCFM < 0:
+		return nil, fmt.Errorf("kurz: constant flow %g SCFM must be positive, the meter reads one way only", ks.constantFlowRateSCFM)
+	case ks.array.Points > 0 && ks.slaveID != 0:
+		return nil, fmt.Errorf("kurz: sensor points need the terminal protocol")
+	case !units.IsFlow(ks.flowNative):
+		return nil, fmt.Errorf("kurz: %q is not a flow unit the meter reports", ks.flowNative)
+	}
+	from := ks.flowNative
+	if ks.constantFlowRateSCFM != 0.0 {
+		from = units.SCFM
+	}
+	if _, err := units.FlowFactor(from, ks.flowUnit, ks.gas); err != nil {
+		return nil, fmt.Errorf("kurz: cannot report flow in %s: %v", ks.flowUnit, err)
+	}
+	if err := ks.array.validate(); err != nil {
+		return nil, fmt.Errorf("kurz: %v", err)
+	}
+	return ks, nil
+}
+
+// SetReadTimeout bounds the wait for each reply from the meter; see
+// serialio.DefaultTimeout. It applies from the next Open.
+func (ks *KurzSensor) SetReadTimeout(d time.Duration) {
+	ks.readTimeout = d
+}
+
+// SetPort skips discovery and opens path (e.g. /dev/ttyUSB1 or COM3) from
+// the next Open.
+func (ks *KurzSensor) SetPort(path string) {
+	ks.portHint = path
+}
+
+// SetPortMatch narrows discovery to the cables whose /dev/serial/by-id link
+// name (or "VID:PID serial" where there is none) matches pattern, for rigs
+// with more than one.
+func (ks *KurzSensor) SetPortMatch(pattern string) error {
+	if pattern == "" {
+		ks.portMatch = nil
+		return nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid port pattern: %v", err)
+	}
+	ks.portMatch = re
+	return nil
+}
+
+func (ks *KurzSensor) searchPorts() (string, error) {
+	if ks.portHint != "" {
+		log.Printf("using configured kurz port %s", ks.portHint)
+		return ks.portHint, nil
+	}
+	log.Printf("searching for Kurz sensor")
+	spec := kurzCable
+	spec.Match = ks.portMatch
+	port, err := discovery.Find(spec)
+	if err != nil {
+		return "", err
+	}
+	log.Printf("kurz sensor found on port: %s", port)
+	return port, nil
+}
+
+// Open discovers the meter, opens its port, and queries its identity, all on
+// the sensor's port worker like every other command.
+func (ks *KurzSensor) Open() error {
+	ks.port.Start()
+	return ks.port.Do(ks.open)
+}
+
+func (ks *KurzSensor) open() error {
+	if ks.constantFlowRateSCFM != 0.0 { // nothing to open when the flow rate is simulated
+		log.Printf("using constant flow rate of %.2f SCFM, skipping Kurz sensor discovery", ks.constantFlowRateSCFM)
+		return nil
+	}
+
+	if ks.serialConn != nil {
+		err := ks.serialConn.Close()
+		if err != nil {
+			log.Printf("Error closing existing serial connection: %v", err)
+		}
+	}
+
+	port, err := ks.searchPorts()
+	if err != nil {
+		return fmt.Errorf("failed to find Kurz sensor: %w", err)
+	}
+	log.Printf("found Kurz sensor at port: %s", port)
+	ks.portPath = port
+	ks.flowArea = 0
+
+	mode := &serial.Mode{
+		BaudRate: ks.baudRate,
+		DataBits: ks.dataBits,
+		Parity:   serial.NoParity,
+		StopBits: serial.OneStopBit,
+	}
+
+	ks.serialConn, err = serial.Open(port, mode)
+	if err != nil {
+		return fmt.Errorf("failed to open serial connection: %w", err)
+	}
+	ks.serialConn = serialio.Traced(ks.serialConn, port)
+
+	ks.reader = serialio.NewLineReader(ks.serialConn, ks.readTimeout)
+	log.Printf("opened serial connection")
+
+	if ks.slaveID != 0 {
+		if ks.bus, err = modbus.NewClient(ks.serialConn, ks.reader, ks.slaveID); err != nil {
+			return err
+		}
+		if err := ks.collectModbusInfo(); err != nil {
+			return fmt.Errorf("failed to collect sensor information: %w", err)
+		}
+		return nil
+	}
+	ks.bus = nil
+	err = ks.collectSensorInfo()
+	if err != nil {
+		return fmt.Errorf("failed to collect sensor information: %v", err)
+	}
+
+	return nil
+}
+
+func (ks *KurzSensor) collectSensorInfo() error { // send specific commands to Kurz to retrieve sensor info, parsed w/regex and values stored
+	response, err := ks.request(context.Background(), "?", identityFrame)
+	if err != nil {
+		return fmt.Errorf("failed to read sensor info response: %w", err)
+	}
+
+	sensorModel := regexp.MustCompile(kurzRegexSensorModel).FindStringSubmatch(response)
+	if len(sensorModel) > 1 {
+		ks.sensorModel = sensorModel[1]
+	}
+
+	sensorSerialNumber := regexp.MustCompile(kurzRegexSensorSerialNumber).FindStringSubmatch(response)
+	if len(sensorSerialNumber) > 1 {
+		ks.sensorSerialNumber = sensorSerialNumber[1]
+	}
+
+	sensorSoftwareVersion := regexp.MustCompile(kurzRegexSensorSoftwareVersion).FindStringSubmatch(response)
+	if len(sensorSoftwareVersion) > 1 {
+		ks.sensorSoftwareVersion = sensorSoftwareVersion[1]
+	}
+
+	return nil
+}
+
+func (ks *KurzSensor) writeCommand(command string) error {
+	ks.reader.Discard()
+	_, err := ks.serialConn.Write([]byte(command))
+	if err != nil {
+		return fmt.Errorf("failed to write command: %v", err)
+	}
+	return nil
+}
+
+func (ks *KurzSensor) ReadFlowRate() (float64, error) {
+	return ks.ReadFlowRateContext(context.Background())
+}
+
+// ReadFlowRateContext gives up with ctx.Err() once ctx is done, whether the
+// request is still queued or already waiting on the meter.
+func (ks *KurzSensor) ReadFlowRateContext(ctx context.Context) (float64, error) {
+	if ks.constantFlowRateSCFM != 0.0 { // if the constantFlowRateSCFM field is not 0, it means the env var is set and parsed and we can directly return it
+		return ks.constantFlowRateSCFM, nil // instead of interacting with the physical flow meter
+	}
+
+	var flowRate float64
+	err := ks.port.Submit(ctx, portworker.Routine, func() error {
+		var err error
+		flowRate, err = ks.readFlowRate(ctx)
+		return err
+	})
+	if errors.Is(err, portworker.ErrStopped) {
+		return 0, fmt.Errorf("kurz sensor is not open: %w", err)
+	} else if err != nil {
+		return 0, err
+	}
+	return flowRate, nil
+}
+
+func (ks *KurzSensor) readFlowRate(ctx context.Context) (float64, error) {
+	values, err := ks.readMeasurements(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for _, m := range values {
+		if m.Metric == metricFlow.Metric {
+			return m.Value, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: no flow rate", sensorerr.ErrInvalidResponse)
+}
+
+// startKurzSensor polls every interval until ctx is done or the sensor is
+// closed, delivering every metric of each read, then closes the returned
+// channel. A meter that stops answering is
+// rediscovered and reopened with backoff, reporting each step to onState.
+// Readings from a constant flow rate are marked sensor.Simulated, and those
+// taken in calibration mode sensor.Uncertain.
+func (ks *KurzSensor) startKurzSensor(ctx context.Context, interval time.Duration) <-chan sensor.Reading {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	quality := sensor.Good
+	if ks.constantFlowRateSCFM != 0.0 {
+		quality = sensor.Simulated
+	}
+	flowCh := make(chan sensor.Reading)
+	go func() {
+		defer close(flowCh)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		link := reconnect.NewTracker(reconnect.DefaultPolicy)
+		for {
+			values, err := ks.ReadMeasurements(ctx)
+			if ctx.Err() != nil || errors.Is(err, portworker.ErrStopped) {
+				return
+			} else if err != nil {
+				log.Printf("failed to read flow rate: %v", err)
+				if link.Observe(err) && ks.reconnect(ctx, err) != nil {
+					return
+				}
+			} else {
+				link.Observe(nil)
+				now := time.Now().UTC()
+				for _, m := range values {
+					rd := sensor.Reading{Sensor: "kurz", Metric: m.Metric, Value: m.Value, Unit: m.Unit, Time: now, Quality: quality}
+					if ks.calibrating.Load() {
+						rd.Quality = sensor.Uncertain
+					}
+					select {
+					case flowCh <- rd:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return flowCh
+}
+
+// Start polls the open meter every polling interval (see
+// WithPollingInterval) until ctx is done or the meter is closed, delivering
+// each reading on Readings. A meter that stops answering is rediscovered and
+// reopened with backoff.
+func (ks *KurzSensor) Start(ctx context.Context) error {
+	if errors.Is(ks.port.Do(func() error { return nil }), portworker.ErrStopped) {
+		return fmt.Errorf("kurz sensor is not open")
+	}
+	ks.readings = ks.startKurzSensor(ctx, ks.pollInterval)
+	return nil
+}
+
+// Readings carries the flow rate in SCFM, with the meter's velocity,
+// temperature, and total (see ReadMeasurements), from Start; it is closed when
+// polling stops, and nil before Start.
+func (ks *KurzSensor) Readings() <-chan sensor.Reading {
+	return ks.readings
+}
+
+// Info returns the meter's port and identity; the zero Info while closed.
+func (ks *KurzSensor) Info() Info {
+	var info Info
+	ks.port.Do(func() error {
+		info = Info{Port: ks.portPath, Model: ks.sensorModel, SerialNumber: ks.sensorSerialNumber, SoftwareVersion: ks.sensorSoftwareVersion}
+		return nil
+	})
+	return info
+}
+
+func (ks *KurzSensor) reconnect(ctx context.Context, cause error) error {
+	notify := func(e sensor.StateEvent) {
+		log.Printf("kurz sensor %s (attempt %d): %v", e.State, e.Attempt, e.Err)
+		if ks.onState != nil {
+			ks.onState(e)
+		}
+	}
+	disconnect := func() error {
+		return ks.port.Do(func() error {
+			if ks.serialConn == nil {
+				return nil
+			}
+			err := ks.serialConn.Close()
+			ks.serialConn, ks.reader, ks.bus = nil, nil, nil
+			return err
+		})
+	}
+	return reconnect.Reconnect(ctx, reconnect.DefaultPolicy, cause, disconnect, func() error { return ks.port.Do(ks.open) }, notify)
+}
+
+// Close lets the in-flight command finish before closing the port and
+// stopping the worker; Open may be called again later.
+func (ks *KurzSensor) Close() error {
+	err := ks.port.Do(func() error {
+		if ks.serialConn == nil {
+			return nil
+		}
+		err := ks.serialConn.Close()
+		ks.serialConn, ks.reader, ks.bus = nil, nil, nil
+		ks.calibrating.Store(false)
+		return err
+	})
+	ks.port.Stop()
+	if errors.Is(err, portworker.ErrStopped) { // never opened, or already closed
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,224 @@
+package kurz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/demelere/sensor-control-modules/internal/modbus"
+	"github.com/demelere/sensor-control-modules/internal/numparse"
+	"github.com/demelere/sensor-control-modules/internal/portworker"
+	"github.com/demelere/sensor-control-modules/internal/sensorerr"
+	"github.com/demelere/sensor-control-modules/internal/units"
+)
+
+// Measurement is one value from ReadMeasurements.
+type Measurement struct {
+	Metric string  `json:"metric"`
+	Value  float64 `json:"value"`
+	Unit   string  `json:"unit"`
+}
+
+// The metrics a meter reports, in the order of its "x" line after the point
+// number: velocity, process temperature, flow rate, and on firmware with a
+// totalizer the totalized flow. Flow and total are in SCFM and SCF unless
+// WithFlowUnits says the meter is set to other units.
+var (
+	metricVelocity    = Measurement{Metric: "velocity", Unit: string(units.FeetPerMinute)}
+	metricTemperature = Measurement{Metric: "temperature", Unit: string(units.Fahrenheit)}
+	metricFlow        = Measurement{Metric: "flow", Unit: string(units.SCFM)}
+	metricTotal       = Measurement{Metric: "total", Unit: string(units.CubicFoot)}
+)
+
+// totalUnits is what the totalizer counts in for each flow unit.
+var totalUnits = map[units.Unit]units.Unit{
+	units.SCFM:                     units.CubicFoot,
+	units.SLPM:                     units.Liter,
+	units.ACFM:                     units.CubicFoot,
+	units.NormalCubicMetersPerHour: units.NormalCubicMeter,
+	units.KilogramsPerHour:         units.Kilogram,
+}
+
+// Metrics lists what ReadMeasurements reports besides the flow rate, so
+// consumers can prepare for them before the first read. A constant flow rate
+// reports the flow alone.
+func (ks *KurzSensor) Metrics() []Measurement {
+	if ks.constantFlowRateSCFM != 0.0 {
+		return nil
+	}
+	total := metricTotal
+	total.Unit = string(totalUnits[ks.flowNative])
+	return append([]Measurement{metricVelocity, metricTemperature, total}, ks.arrayMetrics()...)
+}
+
+// FlowUnit is the unit flow rates are reported in: the one WithFlowUnits
+// converts to, SCFM by default.
+func (ks *KurzSensor) FlowUnit() units.Unit {
+	return ks.flowUnit
+}
+
+// ReadMeasurements reads the flow rate (in FlowUnit), velocity (SFPM),
+// process temperature (°F), and totalized flow (in the meter's own units) in
+// one exchange. A meter whose firmware has no totalizer reports no total over
+// the terminal protocol. With WithArray, each sensor point follows in an
+// exchange of its own.
+func (ks *KurzSensor) ReadMeasurements(ctx context.Context) ([]Measurement, error) {
+	if ks.constantFlowRateSCFM != 0.0 {
+		flow, err := units.ConvertFlow(ks.constantFlowRateSCFM, units.SCFM, ks.flowUnit, ks.gas)
+		if err != nil {
+			return nil, err
+		}
+		return []Measurement{{Metric: metricFlow.Metric, Value: flow, Unit: string(ks.flowUnit)}}, nil
+	}
+	var values []Measurement
+	err := ks.port.Submit(ctx, portworker.Routine, func() error {
+		var err error
+		if values, err = ks.readMeasurements(ctx); err != nil {
+			return err
+		}
+		temperature := math.NaN()
+		for _, m := range values {
+			if m.Metric == metricTemperature.Metric {
+				temperature = m.Value
+			}
+		}
+		points, err := ks.readArray(ctx, temperature)
+		values = append(values, points...)
+		return err
+	})
+	if errors.Is(err, portworker.ErrStopped) {
+		return nil, fmt.Errorf("kurz sensor is not open: %w", err)
+	}
+	return values, err
+}
+
+func (ks *KurzSensor) readMeasurements(ctx context.Context) ([]Measurement, error) {
+	values, err := ks.readNative(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ks.convertFlow(values)
+}
+
+// readNative reads the meter's values as it reports them, the flow in its
+// own units.
+func (ks *KurzSensor) readNative(ctx context.Context) ([]Measurement, error) {
+	if ks.serialConn == nil {
+		return nil, fmt.Errorf("kurz sensor is not open")
+	}
+	var values []Measurement
+	if ks.bus != nil {
+		regs, err := ks.bus.ReadInputRegisters(ctx, regFlowRate, 8)
+		if err != nil {
+			return nil, err
+		}
+		flow := modbus.Float32(regs[regFlowRate:])
+		if math.IsNaN(flow) || math.IsInf(flow, 0) {
+			return nil, fmt.Errorf("%w: meter reports no flow rate", sensorerr.ErrInvalidResponse)
+		}
+		values = []Measurement{
+			with(metricFlow, flow),
+			with(metricVelocity, modbus.Float32(regs[regVelocity:])),
+			with(metricTemperature, modbus.Float32(regs[regTemperature:])),
+			with(metricTotal, modbus.Float32(regs[regTotalizer:])),
+		}
+	} else {
+		response, err := ks.request(ctx, "x", measurementFrame)
+		if err != nil {
+			return nil, err
+		}
+		if values, err = parseMeasurements(response); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// convertFlow tags the flow and total with the meter's units and converts
+// the flow to FlowUnit. Actual volumes are taken at the process temperature
+// the meter reported with them, when it did.
+func (ks *KurzSensor) convertFlow(values []Measurement) ([]Measurement, error) {
+	gas := ks.gas
+	for _, m := range values {
+		if m.Metric == metricTemperature.Metric && !math.IsNaN(m.Value) {
+			gas.Line.Temperature, _ = units.Convert(m.Value, units.Fahrenheit, units.Celsius)
+		}
+	}
+	for i, m := range values {
+		switch m.Metric {
+		case metricFlow.Metric:
+			v, err := units.ConvertFlow(m.Value, ks.flowNative, ks.flowUnit, gas)
+			if err != nil {
+				return nil, err
+			}
+			values[i].Value, values[i].Unit = v, string(ks.flowUnit)
+		case metricTotal.Metric:
+			values[i].Unit = string(totalUnits[ks.flowNative])
+		}
+	}
+	return values, nil
+}
+
+// parseMeasurements reads an "x" line: point, velocity, temperature, flow,
+// and the total where the firmware has one. Only the point number and the
+// flow are required; the other fields are reported when they are numbers, so
+// a meter that prints labels there still reads. Fields are split on
+// whitespace, so a firmware grouping thousands with spaces is not supported:
+// "1 234,5" reads as two fields.
+func parseMeasurements(line string) ([]Measurement, error) {
+	parts := strings.Fields(line)
+	if len(parts) < 4 || len(parts) > 5 {
+		return nil, fmt.Errorf("%w: %q is not a measurement line", sensorerr.ErrInvalidResponse, line)
+	}
+	if _, err := strconv.Atoi(parts[0]); err != nil {
+		return nil, fmt.Errorf("%w: %q does not start with a point number", sensorerr.ErrInvalidResponse, line)
+	}
+	flow, err := numparse.ParseFloat(parts[3])
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to parse flow rate: %v", sensorerr.ErrInvalidResponse, err)
+	}
+	values := []Measurement{with(metricFlow, flow)}
+	for _, f := range []struct {
+		field int
+		m     Measurement
+	}{{1, metricVelocity}, {2, metricTemperature}, {4, metricTotal}} {
+		if f.field >= len(parts) {
+			continue
+		}
+		if v, err := numparse.ParseFloat(parts[f.field]); err == nil {
+			values = append(values, with(f.m, v))
+		}
+	}
+	return values, nil
+}
+
+func with(m Measurement, v float64) Measurement {
+	m.Value = v
+	return m
+}
+
+// ResetTotalizer zeroes the meter's totalized flow, e.g. at the start of a
+// test run.
+func (ks *KurzSensor) ResetTotalizer(ctx context.Context) error {
+	if ks.constantFlowRateSCFM != 0.0 {
+		return fmt.Errorf("kurz sensor has a constant flow rate and no totalizer")
+	}
+	err := ks.port.Submit(ctx, portworker.Operator, func() error {
+		if ks.serialConn == nil {
+			return fmt.Errorf("kurz sensor is not open")
+		}
+		if ks.bus != nil {
+			return ks.bus.WriteRegisters(ctx, regTotalizerReset, []uint16{1})
+		}
+		return ks.setParameter(ctx, kurzParamTotal, "0")
+	})
+	if errors.Is(err, portworker.ErrStopped) {
+		return fmt.Errorf("kurz sensor is not open: %w", err)
+	} else if err != nil {
+		return fmt.Errorf("failed to reset totalizer: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package kurz
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/demelere/sensor-control-modules/internal/sensorerr"
+)
+
+func TestParseMeasurements(t *testing.T) {
+	for _, tc := range []struct {
+		line string
+		want map[string]float64
+	}{
+		{"1 1234.5 72.3 45.6", map[string]float64{"flow": 45.6, "velocity": 1234.5, "temperature": 72.3}},
+		{"1 1234.5 72.3 45.6 98765", map[string]float64{"flow": 45.6, "velocity": 1234.5, "temperature": 72.3, "total": 98765}},
+		// Decimal commas, and thousands grouped with the other separator.
+		{"1 1234,5 72,3 45,6 98.765,4", map[string]float64{"flow": 45.6, "velocity": 1234.5, "temperature": 72.3, "total": 98765.4}},
+		{"1 1,234.5 72.3 45.6", map[string]float64{"flow": 45.6, "velocity": 1234.5, "temperature": 72.3}},
+		// Padding, tabs, line endings, exponents, and negative values.
+		{"  2\t1.2345E+03   -4,5  4.56e1 \r\n", map[string]float64{"flow": 45.6, "velocity": 1234.5, "temperature": -4.5}},
+		// Labels or units where a number is optional are skipped.
+		{"1 ---- ---- 45.6", map[string]float64{"flow": 45.6}},
+		{"1 1234.5SFPM 72.3F 45.6 TOTAL", map[string]float64{"flow": 45.6}},
+		{"1 1234.5 NaN 45.6", map[string]float64{"flow": 45.6, "velocity": 1234.5}},
+	} {
+		got, err := parseMeasurements(tc.line)
+		if err != nil {
+			t.Errorf("parseMeasurements(%q): %v", tc.line, err)
+			continue
+		}
+		if len(got) != len(tc.want) {
+			t.Errorf("parseMeasurements(%q) = %v, want %v", tc.line, got, tc.want)
+			continue
+		}
+		for _, m := range got {
+			if want, ok := tc.want[m.Metric]; !ok || m.Value != want {
+				t.Errorf("parseMeasurements(%q): %s = %v, want %v", tc.line, m.Metric, m.Value, tc.want[m.Metric])
+			}
+		}
+	}
+}
+
+func TestParseMeasurementsInvalid(t *testing.T) {
+	for _, line := range []string{
+		"",
+		"1 1234.5 72.3",
+		"1 1234.5 72.3 45.6 98765 12",
+		"A 1234.5 72.3 45.6",
+		"1.5 1234.5 72.3 45.6",
+		"1 1234.5 72.3 ----",
+		"1 1234.5 72.3 45.6SCFM", // the flow unit is configured, not read
+		"1 1234.5 72.3 NaN",
+		"1 1234.5 72.3 -Inf",
+		// Thousands grouped with spaces split into extra fields.
+		"1 1 234,5 72,3 45,6 98 765",
+	} {
+		if got, err := parseMeasurements(line); !errors.Is(err, sensorerr.ErrInvalidResponse) {
+			t.Errorf("parseMeasurements(%q) = %v, %v, want an invalid response", line, got, err)
+		}
+	}
+}
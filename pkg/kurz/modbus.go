@@ -0,0 +1,60 @@
+package kurz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/demelere/sensor-control-modules/internal/modbus"
+)
+
+// kurzDefaultSlaveID is the Modbus address MFT-B transmitters ship with.
+const kurzDefaultSlaveID = 1
+
+// MFT-B input registers, 0-based. Every value is a 32-bit float, low word
+// first, in the units the meter is configured for (SCFM, SFPM, °F, and SCF
+// out of the box).
+const (
+	regFlowRate    = 0x0000
+	regVelocity    = 0x0002
+	regTemperature = 0x0004
+	regTotalizer   = 0x0006
+
+	regTotalizerReset = 0x0010 // holding register; writing 1 zeroes the total
+)
+
+// collectModbusInfo fills in the meter's identity from its device
+// identification objects. Objects the meter does not implement stay empty;
+// no answer at all fails the open.
+func (ks *KurzSensor) collectModbusInfo() error {
+	for _, f := range []struct {
+		object byte
+		field  *string
+	}{
+		{1, &ks.sensorModel},
+		{2, &ks.sensorSoftwareVersion},
+		{0x80, &ks.sensorSerialNumber},
+	} {
+		v, err := ks.bus.DeviceID(context.Background(), f.object)
+		var exc *modbus.Exception
+		if errors.As(err, &exc) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		*f.field = v
+	}
+	return nil
+}
+
+// terminal fails unless the meter is open over the terminal protocol, which
+// parameter reads and writes need.
+func (ks *KurzSensor) terminal() error {
+	if ks.serialConn == nil {
+		return fmt.Errorf("kurz sensor is not open")
+	}
+	if ks.bus != nil {
+		return fmt.Errorf("meter parameters need the ascii protocol, the meter is on modbus")
+	}
+	return nil
+}
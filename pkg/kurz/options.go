@@ -0,0 +1,85 @@
+package kurz
+
+import (
+	"time"
+
+	"github.com/demelere/sensor-control-modules/internal/units"
+)
+
+// Option adjusts a KurzSensor in NewKurzSensor.
+type Option func(*KurzSensor)
+
+// WithPort skips discovery and opens path, e.g. /dev/ttyUSB1 or COM3.
+func WithPort(path string) Option {
+	return func(ks *KurzSensor) { ks.portHint = path }
+}
+
+// WithBaudRate sets the line speed the meter is configured for; 0 keeps the
+// default 9600.
+func WithBaudRate(baudRate int) Option {
+	return func(ks *KurzSensor) {
+		if baudRate != 0 {
+			ks.baudRate = baudRate
+		}
+	}
+}
+
+// WithPollingInterval sets how often Start reads the meter; 0 keeps the
+// default of once a second.
+func WithPollingInterval(d time.Duration) Option {
+	return func(ks *KurzSensor) {
+		if d != 0 {
+			ks.pollInterval = d
+		}
+	}
+}
+
+// WithReadRetries sets how many times a command is sent again when its reply
+// is missing, malformed, or fails its checksum; 0 keeps the default of 2, and
+// a negative n sends each command once. Commands that change the meter are
+// always sent once.
+func WithReadRetries(n int) Option {
+	return func(ks *KurzSensor) {
+		switch {
+		case n < 0:
+			ks.readRetries = 0
+		case n > 0:
+			ks.readRetries = n
+		}
+	}
+}
+
+// WithConstantFlow makes the sensor report scfm on every read without
+// opening a meter, for rigs without one and for testing. Its readings are
+// marked sensor.Simulated.
+func WithConstantFlow(scfm float64) Option {
+	return func(ks *KurzSensor) { ks.constantFlowRateSCFM = scfm }
+}
+
+// WithModbus talks Modbus RTU to the meter at slaveID (1-247) instead of the
+// terminal protocol; 0 keeps the factory address 1. Meter parameters (Backup,
+// Restore, Apply) still need the terminal protocol.
+func WithModbus(slaveID int) Option {
+	return func(ks *KurzSensor) {
+		if slaveID == 0 {
+			slaveID = kurzDefaultSlaveID
+		}
+		ks.slaveID = slaveID
+	}
+}
+
+// WithFlowUnits says the meter is set to report flow in native (SCFM when
+// empty) and converts it to unit (native when empty) with gas. The meter's
+// process temperature stands in for gas.Line.Temperature in actual volumes.
+func WithFlowUnits(native, unit units.Unit, gas units.Gas) Option {
+	return func(ks *KurzSensor) {
+		if native != "" {
+			ks.flowNative = native
+		}
+		ks.flowUnit = ks.flowNative
+		if unit != "" {
+			ks.flowUnit = unit
+		}
+		ks.gas = gas
+	}
+}
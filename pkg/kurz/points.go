@@ -0,0 +1,250 @@
+package kurz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/demelere/sensor-control-modules/internal/portworker"
+	"github.com/demelere/sensor-control-modules/internal/sensorerr"
+	"github.com/demelere/sensor-control-modules/internal/units"
+)
+
+// A multipoint installation has several sensor points across the duct, on
+// one transmitter. "x" reports the transmitter's average; "x N" reports
+// point N alone, in the same form with N as the point number.
+
+var (
+	kurzCommandPoint string
+	kurzMaxPoints    int
+)
+
+func init() {
+	kurzCommandPoint = "x %d\r"
+	kurzMaxPoints = 32
+}
+
+// The metrics an array adds: each point's velocity as velocity_<n>, their
+// weighted mean, and the flow that mean gives over the duct's area.
+var (
+	metricVelocityAverage = Measurement{Metric: "velocity_average", Unit: string(units.FeetPerMinute)}
+	metricFlowProfile     = Measurement{Metric: "flow_profile", Unit: string(units.SCFM)}
+)
+
+// Array describes the sensor points of a multipoint installation. Their
+// velocities are averaged with Weights, equal when empty, e.g. the
+// equal-area or log-Tchebycheff weights of a traverse. FlowArea is the
+// duct's cross-section in ft²; 0 takes the meter's own FLOW_AREA.
+type Array struct {
+	Points   int
+	Weights  []float64
+	FlowArea float64
+}
+
+func (a Array) validate() error {
+	switch {
+	case a.Points < 0 || a.Points > kurzMaxPoints:
+		return fmt.Errorf("%d sensor points out of range 0-%d", a.Points, kurzMaxPoints)
+	case len(a.Weights) != 0 && len(a.Weights) != a.Points:
+		return fmt.Errorf("%d weights for %d sensor points", len(a.Weights), a.Points)
+	case a.FlowArea < 0 || math.IsInf(a.FlowArea, 0):
+		return fmt.Errorf("flow area %g ft² must be positive", a.FlowArea)
+	}
+	sum := 0.0
+	for _, w := range a.Weights {
+		if w < 0 || math.IsInf(w, 0) || math.IsNaN(w) {
+			return fmt.Errorf("point weight %g must not be negative", w)
+		}
+		sum += w
+	}
+	if len(a.Weights) > 0 && sum == 0 {
+		return fmt.Errorf("point weights are all zero")
+	}
+	return nil
+}
+
+// weight is point i's share of the mean.
+func (a Array) weight(i int) float64 {
+	if len(a.Weights) == 0 {
+		return 1 / float64(a.Points)
+	}
+	sum := 0.0
+	for _, w := range a.Weights {
+		sum += w
+	}
+	return a.Weights[i] / sum
+}
+
+// WithArray reads each of a multipoint installation's sensor points on
+// every poll, reporting velocity_<n> for each, velocity_average, and
+// flow_profile (in FlowUnit) beside the transmitter's own values. Terminal
+// protocol only.
+func WithArray(a Array) Option {
+	return func(ks *KurzSensor) { ks.array = a }
+}
+
+// Point is one sensor point's reading.
+type Point struct {
+	Number      int     `json:"point"`
+	Velocity    float64 `json:"velocity"`              // SFPM
+	Temperature float64 `json:"temperature,omitempty"` // °F, where the point reports it
+}
+
+// ReadPoint reads sensor point n (from 1) on its own. Terminal protocol only.
+func (ks *KurzSensor) ReadPoint(ctx context.Context, n int) (Point, error) {
+	var p Point
+	err := ks.port.Submit(ctx, portworker.Operator, func() error {
+		if err := ks.terminal(); err != nil {
+			return err
+		}
+		var err error
+		p, err = ks.readPoint(ctx, n)
+		return err
+	})
+	if errors.Is(err, portworker.ErrStopped) {
+		return Point{}, fmt.Errorf("kurz sensor is not open: %w", err)
+	}
+	return p, err
+}
+
+// ReadPoints reads sensor points 1 to n in one operator-priority operation;
+// n = 0 reads the points WithArray configured.
+func (ks *KurzSensor) ReadPoints(ctx context.Context, n int) ([]Point, error) {
+	if n == 0 {
+		n = ks.array.Points
+	}
+	if n < 1 || n > kurzMaxPoints {
+		return nil, fmt.Errorf("%d sensor points out of range 1-%d", n, kurzMaxPoints)
+	}
+	var points []Point
+	err := ks.port.Submit(ctx, portworker.Operator, func() error {
+		if err := ks.terminal(); err != nil {
+			return err
+		}
+		points = make([]Point, 0, n)
+		for i := 1; i <= n; i++ {
+			p, err := ks.readPoint(ctx, i)
+			if err != nil {
+				return err
+			}
+			points = append(points, p)
+		}
+		return nil
+	})
+	if errors.Is(err, portworker.ErrStopped) {
+		return nil, fmt.Errorf("kurz sensor is not open: %w", err)
+	}
+	return points, err
+}
+
+// MeanVelocity is the weighted mean of points' velocities, with the weights
+// WithArray configured for them, or equal weights for any other number of
+// points.
+func (ks *KurzSensor) MeanVelocity(points []Point) float64 {
+	a := ks.array
+	if a.Points != len(points) {
+		a = Array{Points: len(points)}
+	}
+	mean := 0.0
+	for i, p := range points {
+		mean += a.weight(i) * p.Velocity
+	}
+	return mean
+}
+
+func (ks *KurzSensor) readPoint(ctx context.Context, n int) (Point, error) {
+	reply, err := ks.request(ctx, fmt.Sprintf(kurzCommandPoint, n), pointFrame(n))
+	if err != nil {
+		return Point{}, fmt.Errorf("failed to read sensor point %d: %w", n, err)
+	}
+	if strings.HasPrefix(reply, kurzRejectedReply) {
+		return Point{}, fmt.Errorf("meter has no sensor point %d: %s", n, reply)
+	}
+	values, _ := parseMeasurements(reply) // pointFrame parsed it already
+	p := Point{Number: n, Velocity: math.NaN()}
+	for _, m := range values {
+		switch m.Metric {
+		case metricVelocity.Metric:
+			p.Velocity = m.Value
+		case metricTemperature.Metric:
+			p.Temperature = m.Value
+		}
+	}
+	if math.IsNaN(p.Velocity) {
+		return Point{}, fmt.Errorf("%w: sensor point %d reports no velocity in %q", sensorerr.ErrInvalidResponse, n, reply)
+	}
+	return p, nil
+}
+
+// pointFrame accepts a measurement line for point n, and not the average or
+// another point's late reply. A rejection is a valid reply the caller
+// handles.
+func pointFrame(n int) func(string) error {
+	return func(line string) error {
+		if strings.HasPrefix(line, kurzRejectedReply) {
+			return nil
+		}
+		if _, err := parseMeasurements(line); err != nil {
+			return err
+		}
+		if got, _ := strconv.Atoi(strings.Fields(line)[0]); got != n {
+			return fmt.Errorf("%w: reply for point %d to a query for point %d", sensorerr.ErrInvalidResponse, got, n)
+		}
+		return nil
+	}
+}
+
+// arrayMetrics lists what WithArray adds to Metrics.
+func (ks *KurzSensor) arrayMetrics() []Measurement {
+	if ks.array.Points == 0 {
+		return nil
+	}
+	out := make([]Measurement, 0, ks.array.Points+2)
+	for i := 1; i <= ks.array.Points; i++ {
+		out = append(out, Measurement{Metric: fmt.Sprintf("%s_%d", metricVelocity.Metric, i), Unit: metricVelocity.Unit})
+	}
+	profile := metricFlowProfile
+	profile.Unit = string(ks.flowUnit)
+	return append(out, metricVelocityAverage, profile)
+}
+
+// readArray reads every point and returns their measurements, for a poll.
+// temperature is the transmitter's, °F, for actual volumes; NaN if unknown.
+func (ks *KurzSensor) readArray(ctx context.Context, temperature float64) ([]Measurement, error) {
+	if ks.array.Points == 0 || ks.bus != nil {
+		return nil, nil
+	}
+	if ks.flowArea == 0 {
+		area := ks.array.FlowArea
+		if area == 0 {
+			var err error
+			if area, err = ks.readFlowArea(ctx); err != nil {
+				return nil, fmt.Errorf("sensor points: %w", err)
+			}
+		}
+		ks.flowArea = area
+	}
+	out := make([]Measurement, 0, ks.array.Points+2)
+	points := make([]Point, 0, ks.array.Points)
+	for i := 1; i <= ks.array.Points; i++ {
+		p, err := ks.readPoint(ctx, i)
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, p)
+		out = append(out, Measurement{Metric: fmt.Sprintf("%s_%d", metricVelocity.Metric, i), Value: p.Velocity, Unit: metricVelocity.Unit})
+	}
+	mean := ks.MeanVelocity(points)
+	gas := ks.gas
+	if !math.IsNaN(temperature) {
+		gas.Line.Temperature, _ = units.Convert(temperature, units.Fahrenheit, units.Celsius)
+	}
+	flow, err := units.ConvertFlow(mean*ks.flowArea, units.SCFM, ks.flowUnit, gas) // SFPM × ft² is SCFM
+	if err != nil {
+		return nil, err
+	}
+	return append(out, with(metricVelocityAverage, mean), Measurement{Metric: metricFlowProfile.Metric, Value: flow, Unit: string(ks.flowUnit)}), nil
+}
@@ -0,0 +1,77 @@
+package kurz
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/demelere/sensor-control-modules/internal/units"
+	"github.com/demelere/sensor-control-modules/pkg/sensor"
+)
+
+func init() {
+	// thermal mass flow is unidirectional; the meter reports two decimals
+	sensor.RegisterContract("kurz", sensor.Contract{Metric: "flow", Unit: string(units.SCFM), Min: 0, Max: 10000, Resolution: 0.01, Interval: time.Second})
+	// the MFT-B's velocity and temperature ranges; the total only counts up
+	sensor.RegisterContract("kurz", sensor.Contract{Metric: "velocity", Unit: string(units.FeetPerMinute), Min: 0, Max: 60000, Resolution: 0.1, Interval: time.Second})
+	sensor.RegisterContract("kurz", sensor.Contract{Metric: "temperature", Unit: string(units.Fahrenheit), Min: -40, Max: 250, Resolution: 0.1, Interval: time.Second})
+	sensor.RegisterContract("kurz", sensor.Contract{Metric: "total", Unit: string(units.CubicFoot), Min: 0, Max: 1e12, Resolution: 0.01, Interval: time.Second})
+	// a multipoint array's mean velocity and the duct flow from it
+	sensor.RegisterContract("kurz", sensor.Contract{Metric: "velocity_average", Unit: string(units.FeetPerMinute), Min: 0, Max: 60000, Resolution: 0.1, Interval: time.Second})
+	sensor.RegisterContract("kurz", sensor.Contract{Metric: "flow_profile", Unit: string(units.SCFM), Min: 0, Max: 10000, Resolution: 0.01, Interval: time.Second})
+	sensor.Register("kurz", func(cfg sensor.Config) (sensor.Sensor, error) {
+		opts := []Option{WithBaudRate(cfg.BaudRate), WithPort(cfg.Port), WithPollingInterval(cfg.PollInterval)}
+		switch cfg.Protocol {
+		case "", "ascii":
+		case "modbus":
+			opts = append(opts, WithModbus(cfg.Address))
+		default:
+			return nil, fmt.Errorf("kurz sensor %s: protocol %q is not supported", cfg.Name, cfg.Protocol)
+		}
+		ks, err := NewKurzSensor(opts...)
+		if err != nil {
+			return nil, err
+		}
+		ks.SetReadTimeout(cfg.ReadTimeout)
+		if err := ks.SetPortMatch(cfg.PortMatch); err != nil {
+			return nil, err
+		}
+		return &registered{KurzSensor: ks, cfg: cfg, readings: make(chan sensor.Reading)}, nil
+	})
+}
+
+// registered adapts KurzSensor to sensor.Sensor.
+type registered struct {
+	*KurzSensor
+	cfg      sensor.Config
+	readings chan sensor.Reading
+}
+
+func (r *registered) Start(ctx context.Context) error {
+	if r.cfg.OnState != nil {
+		r.onState = func(e sensor.StateEvent) {
+			e.Sensor = r.cfg.Name
+			r.cfg.OnState(e)
+		}
+	}
+	flow := r.startKurzSensor(ctx, r.pollInterval)
+	go func() {
+		defer close(r.readings)
+		for rd := range flow {
+			rd.Sensor = r.cfg.Name
+			select {
+			case r.readings <- rd:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (r *registered) Readings() <-chan sensor.Reading { return r.readings }
+
+func (r *registered) Info() sensor.Info {
+	info := r.KurzSensor.Info()
+	return sensor.Info{Name: r.cfg.Name, Driver: "kurz", Port: info.Port, Model: info.Model, SerialNumber: info.SerialNumber, SoftwareVersion: info.SoftwareVersion}
+}
@@ -0,0 +1,241 @@
+package kurz
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/demelere/sensor-control-modules/internal/portworker"
+	"github.com/demelere/sensor-control-modules/internal/sensorerr"
+)
+
+var (
+	kurzCmdGetParameter  string
+	kurzCmdSetParameter  string
+	kurzRejectedReply    string
+	kurzParamTotal       string
+	kurzConfigParameters []string
+)
+
+func init() {
+	kurzCmdGetParameter = "G %s\r"
+	kurzCmdSetParameter = "S %s %s\r"
+	kurzRejectedReply = "ERR"
+	kurzParamTotal = "TOTAL"
+	kurzConfigParameters = []string{ // everything that makes two meters on the same duct read alike
+		"TAG", "UNITS", "STD_TEMP", "STD_PRESS", "FLOW_AREA", "K_FACTOR",
+		"FILTER", "ZERO_CUTOFF", "AOUT_LO", "AOUT_HI", "ALARM_LO", "ALARM_HI",
+	}
+}
+
+// Settings is a snapshot of the meter's configuration parameters, saved as
+// JSON so a replacement meter can be provisioned identically.
+type Settings struct {
+	Model           string            `json:"model,omitempty"`
+	SerialNumber    string            `json:"serial_number,omitempty"`
+	SoftwareVersion string            `json:"software_version,omitempty"`
+	Taken           time.Time         `json:"taken"`
+	Parameters      map[string]string `json:"parameters"`
+}
+
+// Difference is one parameter whose value on the meter (Got) differs from
+// the reference (Want). An empty side means the parameter is missing there.
+type Difference struct {
+	Parameter string `json:"parameter"`
+	Want      string `json:"want"`
+	Got       string `json:"got"`
+}
+
+func (d Difference) String() string {
+	return fmt.Sprintf("%s: want %q, meter has %q", d.Parameter, d.Want, d.Got)
+}
+
+// Backup reads every configuration parameter in one operator-priority
+// operation, so no poll interleaves with the snapshot.
+func (ks *KurzSensor) Backup(ctx context.Context) (Settings, error) {
+	var s Settings
+	err := ks.port.Submit(ctx, portworker.Operator, func() error {
+		if err := ks.terminal(); err != nil {
+			return err
+		}
+		s = Settings{
+			Model:           ks.sensorModel,
+			SerialNumber:    ks.sensorSerialNumber,
+			SoftwareVersion: ks.sensorSoftwareVersion,
+			Taken:           time.Now().UTC(),
+		}
+		var err error
+		s.Parameters, err = ks.getParameters(ctx, kurzConfigParameters)
+		return err
+	})
+	if errors.Is(err, portworker.ErrStopped) {
+		return Settings{}, fmt.Errorf("kurz sensor is not open: %w", err)
+	} else if err != nil {
+		return Settings{}, err
+	}
+	return s, nil
+}
+
+// ReadParameters reads the named parameters in one operator-priority
+// operation.
+func (ks *KurzSensor) ReadParameters(ctx context.Context, names []string) (map[string]string, error) {
+	var params map[string]string
+	err := ks.port.Submit(ctx, portworker.Operator, func() error {
+		if err := ks.terminal(); err != nil {
+			return err
+		}
+		var err error
+		params, err = ks.getParameters(ctx, names)
+		return err
+	})
+	if errors.Is(err, portworker.ErrStopped) {
+		return nil, fmt.Errorf("kurz sensor is not open: %w", err)
+	} else if err != nil {
+		return nil, err
+	}
+	return params, nil
+}
+
+// Restore writes the parameters in s to the meter, then reads them back and
+// returns whatever still differs. Unknown parameters are written as well, so
+// a backup from newer firmware restores fully where the meter accepts it.
+func (ks *KurzSensor) Restore(ctx context.Context, s Settings) ([]Difference, error) {
+	err := ks.port.Submit(ctx, portworker.Operator, func() error {
+		if err := ks.terminal(); err != nil {
+			return err
+		}
+		for _, name := range sortedParameters(s.Parameters) {
+			if err := ks.setParameter(ctx, name, s.Parameters[name]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, portworker.ErrStopped) {
+		return nil, fmt.Errorf("kurz sensor is not open: %w", err)
+	} else if err != nil {
+		return nil, err
+	}
+
+	got, err := ks.Backup(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("restored, but failed to read back: %w", err)
+	}
+	return Compare(s, got), nil
+}
+
+// Apply writes settings (parameter -> value) and fails if any of them did
+// not take, e.g. when provisioning a meter from a profile.
+func (ks *KurzSensor) Apply(ctx context.Context, settings map[string]string) error {
+	diffs, err := ks.Restore(ctx, Settings{Parameters: settings})
+	if err != nil {
+		return err
+	}
+	for _, d := range diffs {
+		if _, wanted := settings[d.Parameter]; wanted {
+			return fmt.Errorf("meter did not take %s", d)
+		}
+	}
+	return nil
+}
+
+// Compare lists the parameters that differ between want and got, sorted by
+// name. Identity fields (model, serial number) are not compared, since a
+// replacement meter is expected to differ there.
+func Compare(want, got Settings) []Difference {
+	names := map[string]string{}
+	for name := range want.Parameters {
+		names[name] = ""
+	}
+	for name := range got.Parameters {
+		names[name] = ""
+	}
+
+	var diffs []Difference
+	for _, name := range sortedParameters(names) {
+		w, g := want.Parameters[name], got.Parameters[name]
+		if w != g {
+			diffs = append(diffs, Difference{Parameter: name, Want: w, Got: g})
+		}
+	}
+	return diffs
+}
+
+func (ks *KurzSensor) getParameters(ctx context.Context, names []string) (map[string]string, error) {
+	params := make(map[string]string, len(names))
+	for _, name := range names {
+		v, err := ks.getParameter(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		params[name] = v
+	}
+	return params, nil
+}
+
+func (ks *KurzSensor) getParameter(ctx context.Context, name string) (string, error) {
+	reply, err := ks.request(ctx, fmt.Sprintf(kurzCmdGetParameter, name), parameterFrame(name))
+	if err != nil {
+		return "", fmt.Errorf("failed to read parameter %s: %w", name, err)
+	}
+	if strings.HasPrefix(reply, kurzRejectedReply) {
+		return "", fmt.Errorf("%w: meter rejected query for %s: %s", sensorerr.ErrInvalidResponse, name, reply)
+	}
+	if _, v, ok := strings.Cut(reply, "="); ok { // "NAME = value"
+		reply = strings.TrimSpace(v)
+	}
+	return reply, nil
+}
+
+func (ks *KurzSensor) setParameter(ctx context.Context, name, value string) error {
+	reply, err := ks.requestOnce(ctx, fmt.Sprintf(kurzCmdSetParameter, name, value), ackFrame)
+	if err != nil {
+		return fmt.Errorf("failed to read reply setting %s: %w", name, err)
+	}
+	if strings.HasPrefix(reply, kurzRejectedReply) {
+		return fmt.Errorf("meter rejected %s = %q: %s", name, value, reply)
+	}
+	if name == kurzParamFlowArea {
+		ks.flowArea = 0 // the sensor points read it again
+	}
+	return nil
+}
+
+func sortedParameters(params map[string]string) []string {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SaveSettings writes s to path as indented JSON.
+func SaveSettings(path string, s Settings) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode settings: %v", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write settings: %w", err)
+	}
+	return nil
+}
+
+// LoadSettings reads a file written by SaveSettings.
+func LoadSettings(path string) (Settings, error) {
+	var s Settings
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return s, fmt.Errorf("failed to read settings: %w", err)
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return s, fmt.Errorf("failed to parse settings %s: %v", path, err)
+	}
+	return s, nil
+}
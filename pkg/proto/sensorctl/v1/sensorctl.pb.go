@@ -0,0 +1,1055 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.10
+// 	protoc        (unknown)
+// source: sensorctl/v1/sensorctl.proto
+
+package sensorctlv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type GetCapabilitiesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetCapabilitiesRequest) Reset() {
+	*x = GetCapabilitiesRequest{}
+	mi := &file_sensorctl_v1_sensorctl_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetCapabilitiesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetCapabilitiesRequest) ProtoMessage() {}
+
+func (x *GetCapabilitiesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_sensorctl_v1_sensorctl_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetCapabilitiesRequest.ProtoReflect.Descriptor instead.
+func (*GetCapabilitiesRequest) Descriptor() ([]byte, []int) {
+	return file_sensorctl_v1_sensorctl_proto_rawDescGZIP(), []int{0}
+}
+
+type Capabilities struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The daemon's build version.
+	Version string `protobuf:"bytes,1,opt,name=version,proto3" json:"version,omitempty"`
+	// The REST API versions served, oldest first.
+	ApiVersions []string      `protobuf:"bytes,2,rep,name=api_versions,json=apiVersions,proto3" json:"api_versions,omitempty"`
+	Sensors     []*SensorInfo `protobuf:"bytes,3,rep,name=sensors,proto3" json:"sensors,omitempty"`
+	Metrics     []string      `protobuf:"bytes,4,rep,name=metrics,proto3" json:"metrics,omitempty"`
+	Features    []string      `protobuf:"bytes,5,rep,name=features,proto3" json:"features,omitempty"`
+	// The gRPC package versions served, oldest first, e.g. "sensorctl.v1". A
+	// client picks the newest one it was built for.
+	GrpcPackages  []string `protobuf:"bytes,6,rep,name=grpc_packages,json=grpcPackages,proto3" json:"grpc_packages,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Capabilities) Reset() {
+	*x = Capabilities{}
+	mi := &file_sensorctl_v1_sensorctl_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Capabilities) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Capabilities) ProtoMessage() {}
+
+func (x *Capabilities) ProtoReflect() protoreflect.Message {
+	mi := &file_sensorctl_v1_sensorctl_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Capabilities.ProtoReflect.Descriptor instead.
+func (*Capabilities) Descriptor() ([]byte, []int) {
+	return file_sensorctl_v1_sensorctl_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Capabilities) GetVersion() string {
+	if x != nil {
+		return x.Version
+	}
+	return ""
+}
+
+func (x *Capabilities) GetApiVersions() []string {
+	if x != nil {
+		return x.ApiVersions
+	}
+	return nil
+}
+
+func (x *Capabilities) GetSensors() []*SensorInfo {
+	if x != nil {
+		return x.Sensors
+	}
+	return nil
+}
+
+func (x *Capabilities) GetMetrics() []string {
+	if x != nil {
+		return x.Metrics
+	}
+	return nil
+}
+
+func (x *Capabilities) GetFeatures() []string {
+	if x != nil {
+		return x.Features
+	}
+	return nil
+}
+
+func (x *Capabilities) GetGrpcPackages() []string {
+	if x != nil {
+		return x.GrpcPackages
+	}
+	return nil
+}
+
+type SensorInfo struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Name   string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Driver string                 `protobuf:"bytes,2,opt,name=driver,proto3" json:"driver,omitempty"`
+	Metric string                 `protobuf:"bytes,3,opt,name=metric,proto3" json:"metric,omitempty"`
+	Unit   string                 `protobuf:"bytes,4,opt,name=unit,proto3" json:"unit,omitempty"`
+	// connected, degraded, disconnected, or reconnecting
+	State         string `protobuf:"bytes,5,opt,name=state,proto3" json:"state,omitempty"`
+	Simulated     bool   `protobuf:"varint,6,opt,name=simulated,proto3" json:"simulated,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SensorInfo) Reset() {
+	*x = SensorInfo{}
+	mi := &file_sensorctl_v1_sensorctl_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SensorInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SensorInfo) ProtoMessage() {}
+
+func (x *SensorInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_sensorctl_v1_sensorctl_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SensorInfo.ProtoReflect.Descriptor instead.
+func (*SensorInfo) Descriptor() ([]byte, []int) {
+	return file_sensorctl_v1_sensorctl_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *SensorInfo) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *SensorInfo) GetDriver() string {
+	if x != nil {
+		return x.Driver
+	}
+	return ""
+}
+
+func (x *SensorInfo) GetMetric() string {
+	if x != nil {
+		return x.Metric
+	}
+	return ""
+}
+
+func (x *SensorInfo) GetUnit() string {
+	if x != nil {
+		return x.Unit
+	}
+	return ""
+}
+
+func (x *SensorInfo) GetState() string {
+	if x != nil {
+		return x.State
+	}
+	return ""
+}
+
+func (x *SensorInfo) GetSimulated() bool {
+	if x != nil {
+		return x.Simulated
+	}
+	return false
+}
+
+// Reading is one published value, in display units.
+type Reading struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Sensor        string                 `protobuf:"bytes,1,opt,name=sensor,proto3" json:"sensor,omitempty"`
+	Metric        string                 `protobuf:"bytes,2,opt,name=metric,proto3" json:"metric,omitempty"`
+	Value         float64                `protobuf:"fixed64,3,opt,name=value,proto3" json:"value,omitempty"`
+	Unit          string                 `protobuf:"bytes,4,opt,name=unit,proto3" json:"unit,omitempty"`
+	Time          *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=time,proto3" json:"time,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Reading) Reset() {
+	*x = Reading{}
+	mi := &file_sensorctl_v1_sensorctl_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Reading) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Reading) ProtoMessage() {}
+
+func (x *Reading) ProtoReflect() protoreflect.Message {
+	mi := &file_sensorctl_v1_sensorctl_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Reading.ProtoReflect.Descriptor instead.
+func (*Reading) Descriptor() ([]byte, []int) {
+	return file_sensorctl_v1_sensorctl_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Reading) GetSensor() string {
+	if x != nil {
+		return x.Sensor
+	}
+	return ""
+}
+
+func (x *Reading) GetMetric() string {
+	if x != nil {
+		return x.Metric
+	}
+	return ""
+}
+
+func (x *Reading) GetValue() float64 {
+	if x != nil {
+		return x.Value
+	}
+	return 0
+}
+
+func (x *Reading) GetUnit() string {
+	if x != nil {
+		return x.Unit
+	}
+	return ""
+}
+
+func (x *Reading) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+type ListLatestRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListLatestRequest) Reset() {
+	*x = ListLatestRequest{}
+	mi := &file_sensorctl_v1_sensorctl_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListLatestRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListLatestRequest) ProtoMessage() {}
+
+func (x *ListLatestRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_sensorctl_v1_sensorctl_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListLatestRequest.ProtoReflect.Descriptor instead.
+func (*ListLatestRequest) Descriptor() ([]byte, []int) {
+	return file_sensorctl_v1_sensorctl_proto_rawDescGZIP(), []int{4}
+}
+
+type ListLatestResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Sorted by metric.
+	Readings      []*Reading `protobuf:"bytes,1,rep,name=readings,proto3" json:"readings,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListLatestResponse) Reset() {
+	*x = ListLatestResponse{}
+	mi := &file_sensorctl_v1_sensorctl_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListLatestResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListLatestResponse) ProtoMessage() {}
+
+func (x *ListLatestResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_sensorctl_v1_sensorctl_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListLatestResponse.ProtoReflect.Descriptor instead.
+func (*ListLatestResponse) Descriptor() ([]byte, []int) {
+	return file_sensorctl_v1_sensorctl_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ListLatestResponse) GetReadings() []*Reading {
+	if x != nil {
+		return x.Readings
+	}
+	return nil
+}
+
+type StreamReadingsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Only these metrics, or every metric when empty.
+	Metrics []string `protobuf:"bytes,1,rep,name=metrics,proto3" json:"metrics,omitempty"`
+	// Only readings from these sensors, or from every sensor when empty.
+	// Derived metrics come from sensor "derived".
+	Sensors       []string `protobuf:"bytes,2,rep,name=sensors,proto3" json:"sensors,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamReadingsRequest) Reset() {
+	*x = StreamReadingsRequest{}
+	mi := &file_sensorctl_v1_sensorctl_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamReadingsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamReadingsRequest) ProtoMessage() {}
+
+func (x *StreamReadingsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_sensorctl_v1_sensorctl_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamReadingsRequest.ProtoReflect.Descriptor instead.
+func (*StreamReadingsRequest) Descriptor() ([]byte, []int) {
+	return file_sensorctl_v1_sensorctl_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *StreamReadingsRequest) GetMetrics() []string {
+	if x != nil {
+		return x.Metrics
+	}
+	return nil
+}
+
+func (x *StreamReadingsRequest) GetSensors() []string {
+	if x != nil {
+		return x.Sensors
+	}
+	return nil
+}
+
+type ListEventsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Events overlapping [from, to]; unset ends are open.
+	From   *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=from,proto3" json:"from,omitempty"`
+	To     *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=to,proto3" json:"to,omitempty"`
+	Types  []string               `protobuf:"bytes,3,rep,name=types,proto3" json:"types,omitempty"`
+	Sensor string                 `protobuf:"bytes,4,opt,name=sensor,proto3" json:"sensor,omitempty"`
+	// Only events that raised an alert.
+	AlertsOnly bool `protobuf:"varint,5,opt,name=alerts_only,json=alertsOnly,proto3" json:"alerts_only,omitempty"`
+	// At most this many events per page; 0 for the default of 100.
+	PageSize int32 `protobuf:"varint,6,opt,name=page_size,json=pageSize,proto3" json:"page_size,omitempty"`
+	// next_page_token of the previous page, empty for the first.
+	PageToken     string `protobuf:"bytes,7,opt,name=page_token,json=pageToken,proto3" json:"page_token,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListEventsRequest) Reset() {
+	*x = ListEventsRequest{}
+	mi := &file_sensorctl_v1_sensorctl_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListEventsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListEventsRequest) ProtoMessage() {}
+
+func (x *ListEventsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_sensorctl_v1_sensorctl_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListEventsRequest.ProtoReflect.Descriptor instead.
+func (*ListEventsRequest) Descriptor() ([]byte, []int) {
+	return file_sensorctl_v1_sensorctl_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ListEventsRequest) GetFrom() *timestamppb.Timestamp {
+	if x != nil {
+		return x.From
+	}
+	return nil
+}
+
+func (x *ListEventsRequest) GetTo() *timestamppb.Timestamp {
+	if x != nil {
+		return x.To
+	}
+	return nil
+}
+
+func (x *ListEventsRequest) GetTypes() []string {
+	if x != nil {
+		return x.Types
+	}
+	return nil
+}
+
+func (x *ListEventsRequest) GetSensor() string {
+	if x != nil {
+		return x.Sensor
+	}
+	return ""
+}
+
+func (x *ListEventsRequest) GetAlertsOnly() bool {
+	if x != nil {
+		return x.AlertsOnly
+	}
+	return false
+}
+
+func (x *ListEventsRequest) GetPageSize() int32 {
+	if x != nil {
+		return x.PageSize
+	}
+	return 0
+}
+
+func (x *ListEventsRequest) GetPageToken() string {
+	if x != nil {
+		return x.PageToken
+	}
+	return ""
+}
+
+type ListEventsResponse struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Events []*Event               `protobuf:"bytes,1,rep,name=events,proto3" json:"events,omitempty"`
+	// Empty on the last page.
+	NextPageToken string `protobuf:"bytes,2,opt,name=next_page_token,json=nextPageToken,proto3" json:"next_page_token,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListEventsResponse) Reset() {
+	*x = ListEventsResponse{}
+	mi := &file_sensorctl_v1_sensorctl_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListEventsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListEventsResponse) ProtoMessage() {}
+
+func (x *ListEventsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_sensorctl_v1_sensorctl_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListEventsResponse.ProtoReflect.Descriptor instead.
+func (*ListEventsResponse) Descriptor() ([]byte, []int) {
+	return file_sensorctl_v1_sensorctl_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *ListEventsResponse) GetEvents() []*Event {
+	if x != nil {
+		return x.Events
+	}
+	return nil
+}
+
+func (x *ListEventsResponse) GetNextPageToken() string {
+	if x != nil {
+		return x.NextPageToken
+	}
+	return ""
+}
+
+// Event is one recorded alert or annotation.
+type Event struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Time  *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=time,proto3" json:"time,omitempty"`
+	// Set for events that span time, such as gaps and labels.
+	End     *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=end,proto3" json:"end,omitempty"`
+	Type    string                 `protobuf:"bytes,3,opt,name=type,proto3" json:"type,omitempty"`
+	Sensor  string                 `protobuf:"bytes,4,opt,name=sensor,proto3" json:"sensor,omitempty"`
+	Session string                 `protobuf:"bytes,5,opt,name=session,proto3" json:"session,omitempty"`
+	Alert   string                 `protobuf:"bytes,6,opt,name=alert,proto3" json:"alert,omitempty"`
+	Message string                 `protobuf:"bytes,7,opt,name=message,proto3" json:"message,omitempty"`
+	// The annotation exactly as it appears in the session stream, as JSON.
+	EventJson     string `protobuf:"bytes,8,opt,name=event_json,json=eventJson,proto3" json:"event_json,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Event) Reset() {
+	*x = Event{}
+	mi := &file_sensorctl_v1_sensorctl_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Event) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Event) ProtoMessage() {}
+
+func (x *Event) ProtoReflect() protoreflect.Message {
+	mi := &file_sensorctl_v1_sensorctl_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Event.ProtoReflect.Descriptor instead.
+func (*Event) Descriptor() ([]byte, []int) {
+	return file_sensorctl_v1_sensorctl_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *Event) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+func (x *Event) GetEnd() *timestamppb.Timestamp {
+	if x != nil {
+		return x.End
+	}
+	return nil
+}
+
+func (x *Event) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Event) GetSensor() string {
+	if x != nil {
+		return x.Sensor
+	}
+	return ""
+}
+
+func (x *Event) GetSession() string {
+	if x != nil {
+		return x.Session
+	}
+	return ""
+}
+
+func (x *Event) GetAlert() string {
+	if x != nil {
+		return x.Alert
+	}
+	return ""
+}
+
+func (x *Event) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *Event) GetEventJson() string {
+	if x != nil {
+		return x.EventJson
+	}
+	return ""
+}
+
+type StreamLogsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// debug, info, warn, or error; empty for info.
+	Level         string `protobuf:"bytes,1,opt,name=level,proto3" json:"level,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamLogsRequest) Reset() {
+	*x = StreamLogsRequest{}
+	mi := &file_sensorctl_v1_sensorctl_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamLogsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamLogsRequest) ProtoMessage() {}
+
+func (x *StreamLogsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_sensorctl_v1_sensorctl_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamLogsRequest.ProtoReflect.Descriptor instead.
+func (*StreamLogsRequest) Descriptor() ([]byte, []int) {
+	return file_sensorctl_v1_sensorctl_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *StreamLogsRequest) GetLevel() string {
+	if x != nil {
+		return x.Level
+	}
+	return ""
+}
+
+type LogEntry struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Time          *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=time,proto3" json:"time,omitempty"`
+	Level         string                 `protobuf:"bytes,2,opt,name=level,proto3" json:"level,omitempty"`
+	Message       string                 `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	Fields        map[string]string      `protobuf:"bytes,4,rep,name=fields,proto3" json:"fields,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LogEntry) Reset() {
+	*x = LogEntry{}
+	mi := &file_sensorctl_v1_sensorctl_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LogEntry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LogEntry) ProtoMessage() {}
+
+func (x *LogEntry) ProtoReflect() protoreflect.Message {
+	mi := &file_sensorctl_v1_sensorctl_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LogEntry.ProtoReflect.Descriptor instead.
+func (*LogEntry) Descriptor() ([]byte, []int) {
+	return file_sensorctl_v1_sensorctl_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *LogEntry) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+func (x *LogEntry) GetLevel() string {
+	if x != nil {
+		return x.Level
+	}
+	return ""
+}
+
+func (x *LogEntry) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *LogEntry) GetFields() map[string]string {
+	if x != nil {
+		return x.Fields
+	}
+	return nil
+}
+
+type AddMarkerRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Label         string                 `protobuf:"bytes,1,opt,name=label,proto3" json:"label,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AddMarkerRequest) Reset() {
+	*x = AddMarkerRequest{}
+	mi := &file_sensorctl_v1_sensorctl_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AddMarkerRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AddMarkerRequest) ProtoMessage() {}
+
+func (x *AddMarkerRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_sensorctl_v1_sensorctl_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AddMarkerRequest.ProtoReflect.Descriptor instead.
+func (*AddMarkerRequest) Descriptor() ([]byte, []int) {
+	return file_sensorctl_v1_sensorctl_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *AddMarkerRequest) GetLabel() string {
+	if x != nil {
+		return x.Label
+	}
+	return ""
+}
+
+type AddMarkerResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AddMarkerResponse) Reset() {
+	*x = AddMarkerResponse{}
+	mi := &file_sensorctl_v1_sensorctl_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AddMarkerResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AddMarkerResponse) ProtoMessage() {}
+
+func (x *AddMarkerResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_sensorctl_v1_sensorctl_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AddMarkerResponse.ProtoReflect.Descriptor instead.
+func (*AddMarkerResponse) Descriptor() ([]byte, []int) {
+	return file_sensorctl_v1_sensorctl_proto_rawDescGZIP(), []int{13}
+}
+
+var File_sensorctl_v1_sensorctl_proto protoreflect.FileDescriptor
+
+const file_sensorctl_v1_sensorctl_proto_rawDesc = "" +
+	"\n" +
+	"\x1csensorctl/v1/sensorctl.proto\x12\fsensorctl.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\x18\n" +
+	"\x16GetCapabilitiesRequest\"\xda\x01\n" +
+	"\fCapabilities\x12\x18\n" +
+	"\aversion\x18\x01 \x01(\tR\aversion\x12!\n" +
+	"\fapi_versions\x18\x02 \x03(\tR\vapiVersions\x122\n" +
+	"\asensors\x18\x03 \x03(\v2\x18.sensorctl.v1.SensorInfoR\asensors\x12\x18\n" +
+	"\ametrics\x18\x04 \x03(\tR\ametrics\x12\x1a\n" +
+	"\bfeatures\x18\x05 \x03(\tR\bfeatures\x12#\n" +
+	"\rgrpc_packages\x18\x06 \x03(\tR\fgrpcPackages\"\x98\x01\n" +
+	"\n" +
+	"SensorInfo\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x16\n" +
+	"\x06driver\x18\x02 \x01(\tR\x06driver\x12\x16\n" +
+	"\x06metric\x18\x03 \x01(\tR\x06metric\x12\x12\n" +
+	"\x04unit\x18\x04 \x01(\tR\x04unit\x12\x14\n" +
+	"\x05state\x18\x05 \x01(\tR\x05state\x12\x1c\n" +
+	"\tsimulated\x18\x06 \x01(\bR\tsimulated\"\x93\x01\n" +
+	"\aReading\x12\x16\n" +
+	"\x06sensor\x18\x01 \x01(\tR\x06sensor\x12\x16\n" +
+	"\x06metric\x18\x02 \x01(\tR\x06metric\x12\x14\n" +
+	"\x05value\x18\x03 \x01(\x01R\x05value\x12\x12\n" +
+	"\x04unit\x18\x04 \x01(\tR\x04unit\x12.\n" +
+	"\x04time\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\"\x13\n" +
+	"\x11ListLatestRequest\"G\n" +
+	"\x12ListLatestResponse\x121\n" +
+	"\breadings\x18\x01 \x03(\v2\x15.sensorctl.v1.ReadingR\breadings\"K\n" +
+	"\x15StreamReadingsRequest\x12\x18\n" +
+	"\ametrics\x18\x01 \x03(\tR\ametrics\x12\x18\n" +
+	"\asensors\x18\x02 \x03(\tR\asensors\"\xfa\x01\n" +
+	"\x11ListEventsRequest\x12.\n" +
+	"\x04from\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\x04from\x12*\n" +
+	"\x02to\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\x02to\x12\x14\n" +
+	"\x05types\x18\x03 \x03(\tR\x05types\x12\x16\n" +
+	"\x06sensor\x18\x04 \x01(\tR\x06sensor\x12\x1f\n" +
+	"\valerts_only\x18\x05 \x01(\bR\n" +
+	"alertsOnly\x12\x1b\n" +
+	"\tpage_size\x18\x06 \x01(\x05R\bpageSize\x12\x1d\n" +
+	"\n" +
+	"page_token\x18\a \x01(\tR\tpageToken\"i\n" +
+	"\x12ListEventsResponse\x12+\n" +
+	"\x06events\x18\x01 \x03(\v2\x13.sensorctl.v1.EventR\x06events\x12&\n" +
+	"\x0fnext_page_token\x18\x02 \x01(\tR\rnextPageToken\"\xfa\x01\n" +
+	"\x05Event\x12.\n" +
+	"\x04time\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\x12,\n" +
+	"\x03end\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\x03end\x12\x12\n" +
+	"\x04type\x18\x03 \x01(\tR\x04type\x12\x16\n" +
+	"\x06sensor\x18\x04 \x01(\tR\x06sensor\x12\x18\n" +
+	"\asession\x18\x05 \x01(\tR\asession\x12\x14\n" +
+	"\x05alert\x18\x06 \x01(\tR\x05alert\x12\x18\n" +
+	"\amessage\x18\a \x01(\tR\amessage\x12\x1d\n" +
+	"\n" +
+	"event_json\x18\b \x01(\tR\teventJson\")\n" +
+	"\x11StreamLogsRequest\x12\x14\n" +
+	"\x05level\x18\x01 \x01(\tR\x05level\"\xe1\x01\n" +
+	"\bLogEntry\x12.\n" +
+	"\x04time\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\x12\x14\n" +
+	"\x05level\x18\x02 \x01(\tR\x05level\x12\x18\n" +
+	"\amessage\x18\x03 \x01(\tR\amessage\x12:\n" +
+	"\x06fields\x18\x04 \x03(\v2\".sensorctl.v1.LogEntry.FieldsEntryR\x06fields\x1a9\n" +
+	"\vFieldsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"(\n" +
+	"\x10AddMarkerRequest\x12\x14\n" +
+	"\x05label\x18\x01 \x01(\tR\x05label\"\x13\n" +
+	"\x11AddMarkerResponse2\xed\x03\n" +
+	"\rSensorControl\x12S\n" +
+	"\x0fGetCapabilities\x12$.sensorctl.v1.GetCapabilitiesRequest\x1a\x1a.sensorctl.v1.Capabilities\x12O\n" +
+	"\n" +
+	"ListLatest\x12\x1f.sensorctl.v1.ListLatestRequest\x1a .sensorctl.v1.ListLatestResponse\x12N\n" +
+	"\x0eStreamReadings\x12#.sensorctl.v1.StreamReadingsRequest\x1a\x15.sensorctl.v1.Reading0\x01\x12O\n" +
+	"\n" +
+	"ListEvents\x12\x1f.sensorctl.v1.ListEventsRequest\x1a .sensorctl.v1.ListEventsResponse\x12G\n" +
+	"\n" +
+	"StreamLogs\x12\x1f.sensorctl.v1.StreamLogsRequest\x1a\x16.sensorctl.v1.LogEntry0\x01\x12L\n" +
+	"\tAddMarker\x12\x1e.sensorctl.v1.AddMarkerRequest\x1a\x1f.sensorctl.v1.AddMarkerResponseBOZMgithub.com/demelere/sensor-control-modules/pkg/proto/sensorctl/v1;sensorctlv1b\x06proto3"
+
+var (
+	file_sensorctl_v1_sensorctl_proto_rawDescOnce sync.Once
+	file_sensorctl_v1_sensorctl_proto_rawDescData []byte
+)
+
+func file_sensorctl_v1_sensorctl_proto_rawDescGZIP() []byte {
+	file_sensorctl_v1_sensorctl_proto_rawDescOnce.Do(func() {
+		file_sensorctl_v1_sensorctl_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_sensorctl_v1_sensorctl_proto_rawDesc), len(file_sensorctl_v1_sensorctl_proto_rawDesc)))
+	})
+	return file_sensorctl_v1_sensorctl_proto_rawDescData
+}
+
+var file_sensorctl_v1_sensorctl_proto_msgTypes = make([]protoimpl.MessageInfo, 15)
+var file_sensorctl_v1_sensorctl_proto_goTypes = []any{
+	(*GetCapabilitiesRequest)(nil), // 0: sensorctl.v1.GetCapabilitiesRequest
+	(*Capabilities)(nil),           // 1: sensorctl.v1.Capabilities
+	(*SensorInfo)(nil),             // 2: sensorctl.v1.SensorInfo
+	(*Reading)(nil),                // 3: sensorctl.v1.Reading
+	(*ListLatestRequest)(nil),      // 4: sensorctl.v1.ListLatestRequest
+	(*ListLatestResponse)(nil),     // 5: sensorctl.v1.ListLatestResponse
+	(*StreamReadingsRequest)(nil),  // 6: sensorctl.v1.StreamReadingsRequest
+	(*ListEventsRequest)(nil),      // 7: sensorctl.v1.ListEventsRequest
+	(*ListEventsResponse)(nil),     // 8: sensorctl.v1.ListEventsResponse
+	(*Event)(nil),                  // 9: sensorctl.v1.Event
+	(*StreamLogsRequest)(nil),      // 10: sensorctl.v1.StreamLogsRequest
+	(*LogEntry)(nil),               // 11: sensorctl.v1.LogEntry
+	(*AddMarkerRequest)(nil),       // 12: sensorctl.v1.AddMarkerRequest
+	(*AddMarkerResponse)(nil),      // 13: sensorctl.v1.AddMarkerResponse
+	nil,                            // 14: sensorctl.v1.LogEntry.FieldsEntry
+	(*timestamppb.Timestamp)(nil),  // 15: google.protobuf.Timestamp
+}
+var file_sensorctl_v1_sensorctl_proto_depIdxs = []int32{
+	2,  // 0: sensorctl.v1.Capabilities.sensors:type_name -> sensorctl.v1.SensorInfo
+	15, // 1: sensorctl.v1.Reading.time:type_name -> google.protobuf.Timestamp
+	3,  // 2: sensorctl.v1.ListLatestResponse.readings:type_name -> sensorctl.v1.Reading
+	15, // 3: sensorctl.v1.ListEventsRequest.from:type_name -> google.protobuf.Timestamp
+	15, // 4: sensorctl.v1.ListEventsRequest.to:type_name -> google.protobuf.Timestamp
+	9,  // 5: sensorctl.v1.ListEventsResponse.events:type_name -> sensorctl.v1.Event
+	15, // 6: sensorctl.v1.Event.time:type_name -> google.protobuf.Timestamp
+	15, // 7: sensorctl.v1.Event.end:type_name -> google.protobuf.Timestamp
+	15, // 8: sensorctl.v1.LogEntry.time:type_name -> google.protobuf.Timestamp
+	14, // 9: sensorctl.v1.LogEntry.fields:type_name -> sensorctl.v1.LogEntry.FieldsEntry
+	0,  // 10: sensorctl.v1.SensorControl.GetCapabilities:input_type -> sensorctl.v1.GetCapabilitiesRequest
+	4,  // 11: sensorctl.v1.SensorControl.ListLatest:input_type -> sensorctl.v1.ListLatestRequest
+	6,  // 12: sensorctl.v1.SensorControl.StreamReadings:input_type -> sensorctl.v1.StreamReadingsRequest
+	7,  // 13: sensorctl.v1.SensorControl.ListEvents:input_type -> sensorctl.v1.ListEventsRequest
+	10, // 14: sensorctl.v1.SensorControl.StreamLogs:input_type -> sensorctl.v1.StreamLogsRequest
+	12, // 15: sensorctl.v1.SensorControl.AddMarker:input_type -> sensorctl.v1.AddMarkerRequest
+	1,  // 16: sensorctl.v1.SensorControl.GetCapabilities:output_type -> sensorctl.v1.Capabilities
+	5,  // 17: sensorctl.v1.SensorControl.ListLatest:output_type -> sensorctl.v1.ListLatestResponse
+	3,  // 18: sensorctl.v1.SensorControl.StreamReadings:output_type -> sensorctl.v1.Reading
+	8,  // 19: sensorctl.v1.SensorControl.ListEvents:output_type -> sensorctl.v1.ListEventsResponse
+	11, // 20: sensorctl.v1.SensorControl.StreamLogs:output_type -> sensorctl.v1.LogEntry
+	13, // 21: sensorctl.v1.SensorControl.AddMarker:output_type -> sensorctl.v1.AddMarkerResponse
+	16, // [16:22] is the sub-list for method output_type
+	10, // [10:16] is the sub-list for method input_type
+	10, // [10:10] is the sub-list for extension type_name
+	10, // [10:10] is the sub-list for extension extendee
+	0,  // [0:10] is the sub-list for field type_name
+}
+
+func init() { file_sensorctl_v1_sensorctl_proto_init() }
+func file_sensorctl_v1_sensorctl_proto_init() {
+	if File_sensorctl_v1_sensorctl_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_sensorctl_v1_sensorctl_proto_rawDesc), len(file_sensorctl_v1_sensorctl_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   15,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_sensorctl_v1_sensorctl_proto_goTypes,
+		DependencyIndexes: file_sensorctl_v1_sensorctl_proto_depIdxs,
+		MessageInfos:      file_sensorctl_v1_sensorctl_proto_msgTypes,
+	}.Build()
+	File_sensorctl_v1_sensorctl_proto = out.File
+	file_sensorctl_v1_sensorctl_proto_goTypes = nil
+	file_sensorctl_v1_sensorctl_proto_depIdxs = nil
+}
@@ -0,0 +1,344 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: sensorctl/v1/sensorctl.proto
+
+package sensorctlv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	SensorControl_GetCapabilities_FullMethodName = "/sensorctl.v1.SensorControl/GetCapabilities"
+	SensorControl_ListLatest_FullMethodName      = "/sensorctl.v1.SensorControl/ListLatest"
+	SensorControl_StreamReadings_FullMethodName  = "/sensorctl.v1.SensorControl/StreamReadings"
+	SensorControl_ListEvents_FullMethodName      = "/sensorctl.v1.SensorControl/ListEvents"
+	SensorControl_StreamLogs_FullMethodName      = "/sensorctl.v1.SensorControl/StreamLogs"
+	SensorControl_AddMarker_FullMethodName       = "/sensorctl.v1.SensorControl/AddMarker"
+)
+
+// SensorControlClient is the client API for SensorControl service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// SensorControl is the daemon's gRPC API. It serves the same rig as the REST
+// API under /v1, and streams readings and logs as they are recorded.
+type SensorControlClient interface {
+	// GetCapabilities returns the sensors, metrics, and features the daemon
+	// supports.
+	GetCapabilities(ctx context.Context, in *GetCapabilitiesRequest, opts ...grpc.CallOption) (*Capabilities, error)
+	// ListLatest returns the most recent reading of every metric.
+	ListLatest(ctx context.Context, in *ListLatestRequest, opts ...grpc.CallOption) (*ListLatestResponse, error)
+	// StreamReadings sends every reading as it is recorded: raw, smoothed, and
+	// derived. A reader that falls behind loses readings rather than slowing
+	// the rig down.
+	StreamReadings(ctx context.Context, in *StreamReadingsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Reading], error)
+	// ListEvents pages through the recorded alerts and annotations, oldest
+	// first.
+	ListEvents(ctx context.Context, in *ListEventsRequest, opts ...grpc.CallOption) (*ListEventsResponse, error)
+	// StreamLogs follows the daemon's log.
+	StreamLogs(ctx context.Context, in *StreamLogsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[LogEntry], error)
+	// AddMarker records a marker in the open session.
+	AddMarker(ctx context.Context, in *AddMarkerRequest, opts ...grpc.CallOption) (*AddMarkerResponse, error)
+}
+
+type sensorControlClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSensorControlClient(cc grpc.ClientConnInterface) SensorControlClient {
+	return &sensorControlClient{cc}
+}
+
+func (c *sensorControlClient) GetCapabilities(ctx context.Context, in *GetCapabilitiesRequest, opts ...grpc.CallOption) (*Capabilities, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Capabilities)
+	err := c.cc.Invoke(ctx, SensorControl_GetCapabilities_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sensorControlClient) ListLatest(ctx context.Context, in *ListLatestRequest, opts ...grpc.CallOption) (*ListLatestResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListLatestResponse)
+	err := c.cc.Invoke(ctx, SensorControl_ListLatest_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sensorControlClient) StreamReadings(ctx context.Context, in *StreamReadingsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Reading], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &SensorControl_ServiceDesc.Streams[0], SensorControl_StreamReadings_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamReadingsRequest, Reading]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SensorControl_StreamReadingsClient = grpc.ServerStreamingClient[Reading]
+
+func (c *sensorControlClient) ListEvents(ctx context.Context, in *ListEventsRequest, opts ...grpc.CallOption) (*ListEventsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListEventsResponse)
+	err := c.cc.Invoke(ctx, SensorControl_ListEvents_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sensorControlClient) StreamLogs(ctx context.Context, in *StreamLogsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[LogEntry], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &SensorControl_ServiceDesc.Streams[1], SensorControl_StreamLogs_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[StreamLogsRequest, LogEntry]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SensorControl_StreamLogsClient = grpc.ServerStreamingClient[LogEntry]
+
+func (c *sensorControlClient) AddMarker(ctx context.Context, in *AddMarkerRequest, opts ...grpc.CallOption) (*AddMarkerResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AddMarkerResponse)
+	err := c.cc.Invoke(ctx, SensorControl_AddMarker_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SensorControlServer is the server API for SensorControl service.
+// All implementations must embed UnimplementedSensorControlServer
+// for forward compatibility.
+//
+// SensorControl is the daemon's gRPC API. It serves the same rig as the REST
+// API under /v1, and streams readings and logs as they are recorded.
+type SensorControlServer interface {
+	// GetCapabilities returns the sensors, metrics, and features the daemon
+	// supports.
+	GetCapabilities(context.Context, *GetCapabilitiesRequest) (*Capabilities, error)
+	// ListLatest returns the most recent reading of every metric.
+	ListLatest(context.Context, *ListLatestRequest) (*ListLatestResponse, error)
+	// StreamReadings sends every reading as it is recorded: raw, smoothed, and
+	// derived. A reader that falls behind loses readings rather than slowing
+	// the rig down.
+	StreamReadings(*StreamReadingsRequest, grpc.ServerStreamingServer[Reading]) error
+	// ListEvents pages through the recorded alerts and annotations, oldest
+	// first.
+	ListEvents(context.Context, *ListEventsRequest) (*ListEventsResponse, error)
+	// StreamLogs follows the daemon's log.
+	StreamLogs(*StreamLogsRequest, grpc.ServerStreamingServer[LogEntry]) error
+	// AddMarker records a marker in the open session.
+	AddMarker(context.Context, *AddMarkerRequest) (*AddMarkerResponse, error)
+	mustEmbedUnimplementedSensorControlServer()
+}
+
+// UnimplementedSensorControlServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedSensorControlServer struct{}
+
+func (UnimplementedSensorControlServer) GetCapabilities(context.Context, *GetCapabilitiesRequest) (*Capabilities, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetCapabilities not implemented")
+}
+func (UnimplementedSensorControlServer) ListLatest(context.Context, *ListLatestRequest) (*ListLatestResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListLatest not implemented")
+}
+func (UnimplementedSensorControlServer) StreamReadings(*StreamReadingsRequest, grpc.ServerStreamingServer[Reading]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamReadings not implemented")
+}
+func (UnimplementedSensorControlServer) ListEvents(context.Context, *ListEventsRequest) (*ListEventsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListEvents not implemented")
+}
+func (UnimplementedSensorControlServer) StreamLogs(*StreamLogsRequest, grpc.ServerStreamingServer[LogEntry]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamLogs not implemented")
+}
+func (UnimplementedSensorControlServer) AddMarker(context.Context, *AddMarkerRequest) (*AddMarkerResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddMarker not implemented")
+}
+func (UnimplementedSensorControlServer) mustEmbedUnimplementedSensorControlServer() {}
+func (UnimplementedSensorControlServer) testEmbeddedByValue()                       {}
+
+// UnsafeSensorControlServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SensorControlServer will
+// result in compilation errors.
+type UnsafeSensorControlServer interface {
+	mustEmbedUnimplementedSensorControlServer()
+}
+
+func RegisterSensorControlServer(s grpc.ServiceRegistrar, srv SensorControlServer) {
+	// If the following call pancis, it indicates UnimplementedSensorControlServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&SensorControl_ServiceDesc, srv)
+}
+
+func _SensorControl_GetCapabilities_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetCapabilitiesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SensorControlServer).GetCapabilities(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SensorControl_GetCapabilities_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SensorControlServer).GetCapabilities(ctx, req.(*GetCapabilitiesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SensorControl_ListLatest_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListLatestRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SensorControlServer).ListLatest(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SensorControl_ListLatest_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SensorControlServer).ListLatest(ctx, req.(*ListLatestRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SensorControl_StreamReadings_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamReadingsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SensorControlServer).StreamReadings(m, &grpc.GenericServerStream[StreamReadingsRequest, Reading]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SensorControl_StreamReadingsServer = grpc.ServerStreamingServer[Reading]
+
+func _SensorControl_ListEvents_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListEventsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SensorControlServer).ListEvents(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SensorControl_ListEvents_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SensorControlServer).ListEvents(ctx, req.(*ListEventsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SensorControl_StreamLogs_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamLogsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SensorControlServer).StreamLogs(m, &grpc.GenericServerStream[StreamLogsRequest, LogEntry]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SensorControl_StreamLogsServer = grpc.ServerStreamingServer[LogEntry]
+
+func _SensorControl_AddMarker_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddMarkerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SensorControlServer).AddMarker(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SensorControl_AddMarker_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SensorControlServer).AddMarker(ctx, req.(*AddMarkerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// SensorControl_ServiceDesc is the grpc.ServiceDesc for SensorControl service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var SensorControl_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "sensorctl.v1.SensorControl",
+	HandlerType: (*SensorControlServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetCapabilities",
+			Handler:    _SensorControl_GetCapabilities_Handler,
+		},
+		{
+			MethodName: "ListLatest",
+			Handler:    _SensorControl_ListLatest_Handler,
+		},
+		{
+			MethodName: "ListEvents",
+			Handler:    _SensorControl_ListEvents_Handler,
+		},
+		{
+			MethodName: "AddMarker",
+			Handler:    _SensorControl_AddMarker_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamReadings",
+			Handler:       _SensorControl_StreamReadings_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "StreamLogs",
+			Handler:       _SensorControl_StreamLogs_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "sensorctl/v1/sensorctl.proto",
+}
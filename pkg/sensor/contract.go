@@ -0,0 +1,54 @@
+package sensor
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Contract is what a driver promises about one metric it produces: a real
+// measurement lies within [Min, Max], values come in steps of Resolution,
+// and a reading arrives every Interval (zero for streams that follow the
+// subject rather than a clock, such as RR intervals). Values are in Unit, the
+// driver's native unit. For polled drivers Interval is the default poll
+// interval; the configured one takes its place.
+type Contract struct {
+	Metric     string
+	Unit       string
+	Min, Max   float64
+	Resolution float64
+	Interval   time.Duration
+}
+
+var contracts = map[string][]Contract{} // driver -> contracts, guarded by driversMu
+
+// RegisterContract declares a metric driver produces. Like Register it is
+// meant for init, and panics if the metric is declared twice.
+func RegisterContract(driver string, c Contract) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	for _, have := range contracts[driver] {
+		if have.Metric == c.Metric {
+			panic(fmt.Sprintf("sensor: driver %q declares metric %q twice", driver, c.Metric))
+		}
+	}
+	contracts[driver] = append(contracts[driver], c)
+	sort.Slice(contracts[driver], func(i, j int) bool { return contracts[driver][i].Metric < contracts[driver][j].Metric })
+}
+
+// Contracts returns the contracts driver declared, sorted by metric.
+func Contracts(driver string) []Contract {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+	return append([]Contract(nil), contracts[driver]...)
+}
+
+// ContractFor returns driver's contract for metric.
+func ContractFor(driver, metric string) (Contract, bool) {
+	for _, c := range Contracts(driver) {
+		if c.Metric == metric {
+			return c, true
+		}
+	}
+	return Contract{}, false
+}
@@ -0,0 +1,275 @@
+package sensor
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Manager runs several sensors side by side, e.g. CO2, flow, and heart rate
+// on one rig. Each sensor has a supervising goroutine that opens and starts
+// it and, when the driver fails, panics, or stops delivering readings before
+// the Manager is stopped, closes it and starts a fresh instance after a
+// backoff. Readings from every sensor arrive on one channel.
+//
+// Drivers still reconnect on their own; the Manager only steps in when that
+// gives up or the driver itself breaks. A panic on a driver's own goroutine
+// cannot be caught here and still takes the process down.
+type Manager struct {
+	// Backoff is the delay before restart number attempt (1-based). The
+	// default doubles from 1s up to 1m. Set it before Start.
+	Backoff func(attempt int) time.Duration
+	// FaultPoll is how often drivers that implement FaultReporter are asked
+	// for device faults, default 1m. Set it before Start.
+	FaultPoll time.Duration
+
+	configs  []Config
+	readings chan Reading
+	lock     sync.Mutex
+	health   map[string]*SensorHealth
+	seen     map[string]map[string]int // consecutive polls each fault was active, by sensor
+}
+
+// faultConfirm is how many polls in a row a device fault must be active
+// before health reports it, so a transient error bit is not an alarm.
+const faultConfirm = 2
+
+// SensorHealth is one managed sensor's status.
+type SensorHealth struct {
+	Name        string    `json:"name"`
+	Driver      string    `json:"driver"`
+	State       State     `json:"state"`
+	Restarts    int       `json:"restarts"`
+	LastReading time.Time `json:"last_reading"`     // zero until the first reading
+	Error       string    `json:"error,omitempty"`  // the last failure, kept after recovery
+	Faults      []string  `json:"faults,omitempty"` // persistent faults the device reports, e.g. "lamp failure"
+}
+
+// Health is the status of every managed sensor. State is Connected when all
+// of them are and none reports a device fault, Disconnected when none is
+// connected, and Degraded in between.
+type Health struct {
+	State   State          `json:"state"`
+	Sensors []SensorHealth `json:"sensors"`
+}
+
+// NewManager checks that every config names a registered driver and a
+// unique sensor name (defaulting to the driver name), but opens nothing.
+func NewManager(cfgs ...Config) (*Manager, error) {
+	m := &Manager{readings: make(chan Reading), health: map[string]*SensorHealth{}, seen: map[string]map[string]int{}}
+	for _, cfg := range cfgs {
+		driversMu.RLock()
+		_, ok := drivers[cfg.Driver]
+		driversMu.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("unknown sensor driver %q (registered: %v)", cfg.Driver, Drivers())
+		}
+		if cfg.Name == "" {
+			cfg.Name = cfg.Driver
+		}
+		if _, dup := m.health[cfg.Name]; dup {
+			return nil, fmt.Errorf("sensor %q configured twice", cfg.Name)
+		}
+		m.health[cfg.Name] = &SensorHealth{Name: cfg.Name, Driver: cfg.Driver, State: Disconnected}
+
+		onState := cfg.OnState
+		cfg.OnState = func(e StateEvent) {
+			m.update(e.Sensor, func(h *SensorHealth) {
+				h.State = e.State
+				if e.Err != nil {
+					h.Error = e.Err.Error()
+				}
+			})
+			if onState != nil {
+				onState(e)
+			}
+		}
+		m.configs = append(m.configs, cfg)
+	}
+	return m, nil
+}
+
+// Start supervises every sensor until ctx is done, then closes them and the
+// Readings channel.
+func (m *Manager) Start(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, cfg := range m.configs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.supervise(ctx, cfg)
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(m.readings)
+	}()
+}
+
+// Readings delivers every sensor's readings, with Sensor set to its name.
+func (m *Manager) Readings() <-chan Reading { return m.readings }
+
+func (m *Manager) Health() Health {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	h := Health{Sensors: make([]SensorHealth, 0, len(m.configs))}
+	connected, faulty := 0, false
+	for _, cfg := range m.configs {
+		s := *m.health[cfg.Name]
+		if s.State == Connected {
+			connected++
+		}
+		if len(s.Faults) > 0 {
+			faulty = true
+		}
+		s.Faults = append([]string(nil), s.Faults...)
+		h.Sensors = append(h.Sensors, s)
+	}
+	switch connected {
+	case len(m.configs):
+		h.State = Connected
+		if faulty {
+			h.State = Degraded
+		}
+	case 0:
+		h.State = Disconnected
+	default:
+		h.State = Degraded
+	}
+	return h
+}
+
+func (m *Manager) supervise(ctx context.Context, cfg Config) {
+	backoff := m.Backoff
+	if backoff == nil {
+		backoff = defaultBackoff
+	}
+	for attempt := 1; ; attempt++ {
+		delivered, err := m.run(ctx, cfg)
+		if ctx.Err() != nil {
+			m.update(cfg.Name, func(h *SensorHealth) { h.State = Disconnected })
+			return
+		}
+		if delivered { // it worked for a while, so this is a new failure, not a repeat
+			attempt = 1
+		}
+		log.Printf("sensor %s failed: %v; restarting (attempt %d)", cfg.Name, err, attempt)
+		m.update(cfg.Name, func(h *SensorHealth) {
+			h.State = Reconnecting
+			h.Error = err.Error()
+			h.Restarts++
+		})
+		select {
+		case <-ctx.Done():
+			m.update(cfg.Name, func(h *SensorHealth) { h.State = Disconnected })
+			return
+		case <-time.After(backoff(attempt)):
+		}
+	}
+}
+
+// run is one lifetime of a driver instance. It returns a nil error only once
+// ctx is done; delivered reports whether any reading got through.
+func (m *Manager) run(ctx context.Context, cfg Config) (delivered bool, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("driver panicked: %v", p)
+		}
+	}()
+	s, err := New(cfg)
+	if err != nil {
+		return false, err
+	}
+	defer s.Close()
+	if err := s.Open(); err != nil {
+		return false, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if err := s.Start(ctx); err != nil {
+		return false, err
+	}
+	m.update(cfg.Name, func(h *SensorHealth) { h.State = Connected })
+	if fr, ok := s.(FaultReporter); ok {
+		go m.watchFaults(ctx, cfg.Name, fr)
+	}
+
+	for r := range s.Readings() {
+		delivered = true
+		m.update(cfg.Name, func(h *SensorHealth) { h.LastReading = r.Time })
+		select {
+		case m.readings <- r:
+		case <-ctx.Done():
+			return delivered, nil
+		}
+	}
+	if ctx.Err() != nil {
+		return delivered, nil
+	}
+	return delivered, fmt.Errorf("readings stopped")
+}
+
+// watchFaults polls fr until ctx is done and keeps the sensor's health Faults
+// to those active for faultConfirm polls in a row. A fault clears as soon as
+// one poll no longer reports it. Counts outlive a restart of the driver.
+func (m *Manager) watchFaults(ctx context.Context, name string, fr FaultReporter) {
+	interval := m.FaultPoll
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		active, err := fr.DeviceFaults(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("sensor %s: fault poll failed: %v", name, err)
+		} else {
+			m.update(name, func(h *SensorHealth) {
+				prev := m.seen[name]
+				seen := map[string]int{}
+				h.Faults = nil
+				for _, f := range active {
+					seen[f] = prev[f] + 1
+					if seen[f] >= faultConfirm {
+						if seen[f] == faultConfirm {
+							log.Printf("sensor %s reports a fault: %s", name, f)
+						}
+						h.Faults = append(h.Faults, f)
+					}
+				}
+				for f, n := range prev {
+					if n >= faultConfirm && seen[f] == 0 {
+						log.Printf("sensor %s fault cleared: %s", name, f)
+					}
+				}
+				m.seen[name] = seen
+			})
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *Manager) update(name string, f func(*SensorHealth)) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if h, ok := m.health[name]; ok {
+		f(h)
+	}
+}
+
+func defaultBackoff(attempt int) time.Duration {
+	d := time.Second
+	for i := 1; i < attempt && d < time.Minute; i++ {
+		d *= 2
+	}
+	return min(d, time.Minute)
+}
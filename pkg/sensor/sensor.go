@@ -0,0 +1,214 @@
+// Package sensor is the lifecycle every driver shares (open, start, stream
+// readings, close) and a registry for driving heterogeneous sensors through
+// it. Drivers register themselves from init, database/sql style, so an
+// application imports the drivers it needs for their side effect:
+//
+//	import _ "github.com/demelere/sensor-control-modules/pkg/vaisala"
+//
+//	s, err := sensor.New(sensor.Config{Name: "co2", Driver: "vaisala"})
+package sensor
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Reading is one sample in the sensor's native unit, stamped when it was
+// taken. Drivers used directly set Sensor to the device's own identity (serial
+// number or address); through New it is the Config.Name.
+type Reading struct {
+	Sensor  string    `json:"sensor"`
+	Metric  string    `json:"metric"`
+	Value   float64   `json:"value"`
+	Unit    string    `json:"unit"`
+	Time    time.Time `json:"time"`
+	Quality Quality   `json:"quality"`
+}
+
+// Quality says how far a reading can be trusted.
+type Quality string
+
+const (
+	Good      Quality = "good"
+	Uncertain Quality = "uncertain" // the device flagged it, e.g. a chest strap without skin contact
+	Simulated Quality = "simulated" // not measured, e.g. a configured constant standing in for a meter
+)
+
+// Info identifies an opened sensor. Fields a driver cannot report are empty.
+type Info struct {
+	Name            string `json:"name"`
+	Driver          string `json:"driver"`
+	Port            string `json:"port,omitempty"` // serial device or BLE address
+	Model           string `json:"model,omitempty"`
+	SerialNumber    string `json:"serial_number,omitempty"`
+	SoftwareVersion string `json:"software_version,omitempty"`
+}
+
+// State is a sensor's connection state. Drivers that lose their device
+// rediscover and reopen it on their own, reporting each change.
+type State string
+
+const (
+	Connected    State = "connected"
+	Disconnected State = "disconnected"
+	Reconnecting State = "reconnecting"
+	Degraded     State = "degraded" // optional sensor absent since startup, still being looked for
+)
+
+type StateEvent struct {
+	Sensor  string
+	State   State
+	Attempt int   // reconnect attempt, 0 on the initial loss
+	Err     error // why the link was declared dead, or why the attempt failed
+	Time    time.Time
+}
+
+// Sensor is the lifecycle shared by all drivers. Open connects and identifies
+// the device; Start begins acquisition, delivering readings on Readings until
+// ctx is done or the sensor is closed, after which the channel is closed.
+// Start may be called once per Open.
+type Sensor interface {
+	Open() error
+	Start(ctx context.Context) error
+	Readings() <-chan Reading
+	Close() error
+	Info() Info
+}
+
+// FaultReporter is implemented by drivers whose devices report faults in
+// themselves, e.g. a failed lamp, that the readings alone would not show.
+// DeviceFaults returns the active faults by message, none when healthy; an
+// error means the device could not be asked.
+type FaultReporter interface {
+	DeviceFaults(ctx context.Context) ([]string, error)
+}
+
+// Config is what a driver needs to construct a sensor. Drivers ignore the
+// fields that do not apply to them and use their own defaults for zero values.
+type Config struct {
+	Name         string
+	Driver       string
+	BaudRate     int
+	Address      int              // bus address (Vaisala), Modbus slave ID (Kurz)
+	MAC          string           // BLE address (Polar)
+	Port         string           // serial device to open instead of discovering one
+	PortMatch    string           // regexp narrowing serial discovery to one of several cables
+	Protocol     string           // wire protocol where the driver offers a choice, e.g. "modbus" (Vaisala, Kurz)
+	Parameters   []string         // metrics to report from a multi-parameter probe, e.g. "temperature" (Vaisala)
+	Stream       bool             // the device sends samples every PollInterval unasked (Vaisala RUN mode)
+	PollInterval time.Duration    // polled drivers only
+	ReadTimeout  time.Duration    // per-reply wait on serial drivers, after which reads fail with a timeout
+	OnState      func(StateEvent) // connection state changes during Start, optional
+}
+
+// Factory constructs an unopened sensor.
+type Factory func(cfg Config) (Sensor, error)
+
+var (
+	driversMu sync.RWMutex
+	drivers   = map[string]Factory{}
+)
+
+// Register makes a driver available to New. It panics if the name is taken,
+// since that can only be a programming error.
+func Register(driver string, f Factory) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	if _, dup := drivers[driver]; dup {
+		panic(fmt.Sprintf("sensor: driver %q registered twice", driver))
+	}
+	drivers[driver] = f
+}
+
+// Drivers returns the registered driver names, sorted.
+func Drivers() []string {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+	names := make([]string, 0, len(drivers))
+	for name := range drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New constructs a sensor with the driver named in cfg. Name defaults to the
+// driver name.
+func New(cfg Config) (Sensor, error) {
+	driversMu.RLock()
+	f, ok := drivers[cfg.Driver]
+	driversMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown sensor driver %q (registered: %v)", cfg.Driver, Drivers())
+	}
+	if cfg.Name == "" {
+		cfg.Name = cfg.Driver
+	}
+	return f(cfg)
+}
+
+// Registry holds named sensor instances so an application can enumerate and
+// manage them together.
+type Registry struct {
+	lock    sync.RWMutex
+	sensors map[string]Sensor
+	order   []string
+}
+
+func NewRegistry() *Registry {
+	return &Registry{sensors: map[string]Sensor{}}
+}
+
+// Add registers s under name, which must be unique within the registry.
+func (r *Registry) Add(name string, s Sensor) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, dup := r.sensors[name]; dup {
+		return fmt.Errorf("sensor %q already registered", name)
+	}
+	r.sensors[name] = s
+	r.order = append(r.order, name)
+	return nil
+}
+
+// Get returns the sensor registered under name.
+func (r *Registry) Get(name string) (Sensor, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	s, ok := r.sensors[name]
+	return s, ok
+}
+
+// Names returns the registered names in the order they were added.
+func (r *Registry) Names() []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return append([]string(nil), r.order...)
+}
+
+// Infos returns every sensor's Info, in the order they were added.
+func (r *Registry) Infos() []Info {
+	var infos []Info
+	for _, name := range r.Names() {
+		if s, ok := r.Get(name); ok {
+			infos = append(infos, s.Info())
+		}
+	}
+	return infos
+}
+
+// Close closes every sensor in reverse order and returns the first error.
+func (r *Registry) Close() error {
+	names := r.Names()
+	var first error
+	for i := len(names) - 1; i >= 0; i-- {
+		s, _ := r.Get(names[i])
+		if err := s.Close(); err != nil && first == nil {
+			first = fmt.Errorf("sensor %s: %w", names[i], err)
+		}
+	}
+	return first
+}
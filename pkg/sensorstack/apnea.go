@@ -0,0 +1,68 @@
+package sensorstack
+
+import (
+	"time"
+
+	"github.com/demelere/sensor-control-modules/internal/apnea"
+	"github.com/demelere/sensor-control-modules/internal/units"
+)
+
+// apneaNote records a breath-hold. Start is the last breath before it; End
+// is set once breathing resumes.
+type apneaNote struct {
+	Annotation string     `json:"annotation"` // "apnea"
+	State      string     `json:"state"`      // "start" or "end"
+	Start      time.Time  `json:"start"`
+	End        *time.Time `json:"end,omitempty"`
+	Seconds    float64    `json:"duration_s,omitempty"`
+}
+
+// apneaWatch runs the breath-hold detector over a metabolic cart's flow and
+// CO2 readings.
+type apneaWatch struct {
+	det *apnea.Detector
+}
+
+func newApneaWatch() *apneaWatch {
+	w := &apneaWatch{}
+	w.resetSession()
+	return w
+}
+
+func (w *apneaWatch) resetSession() {
+	w.det = apnea.NewDetector(0, 0, 0)
+}
+
+// observe feeds one native-unit value to the detector and returns the
+// annotations for whatever events it raised.
+func (w *apneaWatch) observe(t time.Time, metric string, v float64, unit units.Unit) []any {
+	switch metric {
+	case "flow":
+		scfm, err := units.Convert(v, unit, units.SCFM)
+		if err != nil {
+			return nil
+		}
+		w.det.AddFlow(t, scfm)
+	case "co2":
+		if unit != units.PPM {
+			return nil
+		}
+		w.det.AddCO2(t, v)
+	default:
+		return nil
+	}
+	var out []any
+	for {
+		select {
+		case ev := <-w.det.Events():
+			n := apneaNote{Annotation: "apnea", State: "start", Start: ev.Start}
+			if ev.Type == apnea.EventEnd {
+				end := ev.End
+				n.State, n.End, n.Seconds = "end", &end, ev.Duration.Seconds()
+			}
+			out = append(out, n)
+		default:
+			return out
+		}
+	}
+}
@@ -0,0 +1,195 @@
+//go:build chaos
+
+package sensorstack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go.bug.st/serial"
+
+	"github.com/demelere/sensor-control-modules/internal/chaos"
+	"github.com/demelere/sensor-control-modules/internal/gap"
+	"github.com/demelere/sensor-control-modules/internal/reconnect"
+	"github.com/demelere/sensor-control-modules/internal/sensorerr"
+	"github.com/demelere/sensor-control-modules/internal/serialio"
+	"github.com/demelere/sensor-control-modules/pkg/sensor"
+)
+
+// fakePort is a probe that answers every command with one reading. Only the
+// methods serialio uses are implemented.
+type fakePort struct {
+	serial.Port
+	in      []byte
+	timeout time.Duration
+	closed  bool
+}
+
+func (p *fakePort) Write(b []byte) (int, error) {
+	if p.closed {
+		return 0, errors.New("port closed")
+	}
+	p.in = append(p.in, "1234\r\n"...)
+	return len(b), nil
+}
+
+func (p *fakePort) Read(b []byte) (int, error) {
+	if p.closed {
+		return 0, errors.New("port closed")
+	}
+	if len(p.in) == 0 {
+		time.Sleep(p.timeout)
+		return 0, nil
+	}
+	n := copy(b, p.in)
+	p.in = p.in[n:]
+	return n, nil
+}
+
+func (p *fakePort) ResetInputBuffer() error {
+	p.in = nil
+	return nil
+}
+
+func (p *fakePort) SetReadTimeout(t time.Duration) error {
+	p.timeout = t
+	return nil
+}
+
+// probe is a driver over a fakePort, polled the way the stack polls sensors.
+type probe struct {
+	port *fakePort
+	r    *serialio.LineReader
+}
+
+func (p *probe) open() error {
+	p.port = &fakePort{}
+	p.r = serialio.NewLineReader(p.port, 20*time.Millisecond)
+	return nil
+}
+
+func (p *probe) close() error {
+	p.port.closed = true
+	return nil
+}
+
+func (p *probe) poll(ctx context.Context) (float64, error) {
+	p.r.Discard()
+	if _, err := p.port.Write([]byte("send\r\n")); err != nil {
+		return 0, err
+	}
+	line, err := p.r.ReadLine(ctx)
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(line), 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", sensorerr.ErrInvalidResponse, line)
+	}
+	return v, nil
+}
+
+// TestSerialFaultRecovery injects each kind of serial fault into a polled
+// probe and checks that polling recovers, reconnecting only once the fault
+// persists, and that the outage raises the alerts operators rely on.
+func TestSerialFaultRecovery(t *testing.T) {
+	const clean = "delay=0,error=0,disconnect=0,seed=1"
+	for _, tc := range []struct {
+		name      string
+		faults    string
+		polls     int // polls that see the fault
+		wantErr   error
+		reconnect bool
+		alerts    []string
+	}{
+		{"line noise", "error=1", 1, sensorerr.ErrInvalidResponse, false, []string{"gap"}},
+		{"garbled link", "error=1", 3, sensorerr.ErrInvalidResponse, true, []string{"disconnected", "gap"}},
+		{"stalled replies", "delay=1,max_delay=10s", 3, sensorerr.ErrTimeout, true, []string{"disconnected", "gap"}},
+		{"port gone", "disconnect=1", 1, chaos.ErrInjected, true, []string{"disconnected", "gap"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			defer chaos.Configure(clean)
+			ctx := context.Background()
+			policy := reconnect.Policy{Initial: time.Millisecond, Max: time.Millisecond, Multiplier: 1, MaxParseFailures: 3, MaxTimeouts: 3}
+			const interval = time.Second
+
+			var alerts []string
+			var messages []string
+			record := func(v any) {
+				if a, ok := alertFor(v); ok {
+					alerts = append(alerts, a.Kind)
+					messages = append(messages, a.Message)
+				}
+			}
+			var states []sensor.State
+			notify := func(e sensor.StateEvent) {
+				states = append(states, e.State)
+				record(newConnectionNote("co2", e))
+			}
+
+			p := &probe{}
+			p.open()
+			link := reconnect.NewTracker(policy)
+			gaps := gap.NewDetector("co2", "co2", interval)
+			now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+			step := func() (float64, error) {
+				now = now.Add(interval)
+				v, err := p.poll(ctx)
+				if err != nil {
+					gaps.Error(err)
+					if link.Observe(err) {
+						if err := reconnect.Reconnect(ctx, policy, err, p.close, p.open, notify); err != nil {
+							t.Fatalf("reconnect: %v", err)
+						}
+					}
+					return 0, err
+				}
+				link.Observe(nil)
+				if g, ok := gaps.Reading(now); ok {
+					record(g)
+				}
+				return v, nil
+			}
+
+			if err := chaos.Configure(clean); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := step(); err != nil {
+				t.Fatalf("clean poll: %v", err)
+			}
+			if err := chaos.Configure(tc.faults); err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < tc.polls; i++ {
+				if _, err := step(); !errors.Is(err, tc.wantErr) {
+					t.Fatalf("faulty poll %d: got %v, want %v", i+1, err, tc.wantErr)
+				}
+			}
+			if err := chaos.Configure(clean); err != nil {
+				t.Fatal(err)
+			}
+			v, err := step()
+			if err != nil || v != 1234 {
+				t.Fatalf("poll after the faults = %v, %v, want 1234", v, err)
+			}
+
+			if got := len(states) > 0; got != tc.reconnect {
+				t.Errorf("reconnected = %v, want %v (states %v)", got, tc.reconnect, states)
+			}
+			if tc.reconnect && (states[0] != sensor.Disconnected || states[len(states)-1] != sensor.Connected) {
+				t.Errorf("states = %v, want disconnected through connected", states)
+			}
+			if strings.Join(alerts, ",") != strings.Join(tc.alerts, ",") {
+				t.Errorf("alerts = %v, want %v", alerts, tc.alerts)
+			}
+			if want := fmt.Sprintf("co2: %d missed polls", tc.polls); len(messages) == 0 || messages[len(messages)-1] != want {
+				t.Errorf("gap alert = %q, want %q", messages, want)
+			}
+		})
+	}
+}
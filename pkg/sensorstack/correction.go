@@ -0,0 +1,158 @@
+package sensorstack
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/demelere/sensor-control-modules/internal/api"
+	"github.com/demelere/sensor-control-modules/internal/config"
+	"github.com/demelere/sensor-control-modules/internal/correction"
+)
+
+// calibrationNote records a correction being set or cleared, so a session
+// shows which of its readings were corrected with what.
+type calibrationNote struct {
+	Annotation   string            `json:"annotation"` // "calibration"
+	Sensor       string            `json:"sensor"`
+	SerialNumber string            `json:"serial_number,omitempty"` // of the probe a curve is kept for
+	Metric       string            `json:"metric"`
+	State        string            `json:"state"` // "set" or "cleared"
+	Slope        float64           `json:"slope,omitempty"`
+	Offset       float64           `json:"offset,omitempty"`
+	Curve        *correction.Curve `json:"curve,omitempty"`
+	Unit         string            `json:"unit,omitempty"`
+	Note         string            `json:"note,omitempty"`
+	Time         time.Time         `json:"time"`
+}
+
+// corrections applies the stored calibration to readings before anything
+// else sees them. A corrected metric is published corrected under its own
+// name, and as read under <metric>_raw. A probe's own calibration, kept by
+// serial number, comes before the sensor's.
+type corrections struct {
+	set     *correction.Set
+	sensors map[string]bool
+	failed  map[string]bool            // "<sensor> <metric>" whose unit the correction cannot convert, logged once; process dispatcher only
+	submit  func(calibrationNote)      // to the process dispatcher
+	probe   func(sensor string) string // serial number of the probe connected, "" if unknown
+}
+
+func newCorrections(set *correction.Set, sensors []config.Sensor) *corrections {
+	c := &corrections{set: set, sensors: map[string]bool{}, failed: map[string]bool{}, submit: func(calibrationNote) {}, probe: func(string) string { return "" }}
+	for _, sc := range sensors {
+		c.sensors[sc.Name] = true
+	}
+	return c
+}
+
+// apply corrects it in place and returns the raw value, or false if the
+// metric is not corrected.
+func (c *corrections) apply(it *polledSample) (float64, bool) {
+	cor, _, ok := c.lookup(it.sensor, it.metric)
+	if !ok {
+		return 0, false
+	}
+	v, err := cor.Apply(it.value, string(it.unit))
+	if err != nil {
+		if key := it.sensor + " " + it.metric; !c.failed[key] {
+			c.failed[key] = true
+			log.Printf("sensor %s: %s left uncorrected: %v", it.sensor, it.metric, err)
+		}
+		return 0, false
+	}
+	raw := it.value
+	it.value = v
+	return raw, true
+}
+
+// lookup finds the correction for a sensor's metric, and the serial number
+// of the probe it is kept for if it is a probe's.
+func (c *corrections) lookup(sensor, metric string) (correction.Correction, string, bool) {
+	if c.set.HasProbes() {
+		if serial := c.probe(sensor); serial != "" {
+			if cor, ok := c.set.GetProbe(serial, metric); ok {
+				return cor, serial, true
+			}
+		}
+	}
+	cor, ok := c.set.Get(sensor, metric)
+	return cor, "", ok
+}
+
+func (c *corrections) list() []correction.Entry {
+	return c.set.All()
+}
+
+func (c *corrections) put(sensor, metric string, cor correction.Correction) (correction.Entry, error) {
+	if !c.sensors[sensor] {
+		return correction.Entry{}, fmt.Errorf("%w %s", api.ErrUnknownSensor, sensor)
+	}
+	if err := cor.Validate(); err != nil {
+		return correction.Entry{}, err
+	}
+	err := c.set.Put(sensor, metric, cor) // past validation, only saving can fail
+	c.submit(calibrationNote{Annotation: "calibration", Sensor: sensor, Metric: metric, State: "set", Slope: cor.Slope, Offset: cor.Offset, Unit: cor.Unit, Note: cor.Note, Time: cor.Since})
+	offset := fmt.Sprintf("%+g", cor.Offset)
+	if cor.Unit != "" {
+		offset += " " + cor.Unit
+	}
+	log.Printf("sensor %s: %s corrected as %g × reading %s", sensor, metric, cor.Slope, offset)
+	e := correction.Entry{Sensor: sensor, Metric: metric, Correction: cor}
+	if err != nil {
+		return e, fmt.Errorf("correction applied for now, but not saved: %w", err)
+	}
+	return e, nil
+}
+
+// calibrate stores a fitted curve for the probe connected to sensor, or for
+// the sensor itself if the probe has not reported a serial number.
+func (c *corrections) calibrate(sensor, metric string, cor correction.Correction) (correction.Entry, error) {
+	if !c.sensors[sensor] {
+		return correction.Entry{}, fmt.Errorf("%w %s", api.ErrUnknownSensor, sensor)
+	}
+	if err := cor.Validate(); err != nil {
+		return correction.Entry{}, err
+	}
+	serial := c.probe(sensor)
+	e := correction.Entry{Sensor: sensor, Metric: metric, Correction: cor}
+	var err error
+	if serial != "" {
+		e = correction.Entry{SerialNumber: serial, Metric: metric, Correction: cor}
+		err = c.set.PutProbe(serial, metric, cor)
+		log.Printf("sensor %s: %s calibrated with a %s curve for probe %s", sensor, metric, cor.Curve.Method, serial)
+	} else {
+		err = c.set.Put(sensor, metric, cor)
+		log.Printf("sensor %s: %s calibrated with a %s curve; the probe reports no serial number, so it stays with the sensor", sensor, metric, cor.Curve.Method)
+	}
+	c.submit(calibrationNote{Annotation: "calibration", Sensor: sensor, SerialNumber: serial, Metric: metric, State: "set", Curve: cor.Curve, Unit: cor.Unit, Note: cor.Note, Time: cor.Since})
+	if err != nil {
+		return e, fmt.Errorf("calibration applied for now, but not saved: %w", err)
+	}
+	return e, nil
+}
+
+// remove clears the correction a sensor's metric is read with now: the
+// connected probe's, or else the sensor's.
+func (c *corrections) remove(sensor, metric string) (bool, error) {
+	_, serial, ok := c.lookup(sensor, metric)
+	if !ok {
+		return false, nil
+	}
+	var found bool
+	var err error
+	if serial != "" {
+		found, err = c.set.DeleteProbe(serial, metric)
+	} else {
+		found, err = c.set.Delete(sensor, metric)
+	}
+	if found {
+		c.submit(calibrationNote{Annotation: "calibration", Sensor: sensor, SerialNumber: serial, Metric: metric, State: "cleared", Time: time.Now().UTC()})
+		if serial != "" {
+			log.Printf("sensor %s: %s no longer corrected with probe %s's curve", sensor, metric, serial)
+		} else {
+			log.Printf("sensor %s: %s no longer corrected", sensor, metric)
+		}
+	}
+	return found, err
+}
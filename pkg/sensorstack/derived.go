@@ -0,0 +1,259 @@
+package sensorstack
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/demelere/sensor-control-modules/internal/accum"
+	"github.com/demelere/sensor-control-modules/internal/config"
+	"github.com/demelere/sensor-control-modules/internal/derivative"
+	"github.com/demelere/sensor-control-modules/internal/filter"
+	"github.com/demelere/sensor-control-modules/internal/integral"
+	"github.com/demelere/sensor-control-modules/internal/spectral"
+	"github.com/demelere/sensor-control-modules/internal/units"
+)
+
+// derivedChannel computes extra readings from the live stream. observe is
+// called with every native-unit value under the daemon's output lock. input is
+// the metric it is computed from and name the metric it emits (the prefix,
+// for channels that emit several), so it starts after whatever provides input.
+type derivedChannel interface {
+	observe(t time.Time, metric string, v float64, unit units.Unit) []Reading
+	input() string
+	name() string
+}
+
+// sessionScoped channels restart their state when a new session begins.
+type sessionScoped interface {
+	resetSession()
+}
+
+func newDerivedChannels(cfg *config.Config) ([]derivedChannel, error) {
+	var out []derivedChannel
+	for _, dc := range cfg.DeadBands {
+		if dc.Band <= 0 {
+			return nil, fmt.Errorf("dead band %s: band must be positive", dc.Metric)
+		}
+		out = append(out, &deadBandChannel{metric: dc.Metric, filter: filter.DeadBand{Band: dc.Band}})
+	}
+	for _, ic := range cfg.Integrals {
+		ch, err := newIntegralChannel(ic)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, ch)
+	}
+	for _, dc := range cfg.Derivatives {
+		ch, err := newDerivativeChannel(dc)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, ch)
+	}
+	for _, sc := range cfg.Spectral {
+		ch, err := newSpectralChannel(sc)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, ch)
+	}
+	return out, nil
+}
+
+type deadBandChannel struct {
+	metric string
+	filter filter.DeadBand
+}
+
+func (c *deadBandChannel) input() string { return c.metric }
+func (c *deadBandChannel) name() string  { return c.metric + "_filtered" }
+
+func (c *deadBandChannel) observe(t time.Time, metric string, v float64, unit units.Unit) []Reading {
+	if metric != c.metric {
+		return nil
+	}
+	held, changed := c.filter.Apply(v)
+	if !changed {
+		return nil
+	}
+	return []Reading{{Sensor: "derived", Metric: metric + "_filtered", Value: held, Unit: string(unit), Time: t}}
+}
+
+// totalUnits maps a rate unit to the unit of its integral per minute.
+var totalUnits = map[units.Unit]units.Unit{
+	units.SCFM: units.CubicFoot,
+	units.SLPM: units.Liter,
+}
+
+type integralChannel struct {
+	metric string
+	output string
+	unit   string
+	per    time.Duration
+	total  *integral.Integral
+}
+
+func newIntegralChannel(ic config.IntegralChannel) (*integralChannel, error) {
+	mode, err := accum.ParseMode(ic.Mode)
+	if err != nil {
+		return nil, fmt.Errorf("integral %s: %v", ic.Metric, err)
+	}
+	per := time.Duration(ic.Per)
+	if per <= 0 {
+		per = time.Minute
+	}
+	name := ic.Name
+	if name == "" {
+		name = ic.Metric + "_total"
+	}
+	return &integralChannel{
+		metric: ic.Metric,
+		output: name,
+		unit:   ic.Unit,
+		per:    per,
+		total:  integral.New(mode, ic.Places, time.Duration(ic.MaxGap)),
+	}, nil
+}
+
+func (c *integralChannel) input() string { return c.metric }
+func (c *integralChannel) name() string  { return c.output }
+
+func (c *integralChannel) observe(t time.Time, metric string, v float64, unit units.Unit) []Reading {
+	if metric != c.metric {
+		return nil
+	}
+	total := c.total.Add(t, v) / c.per.Seconds()
+	u := c.unit
+	if u == "" {
+		if tu, ok := totalUnits[unit]; ok && c.per == time.Minute {
+			u = string(tu)
+		} else {
+			u = string(unit) + "*" + c.per.String()
+		}
+	}
+	return []Reading{{Sensor: "derived", Metric: c.output, Value: total, Unit: u, Time: t}}
+}
+
+func (c *integralChannel) resetSession() {
+	c.total.Reset()
+}
+
+type derivativeChannel struct {
+	metric string
+	slope  *derivative.Slope
+	per    time.Duration
+	suffix string
+}
+
+func newDerivativeChannel(dc config.DerivativeChannel) (*derivativeChannel, error) {
+	window := time.Duration(dc.Window)
+	if window == 0 {
+		window = 10 * time.Second
+	}
+	slope, err := derivative.NewSlope(window)
+	if err != nil {
+		return nil, fmt.Errorf("derivative %s: %v", dc.Metric, err)
+	}
+	per := time.Duration(dc.Per)
+	if per <= 0 {
+		per = time.Minute
+	}
+	suffix := "/" + per.String()
+	switch per {
+	case time.Second:
+		suffix = "/s"
+	case time.Minute:
+		suffix = "/min"
+	case time.Hour:
+		suffix = "/h"
+	}
+	return &derivativeChannel{metric: dc.Metric, slope: slope, per: per, suffix: suffix}, nil
+}
+
+func (c *derivativeChannel) input() string { return c.metric }
+func (c *derivativeChannel) name() string  { return c.metric + "_rate" }
+
+func (c *derivativeChannel) observe(t time.Time, metric string, v float64, unit units.Unit) []Reading {
+	if metric != c.metric {
+		return nil
+	}
+	perSecond, ok := c.slope.Add(t, v)
+	if !ok {
+		return nil
+	}
+	return []Reading{{Sensor: "derived", Metric: metric + "_rate", Value: perSecond * c.per.Seconds(), Unit: string(unit) + c.suffix, Time: t}}
+}
+
+type spectralChannel struct {
+	metric   string
+	analyzer *spectral.Analyzer
+	every    time.Duration
+	last     time.Time
+	bands    []string
+}
+
+func newSpectralChannel(sc config.SpectralChannel) (*spectralChannel, error) {
+	var bands []spectral.Band
+	if sc.Preset != "" {
+		preset, ok := spectral.Presets[sc.Preset]
+		if !ok {
+			return nil, fmt.Errorf("spectral %s: unknown preset %q", sc.Metric, sc.Preset)
+		}
+		bands = append(bands, preset...)
+	}
+	for _, b := range sc.Bands {
+		bands = append(bands, spectral.Band{Name: b.Name, Low: b.LowHz, High: b.HighHz})
+	}
+
+	rate := sc.RateHz
+	if rate == 0 {
+		rate = 4
+	}
+	a, err := spectral.NewAnalyzer(rate, time.Duration(sc.Window), bands)
+	if err != nil {
+		return nil, fmt.Errorf("spectral %s: %v", sc.Metric, err)
+	}
+
+	every := time.Duration(sc.Every)
+	if every <= 0 {
+		every = 10 * time.Second
+	}
+	ch := &spectralChannel{metric: sc.Metric, analyzer: a, every: every}
+	for _, b := range bands {
+		ch.bands = append(ch.bands, b.Name)
+	}
+	return ch, nil
+}
+
+func (c *spectralChannel) input() string { return c.metric }
+func (c *spectralChannel) name() string  { return c.metric + "_spectral" }
+
+func (c *spectralChannel) observe(t time.Time, metric string, v float64, unit units.Unit) []Reading {
+	if metric != c.metric {
+		return nil
+	}
+	c.analyzer.Add(t, v)
+	if t.Sub(c.last) < c.every {
+		return nil
+	}
+	sum, ok := c.analyzer.Summary()
+	if !ok {
+		return nil
+	}
+	c.last = t
+
+	power := string(unit) + "^2"
+	out := []Reading{
+		{Sensor: "spectral", Metric: metric + "_peak_freq", Value: sum.PeakHz, Unit: string(units.Hertz), Time: t},
+		{Sensor: "spectral", Metric: metric + "_total_power", Value: sum.TotalPower, Unit: power, Time: t},
+	}
+	for _, name := range c.bands {
+		out = append(out, Reading{Sensor: "spectral", Metric: metric + "_" + name + "_power", Value: sum.Bands[name], Unit: power, Time: t})
+	}
+	lf, hasLF := sum.Bands["lf"]
+	hf, hasHF := sum.Bands["hf"]
+	if hasLF && hasHF && hf > 0 { // HRV sympathovagal balance
+		out = append(out, Reading{Sensor: "spectral", Metric: metric + "_lf_hf_ratio", Value: lf / hf, Time: t})
+	}
+	return out
+}
@@ -0,0 +1,178 @@
+package sensorstack
+
+import (
+	"context"
+	"io"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/demelere/sensor-control-modules/internal/config"
+	"github.com/demelere/sensor-control-modules/internal/diskfree"
+)
+
+// fillWarning is how soon the disk may fill at the current write rate before
+// it counts as low, however much space is left.
+const fillWarning = time.Hour
+
+// diskNote records a change in the state of the disk holding sessions.dir:
+// "low" when it needs attention, "critical" when the session file has
+// switched to aggregates only, and "ok" again once there is room.
+type diskNote struct {
+	Annotation string    `json:"annotation"` // "disk"
+	State      string    `json:"state"`
+	Path       string    `json:"path"`
+	FreeMB     float64   `json:"free_mb"`
+	WriteRate  float64   `json:"write_kb_per_s"` // session file writes since the last check
+	FullIn     string    `json:"full_in,omitempty"`
+	Time       time.Time `json:"time"`
+}
+
+// watchDisk checks the free space under sc.Dir every sc.DiskPoll until ctx is
+// done and submits a diskNote for each change of state. It calls
+// aggregateOnly(true) on entering the critical state and aggregateOnly(false)
+// on leaving it. A state is only left once free space is 10% clear of its
+// threshold, so a disk hovering at the limit does not flap.
+func watchDisk(ctx context.Context, sc config.Sessions, written func() uint64, submit func(any), aggregateOnly func(bool)) {
+	interval := time.Duration(sc.DiskPoll)
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	warn, critical := uint64(sc.WarnFreeMB)<<20, uint64(sc.CriticalFreeMB)<<20
+	if warn == 0 {
+		warn = 1024 << 20
+	}
+	if critical == 0 {
+		critical = 200 << 20
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	state := "ok"
+	lastWritten, lastTime := written(), time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		free, ok := diskfree.Available(sc.Dir)
+		if !ok {
+			log.Printf("disk: cannot read free space under %s, not monitoring it", sc.Dir)
+			return
+		}
+		now := time.Now()
+		n := written()
+		rate := float64(n-lastWritten) / now.Sub(lastTime).Seconds() // bytes/s
+		lastWritten, lastTime = n, now
+		var fullIn time.Duration
+		if rate > 0 {
+			fullIn = time.Duration(float64(free) / rate * float64(time.Second))
+		}
+
+		next := "ok"
+		switch {
+		case free < critical:
+			next = "critical"
+		case free < warn, rate > 0 && fullIn < fillWarning:
+			next = "low"
+		}
+		switch {
+		case state == "critical" && next != "critical" && free < critical+critical/10:
+			next = "critical"
+		case state == "low" && next == "ok" && free < warn+warn/10:
+			next = "low"
+		}
+		if next == state {
+			continue
+		}
+		note := diskNote{Annotation: "disk", State: next, Path: sc.Dir, FreeMB: float64(free) / (1 << 20), WriteRate: rate / 1024, Time: now.UTC()}
+		if fullIn > 0 {
+			note.FullIn = fullIn.Round(time.Minute).String()
+		}
+		log.Printf("disk: %s, %.0f MB free under %s", next, note.FreeMB, sc.Dir)
+		if next == "critical" {
+			aggregateOnly(true)
+		} else if state == "critical" {
+			aggregateOnly(false)
+		}
+		submit(note)
+		state = next
+	}
+}
+
+// aggregateReading stands in for a window of readings of one metric in a
+// session file while the disk is critically low.
+type aggregateReading struct {
+	Sensor string    `json:"sensor"`
+	Metric string    `json:"metric"`
+	Unit   string    `json:"unit"`
+	Mean   float64   `json:"mean"`
+	Min    float64   `json:"min"`
+	Max    float64   `json:"max"`
+	Count  int       `json:"count"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+}
+
+// aggregator folds readings into one aggregateReading per sensor and metric
+// over fixed windows.
+type aggregator struct {
+	every time.Duration
+	start time.Time
+	open  map[[2]string]*aggregateReading
+	order [][2]string // keys in the order they first appeared in the window
+}
+
+func newAggregator(every time.Duration) *aggregator {
+	if every <= 0 {
+		every = time.Minute
+	}
+	return &aggregator{every: every, open: map[[2]string]*aggregateReading{}}
+}
+
+// add folds r in and returns the previous window's aggregates when r is the
+// first reading past its end.
+func (a *aggregator) add(r Reading) []aggregateReading {
+	var done []aggregateReading
+	if !a.start.IsZero() && r.Time.Sub(a.start) >= a.every {
+		done = a.flush()
+	}
+	if a.start.IsZero() {
+		a.start = r.Time.Truncate(a.every)
+	}
+	key := [2]string{r.Sensor, r.Metric}
+	agg, ok := a.open[key]
+	if !ok {
+		agg = &aggregateReading{Sensor: r.Sensor, Metric: r.Metric, Unit: r.Unit, Min: r.Value, Max: r.Value, Start: r.Time}
+		a.open[key] = agg
+		a.order = append(a.order, key)
+	}
+	agg.Count++
+	agg.Mean += (r.Value - agg.Mean) / float64(agg.Count)
+	agg.Min, agg.Max = min(agg.Min, r.Value), max(agg.Max, r.Value)
+	agg.End = r.Time
+	return done
+}
+
+// flush returns the open window's aggregates and starts a new window.
+func (a *aggregator) flush() []aggregateReading {
+	done := make([]aggregateReading, 0, len(a.order))
+	for _, key := range a.order {
+		done = append(done, *a.open[key])
+	}
+	a.start, a.open, a.order = time.Time{}, map[[2]string]*aggregateReading{}, nil
+	return done
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n *atomic.Uint64
+}
+
+func (c countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n.Add(uint64(n))
+	return n, err
+}
@@ -0,0 +1,115 @@
+package sensorstack
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/demelere/sensor-control-modules/internal/eventlog"
+	"github.com/demelere/sensor-control-modules/internal/gap"
+	"github.com/demelere/sensor-control-modules/internal/label"
+	"github.com/demelere/sensor-control-modules/internal/validate"
+	"github.com/demelere/sensor-control-modules/pkg/sensor"
+)
+
+// Alert is a recorded event someone should look at.
+type Alert struct {
+	Kind    string    `json:"kind"` // e.g. "gap", "fault", "disk_low"
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// alertFor decides whether v, something the recorder wrote, raises an alert.
+// The MQTT exporter publishes these and the event log keeps them.
+func alertFor(v any) (Alert, bool) {
+	switch v := v.(type) {
+	case gap.Gap:
+		return Alert{"gap", fmt.Sprintf("%s: %d missed polls", v.Sensor, v.Missed), v.End}, true
+	case deviceFault:
+		if v.State == "raised" {
+			return Alert{"fault", fmt.Sprintf("%s: %s", v.Sensor, v.Message), v.Time}, true
+		}
+	case connectionNote:
+		switch v.State {
+		case string(sensor.Disconnected):
+			return Alert{"disconnected", fmt.Sprintf("%s: %s", v.Sensor, v.Error), v.Time}, true
+		case string(sensor.Degraded):
+			return Alert{"degraded", fmt.Sprintf("%s: absent at startup: %s", v.Sensor, v.Error), v.Time}, true
+		}
+	case provisionNote:
+		if v.Error != "" {
+			return Alert{"provisioning", fmt.Sprintf("%s: profile %s: %s", v.Sensor, v.Profile, v.Error), v.Time}, true
+		}
+	case validate.Violation:
+		if v.State == "raised" && v.Kind == "range" {
+			return Alert{"out_of_range", fmt.Sprintf("%s: %s %s, readings dropped", v.Sensor, v.Metric, v.Detail), v.Time}, true
+		}
+	case diskNote:
+		switch v.State {
+		case "low":
+			return Alert{"disk_low", fmt.Sprintf("%s: %.0f MB free", v.Path, v.FreeMB), v.Time}, true
+		case "critical":
+			return Alert{"disk_critical", fmt.Sprintf("%s: %.0f MB free, recording aggregates only", v.Path, v.FreeMB), v.Time}, true
+		}
+	case thermalNote:
+		if v.State == "throttled" {
+			return Alert{"overheating", fmt.Sprintf("%s at %.1f °C, nonessential work paused", v.Source, v.Celsius), v.Time}, true
+		}
+	case identityNote:
+		if v.State == "unconfirmed" {
+			return Alert{"sensor_swap", fmt.Sprintf("%s: probe %s connected in place of %s, readings held until the swap is confirmed", v.Sensor, v.SerialNumber, v.Previous), v.Time}, true
+		}
+	case ConfigAudit:
+		msg := fmt.Sprintf("%s: %d settings differ from profile %s", v.Sensor, len(v.Mismatches), v.Profile)
+		if v.Error != "" {
+			msg = fmt.Sprintf("%s: audit failed: %s", v.Sensor, v.Error)
+		}
+		return Alert{"config_drift", msg, v.Time}, true
+	}
+	return Alert{}, false
+}
+
+// eventEntry turns v into an event log entry. Readings are not events.
+func eventEntry(v any, session string) (eventlog.Entry, bool) {
+	var e eventlog.Entry
+	switch v := v.(type) {
+	case gap.Gap:
+		e = eventlog.Entry{Time: v.Start, End: &v.End, Type: v.Annotation, Sensor: v.Sensor}
+	case label.Label:
+		e = eventlog.Entry{Time: v.Start, End: &v.End, Type: "label"}
+	case deviceFault:
+		e = eventlog.Entry{Time: v.Time, Type: v.Annotation, Sensor: v.Sensor}
+	case connectionNote:
+		e = eventlog.Entry{Time: v.Time, Type: v.Annotation, Sensor: v.Sensor}
+	case provisionNote:
+		e = eventlog.Entry{Time: v.Time, Type: v.Annotation, Sensor: v.Sensor}
+	case ConfigAudit:
+		e = eventlog.Entry{Time: v.Time, Type: v.Annotation, Sensor: v.Sensor}
+	case identityNote:
+		e = eventlog.Entry{Time: v.Time, Type: v.Annotation, Sensor: v.Sensor}
+	case calibrationNote:
+		e = eventlog.Entry{Time: v.Time, Type: v.Annotation, Sensor: v.Sensor}
+	case diskNote:
+		e = eventlog.Entry{Time: v.Time, Type: v.Annotation}
+	case thermalNote:
+		e = eventlog.Entry{Time: v.Time, Type: v.Annotation}
+	case apneaNote:
+		e = eventlog.Entry{Time: v.Start, End: v.End, Type: v.Annotation}
+	case validate.Violation:
+		e = eventlog.Entry{Time: v.Time, Type: v.Annotation, Sensor: v.Sensor}
+	case sessionMark:
+		e = eventlog.Entry{Time: v.Time, Type: v.Annotation}
+	case markerNote:
+		e = eventlog.Entry{Time: v.Time, Type: v.Annotation}
+	case moduleNote:
+		e = eventlog.Entry{Time: v.Time, Type: v.Annotation}
+	default:
+		return e, false
+	}
+	e.Session = session
+	if a, ok := alertFor(v); ok {
+		e.Alert, e.Message = a.Kind, a.Message
+	}
+	e.Event, _ = json.Marshal(v)
+	return e, true
+}
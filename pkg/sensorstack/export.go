@@ -0,0 +1,74 @@
+package sensorstack
+
+import (
+	"log"
+	"time"
+
+	"github.com/demelere/sensor-control-modules/internal/chaos"
+	"github.com/demelere/sensor-control-modules/internal/config"
+	"github.com/demelere/sensor-control-modules/internal/gap"
+	"github.com/demelere/sensor-control-modules/internal/label"
+	"github.com/demelere/sensor-control-modules/internal/mqttexport"
+	"github.com/demelere/sensor-control-modules/internal/validate"
+)
+
+// newMQTTExport connects the MQTT exporter, if configured, and returns the
+// hook the recorder calls with everything it writes.
+func newMQTTExport(cfg *config.Config) (func(any), func(), error) {
+	if cfg.MQTT.Broker == "" {
+		return nil, func() {}, nil
+	}
+	clientID := cfg.MQTT.ClientID
+	if clientID == "" {
+		clientID = "sensorctl-" + cfg.SiteID
+	}
+	e, err := mqttexport.New(mqttexport.Config{
+		Broker:   cfg.MQTT.Broker,
+		ClientID: clientID,
+		Username: cfg.MQTT.Username,
+		Password: cfg.MQTT.Password,
+		Prefix:   cfg.MQTT.TopicPrefix,
+		Mobile:   cfg.MQTT.Mobile,
+	}, cfg.SiteID)
+	if err != nil {
+		return nil, nil, err
+	}
+	log.Printf("exporting to mqtt broker %s", cfg.MQTT.Broker)
+
+	export := func(v any) {
+		if chaos.Enabled && injectExportFault(v) {
+			return
+		}
+		switch v := v.(type) {
+		case Reading:
+			e.Reading(v.Sensor, v.Metric, v.Value, v.Unit, v.Time)
+		case sessionMark:
+			e.Event(v)
+			state := "recording"
+			if v.Annotation == "session_end" {
+				state = "idle"
+			}
+			e.Status(state, v.Session, v.Time)
+		case gap.Gap, deviceFault, connectionNote, provisionNote, ConfigAudit, identityNote, label.Label, markerNote, moduleNote, validate.Violation:
+			e.Event(v)
+		}
+		if a, ok := alertFor(v); ok {
+			e.Alert(a.Kind, a.Message, a.Time)
+		}
+	}
+	return export, e.Close, nil
+}
+
+// injectExportFault plays a slow, failing, or unreachable broker in chaos
+// builds. Stalling holds up only the export queue, which should fill and drop
+// rather than delay recording. It reports whether v was lost.
+func injectExportFault(v any) bool {
+	switch f := chaos.Next("exporter mqtt"); f.Kind {
+	case chaos.Delay, chaos.Disconnect:
+		time.Sleep(f.Delay)
+	case chaos.Error:
+		log.Printf("mqtt export failed: %v: dropped %T", chaos.ErrInjected, v)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package sensorstack
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/demelere/sensor-control-modules/pkg/vaisala"
+)
+
+// deviceFault records an error a sensor reports about itself, once when it
+// is raised and again when it clears. It is distinct from a gap, which is a
+// failure to reach the sensor at all.
+type deviceFault struct {
+	Annotation string    `json:"annotation"` // "device_fault"
+	Sensor     string    `json:"sensor"`
+	Kind       string    `json:"kind"`
+	Message    string    `json:"message"`
+	State      string    `json:"state"` // "raised" or "cleared"
+	Time       time.Time `json:"time"`
+}
+
+// watchFaults polls a sensor's error register every interval until ctx is
+// done and submits a deviceFault for each change. Failed polls are
+// communication errors and leave the known faults as they were.
+func watchFaults(ctx context.Context, sensor string, interval time.Duration, poll func(context.Context) ([]vaisala.Fault, error), submit func(any)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var active []vaisala.Fault
+	for {
+		faults, err := poll(ctx)
+		if err != nil {
+			if ctx.Err() == nil && !errors.Is(err, errSwitchedOff) {
+				log.Printf("sensor %s: error register poll failed: %v", sensor, err)
+			}
+		} else {
+			now := time.Now().UTC()
+			for _, f := range faults {
+				if !hasFault(active, f) {
+					log.Printf("sensor %s reports %s fault: %s", sensor, f.Kind, f.Message)
+					submit(deviceFault{Annotation: "device_fault", Sensor: sensor, Kind: string(f.Kind), Message: f.Message, State: "raised", Time: now})
+				}
+			}
+			for _, f := range active {
+				if !hasFault(faults, f) {
+					log.Printf("sensor %s cleared %s fault: %s", sensor, f.Kind, f.Message)
+					submit(deviceFault{Annotation: "device_fault", Sensor: sensor, Kind: string(f.Kind), Message: f.Message, State: "cleared", Time: now})
+				}
+			}
+			active = faults
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func hasFault(faults []vaisala.Fault, f vaisala.Fault) bool {
+	for _, g := range faults {
+		if g == f {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,213 @@
+package sensorstack
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/demelere/sensor-control-modules/internal/api"
+	"github.com/demelere/sensor-control-modules/internal/device"
+	"github.com/demelere/sensor-control-modules/internal/identity"
+)
+
+// identityNote records the device behind a sensor changing. A probe with
+// another serial number than the sensor is bound to connects "unconfirmed"
+// and its readings are held. An operator mapping it to the sensor through
+// the API records "swapped" and releases them into the sensor's series; the
+// bound probe coming back instead records "restored" and discards them.
+type identityNote struct {
+	Annotation   string    `json:"annotation"` // "identity"
+	Sensor       string    `json:"sensor"`
+	State        string    `json:"state"`
+	Model        string    `json:"model,omitempty"`
+	SerialNumber string    `json:"serial_number"`
+	Previous     string    `json:"previous_serial_number,omitempty"`
+	Released     int       `json:"released,omitempty"`  // held readings recorded on confirmation
+	Discarded    int       `json:"discarded,omitempty"` // held readings from a probe that was never confirmed
+	Note         string    `json:"note,omitempty"`
+	Time         time.Time `json:"time"`
+}
+
+// heldSamples are an unconfirmed probe's readings, released as one item so
+// a long hold cannot overflow the sensor's queue.
+type heldSamples []polledSample
+
+// swaps tracks which device each sensor is connected to against the one it
+// is bound to, and holds readings while they differ.
+type swaps struct {
+	bindings *identity.Set
+	lock     sync.Mutex
+	sensors  map[string]*swapState
+}
+
+type swapState struct {
+	driver  string
+	submit  func(any) // the sensor's queue
+	limit   int       // held readings kept, the oldest dropped beyond it
+	model   string
+	serial  string // of the device last connected
+	holding bool
+	held    []polledSample
+	dropped int
+}
+
+func newSwaps(bindings *identity.Set) *swaps {
+	return &swaps{bindings: bindings, sensors: map[string]*swapState{}}
+}
+
+// add tracks a sensor polled every interval, reporting extra metrics besides
+// its main one.
+func (sw *swaps) add(name, driver string, interval time.Duration, extra int, submit func(any)) {
+	polls := min(int(10*time.Minute/interval), 36000)
+	sw.lock.Lock()
+	defer sw.lock.Unlock()
+	sw.sensors[name] = &swapState{driver: driver, submit: submit, limit: polls * (1 + extra)}
+}
+
+// connected checks the device just opened for a sensor against its binding.
+// The first device seen is bound without asking.
+func (sw *swaps) connected(name string, s *device.Device) (identityNote, bool) {
+	if s.Ident == nil {
+		return identityNote{}, false
+	}
+	model, serial := s.Ident()
+	sw.lock.Lock()
+	defer sw.lock.Unlock()
+	st := sw.sensors[name]
+	if st == nil || serial == "" {
+		return identityNote{}, false
+	}
+	last := st.serial
+	st.model, st.serial = model, serial
+	now := time.Now().UTC()
+
+	b, ok := sw.bindings.Get(name)
+	if !ok {
+		log.Printf("sensor %s: bound to %s %s", name, model, serial)
+		if err := sw.bindings.Bind(name, identity.Binding{Driver: st.driver, Model: model, SerialNumber: serial, Since: now}); err != nil {
+			log.Printf("sensor %s: %v", name, err)
+		}
+		return identityNote{}, false
+	}
+	if serial == b.SerialNumber {
+		if !st.holding {
+			return identityNote{}, false
+		}
+		note := identityNote{Annotation: "identity", Sensor: name, State: "restored", Model: model, SerialNumber: serial, Previous: last, Discarded: st.discard(), Time: now}
+		log.Printf("sensor %s: bound probe %s is back; discarded %d readings from %s", name, serial, note.Discarded, last)
+		return note, true
+	}
+	if st.holding && serial == last {
+		return identityNote{}, false // the same unconfirmed probe, reconnected
+	}
+	note := identityNote{Annotation: "identity", Sensor: name, State: "unconfirmed", Model: model, SerialNumber: serial, Previous: b.SerialNumber, Time: now}
+	if st.holding {
+		note.Discarded = st.discard()
+	}
+	st.holding = true
+	log.Printf("sensor %s: probe %s connected in place of %s; holding its readings until the swap is confirmed", name, serial, b.SerialNumber)
+	return note, true
+}
+
+// discard empties the hold, returning how many readings were in it.
+func (st *swapState) discard() int {
+	n := len(st.held) + st.dropped
+	st.held, st.dropped, st.holding = nil, 0, false
+	return n
+}
+
+// pass queues a poll's samples, or holds them while the sensor's probe is
+// unconfirmed.
+func (sw *swaps) pass(name string, samples ...polledSample) {
+	sw.lock.Lock()
+	defer sw.lock.Unlock()
+	st := sw.sensors[name]
+	if !st.holding {
+		for _, p := range samples {
+			st.submit(p)
+		}
+		return
+	}
+	st.held = append(st.held, samples...)
+	if over := len(st.held) - st.limit; over > 0 {
+		if st.dropped == 0 {
+			log.Printf("sensor %s: swap still unconfirmed, dropping the oldest held readings", name)
+		}
+		st.held = append(st.held[:0], st.held[over:]...)
+		st.dropped += over
+	}
+}
+
+// serial returns the serial number of the device last connected for name.
+func (sw *swaps) serial(name string) string {
+	sw.lock.Lock()
+	defer sw.lock.Unlock()
+	if st := sw.sensors[name]; st != nil {
+		return st.serial
+	}
+	return ""
+}
+
+// info reports the device behind name.
+func (sw *swaps) info(name string) (api.SensorIdentity, error) {
+	sw.lock.Lock()
+	defer sw.lock.Unlock()
+	return sw.infoLocked(name)
+}
+
+func (sw *swaps) infoLocked(name string) (api.SensorIdentity, error) {
+	st, ok := sw.sensors[name]
+	if !ok {
+		return api.SensorIdentity{}, fmt.Errorf("%w %s", api.ErrUnknownSensor, name)
+	}
+	id := api.SensorIdentity{Sensor: name, Model: st.model, Connected: st.serial, State: "unknown", HeldReadings: len(st.held)}
+	if b, ok := sw.bindings.Get(name); ok {
+		since := b.Since
+		id.SerialNumber, id.BoundSince = b.SerialNumber, &since
+		if st.serial == b.SerialNumber {
+			id.State = "confirmed"
+		}
+	}
+	if st.holding {
+		id.State = "unconfirmed"
+	}
+	return id, nil
+}
+
+// confirm binds name to serial, which must be the device connected to it,
+// records the swap, and releases the readings held since it connected.
+func (sw *swaps) confirm(name, serial, note string) (api.SensorIdentity, error) {
+	sw.lock.Lock()
+	defer sw.lock.Unlock()
+	st, ok := sw.sensors[name]
+	if !ok {
+		return api.SensorIdentity{}, fmt.Errorf("%w %s", api.ErrUnknownSensor, name)
+	}
+	b, bound := sw.bindings.Get(name)
+	if bound && b.SerialNumber == serial {
+		return sw.infoLocked(name)
+	}
+	if serial != st.serial {
+		if st.serial == "" {
+			return api.SensorIdentity{}, fmt.Errorf("%w: %s has not reported a serial number", api.ErrIdentityMismatch, name)
+		}
+		return api.SensorIdentity{}, fmt.Errorf("%w: %s is connected to %s", api.ErrIdentityMismatch, name, st.serial)
+	}
+
+	now := time.Now().UTC()
+	err := sw.bindings.Bind(name, identity.Binding{Driver: st.driver, Model: st.model, SerialNumber: serial, Since: now})
+	held := st.held
+	swapped := identityNote{Annotation: "identity", Sensor: name, State: "swapped", Model: st.model, SerialNumber: serial, Previous: b.SerialNumber, Released: len(held), Discarded: st.dropped, Note: note, Time: now}
+	st.held, st.dropped, st.holding = nil, 0, false
+	st.submit(swapped)
+	if len(held) > 0 {
+		st.submit(heldSamples(held))
+	}
+	log.Printf("sensor %s: swap from %s to %s confirmed, releasing %d held readings", name, b.SerialNumber, serial, len(held))
+	id, _ := sw.infoLocked(name)
+	if err != nil {
+		return id, fmt.Errorf("swap recorded for now, but not saved: %w", err)
+	}
+	return id, nil
+}
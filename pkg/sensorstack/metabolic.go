@@ -0,0 +1,103 @@
+package sensorstack
+
+import (
+	"time"
+
+	"github.com/demelere/sensor-control-modules/internal/kalman"
+	"github.com/demelere/sensor-control-modules/internal/metabolic"
+	"github.com/demelere/sensor-control-modules/internal/uncertainty"
+	"github.com/demelere/sensor-control-modules/internal/units"
+)
+
+// co2MaxAge is how old the last CO2 reading may be and still be combined with
+// a flow reading.
+const co2MaxAge = 10 * time.Second
+
+// metabolicChannel derives ve and vco2 from the flow and the expired CO2
+// through the mouthpiece. The two sensors are polled independently, so each
+// flow reading is combined with the latest CO2 one. With publishCI, each
+// value is followed by the 95% confidence bounds its inputs' uncertainties
+// propagate to.
+//
+// energy_expenditure is the Kalman estimate fusing gas exchange with heart
+// rate, where a heart rate sensor is polled too, and is always followed by
+// the filter's 95% bounds. It is published from the first gas exchange
+// reading of a session on.
+type metabolicChannel struct {
+	publishCI bool
+	co2       uncertainty.Quantity
+	co2At     time.Time
+	fused     *kalman.MetabolicEstimator
+	gas       bool // gas exchange has reached fused this session
+}
+
+func newMetabolicChannel(publishCI bool) *metabolicChannel {
+	c := &metabolicChannel{publishCI: publishCI}
+	c.resetSession()
+	return c
+}
+
+func (c *metabolicChannel) resetSession() {
+	c.fused = kalman.NewMetabolicEstimator(kalman.DefaultHRCalibration(), 0)
+	c.gas = false
+}
+
+func (c *metabolicChannel) input() string { return "flow" }
+func (c *metabolicChannel) name() string  { return "metabolic" }
+
+func (c *metabolicChannel) observe(t time.Time, metric string, v float64, unit units.Unit) []Reading {
+	switch metric {
+	case "co2":
+		if unit == units.PPM {
+			c.co2, c.co2At = uncertainty.Measure(metric, v), t
+			c.fused.UpdateCO2(t, v)
+		}
+		return nil
+	case "heart_rate":
+		c.fused.UpdateHeartRate(t, v)
+		if !c.gas {
+			return nil
+		}
+		return c.energy(t)
+	case "flow":
+	default:
+		return nil
+	}
+	perSCFM, err := units.Convert(1, unit, units.SCFM)
+	if err != nil || c.co2At.IsZero() || t.Sub(c.co2At) > co2MaxAge {
+		return nil
+	}
+	flow := uncertainty.Measure(metric, v).Scale(perSCFM)
+	ve := metabolic.VEUncertain(flow)
+	vco2 := metabolic.VCO2Uncertain(ve, c.co2)
+	c.fused.UpdateFlow(t, flow.Value)
+	c.gas = true
+
+	var out []Reading
+	add := func(name string, q uncertainty.Quantity, unit units.Unit) {
+		dv, du := units.Display(q.Value, unit)
+		out = append(out, Reading{Sensor: "derived", Metric: name, Value: dv, Unit: string(du), Time: t})
+		if c.publishCI && q.StdDev > 0 {
+			lo, hi := q.CI95()
+			dlo, _ := units.Display(lo, unit)
+			dhi, _ := units.Display(hi, unit)
+			out = append(out,
+				Reading{Sensor: "derived", Metric: name + "_ci95_lower", Value: dlo, Unit: string(du), Time: t},
+				Reading{Sensor: "derived", Metric: name + "_ci95_upper", Value: dhi, Unit: string(du), Time: t})
+		}
+	}
+	add("ve", ve, units.SLPM)
+	add("vco2", vco2, units.SLPM)
+	return append(out, c.energy(t)...)
+}
+
+// energy publishes the fused estimate of energy_expenditure.
+func (c *metabolicChannel) energy(t time.Time) []Reading {
+	e := c.fused.Estimate()
+	unit := string(units.KcalPerMin)
+	return []Reading{
+		{Sensor: "derived", Metric: "energy_expenditure", Value: e.EE, Unit: unit, Time: t},
+		{Sensor: "derived", Metric: "energy_expenditure_ci95_lower", Value: e.Lower, Unit: unit, Time: t},
+		{Sensor: "derived", Metric: "energy_expenditure_ci95_upper", Value: e.Upper, Unit: unit, Time: t},
+	}
+}
@@ -0,0 +1,63 @@
+package sensorstack
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/demelere/sensor-control-modules/internal/api"
+	"github.com/demelere/sensor-control-modules/internal/toggle"
+)
+
+// errSwitchedOff stands in for a poll skipped because its module is off.
+var errSwitchedOff = errors.New("switched off")
+
+// moduleNote records an operator switching a module off or on, so a session
+// shows why a stream stopped or restarted.
+type moduleNote struct {
+	Annotation string    `json:"annotation"` // "module"
+	Kind       string    `json:"kind"`
+	Name       string    `json:"name"`
+	Enabled    bool      `json:"enabled"`
+	Time       time.Time `json:"time"`
+}
+
+// moduleSwitch backs the modules API. Modules are keyed "<kind> <name>" in
+// the toggle set, the same names startup ordering reports them under.
+type moduleSwitch struct {
+	toggles *toggle.Set
+	known   []api.ModuleInfo
+	submit  func(any)
+}
+
+func (ms *moduleSwitch) list() []api.ModuleInfo {
+	out := make([]api.ModuleInfo, len(ms.known))
+	for i, m := range ms.known {
+		m.Enabled = ms.toggles.Enabled(m.Kind + " " + m.Name)
+		out[i] = m
+	}
+	return out
+}
+
+func (ms *moduleSwitch) set(kind, name string, enabled bool) (api.ModuleInfo, error) {
+	for _, m := range ms.known {
+		if m.Kind != kind || m.Name != name {
+			continue
+		}
+		key := kind + " " + name
+		if ms.toggles.Enabled(key) == enabled {
+			m.Enabled = enabled
+			return m, nil
+		}
+		err := ms.toggles.SetEnabled(key, enabled)
+		log.Printf("%s switched %s", key, map[bool]string{true: "on", false: "off"}[enabled])
+		ms.submit(moduleNote{Annotation: "module", Kind: kind, Name: name, Enabled: enabled, Time: time.Now().UTC()})
+		if err != nil {
+			return m, fmt.Errorf("%s switched for now, but not saved: %w", key, err)
+		}
+		m.Enabled = enabled
+		return m, nil
+	}
+	return api.ModuleInfo{}, fmt.Errorf("%w %s/%s", api.ErrUnknownModule, kind, name)
+}
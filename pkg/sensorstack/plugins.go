@@ -0,0 +1,127 @@
+package sensorstack
+
+import (
+	"log"
+	"time"
+
+	"github.com/demelere/sensor-control-modules/internal/config"
+	"github.com/demelere/sensor-control-modules/internal/pipeline"
+	"github.com/demelere/sensor-control-modules/pkg/exporter"
+)
+
+const maxPluginBackoff = time.Minute
+
+// pluginExport feeds one plugin exporter from a queue of its own, so a plugin
+// that stalls holds up neither recording nor the other exporters. A plugin
+// that exits is restarted, waiting longer after each failure, and what is
+// recorded while it is down is dropped.
+type pluginExport struct {
+	cfg     config.Plugin
+	queue   *pipeline.Dispatcher
+	stream  *pipeline.Stream
+	plugin  *exporter.Plugin // nil while down
+	started time.Time
+	retry   time.Time
+	backoff time.Duration
+	lost    int
+}
+
+// startPlugins starts every configured plugin. A plugin that cannot start at
+// all is a configuration mistake, so it stops the daemon rather than being
+// retried.
+func startPlugins(cfg *config.Config) ([]*pluginExport, error) {
+	var plugins []*pluginExport
+	for _, c := range cfg.Plugins {
+		p, err := exporter.StartPlugin(c.Name, c.Command)
+		if err != nil {
+			closePlugins(plugins)
+			return nil, err
+		}
+		log.Printf("exporting to plugin %s", c.Name)
+		pe := &pluginExport{cfg: c, plugin: p, started: time.Now(), backoff: time.Second}
+		pe.queue = pipeline.New(func(_ string, v any) { pe.send(v) })
+		pe.stream = pe.queue.Stream("plugin "+c.Name, 1, 4096)
+		go pe.queue.Run()
+		plugins = append(plugins, pe)
+	}
+	return plugins, nil
+}
+
+// closePlugins lets each plugin drain its queue and stops it.
+func closePlugins(plugins []*pluginExport) {
+	for _, pe := range plugins {
+		if pe.queue != nil {
+			pe.queue.Close()
+			logDrops(pe.queue)
+		}
+		if pe.lost > 0 {
+			log.Printf("plugin %s: dropped %d records while it was down", pe.cfg.Name, pe.lost)
+		}
+		if pe.plugin != nil {
+			if err := pe.plugin.Close(); err != nil {
+				log.Printf("plugin %s: %v", pe.cfg.Name, err)
+			}
+		}
+	}
+}
+
+// send runs on the plugin's queue only.
+func (pe *pluginExport) send(v any) {
+	m, ok := toMessage(v)
+	if !ok {
+		return
+	}
+	if pe.plugin == nil && !pe.restart() {
+		pe.lost++
+		return
+	}
+	if err := pe.plugin.Send(m); err != nil {
+		pe.plugin.Close()
+		pe.down()
+		pe.lost++
+		log.Printf("%v, restarting in %v", err, time.Until(pe.retry).Round(time.Second))
+	}
+}
+
+func (pe *pluginExport) restart() bool {
+	if time.Now().Before(pe.retry) {
+		return false
+	}
+	p, err := exporter.StartPlugin(pe.cfg.Name, pe.cfg.Command)
+	if err != nil {
+		pe.down()
+		log.Printf("%v, retrying in %v", err, time.Until(pe.retry).Round(time.Second))
+		return false
+	}
+	log.Printf("plugin %s restarted", pe.cfg.Name)
+	pe.plugin, pe.started = p, time.Now()
+	return true
+}
+
+// down schedules the next start. A plugin that ran for a while before failing
+// starts over at the shortest wait.
+func (pe *pluginExport) down() {
+	if !pe.started.IsZero() && time.Since(pe.started) > maxPluginBackoff {
+		pe.backoff = time.Second
+	}
+	pe.plugin, pe.started = nil, time.Time{}
+	pe.retry = time.Now().Add(pe.backoff)
+	pe.backoff = min(2*pe.backoff, maxPluginBackoff)
+}
+
+// toMessage converts what the recorder writes into the plugin protocol.
+// Session bookkeeping without an event log entry is not sent.
+func toMessage(v any) (exporter.Message, bool) {
+	if r, ok := v.(Reading); ok {
+		return exporter.Message{Reading: &exporter.Reading{Sensor: r.Sensor, Metric: r.Metric, Value: r.Value, Unit: r.Unit, Time: r.Time}}, true
+	}
+	e, ok := eventEntry(v, "")
+	if !ok {
+		return exporter.Message{}, false
+	}
+	m := exporter.Message{Event: &exporter.Event{Type: e.Type, Sensor: e.Sensor, Time: e.Time, Data: e.Event}}
+	if a, ok := alertFor(v); ok {
+		m.Alert = &exporter.Alert{Kind: a.Kind, Message: a.Message, Time: a.Time}
+	}
+	return m, true
+}
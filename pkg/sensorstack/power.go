@@ -0,0 +1,107 @@
+package sensorstack
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/demelere/sensor-control-modules/internal/config"
+	"github.com/demelere/sensor-control-modules/internal/power"
+	"github.com/demelere/sensor-control-modules/internal/units"
+)
+
+// openPowerSource opens the supply source the config names.
+func openPowerSource(p config.Power) (power.Source, error) {
+	switch p.Source {
+	case "ina219":
+		bus, address := p.I2CBus, p.I2CAddress
+		if bus == 0 {
+			bus = 1
+		}
+		if address == 0 {
+			address = 0x42
+		}
+		s, err := power.OpenINA219(bus, address)
+		if err != nil {
+			return nil, fmt.Errorf("power: %w", err)
+		}
+		if p.EmptyVoltage > 0 {
+			s.EmptyVoltage = p.EmptyVoltage
+		}
+		if p.FullVoltage > 0 {
+			s.FullVoltage = p.FullVoltage
+		}
+		return s, nil
+	case "nut":
+		return &power.NUT{Addr: p.NUTAddr, UPS: p.UPS}, nil
+	}
+	return nil, fmt.Errorf("power: unknown source %q", p.Source)
+}
+
+// watchPower reads the supply every p.Poll (default 30s) until ctx is done.
+// It submits supply_voltage and battery readings as sensor "power" and a
+// power.Event for each change, and calls shutdown once when the battery has
+// run low. Failed reads are logged and leave the state as it was.
+func watchPower(ctx context.Context, src power.Source, p config.Power, submit func(any), shutdown func()) {
+	interval := time.Duration(p.Poll)
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	monitor := power.Monitor{LowBattery: p.LowBattery}
+	for {
+		st, err := src.Read(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("power: %v", err)
+		} else {
+			now := time.Now().UTC()
+			if st.Voltage > 0 {
+				submit(polledSample{sensor: "power", metric: "supply_voltage", unit: units.Volt, value: st.Voltage, time: now})
+			}
+			if st.Battery >= 0 {
+				submit(polledSample{sensor: "power", metric: "battery", unit: units.Percent, value: st.Battery, time: now})
+			}
+			events, off := monitor.Observe(st, now)
+			for _, e := range events {
+				if e.Battery != nil {
+					log.Printf("power: %s (battery %.0f%%)", e.Event, *e.Battery)
+				} else {
+					log.Printf("power: %s (%.2f V)", e.Event, e.Voltage)
+				}
+				submit(e)
+			}
+			if off {
+				log.Printf("power: battery low, stopping to shut down cleanly")
+				shutdown()
+				return
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// powerOff runs the configured shutdown command once the daemon has stopped
+// after a low battery; with none it leaves the host to its UPS.
+func powerOff(command []string) error {
+	if len(command) == 0 {
+		return nil
+	}
+	log.Printf("power: running %v", command)
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("power: shutdown command failed: %w", err)
+	}
+	return nil
+}
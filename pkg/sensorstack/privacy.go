@@ -0,0 +1,86 @@
+package sensorstack
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/demelere/sensor-control-modules/internal/api"
+	"github.com/demelere/sensor-control-modules/internal/config"
+	"github.com/demelere/sensor-control-modules/internal/erasure"
+	"github.com/demelere/sensor-control-modules/internal/eventlog"
+	"github.com/demelere/sensor-control-modules/internal/privacy"
+	"github.com/demelere/sensor-control-modules/internal/trend"
+)
+
+// newSubject returns what each session records as its subject: the
+// configured one or, in privacy mode, a pseudonym for it. The pseudonyms are
+// returned in privacy mode so subject deletion can forget them.
+func newSubject(cfg *config.Config) (func(time.Time) string, *privacy.Pseudonyms, error) {
+	if !cfg.Privacy.Enabled {
+		return func(time.Time) string { return cfg.Subject }, nil, nil
+	}
+	p, err := privacy.Open(cfg.Privacy.KeyMap, time.Duration(cfg.Privacy.Rotate))
+	if err != nil {
+		return nil, nil, err
+	}
+	if cfg.Subject == "" {
+		return func(time.Time) string { return "" }, p, nil
+	}
+	return func(now time.Time) string {
+		name, err := p.For(cfg.Subject, now)
+		if err != nil {
+			log.Printf("privacy: %v; recording the session without a subject", err)
+			return ""
+		}
+		return name
+	}, p, nil
+}
+
+// eraseSubject deletes what the rig has stored about subject. The subject
+// the rig is recording is refused: its open session would outlive the
+// deletion.
+func eraseSubject(cfg *config.Config, key []byte, events *eventlog.Log, history *trend.History, pseudonyms *privacy.Pseudonyms) func(string) (erasure.Report, error) {
+	return func(subject string) (erasure.Report, error) {
+		if subject == cfg.Subject {
+			return erasure.Report{}, fmt.Errorf("%w: %s is the configured subject; change it and restart first", api.ErrSubjectRecording, subject)
+		}
+		st := erasure.Stores{SessionDir: cfg.Sessions.Dir, Key: key, Protocols: cfg.Protocol.Results, Events: events, History: history, Pseudonyms: pseudonyms}
+		if st.Pseudonyms == nil {
+			// privacy mode is off now, but sessions recorded while it was on
+			// are still under pseudonyms
+			p, err := privacy.Open(cfg.Privacy.KeyMap, 0)
+			if err != nil {
+				return erasure.Report{}, err
+			}
+			st.Pseudonyms = p
+		}
+		rep, err := erasure.Delete(subject, st)
+		if err != nil {
+			return rep, err
+		}
+		if cfg.MQTT.Broker != "" {
+			rep.Elsewhere = append(rep.Elsewhere, "mqtt "+cfg.Redacted().MQTT.Broker)
+		}
+		for _, pc := range cfg.Plugins {
+			rep.Elsewhere = append(rep.Elsewhere, "exporter "+pc.Name)
+		}
+		log.Printf("erased subject: %d sessions, %d files, %d events, %d session summaries, %d pseudonyms, %d skipped",
+			len(rep.Sessions), len(rep.Files), rep.Events, rep.Summaries, len(rep.Pseudonyms), len(rep.Skipped))
+		return rep, nil
+	}
+}
+
+// scrub strips device MAC addresses, e.g. a Polar strap's in a BLE error,
+// from the free text of v.
+func scrub(v any) any {
+	switch v := v.(type) {
+	case connectionNote:
+		v.Error = privacy.StripMACs(v.Error)
+		return v
+	case deviceFault:
+		v.Message = privacy.StripMACs(v.Message)
+		return v
+	}
+	return v
+}
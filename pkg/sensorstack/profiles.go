@@ -0,0 +1,139 @@
+package sensorstack
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/demelere/sensor-control-modules/internal/config"
+	"github.com/demelere/sensor-control-modules/internal/device"
+	"github.com/demelere/sensor-control-modules/internal/provision"
+)
+
+// provisionNote records a profile being applied to a probe seen for the
+// first time; Error is set if the probe did not accept it.
+type provisionNote struct {
+	Annotation   string    `json:"annotation"` // "provisioned"
+	Sensor       string    `json:"sensor"`
+	Profile      string    `json:"profile"`
+	Model        string    `json:"model,omitempty"`
+	SerialNumber string    `json:"serial_number"`
+	Error        string    `json:"error,omitempty"`
+	Time         time.Time `json:"time"`
+}
+
+// ConfigAudit reports device settings that no longer match the sensor's
+// profile, so data recorded in the wrong format or at the wrong interval is
+// flagged instead of passing silently.
+type ConfigAudit struct {
+	Annotation string               `json:"annotation"` // "config_audit"
+	Sensor     string               `json:"sensor"`
+	Profile    string               `json:"profile"`
+	Mismatches []provision.Mismatch `json:"mismatches,omitempty"`
+	Error      string               `json:"error,omitempty"`
+	Time       time.Time            `json:"time"`
+}
+
+// onConnect provisions and then audits a sensor each time it is opened or
+// reopened, returning the annotations to record.
+func onConnect(ctx context.Context, cfg *config.Config, ledger *provision.Ledger, sc config.Sensor, s *device.Device) []any {
+	var notes []any
+	if note, ok := applyProfile(ctx, cfg, ledger, sc, s); ok {
+		notes = append(notes, note)
+	}
+	if sc.Filtering != 0 && s.SetFiltering != nil {
+		if err := s.SetFiltering(ctx, sc.Filtering); err != nil {
+			log.Printf("sensor %s: %v", sc.Name, err)
+		}
+	}
+	if audit, ok := auditProfile(ctx, cfg, sc, s); ok {
+		notes = append(notes, audit)
+	}
+	return notes
+}
+
+// auditProfile reads back the settings in the sensor's profile and reports
+// true only when something is wrong. The returned audit names the profile
+// whenever one applied.
+func auditProfile(ctx context.Context, cfg *config.Config, sc config.Sensor, s *device.Device) (ConfigAudit, bool) {
+	if s.ReadSettings == nil || s.Ident == nil || len(cfg.Profiles) == 0 {
+		return ConfigAudit{}, false
+	}
+	model, _ := s.Ident()
+	p, ok := provision.MatchProfile(cfg.Profiles, sc.Driver, model, sc.Profile)
+	if !ok || len(p.Settings) == 0 {
+		return ConfigAudit{}, false
+	}
+	names := make([]string, 0, len(p.Settings))
+	for name := range p.Settings {
+		names = append(names, name)
+	}
+
+	audit := ConfigAudit{Annotation: "config_audit", Sensor: sc.Name, Profile: p.Name}
+	got, err := s.ReadSettings(ctx, names)
+	audit.Time = time.Now().UTC()
+	if err != nil {
+		log.Printf("sensor %s: config audit failed: %v", sc.Name, err)
+		audit.Error = err.Error()
+		return audit, true
+	}
+	if audit.Mismatches = provision.Audit(p.Settings, got); len(audit.Mismatches) == 0 {
+		return audit, false
+	}
+	for _, m := range audit.Mismatches {
+		log.Printf("sensor %s: %v", sc.Name, m)
+	}
+	return audit, true
+}
+
+// applyProfile provisions a freshly connected sensor with its profile unless
+// the ledger shows this serial number already has it. A failed apply is not
+// recorded, so it is retried on the next connection.
+func applyProfile(ctx context.Context, cfg *config.Config, ledger *provision.Ledger, sc config.Sensor, s *device.Device) (provisionNote, bool) {
+	if ledger == nil || s.Apply == nil || s.Ident == nil {
+		return provisionNote{}, false
+	}
+	model, serial := s.Ident()
+	if serial == "" {
+		log.Printf("sensor %s: no serial number reported, skipping provisioning", sc.Name)
+		return provisionNote{}, false
+	}
+	p, ok := provision.MatchProfile(cfg.Profiles, sc.Driver, model, sc.Profile)
+	if !ok || ledger.Has(sc.Driver, serial, p.Name) {
+		return provisionNote{}, false
+	}
+
+	now := time.Now().UTC()
+	note := provisionNote{Annotation: "provisioned", Sensor: sc.Name, Profile: p.Name, Model: model, SerialNumber: serial, Time: now}
+	if err := s.Apply(ctx, p.Settings); err != nil {
+		log.Printf("sensor %s: failed to apply profile %s to %s: %v", sc.Name, p.Name, serial, err)
+		note.Error = err.Error()
+		return note, true
+	}
+	log.Printf("sensor %s: applied profile %s to new probe %s", sc.Name, p.Name, serial)
+	if err := ledger.Record(sc.Driver, serial, p.Name, now); err != nil {
+		log.Printf("sensor %s: %v", sc.Name, err)
+	}
+	return note, true
+}
+
+// Audit opens sc's sensor, compares the settings in its profile with the
+// device's, and closes it again. It reports true when something is wrong: a
+// setting differs, or reading them back failed (Error). Profile is empty when
+// no profile applies.
+func Audit(ctx context.Context, cfg *Config, sc Sensor) (ConfigAudit, bool, error) {
+	if _, ok := device.Drivers[sc.Driver]; !ok {
+		return ConfigAudit{}, false, fmt.Errorf("driver %q is not supported", sc.Driver)
+	}
+	s, err := device.New(sc)
+	if err != nil {
+		return ConfigAudit{}, false, err
+	}
+	if err := s.Open(); err != nil {
+		return ConfigAudit{}, false, err
+	}
+	defer s.Close()
+	audit, bad := auditProfile(ctx, cfg, sc, s)
+	return audit, bad, nil
+}
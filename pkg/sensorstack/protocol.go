@@ -0,0 +1,201 @@
+package sensorstack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/demelere/sensor-control-modules/internal/atrest"
+	"github.com/demelere/sensor-control-modules/internal/audio"
+	"github.com/demelere/sensor-control-modules/internal/config"
+	"github.com/demelere/sensor-control-modules/internal/protocol"
+	"github.com/demelere/sensor-control-modules/internal/threshold"
+	"github.com/demelere/sensor-control-modules/internal/units"
+)
+
+// protocolRuns runs the configured protocol with each session. Readings are
+// summarised as <sensor>.<metric> against the stage they arrive in. While a
+// ramp stage runs, the derived ve and vco2 and any heart_rate feed a threshold
+// estimator, and each threshold it finds is marked in the session.
+type protocolRuns struct {
+	proto   protocol.Protocol
+	results string
+	key     []byte        // encrypts result files like the sessions, nil when they are not
+	player  *audio.Player // plays each stage's cue, nil without audio
+	mark    func(session, label string, at time.Time)
+
+	lock   sync.Mutex
+	runner *protocol.Runner // the open session's, nil when none
+	thr    *threshold.Estimator
+	ramp   bool    // a ramp stage is running
+	ve, hr float64 // latest during the ramp, ve in SLPM
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newProtocolRuns(cfg *config.Config, key []byte, player *audio.Player) (*protocolRuns, error) {
+	if cfg.Protocol.File == "" {
+		return nil, nil
+	}
+	p, err := protocol.LoadProtocol(cfg.Protocol.File)
+	if err != nil {
+		return nil, fmt.Errorf("protocol: %w", err)
+	}
+	log.Printf("running protocol %s (%d stages) with each session", p.Name, len(p.Stages))
+	return &protocolRuns{proto: *p, results: cfg.Protocol.Results, key: key, player: player}, nil
+}
+
+// start runs the protocol for session, whose file is named stem.
+func (pr *protocolRuns) start(session, stem string) {
+	runner, err := protocol.NewRunner(pr.proto)
+	if err != nil { // validated when loaded
+		log.Printf("protocol: %v", err)
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	thr := threshold.NewEstimator(func(label string, at time.Time) {
+		runner.Mark(label)
+		if ctx.Err() == nil {
+			pr.mark(session, label, at.UTC())
+		}
+	})
+	runner.OnStage(func(s protocol.Stage) {
+		for _, label := range s.Markers {
+			if ctx.Err() == nil {
+				pr.mark(session, label, time.Now().UTC())
+			}
+		}
+	})
+	runner.OnStage(func(s protocol.Stage) {
+		pr.lock.Lock()
+		defer pr.lock.Unlock()
+		if pr.runner != runner {
+			return
+		}
+		if s.Ramp && !pr.ramp {
+			thr.Reset()
+			pr.ve, pr.hr = 0, 0
+		}
+		pr.ramp = s.Ramp
+	})
+	if pr.player != nil {
+		runner.OnStage(pr.player.StageCue)
+	}
+	done := make(chan struct{})
+	pr.lock.Lock()
+	pr.runner, pr.thr, pr.ramp, pr.cancel, pr.done = runner, thr, false, cancel, done
+	pr.lock.Unlock()
+
+	go func() {
+		defer close(done)
+		defer thr.Close()
+		res, err := runner.Run(ctx)
+		pr.lock.Lock()
+		if pr.runner == runner {
+			pr.ramp = false
+		}
+		pr.lock.Unlock()
+		if err == nil {
+			log.Printf("session %s: protocol %s finished", session, pr.proto.Name)
+		}
+		if pr.results == "" {
+			return
+		}
+		path, err := pr.write(stem, res)
+		if err != nil {
+			log.Printf("session %s: %v", session, err)
+			return
+		}
+		log.Printf("session %s: protocol result written to %s", session, path)
+	}()
+}
+
+// stop ends the open session's run, if it is still going, and waits for its
+// result to be written.
+func (pr *protocolRuns) stop() {
+	pr.lock.Lock()
+	cancel, done := pr.cancel, pr.done
+	pr.runner, pr.thr, pr.ramp, pr.cancel, pr.done = nil, nil, false, nil, nil
+	pr.lock.Unlock()
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+}
+
+func (pr *protocolRuns) record(r Reading) {
+	pr.lock.Lock()
+	runner, thr := pr.runner, pr.thr
+	var sample *threshold.Sample
+	if pr.ramp {
+		sample = pr.rampSample(r)
+	}
+	pr.lock.Unlock()
+	if runner != nil {
+		runner.Record(r.Sensor+"."+r.Metric, r.Value)
+	}
+	if sample != nil {
+		thr.Add(*sample)
+	}
+}
+
+// rampSample keeps the latest ve and heart_rate during a ramp and makes a
+// threshold sample of each vco2 reading that follows them.
+func (pr *protocolRuns) rampSample(r Reading) *threshold.Sample {
+	switch {
+	case r.Metric == "heart_rate":
+		pr.hr = r.Value
+	case r.Sensor == "derived" && (r.Metric == "ve" || r.Metric == "vco2"):
+		v, err := units.Convert(r.Value, units.Unit(r.Unit), units.SLPM)
+		if err != nil {
+			return nil
+		}
+		if r.Metric == "ve" {
+			pr.ve = v
+		} else if pr.ve > 0 {
+			return &threshold.Sample{Time: r.Time, VE: pr.ve, VCO2: v, HR: pr.hr}
+		}
+	}
+	return nil
+}
+
+// write stores a run's result under its session's name, encrypted if the
+// sessions are.
+func (pr *protocolRuns) write(stem string, res *protocol.Result) (string, error) {
+	if pr.key == nil {
+		path := filepath.Join(pr.results, stem+protocol.ResultSuffix)
+		if err := os.MkdirAll(pr.results, 0o755); err != nil {
+			return "", fmt.Errorf("failed to write protocol result: %w", err)
+		}
+		return path, res.WriteFile(path)
+	}
+	path := filepath.Join(pr.results, stem+protocol.ResultSuffix+atrest.Suffix)
+	data, err := json.MarshalIndent(res, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode protocol result: %v", err)
+	}
+	if err := os.MkdirAll(pr.results, 0o755); err != nil {
+		return "", fmt.Errorf("failed to write protocol result: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return "", fmt.Errorf("failed to write protocol result: %w", err)
+	}
+	defer f.Close()
+	w, err := atrest.NewWriter(f, pr.key)
+	if err == nil {
+		_, err = w.Write(data)
+	}
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to write protocol result: %w", err)
+	}
+	return path, nil
+}
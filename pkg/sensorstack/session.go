@@ -0,0 +1,331 @@
+package sensorstack
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/demelere/sensor-control-modules/internal/api"
+	"github.com/demelere/sensor-control-modules/internal/atrest"
+	"github.com/demelere/sensor-control-modules/internal/config"
+	"github.com/demelere/sensor-control-modules/internal/eventlog"
+	"github.com/demelere/sensor-control-modules/internal/integrity"
+	"github.com/demelere/sensor-control-modules/internal/timesource"
+	"github.com/demelere/sensor-control-modules/internal/trend"
+	"github.com/demelere/sensor-control-modules/internal/version"
+)
+
+// sessionMark opens and closes every session stream, recording the clock's
+// state at both ends so multi-rig datasets can be aligned later.
+type sessionMark struct {
+	Annotation string            `json:"annotation"`
+	Session    string            `json:"session"`
+	SiteID     string            `json:"site_id,omitempty"`
+	Subject    string            `json:"subject,omitempty"` // a pseudonym in privacy mode
+	Version    string            `json:"version"`
+	Time       time.Time         `json:"time"`
+	Clock      timesource.Status `json:"clock"`
+}
+
+type markerNote struct {
+	Annotation string    `json:"annotation"`
+	Session    string    `json:"session"`
+	Label      string    `json:"label"`
+	Time       time.Time `json:"time"`
+	Source     string    `json:"source,omitempty"` // leader that issued it if synced, or "protocol"
+}
+
+func newSessionID(t time.Time) string {
+	return "session-" + t.UTC().Format("20060102T150405.000Z")
+}
+
+// recorder owns the daemon's output. Everything goes to the stack's Output and
+// hooks; while a session is open it also goes to that session's file, if
+// sessions.dir is set.
+type recorder struct {
+	cfg     *config.Config
+	source  timesource.Source
+	lock    sync.Mutex
+	stdout  *json.Encoder // nil without an Output
+	file    *os.File
+	sealer  *atrest.Writer // encrypts the session file when sessions.encryption_key is set
+	fenc    *json.Encoder
+	key     []byte
+	subject func(time.Time) string
+	subj    string        // the open session's subject
+	export  func(any)     // exporters, nil when none are configured
+	events  *eventlog.Log // alerts and annotations kept for the events API, nil when off
+	hooks   Hooks
+	onStart func()        // called as each session opens, before session_start is written
+	id      string        // open session, empty when none
+	written atomic.Uint64 // bytes written to session files
+	agg     *aggregator   // set while the disk is critically low, so files get aggregates only
+	history *trend.History
+	stats   *trend.Session // the open session's, nil when none
+	proto   *protocolRuns  // nil without a protocol
+}
+
+func newRecorder(cfg *config.Config, source timesource.Source, out io.Writer, export func(any), events *eventlog.Log, hooks Hooks) *recorder {
+	r := &recorder{cfg: cfg, source: source, export: export, events: events, hooks: hooks}
+	if out != nil {
+		r.stdout = json.NewEncoder(out)
+	}
+	return r
+}
+
+func (r *recorder) write(vs ...any) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.writeLocked(vs...)
+}
+
+func (r *recorder) writeLocked(vs ...any) {
+	for _, v := range vs {
+		if r.cfg.Privacy.Enabled {
+			v = scrub(v)
+		}
+		if r.stdout != nil {
+			r.stdout.Encode(v)
+		}
+		if rd, ok := v.(Reading); ok && r.stats != nil {
+			r.stats.Add(rd.Sensor, rd.Metric, rd.Unit, rd.Value)
+		}
+		if rd, ok := v.(Reading); ok && r.proto != nil {
+			r.proto.record(rd)
+		}
+		if rd, ok := v.(Reading); ok && r.fenc != nil && r.agg != nil {
+			for _, a := range r.agg.add(rd) {
+				r.fenc.Encode(a)
+			}
+		} else if r.fenc != nil {
+			r.fenc.Encode(v)
+		}
+		if r.export != nil {
+			r.export(v)
+		}
+		if r.events != nil {
+			if e, ok := eventEntry(v, r.id); ok {
+				if err := r.events.Append(e); err != nil {
+					log.Printf("%v", err)
+				}
+			}
+		}
+		r.hooks.call(v)
+	}
+}
+
+// session returns the open session's ID, or "" between sessions.
+func (r *recorder) session() string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.id
+}
+
+// start opens session id, closing any session still open.
+func (r *recorder) start(id string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.id != "" {
+		r.stopLocked()
+	}
+	clock, err := timesource.Probe(r.source)
+	if err != nil {
+		log.Printf("session %s: %v", id, err)
+	}
+	if r.cfg.Sessions.Dir != "" {
+		f, err := openSession(r.cfg.Sessions.Dir, r.cfg.SiteID, id, r.key != nil)
+		if err != nil {
+			return err
+		}
+		var w io.Writer = countingWriter{f, &r.written}
+		if r.key != nil {
+			if r.sealer, err = atrest.NewWriter(w, r.key); err != nil {
+				f.Close()
+				return fmt.Errorf("failed to encrypt session file: %w", err)
+			}
+			w = r.sealer
+		}
+		r.file, r.fenc = f, json.NewEncoder(w)
+	}
+	r.id = id
+	now := time.Now().UTC()
+	if r.subject != nil {
+		r.subj = r.subject(now)
+	}
+	if r.history != nil {
+		r.stats = trend.NewSession(id, r.cfg.SiteID, r.subj, now)
+	}
+	if r.onStart != nil {
+		r.onStart()
+	}
+	r.writeLocked(sessionMark{Annotation: "session_start", Session: id, SiteID: r.cfg.SiteID, Subject: r.subj, Version: version.Version, Time: now, Clock: clock})
+	if r.proto != nil {
+		r.proto.start(id, sessionStem(r.cfg.SiteID, id))
+	}
+	return nil
+}
+
+func (r *recorder) stop() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.stopLocked()
+}
+
+func (r *recorder) stopLocked() {
+	if r.id == "" {
+		return
+	}
+	if r.proto != nil {
+		r.proto.stop()
+	}
+	r.flushAggregates()
+	clock, _ := timesource.Probe(r.source)
+	now := time.Now().UTC()
+	r.writeLocked(sessionMark{Annotation: "session_end", Session: r.id, SiteID: r.cfg.SiteID, Subject: r.subj, Version: version.Version, Time: now, Clock: clock})
+	if r.stats != nil {
+		if s := r.stats.Summary(); len(s.Metrics) > 0 {
+			s.End = now
+			if err := r.history.Append(s); err != nil {
+				log.Printf("session %s: %v", r.id, err)
+			}
+		}
+		r.stats = nil
+	}
+	if r.sealer != nil {
+		if err := r.sealer.Close(); err != nil {
+			log.Printf("failed to finish encrypted session %s: %v", r.file.Name(), err)
+		}
+	}
+	if r.file != nil {
+		closeSession(r.file, r.cfg.Sessions)
+		r.file, r.sealer, r.fenc = nil, nil, nil
+	}
+	r.id = ""
+}
+
+// aggregateOnly switches session files between every reading and aggregates
+// of them over every. Readings still go to stdout and the exporters in full.
+func (r *recorder) aggregateOnly(on bool, every time.Duration) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	switch {
+	case on && r.agg == nil:
+		r.agg = newAggregator(every)
+	case !on && r.agg != nil:
+		r.flushAggregates()
+		r.agg = nil
+	}
+}
+
+// flushAggregates writes out the window being aggregated, if any.
+func (r *recorder) flushAggregates() {
+	if r.agg == nil {
+		return
+	}
+	for _, a := range r.agg.flush() {
+		if r.fenc != nil {
+			r.fenc.Encode(a)
+		}
+	}
+}
+
+// trends compares session id, or the open one for "current", with up to
+// limit of the sessions recorded before it for the same subject.
+func (r *recorder) trends(id string, limit int) (trend.Comparison, error) {
+	r.lock.Lock()
+	var cur trend.Summary
+	open := r.stats != nil && (id == "current" || id == r.id)
+	if open {
+		cur = r.stats.Summary()
+	}
+	r.lock.Unlock()
+	if !open {
+		var ok bool
+		if cur, ok = r.history.Get(id); !ok {
+			if id == "current" {
+				return trend.Comparison{}, fmt.Errorf("%w: no session is being recorded", api.ErrUnknownSession)
+			}
+			return trend.Comparison{}, fmt.Errorf("%w %s", api.ErrUnknownSession, id)
+		}
+	}
+	return trend.Compare(cur, r.history.Before(cur, limit)), nil
+}
+
+// markIn records a protocol marker against session if it is still open. It
+// does not wait for the recorder, so a stage starting as the session stops
+// cannot hold up the stop.
+func (r *recorder) markIn(session, label string, at time.Time) {
+	go func() {
+		r.lock.Lock()
+		defer r.lock.Unlock()
+		if r.id == session {
+			r.writeLocked(markerNote{Annotation: "marker", Session: session, Label: label, Time: at, Source: "protocol"})
+		}
+	}()
+}
+
+// mark records a marker against the open session.
+func (r *recorder) mark(label, source string, at time.Time) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.id == "" {
+		return fmt.Errorf("no session is being recorded")
+	}
+	r.writeLocked(markerNote{Annotation: "marker", Session: r.id, Label: label, Time: at.UTC(), Source: source})
+	return nil
+}
+
+// sessionStem is a session's file name without its extensions.
+func sessionStem(siteID, id string) string {
+	if siteID == "" {
+		return id
+	}
+	return siteID + "-" + id
+}
+
+func openSession(dir, siteID, id string, encrypted bool) (*os.File, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create session dir: %w", err)
+	}
+	name := sessionStem(siteID, id) + ".jsonl"
+	if encrypted {
+		name += atrest.Suffix
+	}
+	f, err := os.OpenFile(filepath.Join(dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session file: %w", err)
+	}
+	log.Printf("recording session to %s", f.Name())
+	return f, nil
+}
+
+// closeSession closes the session file and seals it for later verification.
+func closeSession(f *os.File, sc config.Sessions) {
+	if err := f.Close(); err != nil {
+		log.Printf("failed to close session %s: %v", f.Name(), err)
+		return
+	}
+	var key ed25519.PrivateKey
+	if sc.SigningKey != "" {
+		k, err := integrity.LoadPrivateKey(sc.SigningKey)
+		if err != nil {
+			log.Printf("session %s left unsigned: %v", f.Name(), err)
+		} else {
+			key = k
+		}
+	}
+	digest, err := integrity.Seal(f.Name(), key)
+	if err != nil {
+		log.Printf("failed to seal session %s: %v", f.Name(), err)
+		return
+	}
+	log.Printf("session %s sealed, sha256 %s", f.Name(), digest)
+}
@@ -0,0 +1,54 @@
+package sensorstack
+
+import (
+	"strings"
+
+	"github.com/demelere/sensor-control-modules/internal/config"
+	"github.com/demelere/sensor-control-modules/internal/filter"
+)
+
+// smoothing keeps a smoother per metric of every sensor configured with one.
+// Its caller serialises access.
+type smoothing struct {
+	methods map[string]config.Smoothing // by sensor
+	series  map[string]filter.Smoother  // by "<sensor> <metric>"
+}
+
+func newSmoothing(sensors []config.Sensor) *smoothing {
+	sm := &smoothing{methods: map[string]config.Smoothing{}, series: map[string]filter.Smoother{}}
+	for _, sc := range sensors {
+		if sc.Smoothing.Method != "" {
+			sm.methods[sc.Name] = sc.Smoothing
+		}
+	}
+	return sm
+}
+
+// observe returns the smoothed value of the sensor's metric after v, and
+// false for a sensor without smoothing.
+func (sm *smoothing) observe(sensor, metric string, v float64) (float64, bool) {
+	m, ok := sm.methods[sensor]
+	if !ok {
+		return 0, false
+	}
+	key := sensor + " " + metric
+	s, ok := sm.series[key]
+	if !ok {
+		var err error
+		if s, err = filter.NewSmoother(m.Method, m.Window, m.Alpha); err != nil {
+			return 0, false // config validation has already refused it
+		}
+		sm.series[key] = s
+	}
+	return s.Apply(v), true
+}
+
+// reset starts the sensor's series afresh, e.g. after a reconnect that may
+// have brought a different probe.
+func (sm *smoothing) reset(sensor string) {
+	for key, s := range sm.series {
+		if strings.HasPrefix(key, sensor+" ") {
+			s.Reset()
+		}
+	}
+}
@@ -0,0 +1,1054 @@
+// Package sensorstack is everything `sensorctl run` does, for embedding in
+// another Go program: it opens the configured sensors, polls them through the
+// processing pipeline, records sessions, and runs the exporters and the REST
+// API.
+//
+//	cfg, err := sensorstack.LoadConfig("rig.yaml")
+//	if err != nil {
+//		return err
+//	}
+//	stack := &sensorstack.Stack{Config: cfg, Hooks: sensorstack.Hooks{
+//		Reading: func(r sensorstack.Reading) { dashboard.Update(r) },
+//	}}
+//	return stack.Run(ctx)
+//
+// The stack logs through the standard log package.
+package sensorstack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/demelere/sensor-control-modules/internal/adaptive"
+	"github.com/demelere/sensor-control-modules/internal/api"
+	"github.com/demelere/sensor-control-modules/internal/atrest"
+	"github.com/demelere/sensor-control-modules/internal/audio"
+	"github.com/demelere/sensor-control-modules/internal/config"
+	"github.com/demelere/sensor-control-modules/internal/correction"
+	"github.com/demelere/sensor-control-modules/internal/device"
+	"github.com/demelere/sensor-control-modules/internal/eventlog"
+	"github.com/demelere/sensor-control-modules/internal/gap"
+	"github.com/demelere/sensor-control-modules/internal/identity"
+	"github.com/demelere/sensor-control-modules/internal/label"
+	"github.com/demelere/sensor-control-modules/internal/latest"
+	"github.com/demelere/sensor-control-modules/internal/logging"
+	"github.com/demelere/sensor-control-modules/internal/pipeline"
+	"github.com/demelere/sensor-control-modules/internal/power"
+	"github.com/demelere/sensor-control-modules/internal/provision"
+	"github.com/demelere/sensor-control-modules/internal/reconnect"
+	"github.com/demelere/sensor-control-modules/internal/rigsync"
+	"github.com/demelere/sensor-control-modules/internal/serialio"
+	"github.com/demelere/sensor-control-modules/internal/startorder"
+	"github.com/demelere/sensor-control-modules/internal/timesource"
+	"github.com/demelere/sensor-control-modules/internal/toggle"
+	"github.com/demelere/sensor-control-modules/internal/trend"
+	"github.com/demelere/sensor-control-modules/internal/uncertainty"
+	"github.com/demelere/sensor-control-modules/internal/units"
+	"github.com/demelere/sensor-control-modules/internal/validate"
+	"github.com/demelere/sensor-control-modules/pkg/sensor"
+	"github.com/demelere/sensor-control-modules/pkg/vaisala"
+)
+
+// Config is the rig configuration: sensors, sessions, exporters, the API,
+// and everything else sensorctl reads from its -config file.
+type (
+	Config = config.Config
+	Sensor = config.Sensor
+)
+
+// LoadConfig reads the embedded defaults overlaid with the file at path (JSON,
+// YAML, or TOML), or just the defaults when path is empty.
+func LoadConfig(path string) (*Config, error) {
+	return config.Load(path)
+}
+
+// Reading is one published value, in display units.
+type Reading struct {
+	Sensor string    `json:"sensor"`
+	Metric string    `json:"metric"`
+	Value  float64   `json:"value"`
+	Unit   string    `json:"unit"`
+	Time   time.Time `json:"time"`
+}
+
+// Hooks let a program embedding the stack follow what it records. Every hook
+// is optional. They are called on the stack's own goroutines, in recording
+// order, and hold up recording while they run, so they must return quickly.
+type Hooks struct {
+	Reading     func(Reading)                         // every reading: raw, smoothed, and derived
+	Record      func(any)                             // everything else recorded: session marks, gaps, faults, labels, notes
+	Alert       func(Alert)                           // records someone should look at, as the MQTT exporter publishes them
+	SensorState func(name string, state sensor.State) // connection changes
+	Started     func()                                // once every module has started
+}
+
+func (h Hooks) call(v any) {
+	if r, ok := v.(Reading); ok {
+		if h.Reading != nil {
+			h.Reading(r)
+		}
+	} else if h.Record != nil {
+		h.Record(v)
+	}
+	if a, ok := alertFor(v); ok && h.Alert != nil {
+		h.Alert(a)
+	}
+}
+
+// Stack is the whole daemon: the sensors and their pollers, the processing
+// pipeline, sessions, exporters, and the API server, all as Config says.
+type Stack struct {
+	Config *Config
+	Hooks  Hooks
+	Output io.Writer       // everything recorded as JSON lines, as sensorctl run prints it; nil for none
+	Logs   *logging.Stream // entries for the API's live log stream, nil to serve none
+
+	mu   sync.Mutex
+	mark func(label string) error // while running
+}
+
+// Run runs the stack for cfg, without hooks, until ctx is done.
+func Run(ctx context.Context, cfg *Config) error {
+	return (&Stack{Config: cfg}).Run(ctx)
+}
+
+// Mark records a marker in the open session, and announces it to followers
+// on a leader rig. It fails while no session is being recorded.
+func (st *Stack) Mark(label string) error {
+	st.mu.Lock()
+	mark := st.mark
+	st.mu.Unlock()
+	if mark == nil {
+		return fmt.Errorf("the stack is not running")
+	}
+	return mark(label)
+}
+
+// Run starts every module in dependency order and runs until ctx is done or
+// the power monitor stops it. A module that fails to start stops the others
+// and is returned.
+func (st *Stack) Run(ctx context.Context) error {
+	cfg := st.Config
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	labeler, err := label.NewLabeler(labelRules(cfg.Labels))
+	if err != nil {
+		return err
+	}
+	channels, err := newDerivedChannels(cfg)
+	if err != nil {
+		return err
+	}
+	toggles, err := toggle.Open(cfg.ModuleState)
+	if err != nil {
+		return err
+	}
+	bindings, err := identity.Open(cfg.IdentityState)
+	if err != nil {
+		return err
+	}
+	swaps := newSwaps(bindings)
+	calibration, err := correction.Open(cfg.CalibrationState)
+	if err != nil {
+		return err
+	}
+	corrected := newCorrections(calibration, cfg.Sensors)
+	corrected.probe = swaps.serial
+	// hot holds nonessential modules off while the host overheats. Unlike a
+	// module switched off, it is not saved.
+	var hot atomic.Bool
+	paused := func(key string) bool { return hot.Load() && nonessential(cfg.Thermal, key) }
+
+	source, err := timesource.ParseSource(cfg.Time.Source)
+	if err != nil {
+		return err
+	}
+	if _, err := timesource.Probe(source); err != nil {
+		if cfg.Time.Strict {
+			return err
+		}
+		log.Printf("%v; recording timestamps anyway", err)
+	}
+
+	var events *eventlog.Log
+	if cfg.EventLog != "" {
+		if events, err = eventlog.Open(cfg.EventLog, 0); err != nil {
+			return err
+		}
+		defer events.Close()
+	}
+	var history *trend.History
+	if cfg.SessionHistory != "" {
+		if history, err = trend.Open(cfg.SessionHistory); err != nil {
+			return err
+		}
+	}
+
+	subject, pseudonyms, err := newSubject(cfg)
+	if err != nil {
+		return err
+	}
+	if history != nil && pseudonyms != nil {
+		// a pseudonym rotates, so sessions are matched on the subject behind it
+		history.MatchSubjects(func(name string) string {
+			if subject, ok := pseudonyms.Subject(name); ok {
+				return subject
+			}
+			return name
+		})
+	}
+	var sessionKey []byte
+	if cfg.Sessions.EncryptionKey != "" {
+		if sessionKey, err = atrest.LoadKey(cfg.Sessions.EncryptionKey); err != nil {
+			return err
+		}
+	}
+
+	for metric, spec := range cfg.Uncertainty.Specs {
+		uncertainty.SetSpec(metric, uncertainty.Spec(spec))
+	}
+
+	hooks := st.Hooks
+	var player *audio.Player
+	if cfg.Audio.Enabled {
+		if player, err = audio.NewPlayer(); err != nil {
+			log.Printf("audio: %v; running without audio cues", err)
+		} else {
+			defer player.Close()
+			if alert := hooks.Alert; cfg.Audio.Alerts {
+				hooks.Alert = func(a Alert) {
+					player.Alert(a.Message)
+					if alert != nil {
+						alert(a)
+					}
+				}
+			}
+		}
+	}
+	proto, err := newProtocolRuns(cfg, sessionKey, player)
+	if err != nil {
+		return err
+	}
+
+	export, closeExport, err := newMQTTExport(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeExport()
+
+	// Pollers hand samples to per-sensor queues and go straight back to
+	// polling. One dispatcher runs the processing and recording, serving
+	// fast streams more often, and exporters get a queue of their own so a
+	// slow broker holds up nobody.
+	var recExport func(any)
+	exportQ := pipeline.New(func(_ string, v any) { export(v) })
+	go exportQ.Run()
+	defer exportQ.Close()
+	var mqttQ *pipeline.Stream
+	if export != nil {
+		mqttQ = exportQ.Stream("export", 1, 4096)
+	}
+	plugins, err := startPlugins(cfg)
+	if err != nil {
+		return err
+	}
+	defer func() { closePlugins(plugins) }()
+	if export != nil || len(plugins) > 0 {
+		recExport = func(v any) {
+			_, alerting := alertFor(v)
+			wanted := func(module string) bool {
+				return toggles.Enabled(module) && (alerting || !paused(module))
+			}
+			if mqttQ != nil && wanted("exporter mqtt") {
+				mqttQ.Submit(v)
+			}
+			for _, pe := range plugins {
+				if wanted("exporter " + pe.cfg.Name) {
+					pe.stream.Submit(v)
+				}
+			}
+		}
+	}
+
+	var (
+		wg      sync.WaitGroup
+		outMu   sync.Mutex // serialises the labeler, smoothing, and derived channels
+		rec     = newRecorder(cfg, source, st.Output, recExport, events, hooks)
+		active  int
+		polled  []api.SensorInfo
+		checks  = validate.New() // used only by the process dispatcher once polling starts
+		limits  []api.Contract
+		states  = sensorStates{onChange: st.Hooks.SensorState}
+		values  latest.Cache
+		feed    latest.Feed      // every value in values, as it is stored
+		derived []derivedChannel // channels whose inputs started, guarded by outMu
+		breath  *apneaWatch      // a metabolic cart's, guarded by outMu
+		smooth  = newSmoothing(cfg.Sensors)
+	)
+	rec.key, rec.subject, rec.history = sessionKey, subject, history
+	if proto != nil {
+		proto.mark = rec.markIn
+		rec.proto = proto
+	}
+	rec.onStart = func() {
+		outMu.Lock()
+		defer outMu.Unlock()
+		for _, d := range derived {
+			if ss, ok := d.(sessionScoped); ok {
+				ss.resetSession()
+			}
+		}
+		if breath != nil {
+			breath.resetSession()
+		}
+	}
+
+	sample := func(it polledSample) {
+		raw, isCorrected := corrected.apply(&it)
+		valid, notes := checks.Check(it.sensor, it.metric, it.value, it.time)
+		for _, n := range notes {
+			rec.write(n)
+		}
+		if !valid {
+			return
+		}
+		dv, unit := units.Display(it.value, it.unit)
+		out := []any{Reading{Sensor: it.sensor, Metric: it.metric, Value: dv, Unit: string(unit), Time: it.time}}
+		if isCorrected {
+			drv, _ := units.Display(raw, it.unit)
+			out = append(out, Reading{Sensor: it.sensor, Metric: it.metric + "_raw", Value: drv, Unit: string(unit), Time: it.time})
+		}
+		if cfg.Uncertainty.Publish {
+			if q := uncertainty.Measure(it.metric, it.value); q.StdDev > 0 {
+				lo, hi := q.CI95()
+				dlo, _ := units.Display(lo, it.unit)
+				dhi, _ := units.Display(hi, it.unit)
+				out = append(out,
+					Reading{Sensor: it.sensor, Metric: it.metric + "_ci95_lower", Value: dlo, Unit: string(unit), Time: it.time},
+					Reading{Sensor: it.sensor, Metric: it.metric + "_ci95_upper", Value: dhi, Unit: string(unit), Time: it.time})
+			}
+		}
+		outMu.Lock()
+		for _, l := range labeler.Observe(it.time, it.metric, it.value) {
+			out = append(out, l)
+		}
+		if sv, ok := smooth.observe(it.sensor, it.metric, it.value); ok {
+			dsv, _ := units.Display(sv, it.unit)
+			out = append(out, Reading{Sensor: it.sensor, Metric: it.metric + "_smoothed", Value: dsv, Unit: string(unit), Time: it.time})
+			for _, l := range labeler.Observe(it.time, it.metric+"_smoothed", sv) {
+				out = append(out, l)
+			}
+		}
+		for _, d := range derived {
+			if !toggles.Enabled("derived "+d.name()) || paused("derived "+d.name()) {
+				continue
+			}
+			for _, r := range d.observe(it.time, it.metric, it.value, it.unit) {
+				out = append(out, r)
+				for _, l := range labeler.Observe(it.time, r.Metric, r.Value) { // label rules may use derived metrics
+					out = append(out, l)
+				}
+			}
+		}
+		if breath != nil {
+			out = append(out, breath.observe(it.time, it.metric, it.value, it.unit)...)
+		}
+		outMu.Unlock()
+		for _, v := range out {
+			if r, ok := v.(Reading); ok {
+				values.Store(latest.Value(r))
+				feed.Publish(latest.Value(r))
+			}
+		}
+		rec.write(out...)
+	}
+	process := pipeline.New(func(_ string, item any) {
+		switch it := item.(type) {
+		case connectionNote:
+			if it.State == string(sensor.Connected) {
+				outMu.Lock()
+				smooth.reset(it.Sensor)
+				outMu.Unlock()
+			}
+			rec.write(it)
+		case gap.Gap, deviceFault, provisionNote, ConfigAudit, moduleNote, power.Event, diskNote, thermalNote, identityNote, calibrationNote:
+			rec.write(it)
+		case polledSample:
+			sample(it)
+		case heldSamples:
+			for _, p := range it {
+				sample(p)
+			}
+		}
+	})
+	go process.Run()
+	defer process.Close()
+
+	var ledger *provision.Ledger
+	if len(cfg.Profiles) > 0 {
+		if cfg.ProfileState == "" {
+			return fmt.Errorf("profiles need profile_state to record provisioned serial numbers")
+		}
+		if ledger, err = provision.OpenLedger(cfg.ProfileState); err != nil {
+			return err
+		}
+	}
+
+	// Everything below starts in dependency order: sensors, then the derived
+	// channels computed from them, then sessions once the required sensors
+	// are up, then the API. A failure cancels whatever already started.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		mods     []startorder.Module
+		switches = moduleSwitch{toggles: toggles}
+		provides = map[string]string{} // metric -> sensor module producing it
+		storage  = startorder.Module{Name: "storage"}
+		leader   *rigsync.Leader
+	)
+	control := process.Stream("modules", 1, 64)
+	corrected.submit = func(n calibrationNote) { control.Submit(n) }
+	switches.submit = func(v any) { control.Submit(v) }
+	if export != nil {
+		switches.known = append(switches.known, api.ModuleInfo{Kind: "exporter", Name: "mqtt"})
+	}
+	for _, pe := range plugins {
+		switches.known = append(switches.known, api.ModuleInfo{Kind: "exporter", Name: pe.cfg.Name})
+	}
+	for _, sc := range cfg.Sensors {
+		if !sc.Enabled {
+			continue
+		}
+		if _, ok := device.Drivers[sc.Driver]; !ok {
+			log.Printf("sensor %s: driver %q is not supported by the daemon, skipping", sc.Name, sc.Driver)
+			continue
+		}
+		s, err := device.New(sc)
+		if err != nil {
+			return fmt.Errorf("sensor %s: %w", sc.Name, err)
+		}
+		active++
+		_, displayUnit := units.Display(0, s.Unit)
+		polled = append(polled, api.SensorInfo{Name: sc.Name, Driver: sc.Driver, Metric: s.Metric, Unit: string(displayUnit), Simulated: s.Simulated})
+
+		interval := time.Duration(sc.PollInterval)
+		if interval <= 0 {
+			interval = time.Second
+		}
+		spacing := interval // the longest expected between readings, for gap detection
+		var pace *adaptive.Poller
+		if sc.Adaptive.On() {
+			interval, spacing = time.Duration(sc.Adaptive.MinInterval), time.Duration(sc.Adaptive.MaxInterval)
+			if pace, err = adaptive.New(interval, spacing, sc.Adaptive.Rate); err != nil {
+				return fmt.Errorf("sensor %s: %w", sc.Name, err)
+			}
+		}
+		for _, m := range append([]device.Measurement{{Metric: s.Metric, Unit: s.Unit}}, s.Extra...) {
+			c, ok := sensor.ContractFor(sc.Driver, m.Metric)
+			if !ok {
+				continue
+			}
+			if c.Interval > 0 {
+				c.Interval = interval // the configured poll, not the driver default
+			}
+			c = contractIn(c, m.Unit, sc.Flow.Gas())
+			checks.Expect(sc.Name, c)
+			limits = append(limits, apiContract(sc.Name, c, m.Unit))
+		}
+		priority := sc.Priority
+		if priority <= 0 {
+			priority = defaultPriority(interval)
+		}
+		queue := process.Stream(sc.Name, priority, queueCapacity(interval))
+		swaps.add(sc.Name, sc.Driver, interval, len(s.Extra), func(v any) { queue.Submit(v) })
+		notify := func(e sensor.StateEvent) {
+			log.Printf("sensor %s %s (attempt %d): %v", sc.Name, e.State, e.Attempt, e.Err)
+			states.set(sc.Name, e.State)
+			queue.Submit(newConnectionNote(sc.Name, e))
+			if e.State == sensor.Connected { // possibly a different probe
+				if note, ok := swaps.connected(sc.Name, s); ok {
+					queue.Submit(note)
+				}
+				for _, note := range onConnect(ctx, cfg, ledger, sc, s) {
+					queue.Submit(note)
+				}
+			}
+		}
+
+		name := "sensor " + sc.Name
+		provides[s.Metric] = name
+		for _, m := range s.Extra {
+			provides[m.Metric] = name
+		}
+		if !sc.Optional { // sessions wait for every required sensor
+			storage.Requires = append(storage.Requires, name)
+		}
+		// poll runs until ctx is done. closed says the sensor was switched off
+		// at startup and never opened.
+		poll := func(sc config.Sensor, s *device.Device, startErr error, closed bool) {
+			defer wg.Done()
+			if startErr != nil && !awaitSensor(ctx, sc.Name, s, notify) {
+				return
+			}
+
+			if s.Faults != nil {
+				faultPoll := time.Duration(sc.FaultPoll)
+				if faultPoll <= 0 {
+					faultPoll = time.Minute
+				}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					faults := func(ctx context.Context) ([]vaisala.Fault, error) {
+						if !toggles.Enabled(name) {
+							return nil, errSwitchedOff
+						}
+						return s.Faults(ctx)
+					}
+					watchFaults(ctx, sc.Name, faultPoll, faults, func(v any) { queue.Submit(v) })
+				}()
+			}
+			for kind, metric := range sc.Compensate {
+				if s.Compensate == nil {
+					break
+				}
+				source := func() (vaisala.Measurement, bool) {
+					v, ok := values.Load(metric)
+					if !ok || !toggles.Enabled(name) || time.Since(v.Time) > 2*device.CompensateEvery {
+						return vaisala.Measurement{}, false
+					}
+					return vaisala.Measurement{Metric: v.Metric, Value: v.Value, Unit: v.Unit}, true
+				}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if err := s.Compensate(ctx, kind, source); err != nil {
+						log.Printf("sensor %s: %s compensation: %v", sc.Name, kind, err)
+					}
+				}()
+			}
+
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			tick := interval
+			repace := func(next time.Duration) {
+				if next != tick {
+					tick = next
+					ticker.Reset(next)
+				}
+			}
+			gaps := gap.NewDetector(sc.Name, s.Metric, spacing)
+			link := reconnect.NewTracker(reconnect.DefaultPolicy)
+			for {
+				if on := toggles.Enabled(name); on == closed {
+					if closed = !on; closed { // release the port while switched off
+						if g, ok := gaps.Close(time.Now().UTC()); ok {
+							queue.Submit(g)
+						}
+						s.Close()
+						states.set(sc.Name, sensor.Disconnected)
+					} else {
+						if err := s.Open(); err != nil {
+							reconnect.Reconnect(ctx, reconnect.DefaultPolicy, err, s.Close, s.Open, notify)
+						} else {
+							notify(sensor.StateEvent{State: sensor.Connected, Time: time.Now().UTC()})
+						}
+						gaps = gap.NewDetector(sc.Name, s.Metric, spacing)
+						link = reconnect.NewTracker(reconnect.DefaultPolicy)
+					}
+				}
+				var v float64
+				var more []device.Measurement
+				var err error
+				if !closed {
+					v, more, err = s.Poll(ctx)
+				}
+				switch {
+				case closed || ctx.Err() != nil: // switched off, or shutting down; the select below closes any open gap
+				case err != nil:
+					log.Printf("sensor %s: %v", sc.Name, err)
+					gaps.Error(err)
+					if pace != nil {
+						repace(pace.Miss())
+					}
+					if link.Observe(err) {
+						reconnect.Reconnect(ctx, reconnect.DefaultPolicy, err, s.Close, s.Open, notify)
+					}
+				default:
+					link.Observe(nil)
+					now := time.Now().UTC()
+					if g, ok := gaps.Reading(now); ok {
+						queue.Submit(g)
+					}
+					samples := []polledSample{{sensor: sc.Name, metric: s.Metric, unit: s.Unit, value: v, time: now}}
+					for _, m := range more {
+						samples = append(samples, polledSample{sensor: sc.Name, metric: m.Metric, unit: m.Unit, value: m.Value, time: now})
+					}
+					swaps.pass(sc.Name, samples...)
+					if pace != nil {
+						repace(pace.Observe(now, v))
+					}
+				}
+				var paced chan struct{} // a streaming sensor's reads wait for its next sample
+				if s.Paced && !closed && err == nil {
+					paced = make(chan struct{})
+					close(paced)
+				}
+				select {
+				case <-ctx.Done():
+					if g, ok := gaps.Close(time.Now().UTC()); ok {
+						queue.Submit(g)
+					}
+					return
+				case <-ticker.C:
+				case <-paced:
+				}
+			}
+		}
+		switches.known = append(switches.known, api.ModuleInfo{Kind: "sensor", Name: sc.Name})
+		mods = append(mods, startorder.Module{Name: name, Stop: func() { s.Close() }, Start: func(ctx context.Context) error {
+			if !toggles.Enabled(name) {
+				log.Printf("sensor %s is switched off, not opening it", sc.Name)
+				states.set(sc.Name, sensor.Disconnected)
+				wg.Add(1)
+				go poll(sc, s, nil, true)
+				return nil
+			}
+			startErr := s.Open()
+			if startErr == nil {
+				states.set(sc.Name, sensor.Connected)
+				if note, ok := swaps.connected(sc.Name, s); ok {
+					queue.Submit(note)
+				}
+				for _, note := range onConnect(ctx, cfg, ledger, sc, s) {
+					queue.Submit(note)
+				}
+			} else if sc.Optional {
+				log.Printf("sensor %s: %v; running degraded until it appears", sc.Name, startErr)
+				notify(sensor.StateEvent{State: sensor.Degraded, Err: startErr, Time: time.Now().UTC()})
+			} else {
+				return startErr
+			}
+			wg.Add(1)
+			go poll(sc, s, startErr, false)
+			return nil
+		}})
+	}
+
+	if active == 0 {
+		return fmt.Errorf("no enabled sensors in config")
+	}
+
+	addDerived := func(ch derivedChannel, requires ...string) {
+		switches.known = append(switches.known, api.ModuleInfo{Kind: "derived", Name: ch.name()})
+		mods = append(mods, startorder.Module{Name: "derived " + ch.name(), Requires: requires, Start: func(context.Context) error {
+			outMu.Lock()
+			defer outMu.Unlock()
+			derived = append(derived, ch)
+			return nil
+		}})
+	}
+	for _, ch := range channels { // derived channels only see sensor readings, not each other's
+		required, ok := provides[ch.input()]
+		if !ok {
+			required = "metric " + ch.input()
+		}
+		addDerived(ch, required)
+	}
+	// a rig measuring both the flow and the CO2 expired through it is a
+	// metabolic cart
+	if flow, co2 := provides["flow"], provides["co2"]; flow != "" && co2 != "" {
+		addDerived(newMetabolicChannel(cfg.Uncertainty.Publish), flow, co2)
+		outMu.Lock()
+		breath = newApneaWatch()
+		outMu.Unlock()
+	}
+
+	mark := func(label string) error {
+		if cfg.Sync.Role == syncFollower {
+			return fmt.Errorf("a follower records its leader's markers only")
+		}
+		at := time.Now()
+		if leader != nil {
+			at = leader.Mark(rec.session(), label)
+		}
+		return rec.mark(label, "", at)
+	}
+	storage.Start = func(ctx context.Context) (err error) {
+		if leader, err = startSync(ctx, &wg, cfg, rec); err != nil {
+			return err
+		}
+		st.mu.Lock()
+		st.mark = mark
+		st.mu.Unlock()
+		return nil
+	}
+	storage.Stop = func() {
+		st.mu.Lock()
+		st.mark = nil
+		st.mu.Unlock()
+		if leader != nil {
+			leader.Stop(rec.session())
+			leader.Close()
+		}
+		rec.stop()
+	}
+	mods = append(mods, storage)
+
+	if cfg.APIAddr != "" {
+		mods = append(mods, startorder.Module{Name: "api", Requires: []string{"storage"}, Start: func(ctx context.Context) error {
+			srv := api.NewServer(cfg.APIAddr, polled)
+			srv.ServeSensorStates(states.get)
+			srv.ServeLatest(&values)
+			srv.ServeReadings(&feed)
+			if cfg.GRPCAddr != "" {
+				srv.ServeGRPC(cfg.GRPCAddr)
+			}
+			srv.ServeContracts(limits)
+			srv.ServeTrace(serialio.Trace)
+			srv.ServeLogs(st.Logs)
+			srv.HandleModules(switches.list, switches.set)
+			if events != nil {
+				srv.HandleEvents(events.Query)
+			}
+			if cfg.Sync.Role != syncFollower {
+				srv.HandleMarkers(mark)
+			}
+			srv.HandleSubjectDeletion(eraseSubject(cfg, sessionKey, events, history, pseudonyms))
+			if history != nil {
+				srv.HandleTrends(rec.trends)
+			}
+			srv.HandleIdentity(swaps.info, swaps.confirm)
+			srv.HandleCorrections(corrected.list, corrected.put, corrected.remove)
+			srv.HandleCalibrations(corrected.calibrate)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := srv.Run(ctx); err != nil {
+					log.Printf("api server stopped: %v", err)
+				}
+			}()
+			return nil
+		}})
+	}
+
+	if cfg.Sessions.Dir != "" {
+		mods = append(mods, startorder.Module{Name: "disk", Requires: []string{"storage"}, Start: func(ctx context.Context) error {
+			queue := process.Stream("disk", 1, 16)
+			every := time.Duration(cfg.Sessions.AggregateEvery)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				watchDisk(ctx, cfg.Sessions, rec.written.Load, func(v any) { queue.Submit(v) }, func(on bool) { rec.aggregateOnly(on, every) })
+			}()
+			return nil
+		}})
+	}
+
+	if cfg.Thermal.ThrottleC > 0 {
+		mods = append(mods, startorder.Module{Name: "thermal", Requires: []string{"storage"}, Start: func(ctx context.Context) error {
+			queue := process.Stream("thermal", 1, 16)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				watchThermal(ctx, cfg.Thermal, func(v any) { queue.Submit(v) }, func(on bool) []string {
+					hot.Store(on)
+					var names []string
+					for _, m := range switches.known {
+						if key := m.Kind + " " + m.Name; nonessential(cfg.Thermal, key) && toggles.Enabled(key) {
+							names = append(names, key)
+						}
+					}
+					return names
+				})
+			}()
+			return nil
+		}})
+	}
+
+	var lowBattery atomic.Bool // the power monitor stopped the daemon
+	if cfg.Power.Source != "" {
+		mods = append(mods, startorder.Module{Name: "power", Requires: []string{"storage"}, Start: func(ctx context.Context) error {
+			src, err := openPowerSource(cfg.Power)
+			if err != nil {
+				return err
+			}
+			queue := process.Stream("power", 1, 16)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer src.Close()
+				watchPower(ctx, src, cfg.Power, func(v any) { queue.Submit(v) }, func() {
+					lowBattery.Store(true)
+					cancel()
+				})
+			}()
+			return nil
+		}})
+	}
+
+	modules, errs := startorder.Start(ctx, mods)
+	var fatal []error
+	for _, err := range errs {
+		var blocked startorder.Blocked
+		if errors.As(err, &blocked) && strings.HasPrefix(blocked.Module, "derived ") && strings.HasPrefix(blocked.Dependency, "metric ") {
+			log.Printf("%v", err) // a derived channel over a metric nothing provides: warn and run without it
+			continue
+		}
+		fatal = append(fatal, err)
+	}
+	if len(fatal) > 0 {
+		cancel()
+		wg.Wait()
+		modules.Stop()
+		return errors.Join(fatal...)
+	}
+
+	if st.Hooks.Started != nil {
+		st.Hooks.Started()
+	}
+
+	wg.Wait()
+	process.Close()
+	logDrops(process)
+	var tail []any
+	for _, l := range labeler.Flush(time.Now().UTC()) {
+		tail = append(tail, l)
+	}
+	rec.write(tail...)
+	modules.Stop()
+	exportQ.Close()
+	logDrops(exportQ)
+	closePlugins(plugins)
+	plugins = nil
+	if lowBattery.Load() {
+		return powerOff(cfg.Power.ShutdownCommand)
+	}
+	return nil
+}
+
+// apiContract converts c to the display units readings are published in.
+func apiContract(sensorName string, c sensor.Contract, native units.Unit) api.Contract {
+	lo, unit := units.Display(c.Min, native)
+	hi, _ := units.Display(c.Max, native)
+	zero, _ := units.Display(0, native)
+	res, _ := units.Display(c.Resolution, native)
+	res, _ = strconv.ParseFloat(strconv.FormatFloat(res-zero, 'g', 6, 64), 64) // no float noise from the conversion
+	out := api.Contract{Sensor: sensorName, Metric: c.Metric, Unit: string(unit), ValidMin: lo, ValidMax: hi, Resolution: res}
+	if c.Interval > 0 {
+		out.ExpectedInterval = c.Interval.String()
+	}
+	return out
+}
+
+// contractIn rescales c to unit, for a sensor set to report in another unit
+// than its driver's contract, e.g. a flow meter converting to kg/h. A
+// contract whose unit cannot be converted is kept as it is.
+func contractIn(c sensor.Contract, unit units.Unit, gas units.Gas) sensor.Contract {
+	from := units.Unit(c.Unit)
+	if from == unit {
+		return c
+	}
+	if factor, err := units.FlowFactor(from, unit, gas); err == nil {
+		c.Min, c.Max, c.Resolution = c.Min*factor, c.Max*factor, c.Resolution*factor
+		c.Unit = string(unit)
+		return c
+	}
+	lo, err1 := units.Convert(c.Min, from, unit)
+	hi, err2 := units.Convert(c.Max, from, unit)
+	zero, _ := units.Convert(0, from, unit)
+	res, _ := units.Convert(c.Resolution, from, unit)
+	if err1 != nil || err2 != nil {
+		return c
+	}
+	c.Min, c.Max, c.Resolution, c.Unit = lo, hi, res-zero, string(unit)
+	return c
+}
+
+// polledSample is one native-unit value on its way from a poller to the
+// processing dispatcher.
+type polledSample struct {
+	sensor string
+	metric string
+	unit   units.Unit
+	value  float64
+	time   time.Time
+}
+
+// connectionNote records a sensor dropping off the bus and each attempt to
+// bring it back.
+type connectionNote struct {
+	Annotation string    `json:"annotation"` // "connection"
+	Sensor     string    `json:"sensor"`
+	State      string    `json:"state"`
+	Attempt    int       `json:"attempt,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Time       time.Time `json:"time"`
+}
+
+func newConnectionNote(name string, e sensor.StateEvent) connectionNote {
+	n := connectionNote{Annotation: "connection", Sensor: name, State: string(e.State), Attempt: e.Attempt, Time: e.Time}
+	if e.Err != nil {
+		n.Error = e.Err.Error()
+	}
+	return n
+}
+
+// awaitSensor keeps retrying an optional sensor that was absent at startup,
+// with the reconnect backoff, and reports whether it appeared before ctx was
+// done. Only its arrival is recorded; the failed attempts are just logged, so
+// a strap left in the drawer does not fill the session with annotations.
+func awaitSensor(ctx context.Context, name string, s *device.Device, notify func(sensor.StateEvent)) bool {
+	err := reconnect.Reconnect(ctx, reconnect.DefaultPolicy, nil, s.Close, s.Open, func(e sensor.StateEvent) {
+		switch e.State {
+		case sensor.Connected:
+			notify(e)
+		case sensor.Reconnecting:
+			log.Printf("sensor %s still absent (attempt %d): %v", name, e.Attempt, e.Err)
+		}
+	})
+	return err == nil
+}
+
+// sensorStates is each polled sensor's latest connection state, for the API.
+type sensorStates struct {
+	lock     sync.Mutex
+	states   map[string]sensor.State
+	onChange func(string, sensor.State) // nil for none
+}
+
+func (ss *sensorStates) set(name string, st sensor.State) {
+	ss.lock.Lock()
+	if ss.states == nil {
+		ss.states = map[string]sensor.State{}
+	}
+	prev, known := ss.states[name]
+	ss.states[name] = st
+	ss.lock.Unlock()
+	if ss.onChange != nil && (!known || prev != st) {
+		ss.onChange(name, st)
+	}
+}
+
+func (ss *sensorStates) get(name string) string {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+	return string(ss.states[name])
+}
+
+// defaultPriority serves faster streams more often per dispatch round.
+func defaultPriority(interval time.Duration) int {
+	switch {
+	case interval <= 100*time.Millisecond:
+		return 4
+	case interval <= time.Second:
+		return 2
+	}
+	return 1
+}
+
+// queueCapacity holds about ten seconds of backlog per stream.
+func queueCapacity(interval time.Duration) int {
+	return min(max(int(10*time.Second/interval), 64), 4096)
+}
+
+func logDrops(d *pipeline.Dispatcher) {
+	for _, st := range d.Stats() {
+		if st.Dropped > 0 {
+			log.Printf("pipeline: stream %s dropped %d of %d items under backpressure", st.Name, st.Dropped, st.Dropped+st.Handled)
+		}
+	}
+}
+
+const (
+	syncLeader   = "leader"
+	syncFollower = "follower"
+)
+
+// startSync opens the first session according to the rig's sync role. A
+// standalone rig records from startup; a leader announces the session and
+// starts with its followers; a follower records only between the start and
+// stop it receives. The leader is returned so shutdown can announce the stop.
+func startSync(ctx context.Context, wg *sync.WaitGroup, cfg *config.Config, rec *recorder) (*rigsync.Leader, error) {
+	group := cfg.Sync.Group
+	if group == "" {
+		group = rigsync.DefaultGroup
+	}
+
+	switch cfg.Sync.Role {
+	case "", "standalone":
+		return nil, rec.start(newSessionID(time.Now()))
+
+	case syncLeader:
+		lead := time.Duration(cfg.Sync.StartDelay)
+		if lead <= 0 {
+			lead = 500 * time.Millisecond
+		}
+		leader, err := rigsync.NewLeader(cfg.SiteID, append([]string{group}, cfg.Sync.Followers...), lead)
+		if err != nil {
+			return nil, err
+		}
+		id := newSessionID(time.Now())
+		at := leader.Start(id)
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Until(at)):
+		}
+		if err := rec.start(id); err != nil {
+			leader.Close()
+			return nil, err
+		}
+		return leader, nil
+
+	case syncFollower:
+		follower, err := rigsync.NewFollower(group)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("sync: following on %s, waiting for a leader to start a session", group)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := follower.Run(ctx, func(m rigsync.Message) {
+				switch m.Type {
+				case rigsync.Start:
+					if err := rec.start(m.Session); err != nil {
+						log.Printf("sync: %v", err)
+					}
+				case rigsync.Stop:
+					rec.stop()
+				case rigsync.Marker:
+					if err := rec.mark(m.Label, m.Leader, m.At); err != nil {
+						log.Printf("sync: marker %q: %v", m.Label, err)
+					}
+				}
+			})
+			if err != nil {
+				log.Printf("sync: %v", err)
+			}
+		}()
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown sync role %q", cfg.Sync.Role)
+}
+
+func labelRules(cfgRules []config.LabelRule) []label.Rule {
+	var rules []label.Rule
+	for _, r := range cfgRules {
+		rule := label.Rule{Name: r.Name, MinDuration: time.Duration(r.For)}
+		for _, c := range r.When {
+			rule.Conditions = append(rule.Conditions, label.Condition{Metric: c.Metric, Op: c.Op, Value: c.Value, Hysteresis: c.Hysteresis})
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
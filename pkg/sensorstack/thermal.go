@@ -0,0 +1,80 @@
+package sensorstack
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/demelere/sensor-control-modules/internal/config"
+	"github.com/demelere/sensor-control-modules/internal/thermal"
+	"github.com/demelere/sensor-control-modules/internal/units"
+)
+
+// thermalNote records the daemon shedding nonessential work because the host
+// is too hot, and taking it up again once it has cooled.
+type thermalNote struct {
+	Annotation string    `json:"annotation"` // "thermal"
+	State      string    `json:"state"`      // "throttled" or "resumed"
+	Source     string    `json:"source"`     // the hottest sensor
+	Celsius    float64   `json:"celsius"`
+	Paused     []string  `json:"paused,omitempty"` // modules held off while throttled
+	Time       time.Time `json:"time"`
+}
+
+// nonessential reports whether the module keyed "<kind> <name>" may be
+// paused while the host is hot: those listed in t.Nonessential, or by
+// default every derived channel and exporter.
+func nonessential(t config.Thermal, key string) bool {
+	if len(t.Nonessential) == 0 {
+		return strings.HasPrefix(key, "derived ") || strings.HasPrefix(key, "exporter ")
+	}
+	for _, m := range t.Nonessential {
+		if m == key {
+			return true
+		}
+	}
+	return false
+}
+
+// watchThermal reads the host's temperatures every t.Poll until ctx is done.
+// It submits the hottest as metric host_temperature of sensor "host", and
+// calls throttle with each change of state along with a thermalNote.
+func watchThermal(ctx context.Context, t config.Thermal, submit func(any), throttle func(bool) []string) {
+	interval := time.Duration(t.Poll)
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	gov := thermal.Governor{Throttle: t.ThrottleC, Resume: t.ResumeC}
+	for {
+		readings, err := thermal.Read(t.Sensors)
+		if err != nil {
+			log.Printf("thermal: %v", err)
+		} else {
+			hot := thermal.Hottest(readings)
+			now := time.Now().UTC()
+			submit(polledSample{sensor: "host", metric: "host_temperature", unit: units.Celsius, value: hot.Celsius, time: now})
+			if on, changed := gov.Observe(hot.Celsius); changed {
+				note := thermalNote{Annotation: "thermal", State: "resumed", Source: hot.Source, Celsius: hot.Celsius, Time: now}
+				if on {
+					note.State = "throttled"
+				}
+				note.Paused = throttle(on)
+				if on {
+					log.Printf("thermal: %s at %.1f °C, pausing %s", hot.Source, hot.Celsius, strings.Join(note.Paused, ", "))
+				} else {
+					log.Printf("thermal: %s down to %.1f °C, resuming", hot.Source, hot.Celsius)
+					note.Paused = nil
+				}
+				submit(note)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package vaisala
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"go.bug.st/serial"
+
+	"github.com/demelere/sensor-control-modules/internal/portworker"
+	"github.com/demelere/sensor-control-modules/internal/serialio"
+)
+
+// selectSettle is how long a probe gets to answer OPEN or CLOSE before its
+// banner is thrown away.
+var selectSettle = 100 * time.Millisecond
+
+// Bus is one RS-485 line shared by several probes, each at its own address.
+// The probes share one port worker, which is the line's arbiter: a command to
+// one probe and its reply never overlap another's. Over the terminal protocol
+// the bus also keeps track of which probe is OPEN and switches probes with
+// CLOSE and OPEN as commands come in. The zero Bus is ready to use; give it
+// to each probe with SetBus before Open.
+type Bus struct {
+	port portworker.Worker // the arbiter
+
+	lock     sync.Mutex
+	attached map[*VaisalaSensor]bool // opened and not yet closed
+
+	// owned by the worker
+	conn     serial.Port
+	reader   *serialio.LineReader
+	path     string
+	baudRate int
+	protocol Protocol
+	users    map[*VaisalaSensor]bool // probes connected over conn
+	selected int                     // address of the OPEN probe, 0 for none
+}
+
+var (
+	busesLock sync.Mutex
+	buses     = map[string]*Bus{}
+)
+
+// SharedBus returns the process-wide Bus for probes opened on port, or
+// found by discovery with portMatch when port is empty, so that every probe
+// configured on the same line shares it.
+func SharedBus(port, portMatch string) *Bus {
+	key := "port:" + port
+	if port == "" {
+		key = "match:" + portMatch
+	}
+	busesLock.Lock()
+	defer busesLock.Unlock()
+	b, ok := buses[key]
+	if !ok {
+		b = &Bus{}
+		buses[key] = b
+	}
+	return b
+}
+
+// SetBus puts the probe on b, sharing its port and worker with the other
+// probes there; the first to connect opens the port with its own port
+// settings, and the rest must match its baud rate and protocol. Call it
+// before Open. Run mode needs the bus to itself.
+func (vs *VaisalaSensor) SetBus(b *Bus) {
+	vs.line = b
+	vs.port = &b.port
+}
+
+// attach starts the worker for vs, failing while another probe on the bus
+// is in run mode and so has the line to itself.
+func (b *Bus) attach(vs *VaisalaSensor) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for other := range b.attached {
+		if other != vs && other.Running() {
+			return fmt.Errorf("vaisala probe at address %d is in run mode on this bus", other.defaultAddress)
+		}
+	}
+	if b.attached == nil {
+		b.attached = map[*VaisalaSensor]bool{}
+	}
+	b.attached[vs] = true
+	b.port.Start()
+	return nil
+}
+
+// detach stops the worker once the last probe is closed.
+func (b *Bus) detach(vs *VaisalaSensor) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	delete(b.attached, vs)
+	if len(b.attached) == 0 {
+		b.port.Stop()
+	}
+}
+
+// shared reports whether another probe is open on the bus.
+func (b *Bus) shared(vs *VaisalaSensor) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for other := range b.attached {
+		if other != vs {
+			return true
+		}
+	}
+	return false
+}
+
+// connect hands vs the bus's port, opening it first if no probe has. It
+// runs on the worker.
+func (b *Bus) connect(vs *VaisalaSensor) error {
+	if b.conn == nil {
+		if err := vs.openPort(); err != nil {
+			return err
+		}
+		b.conn, b.reader, b.path = vs.serialConn, vs.reader, vs.portPath
+		b.baudRate, b.protocol = vs.baudRate, vs.protocol
+		b.selected = 0
+	} else if vs.baudRate != b.baudRate || vs.protocol != b.protocol {
+		return fmt.Errorf("vaisala bus on %s runs %s at %d baud, probe at address %d wants %s at %d", b.path, b.protocol, b.baudRate, vs.defaultAddress, vs.protocol, vs.baudRate)
+	}
+	vs.serialConn, vs.reader, vs.portPath = b.conn, b.reader, b.path
+	if b.users == nil {
+		b.users = map[*VaisalaSensor]bool{}
+	}
+	b.users[vs] = true
+	return nil
+}
+
+// release lets go of vs's connection and closes the port once no probe is
+// connected over it, so a line that failed for all of them is reopened
+// from scratch. It runs on the worker.
+func (b *Bus) release(vs *VaisalaSensor) error {
+	if !b.users[vs] {
+		return nil
+	}
+	delete(b.users, vs)
+	if b.selected == vs.defaultAddress {
+		b.selected = 0 // the next command opens it again, in case it was reset
+	}
+	if len(b.users) > 0 || b.conn == nil {
+		return nil
+	}
+	err := b.conn.Close()
+	b.conn, b.reader = nil, nil
+	return err
+}
+
+// selectProbe makes vs the OPEN probe on the line, closing the one before.
+// force reopens it even when it already is, as on connect. It runs on the
+// worker.
+func (b *Bus) selectProbe(vs *VaisalaSensor, force bool) error {
+	if b.selected == vs.defaultAddress && !force {
+		return nil
+	}
+	if b.selected != 0 && b.selected != vs.defaultAddress {
+		if _, err := b.conn.Write([]byte("close\r\n")); err != nil {
+			return fmt.Errorf("failed to write close command: %v", err)
+		}
+		time.Sleep(selectSettle)
+	}
+	b.selected = 0
+	if _, err := b.conn.Write([]byte(fmt.Sprintf("open %d\r\n", vs.defaultAddress))); err != nil {
+		return fmt.Errorf("failed to write open command: %v", err)
+	}
+	time.Sleep(selectSettle)
+	b.reader.Reset()
+	b.selected = vs.defaultAddress
+	return nil
+}
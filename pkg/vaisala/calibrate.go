@@ -0,0 +1,236 @@
+package vaisala
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/demelere/sensor-control-modules/internal/numparse"
+	"github.com/demelere/sensor-control-modules/internal/portworker"
+)
+
+// GMP25x calibration commands. The adjustment commands take the reference
+// concentration in ppm; the user adjustment is a linear correction applied
+// on top of the factory calibration.
+var (
+	vaisalaCmdZero          string // with the reference, normally 0 ppm (nitrogen)
+	vaisalaCmdSpan          string // with the reference gas concentration
+	vaisalaCmdCancel        string
+	vaisalaCmdAdjustment    string // alone to read, with offset and gain to write
+	vaisalaCmdCalDate       string // alone to read, with a date to write
+	vaisalaCmdCalText       string
+	vaisalaRegexCalOffset   *regexp.Regexp
+	vaisalaRegexCalGain     *regexp.Regexp
+	vaisalaMaxCalCorrection float64 // ppm, the largest correction made without Force
+)
+
+func init() {
+	vaisalaCmdZero = "cco2 -lo %g"
+	vaisalaCmdSpan = "cco2 -hi %g"
+	vaisalaCmdCancel = "cco2 -cancel"
+	vaisalaCmdAdjustment = "lco2"
+	vaisalaCmdCalDate = "cdate"
+	vaisalaCmdCalText = "ctext"
+	vaisalaRegexCalOffset = regexp.MustCompile(`(?i)offset\s*:?\s*(-?[\d.,]+)`)
+	vaisalaRegexCalGain = regexp.MustCompile(`(?i)gain\s*:?\s*(-?[\d.,]+)`)
+	vaisalaMaxCalCorrection = 2000
+}
+
+// ErrNotConfirmed is returned when a calibration step was not confirmed.
+var ErrNotConfirmed = errors.New("calibration not confirmed")
+
+// CalibrationOptions are the guard rails around a command that changes the
+// probe's calibration.
+type CalibrationOptions struct {
+	// Confirm is asked before each change with a description of it,
+	// including what the probe reads now; the change is made only if it
+	// returns true. Nil refuses every change, so a caller cannot calibrate
+	// by accident.
+	Confirm func(prompt string) bool
+	// DryRun reads the probe and returns the steps that would be sent,
+	// without asking or sending them.
+	DryRun bool
+	// Force allows a correction larger than 2000 ppm, e.g. for a probe
+	// that was never calibrated or a wrong reference gas.
+	Force bool
+	// Date is recorded as the calibration date after a zero or span
+	// adjustment; zero records today.
+	Date time.Time
+}
+
+// CalibrationStep is one command of a calibration, with the probe's reply
+// (empty on a dry run).
+type CalibrationStep struct {
+	Command string `json:"command"`
+	Reply   string `json:"reply,omitempty"`
+}
+
+// Adjustment is the user adjustment: corrected = Offset + Gain * reading,
+// in ppm.
+type Adjustment struct {
+	Offset float64 `json:"offset"`
+	Gain   float64 `json:"gain"`
+}
+
+// CalibrationInfo is what the probe records about its last calibration.
+type CalibrationInfo struct {
+	Date string `json:"date,omitempty"` // as the probe prints it
+	Text string `json:"text,omitempty"`
+}
+
+// CalibrateZero adjusts the probe's zero point. The probe must be in CO2-free
+// gas (nitrogen) and settled. See CalibrationOptions for the guard rails.
+// Terminal protocol only.
+func (vs *VaisalaSensor) CalibrateZero(ctx context.Context, opts CalibrationOptions) ([]CalibrationStep, error) {
+	return vs.adjust(ctx, "zero", vaisalaCmdZero, 0, opts)
+}
+
+// CalibrateSpan adjusts the probe's span against reference gas of
+// referencePPM, which must be in the probe's measuring range. Terminal
+// protocol only.
+func (vs *VaisalaSensor) CalibrateSpan(ctx context.Context, referencePPM float64, opts CalibrationOptions) ([]CalibrationStep, error) {
+	if referencePPM <= 0 || referencePPM > 200000 {
+		return nil, fmt.Errorf("span reference %g ppm outside the measuring range 0-200000", referencePPM)
+	}
+	return vs.adjust(ctx, "span", vaisalaCmdSpan, referencePPM, opts)
+}
+
+// adjust runs one zero or span adjustment: read the probe, check the
+// correction, confirm, adjust, and record the date. A rejected adjustment is
+// cancelled so the probe keeps its previous calibration.
+func (vs *VaisalaSensor) adjust(ctx context.Context, kind, format string, reference float64, opts CalibrationOptions) ([]CalibrationStep, error) {
+	if vs.protocol == Modbus {
+		return nil, fmt.Errorf("calibration needs the ascii protocol, the probe is on modbus")
+	}
+	now, err := vs.ReadCO2Context(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the probe before %s calibration: %w", kind, err)
+	}
+	if correction := math.Abs(now - reference); correction > vaisalaMaxCalCorrection && !opts.Force {
+		return nil, fmt.Errorf("%s calibration would correct the probe by %.0f ppm (reads %.0f, reference %g), more than %.0f; check the reference gas or force it", kind, correction, now, reference, vaisalaMaxCalCorrection)
+	}
+
+	date := opts.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	steps := []CalibrationStep{
+		{Command: fmt.Sprintf(format, reference)},
+		{Command: vaisalaCmdCalDate + " " + date.Format("2006-01-02")},
+	}
+	if opts.DryRun {
+		return steps, nil
+	}
+	prompt := fmt.Sprintf("%s calibration of vaisala probe %s at %g ppm; it reads %.0f ppm now", kind, vs.sensorID(), reference, now)
+	if opts.Confirm == nil || !opts.Confirm(prompt) {
+		return nil, ErrNotConfirmed
+	}
+
+	for i := range steps {
+		reply, err := vs.command(ctx, portworker.Calibration, steps[i].Command)
+		steps[i].Reply = reply
+		if err == nil && rejected(reply) {
+			err = fmt.Errorf("probe rejected %s: %s", steps[i].Command, reply)
+		}
+		if err != nil {
+			if i == 0 {
+				if _, cerr := vs.command(context.Background(), portworker.Calibration, vaisalaCmdCancel); cerr != nil {
+					log.Printf("failed to cancel vaisala %s calibration: %v", kind, cerr)
+				}
+			}
+			return steps[:i+1], err
+		}
+	}
+	log.Printf("vaisala probe %s: %s calibration at %g ppm done", vs.sensorID(), kind, reference)
+	return steps, nil
+}
+
+// UserAdjustment reads the user adjustment. Terminal protocol only.
+func (vs *VaisalaSensor) UserAdjustment(ctx context.Context) (Adjustment, error) {
+	reply, err := vs.Command(ctx, vaisalaCmdAdjustment)
+	if err != nil {
+		return Adjustment{}, err
+	}
+	return parseAdjustment(reply)
+}
+
+func parseAdjustment(reply string) (Adjustment, error) {
+	var adj Adjustment
+	for _, f := range []struct {
+		re    *regexp.Regexp
+		name  string
+		field *float64
+	}{
+		{vaisalaRegexCalOffset, "offset", &adj.Offset},
+		{vaisalaRegexCalGain, "gain", &adj.Gain},
+	} {
+		m := f.re.FindStringSubmatch(reply)
+		if m == nil {
+			return Adjustment{}, fmt.Errorf("%w: no %s in %q", ErrInvalidResponse, f.name, reply)
+		}
+		v, err := numparse.ParseFloat(m[1])
+		if err != nil {
+			return Adjustment{}, fmt.Errorf("%w: failed to parse %s: %v", ErrInvalidResponse, f.name, err)
+		}
+		*f.field = v
+	}
+	return adj, nil
+}
+
+// SetUserAdjustment replaces the user adjustment, after the same guard rails
+// as a calibration; an adjustment that moves the probe's current reading by
+// more than 2000 ppm needs Force. Terminal protocol only.
+func (vs *VaisalaSensor) SetUserAdjustment(ctx context.Context, adj Adjustment, opts CalibrationOptions) ([]CalibrationStep, error) {
+	if adj.Gain <= 0 {
+		return nil, fmt.Errorf("adjustment gain must be positive, not %g", adj.Gain)
+	}
+	if vs.protocol == Modbus {
+		return nil, fmt.Errorf("calibration needs the ascii protocol, the probe is on modbus")
+	}
+	old, err := vs.UserAdjustment(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the current adjustment: %w", err)
+	}
+	now, err := vs.ReadCO2Context(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the probe before adjusting it: %w", err)
+	}
+	raw := now
+	if old.Gain != 0 {
+		raw = (now - old.Offset) / old.Gain
+	}
+	after := adj.Offset + adj.Gain*raw
+	if shift := math.Abs(after - now); shift > vaisalaMaxCalCorrection && !opts.Force {
+		return nil, fmt.Errorf("adjustment would move the reading by %.0f ppm (%.0f to %.0f), more than %.0f; force it if intended", shift, now, after, vaisalaMaxCalCorrection)
+	}
+
+	step := CalibrationStep{Command: fmt.Sprintf("%s %g %g", vaisalaCmdAdjustment, adj.Offset, adj.Gain)}
+	if opts.DryRun {
+		return []CalibrationStep{step}, nil
+	}
+	prompt := fmt.Sprintf("user adjustment of vaisala probe %s from offset %g gain %g to offset %g gain %g; it reads %.0f ppm now, %.0f after", vs.sensorID(), old.Offset, old.Gain, adj.Offset, adj.Gain, now, after)
+	if opts.Confirm == nil || !opts.Confirm(prompt) {
+		return nil, ErrNotConfirmed
+	}
+	reply, err := vs.command(ctx, portworker.Calibration, step.Command)
+	step.Reply = reply
+	if err == nil && rejected(reply) {
+		err = fmt.Errorf("probe rejected %s: %s", step.Command, reply)
+	}
+	return []CalibrationStep{step}, err
+}
+
+// CalibrationInfo reads the date and text of the probe's last calibration.
+// Terminal protocol only.
+func (vs *VaisalaSensor) CalibrationInfo(ctx context.Context) (CalibrationInfo, error) {
+	settings, err := vs.ReadSettings(ctx, []string{vaisalaCmdCalDate, vaisalaCmdCalText})
+	if err != nil {
+		return CalibrationInfo{}, err
+	}
+	return CalibrationInfo{Date: settings[vaisalaCmdCalDate], Text: strings.Trim(settings[vaisalaCmdCalText], `"`)}, nil
+}
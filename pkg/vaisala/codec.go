@@ -0,0 +1,93 @@
+package vaisala
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/demelere/sensor-control-modules/internal/sensorerr"
+)
+
+// The terminal protocol is one exchange per command. The driver writes a
+// command line; with ECHO on the probe repeats it, then prints its reply over
+// one or more lines, and in STOP mode (or after OPEN) ends with the prompt
+// '>' on a line of its own. A probe that prints no prompt, such as one with
+// its serial mode set to POLL and never opened, only prints the reply, so
+// request learns from the first prompt it sees which kind it is talking to.
+
+// prompt is what the probe prints, with no newline, when it is ready.
+const prompt = ">"
+
+var replyQuiet time.Duration // a multi-line reply from a probe without a prompt ends after this long without a line
+
+func init() {
+	replyQuiet = 200 * time.Millisecond
+}
+
+// request writes command and returns its reply lines, trimmed, without the
+// echo, the prompt, or blank lines. From a probe that prompts it reads up to
+// the prompt. From one that does not, it returns after the first line, or
+// with multiline once the probe has been quiet for replyQuiet. It runs on the
+// port worker.
+func (vs *VaisalaSensor) request(ctx context.Context, command string, multiline bool) ([]string, error) {
+	if err := vs.writeCommand(command); err != nil {
+		return nil, err
+	}
+	var (
+		lines   []string
+		partial string
+		seen    bool // anything of this exchange, echo included, so an earlier prompt is not taken as the end
+	)
+	for {
+		var wait time.Duration // the reader's own timeout
+		if len(lines) > 0 && !vs.prompted {
+			if !multiline {
+				return lines, nil
+			}
+			wait = replyQuiet
+		}
+		chunk, err := vs.reader.ReadUntil(ctx, wait, "\n"+prompt)
+		if errors.Is(err, sensorerr.ErrTimeout) && len(lines) > 0 {
+			vs.prompted = false // the prompt was switched off since it was learned
+			return lines, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read response: %w", err)
+		}
+		if chunk == prompt && partial == "" {
+			vs.prompted = true
+			if seen {
+				return lines, nil
+			}
+			continue
+		}
+		partial += chunk
+		if !strings.HasSuffix(chunk, "\n") { // a '>' inside the line
+			continue
+		}
+		line := strings.TrimSpace(partial)
+		partial = ""
+		if line == "" {
+			continue
+		}
+		if !seen && strings.EqualFold(line, command) {
+			seen = true // the echo
+			continue
+		}
+		seen = true
+		lines = append(lines, line)
+	}
+}
+
+// requestLine is request for a single-line reply, returning its first line.
+func (vs *VaisalaSensor) requestLine(ctx context.Context, command string) (string, error) {
+	lines, err := vs.request(ctx, command, false)
+	if err != nil {
+		return "", err
+	}
+	if len(lines) == 0 {
+		return "", fmt.Errorf("%w: empty reply to %s", sensorerr.ErrInvalidResponse, command)
+	}
+	return lines[0], nil
+}
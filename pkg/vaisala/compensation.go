@@ -0,0 +1,159 @@
+package vaisala
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/demelere/sensor-control-modules/internal/numparse"
+	"github.com/demelere/sensor-control-modules/internal/units"
+)
+
+// Compensation is an ambient condition the probe corrects its CO2 reading
+// for. The probe does not measure these itself, so the values it uses are
+// set from outside: once for a fixed installation, or continuously from
+// another sensor with AutoCompensate.
+type Compensation string
+
+const (
+	CompPressure    Compensation = "pressure"    // hPa, PC
+	CompTemperature Compensation = "temperature" // °C, TC
+	CompHumidity    Compensation = "humidity"    // %RH, RHC
+	CompOxygen      Compensation = "oxygen"      // %O2, OC
+)
+
+type compensationSpec struct {
+	command  string
+	unit     units.Unit
+	min, max float64
+	deadband float64 // smallest change worth sending
+}
+
+var compensations = map[Compensation]compensationSpec{
+	CompPressure:    {"pc", units.HectoPascal, 500, 1100, 0.5},
+	CompTemperature: {"tc", units.Celsius, -40, 60, 0.5},
+	CompHumidity:    {"rhc", units.Percent, 0, 100, 1},
+	CompOxygen:      {"oc", units.Percent, 0, 100, 0.1},
+}
+
+func compensationFor(c Compensation) (compensationSpec, error) {
+	spec, ok := compensations[c]
+	if !ok {
+		return compensationSpec{}, fmt.Errorf("unknown vaisala compensation %q (want pressure, temperature, humidity, or oxygen)", c)
+	}
+	return spec, nil
+}
+
+// CompensationUnit is the unit c is set and read in.
+func CompensationUnit(c Compensation) (units.Unit, error) {
+	spec, err := compensationFor(c)
+	return spec.unit, err
+}
+
+// SetCompensation sets the value the probe compensates for, in c's unit (see
+// CompensationUnit). Over Modbus only pressure can be set.
+func (vs *VaisalaSensor) SetCompensation(ctx context.Context, c Compensation, value float64) error {
+	spec, err := compensationFor(c)
+	if err != nil {
+		return err
+	}
+	if value < spec.min || value > spec.max {
+		return fmt.Errorf("%s compensation %g %s outside the probe's range %g-%g", c, value, spec.unit, spec.min, spec.max)
+	}
+	if vs.protocol == Modbus {
+		if c != CompPressure {
+			return fmt.Errorf("%s compensation needs the ascii protocol, over modbus only pressure has a register", c)
+		}
+		return vs.SetPressureCompensation(ctx, value)
+	}
+	cmd := fmt.Sprintf("%s %.2f", spec.command, value)
+	reply, err := vs.Command(ctx, cmd)
+	if err != nil {
+		return fmt.Errorf("failed to set %s compensation: %w", c, err)
+	}
+	if rejected(reply) {
+		return fmt.Errorf("probe rejected %s: %s", cmd, reply)
+	}
+	return nil
+}
+
+// Compensation reads the value the probe compensates for, in c's unit.
+func (vs *VaisalaSensor) Compensation(ctx context.Context, c Compensation) (float64, error) {
+	spec, err := compensationFor(c)
+	if err != nil {
+		return 0, err
+	}
+	if vs.protocol == Modbus {
+		if c != CompPressure {
+			return 0, fmt.Errorf("%s compensation needs the ascii protocol, over modbus only pressure has a register", c)
+		}
+		return vs.PressureCompensation(ctx)
+	}
+	settings, err := vs.ReadSettings(ctx, []string{spec.command})
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(settings[spec.command]) // e.g. "1013.0 hPa"
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("%w: no %s compensation value", ErrInvalidResponse, c)
+	}
+	v, err := numparse.ParseFloat(fields[0])
+	if err != nil {
+		return 0, fmt.Errorf("%w: failed to parse %s compensation: %v", ErrInvalidResponse, c, err)
+	}
+	return v, nil
+}
+
+// AutoCompensate keeps c up to date from another sensor until ctx is done.
+// Every interval (default 1m) it asks source for that sensor's latest value,
+// in any unit convertible to c's, and sets it when it has moved by more than
+// a small dead band since it was last set, so the probe's memory is not
+// written every minute for noise; a reconnected probe with a different
+// serial number is always set. source returns false when it has no recent
+// value; the probe then keeps the last one. Failures are logged and retried
+// at the next interval. An unknown or unsupported compensation is returned
+// straight away.
+func (vs *VaisalaSensor) AutoCompensate(ctx context.Context, c Compensation, source func() (Measurement, bool), interval time.Duration) error {
+	spec, err := compensationFor(c)
+	if err != nil {
+		return err
+	}
+	if vs.protocol == Modbus && c != CompPressure {
+		return fmt.Errorf("%s compensation needs the ascii protocol, over modbus only pressure has a register", c)
+	}
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	last, probe := math.NaN(), ""
+	for {
+		if sn := vs.Info().SerialNumber; sn != probe { // a replaced probe starts from its own setting
+			last, probe = math.NaN(), sn
+		}
+		if m, ok := source(); ok {
+			v, err := units.Convert(m.Value, units.Unit(m.Unit), spec.unit)
+			switch {
+			case err != nil:
+				log.Printf("vaisala %s compensation from %s: %v", c, m.Metric, err)
+			case math.IsNaN(last) || math.Abs(v-last) > spec.deadband:
+				if err := vs.SetCompensation(ctx, c, v); err != nil {
+					if ctx.Err() != nil {
+						return nil
+					}
+					log.Printf("failed to update vaisala %s compensation: %v", c, err)
+				} else {
+					last = v
+				}
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
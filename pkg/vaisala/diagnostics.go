@@ -0,0 +1,129 @@
+package vaisala
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/demelere/sensor-control-modules/internal/portworker"
+)
+
+// DeviceStatus is the probe's overall verdict on itself, worst first.
+type DeviceStatus string
+
+const (
+	StatusCritical DeviceStatus = "critical" // readings cannot be trusted, e.g. a failed measurement element
+	StatusError    DeviceStatus = "error"
+	StatusWarning  DeviceStatus = "warning" // readings continue, e.g. conditions outside the measuring range
+	StatusOK       DeviceStatus = "ok"
+)
+
+// HealthReport is what Diagnostics found.
+type HealthReport struct {
+	Time   time.Time         `json:"time"`
+	Info   Info              `json:"info"`
+	Status DeviceStatus      `json:"status"`
+	Faults []Fault           `json:"faults,omitempty"`
+	System map[string]string `json:"system,omitempty"` // SYSTEM fields by name; terminal protocol only
+}
+
+// Healthy reports whether the probe found nothing wrong with itself.
+func (h HealthReport) Healthy() bool { return h.Status == StatusOK }
+
+// regDeviceStatus is the GMP25x status register: 0 when healthy, otherwise
+// bits for a critical error, an error, and a warning.
+const regDeviceStatus = 0x0800
+
+var vaisalaRegexSystemKey *regexp.Regexp
+
+func init() {
+	vaisalaRegexSystemKey = regexp.MustCompile(`^\s*([^:]*?)\s*:\s*(.*?)\s*$`) // "Serial number : M1234567"
+}
+
+// Diagnostics asks the probe about its health: the error register (ERRS),
+// and over the terminal protocol the device summary (SYSTEM), or over Modbus
+// the status register. It runs at operator priority, so a poll cycle may be
+// delayed by the time SYSTEM takes. An error return means
+// the probe could not be asked.
+func (vs *VaisalaSensor) Diagnostics(ctx context.Context) (HealthReport, error) {
+	report := HealthReport{Info: vs.Info()}
+	faults, err := vs.Faults(ctx)
+	if err != nil {
+		return HealthReport{}, fmt.Errorf("failed to read error register: %w", err)
+	}
+	report.Faults = faults
+
+	if vs.protocol == Modbus {
+		var status uint16
+		err = vs.registers(ctx, portworker.Operator, func() error {
+			regs, err := vs.bus.ReadHoldingRegisters(ctx, regDeviceStatus, 1)
+			if err != nil {
+				return err
+			}
+			status = regs[0]
+			return nil
+		})
+		if err != nil {
+			return HealthReport{}, fmt.Errorf("failed to read status register: %w", err)
+		}
+		report.Status = statusFromRegister(status, faults)
+	} else {
+		reply, err := vs.command(ctx, portworker.Operator, "system")
+		if err != nil {
+			return HealthReport{}, fmt.Errorf("failed to read system info: %w", err)
+		}
+		report.System = parseSystem(strings.Split(reply, "\n"))
+		report.Status = statusFromFaults(faults)
+	}
+	report.Time = time.Now().UTC()
+	return report, nil
+}
+
+// parseSystem reads the "name : value" lines of a SYSTEM reply. Lines without
+// a colon, such as a banner, are skipped.
+func parseSystem(lines []string) map[string]string {
+	fields := map[string]string{}
+	for _, line := range lines {
+		m := vaisalaRegexSystemKey.FindStringSubmatch(line)
+		if m == nil || m[1] == "" {
+			continue
+		}
+		fields[m[1]] = m[2]
+	}
+	return fields
+}
+
+// statusFromFaults grades ERRS faults the way the probe's status register
+// would: a failing element is critical, anything out of range a warning.
+func statusFromFaults(faults []Fault) DeviceStatus {
+	status := StatusOK
+	for _, f := range faults {
+		switch f.Kind {
+		case FaultSensor:
+			return StatusCritical
+		case FaultRange:
+			if status == StatusOK {
+				status = StatusWarning
+			}
+		default:
+			status = StatusError
+		}
+	}
+	return status
+}
+
+func statusFromRegister(status uint16, faults []Fault) DeviceStatus {
+	switch {
+	case status&0x1 != 0:
+		return StatusCritical
+	case status&0x2 != 0:
+		return StatusError
+	case status&0x4 != 0:
+		return StatusWarning
+	case status != 0: // a bit this driver does not know
+		return statusFromFaults(append(faults, Fault{Kind: FaultOther, Message: fmt.Sprintf("status 0x%04x", status)}))
+	}
+	return statusFromFaults(faults)
+}
@@ -0,0 +1,256 @@
+package vaisala
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var vaisalaExportedSettings []string
+
+func init() {
+	// in the order ImportSettings writes them: the unit first, since the
+	// form and the compensations may be read in it
+	vaisalaExportedSettings = []string{"unit", "form", "intv", "filt"}
+}
+
+// Settings is a snapshot of a probe's configuration, saved as JSON so a
+// replacement probe can be set up identically. Settings are keyed by the
+// probe command that sets them ("intv": "1 s"); compensations by theirs
+// ("pc": "1013.0"), without the unit.
+type Settings struct {
+	Model           string            `json:"model,omitempty"`
+	SerialNumber    string            `json:"serial_number,omitempty"`
+	SoftwareVersion string            `json:"software_version,omitempty"`
+	Taken           time.Time         `json:"taken"`
+	Address         int               `json:"address,omitempty"`
+	Settings        map[string]string `json:"settings"`
+}
+
+// Difference is one setting whose value on the probe (Got) differs from the
+// reference (Want). An empty side means the setting is missing there.
+type Difference struct {
+	Setting string `json:"setting"`
+	Want    string `json:"want"`
+	Got     string `json:"got"`
+}
+
+func (d Difference) String() string {
+	return fmt.Sprintf("%s: want %q, probe has %q", d.Setting, d.Want, d.Got)
+}
+
+// ExportSettings reads the probe's output unit, form, interval, filtering,
+// address, and compensations. Settings this probe's firmware does not know
+// are left out. It needs the terminal protocol.
+func (vs *VaisalaSensor) ExportSettings(ctx context.Context) (Settings, error) {
+	if vs.protocol == Modbus {
+		return Settings{}, fmt.Errorf("exporting settings needs the ascii protocol, the probe is on modbus")
+	}
+	info := vs.Info()
+	s := Settings{Model: info.Model, SerialNumber: info.SerialNumber, SoftwareVersion: info.SoftwareVersion, Taken: time.Now().UTC(), Settings: map[string]string{}}
+	names := append([]string(nil), vaisalaExportedSettings...)
+	for _, c := range sortedCompensations() {
+		names = append(names, compensations[c].command)
+	}
+	for _, name := range names {
+		v, ok, err := vs.query(ctx, name)
+		if err != nil {
+			return Settings{}, err
+		}
+		if !ok {
+			continue
+		}
+		if isCompensation(name) {
+			v, _, _ = strings.Cut(v, " ") // "1013.0 hPa"
+		}
+		s.Settings[name] = v
+	}
+	v, ok, err := vs.query(ctx, "addr")
+	if err != nil {
+		return Settings{}, err
+	}
+	if ok {
+		if s.Address, err = strconv.Atoi(v); err != nil {
+			return Settings{}, fmt.Errorf("%w: address %q", ErrInvalidResponse, v)
+		}
+	}
+	return s, nil
+}
+
+// ImportSettings writes s to the probe, then reads it back and returns
+// whatever still differs. Settings other than the exported ones are written
+// too, after them. A different address is set last and the driver follows
+// it; that is refused for a probe on a shared line, where the address is how
+// the others are told apart.
+func (vs *VaisalaSensor) ImportSettings(ctx context.Context, s Settings) ([]Difference, error) {
+	if vs.protocol == Modbus {
+		return nil, fmt.Errorf("importing settings needs the ascii protocol, the probe is on modbus")
+	}
+	for _, name := range importOrder(s.Settings) {
+		reply, err := vs.Command(ctx, name+" "+s.Settings[name])
+		if err != nil {
+			return nil, fmt.Errorf("failed to set %s: %w", name, err)
+		}
+		if rejected(reply) {
+			return nil, fmt.Errorf("probe rejected %s %q: %s", name, s.Settings[name], reply)
+		}
+	}
+	if s.Address != 0 {
+		if err := vs.readdress(ctx, s.Address); err != nil {
+			return nil, err
+		}
+	}
+
+	got, err := vs.ExportSettings(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("imported, but failed to read back: %w", err)
+	}
+	return CompareSettings(s, got), nil
+}
+
+// readdress moves the probe to address, unless it is there already.
+func (vs *VaisalaSensor) readdress(ctx context.Context, address int) error {
+	v, ok, err := vs.query(ctx, "addr")
+	if err != nil || !ok {
+		return err
+	}
+	if current, _ := strconv.Atoi(v); current == address {
+		return nil
+	}
+	if vs.line != nil {
+		return fmt.Errorf("cannot move a probe on a shared line to address %d, set it with the probe on its own", address)
+	}
+	reply, err := vs.Command(ctx, fmt.Sprintf("addr %d", address))
+	if err != nil {
+		return fmt.Errorf("failed to set address: %w", err)
+	}
+	if rejected(reply) {
+		return fmt.Errorf("probe rejected address %d: %s", address, reply)
+	}
+	return vs.port.Do(func() error {
+		vs.defaultAddress = address // the OPEN after a reconnect must use it
+		return nil
+	})
+}
+
+// query asks for one setting's value. ok is false when the probe does not
+// know the command.
+func (vs *VaisalaSensor) query(ctx context.Context, name string) (value string, ok bool, err error) {
+	reply, err := vs.Command(ctx, name)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	if rejected(reply) {
+		return "", false, nil
+	}
+	if i := strings.LastIndex(reply, ":"); i >= 0 {
+		reply = reply[i+1:]
+	}
+	return strings.TrimSpace(reply), true, nil
+}
+
+// CompareSettings lists the settings, address included, that differ between
+// want and got, sorted by name. Whitespace and case are not significant.
+// Identity fields are not compared, since a replacement probe is expected to
+// differ there.
+func CompareSettings(want, got Settings) []Difference {
+	names := map[string]bool{}
+	for name := range want.Settings {
+		names[name] = true
+	}
+	for name := range got.Settings {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	var diffs []Difference
+	if want.Address != 0 && want.Address != got.Address {
+		diffs = append(diffs, Difference{Setting: "addr", Want: strconv.Itoa(want.Address), Got: strconv.Itoa(got.Address)})
+	}
+	for _, name := range sorted {
+		w, g := want.Settings[name], got.Settings[name]
+		if !strings.EqualFold(strings.Join(strings.Fields(w), " "), strings.Join(strings.Fields(g), " ")) {
+			diffs = append(diffs, Difference{Setting: name, Want: w, Got: g})
+		}
+	}
+	return diffs
+}
+
+// importOrder puts the exported settings first, in their order, then the
+// compensations, then anything else by name.
+func importOrder(settings map[string]string) []string {
+	rank := func(name string) int {
+		for i, n := range vaisalaExportedSettings {
+			if n == name {
+				return i
+			}
+		}
+		if isCompensation(name) {
+			return len(vaisalaExportedSettings)
+		}
+		return len(vaisalaExportedSettings) + 1
+	}
+	names := make([]string, 0, len(settings))
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if ri, rj := rank(names[i]), rank(names[j]); ri != rj {
+			return ri < rj
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+func isCompensation(command string) bool {
+	for _, spec := range compensations {
+		if spec.command == command {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedCompensations() []Compensation {
+	out := make([]Compensation, 0, len(compensations))
+	for c := range compensations {
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+// SaveSettings writes s to path as indented JSON.
+func SaveSettings(path string, s Settings) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode settings: %v", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write settings: %w", err)
+	}
+	return nil
+}
+
+// LoadSettings reads a file written by SaveSettings.
+func LoadSettings(path string) (Settings, error) {
+	var s Settings
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return s, fmt.Errorf("failed to read settings: %w", err)
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return s, fmt.Errorf("failed to parse settings %s: %v", path, err)
+	}
+	return s, nil
+}
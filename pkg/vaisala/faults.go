@@ -0,0 +1,73 @@
+package vaisala
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/demelere/sensor-control-modules/internal/portworker"
+)
+
+// FaultKind classifies an error the probe reports about itself, as opposed to
+// a failure to communicate with it.
+type FaultKind string
+
+const (
+	FaultSensor FaultKind = "sensor"       // measurement element damaged or failing
+	FaultRange  FaultKind = "out_of_range" // measurement or conditions outside the probe's range
+	FaultOther  FaultKind = "other"
+)
+
+// Fault is one active entry in the probe's error register.
+type Fault struct {
+	Kind    FaultKind `json:"kind"`
+	Message string    `json:"message"`
+}
+
+var (
+	vaisalaRegexNoErrors    = regexp.MustCompile(`(?i)no (active )?errors`)
+	vaisalaRegexErrorPrefix = regexp.MustCompile(`(?i)^(error|err)\s*[:\d]*\s*`)
+)
+
+// Faults reads the probe's error register (ERRS, or the error flags register
+// over Modbus) at routine priority and returns the active faults, none when
+// the probe reports no errors. An error return means the probe could not be
+// asked, never that it is faulty.
+func (vs *VaisalaSensor) Faults(ctx context.Context) ([]Fault, error) {
+	if vs.protocol == Modbus {
+		return vs.modbusFaults(ctx)
+	}
+	reply, err := vs.command(ctx, portworker.Routine, "errs")
+	if err != nil {
+		return nil, err
+	}
+	return parseFaults(reply), nil
+}
+
+// parseFaults splits an ERRS reply, which lists the active errors separated
+// by semicolons or one to a line.
+func parseFaults(reply string) []Fault {
+	if vaisalaRegexNoErrors.MatchString(reply) {
+		return nil
+	}
+	var faults []Fault
+	for _, part := range strings.FieldsFunc(reply, func(r rune) bool { return r == ';' || r == '\n' }) {
+		msg := strings.TrimSpace(vaisalaRegexErrorPrefix.ReplaceAllString(strings.TrimSpace(part), ""))
+		if msg == "" {
+			continue
+		}
+		faults = append(faults, Fault{Kind: faultKind(msg), Message: msg})
+	}
+	return faults
+}
+
+func faultKind(msg string) FaultKind {
+	lower := strings.ToLower(msg)
+	switch {
+	case strings.Contains(lower, "range"):
+		return FaultRange
+	case strings.Contains(lower, "sensor"), strings.Contains(lower, "damage"), strings.Contains(lower, "fail"):
+		return FaultSensor
+	}
+	return FaultOther
+}
@@ -0,0 +1,57 @@
+package vaisala
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/demelere/sensor-control-modules/internal/numparse"
+)
+
+// The probe averages its own measurement with the FILT factor: each output is
+// factor times the new measurement plus (1 - factor) times the last output.
+// 1 turns the filtering off; 0.1 averages over roughly the last ten readings.
+const (
+	MinFiltering = 0.1
+	MaxFiltering = 1.0
+)
+
+// SetFiltering sets the probe's filtering factor, between MinFiltering and
+// MaxFiltering. It needs the terminal protocol.
+func (vs *VaisalaSensor) SetFiltering(ctx context.Context, factor float64) error {
+	if factor < MinFiltering || factor > MaxFiltering {
+		return fmt.Errorf("filtering factor %g outside the probe's range %g-%g", factor, MinFiltering, MaxFiltering)
+	}
+	if vs.protocol == Modbus {
+		return fmt.Errorf("setting the filtering factor needs the ascii protocol, the probe is on modbus")
+	}
+	cmd := fmt.Sprintf("filt %.3f", factor)
+	reply, err := vs.Command(ctx, cmd)
+	if err != nil {
+		return fmt.Errorf("failed to set filtering: %w", err)
+	}
+	if rejected(reply) {
+		return fmt.Errorf("probe rejected %s: %s", cmd, reply)
+	}
+	return nil
+}
+
+// Filtering reads the probe's filtering factor.
+func (vs *VaisalaSensor) Filtering(ctx context.Context) (float64, error) {
+	if vs.protocol == Modbus {
+		return 0, fmt.Errorf("reading the filtering factor needs the ascii protocol, the probe is on modbus")
+	}
+	settings, err := vs.ReadSettings(ctx, []string{"filt"})
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(settings["filt"]) // "1.000"
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("%w: no filtering factor", ErrInvalidResponse)
+	}
+	v, err := numparse.ParseFloat(fields[0])
+	if err != nil {
+		return 0, fmt.Errorf("%w: failed to parse filtering factor: %v", ErrInvalidResponse, err)
+	}
+	return v, nil
+}
@@ -0,0 +1,306 @@
+package vaisala
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/demelere/sensor-control-modules/internal/numparse"
+	"github.com/demelere/sensor-control-modules/internal/portworker"
+	"github.com/demelere/sensor-control-modules/internal/sensorerr"
+	"github.com/demelere/sensor-control-modules/internal/units"
+)
+
+// Parameter is a quantity the probe can report: its name in the probe's
+// output form and the metric and unit the driver reports it as.
+type Parameter struct {
+	Quantity string `json:"quantity"` // e.g. "CO2", "T"
+	Metric   string `json:"metric"`
+	Unit     string `json:"unit"`
+}
+
+// Measurement is one value from a multi-parameter read, in the unit of its
+// Parameter.
+type Measurement struct {
+	Metric string  `json:"metric"`
+	Value  float64 `json:"value"`
+	Unit   string  `json:"unit"`
+}
+
+var knownParameters = []Parameter{
+	{"CO2", "co2", string(units.PPM)},
+	{"T", "temperature", string(units.Celsius)},
+	{"RH", "humidity", string(units.Percent)},
+	{"P", "pressure", string(units.HectoPascal)},
+}
+
+// modbusParameters are the quantities the GMP25x has measurement registers
+// for, and what a Modbus read reports when no parameters are set.
+var modbusParameters = map[string]uint16{
+	"CO2": regCO2,
+	"T":   regTemperature,
+}
+
+// fieldName finds each "NAME=" in a send reply, e.g.
+// "CO2=    412 ppm T= 23.4 'C".
+var fieldName = regexp.MustCompile(`([A-Za-z][A-Za-z0-9]*)\s*=`)
+
+// SetParameters selects, by metric name ("co2", "temperature", "humidity",
+// "pressure"), what each read reports. Over the terminal protocol the probe's
+// output form is set to them with FORM at the next Open; over Modbus only co2
+// and temperature have registers. None leaves the probe's form alone, and
+// reads report whatever it prints (over Modbus, co2 and temperature).
+func (vs *VaisalaSensor) SetParameters(metrics []string) error {
+	var params []Parameter
+	for _, m := range metrics {
+		p, ok := parameterFor(func(p Parameter) bool { return p.Metric == strings.ToLower(strings.TrimSpace(m)) })
+		if !ok {
+			return fmt.Errorf("unknown vaisala parameter %q", m)
+		}
+		if !hasParameter(params, p) {
+			params = append(params, p)
+		}
+	}
+	if err := checkModbusParameters(vs.protocol, params); err != nil {
+		return err
+	}
+	vs.parameters = params
+	return nil
+}
+
+// Parameters returns what reads will report, where that is known before the
+// probe answers: the parameters set with SetParameters or, over Modbus, the
+// default co2 and temperature. Nil means whatever the probe's form prints.
+func (vs *VaisalaSensor) Parameters() []Parameter {
+	if len(vs.parameters) > 0 {
+		return append([]Parameter(nil), vs.parameters...)
+	}
+	if vs.protocol == Modbus {
+		return defaultModbusParameters()
+	}
+	return nil
+}
+
+func defaultModbusParameters() []Parameter {
+	var params []Parameter
+	for _, p := range knownParameters {
+		if _, ok := modbusParameters[p.Quantity]; ok {
+			params = append(params, p)
+		}
+	}
+	return params
+}
+
+func checkModbusParameters(protocol Protocol, params []Parameter) error {
+	if protocol != Modbus {
+		return nil
+	}
+	for _, p := range params {
+		if _, ok := modbusParameters[p.Quantity]; !ok {
+			return fmt.Errorf("vaisala parameter %s has no modbus register, only co2 and temperature do", p.Metric)
+		}
+	}
+	return nil
+}
+
+func parameterFor(match func(Parameter) bool) (Parameter, bool) {
+	for _, p := range knownParameters {
+		if match(p) {
+			return p, true
+		}
+	}
+	return Parameter{}, false
+}
+
+func hasParameter(params []Parameter, p Parameter) bool {
+	for _, have := range params {
+		if have == p {
+			return true
+		}
+	}
+	return false
+}
+
+// formCommand sets the output form to one "NAME= value unit" field per
+// parameter, e.g. form "CO2=" CO2 " " U " T=" T " " U #r #n.
+func formCommand(params []Parameter) string {
+	var b strings.Builder
+	b.WriteString("form")
+	for i, p := range params {
+		sep := " "
+		if i == 0 {
+			sep = ""
+		}
+		fmt.Fprintf(&b, ` "%s%s=" %s " " U`, sep, p.Quantity, p.Quantity)
+	}
+	b.WriteString(" #r #n")
+	return b.String()
+}
+
+// setForm points the probe's output form at the configured parameters.
+func (vs *VaisalaSensor) setForm() error {
+	if len(vs.parameters) == 0 {
+		return nil
+	}
+	cmd := formCommand(vs.parameters)
+	reply, err := vs.requestLine(context.Background(), cmd)
+	if err != nil {
+		return fmt.Errorf("failed to read form reply: %w", err)
+	}
+	if rejected(reply) {
+		return fmt.Errorf("probe rejected %s: %s", cmd, strings.TrimSpace(reply))
+	}
+	return nil
+}
+
+// ReadMeasurements requests one measurement and returns every parameter in
+// the reply (see SetParameters), in the order the probe printed them. Like
+// ReadCO2 it waits behind commands already queued on the port; errors wrap
+// ErrInvalidResponse when a field cannot be parsed.
+func (vs *VaisalaSensor) ReadMeasurements(ctx context.Context) ([]Measurement, error) {
+	if values, ok, err := vs.nextSample(ctx); ok {
+		return values, err
+	}
+	var out []Measurement
+	err := vs.port.Submit(ctx, portworker.Routine, func() error {
+		var err error
+		out, err = vs.readMeasurements(ctx)
+		return err
+	})
+	if errors.Is(err, portworker.ErrStopped) {
+		return nil, fmt.Errorf("vaisala sensor is not open: %w", err)
+	} else if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (vs *VaisalaSensor) readMeasurements(ctx context.Context) ([]Measurement, error) {
+	if vs.serialConn == nil {
+		return nil, fmt.Errorf("vaisala sensor is not open")
+	}
+	if vs.bus != nil {
+		var out []Measurement
+		for _, p := range vs.Parameters() {
+			v, err := vs.readFloat(ctx, modbusParameters[p.Quantity])
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", p.Metric, err)
+			}
+			out = append(out, Measurement{Metric: p.Metric, Value: v, Unit: p.Unit})
+		}
+		return out, nil
+	}
+
+	return vs.send(ctx)
+}
+
+// send asks for one sample with "send" and parses the reply.
+func (vs *VaisalaSensor) send(ctx context.Context) ([]Measurement, error) {
+	resume, err := vs.pauseRun() // only if run mode started while this was queued
+	if err != nil {
+		return nil, err
+	}
+	defer resume()
+	response, err := vs.requestLine(ctx, "send")
+	if err != nil {
+		return nil, err
+	}
+	return parseSend(response)
+}
+
+// parseSend reads every field of a send reply the driver has a metric for;
+// other fields are skipped.
+func parseSend(line string) ([]Measurement, error) {
+	found := fieldName.FindAllStringSubmatchIndex(line, -1)
+	if len(found) == 0 {
+		return nil, fmt.Errorf("%w: no NAME=value fields in %q", sensorerr.ErrInvalidResponse, strings.TrimSpace(line))
+	}
+	var out []Measurement
+	for i, loc := range found {
+		name := line[loc[2]:loc[3]]
+		p, ok := parameterFor(func(p Parameter) bool { return strings.EqualFold(p.Quantity, name) })
+		if !ok {
+			continue
+		}
+		end := len(line)
+		if i+1 < len(found) {
+			end = found[i+1][0]
+		}
+		fields := strings.Fields(line[loc[1]:end])
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("%w: no value for %s", sensorerr.ErrInvalidResponse, name)
+		}
+		value, printed := fields[0], ""
+		if j := unitStart(value); j > 0 { // a unit printed without a space, "23.4'C"
+			value, printed = value[:j], value[j:]
+		} else if len(fields) > 1 {
+			printed = fields[1]
+		}
+		v, err := numparse.ParseFloat(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to parse %s value: %v", sensorerr.ErrInvalidResponse, name, err)
+		}
+		if v, err = toParameterUnit(p, v, printed); err != nil {
+			return nil, fmt.Errorf("%w: %v", sensorerr.ErrInvalidResponse, err)
+		}
+		out = append(out, Measurement{Metric: p.Metric, Value: v, Unit: p.Unit})
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("%w: no known parameters in %q", sensorerr.ErrInvalidResponse, strings.TrimSpace(line))
+	}
+	return out, nil
+}
+
+// unitStart is the index where a unit follows the number in field, or -1.
+// e and E are exponents, and an apostrophe starts a unit only before a
+// letter ("'C"); otherwise it groups thousands ("1'234").
+func unitStart(field string) int {
+	for i, r := range field {
+		switch {
+		case r == '%' || r == '°':
+			return i
+		case r == '\'' && i+1 < len(field) && unicode.IsLetter(rune(field[i+1])):
+			return i
+		case unicode.IsLetter(r) && r != 'e' && r != 'E':
+			return i
+		}
+	}
+	return -1
+}
+
+// toParameterUnit converts v from the unit the probe printed it in. A field
+// without a unit is taken to be in the parameter's unit already.
+func toParameterUnit(p Parameter, v float64, printed string) (float64, error) {
+	var from units.Unit
+	switch strings.TrimLeft(printed, "'°") {
+	case "":
+		return v, nil
+	case "ppm":
+		from = units.PPM
+	case "%":
+		if p.Quantity == "CO2" { // the probe's %-scale
+			return v * 10000, nil
+		}
+		from = units.Percent
+	case "%RH":
+		from = units.Percent
+	case "C":
+		from = units.Celsius
+	case "F":
+		from = units.Fahrenheit
+	case "hPa", "mbar":
+		from = units.HectoPascal
+	case "psi", "psia":
+		from = units.PSI
+	default:
+		return 0, fmt.Errorf("unexpected unit %q for %s", printed, p.Quantity)
+	}
+	out, err := units.Convert(v, from, units.Unit(p.Unit))
+	if err != nil {
+		return 0, fmt.Errorf("%s in %s: %v", p.Quantity, printed, err)
+	}
+	return out, nil
+}
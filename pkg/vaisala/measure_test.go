@@ -0,0 +1,69 @@
+package vaisala
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/demelere/sensor-control-modules/internal/sensorerr"
+)
+
+func TestParseSend(t *testing.T) {
+	for _, tc := range []struct {
+		line string
+		want map[string]float64
+	}{
+		{"CO2=  1234 ppm", map[string]float64{"co2": 1234}},
+		{"CO2=  1234 ppm T= 23.4 'C RH= 45.6 %RH P= 1013.2 hPa\r\n", map[string]float64{"co2": 1234, "temperature": 23.4, "humidity": 45.6, "pressure": 1013.2}},
+		// Decimal commas, as firmware set to a European locale prints them.
+		{"CO2=1234,5 ppm T=23,4 'C", map[string]float64{"co2": 1234.5, "temperature": 23.4}},
+		{"CO2= 1.234,5 ppm", map[string]float64{"co2": 1234.5}},
+		// Units printed without a space, or not at all.
+		{"CO2=1234ppm T=23.4'C RH=45.6%RH", map[string]float64{"co2": 1234, "temperature": 23.4, "humidity": 45.6}},
+		{"CO2=1.2e3ppm", map[string]float64{"co2": 1200}},
+		{"CO2=1234 T=23.4", map[string]float64{"co2": 1234, "temperature": 23.4}},
+		{"CO2=1'234 ppm", map[string]float64{"co2": 1234}},
+		// Units other than the metric's are converted.
+		{"CO2= 0.12 %", map[string]float64{"co2": 1200}},
+		{"T= 74.3 'F", map[string]float64{"temperature": 23.5}},
+		{"T= 23.4 °C", map[string]float64{"temperature": 23.4}},
+		{"P= 14.5038 psia", map[string]float64{"pressure": 1000}},
+		{"P= 1000 mbar", map[string]float64{"pressure": 1000}},
+		// Lower case names, fields the driver has no metric for, and tabs.
+		{"co2=1234\ttd=12.1 'C\trh=45.6 %RH", map[string]float64{"co2": 1234, "humidity": 45.6}},
+	} {
+		got, err := parseSend(tc.line)
+		if err != nil {
+			t.Errorf("parseSend(%q): %v", tc.line, err)
+			continue
+		}
+		if len(got) != len(tc.want) {
+			t.Errorf("parseSend(%q) = %v, want %v", tc.line, got, tc.want)
+			continue
+		}
+		for _, m := range got {
+			if want, ok := tc.want[m.Metric]; !ok || math.Abs(m.Value-want) > 1e-3*max(1, math.Abs(want)) {
+				t.Errorf("parseSend(%q): %s = %v, want %v", tc.line, m.Metric, m.Value, tc.want[m.Metric])
+			}
+		}
+	}
+}
+
+func TestParseSendInvalid(t *testing.T) {
+	for _, line := range []string{
+		"",
+		"1234 ppm",
+		"TD=12.1 'C",
+		"CO2=",
+		"CO2= ppm",
+		"CO2=NaN ppm",
+		"CO2=Inf",
+		"CO2=1,2.3,4 ppm",
+		"CO2=1234 furlongs",
+		"T=23.4 'K",
+	} {
+		if got, err := parseSend(line); !errors.Is(err, sensorerr.ErrInvalidResponse) {
+			t.Errorf("parseSend(%q) = %v, %v, want an invalid response", line, got, err)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package vaisala
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/demelere/sensor-control-modules/internal/modbus"
+	"github.com/demelere/sensor-control-modules/internal/portworker"
+	"github.com/demelere/sensor-control-modules/internal/sensorerr"
+)
+
+// Protocol is how the driver talks to the probe.
+type Protocol string
+
+const (
+	ASCII  Protocol = "ascii"  // the probe's terminal protocol ("send", "errs"), the default
+	Modbus Protocol = "modbus" // Modbus RTU, for multi-drop RS-485 buses without the terminal protocol
+)
+
+// GMP25x holding registers, 0-based. Measurements and settings are 32-bit
+// floats, low word first.
+const (
+	regCO2             = 0x0000 // ppm
+	regTemperature     = 0x0004 // probe temperature, °C
+	regPressureComp    = 0x0202 // pressure used for compensation, hPa (read/write)
+	regErrorFlags      = 0x0802 // 32-bit error bit field, 0 when healthy
+	objectSerialNumber = 0x80   // Vaisala's private device identification object
+)
+
+// modbusErrors names the bits of the error register.
+var modbusErrors = []struct {
+	bit  uint
+	kind FaultKind
+	msg  string
+}{
+	{0, FaultSensor, "CO2 measurement failure"},
+	{1, FaultSensor, "temperature measurement failure"},
+	{2, FaultRange, "CO2 reading out of range"},
+	{3, FaultRange, "temperature out of range"},
+	{4, FaultOther, "supply voltage out of range"},
+	{5, FaultOther, "internal memory error"},
+}
+
+// SetProtocol selects the protocol from the next Open; "" means ASCII. Over
+// Modbus, Address is the probe's Modbus address (1-247) and the line runs
+// 8N2; Command, Apply, and ReadSettings need the terminal protocol.
+func (vs *VaisalaSensor) SetProtocol(p Protocol) error {
+	switch p {
+	case "", ASCII:
+		vs.protocol = ASCII
+	case Modbus:
+		if vs.defaultAddress > 247 {
+			return fmt.Errorf("modbus address %d out of range 1-247", vs.defaultAddress)
+		}
+		if err := checkModbusParameters(Modbus, vs.parameters); err != nil {
+			return err
+		}
+		vs.protocol = Modbus
+	default:
+		return fmt.Errorf("unknown vaisala protocol %q (want %q or %q)", p, ASCII, Modbus)
+	}
+	return nil
+}
+
+// collectModbusInfo fills in the probe's identity from its device
+// identification objects. A probe that does not implement one leaves that
+// field empty; one that does not answer at all fails the open.
+func (vs *VaisalaSensor) collectModbusInfo() error {
+	for _, f := range []struct {
+		object byte
+		field  *string
+	}{
+		{1, &vs.sensorModel},
+		{2, &vs.sensorSoftwareVersion},
+		{objectSerialNumber, &vs.sensorSerialNumber},
+	} {
+		v, err := vs.bus.DeviceID(context.Background(), f.object)
+		var exc *modbus.Exception
+		if errors.As(err, &exc) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		*f.field = v
+	}
+	return nil
+}
+
+func (vs *VaisalaSensor) readFloat(ctx context.Context, addr uint16) (float64, error) {
+	regs, err := vs.bus.ReadHoldingRegisters(ctx, addr, 2)
+	if err != nil {
+		return 0, err
+	}
+	v := modbus.Float32(regs)
+	if math.IsNaN(v) { // what the probe reports while warming up
+		return 0, fmt.Errorf("%w: probe reports no value for register 0x%04x", sensorerr.ErrInvalidResponse, addr)
+	}
+	return v, nil
+}
+
+// registers runs fn against the Modbus client on the port worker.
+func (vs *VaisalaSensor) registers(ctx context.Context, priority portworker.Priority, fn func() error) error {
+	err := vs.port.Submit(ctx, priority, func() error {
+		if vs.serialConn == nil {
+			return fmt.Errorf("vaisala sensor is not open")
+		}
+		if vs.bus == nil {
+			return fmt.Errorf("vaisala sensor is not using modbus")
+		}
+		return fn()
+	})
+	if errors.Is(err, portworker.ErrStopped) {
+		return fmt.Errorf("vaisala sensor is not open: %w", err)
+	}
+	return err
+}
+
+// ReadTemperature returns the probe's temperature in °C. Modbus only.
+func (vs *VaisalaSensor) ReadTemperature(ctx context.Context) (float64, error) {
+	var t float64
+	err := vs.registers(ctx, portworker.Routine, func() (err error) {
+		t, err = vs.readFloat(ctx, regTemperature)
+		return err
+	})
+	return t, err
+}
+
+// PressureCompensation returns the ambient pressure, in hPa, the probe
+// compensates its CO2 reading for. Modbus only.
+func (vs *VaisalaSensor) PressureCompensation(ctx context.Context) (float64, error) {
+	var p float64
+	err := vs.registers(ctx, portworker.Operator, func() (err error) {
+		p, err = vs.readFloat(ctx, regPressureComp)
+		return err
+	})
+	return p, err
+}
+
+// SetPressureCompensation sets the ambient pressure in hPa, e.g. from a
+// barometer on the rig. Modbus only; SetCompensation works over either
+// protocol.
+func (vs *VaisalaSensor) SetPressureCompensation(ctx context.Context, hPa float64) error {
+	if hPa < 500 || hPa > 1100 {
+		return fmt.Errorf("pressure %g hPa outside the probe's compensation range 500-1100", hPa)
+	}
+	return vs.registers(ctx, portworker.Operator, func() error {
+		return vs.bus.WriteRegisters(ctx, regPressureComp, modbus.Float32Registers(hPa))
+	})
+}
+
+func (vs *VaisalaSensor) modbusFaults(ctx context.Context) ([]Fault, error) {
+	var flags uint32
+	err := vs.registers(ctx, portworker.Routine, func() error {
+		regs, err := vs.bus.ReadHoldingRegisters(ctx, regErrorFlags, 2)
+		if err != nil {
+			return err
+		}
+		flags = modbus.Uint32(regs)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return parseErrorFlags(flags), nil
+}
+
+func parseErrorFlags(flags uint32) []Fault {
+	var faults []Fault
+	for _, e := range modbusErrors {
+		if flags&(1<<e.bit) != 0 {
+			faults = append(faults, Fault{Kind: e.kind, Message: e.msg})
+			flags &^= 1 << e.bit
+		}
+	}
+	for bit := uint(0); flags != 0; bit++ {
+		if flags&(1<<bit) != 0 {
+			faults = append(faults, Fault{Kind: FaultOther, Message: fmt.Sprintf("error bit %d", bit)})
+			flags &^= 1 << bit
+		}
+	}
+	return faults
+}
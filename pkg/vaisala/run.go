@@ -0,0 +1,267 @@
+package vaisala
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/demelere/sensor-control-modules/internal/portworker"
+	"github.com/demelere/sensor-control-modules/internal/sensorerr"
+	"github.com/demelere/sensor-control-modules/internal/serialio"
+)
+
+// runSettle is how long the probe may keep sending after "s" before what it
+// sent is thrown away.
+var runSettle = 200 * time.Millisecond
+
+// runState is the probe's continuous output (RUN mode), if on. It has its
+// own lock because readers wait on it while the port worker is busy reading
+// the stream.
+type runState struct {
+	lock     sync.Mutex
+	interval time.Duration // 0 in poll mode
+	stop     chan struct{} // closed by StopRun to end follow
+	done     chan struct{} // closed when follow has returned
+	next     chan struct{} // closed when a sample newer than taken arrives
+	seq      uint64        // samples received
+	taken    uint64        // seq of the last sample handed to a reader
+	values   []Measurement
+	err      error
+}
+
+// StartRun switches the probe from answering "send" to printing a sample
+// every interval by itself (INTV, then R), which saves a command per sample.
+// interval is rounded to whole seconds, at least 1s. Until StopRun or Close,
+// ReadCO2 and ReadMeasurements return the next sample the probe prints, and
+// commands stop the output around themselves. Terminal protocol only, and not
+// on a Bus other probes are open on.
+func (vs *VaisalaSensor) StartRun(interval time.Duration) error {
+	interval = max(interval.Round(time.Second), time.Second)
+	if vs.line != nil && vs.line.shared(vs) {
+		return fmt.Errorf("run mode needs the bus to itself, other probes are open on it")
+	}
+	vs.run.lock.Lock()
+	if vs.run.interval > 0 {
+		vs.run.lock.Unlock()
+		return fmt.Errorf("vaisala sensor is already in run mode")
+	}
+	vs.run.interval = interval
+	vs.run.stop, vs.run.done = make(chan struct{}), make(chan struct{})
+	vs.run.next = make(chan struct{})
+	vs.run.taken = vs.run.seq
+	stop, done := vs.run.stop, vs.run.done
+	vs.run.lock.Unlock()
+
+	err := vs.port.Do(func() error {
+		if vs.serialConn == nil {
+			return fmt.Errorf("vaisala sensor is not open")
+		}
+		if vs.bus != nil {
+			return fmt.Errorf("run mode needs the ascii protocol, the probe is on modbus")
+		}
+		return vs.enterRun(interval)
+	})
+	if errors.Is(err, portworker.ErrStopped) {
+		err = fmt.Errorf("vaisala sensor is not open: %w", err)
+	}
+	if err != nil {
+		vs.run.lock.Lock()
+		vs.run.interval = 0
+		vs.run.lock.Unlock()
+		close(done)
+		return err
+	}
+	go vs.follow(stop, done, interval)
+	return nil
+}
+
+// StopRun stops the probe's continuous output and returns it to answering
+// "send". It does nothing in poll mode.
+func (vs *VaisalaSensor) StopRun() error {
+	if !vs.endRun() {
+		return nil
+	}
+	err := vs.port.Do(vs.exitRun)
+	if errors.Is(err, portworker.ErrStopped) { // closed meanwhile, nothing left to stop
+		return nil
+	}
+	return err
+}
+
+// Running reports whether the probe is in run mode.
+func (vs *VaisalaSensor) Running() bool {
+	return vs.runInterval() > 0
+}
+
+func (vs *VaisalaSensor) runInterval() time.Duration {
+	vs.run.lock.Lock()
+	defer vs.run.lock.Unlock()
+	return vs.run.interval
+}
+
+// endRun leaves run mode on the driver's side, waiting for follow to return,
+// and reports whether it was on.
+func (vs *VaisalaSensor) endRun() bool {
+	vs.run.lock.Lock()
+	if vs.run.interval == 0 {
+		vs.run.lock.Unlock()
+		return false
+	}
+	vs.run.interval = 0
+	stop, done := vs.run.stop, vs.run.done
+	vs.run.lock.Unlock()
+	close(stop)
+	<-done
+	return true
+}
+
+// enterRun sets the output interval and starts the output. It runs on the
+// port worker.
+func (vs *VaisalaSensor) enterRun(interval time.Duration) error {
+	cmd := fmt.Sprintf("intv %d s", int(interval/time.Second))
+	reply, err := vs.requestLine(context.Background(), cmd)
+	if err != nil {
+		return fmt.Errorf("failed to read %s reply: %w", cmd, err)
+	}
+	if rejected(reply) {
+		return fmt.Errorf("probe rejected %s: %s", cmd, strings.TrimSpace(reply))
+	}
+	return vs.writeCommand("r")
+}
+
+// exitRun stops the output and drops whatever the probe sent meanwhile. It
+// runs on the port worker.
+func (vs *VaisalaSensor) exitRun() error {
+	if vs.serialConn == nil {
+		return nil
+	}
+	if _, err := vs.serialConn.Write([]byte("s\r\n")); err != nil {
+		return fmt.Errorf("failed to write stop command: %v", err)
+	}
+	time.Sleep(runSettle)
+	vs.reader.Reset()
+	return nil
+}
+
+// pauseRun stops the output around a command so its reply is not lost among
+// the samples, returning the function that restarts it. Both run on the port
+// worker.
+func (vs *VaisalaSensor) pauseRun() (resume func(), err error) {
+	if vs.runInterval() == 0 {
+		return func() {}, nil
+	}
+	if err := vs.exitRun(); err != nil {
+		return nil, err
+	}
+	return func() {
+		if vs.runInterval() == 0 || vs.serialConn == nil {
+			return
+		}
+		if err := vs.writeCommand("r"); err != nil {
+			log.Printf("failed to restart vaisala run mode: %v", err)
+		}
+	}, nil
+}
+
+// follow reads the samples the probe prints until stop is closed. Each read
+// is a routine job on the port worker, so commands queued meanwhile go out
+// between two samples.
+func (vs *VaisalaSensor) follow(stop, done chan struct{}, interval time.Duration) {
+	defer close(done)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	wait := interval + vs.readTimeout
+	if vs.readTimeout <= 0 {
+		wait = interval + serialio.DefaultTimeout
+	}
+	for {
+		var line string
+		err := vs.port.Submit(ctx, portworker.Routine, func() error {
+			if vs.serialConn == nil {
+				return fmt.Errorf("vaisala sensor is not open")
+			}
+			var err error
+			line, err = vs.reader.ReadLineWithin(ctx, wait)
+			return err
+		})
+		if ctx.Err() != nil || errors.Is(err, portworker.ErrStopped) {
+			return
+		}
+		var values []Measurement
+		if err == nil {
+			values, err = parseSend(line)
+		} else {
+			err = fmt.Errorf("failed to read sample: %w", err)
+		}
+		vs.publish(values, err)
+		if err != nil { // give a reconnect time before reading again
+			select {
+			case <-time.After(interval):
+			case <-stop:
+				return
+			}
+		}
+	}
+}
+
+func (vs *VaisalaSensor) publish(values []Measurement, err error) {
+	vs.run.lock.Lock()
+	defer vs.run.lock.Unlock()
+	vs.run.values, vs.run.err = values, err
+	vs.run.seq++
+	close(vs.run.next)
+	vs.run.next = make(chan struct{})
+}
+
+// nextSample returns the oldest sample not yet handed out, waiting for the
+// probe to print one if need be. ok is false in poll mode, including when run
+// mode ends during the wait.
+func (vs *VaisalaSensor) nextSample(ctx context.Context) (values []Measurement, ok bool, err error) {
+	vs.run.lock.Lock()
+	if vs.run.interval == 0 {
+		vs.run.lock.Unlock()
+		return nil, false, nil
+	}
+	if vs.run.seq > vs.run.taken {
+		vs.run.taken = vs.run.seq
+		values, err = vs.run.values, vs.run.err
+		vs.run.lock.Unlock()
+		return values, true, err
+	}
+	next, stop := vs.run.next, vs.run.stop
+	vs.run.lock.Unlock()
+
+	select {
+	case <-next:
+	case <-stop:
+		return nil, false, nil
+	case <-ctx.Done():
+		return nil, true, ctx.Err()
+	}
+	vs.run.lock.Lock()
+	defer vs.run.lock.Unlock()
+	vs.run.taken = vs.run.seq
+	return vs.run.values, true, vs.run.err
+}
+
+// co2Of picks CO2 out of a sample.
+func co2Of(values []Measurement) (float64, error) {
+	for _, m := range values {
+		if m.Metric == "co2" {
+			return m.Value, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: sample has no CO2 field", sensorerr.ErrInvalidResponse)
+}
@@ -0,0 +1,93 @@
+package vaisala
+
+import (
+	"context"
+	"time"
+
+	"github.com/demelere/sensor-control-modules/internal/units"
+	"github.com/demelere/sensor-control-modules/pkg/sensor"
+)
+
+func init() {
+	// GMP251/GMP252 measuring range, at the default 1s poll
+	sensor.RegisterContract("vaisala", sensor.Contract{Metric: "co2", Unit: string(units.PPM), Min: 0, Max: 200000, Resolution: 1, Interval: time.Second})
+	// probe temperature over the GMP25x operating range; humidity and pressure
+	// from probes that measure them
+	sensor.RegisterContract("vaisala", sensor.Contract{Metric: "temperature", Unit: string(units.Celsius), Min: -40, Max: 60, Resolution: 0.01, Interval: time.Second})
+	sensor.RegisterContract("vaisala", sensor.Contract{Metric: "humidity", Unit: string(units.Percent), Min: 0, Max: 100, Resolution: 0.01, Interval: time.Second})
+	sensor.RegisterContract("vaisala", sensor.Contract{Metric: "pressure", Unit: string(units.HectoPascal), Min: 500, Max: 1100, Resolution: 0.01, Interval: time.Second})
+	sensor.Register("vaisala", func(cfg sensor.Config) (sensor.Sensor, error) {
+		vs, err := NewVaisalaSensor(cfg.BaudRate, cfg.Address)
+		if err != nil {
+			return nil, err
+		}
+		vs.SetReadTimeout(cfg.ReadTimeout)
+		vs.SetPort(cfg.Port)
+		vs.SetBus(SharedBus(cfg.Port, cfg.PortMatch)) // probes configured on one line share it
+		if err := vs.SetPortMatch(cfg.PortMatch); err != nil {
+			return nil, err
+		}
+		if err := vs.SetProtocol(Protocol(cfg.Protocol)); err != nil {
+			return nil, err
+		}
+		if err := vs.SetParameters(cfg.Parameters); err != nil {
+			return nil, err
+		}
+		return &registered{VaisalaSensor: vs, cfg: cfg, readings: make(chan sensor.Reading)}, nil
+	})
+}
+
+// registered adapts VaisalaSensor to sensor.Sensor.
+type registered struct {
+	*VaisalaSensor
+	cfg      sensor.Config
+	readings chan sensor.Reading
+}
+
+func (r *registered) Start(ctx context.Context) error {
+	if r.cfg.OnState != nil {
+		r.OnStateChange(func(e sensor.StateEvent) {
+			e.Sensor = r.cfg.Name
+			r.cfg.OnState(e)
+		})
+	}
+	if r.cfg.Stream {
+		if err := r.StartRun(r.cfg.PollInterval); err != nil {
+			return err
+		}
+	}
+	polled := r.VaisalaSensor.Start(ctx, r.cfg.PollInterval)
+	go func() {
+		defer close(r.readings)
+		for rd := range polled {
+			rd.Sensor = r.cfg.Name
+			select {
+			case r.readings <- rd:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (r *registered) Readings() <-chan sensor.Reading { return r.readings }
+
+// DeviceFaults lists the active faults by message, for sensor.Manager to
+// track.
+func (r *registered) DeviceFaults(ctx context.Context) ([]string, error) {
+	faults, err := r.Faults(ctx)
+	if err != nil {
+		return nil, err
+	}
+	msgs := make([]string, len(faults))
+	for i, f := range faults {
+		msgs[i] = f.Message
+	}
+	return msgs, nil
+}
+
+func (r *registered) Info() sensor.Info {
+	info := r.VaisalaSensor.Info()
+	return sensor.Info{Name: r.cfg.Name, Driver: "vaisala", Port: info.Port, Model: info.Model, SerialNumber: info.SerialNumber, SoftwareVersion: info.SoftwareVersion}
+}
@@ -0,0 +1,56 @@
+package vaisala
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Apply sets each probe parameter in settings by sending "<name> <value>"
+// (e.g. "intv 1 s", "form CO2"), in name order, as operator commands. It stops
+// at the first command the probe rejects.
+func (vs *VaisalaSensor) Apply(ctx context.Context, settings map[string]string) error {
+	names := make([]string, 0, len(settings))
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		reply, err := vs.Command(ctx, strings.TrimSpace(name+" "+settings[name]))
+		if err != nil {
+			return fmt.Errorf("failed to set %s: %w", name, err)
+		}
+		if rejected(reply) {
+			return fmt.Errorf("probe rejected %s %q: %s", name, settings[name], reply)
+		}
+	}
+	return nil
+}
+
+func rejected(reply string) bool {
+	lower := strings.ToLower(reply)
+	return strings.Contains(lower, "error") || strings.Contains(lower, "unknown") || strings.Contains(lower, "invalid")
+}
+
+// ReadSettings queries each named setting by sending its command without a
+// value (e.g. "intv", "form") and returns the current value from the reply,
+// taking the text after the last colon when the probe labels it
+// ("Output interval : 1 s").
+func (vs *VaisalaSensor) ReadSettings(ctx context.Context, names []string) (map[string]string, error) {
+	settings := make(map[string]string, len(names))
+	for _, name := range names {
+		reply, err := vs.Command(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		if rejected(reply) {
+			return nil, fmt.Errorf("probe rejected query for %s: %s", name, reply)
+		}
+		if i := strings.LastIndex(reply, ":"); i >= 0 {
+			reply = reply[i+1:]
+		}
+		settings[name] = strings.TrimSpace(reply)
+	}
+	return settings, nil
+}
@@ -0,0 +1,566 @@
+// Package vaisala drives a Vaisala CO2 probe on a USB serial cable: it finds
+// the cable (under /dev/serial/by-id on Linux, by USB ID elsewhere), addresses
+// the probe, and polls it for CO2 in ppm, and for temperature, humidity, and
+// pressure where the probe reports them (see SetParameters), over the probe's
+// terminal protocol or Modbus RTU (see SetProtocol). All methods are safe for
+// concurrent use; every command runs on the sensor's own port worker, one at a
+// time, or on the worker of the Bus it shares with other probes on the same
+// RS-485 line.
+package vaisala
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.bug.st/serial"
+
+	"github.com/demelere/sensor-control-modules/internal/discovery"
+	"github.com/demelere/sensor-control-modules/internal/modbus"
+	"github.com/demelere/sensor-control-modules/internal/portworker"
+	"github.com/demelere/sensor-control-modules/internal/reconnect"
+	"github.com/demelere/sensor-control-modules/internal/sensorerr"
+	"github.com/demelere/sensor-control-modules/internal/serialio"
+	"github.com/demelere/sensor-control-modules/pkg/sensor"
+)
+
+var (
+	vaisalaBaudRate                   int
+	vaisalaDefaultAddress             int
+	vaisalaDataBits                   int
+	vaisalaCable                      discovery.Spec
+	vaisalaRegexSensorModel           string
+	vaisalaRegexSensorSerialNumber    string
+	vaisalaRegexSensorSoftwareVersion string
+)
+
+// Errors returned by the driver, for use with errors.Is.
+var (
+	ErrNotFound        = sensorerr.ErrNotFound        // no probe cable on any serial port
+	ErrInvalidResponse = sensorerr.ErrInvalidResponse // the probe answered with something unparseable
+	ErrTimeout         = sensorerr.ErrTimeout         // no reply within the read timeout or the context deadline
+)
+
+// Info is the identity the probe reported when it was opened. Fields the
+// probe did not report are empty.
+type Info struct {
+	Port            string `json:"port"`
+	Model           string `json:"model,omitempty"`
+	SerialNumber    string `json:"serial_number,omitempty"`
+	SoftwareVersion string `json:"software_version,omitempty"`
+}
+
+// VaisalaSensor is one probe; create it with NewVaisalaSensor.
+type VaisalaSensor struct {
+	baudRate              int
+	dataBits              int
+	defaultAddress        int
+	portPath              string
+	portHint              string         // configured device, skips discovery
+	portMatch             *regexp.Regexp // narrows discovery
+	protocol              Protocol
+	parameters            []Parameter // from SetParameters; nil keeps the probe's form
+	run                   runState
+	line                  *Bus // set by SetBus, nil while the probe has the port to itself
+	serialConn            serial.Port
+	bus                   *modbus.Client // set while open over Modbus
+	stop                  chan struct{}  // closed by Close to end the Start loop
+	onState               func(sensor.StateEvent)
+	port                  *portworker.Worker // serialises all access to serialConn and reader; the bus's when shared
+	reader                *serialio.LineReader
+	prompted              bool // the probe ends each reply with its prompt; learned by request
+	readTimeout           time.Duration
+	sensorModel           string
+	sensorSerialNumber    string
+	sensorSoftwareVersion string
+}
+
+func init() {
+	vaisalaBaudRate = 19200
+	vaisalaDefaultAddress = 240
+	vaisalaDataBits = 8
+	vaisalaRegexSensorModel = "Device\\s+:\\s+(\\w+)"
+	vaisalaRegexSensorSerialNumber = "SNUM\\s+:\\s+(\\w+)"
+	vaisalaRegexSensorSoftwareVersion = "SW(?:\\s+version)?\\s+:\\s+([\\w.]+)"
+	vaisalaCable = discovery.Spec{
+		Driver: "vaisala",
+		ByID:   regexp.MustCompile("^usb-Silicon_Labs_Vaisala_USB"), // e.g. usb-Silicon_Labs_Vaisala_USB_Instrument_Cable_R3234317-if00-port0
+		USB:    []discovery.USBID{{VID: "10C4", PID: "EA60"}},       // the cable's CP210x bridge
+	}
+}
+
+// NewVaisalaSensor returns a sensor for the probe at defaultAddress on the
+// RS-485 bus behind the cable. Zero values select the defaults (19200 baud,
+// address 240). Nothing is opened until Open.
+func NewVaisalaSensor(baudRate int, defaultAddress int) (*VaisalaSensor, error) {
+	if baudRate == 0 {
+		baudRate = vaisalaBaudRate
+	}
+	if defaultAddress == 0 {
+		defaultAddress = vaisalaDefaultAddress
+	}
+
+	return &VaisalaSensor{
+		defaultAddress: defaultAddress,
+		baudRate:       baudRate,
+		dataBits:       vaisalaDataBits,
+		protocol:       ASCII,
+		port:           new(portworker.Worker),
+	}, nil
+}
+
+// SetReadTimeout sets how long each reply may take before the read fails
+// with ErrTimeout (default 2s). Call it before Open.
+func (vs *VaisalaSensor) SetReadTimeout(d time.Duration) {
+	vs.readTimeout = d
+}
+
+// SetPort skips discovery and opens path (e.g. /dev/ttyUSB1 or COM3) from
+// the next Open.
+func (vs *VaisalaSensor) SetPort(path string) {
+	vs.portHint = path
+}
+
+// SetPortMatch narrows discovery to the cables whose /dev/serial/by-id link
+// name (or "VID:PID serial" where there is none) matches pattern, for rigs
+// with more than one.
+func (vs *VaisalaSensor) SetPortMatch(pattern string) error {
+	if pattern == "" {
+		vs.portMatch = nil
+		return nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid port pattern: %v", err)
+	}
+	vs.portMatch = re
+	return nil
+}
+
+func (vs *VaisalaSensor) searchPorts() (string, error) {
+	if vs.portHint != "" {
+		log.Printf("using configured vaisala port %s", vs.portHint)
+		return vs.portHint, nil
+	}
+	log.Printf("searching for Vaisala sensor")
+	spec := vaisalaCable
+	spec.Match = vs.portMatch
+	port, err := discovery.Find(spec)
+	if err != nil {
+		return "", err
+	}
+	log.Printf("vaisala sensor found on port: %s", port)
+	return port, nil
+}
+
+// Open finds the probe, opens its port, and reads its identity (see Info).
+// Open, reads, and Close all run on the sensor's port worker, so concurrent
+// callers never interleave commands on the wire. Errors wrap ErrNotFound when
+// no probe cable is attached. A closed sensor can be opened again.
+func (vs *VaisalaSensor) Open() error {
+	if vs.line != nil {
+		if err := vs.line.attach(vs); err != nil {
+			return err
+		}
+	} else {
+		vs.port.Start()
+	}
+	return vs.port.Do(vs.open)
+}
+
+func (vs *VaisalaSensor) open() error {
+	vs.endLoop()
+	vs.stop = make(chan struct{})
+	return vs.connect()
+}
+
+// connect (re)discovers the probe and opens its port, leaving any Start loop
+// running.
+func (vs *VaisalaSensor) connect() error {
+	if vs.serialConn != nil {
+		err := vs.closePort()
+		if err != nil {
+			log.Printf("Error closing existing serial connection: %v", err)
+			// handle the error, depending on whether I want to proceed with opening a new connection?
+		}
+	}
+
+	var err error
+	if vs.line != nil {
+		err = vs.line.connect(vs)
+	} else {
+		err = vs.openPort()
+	}
+	if err != nil {
+		return err
+	}
+	running := vs.runInterval()
+
+	if vs.protocol == Modbus {
+		vs.bus, err = modbus.NewClient(vs.serialConn, vs.reader, vs.defaultAddress)
+		if err != nil {
+			return err
+		}
+		if err := vs.collectModbusInfo(); err != nil {
+			return fmt.Errorf("failed to collect probe information: %w", err)
+		}
+		return nil
+	}
+	// possibly a different probe, so learn its prompt again
+	vs.bus, vs.prompted = nil, false
+	if running > 0 { // reopened after a dropped link, the probe may still be printing samples
+		if err := vs.exitRun(); err != nil {
+			return err
+		}
+	}
+	if vs.line != nil {
+		err = vs.line.selectProbe(vs, true)
+	} else if _, err = vs.serialConn.Write([]byte(fmt.Sprintf("open %d\r\n", vs.defaultAddress))); err != nil {
+		err = fmt.Errorf("failed to write open command: %v", err)
+	} else { // drop the "line opened" banner and prompt, or a STOP mode probe's error
+		time.Sleep(selectSettle)
+		vs.reader.Reset()
+	}
+	if err != nil {
+		return err
+	}
+
+	err = vs.collectProbeInfo()
+	if err != nil {
+		return fmt.Errorf("failed to collect probe information: %v", err)
+	}
+
+	if err := vs.setForm(); err != nil {
+		return fmt.Errorf("failed to set output form: %w", err)
+	}
+	if running > 0 {
+		return vs.enterRun(running)
+	}
+	return nil
+}
+
+// openPort finds the cable and opens its port.
+func (vs *VaisalaSensor) openPort() error {
+	port, err := vs.searchPorts()
+	if err != nil {
+		return fmt.Errorf("failed to find Vaisala sensor: %w", err)
+	}
+	log.Printf("found Vaisala sensor at port: %s", port)
+	vs.portPath = port
+
+	mode := &serial.Mode{
+		BaudRate: vs.baudRate,
+		DataBits: vs.dataBits,
+		Parity:   serial.NoParity,
+		StopBits: serial.OneStopBit,
+	}
+	if vs.protocol == Modbus {
+		mode.StopBits = serial.TwoStopBits // the probe's Modbus default, 8N2
+	}
+
+	vs.serialConn, err = serial.Open(port, mode)
+	if err != nil {
+		return fmt.Errorf("failed to open serial connection: %w", err)
+	}
+	vs.serialConn = serialio.Traced(vs.serialConn, port)
+
+	vs.reader = serialio.NewLineReader(vs.serialConn, vs.readTimeout)
+	log.Printf("opened serial connection")
+	return nil
+}
+
+// closePort closes the port or, on a shared bus, lets go of it.
+func (vs *VaisalaSensor) closePort() error {
+	var err error
+	if vs.line != nil {
+		err = vs.line.release(vs)
+	} else {
+		err = vs.serialConn.Close()
+	}
+	vs.serialConn, vs.reader, vs.bus = nil, nil, nil
+	return err
+}
+
+// collectProbeInfo reads the identity from the probe's "?" listing, one
+// "name : value" line per setting.
+func (vs *VaisalaSensor) collectProbeInfo() error {
+	lines, err := vs.request(context.Background(), "?", true)
+	if err != nil {
+		return fmt.Errorf("failed to read probe info response: %w", err)
+	}
+	response := strings.Join(lines, "\n")
+
+	sensorModel := regexp.MustCompile(vaisalaRegexSensorModel).FindStringSubmatch(response)
+	if len(sensorModel) > 1 {
+		vs.sensorModel = sensorModel[1]
+	}
+
+	sensorSerialNumber := regexp.MustCompile(vaisalaRegexSensorSerialNumber).FindStringSubmatch(response)
+	if len(sensorSerialNumber) > 1 {
+		vs.sensorSerialNumber = sensorSerialNumber[1]
+	}
+
+	sensorSoftwareVersion := regexp.MustCompile(vaisalaRegexSensorSoftwareVersion).FindStringSubmatch(response)
+	if len(sensorSoftwareVersion) > 1 {
+		vs.sensorSoftwareVersion = sensorSoftwareVersion[1]
+	}
+
+	return nil
+}
+
+func (vs *VaisalaSensor) writeCommand(command string) error {
+	if vs.line != nil {
+		if err := vs.line.selectProbe(vs, false); err != nil {
+			return err
+		}
+	}
+	vs.reader.Discard()
+	_, err := vs.serialConn.Write([]byte(command + "\r\n")) // takes dynamic cmds instead of only hard-coded ones
+	if err != nil {
+		return fmt.Errorf("failed to write command: %v", err)
+	}
+	return nil
+}
+
+// ReadCO2 requests one measurement and returns CO2 in ppm. It waits behind any
+// command already queued on the port. Errors wrap ErrInvalidResponse when the
+// reply cannot be parsed.
+func (vs *VaisalaSensor) ReadCO2() (float64, error) {
+	return vs.ReadCO2Context(context.Background())
+}
+
+// ReadCO2Context is ReadCO2 returning ctx.Err() as soon as ctx is done, even
+// while the request is queued or waiting for its reply.
+func (vs *VaisalaSensor) ReadCO2Context(ctx context.Context) (float64, error) {
+	if values, ok, err := vs.nextSample(ctx); ok {
+		if err != nil {
+			return 0, err
+		}
+		return co2Of(values)
+	}
+	var co2 float64
+	err := vs.port.Submit(ctx, portworker.Routine, func() error {
+		var err error
+		co2, err = vs.readCO2(ctx)
+		return err
+	})
+	if errors.Is(err, portworker.ErrStopped) {
+		return 0, fmt.Errorf("vaisala sensor is not open: %w", err)
+	} else if err != nil {
+		return 0, err // co2 may still be written by an abandoned read
+	}
+	return co2, nil
+}
+
+func (vs *VaisalaSensor) readCO2(ctx context.Context) (float64, error) {
+	if vs.serialConn == nil {
+		return 0, fmt.Errorf("vaisala sensor is not open")
+	}
+	if vs.bus != nil {
+		co2, err := vs.readFloat(ctx, regCO2)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read CO2: %w", err)
+		}
+		return co2, nil
+	}
+
+	values, err := vs.send(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return co2Of(values)
+}
+
+// Command sends one raw command line (e.g. "errs" or "unit") and returns the
+// reply without the echo and the prompt, its lines joined by '\n'. It is
+// queued ahead of routine polls, so it waits at most for the poll already on
+// the wire. If ctx ends first, ctx.Err() is returned and a command not yet
+// sent is dropped.
+func (vs *VaisalaSensor) Command(ctx context.Context, command string) (string, error) {
+	return vs.command(ctx, portworker.Operator, command)
+}
+
+func (vs *VaisalaSensor) command(ctx context.Context, priority portworker.Priority, command string) (string, error) {
+	var reply string
+	err := vs.port.Submit(ctx, priority, func() error {
+		if vs.serialConn == nil {
+			return fmt.Errorf("vaisala sensor is not open")
+		}
+		if vs.bus != nil {
+			return fmt.Errorf("raw commands need the ascii protocol, the probe is on modbus")
+		}
+		resume, err := vs.pauseRun()
+		if err != nil {
+			return err
+		}
+		defer resume()
+		lines, err := vs.request(ctx, command, true)
+		if err != nil {
+			return err
+		}
+		reply = strings.Join(lines, "\n")
+		return nil
+	})
+	if errors.Is(err, portworker.ErrStopped) {
+		return "", fmt.Errorf("vaisala sensor is not open: %w", err)
+	} else if err != nil {
+		return "", err
+	}
+	return reply, nil
+}
+
+// Start polls the probe every interval (default 1s) on a background goroutine
+// after a successful Open, delivering one reading per parameter (metric "co2"
+// in ppm, "temperature" in degC, and so on, with the probe's serial number as
+// Sensor) on the returned channel.
+// Failed reads are logged and retried on the next tick. The loop stops and
+// closes the channel when ctx is done or the sensor is closed or reopened,
+// without waiting for the consumer to take a pending reading.
+func (vs *VaisalaSensor) Start(ctx context.Context, interval time.Duration) <-chan sensor.Reading {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ch := make(chan sensor.Reading)
+	var stop chan struct{}
+	vs.port.Do(func() error {
+		stop = vs.stop
+		return nil
+	})
+	if stop == nil { // not open
+		close(ch)
+		return ch
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	go func() { // a Close ends the loop like a cancel
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	go func() {
+		defer close(ch)
+		defer cancel()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		link := reconnect.NewTracker(reconnect.DefaultPolicy)
+		id := vs.sensorID()
+		for {
+			values, err := vs.ReadMeasurements(ctx)
+			if ctx.Err() != nil || errors.Is(err, portworker.ErrStopped) {
+				return
+			} else if err != nil {
+				log.Printf("failed to read vaisala probe: %v", err)
+				if link.Observe(err) {
+					if vs.reconnect(ctx, err) != nil {
+						return
+					}
+					id = vs.sensorID() // possibly a different probe
+				}
+			} else {
+				link.Observe(nil)
+				now := time.Now().UTC()
+				for _, m := range values {
+					rd := sensor.Reading{Sensor: id, Metric: m.Metric, Value: m.Value, Unit: m.Unit, Time: now, Quality: sensor.Good}
+					select {
+					case ch <- rd:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+			if vs.Running() && err == nil { // samples come at the probe's pace
+				continue
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// OnStateChange sets a handler for the connection state changes Start goes
+// through when the probe stops answering: it is declared disconnected, then
+// rediscovered and reopened with exponential backoff. Set it before Start.
+func (vs *VaisalaSensor) OnStateChange(fn func(sensor.StateEvent)) {
+	vs.onState = fn
+}
+
+func (vs *VaisalaSensor) reconnect(ctx context.Context, cause error) error {
+	notify := func(e sensor.StateEvent) {
+		log.Printf("vaisala sensor %s (attempt %d): %v", e.State, e.Attempt, e.Err)
+		if vs.onState != nil {
+			vs.onState(e)
+		}
+	}
+	disconnect := func() error {
+		return vs.port.Do(func() error {
+			if vs.serialConn == nil {
+				return nil
+			}
+			return vs.closePort()
+		})
+	}
+	return reconnect.Reconnect(ctx, reconnect.DefaultPolicy, cause, disconnect, func() error { return vs.port.Do(vs.connect) }, notify)
+}
+
+// Info returns the port and identity found by the last Open. It is the zero
+// Info while the sensor is closed.
+func (vs *VaisalaSensor) Info() Info {
+	var info Info
+	vs.port.Do(func() error {
+		info = Info{Port: vs.portPath, Model: vs.sensorModel, SerialNumber: vs.sensorSerialNumber, SoftwareVersion: vs.sensorSoftwareVersion}
+		return nil
+	})
+	return info
+}
+
+// sensorID names readings from Start: the serial number, or the driver name
+// for a probe that did not report one.
+func (vs *VaisalaSensor) sensorID() string {
+	if sn := vs.Info().SerialNumber; sn != "" {
+		return sn
+	}
+	return "vaisala"
+}
+
+func (vs *VaisalaSensor) endLoop() {
+	if vs.stop != nil {
+		close(vs.stop)
+		vs.stop = nil
+	}
+}
+
+// Close waits for any in-flight command, stops the Start loop and run mode,
+// closes the port, and stops the worker. On a shared bus the port and worker
+// stay up until the last probe closes. The sensor can be opened again afterwards.
+func (vs *VaisalaSensor) Close() error {
+	running := vs.endRun()
+	err := vs.port.Do(func() error {
+		vs.endLoop()
+		if vs.serialConn == nil {
+			return nil
+		}
+		if running {
+			vs.exitRun() // leave the probe answering "send" for whoever opens it next
+		}
+		return vs.closePort()
+	})
+	if vs.line != nil {
+		vs.line.detach(vs) // the last probe off the bus stops its worker
+	} else {
+		vs.port.Stop()
+	}
+	if errors.Is(err, portworker.ErrStopped) { // never opened, or already closed
+		return nil
+	}
+	return err
+}